@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"expvar"
+	"log"
+	"math"
+	"net/http"
+	"net/http/pprof"
+	"runtime/metrics"
+	"time"
+)
+
+// 수집기 관리용 HTTP 서버. 메트릭은 expvar 로 /debug/vars 에 JSON 으로 나온다.
+// 다른 구성 요소는 adminMux 에 핸들러를, expvar 에 메트릭을 등록한다.
+//
+// 부하 중에 다시 빌드하지 않고 프로필을 뜰 수 있도록 net/http/pprof 도 붙인다.
+//
+//	go tool pprof http://127.0.0.1:6060/debug/pprof/profile?seconds=30   CPU
+//	go tool pprof http://127.0.0.1:6060/debug/pprof/heap                 힙
+//	curl http://127.0.0.1:6060/debug/pprof/goroutine?debug=2             고루틴 스택
+//
+// block, mutex 프로필은 collect -block-profile-rate, -mutex-profile-fraction 을 켜야 모인다.
+// 고루틴 수, 힙, GC 요약은 expvar "runtime" 과 GET /debug/runtime 으로 본다 (전체 MemStats 는 expvar "memstats").
+// 관리 서버에는 인증이 없으므로 외부에 열지 않는다.
+
+var adminMux = http.NewServeMux()
+
+var startedAt = time.Now()
+
+func init() {
+	adminMux.Handle("GET /debug/vars", expvar.Handler())
+	adminMux.HandleFunc("/debug/pprof/", pprof.Index)
+	adminMux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	adminMux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	adminMux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	adminMux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	expvar.Publish("runtime", expvar.Func(func() any { return readRuntimeStats() }))
+	adminMux.HandleFunc("GET /debug/runtime", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(readRuntimeStats())
+	})
+
+	// 싱크 상태 (breaker.go). 싱크가 없으면 빈 배열이다
+	expvar.Publish("sinks", expvar.Func(func() any { return sinkStatuses() }))
+	adminMux.HandleFunc("GET /sinks", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sinkStatuses())
+	})
+}
+
+func startAdminServer(addr string) {
+	go func() {
+		log.Printf("Admin server on %s", addr)
+		if err := http.ListenAndServe(addr, adminMux); err != nil {
+			log.Printf("Admin server stopped: %v", err)
+		}
+	}()
+}
+
+type runtimeStats struct {
+	Uptime      string  `json:"uptime"`
+	Goroutines  uint64  `json:"goroutines"`
+	GOMAXPROCS  uint64  `json:"gomaxprocs"`
+	HeapBytes   uint64  `json:"heapBytes"` // 살아 있는 객체와 아직 쓸어 가지 않은 객체
+	HeapObjects uint64  `json:"heapObjects"`
+	HeapGoal    uint64  `json:"heapGoal"`   // 다음 GC 가 시작되는 힙 크기
+	TotalBytes  uint64  `json:"totalBytes"` // 런타임이 OS 에서 받은 메모리 전체
+	GCCycles    uint64  `json:"gcCycles"`
+	GCPauseP50  float64 `json:"gcPauseP50Ms"` // 시작 후 전체 GC 멈춤 분포
+	GCPauseP99  float64 `json:"gcPauseP99Ms"`
+	GCPauseMax  float64 `json:"gcPauseMaxMs"`
+	GCCPU       float64 `json:"gcCpuFraction"` // 시작 후 CPU 시간 중 GC 비율
+}
+
+// runtime/metrics 는 MemStats 와 달리 세계를 멈추지 않으므로 자주 긁어도 된다
+var runtimeSamples = []string{
+	"/sched/goroutines:goroutines",
+	"/sched/gomaxprocs:threads",
+	"/memory/classes/heap/objects:bytes",
+	"/gc/heap/objects:objects",
+	"/gc/heap/goal:bytes",
+	"/memory/classes/total:bytes",
+	"/gc/cycles/total:gc-cycles",
+	"/sched/pauses/total/gc:seconds",
+	"/cpu/classes/gc/total:cpu-seconds",
+	"/cpu/classes/total:cpu-seconds",
+}
+
+func readRuntimeStats() runtimeStats {
+	samples := make([]metrics.Sample, len(runtimeSamples))
+	for i, name := range runtimeSamples {
+		samples[i].Name = name
+	}
+	metrics.Read(samples)
+	u64 := func(i int) uint64 {
+		if samples[i].Value.Kind() != metrics.KindUint64 {
+			return 0
+		}
+		return samples[i].Value.Uint64()
+	}
+	f64 := func(i int) float64 {
+		if samples[i].Value.Kind() != metrics.KindFloat64 {
+			return 0
+		}
+		return samples[i].Value.Float64()
+	}
+	st := runtimeStats{
+		Uptime:      time.Since(startedAt).Round(time.Second).String(),
+		Goroutines:  u64(0),
+		GOMAXPROCS:  u64(1),
+		HeapBytes:   u64(2),
+		HeapObjects: u64(3),
+		HeapGoal:    u64(4),
+		TotalBytes:  u64(5),
+		GCCycles:    u64(6),
+	}
+	if samples[7].Value.Kind() == metrics.KindFloat64Histogram {
+		h := samples[7].Value.Float64Histogram()
+		st.GCPauseP50 = 1000 * histogramQuantile(h, 0.5)
+		st.GCPauseP99 = 1000 * histogramQuantile(h, 0.99)
+		st.GCPauseMax = 1000 * histogramQuantile(h, 1)
+	}
+	if total := f64(9); total > 0 {
+		st.GCCPU = f64(8) / total
+	}
+	return st
+}
+
+// 히스토그램에서 q 분위가 들어 있는 구간의 위쪽 경계. 경계가 무한대면 아래쪽 경계.
+func histogramQuantile(h *metrics.Float64Histogram, q float64) float64 {
+	var total uint64
+	for _, c := range h.Counts {
+		total += c
+	}
+	if total == 0 {
+		return 0
+	}
+	target := uint64(math.Ceil(q * float64(total)))
+	var n uint64
+	for i, c := range h.Counts {
+		n += c
+		if n >= max(target, 1) {
+			if upper := h.Buckets[i+1]; !math.IsInf(upper, 0) {
+				return upper
+			}
+			return max(h.Buckets[i], 0)
+		}
+	}
+	return 0
+}
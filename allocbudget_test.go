@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"orderbook/orderbook"
+)
+
+// 메시지 하나를 처리하는 데 드는 할당 수의 상한. 기능이 붙으면서 핫 패스의 할당이 늘면
+// GC 가 잦아지고 쓰기 지연의 꼬리가 길어지므로 go test 로 확인한다. 의도한 증가라면 여기 상한을 함께 올린다.
+
+type allocBudget struct {
+	name   string
+	budget float64 // 메시지당 최대 할당 횟수
+	setup  func(t *testing.T) (run func(), err error)
+}
+
+var allocBudgets = []allocBudget{
+	{"parse depth20 snapshot", 8, func(t *testing.T) (func(), error) {
+		return parseFixture(t, "ethusdt@depth20@100ms", depthSnapshotFixture(20), func(ev *orderbook.Event) error {
+			if s := ev.GetSnapshot(); s == nil || len(s.Bids) != 20 || len(s.Asks) != 20 {
+				return fmt.Errorf("want a 20-level snapshot, got %v", ev.Payload)
+			}
+			return nil
+		})
+	}},
+	{"parse depth diff", 8, func(t *testing.T) (func(), error) {
+		return parseFixture(t, "ethusdt@depth@100ms", depthDiffFixture(10), func(ev *orderbook.Event) error {
+			if d := ev.GetDepthDiff(); d == nil || len(d.Bids) != 10 || len(d.Asks) != 10 {
+				return fmt.Errorf("want a 10-level depth diff, got %v", ev.Payload)
+			}
+			return nil
+		})
+	}},
+	{"parse trade", 5, func(t *testing.T) (func(), error) {
+		data := json.RawMessage(`{"e":"trade","E":1776092400000,"s":"ETHUSDT","t":12345,"p":"3012.34000000","q":"0.01230000","T":1776092400000,"m":true,"M":true}`)
+		return parseFixture(t, "ethusdt@trade", data, func(ev *orderbook.Event) error {
+			if tr := ev.GetTrade(); tr == nil || tr.TradeId != 12345 || tr.Price != 3012.34 {
+				return fmt.Errorf("want trade 12345 at 3012.34, got %v", ev.Payload)
+			}
+			return nil
+		})
+	}},
+	{"write event (none)", 1, func(t *testing.T) (func(), error) {
+		return writeFixture(t, orderbook.Compression_COMPRESSION_NONE)
+	}},
+	{"write event (zstd)", 1, func(t *testing.T) (func(), error) {
+		return writeFixture(t, orderbook.Compression_COMPRESSION_ZSTD)
+	}},
+	{"collect pipeline (depth20, zstd)", 8, func(t *testing.T) (func(), error) {
+		msg, err := json.Marshal(CombinedStreamEvent{Stream: "ethusdt@depth20@100ms", Data: depthSnapshotFixture(20)})
+		if err != nil {
+			return nil, err
+		}
+		w, err := orderbook.NewWriter(bufio.NewWriter(io.Discard), &orderbook.FileHeader{Compression: orderbook.Compression_COMPRESSION_ZSTD}, nil)
+		if err != nil {
+			return nil, err
+		}
+		var (
+			seq     uint64
+			decoder combinedDecoder // 수집 루프처럼 연결 동안 재사용한다
+		)
+		step := func() error {
+			stream, data, err := decoder.decode(msg)
+			if err != nil {
+				return err
+			}
+			ev, err := parseStreamEvent(stream, data, time.Now())
+			if err != nil {
+				return err
+			}
+			if ev.GetSnapshot() == nil {
+				return fmt.Errorf("want a snapshot, got %v", ev.Payload)
+			}
+			seq++
+			ev.Sequence = seq
+			return w.Write(ev)
+		}
+		if err := step(); err != nil {
+			return nil, err
+		}
+		return func() {
+			if err := step(); err != nil {
+				t.Error(err)
+			}
+		}, nil
+	}},
+}
+
+// 파싱이 일찍 실패하면 할당이 줄어 상한을 통과하므로, 재기 전에 한 번 파싱해 check 로 결과를 확인한다
+func parseFixture(t *testing.T, stream string, data json.RawMessage, check func(ev *orderbook.Event) error) (func(), error) {
+	ev, err := parseStreamEvent(stream, data, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if err := check(ev); err != nil {
+		return nil, err
+	}
+	return func() {
+		if _, err := parseStreamEvent(stream, data, time.Now()); err != nil {
+			t.Error(err)
+		}
+	}, nil
+}
+
+func TestAllocBudgets(t *testing.T) {
+	for _, b := range allocBudgets {
+		t.Run(b.name, func(t *testing.T) {
+			run, err := b.setup(t)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := testing.AllocsPerRun(1000, run); got > b.budget {
+				t.Errorf("%.1f allocs per message, budget %.0f", got, b.budget)
+			}
+		})
+	}
+}
+
+// 바이낸스 partial depth 메시지와 같은 모양의 data
+func depthSnapshotFixture(levels int) json.RawMessage {
+	var b strings.Builder
+	b.WriteString(`{"lastUpdateId":160,"bids":[`)
+	writeLevelsFixture(&b, levels, 3000)
+	b.WriteString(`],"asks":[`)
+	writeLevelsFixture(&b, levels, 3001)
+	b.WriteString(`]}`)
+	return json.RawMessage(b.String())
+}
+
+func depthDiffFixture(levels int) json.RawMessage {
+	var b strings.Builder
+	b.WriteString(`{"e":"depthUpdate","E":1776092400000,"s":"ETHUSDT","U":157,"u":160,"b":[`)
+	writeLevelsFixture(&b, levels, 3000)
+	b.WriteString(`],"a":[`)
+	writeLevelsFixture(&b, levels, 3001)
+	b.WriteString(`]}`)
+	return json.RawMessage(b.String())
+}
+
+func writeLevelsFixture(b *strings.Builder, n int, base float64) {
+	for i := range n {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(b, `["%s","%s"]`, strconv.FormatFloat(base+float64(i)*0.01, 'f', 8, 64), "1.50000000")
+	}
+}
+
+// 이미 만들어진 이벤트를 쓰는 데 드는 할당 (파싱 제외)
+func writeFixture(t *testing.T, comp orderbook.Compression) (func(), error) {
+	ev, err := parseStreamEvent("ethusdt@depth20@100ms", depthSnapshotFixture(20), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	w, err := orderbook.NewWriter(bufio.NewWriter(io.Discard), &orderbook.FileHeader{Compression: comp}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		ev.Sequence++
+		if err := w.Write(ev); err != nil {
+			t.Error(err)
+		}
+	}, nil
+}
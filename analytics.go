@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+	"orderbook/orderbook"
+)
+
+// 스냅샷마다 특징값을 계산해 시계열로 내보낸다 (orderbook/analytics.go).
+//
+//	-metric imbalance   mid, microprice, imbalance_top (최우선 호가만), imbalance (상위 -levels 개, 가중치 -decay^i)
+//	-metric liquidity   mid 와, -bands 의 밴드마다 mid 에서 그 bps 이내의 수량/금액
+//	                    (bid_qty_10bps, ask_qty_10bps, bid_notional_10bps, ask_notional_10bps, ...)
+//	-metric vwap        mid 와, -sizes 의 주문 수량마다 시장가로 쓸었을 때의 평균 체결가와 mid 대비 비용(bps)
+//	                    (buy_vwap_1, sell_vwap_1, buy_cost_bps_1, sell_cost_bps_1, ...). 기록된 호가로 다 채울 수 없으면 빈 칸
+//
+// 앞의 두 열은 event_time (수신 시각 UTC ms) 과 symbol. -symbol 에 여러 심볼을 주면 심볼 순서대로 이어 쓴다.
+// -format csv 는 표준 출력(또는 -out)에, parquet 은 -out 파일에 쓴다.
+// 한쪽 호가가 비어 계산할 수 없는 값은 CSV 에서 빈 칸, Parquet 에서 null 이다.
+
+// 스냅샷 하나에서 columns 순서대로 값을 계산한다
+type snapshotMetric struct {
+	columns []string
+	compute func(s *orderbook.Snapshot, row []float64) []float64
+}
+
+type analyticsOptions struct {
+	levels int
+	decay  float64
+	bands  string
+	sizes  string
+}
+
+func (o *analyticsOptions) register(fs *flag.FlagSet) {
+	fs.IntVar(&o.levels, "levels", 5, "imbalance: levels per side")
+	fs.Float64Var(&o.decay, "decay", 0.5, "imbalance: weight of level i is decay^i (1 weighs all levels equally)")
+	fs.StringVar(&o.bands, "bands", "10,25,50,100", "liquidity: comma-separated bps bands around mid")
+	fs.StringVar(&o.sizes, "sizes", "1,5,10,50", "vwap: comma-separated order sizes in base asset units")
+}
+
+func parseFloatList(s string) ([]float64, error) {
+	var out []float64
+	for _, v := range splitList(s) {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f <= 0 {
+			return nil, fmt.Errorf("invalid value %q", v)
+		}
+		out = append(out, f)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("empty list")
+	}
+	return out, nil
+}
+
+func newSnapshotMetric(name string, o analyticsOptions) (*snapshotMetric, error) {
+	switch name {
+	case "imbalance":
+		if o.levels <= 0 || o.decay <= 0 {
+			return nil, fmt.Errorf("-levels and -decay must be positive")
+		}
+		return &snapshotMetric{
+			columns: []string{"mid", "microprice", "imbalance_top", "imbalance"},
+			compute: func(s *orderbook.Snapshot, row []float64) []float64 {
+				return append(row,
+					orderbook.Mid(s.Bids, s.Asks),
+					orderbook.Microprice(s.Bids, s.Asks),
+					orderbook.Imbalance(s.Bids, s.Asks, 1, 1),
+					orderbook.Imbalance(s.Bids, s.Asks, o.levels, o.decay))
+			},
+		}, nil
+	case "liquidity":
+		bands, err := parseFloatList(o.bands)
+		if err != nil {
+			return nil, fmt.Errorf("-bands: %w", err)
+		}
+		m := &snapshotMetric{columns: []string{"mid"}}
+		for _, b := range bands {
+			bps := strconv.FormatFloat(b, 'f', -1, 64) + "bps"
+			m.columns = append(m.columns, "bid_qty_"+bps, "ask_qty_"+bps, "bid_notional_"+bps, "ask_notional_"+bps)
+		}
+		m.compute = func(s *orderbook.Snapshot, row []float64) []float64 {
+			mid := orderbook.Mid(s.Bids, s.Asks)
+			row = append(row, mid)
+			for _, b := range bands {
+				bq, bn := orderbook.LiquidityWithin(s.Bids, mid, b, true)
+				aq, an := orderbook.LiquidityWithin(s.Asks, mid, b, false)
+				row = append(row, bq, aq, bn, an)
+			}
+			return row
+		}
+		return m, nil
+	case "vwap":
+		sizes, err := parseFloatList(o.sizes)
+		if err != nil {
+			return nil, fmt.Errorf("-sizes: %w", err)
+		}
+		m := &snapshotMetric{columns: []string{"mid"}}
+		for _, size := range sizes {
+			q := strconv.FormatFloat(size, 'f', -1, 64)
+			m.columns = append(m.columns, "buy_vwap_"+q, "sell_vwap_"+q, "buy_cost_bps_"+q, "sell_cost_bps_"+q)
+		}
+		m.compute = func(s *orderbook.Snapshot, row []float64) []float64 {
+			mid := orderbook.Mid(s.Bids, s.Asks)
+			row = append(row, mid)
+			for _, size := range sizes {
+				buy := fillVWAP(orderbook.WalkLevels(s.Asks, size, true))
+				sell := fillVWAP(orderbook.WalkLevels(s.Bids, size, false))
+				row = append(row, buy, sell, (buy-mid)/mid*1e4, (mid-sell)/mid*1e4)
+			}
+			return row
+		}
+		return m, nil
+	default:
+		return nil, fmt.Errorf("unknown metric %q (imbalance, liquidity, vwap)", name)
+	}
+}
+
+// 다 채운 주문의 평균 체결가. 책이 모자라면 NaN.
+func fillVWAP(f orderbook.Fill) float64 {
+	if !f.Complete {
+		return math.NaN()
+	}
+	return f.AvgPrice
+}
+
+func runAnalytics(args []string) error {
+	fs := flag.NewFlagSet("analytics", flag.ExitOnError)
+	metricName := fs.String("metric", "imbalance", "what to compute per snapshot: imbalance, liquidity or vwap")
+	symbolList := fs.String("symbol", "", "symbol, or comma-separated symbols")
+	var rng rangeFlags
+	rng.register(fs)
+	var opts analyticsOptions
+	opts.register(fs)
+	format := fs.String("format", "csv", "output format: csv or parquet")
+	outPath := fs.String("out", "", "output file (required for parquet; csv defaults to stdout)")
+	dataDir := fs.String("data", defaultDataDir, "data directory")
+	noProgress := fs.Bool("no-progress", false, "disable the progress bar")
+	fs.Parse(args)
+
+	symbols := splitList(*symbolList)
+	if len(symbols) == 0 {
+		return fmt.Errorf("-symbol is required")
+	}
+	metric, err := newSnapshotMetric(*metricName, opts)
+	if err != nil {
+		return err
+	}
+	from, to, err := rng.resolve()
+	if err != nil {
+		return err
+	}
+	var (
+		files []dataFile
+		size  int64
+	)
+	for _, symbol := range symbols {
+		found := dataFilesInRange(*dataDir, symbol, from, to)
+		if len(found) == 0 {
+			return fmt.Errorf("no data for %s in %s", symbol, rng.String())
+		}
+		files = append(files, found...)
+	}
+	for _, f := range files {
+		size += f.size
+	}
+
+	var out analyticsOutput
+	switch *format {
+	case "csv":
+		var w io.Writer = os.Stdout
+		if *outPath != "" {
+			f, err := os.Create(*outPath)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			w = f
+		}
+		out = newAnalyticsCSV(w, metric.columns)
+	case "parquet":
+		if *outPath == "" {
+			return fmt.Errorf("-format parquet needs -out")
+		}
+		if out, err = newAnalyticsParquet(*outPath, metric.columns); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown format %q (use csv or parquet)", *format)
+	}
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+	progress := NewProgress("analytics", size, !*noProgress)
+	var (
+		n   int
+		row []float64
+	)
+	for _, f := range files {
+		symbol := strings.ToUpper(fileSymbol(f.path))
+		err := scanFile(ctx, f.path, from, to, progress, func(r *orderbook.Reader, ev *orderbook.Event) error {
+			s := ev.GetSnapshot()
+			if s == nil {
+				return nil
+			}
+			row = metric.compute(s, row[:0])
+			n++
+			return out.write(ev.EventTime, symbol, row)
+		})
+		if err != nil {
+			out.abort()
+			return err
+		}
+	}
+	progress.Finish()
+	if err := out.close(); err != nil {
+		return err
+	}
+	log.Printf("Computed %s for %d snapshots", *metricName, n)
+	return nil
+}
+
+type analyticsOutput interface {
+	write(eventTime int64, symbol string, row []float64) error
+	close() error
+	abort() // 실패했을 때 반쪽 파일을 남기지 않는다
+}
+
+type analyticsCSV struct {
+	w   *bufio.Writer
+	buf []byte
+}
+
+func newAnalyticsCSV(w io.Writer, columns []string) *analyticsCSV {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("event_time,symbol," + strings.Join(columns, ",") + "\n")
+	return &analyticsCSV{w: bw}
+}
+
+func (c *analyticsCSV) write(eventTime int64, symbol string, row []float64) error {
+	b := strconv.AppendInt(c.buf[:0], eventTime, 10)
+	b = append(append(b, ','), symbol...)
+	for _, v := range row {
+		b = append(b, ',')
+		if !math.IsNaN(v) {
+			b = strconv.AppendFloat(b, v, 'f', -1, 64)
+		}
+	}
+	c.buf = append(b, '\n')
+	_, err := c.w.Write(c.buf)
+	return err
+}
+
+func (c *analyticsCSV) close() error { return c.w.Flush() }
+
+func (c *analyticsCSV) abort() { c.w.Flush() }
+
+// 열이 지표마다 달라 스키마를 실행 중에 만든다. .tmp 에 쓴 뒤 옮긴다.
+type analyticsParquet struct {
+	path    string
+	f       *os.File
+	w       *parquet.Writer
+	time    int // 각 열의 parquet 열 번호 (Group 은 이름순으로 놓인다)
+	symbol  int
+	columns []int
+	rows    []parquet.Row
+}
+
+func newAnalyticsParquet(path string, columns []string) (*analyticsParquet, error) {
+	group := parquet.Group{
+		"event_time": parquet.Timestamp(parquet.Millisecond),
+		"symbol":     parquet.Encoded(parquet.String(), &parquet.RLEDictionary),
+	}
+	for _, c := range columns {
+		group[c] = parquet.Optional(parquet.Leaf(parquet.DoubleType))
+	}
+	schema := parquet.NewSchema("analytics", group)
+	index := func(name string) int {
+		leaf, _ := schema.Lookup(name)
+		return leaf.ColumnIndex
+	}
+
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return nil, err
+	}
+	p := &analyticsParquet{
+		path:   path,
+		f:      f,
+		w:      parquet.NewWriter(f, schema, parquet.Compression(&parquet.Zstd), parquet.MaxRowsPerRowGroup(1<<20)),
+		time:   index("event_time"),
+		symbol: index("symbol"),
+	}
+	for _, c := range columns {
+		p.columns = append(p.columns, index(c))
+	}
+	return p, nil
+}
+
+func (p *analyticsParquet) write(eventTime int64, symbol string, row []float64) error {
+	r := make(parquet.Row, len(row)+2)
+	r[p.time] = parquet.Int64Value(eventTime).Level(0, 0, p.time)
+	r[p.symbol] = parquet.ByteArrayValue([]byte(symbol)).Level(0, 0, p.symbol)
+	for i, v := range row {
+		c := p.columns[i]
+		if math.IsNaN(v) {
+			r[c] = parquet.NullValue().Level(0, 0, c)
+		} else {
+			r[c] = parquet.DoubleValue(v).Level(0, 1, c)
+		}
+	}
+	p.rows = append(p.rows, r)
+	if len(p.rows) < 1024 {
+		return nil
+	}
+	_, err := p.w.WriteRows(p.rows)
+	p.rows = p.rows[:0]
+	return err
+}
+
+func (p *analyticsParquet) close() error {
+	if _, err := p.w.WriteRows(p.rows); err != nil {
+		p.abort()
+		return err
+	}
+	if err := p.w.Close(); err != nil {
+		p.abort()
+		return err
+	}
+	if err := p.f.Close(); err != nil {
+		os.Remove(p.f.Name())
+		return err
+	}
+	return os.Rename(p.f.Name(), p.path)
+}
+
+func (p *analyticsParquet) abort() {
+	p.f.Close()
+	os.Remove(p.f.Name())
+}
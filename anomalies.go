@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"orderbook/orderbook"
+)
+
+// 스냅샷의 최우선 호가를 훑어 이상한 데이터를 찾는다. 분석 전에 걸러낼 날짜나 시각을 고르는 용도.
+//
+//	crossed   매수 최우선가 > 매도 최우선가 (음수 스프레드)
+//	locked    매수 최우선가 = 매도 최우선가
+//	jump      직전 스냅샷 대비 중간가 로그 수익률이 최근 변동성의 -sigma 배를 넘는다
+//
+// 변동성은 최근 약 -window 개 수익률의 지수가중 표준편차다. 처음 -window 개 동안은 jump 를 판정하지 않고,
+// 잡힌 jump 는 변동성에 넣지 않는다 (튄 값 하나가 뒤의 판정을 무디게 하지 않도록).
+// 조용한 책에서 한 틱 움직임이 수십 sigma 로 잡히지 않게 -min-bps 보다 작은 움직임은 jump 로 보지 않는다.
+// crossed/locked 스냅샷은 중간가 계열에서 빼므로 그 앞뒤를 잇는 움직임으로 판정한다.
+//
+// 기본 출력은 날짜(-convention 기준 파일 날짜)와 심볼별 요약 CSV, -events 면 잡힌 스냅샷마다 한 줄이다.
+
+type anomalyOptions struct {
+	sigma  float64
+	window int
+	minBps float64
+}
+
+func runAnomalies(args []string) error {
+	fs := flag.NewFlagSet("anomalies", flag.ExitOnError)
+	symbolList := fs.String("symbol", "", "symbol, or comma-separated symbols")
+	var rng rangeFlags
+	rng.register(fs)
+	var opts anomalyOptions
+	fs.Float64Var(&opts.sigma, "sigma", 8, "flag mid jumps larger than this many standard deviations")
+	fs.IntVar(&opts.window, "window", 1000, "snapshots in the volatility estimate (and warm-up before judging jumps)")
+	fs.Float64Var(&opts.minBps, "min-bps", 5, "never flag mid moves smaller than this (bps)")
+	events := fs.Bool("events", false, "list every flagged snapshot instead of the per-day report")
+	dataDir := fs.String("data", defaultDataDir, "data directory")
+	noProgress := fs.Bool("no-progress", false, "disable the progress bar")
+	fs.Parse(args)
+
+	symbols := splitList(*symbolList)
+	if len(symbols) == 0 {
+		return fmt.Errorf("-symbol is required")
+	}
+	if opts.sigma <= 0 || opts.window <= 0 || opts.minBps < 0 {
+		return fmt.Errorf("-sigma and -window must be positive and -min-bps not negative")
+	}
+	from, to, err := rng.resolve()
+	if err != nil {
+		return err
+	}
+	var (
+		files []dataFile
+		size  int64
+	)
+	for _, symbol := range symbols {
+		found := dataFilesInRange(*dataDir, symbol, from, to)
+		if len(found) == 0 {
+			return fmt.Errorf("no data for %s in %s", symbol, rng.String())
+		}
+		files = append(files, found...)
+		for _, f := range found {
+			size += f.size
+		}
+	}
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+	bw := bufio.NewWriter(os.Stdout)
+	if *events {
+		io.WriteString(bw, "date,event_time,symbol,kind,bid,ask,mid,prev_mid,z\n")
+	} else {
+		io.WriteString(bw, "date,symbol,snapshots,crossed,locked,jumps,max_abs_z,first_anomaly\n")
+	}
+	progress := NewProgress("anomalies", size, !*noProgress)
+	var (
+		d     *anomalyDetector
+		day   *anomalyDay
+		total int
+	)
+	flushDay := func() {
+		if day != nil && !*events {
+			day.write(bw)
+		}
+	}
+	for _, f := range files {
+		symbol := strings.ToUpper(fileSymbol(f.path))
+		if d == nil || d.symbol != symbol {
+			d = newAnomalyDetector(symbol, opts)
+		}
+		if day == nil || day.date != f.date || day.symbol != symbol {
+			flushDay()
+			day = &anomalyDay{date: f.date, symbol: symbol, maxZ: math.NaN()}
+		}
+		err := scanFile(ctx, f.path, from, to, progress, func(r *orderbook.Reader, ev *orderbook.Event) error {
+			s := ev.GetSnapshot()
+			if s == nil {
+				return nil
+			}
+			a, ok := d.check(ev.EventTime, s)
+			day.add(a, ok)
+			if ok {
+				total++
+				if *events {
+					a.write(bw, f.date, symbol)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	flushDay()
+	progress.Finish()
+	log.Printf("Found %d anomalies", total)
+	return bw.Flush()
+}
+
+type anomaly struct {
+	time     int64
+	kind     string
+	bid, ask float64
+	mid      float64
+	prevMid  float64 // jump 만
+	z        float64 // jump 만
+}
+
+func (a anomaly) write(w io.Writer, date, symbol string) {
+	fmt.Fprintf(w, "%s,%d,%s,%s,%s,%s,%s,%s,%s\n", date, a.time, symbol, a.kind,
+		csvFloat(a.bid), csvFloat(a.ask), csvFloat(a.mid), csvFloat(a.prevMid), csvFloat(a.z))
+}
+
+// NaN 은 빈 칸
+func csvFloat(v float64) string {
+	if math.IsNaN(v) {
+		return ""
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+type anomalyDetector struct {
+	symbol string
+	opts   anomalyOptions
+	alpha  float64
+
+	prevMid  float64 // 0 이면 아직 없다
+	variance float64 // 로그 수익률의 지수가중 분산
+	returns  int
+}
+
+func newAnomalyDetector(symbol string, opts anomalyOptions) *anomalyDetector {
+	return &anomalyDetector{symbol: symbol, opts: opts, alpha: 2 / float64(opts.window+1)}
+}
+
+// 스냅샷 하나를 판정한다. 한쪽 호가가 빈 스냅샷은 판정하지 않는다.
+func (d *anomalyDetector) check(t int64, s *orderbook.Snapshot) (anomaly, bool) {
+	if len(s.Bids) == 0 || len(s.Asks) == 0 {
+		return anomaly{}, false
+	}
+	bid, ask := s.Bids[0].Price, s.Asks[0].Price
+	mid := (bid + ask) / 2
+	a := anomaly{time: t, bid: bid, ask: ask, mid: mid, prevMid: math.NaN(), z: math.NaN()}
+	switch {
+	case bid > ask:
+		a.kind = "crossed"
+		return a, true
+	case bid == ask:
+		a.kind = "locked"
+		return a, true
+	}
+
+	prev := d.prevMid
+	d.prevMid = mid
+	if prev == 0 {
+		return anomaly{}, false
+	}
+	r := math.Log(mid / prev)
+	if d.returns >= d.opts.window && d.variance > 0 {
+		z := r / math.Sqrt(d.variance)
+		if math.Abs(z) > d.opts.sigma && math.Abs(r)*1e4 >= d.opts.minBps {
+			a.kind, a.prevMid, a.z = "jump", prev, z
+			return a, true
+		}
+	}
+	d.variance += d.alpha * (r*r - d.variance)
+	d.returns++
+	return anomaly{}, false
+}
+
+// 날짜, 심볼별 요약
+type anomalyDay struct {
+	date, symbol                      string
+	snapshots, crossed, locked, jumps int
+	maxZ                              float64
+	first                             int64
+}
+
+func (day *anomalyDay) add(a anomaly, ok bool) {
+	day.snapshots++
+	if !ok {
+		return
+	}
+	if day.crossed+day.locked+day.jumps == 0 {
+		day.first = a.time
+	}
+	switch a.kind {
+	case "crossed":
+		day.crossed++
+	case "locked":
+		day.locked++
+	case "jump":
+		day.jumps++
+		if z := math.Abs(a.z); math.IsNaN(day.maxZ) || z > day.maxZ {
+			day.maxZ = z
+		}
+	}
+}
+
+func (day *anomalyDay) write(w io.Writer) {
+	first := ""
+	if day.crossed+day.locked+day.jumps > 0 {
+		first = formatMillis(day.first)
+	}
+	fmt.Fprintf(w, "%s,%s,%d,%d,%d,%d,%s,%s\n", day.date, day.symbol, day.snapshots,
+		day.crossed, day.locked, day.jumps, csvFloat(day.maxZ), first)
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"orderbook/orderbook"
+)
+
+// 저장된 데이터에 대한 HTTP 질의 API.
+//
+//	GET /v1/book/{symbol}?at=[&depth=20]                   at 시점의 책. 그 전 마지막 스냅샷에 at 까지의 증분을 적용한다
+//	GET /v1/range/{symbol}?from=&to=[&limit=][&cursor=]   한 페이지 (JSON). nextCursor 가 있으면 이어서 요청한다
+//	                       ?day=&convention=               from/to 대신 하루 (convention: utc, kst, <zone>[@HH:MM])
+//	GET /v1/range/{symbol}?from=&to=&stream=true          NDJSON 스트리밍. limit 으로 끊기면 Next-Cursor 트레일러
+//	GET /v1/symbols                                       심볼과 기록 구간 (dashboard.go)
+//	GET /v1/gaps/{symbol}?from=&to=[&minGap=5s]           스냅샷이 없었던 빈 구간 (orderbook gaps 와 같다)
+//	GET /                                                 웹 대시보드 (-ui=false 로 끈다)
+//
+// 페이지 크기와 한 번에 질의할 수 있는 구간 길이는 서버 플래그로 제한한다.
+// 응답에는 심볼 메타데이터(symbolInfo, 스트리밍이면 X-Symbol-Info 헤더)가 함께 실린다.
+// -keep-decimals 로 기록된 파일이면 이벤트의 priceText/quantityText 등에 거래소 원래 문자열이 있다.
+// -store 를 주면 -data 대신 그 저장소들(로컬, 보관본, 다른 수집기)을 묶어 질의한다 (federation.go).
+
+type apiServer struct {
+	dataDir     string
+	files       fileLister
+	symbols     *symbolMetadata
+	defaultPage int
+	maxPage     int
+	maxRange    time.Duration
+}
+
+func runServeAPI(args []string) error {
+	fs := flag.NewFlagSet("serve-api", flag.ExitOnError)
+	addr := fs.String("addr", ":8082", "listen address")
+	dataDir := fs.String("data", defaultDataDir, "data directory")
+	token := fs.String("token", os.Getenv("ORDERBOOK_HTTP_TOKEN"), "require this bearer token (default $ORDERBOOK_HTTP_TOKEN; empty disables auth)")
+	defaultPage := fs.Int("page-size", 100, "events per page when the request has no limit")
+	maxPage := fs.Int("max-page-size", 1000, "largest limit a page request may ask for")
+	maxRange := fs.String("max-range", "7d", "longest from..to span a single request may cover")
+	var stores []string
+	fs.Func("store", "query this store instead of -data; repeat in order of preference (directory, s3://, gs://, http(s)://peer serving files)", func(v string) error {
+		stores = append(stores, v)
+		return nil
+	})
+	cacheDir := fs.String("cache-dir", "", "where files from remote stores are downloaded (default <data>/.federation)")
+	symbolRefresh := fs.Duration("symbol-refresh", time.Hour, "how often to refresh symbol metadata from exchangeInfo; 0 only uses the cached "+symbolMetadataFile)
+	ui := fs.Bool("ui", true, "serve the web dashboard at /")
+	var network networkOptions
+	network.register(fs)
+	fs.Parse(args)
+	if err := network.apply(); err != nil {
+		return err
+	}
+
+	mr, err := parseDuration(*maxRange)
+	if err != nil {
+		return err
+	}
+	srv := &apiServer{dataDir: *dataDir, files: localFiles(*dataDir), symbols: loadSymbolMetadata(*dataDir), defaultPage: *defaultPage, maxPage: *maxPage, maxRange: mr}
+	if len(stores) > 0 {
+		if *cacheDir == "" {
+			*cacheDir = filepath.Join(*dataDir, ".federation")
+		}
+		fd, err := newFederation(stores, *cacheDir)
+		if err != nil {
+			return err
+		}
+		srv.files = fd.files
+		log.Printf("Federating queries over %d store(s): %v", len(fd.stores), fd.stores)
+	}
+	if *symbolRefresh > 0 {
+		go srv.symbols.runRefresher(context.Background(), *symbolRefresh)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/book/{symbol}", srv.handleBook)
+	mux.HandleFunc("GET /v1/range/{symbol}", srv.handleRange)
+	mux.HandleFunc("GET /v1/symbols", srv.handleSymbols)
+	mux.HandleFunc("GET /v1/gaps/{symbol}", srv.handleGaps)
+
+	var handler http.Handler = mux
+	if *token != "" {
+		handler = requireToken(*token, handler)
+	} else {
+		log.Printf("Warning: serving the query API without authentication")
+	}
+	if *ui {
+		// 페이지에는 데이터가 없다. API 요청은 페이지가 토큰을 실어 보낸다
+		root := http.NewServeMux()
+		root.HandleFunc("GET /{$}", serveDashboard)
+		root.Handle("/", handler)
+		handler = root
+		log.Printf("Serving the dashboard at /")
+	}
+
+	log.Printf("Query API for %s on %s", *dataDir, *addr)
+	return http.ListenAndServe(*addr, handler)
+}
+
+// 요청 파라미터로 rangeQuery 를 만든다. 스트리밍이면 limit 이 없어도 된다.
+func (s *apiServer) parseRange(r *http.Request, stream bool) (*rangeQuery, error) {
+	qs := r.URL.Query()
+	from, to, err := s.parseSpan(qs)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &rangeQuery{DataDir: s.dataDir, Files: s.files, Symbol: strings.ToLower(r.PathValue("symbol")), From: from, To: to}
+	if !stream {
+		q.Limit = s.defaultPage
+	}
+	if v := qs.Get("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil || q.Limit <= 0 {
+			return nil, fmt.Errorf("invalid limit %q", v)
+		}
+		if !stream && q.Limit > s.maxPage {
+			return nil, fmt.Errorf("limit exceeds the maximum page size %d", s.maxPage)
+		}
+	}
+	if v := qs.Get("cursor"); v != "" {
+		if q.Cursor, err = parseCursor(v); err != nil {
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+// from/to 또는 day/convention 으로 준 구간. 서버의 -max-range 를 넘으면 안 된다.
+func (s *apiServer) parseSpan(qs url.Values) (int64, int64, error) {
+	rng := rangeFlags{from: qs.Get("from"), to: qs.Get("to"), day: qs.Get("day"), convention: qs.Get("convention")}
+	from, to, err := rng.resolve()
+	if err != nil {
+		return 0, 0, err
+	}
+	if to <= from {
+		return 0, 0, fmt.Errorf("to must be after from")
+	}
+	if time.Duration(to-from)*time.Millisecond > s.maxRange {
+		return 0, 0, fmt.Errorf("range exceeds the %s limit; split the request", s.maxRange)
+	}
+	return from, to, nil
+}
+
+func (s *apiServer) handleRange(w http.ResponseWriter, r *http.Request) {
+	stream, _ := strconv.ParseBool(r.URL.Query().Get("stream"))
+	q, err := s.parseRange(r, stream)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if stream {
+		s.streamRange(w, r, q)
+		return
+	}
+
+	var events []json.RawMessage
+	next, err := q.run(r.Context(), func(ev *orderbook.Event) error {
+		b, err := protojson.Marshal(ev)
+		events = append(events, b)
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp := struct {
+		SymbolInfo *SymbolInfo       `json:"symbolInfo,omitempty"`
+		Events     []json.RawMessage `json:"events"`
+		NextCursor string            `json:"nextCursor,omitempty"`
+	}{SymbolInfo: s.symbols.Get(q.Symbol), Events: events}
+	if resp.Events == nil {
+		resp.Events = []json.RawMessage{}
+	}
+	if next != nil {
+		resp.NextCursor = next.String()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+type apiLevel struct {
+	Price    float64 `json:"price"`
+	Quantity float64 `json:"quantity"`
+}
+
+func (s *apiServer) handleBook(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	symbol := strings.ToLower(r.PathValue("symbol"))
+	if qs.Get("at") == "" {
+		http.Error(w, "at is required", http.StatusBadRequest)
+		return
+	}
+	at, err := parseTime(qs.Get("at"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	depth := 20
+	if v := qs.Get("depth"); v != "" {
+		if depth, err = strconv.Atoi(v); err != nil || depth <= 0 || depth > s.maxPage {
+			http.Error(w, fmt.Sprintf("invalid depth %q (1..%d)", v, s.maxPage), http.StatusBadRequest)
+			return
+		}
+	}
+
+	b, err := reconstructBookFrom(r.Context(), s.files, symbol, at)
+	if errors.Is(err, errNoSnapshot) {
+		http.Error(w, fmt.Sprintf("no book for %s at %s", symbol, formatMillis(at)), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	levels := func(ls []*orderbook.Level) []apiLevel {
+		out := make([]apiLevel, len(ls))
+		for i, l := range ls {
+			out[i] = apiLevel{Price: l.Price, Quantity: l.Quantity}
+		}
+		return out
+	}
+	resp := struct {
+		SymbolInfo   *SymbolInfo `json:"symbolInfo,omitempty"`
+		Symbol       string      `json:"symbol"`
+		At           int64       `json:"at"`
+		SnapshotTime int64       `json:"snapshotTime"`
+		UpdateTime   int64       `json:"updateTime"`
+		LastUpdateID int64       `json:"lastUpdateId"`
+		DiffsApplied int         `json:"diffsApplied"`
+		Gap          bool        `json:"gap,omitempty"` // 증분이 끊겨 updateTime 이후는 반영되지 않았다
+		Bids         []apiLevel  `json:"bids"`
+		Asks         []apiLevel  `json:"asks"`
+	}{
+		SymbolInfo:   s.symbols.Get(symbol),
+		Symbol:       symbol,
+		At:           at,
+		SnapshotTime: b.SnapshotTime,
+		UpdateTime:   b.UpdateTime,
+		LastUpdateID: b.Book.LastUpdateID,
+		DiffsApplied: b.Diffs,
+		Gap:          b.Gap,
+		Bids:         levels(b.Book.TopBids(depth)),
+		Asks:         levels(b.Book.TopAsks(depth)),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// 이벤트를 한 줄씩 내보내며 주기적으로 flush 한다. 클라이언트가 끊으면 요청 context 가 취소되어 읽기를 멈춘다.
+func (s *apiServer) streamRange(w http.ResponseWriter, r *http.Request, q *rangeQuery) {
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Trailer", "Next-Cursor")
+	if si := s.symbols.Get(q.Symbol); si != nil {
+		b, _ := json.Marshal(si)
+		w.Header().Set("X-Symbol-Info", string(b))
+	}
+
+	var n int
+	next, err := q.run(r.Context(), func(ev *orderbook.Event) error {
+		b, err := protojson.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(append(b, '\n')); err != nil {
+			return err
+		}
+		if n++; n%100 == 0 {
+			return rc.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		// 헤더는 이미 나갔으므로 상태 코드를 바꿀 수 없다. 로그만 남기고 연결을 끊는다.
+		log.Printf("stream %s: %v", r.URL, err)
+		panic(http.ErrAbortHandler)
+	}
+	if next != nil {
+		w.Header().Set("Next-Cursor", next.String())
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"orderbook/orderbook"
+)
+
+// orderbook arb : 세 심볼의 최우선 호가로 합성 교차 환율과 삼각 차익 스프레드를 계산한다 (Feed 로 라이브 또는 재생).
+//
+//	-triangle ethbtc,btcusdt,ethusdt      a,b,c 는 c 를 a x b 로 만들 수 있는 순서 (ETH/BTC x BTC/USDT = ETH/USDT)
+//	-triangle ethusdc,usdcusdt,ethusdt    여러 번 줄 수 있다
+//
+// 수집기 기본 심볼(ethusdt, ethusdc, ethbtc)만으로는 삼각형이 닫히지 않으므로 btcusdt, usdcusdt 같은 다리를
+// collect -symbols 에 더해 기록해야 한다. 최우선 호가만 보므로 그 호가 수량을 넘는 크기의 차익은 알 수 없다.
+//
+//	synthetic       a 와 b 중간가의 곱
+//	direct          c 의 중간가
+//	basis_bps       synthetic 이 direct 보다 비싼 정도
+//	buy_cross_bps   a, b 로 사서(ask x ask) c 에 파는(bid) 한 바퀴의 수수료 뺀 손익
+//	sell_cross_bps  c 에서 사서(ask) a, b 로 파는(bid x bid) 한 바퀴의 수수료 뺀 손익
+//
+// 수수료는 다리마다 -fee-bps 를 뗀다. 한 방향이라도 -threshold 이상인 갱신만 CSV 로 쓰고(-all 이면 모두),
+// 기회가 열리고 닫힐 때 로그를 남긴다.
+
+type triangle struct {
+	a, b, c string // 소문자 심볼
+	open    bool   // 지금 -threshold 이상인지
+	opened  int64
+	best    float64 // 열린 동안 가장 큰 손익
+}
+
+func (t *triangle) String() string { return t.a + "*" + t.b + "/" + t.c }
+
+func parseTriangle(v string) (*triangle, error) {
+	legs := splitList(strings.ToLower(v))
+	if len(legs) != 3 {
+		return nil, fmt.Errorf("invalid -triangle %q (want a,b,c with c = a x b)", v)
+	}
+	return &triangle{a: legs[0], b: legs[1], c: legs[2]}, nil
+}
+
+func runArb(args []string) error {
+	fs := flag.NewFlagSet("arb", flag.ExitOnError)
+	var triangles []*triangle
+	fs.Func("triangle", "legs a,b,c where c = a x b (e.g. ethbtc,btcusdt,ethusdt); repeat for more (default ethbtc,btcusdt,ethusdt)", func(v string) error {
+		t, err := parseTriangle(v)
+		if err != nil {
+			return err
+		}
+		triangles = append(triangles, t)
+		return nil
+	})
+	feeBps := fs.Float64("fee-bps", 10, "taker fee per leg (bps)")
+	threshold := fs.Float64("threshold", 0, "report when a direction nets at least this many bps after fees")
+	all := fs.Bool("all", false, "write every top-of-book update, not only those over -threshold")
+	live := fs.Bool("live", false, "watch the live Binance stream instead of recorded data")
+	streamList := fs.String("streams", "bookTicker", "stream types for -live")
+	var rng rangeFlags
+	rng.register(fs)
+	speed := fs.Float64("speed", 0, "replay pacing relative to the original timing (1 = real time); 0 replays as fast as possible")
+	dataDir := fs.String("data", defaultDataDir, "data directory")
+	fs.Parse(args)
+
+	if len(triangles) == 0 {
+		t, _ := parseTriangle("ethbtc,btcusdt,ethusdt")
+		triangles = append(triangles, t)
+	}
+	var legs []string
+	seen := make(map[string]bool)
+	for _, t := range triangles {
+		for _, s := range []string{t.a, t.b, t.c} {
+			if !seen[s] {
+				seen[s] = true
+				legs = append(legs, s)
+			}
+		}
+	}
+
+	var feed Feed
+	if *live {
+		feed = NewLiveFeed(splitList(*streamList))
+	} else {
+		from, to, err := rng.resolve()
+		if err != nil {
+			return fmt.Errorf("%w (or -live)", err)
+		}
+		feed = NewReplayFeed(*dataDir, from, to, *speed)
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+
+	m := &arbMonitor{
+		w:         bufio.NewWriter(os.Stdout),
+		triangles: triangles,
+		feeFactor: math.Pow(1-*feeBps/1e4, 3),
+		threshold: *threshold,
+		all:       *all,
+		live:      *live,
+		deriver:   orderbook.NewTickDeriver(),
+		tops:      make(map[string]*orderbook.Tick),
+	}
+	io.WriteString(m.w, "time,triangle,synthetic,direct,basis_bps,buy_cross_bps,sell_cross_bps\n")
+	err := consumeFeed(ctx, feed, legs, m.add)
+	if ferr := m.w.Flush(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+type arbMonitor struct {
+	w         *bufio.Writer
+	triangles []*triangle
+	feeFactor float64 // 세 다리 수수료를 뗀 뒤 남는 비율
+	threshold float64
+	all       bool
+	live      bool // 줄마다 바로 내보낸다
+
+	deriver *orderbook.TickDeriver
+	tops    map[string]*orderbook.Tick // 소문자 심볼별 최우선 호가
+	buf     []byte
+}
+
+func (m *arbMonitor) add(ev *orderbook.Event) error {
+	t := m.deriver.Next(ev).GetTick()
+	if t == nil {
+		return nil
+	}
+	symbol := strings.ToLower(ev.Symbol)
+	if t.BidPrice <= 0 || t.AskPrice <= 0 {
+		delete(m.tops, symbol) // 한쪽이 빈 책으로는 계산하지 않는다
+		return nil
+	}
+	m.tops[symbol] = t
+	for _, tri := range m.triangles {
+		if symbol == tri.a || symbol == tri.b || symbol == tri.c {
+			m.evaluate(ev.EventTime, tri)
+		}
+	}
+	if m.live && m.w.Buffered() > 0 {
+		return m.w.Flush()
+	}
+	return nil
+}
+
+func (m *arbMonitor) evaluate(now int64, tri *triangle) {
+	a, b, c := m.tops[tri.a], m.tops[tri.b], m.tops[tri.c]
+	if a == nil || b == nil || c == nil {
+		return
+	}
+	synthetic := (a.BidPrice + a.AskPrice) / 2 * (b.BidPrice + b.AskPrice) / 2
+	direct := (c.BidPrice + c.AskPrice) / 2
+	basis := (synthetic/direct - 1) * 1e4
+	buyCross := (c.BidPrice/(a.AskPrice*b.AskPrice)*m.feeFactor - 1) * 1e4
+	sellCross := (a.BidPrice*b.BidPrice/c.AskPrice*m.feeFactor - 1) * 1e4
+
+	edge := max(buyCross, sellCross)
+	switch over := edge >= m.threshold; {
+	case over && !tri.open:
+		tri.open, tri.opened, tri.best = true, now, edge
+		log.Printf("Arbitrage opened on %s at %s: %.2f bps", tri, formatMillis(now), edge)
+	case over:
+		tri.best = max(tri.best, edge)
+	case tri.open:
+		tri.open = false
+		log.Printf("Arbitrage closed on %s at %s after %s, best %.2f bps", tri, formatMillis(now), time.Duration(now-tri.opened)*time.Millisecond, tri.best)
+	}
+	if !tri.open && !m.all {
+		return
+	}
+	buf := append(m.buf[:0], formatMillis(now)...)
+	buf = append(append(buf, ','), tri.String()...)
+	for _, v := range []float64{synthetic, direct, basis, buyCross, sellCross} {
+		buf = strconv.AppendFloat(append(buf, ','), v, 'g', 10, 64)
+	}
+	m.buf = append(buf, '\n')
+	m.w.Write(m.buf)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"orderbook/orderbook"
+)
+
+// Arrow IPC 파일(Feather v2) 출력. 호가 단계 하나가 한 행인 열 지향 배치로 쓴다.
+// 압축하지 않으므로 DuckDB, pyarrow 등이 파일을 mmap 해 복사 없이 읽을 수 있다.
+//
+//	time (timestamp[ms, UTC]), sequence, symbol, side (bid/ask), level_index (0 이 최우선),
+//	price, qty, price_text, qty_text (원래 문자열. 없으면 null)
+
+const arrowBatchRows = 64 << 10
+
+var arrowLevelSchemaFields = []arrow.Field{
+	{Name: "time", Type: &arrow.TimestampType{Unit: arrow.Millisecond, TimeZone: "UTC"}},
+	{Name: "sequence", Type: arrow.PrimitiveTypes.Uint64},
+	{Name: "symbol", Type: arrow.BinaryTypes.String},
+	{Name: "side", Type: arrow.BinaryTypes.String},
+	{Name: "level_index", Type: arrow.PrimitiveTypes.Int32},
+	{Name: "price", Type: arrow.PrimitiveTypes.Float64},
+	{Name: "qty", Type: arrow.PrimitiveTypes.Float64},
+	{Name: "price_text", Type: arrow.BinaryTypes.String, Nullable: true},
+	{Name: "qty_text", Type: arrow.BinaryTypes.String, Nullable: true},
+}
+
+// in 의 스냅샷을 out 에 쓴다. symbolInfo 가 있으면 스키마 메타데이터에 넣는다.
+func writeArrow(ctx context.Context, in, out string, p *Progress, symbol, symbolInfo string) (int, error) {
+	var md arrow.Metadata
+	if symbolInfo != "" {
+		md = arrow.NewMetadata([]string{symbolInfoMetadataKey}, []string{symbolInfo})
+	}
+	schema := arrow.NewSchema(arrowLevelSchemaFields, &md)
+
+	if err := os.MkdirAll(filepath.Dir(out), os.ModePerm); err != nil {
+		return 0, err
+	}
+	tmp := out + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp)
+	defer f.Close()
+
+	w, err := ipc.NewFileWriter(f, ipc.WithSchema(schema))
+	if err != nil {
+		return 0, err
+	}
+	b := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer b.Release()
+	var (
+		timeCol   = b.Field(0).(*array.TimestampBuilder)
+		seqCol    = b.Field(1).(*array.Uint64Builder)
+		symbolCol = b.Field(2).(*array.StringBuilder)
+		sideCol   = b.Field(3).(*array.StringBuilder)
+		levelCol  = b.Field(4).(*array.Int32Builder)
+		priceCol  = b.Field(5).(*array.Float64Builder)
+		qtyCol    = b.Field(6).(*array.Float64Builder)
+		priceText = b.Field(7).(*array.StringBuilder)
+		qtyText   = b.Field(8).(*array.StringBuilder)
+	)
+	appendText := func(col *array.StringBuilder, s string) {
+		if s == "" {
+			col.AppendNull()
+		} else {
+			col.Append(s)
+		}
+	}
+	flush := func() error {
+		if timeCol.Len() == 0 {
+			return nil
+		}
+		rec := b.NewRecordBatch()
+		defer rec.Release()
+		return w.Write(rec)
+	}
+
+	var n int
+	err = scanFile(ctx, in, math.MinInt64, math.MaxInt64, p, func(r *orderbook.Reader, ev *orderbook.Event) error {
+		s := ev.GetSnapshot()
+		if s == nil {
+			return nil
+		}
+		sym := eventSymbol(ev, s, symbol)
+		for _, side := range []struct {
+			name   string
+			levels []*orderbook.Level
+		}{{"bid", s.Bids}, {"ask", s.Asks}} {
+			for i, l := range side.levels {
+				timeCol.Append(arrow.Timestamp(ev.EventTime))
+				seqCol.Append(ev.Sequence)
+				symbolCol.Append(sym)
+				sideCol.Append(side.name)
+				levelCol.Append(int32(i))
+				priceCol.Append(l.Price)
+				qtyCol.Append(l.Quantity)
+				appendText(priceText, l.PriceText)
+				appendText(qtyText, l.QuantityText)
+				n++
+			}
+		}
+		if timeCol.Len() >= arrowBatchRows {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		return 0, err
+	}
+	if err := w.Close(); err != nil {
+		return 0, err
+	}
+	if err := f.Close(); err != nil {
+		return 0, err
+	}
+	return n, os.Rename(tmp, out)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/binary"
+	"math"
+
+	"orderbook/orderbook"
+)
+
+// Event 를 orderbook.avsc 스키마의 Avro 바이너리로 인코딩한다. 스키마가 고정이라 범용 라이브러리 없이 직접 쓴다.
+// orderbook.proto 에 필드를 추가하면 orderbook.avsc 와 여기도 같이 고친다 (새 필드는 스키마 끝에, 기본값과 함께).
+
+//go:embed orderbook.avsc
+var orderbookAvroSchema string
+
+// payload union 의 분기 순서 (orderbook.avsc 와 같아야 한다)
+const (
+	avroPayloadNull = iota
+	avroPayloadSnapshot
+	avroPayloadDepthDiff
+	avroPayloadTrade
+	avroPayloadBookTicker
+	avroPayloadTick
+	avroPayloadRecord
+	avroPayloadLiquidation
+	avroPayloadTicker
+)
+
+func appendAvroEvent(b []byte, ev *orderbook.Event) []byte {
+	b = appendAvroLong(b, ev.EventTime)
+	b = appendAvroLong(b, int64(ev.Sequence))
+	b = appendAvroString(b, ev.Symbol)
+	b = appendAvroString(b, ev.Exchange)
+	b = appendAvroString(b, ev.MarketType)
+	b = appendAvroString(b, ev.StreamType)
+	b = appendAvroLong(b, ev.ExchangeTime)
+	b = appendAvroLong(b, ev.ReceiveTimeNs)
+	b = appendAvroLong(b, ev.LatencyUs)
+
+	switch pl := ev.Payload.(type) {
+	case *orderbook.Event_Snapshot:
+		s := pl.Snapshot
+		b = appendAvroLong(b, avroPayloadSnapshot)
+		b = appendAvroLong(b, s.LastUpdateId)
+		b = appendAvroLevels(b, s.Bids)
+		b = appendAvroLevels(b, s.Asks)
+	case *orderbook.Event_DepthDiff:
+		d := pl.DepthDiff
+		b = appendAvroLong(b, avroPayloadDepthDiff)
+		b = appendAvroLong(b, d.FirstUpdateId)
+		b = appendAvroLong(b, d.FinalUpdateId)
+		b = appendAvroLong(b, d.PrevFinalUpdateId)
+		b = appendAvroLevels(b, d.Bids)
+		b = appendAvroLevels(b, d.Asks)
+	case *orderbook.Event_Trade:
+		t := pl.Trade
+		b = appendAvroLong(b, avroPayloadTrade)
+		b = appendAvroLong(b, t.TradeId)
+		b = appendAvroDouble(b, t.Price)
+		b = appendAvroDouble(b, t.Quantity)
+		b = appendAvroLong(b, t.TradeTime)
+		b = appendAvroBool(b, t.BuyerIsMaker)
+		b = appendAvroString(b, t.PriceText)
+		b = appendAvroString(b, t.QuantityText)
+	case *orderbook.Event_BookTicker:
+		t := pl.BookTicker
+		b = appendAvroLong(b, avroPayloadBookTicker)
+		b = appendAvroLong(b, t.UpdateId)
+		b = appendAvroDouble(b, t.BidPrice)
+		b = appendAvroDouble(b, t.BidQuantity)
+		b = appendAvroDouble(b, t.AskPrice)
+		b = appendAvroDouble(b, t.AskQuantity)
+		b = appendAvroString(b, t.BidPriceText)
+		b = appendAvroString(b, t.BidQuantityText)
+		b = appendAvroString(b, t.AskPriceText)
+		b = appendAvroString(b, t.AskQuantityText)
+	case *orderbook.Event_Tick:
+		t := pl.Tick
+		b = appendAvroLong(b, avroPayloadTick)
+		b = appendAvroDouble(b, t.BidPrice)
+		b = appendAvroDouble(b, t.BidQuantity)
+		b = appendAvroDouble(b, t.AskPrice)
+		b = appendAvroDouble(b, t.AskQuantity)
+		b = appendAvroLong(b, t.UpdateId)
+		b = appendAvroString(b, t.BidPriceText)
+		b = appendAvroString(b, t.BidQuantityText)
+		b = appendAvroString(b, t.AskPriceText)
+		b = appendAvroString(b, t.AskQuantityText)
+	case *orderbook.Event_Record:
+		r := pl.Record
+		b = appendAvroLong(b, avroPayloadRecord)
+		b = appendAvroString(b, r.Type)
+		b = appendAvroString(b, r.Encoding)
+		b = appendAvroBytes(b, r.Data)
+	case *orderbook.Event_Liquidation:
+		l := pl.Liquidation
+		b = appendAvroLong(b, avroPayloadLiquidation)
+		b = appendAvroString(b, l.Side)
+		b = appendAvroString(b, l.OrderType)
+		b = appendAvroString(b, l.TimeInForce)
+		b = appendAvroDouble(b, l.Price)
+		b = appendAvroDouble(b, l.AveragePrice)
+		b = appendAvroDouble(b, l.Quantity)
+		b = appendAvroDouble(b, l.LastFilledQuantity)
+		b = appendAvroDouble(b, l.FilledQuantity)
+		b = appendAvroString(b, l.Status)
+		b = appendAvroLong(b, l.TradeTime)
+		b = appendAvroString(b, l.PriceText)
+		b = appendAvroString(b, l.AveragePriceText)
+		b = appendAvroString(b, l.QuantityText)
+		b = appendAvroString(b, l.LastFilledQuantityText)
+		b = appendAvroString(b, l.FilledQuantityText)
+	case *orderbook.Event_Ticker:
+		t := pl.Ticker
+		b = appendAvroLong(b, avroPayloadTicker)
+		b = appendAvroDouble(b, t.LastPrice)
+		b = appendAvroDouble(b, t.OpenPrice)
+		b = appendAvroDouble(b, t.HighPrice)
+		b = appendAvroDouble(b, t.LowPrice)
+		b = appendAvroDouble(b, t.Volume)
+		b = appendAvroDouble(b, t.QuoteVolume)
+		b = appendAvroDouble(b, t.PriceChange)
+		b = appendAvroDouble(b, t.PriceChangePercent)
+		b = appendAvroDouble(b, t.WeightedAvgPrice)
+		b = appendAvroDouble(b, t.LastQuantity)
+		b = appendAvroLong(b, t.OpenTime)
+		b = appendAvroLong(b, t.CloseTime)
+		b = appendAvroLong(b, t.FirstTradeId)
+		b = appendAvroLong(b, t.LastTradeId)
+		b = appendAvroLong(b, t.TradeCount)
+	default:
+		// 이 빌드가 모르는 payload 는 Avro 로 옮길 수 없다
+		b = appendAvroLong(b, avroPayloadNull)
+	}
+	return b
+}
+
+func appendAvroLevels(b []byte, levels []*orderbook.Level) []byte {
+	// 배열은 (개수, 항목들) 블록 뒤에 개수 0 블록으로 끝난다
+	if len(levels) > 0 {
+		b = appendAvroLong(b, int64(len(levels)))
+		for _, l := range levels {
+			b = appendAvroDouble(b, l.Price)
+			b = appendAvroDouble(b, l.Quantity)
+			b = appendAvroString(b, l.PriceText)
+			b = appendAvroString(b, l.QuantityText)
+		}
+	}
+	return appendAvroLong(b, 0)
+}
+
+// long 과 int 는 zigzag varint
+func appendAvroLong(b []byte, v int64) []byte {
+	return binary.AppendVarint(b, v)
+}
+
+func appendAvroDouble(b []byte, v float64) []byte {
+	return binary.LittleEndian.AppendUint64(b, math.Float64bits(v))
+}
+
+func appendAvroString(b []byte, s string) []byte {
+	return append(appendAvroLong(b, int64(len(s))), s...)
+}
+
+func appendAvroBytes(b []byte, data []byte) []byte {
+	return append(appendAvroLong(b, int64(len(data))), data...)
+}
+
+func appendAvroBool(b []byte, v bool) []byte {
+	if v {
+		return append(b, 1)
+	}
+	return append(b, 0)
+}
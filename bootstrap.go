@@ -0,0 +1,62 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"orderbook/orderbook"
+)
+
+// 연결(재연결) 직후 심볼마다 REST depth 스냅샷을 받아 그 연결의 첫 레코드로 기록한다.
+// 스트림 스냅샷(depth20@100ms)이나 증분을 기다리는 동안 책을 모르는 구간이 생기지 않게 하고,
+// 증분(depth@...)만 받는 경우에도 이 스냅샷의 lastUpdateId 에 이어 책을 재구성할 수 있다.
+// REST 로 받은 레코드는 stream_type 이 orderbook.RESTSnapshotStreamType 이라 스트림 스냅샷과 구분된다.
+
+// 0 이면 받지 않는다 (collect -bootstrap-depth)
+var bootstrapDepth = 1000
+
+var restClient = &http.Client{Timeout: 10 * time.Second}
+
+// GET /api/v3/depth (선물은 /fapi/v1/depth) 를 Snapshot 이벤트로 바꾼다. 순번은 호출자가 매긴다.
+func fetchRESTSnapshot(ctx context.Context, symbol string, limit int) (*orderbook.Event, error) {
+	u := restBaseURL + restAPIPath + "/depth?symbol=" + strings.ToUpper(symbol) + "&limit=" + strconv.Itoa(limit)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := restClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("depth %s: %s", symbol, resp.Status)
+	}
+	var depth SnapshotEvent
+	if err := json.NewDecoder(resp.Body).Decode(&depth); err != nil {
+		return nil, fmt.Errorf("depth %s: %w", symbol, err)
+	}
+
+	// 응답을 다 받은 시각을 수신 시각으로 쓴다
+	received := time.Now()
+	return &orderbook.Event{
+		EventTime:     received.UnixMilli(),
+		ReceiveTimeNs: received.UnixNano(),
+		Symbol:        strings.ToUpper(symbol),
+		Exchange:      exchangeName,
+		MarketType:    marketType,
+		StreamType:    orderbook.RESTSnapshotStreamType,
+		Payload: &orderbook.Event_Snapshot{Snapshot: &orderbook.Snapshot{
+			EventTime:    received.UnixMilli(),
+			LastUpdateId: cmp.Or(depth.LastUpdateID, depth.FinalUpdateID), // 옵션은 u 로 온다
+			Bids:         parseLevels(depth.Bids),
+			Asks:         parseLevels(depth.Asks),
+		}},
+	}, nil
+}
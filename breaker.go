@@ -0,0 +1,568 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"orderbook/orderbook"
+)
+
+// 수집기가 실시간으로 내보내는 싱크(-sink)마다 큐와 서킷 브레이커를 둔다.
+// 싱크는 각자 고루틴에서 보내므로 느리거나 죽은 싱크가 파일 기록이나 다른 싱크를 막지 않는다.
+//
+// 브레이커는 최근 window 번의 전송 중 실패 비율이 error-rate 이상이면 열린다(open). 열려 있는 동안에는
+// 싱크를 부르지 않고 이벤트를 넘침 정책(overflow)으로 보낸다. cooldown 이 지나면 반열림(half-open)
+// 상태에서 이벤트 몇 개를 시험 삼아 보내고, probes 번 연속 성공하면 닫히고 한 번이라도 실패하면 다시 열린다.
+// 큐가 가득 찼거나 전송에 실패한 이벤트도 넘침 정책을 따른다.
+//
+//	drop         버린다 (기본)
+//	drop-oldest  큐가 가득 찼으면 가장 오래된 이벤트를 버리고 새 이벤트를 넣는다. 실패한 이벤트는 버린다
+//	spool        <data>/.spool/ 에 데이터 파일 형식으로 쌓아 두었다가 싱크가 회복되면 먼저 보낸다. 재시작해도 남는다
+//
+// 기본값은 -sink-* 플래그로 정하고, 싱크 URL 의 breaker.* 쿼리로 싱크마다 바꿀 수 있다.
+//
+//	-sink 'kafka://broker:9092/orderbook?breaker.error-rate=0.2&breaker.overflow=spool'
+//
+// 상태는 expvar "sinks" 와 관리 서버의 GET /sinks 로 볼 수 있다.
+
+type breakerConfig struct {
+	ErrorRate float64
+	Window    int
+	Cooldown  time.Duration
+	Probes    int
+	Overflow  string
+	Queue     int
+	SpoolMax  int64
+}
+
+type breakerOptions struct {
+	breakerConfig
+	spoolMax string
+}
+
+func (o *breakerOptions) register(fs *flag.FlagSet) {
+	fs.Float64Var(&o.ErrorRate, "sink-error-rate", 0.5, "failure ratio over the breaker window that opens a sink's circuit breaker")
+	fs.IntVar(&o.Window, "sink-window", 50, "number of recent sends the breaker error rate is measured over")
+	fs.DurationVar(&o.Cooldown, "sink-cooldown", 30*time.Second, "how long an open breaker waits before probing the sink again")
+	fs.IntVar(&o.Probes, "sink-probes", 3, "consecutive successful probes that close a half-open breaker")
+	fs.StringVar(&o.Overflow, "sink-overflow", "drop", "what happens to events a sink cannot take: drop, drop-oldest (evict the oldest queued event) or spool")
+	fs.IntVar(&o.Queue, "sink-queue", 10000, "events buffered per sink before overflowing")
+	fs.StringVar(&o.spoolMax, "sink-spool-max", "1GB", "spool size limit per sink; events beyond it are dropped")
+}
+
+func (o *breakerOptions) parse() error {
+	n, err := parseBytes(o.spoolMax)
+	if err != nil {
+		return err
+	}
+	o.SpoolMax = n
+	return o.validate()
+}
+
+func (c *breakerConfig) validate() error {
+	switch {
+	case c.ErrorRate <= 0 || c.ErrorRate > 1:
+		return fmt.Errorf("breaker error rate must be in (0, 1], got %g", c.ErrorRate)
+	case c.Window <= 0 || c.Probes <= 0 || c.Queue <= 0:
+		return fmt.Errorf("breaker window, probes and queue must be positive")
+	case c.Cooldown <= 0:
+		return fmt.Errorf("breaker cooldown must be positive")
+	case c.Overflow != "drop" && c.Overflow != "drop-oldest" && c.Overflow != "spool":
+		return fmt.Errorf("unknown sink overflow policy %q (use drop, drop-oldest or spool)", c.Overflow)
+	}
+	return nil
+}
+
+// URL 의 breaker.* 쿼리로 기본값을 덮어쓰고, 싱크에 넘길 URL 에서는 뺀다
+func (c breakerConfig) override(spec string) (breakerConfig, string, error) {
+	u, err := url.Parse(spec)
+	if err != nil {
+		return c, spec, fmt.Errorf("sink %q: %w", sinkName(spec), err)
+	}
+	q := u.Query()
+	for key, vals := range q {
+		name, ok := strings.CutPrefix(key, "breaker.")
+		if !ok {
+			continue
+		}
+		v := vals[0]
+		switch name {
+		case "error-rate":
+			c.ErrorRate, err = strconv.ParseFloat(v, 64)
+		case "window":
+			c.Window, err = strconv.Atoi(v)
+		case "cooldown":
+			c.Cooldown, err = time.ParseDuration(v)
+		case "probes":
+			c.Probes, err = strconv.Atoi(v)
+		case "overflow":
+			c.Overflow = v
+		case "queue":
+			c.Queue, err = strconv.Atoi(v)
+		case "spool-max":
+			c.SpoolMax, err = parseBytes(v)
+		default:
+			err = fmt.Errorf("unknown option")
+		}
+		if err != nil {
+			return c, spec, fmt.Errorf("sink %s: %s=%q: %w", sinkName(spec), key, v, err)
+		}
+		q.Del(key)
+	}
+	if err := c.validate(); err != nil {
+		return c, spec, fmt.Errorf("sink %s: %w", sinkName(spec), err)
+	}
+	u.RawQuery = q.Encode()
+	return c, u.String(), nil
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// 오류율 기반 서킷 브레이커. 최근 결과를 원형 버퍼로 센다.
+type circuitBreaker struct {
+	cfg breakerConfig
+
+	mu       sync.Mutex
+	state    breakerState
+	results  []bool // true = 실패
+	next     int
+	filled   int
+	failures int
+	openedAt time.Time
+	probesOK int
+	trips    int64
+}
+
+func newCircuitBreaker(cfg breakerConfig) *circuitBreaker {
+	return &circuitBreaker{cfg: cfg, results: make([]bool, cfg.Window)}
+}
+
+// 지금 싱크를 불러도 되는지. 열린 지 cooldown 이 지났으면 반열림으로 바꾸고 허용한다.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerOpen && time.Since(b.openedAt) >= b.cfg.Cooldown {
+		b.state, b.probesOK = breakerHalfOpen, 0
+	}
+	return b.state != breakerOpen
+}
+
+func (b *circuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerHalfOpen:
+		if err != nil {
+			b.trip()
+			return
+		}
+		if b.probesOK++; b.probesOK >= b.cfg.Probes {
+			b.state = breakerClosed
+			b.reset()
+		}
+	case breakerClosed:
+		failed := err != nil
+		if b.filled == len(b.results) {
+			if b.results[b.next] {
+				b.failures--
+			}
+		} else {
+			b.filled++
+		}
+		b.results[b.next] = failed
+		b.next = (b.next + 1) % len(b.results)
+		if failed {
+			b.failures++
+		}
+		// 창이 반도 안 찼으면 몇 번의 실패만으로 열리지 않게 한다
+		if b.filled >= (len(b.results)+1)/2 && float64(b.failures)/float64(b.filled) >= b.cfg.ErrorRate {
+			b.trip()
+		}
+	}
+}
+
+// b.mu 를 잡은 상태에서 호출해야 한다.
+func (b *circuitBreaker) trip() {
+	b.state, b.openedAt = breakerOpen, time.Now()
+	b.trips++
+	b.reset()
+}
+
+// b.mu 를 잡은 상태에서 호출해야 한다.
+func (b *circuitBreaker) reset() {
+	clear(b.results)
+	b.next, b.filled, b.failures = 0, 0, 0
+}
+
+func (b *circuitBreaker) snapshot() (state breakerState, errorRate float64, trips int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.filled > 0 {
+		errorRate = float64(b.failures) / float64(b.filled)
+	}
+	return b.state, errorRate, b.trips
+}
+
+// 큐, 브레이커, 스풀을 갖춘 싱크 하나
+type managedSink struct {
+	name    string
+	cfg     breakerConfig
+	sink    Sink
+	breaker *circuitBreaker
+	queue   chan *orderbook.Event
+	done    chan struct{}
+
+	spoolMu      sync.Mutex
+	spoolPath    string
+	spool        *orderbook.FileWriter
+	spoolPending atomic.Bool // 아직 보내지 않은 스풀 파일이 있다
+	draining     bool        // .draining 파일을 보내는 중 (run 고루틴만 쓴다)
+	drained      int         // 그 파일에서 이미 보낸 이벤트 수
+
+	closeMu sync.RWMutex // offer 와 close 가 겹치지 않게 한다
+	closed  bool
+
+	published, failed, dropped, spooled atomic.Int64
+}
+
+type sinkStatus struct {
+	Name       string  `json:"name"`
+	State      string  `json:"state"`
+	ErrorRate  float64 `json:"errorRate"`
+	Trips      int64   `json:"trips"`
+	Published  int64   `json:"published"`
+	Failed     int64   `json:"failed"`
+	Dropped    int64   `json:"dropped"`
+	Spooled    int64   `json:"spooled"`
+	Queued     int     `json:"queued"`
+	SpoolBytes int64   `json:"spoolBytes"`
+}
+
+func openManagedSink(spec string, defaults breakerConfig, dataDir string) (*managedSink, error) {
+	cfg, spec, err := defaults.override(spec)
+	if err != nil {
+		return nil, err
+	}
+	sink, err := openSink(spec)
+	if err != nil {
+		return nil, err
+	}
+	name := sinkName(spec)
+	sum := sha1.Sum([]byte(name))
+	scheme, _, _ := strings.Cut(name, ":")
+	m := &managedSink{
+		name:      name,
+		cfg:       cfg,
+		sink:      sink,
+		breaker:   newCircuitBreaker(cfg),
+		queue:     make(chan *orderbook.Event, cfg.Queue),
+		done:      make(chan struct{}),
+		spoolPath: filepath.Join(dataDir, ".spool", scheme+"-"+hex.EncodeToString(sum[:4])+".spool"),
+	}
+	// 지난 실행에서 남은 스풀은 싱크가 받을 수 있게 되면 먼저 보낸다
+	if _, err := os.Stat(m.spoolPath + ".draining"); err == nil {
+		m.draining = true
+	}
+	if _, err := os.Stat(m.spoolPath); err == nil {
+		m.spoolPending.Store(true)
+	}
+	go m.run()
+	return m, nil
+}
+
+// 수집 루프에서 부른다. 막히지 않는다.
+func (m *managedSink) offer(ev *orderbook.Event) {
+	m.closeMu.RLock()
+	defer m.closeMu.RUnlock()
+	if m.closed {
+		return
+	}
+	select {
+	case m.queue <- ev:
+		return
+	default:
+	}
+	if m.cfg.Overflow != "drop-oldest" {
+		m.overflow(ev)
+		return
+	}
+	for {
+		select {
+		case <-m.queue:
+			m.dropped.Add(1)
+		default:
+		}
+		select {
+		case m.queue <- ev:
+			return
+		default:
+		}
+	}
+}
+
+func (m *managedSink) run() {
+	defer close(m.done)
+	for ev := range m.queue {
+		m.deliver(ev)
+	}
+}
+
+func (m *managedSink) deliver(ev *orderbook.Event) {
+	if !m.breaker.allow() {
+		m.overflow(ev)
+		return
+	}
+	if (m.draining || m.spoolPending.Load()) && !m.drainSpool() {
+		m.overflow(ev)
+		return
+	}
+	if !m.send(ev) {
+		m.overflow(ev)
+	}
+}
+
+func (m *managedSink) send(ev *orderbook.Event) bool {
+	before, _, _ := m.breaker.snapshot()
+	err := m.sink.Publish(ev)
+	m.breaker.record(err)
+	after, _, _ := m.breaker.snapshot()
+	if err != nil {
+		m.failed.Add(1)
+		if after == breakerOpen && before != breakerOpen {
+			log.Printf("Sink %s: circuit breaker opened (was %s): %v", m.name, before, err)
+		}
+		return false
+	}
+	m.published.Add(1)
+	if after == breakerClosed && before == breakerHalfOpen {
+		log.Printf("Sink %s: circuit breaker closed", m.name)
+	}
+	return true
+}
+
+func (m *managedSink) overflow(ev *orderbook.Event) {
+	if m.cfg.Overflow != "spool" {
+		m.dropped.Add(1)
+		return
+	}
+	m.spoolMu.Lock()
+	defer m.spoolMu.Unlock()
+	if m.spool == nil {
+		if err := os.MkdirAll(filepath.Dir(m.spoolPath), 0755); err != nil {
+			log.Printf("Sink %s: cannot create spool: %v", m.name, err)
+			m.dropped.Add(1)
+			return
+		}
+		fw, err := orderbook.OpenFileWriter(m.spoolPath, &orderbook.FileHeader{CreatedAt: time.Now().UTC().UnixMilli()})
+		if err != nil {
+			log.Printf("Sink %s: cannot open spool: %v", m.name, err)
+			m.dropped.Add(1)
+			return
+		}
+		m.spool = fw
+	}
+	if m.spool.Size() >= m.cfg.SpoolMax {
+		m.dropped.Add(1)
+		return
+	}
+	if err := m.spool.Write(ev); err != nil {
+		log.Printf("Sink %s: spool write failed: %v", m.name, err)
+		m.dropped.Add(1)
+		return
+	}
+	m.spooled.Add(1)
+	m.spoolPending.Store(true)
+}
+
+// 스풀에 쌓인 이벤트를 먼저 보낸다. 다 보냈으면 true.
+// 쓰고 있는 스풀은 .draining 으로 옮겨 읽고, 그 사이 넘치는 이벤트는 새 스풀에 쌓인다.
+// 도중에 실패하면 .draining 을 남겨 두고 다음에 이어서 보낸다. 재시작하면 처음부터 다시 보내므로 중복될 수 있다.
+func (m *managedSink) drainSpool() bool {
+	path := m.spoolPath + ".draining"
+	if !m.draining {
+		if !m.spoolPending.Load() {
+			return true
+		}
+		m.spoolMu.Lock()
+		m.spoolPending.Store(false)
+		if m.spool != nil {
+			if err := m.spool.Close(); err != nil {
+				log.Printf("Sink %s: closing spool: %v", m.name, err)
+			}
+			m.spool = nil
+		}
+		err := os.Rename(m.spoolPath, path)
+		m.spoolMu.Unlock()
+		if err != nil {
+			if os.IsNotExist(err) {
+				return true
+			}
+			log.Printf("Sink %s: %v", m.name, err)
+			return false
+		}
+		m.draining, m.drained = true, 0
+	}
+
+	n := 0
+	errStop := fmt.Errorf("stop")
+	err := scanFile(context.Background(), path, math.MinInt64, math.MaxInt64, nil, func(r *orderbook.Reader, ev *orderbook.Event) error {
+		if n++; n <= m.drained {
+			return nil
+		}
+		if !m.breaker.allow() || !m.send(ev) {
+			return errStop
+		}
+		m.drained++
+		return nil
+	})
+	if err != nil {
+		if err != errStop {
+			log.Printf("Sink %s: reading spool: %v", m.name, err)
+		}
+		return false
+	}
+	log.Printf("Sink %s: replayed %d spooled events", m.name, m.drained)
+	os.Remove(path)
+	m.draining, m.drained = false, 0
+	return true
+}
+
+func (m *managedSink) status() sinkStatus {
+	state, rate, trips := m.breaker.snapshot()
+	st := sinkStatus{
+		Name: m.name, State: state.String(), ErrorRate: rate, Trips: trips,
+		Published: m.published.Load(), Failed: m.failed.Load(), Dropped: m.dropped.Load(), Spooled: m.spooled.Load(),
+		Queued: len(m.queue),
+	}
+	for _, p := range []string{m.spoolPath, m.spoolPath + ".draining"} {
+		if fi, err := os.Stat(p); err == nil {
+			st.SpoolBytes += fi.Size()
+		}
+	}
+	return st
+}
+
+// 큐에 남은 이벤트를 timeout 안에서 보내고 닫는다. 다 못 보낸 것은 넘침 정책을 따른다.
+func (m *managedSink) close(timeout time.Duration) {
+	m.closeMu.Lock()
+	m.closed = true
+	close(m.queue)
+	m.closeMu.Unlock()
+	select {
+	case <-m.done:
+	case <-time.After(timeout):
+		log.Printf("Sink %s: %d events still queued at shutdown", m.name, len(m.queue))
+	}
+	m.spoolMu.Lock()
+	if m.spool != nil {
+		m.spool.Close()
+		m.spool = nil
+	}
+	m.spoolMu.Unlock()
+	if err := m.sink.Close(); err != nil {
+		log.Printf("Sink %s: close: %v", m.name, err)
+	}
+}
+
+type sinkSet struct {
+	sinks []*managedSink
+}
+
+func openSinkSet(specs []string, defaults breakerConfig, dataDir string) (*sinkSet, error) {
+	s := &sinkSet{}
+	for _, spec := range specs {
+		m, err := openManagedSink(spec, defaults, dataDir)
+		if err != nil {
+			s.close()
+			return nil, err
+		}
+		log.Printf("Publishing live events to %s", m.name)
+		s.sinks = append(s.sinks, m)
+	}
+	openSinkSets.Lock()
+	openSinkSets.sets = append(openSinkSets.sets, s)
+	openSinkSets.Unlock()
+	return s, nil
+}
+
+// 열려 있는 싱크 묶음. expvar "sinks" 와 GET /sinks 는 admin.go 에서 한 번만 등록하고 여기서 상태를 모은다
+var openSinkSets struct {
+	sync.Mutex
+	sets []*sinkSet
+}
+
+func sinkStatuses() []sinkStatus {
+	openSinkSets.Lock()
+	defer openSinkSets.Unlock()
+	out := []sinkStatus{}
+	for _, s := range openSinkSets.sets {
+		out = append(out, s.status()...)
+	}
+	return out
+}
+
+// s 가 nil 이면 아무것도 하지 않는다
+func (s *sinkSet) publish(ev *orderbook.Event) {
+	if s == nil {
+		return
+	}
+	for _, m := range s.sinks {
+		m.offer(ev)
+	}
+}
+
+func (s *sinkSet) status() []sinkStatus {
+	var out []sinkStatus
+	for _, m := range s.sinks {
+		out = append(out, m.status())
+	}
+	return out
+}
+
+func (s *sinkSet) close() {
+	if s == nil {
+		return
+	}
+	openSinkSets.Lock()
+	openSinkSets.sets = slices.DeleteFunc(openSinkSets.sets, func(o *sinkSet) bool { return o == s })
+	openSinkSets.Unlock()
+	var wg sync.WaitGroup
+	for _, m := range s.sinks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.close(10 * time.Second)
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"orderbook/orderbook"
+)
+
+// 수집기가 메모리에 들고 있는 심볼별 최근 이벤트. 라이브 구독자가 접속 직전 구간을 받아 갈 때 쓴다.
+// 심볼마다 보관 기간(TTL)과 최대 바이트 한도를 두고, 넣을 때와 주기적인 sweep 에서 오래된 것부터 버린다.
+// 거래가 많은 심볼 하나가 메모리를 다 차지하지 않도록 한도는 심볼별로 따로 적용된다.
+
+type cachePolicy struct {
+	TTL      time.Duration // 0 이면 기간 제한 없음
+	MaxBytes int64         // 0 이면 크기 제한 없음
+}
+
+type liveCache struct {
+	mu        sync.Mutex
+	defaults  cachePolicy
+	overrides map[string]cachePolicy
+	symbols   map[string]*symbolCache
+}
+
+type symbolCache struct {
+	policy cachePolicy
+	events []cachedEvent // 오래된 순. 앞쪽은 head 부터 유효하다
+	head   int
+	bytes  int64
+
+	added, evictedTTL, evictedBytes uint64
+}
+
+type cachedEvent struct {
+	ev   *orderbook.Event
+	size int64
+}
+
+func newLiveCache(defaults cachePolicy, overrides map[string]cachePolicy) *liveCache {
+	return &liveCache{defaults: defaults, overrides: overrides, symbols: make(map[string]*symbolCache)}
+}
+
+// 심볼별 한도 목록을 읽는다. 형식: symbol:ttl:maxbytes[,...] 예) btcusdt:1m:64MB,ethbtc::4MB
+// 비워 둔 항목은 기본값을 따른다.
+func parseCachePolicies(s string, defaults cachePolicy) (map[string]cachePolicy, error) {
+	out := make(map[string]cachePolicy)
+	for _, item := range splitList(s) {
+		parts := strings.Split(item, ":")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("invalid cache limit %q: want symbol:ttl:maxbytes", item)
+		}
+		p := defaults
+		if parts[1] != "" {
+			d, err := parseDuration(parts[1])
+			if err != nil {
+				return nil, err
+			}
+			p.TTL = d
+		}
+		if parts[2] != "" {
+			n, err := parseBytes(parts[2])
+			if err != nil {
+				return nil, err
+			}
+			p.MaxBytes = n
+		}
+		out[strings.ToLower(parts[0])] = p
+	}
+	return out, nil
+}
+
+func (c *liveCache) Add(ev *orderbook.Event) {
+	symbol := strings.ToLower(ev.Symbol)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	sc, ok := c.symbols[symbol]
+	if !ok {
+		policy, ok := c.overrides[symbol]
+		if !ok {
+			policy = c.defaults
+		}
+		sc = &symbolCache{policy: policy}
+		c.symbols[symbol] = sc
+	}
+	size := int64(proto.Size(ev))
+	sc.events = append(sc.events, cachedEvent{ev: ev, size: size})
+	sc.bytes += size
+	sc.added++
+	sc.evict(ev.EventTime)
+}
+
+// 수신 시간이 from(UTC ms) 이상인 캐시된 이벤트. 돌려준 슬라이스는 호출자 것이다.
+func (c *liveCache) Since(symbol string, from int64) []*orderbook.Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	sc, ok := c.symbols[strings.ToLower(symbol)]
+	if !ok {
+		return nil
+	}
+	var out []*orderbook.Event
+	for _, ce := range sc.events[sc.head:] {
+		if ce.ev.EventTime >= from {
+			out = append(out, ce.ev)
+		}
+	}
+	return out
+}
+
+// 조용한 심볼도 TTL 이 지나면 비워지도록 주기적으로 호출한다
+func (c *liveCache) sweep(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, sc := range c.symbols {
+		sc.evict(now.UnixMilli())
+	}
+}
+
+func (c *liveCache) runSweeper(interval time.Duration) {
+	for now := range time.Tick(interval) {
+		c.sweep(now)
+	}
+}
+
+// now(UTC ms) 기준으로 TTL 이 지났거나 바이트 한도를 넘는 만큼 앞에서부터 버린다
+func (sc *symbolCache) evict(now int64) {
+	for sc.head < len(sc.events) {
+		ce := sc.events[sc.head]
+		switch {
+		case sc.policy.TTL > 0 && now-ce.ev.EventTime > sc.policy.TTL.Milliseconds():
+			sc.evictedTTL++
+		case sc.policy.MaxBytes > 0 && sc.bytes > sc.policy.MaxBytes:
+			sc.evictedBytes++
+		default:
+			sc.compact()
+			return
+		}
+		sc.events[sc.head] = cachedEvent{}
+		sc.head++
+		sc.bytes -= ce.size
+	}
+	sc.compact()
+}
+
+// 버린 앞부분이 절반을 넘으면 슬라이스를 당겨 메모리를 돌려준다
+func (sc *symbolCache) compact() {
+	if sc.head > 0 && sc.head >= len(sc.events)/2 {
+		n := copy(sc.events, sc.events[sc.head:])
+		clear(sc.events[n:])
+		sc.events = sc.events[:n]
+		sc.head = 0
+	}
+}
+
+type cacheStats struct {
+	Events       int    `json:"events"`
+	Bytes        int64  `json:"bytes"`
+	MaxBytes     int64  `json:"maxBytes"`
+	TTLSeconds   int64  `json:"ttlSeconds"`
+	Added        uint64 `json:"added"`
+	EvictedTTL   uint64 `json:"evictedTtl"`
+	EvictedBytes uint64 `json:"evictedBytes"`
+}
+
+// 심볼별 캐시 상태 (메트릭으로 공개한다)
+func (c *liveCache) stats() map[string]cacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make(map[string]cacheStats, len(c.symbols))
+	for symbol, sc := range c.symbols {
+		out[symbol] = cacheStats{
+			Events:       len(sc.events) - sc.head,
+			Bytes:        sc.bytes,
+			MaxBytes:     sc.policy.MaxBytes,
+			TTLSeconds:   int64(sc.policy.TTL / time.Second),
+			Added:        sc.added,
+			EvictedTTL:   sc.evictedTTL,
+			EvictedBytes: sc.evictedBytes,
+		}
+	}
+	return out
+}
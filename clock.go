@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"flag"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"orderbook/orderbook"
+)
+
+// 거래소 서버 시각과 로컬 시계 비교 (collect -clock-check). event_time, receive_time_ns 는 로컬 시계라
+// 시계가 어긋난 호스트의 파일끼리는 수신 시각으로 맞춰 볼 수 없다. -clock-check 마다 GET /api/v3/time
+// (선물은 /fapi/v1/time 등) 을 몇 번 불러 왕복 시간이 가장 짧은 것으로 차이를 잰다.
+//
+//	offset = 서버 시각 - (요청 시각 + 응답 시각) / 2
+//
+// 서버 시각이 ms 단위라 오차는 대략 왕복 시간의 절반 + 0.5ms 다. 잰 값은 expvar "clock" 으로 보고,
+// |offset| 이 -clock-max-drift 를 넘으면 경고를 남기고 -alert 가 있으면 clock 알림을 보낸다.
+// -clock-header 면 파일을 열 때 가장 최근 값을 세션 헤더(FileHeader.clock)에 남긴다.
+
+// 한 번 잴 때 부르는 횟수. 첫 요청은 연결을 맺느라 느리다
+const clockSamples = 5
+
+type clockOptions struct {
+	Interval time.Duration
+	MaxDrift time.Duration
+	Header   bool
+}
+
+func (o *clockOptions) register(fs *flag.FlagSet) {
+	fs.DurationVar(&o.Interval, "clock-check", 10*time.Minute, "how often to measure the local clock against the exchange server time; 0 disables")
+	fs.DurationVar(&o.MaxDrift, "clock-max-drift", 100*time.Millisecond, "warn (and alert) when the local clock is further than this from the exchange")
+	fs.BoolVar(&o.Header, "clock-header", false, "store the latest measured clock offset in the session header of every data file opened")
+}
+
+func (o *clockOptions) parse() error {
+	switch {
+	case o.Interval < 0:
+		return fmt.Errorf("-clock-check must not be negative")
+	case o.MaxDrift <= 0:
+		return fmt.Errorf("-clock-max-drift must be positive")
+	case o.Header && o.Interval == 0:
+		return fmt.Errorf("-clock-header needs -clock-check")
+	}
+	return nil
+}
+
+type clockChecker struct {
+	opts    clockOptions
+	alerter *alerter
+
+	mu       sync.Mutex
+	last     *orderbook.ClockSync
+	checks   int
+	failures int
+	lastErr  string
+}
+
+// 확인하지 않으면 nil
+func newClockChecker(opts clockOptions, a *alerter) *clockChecker {
+	if opts.Interval == 0 {
+		return nil
+	}
+	c := &clockChecker{opts: opts, alerter: a}
+	expvar.Publish("clock", expvar.Func(func() any { return c.status() }))
+	return c
+}
+
+type clockStatus struct {
+	OffsetUs   int64  `json:"offsetUs"`
+	RTTUs      int64  `json:"rttUs"`
+	MeasuredAt int64  `json:"measuredAt"` // 0 이면 아직 재지 못했다
+	Checks     int    `json:"checks"`
+	Failures   int    `json:"failures"`
+	LastError  string `json:"lastError,omitempty"`
+}
+
+func (c *clockChecker) status() clockStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return clockStatus{
+		OffsetUs:   c.last.GetOffsetUs(),
+		RTTUs:      c.last.GetRttUs(),
+		MeasuredAt: c.last.GetMeasuredAt(),
+		Checks:     c.checks,
+		Failures:   c.failures,
+		LastError:  c.lastErr,
+	}
+}
+
+// 서버 시각을 clockSamples 번 받아 왕복 시간이 가장 짧은 것으로 차이를 잰다
+func measureClock(ctx context.Context) (*orderbook.ClockSync, error) {
+	var best *orderbook.ClockSync
+	var lastErr error
+	for range clockSamples {
+		var resp struct {
+			ServerTime int64 `json:"serverTime"`
+		}
+		sent := time.Now()
+		if err := fetchJSON(ctx, restBaseURL+restAPIPath+"/time", &resp); err != nil {
+			lastErr = err
+			continue
+		}
+		rtt := time.Since(sent)
+		if resp.ServerTime == 0 {
+			lastErr = fmt.Errorf("no serverTime in response")
+			continue
+		}
+		mid := sent.Add(rtt / 2)
+		s := &orderbook.ClockSync{
+			OffsetUs:   resp.ServerTime*1000 - mid.UnixMicro(),
+			RttUs:      rtt.Microseconds(),
+			MeasuredAt: mid.UnixMilli(),
+		}
+		if best == nil || s.RttUs < best.RttUs {
+			best = s
+		}
+	}
+	if best == nil {
+		return nil, lastErr
+	}
+	return best, nil
+}
+
+func (c *clockChecker) check(ctx context.Context) {
+	s, err := measureClock(ctx)
+	c.mu.Lock()
+	c.checks++
+	if err != nil {
+		c.failures++
+		c.lastErr = err.Error()
+		c.mu.Unlock()
+		log.Printf("Clock check against the exchange failed: %v", err)
+		return
+	}
+	first := c.last == nil
+	c.last, c.lastErr = s, ""
+	c.mu.Unlock()
+
+	offset := time.Duration(s.OffsetUs) * time.Microsecond
+	rtt := time.Duration(s.RttUs) * time.Microsecond
+	switch {
+	case offset.Abs() > c.opts.MaxDrift:
+		log.Printf("Warning: local clock is %s (rtt %s); receive timestamps are off by that much", describeClockOffset(offset), rtt)
+	case first:
+		log.Printf("Local clock is %s (rtt %s)", describeClockOffset(offset), rtt)
+	}
+	c.alerter.clockChecked(offset, c.opts.MaxDrift)
+}
+
+func describeClockOffset(offset time.Duration) string {
+	d := offset.Abs().Round(time.Microsecond)
+	if offset > 0 {
+		return fmt.Sprintf("%s behind the exchange", d)
+	}
+	return fmt.Sprintf("%s ahead of the exchange", d)
+}
+
+// -clock-check 마다 다시 잰다. 첫 값은 연결하기 전에 check 로 잰다
+func (c *clockChecker) run(ctx context.Context) {
+	if c == nil {
+		return
+	}
+	tick := time.NewTicker(c.opts.Interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+			c.check(ctx)
+		}
+	}
+}
+
+// -clock-header 면 세션 헤더에 가장 최근 값을 남긴다
+func (c *clockChecker) describe(h *orderbook.FileHeader) {
+	if c == nil || !c.opts.Header {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.last != nil {
+		h.Clock = proto.Clone(c.last).(*orderbook.ClockSync)
+	}
+}
@@ -0,0 +1,1060 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"expvar"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"orderbook/orderbook"
+)
+
+const (
+	// 수집 중인 파일의 사이드카 인덱스를 다시 쓰는 간격
+	liveIndexInterval = 30 * time.Second
+)
+
+var (
+	// 거래소 주소와 레코드에 기록되는 출처. -endpoint 로 바꾼다 (network.go)
+	websocketURL = endpointPresets["global"].WebSocket
+	exchangeName = endpointPresets["global"].Exchange
+	marketType   = endpointPresets["global"].Market
+
+	symbols = []string{"ethusdt", "ethusdc", "ethbtc"}
+	// 기본은 상위 20개, 100ms 주기 스냅샷 스트림. depth@100ms, trade, bookTicker 를 추가로 받을 수 있다.
+	streamTypes = []string{"depth20@100ms"}
+)
+
+// --- 구조체 정의 ---
+type CombinedStreamEvent struct {
+	Stream string          `json:"stream"`
+	Data   json.RawMessage `json:"data"`
+}
+
+type FileManager struct {
+	mu          sync.Mutex
+	dataDir     string
+	compression orderbook.Compression
+	rotation    *rotationPolicy
+	sessionID   string
+	sequences   map[string]uint64
+	writers     map[string]*orderbook.FileWriter
+	periods     map[string]string // 열린 파일의 회전 구간
+	parts       map[string]int
+	sessions    map[string]string                            // 재시작으로 새 세션 파일을 연 구간의 표시 (rotationPolicy.open)
+	sidecars    map[string]time.Time                         // 열린 파일의 사이드카 인덱스를 마지막으로 쓴 시각
+	synced      map[string]time.Time                         // 열린 파일을 마지막으로 fsync 한 시각 (-fsync interval)
+	dedup       orderbook.DedupMode                          // 바뀌지 않은 스냅샷을 줄이는 방식 (orderbook/dedup.go)
+	deltaEvery  int                                          // 스냅샷을 이 개수마다 온전히 쓰고 사이는 델타로 쓴다 (orderbook/delta.go). 0 이면 끈다
+	writes      writeOptions                                 // 쓰기 큐와 내려보내기 (writequeue.go)
+	spill       *FileManager                                 // -write-overflow spill 에서 큐가 넘친 이벤트를 쓴다
+	describe    func(symbol string, h *orderbook.FileHeader) // 세션 헤더에 심볼의 수집 설정을 적는다. nil 이면 적지 않는다
+
+	// 쓰기 실패 처리 (failover.go). mu 가 보호한다
+	failoverDir string
+	health      writeHealth
+	broken      map[string]bool      // 실패해서 닫은 파일이 있다. 같은 구간이면 새 세션 파일을 연다
+	retryAt     map[string]time.Time // 실패한 심볼을 다시 시도할 시각. 그때까지 이벤트를 버린다
+
+	seqMu sync.Mutex // sequences 만 보호한다. 수신 루프가 파일 쓰기를 기다리지 않게 mu 와 나눈다
+
+	queueMu      sync.RWMutex
+	queues       map[string]*writeQueue
+	queuesClosed bool
+
+	closed      bool         // Close 뒤에는 파일을 다시 열지 않는다. mu 가 보호한다
+	lateDropped atomic.Int64 // 닫힌 뒤에 들어와 버린 이벤트 수
+
+	// 회전으로 닫힌 파일 경로를 받는다 (업로드 등). fm.mu 를 잡은 채 호출되므로 막히면 안 된다.
+	onRotate func(path string)
+}
+
+func NewFileManager(dataDir string, compression orderbook.Compression, rotation *rotationPolicy) *FileManager {
+	return &FileManager{
+		dataDir:     dataDir,
+		compression: compression,
+		rotation:    rotation,
+		sessionID:   newSessionID(),
+		sequences:   make(map[string]uint64),
+		writers:     make(map[string]*orderbook.FileWriter),
+		periods:     make(map[string]string),
+		parts:       make(map[string]int),
+		sessions:    make(map[string]string),
+		sidecars:    make(map[string]time.Time),
+		synced:      make(map[string]time.Time),
+		broken:      make(map[string]bool),
+		retryAt:     make(map[string]time.Time),
+		queues:      make(map[string]*writeQueue),
+	}
+}
+
+// 회전 구간이 바뀌었거나 파일이 크기 한도를 넘었으면 새 파일을 연다. 구간은 이벤트의 수신 시각 at 으로 정하므로
+// 큐에서 늦게 꺼낸 이벤트도 받은 때의 파일에 들어간다.
+// fm.mu 를 잡은 상태에서 호출해야 한다.
+func (fm *FileManager) getWriter(symbol string, at time.Time) (*orderbook.FileWriter, error) {
+	now := at.UTC()
+	period := fm.rotation.period(now)
+	symbolLower := strings.ToLower(symbol)
+	fw := fm.writers[symbolLower]
+	switch {
+	case fm.broken[symbolLower] && fm.periods[symbolLower] == period:
+		// 실패한 파일은 끝이 잘렸을 수 있으므로 이어 쓰지 않고 같은 구간의 새 세션 파일을 연다
+		session := now.Format("150405")
+		fm.sessions[symbolLower] = session
+		return fm.openFile(symbol, fm.rotation.path(fm.dataDir, symbolLower, now, fm.parts[symbolLower], session), period, fm.parts[symbolLower])
+	case fw == nil || fm.periods[symbolLower] != period:
+		fm.rotate(symbolLower)
+		fileName, part, session := fm.rotation.open(fm.dataDir, symbolLower, now)
+		fm.sessions[symbolLower] = session
+		return fm.openFile(symbol, fileName, period, part)
+	case fm.rotation.MaxBytes > 0 && fw.Size() >= fm.rotation.MaxBytes:
+		part := fm.parts[symbolLower] + 1
+		fm.rotate(symbolLower)
+		return fm.openFile(symbol, fm.rotation.path(fm.dataDir, symbolLower, now, part, fm.sessions[symbolLower]), period, part)
+	}
+	return fw, nil
+}
+
+// fm.mu 를 잡은 상태에서 호출해야 한다.
+func (fm *FileManager) openFile(symbol, fileName, period string, part int) (*orderbook.FileWriter, error) {
+	if err := os.MkdirAll(filepath.Dir(fileName), os.ModePerm); err != nil {
+		return nil, err
+	}
+	// 같은 구간에 재시작했고 -on-restart append 면 기존 파일 끝에 새 세션으로 이어 쓴다
+	header := &orderbook.FileHeader{
+		CreatedAt:   time.Now().UTC().UnixMilli(),
+		Symbol:      strings.ToUpper(symbol),
+		Exchange:    exchangeName,
+		MarketType:  marketType,
+		SessionId:   fm.sessionID,
+		Compression: fm.compression,
+	}
+	if fm.describe != nil {
+		fm.describe(strings.ToLower(symbol), header)
+	}
+	fw, err := orderbook.OpenFileWriter(fileName, header)
+	if err != nil {
+		return nil, err
+	}
+	fw.SetDedup(fm.dedup)
+	fw.SetDeltaEvery(fm.deltaEvery)
+	fw.SetSyncOnClose(fm.writes.Fsync != fsyncNever)
+	if fm.writes.Queue > 0 {
+		if err := fw.SetBufferSize(int(fm.writes.FlushBytes)); err != nil {
+			fw.Close()
+			return nil, err
+		}
+	}
+	symbolLower := strings.ToLower(symbol)
+	fm.writers[symbolLower] = fw
+	fm.periods[symbolLower] = period
+	fm.parts[symbolLower] = part
+	delete(fm.broken, symbolLower)
+	log.Printf("Opened new data file for %s: %s", symbolLower, fileName)
+	return fw, nil
+}
+
+// 열린 파일을 닫고 onRotate 에 알린다. 종료할 때 닫는 파일은 같은 구간에 이어 쓸 수 있으므로 알리지 않는다.
+// fm.mu 를 잡은 상태에서 호출해야 한다.
+func (fm *FileManager) rotate(symbolLower string) {
+	fw, ok := fm.writers[symbolLower]
+	if !ok {
+		return
+	}
+	fm.closeFile(symbolLower)
+	if fm.onRotate != nil {
+		fm.onRotate(fw.Name())
+	}
+}
+
+// fm.mu 를 잡은 상태에서 호출해야 한다.
+func (fm *FileManager) closeFile(symbolLower string) {
+	fw, ok := fm.writers[symbolLower]
+	if !ok {
+		return
+	}
+	// 남은 압축 블록과 블록 인덱스 footer 가 이때 기록된다
+	if err := fw.Close(); err != nil {
+		log.Printf("Error closing data file %s: %v", fw.Name(), err)
+	} else if err := orderbook.RemoveSidecar(fw.Name()); err != nil {
+		log.Printf("Error removing live index of %s: %v", fw.Name(), err)
+	}
+	delete(fm.writers, symbolLower)
+	delete(fm.sidecars, symbolLower)
+	delete(fm.synced, symbolLower)
+	delete(fm.periods, symbolLower)
+}
+
+// 큐에 남은 이벤트를 쓰고 열린 파일을 모두 닫는다. 이후에 들어오는 이벤트는 버린다
+func (fm *FileManager) Close() {
+	fm.stopQueues()
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	fm.closed = true
+	for symbolLower := range fm.writers {
+		fm.closeFile(symbolLower)
+	}
+	if fm.spill != nil {
+		fm.spill.Close()
+	}
+}
+
+// 수신한 메시지마다 심볼별 순번을 발급한다. 파싱이나 쓰기에 실패해도 번호는 소비되므로
+// 읽는 쪽에서 수집기 내부의 유실을 순번 공백으로 알아챌 수 있다.
+func (fm *FileManager) nextSequence(symbol string) uint64 {
+	fm.seqMu.Lock()
+	defer fm.seqMu.Unlock()
+	symbolLower := strings.ToLower(symbol)
+	fm.sequences[symbolLower]++
+	return fm.sequences[symbolLower]
+}
+
+func newSessionID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// 쓰기 큐가 있으면 넣기만 하고(writequeue.go), 없으면 바로 쓰고 내려보낸다
+func (fm *FileManager) writeEvent(symbol string, ev *orderbook.Event) {
+	if fm.writes.Queue > 0 {
+		fm.enqueue(symbol, ev)
+		return
+	}
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	writer := fm.writeLocked(symbol, ev)
+	if writer == nil {
+		return
+	}
+	start := time.Now()
+	if err := writer.Flush(); err != nil {
+		fm.writeFailed(symbol, err)
+		return
+	}
+	pipelineTelemetry.timed("flush", start)
+	fm.syncFile(symbol, writer, fm.writes.Fsync == fsyncEveryWrite)
+	fm.maintainSidecar(symbol, writer)
+}
+
+// 닫힌 뒤(종료 중)에 들어온 이벤트를 버린다. 로그는 처음 한 번만 남긴다
+func (fm *FileManager) dropLate(symbol string, ev *orderbook.Event) {
+	if fm.lateDropped.Add(1) == 1 {
+		log.Printf("Data files closed, dropping events that arrive during shutdown (first: %s seq %d)", symbol, ev.Sequence)
+	}
+}
+
+// 이벤트를 알맞은 파일에 쓰고 그 파일을 돌려준다. 실패하면 writeFailed 를 따르고(failover.go) 버렸으면 nil.
+// fm.mu 를 잡은 상태에서 호출해야 한다.
+func (fm *FileManager) writeLocked(symbol string, ev *orderbook.Event) *orderbook.FileWriter {
+	if fm.closed {
+		// 닫은 뒤에 새로 연 파일은 footer 없이 종료에 잘린다
+		fm.dropLate(symbol, ev)
+		return nil
+	}
+	symbolLower := strings.ToLower(symbol)
+	if at, ok := fm.retryAt[symbolLower]; ok {
+		if time.Now().Before(at) {
+			fm.health.Dropped++
+			return nil
+		}
+		delete(fm.retryAt, symbolLower)
+		log.Printf("Retrying writes for %s (%d events dropped so far)", symbol, fm.health.Dropped)
+	}
+	for {
+		writer, err := fm.getWriter(symbol, time.UnixMilli(ev.EventTime))
+		if err == nil {
+			start := time.Now()
+			if err = writer.Write(ev); err == nil {
+				pipelineTelemetry.written(ev, start, time.Now())
+				return writer
+			}
+		}
+		if !fm.writeFailed(symbol, err) {
+			fm.health.Dropped++
+			log.Printf("Event for %s (seq %d) dropped, retrying writes in %s", symbol, ev.Sequence, writeRetryInterval)
+			return nil
+		}
+	}
+}
+
+// 수집 중인 파일에는 footer 가 없으므로 사이드카로 블록 인덱스를 자주 남겨 최근 시각 조회가 파일을 다 읽지 않게 한다.
+// fm.mu 를 잡은 상태에서 호출해야 한다.
+func (fm *FileManager) maintainSidecar(symbol string, writer *orderbook.FileWriter) {
+	symbolLower := strings.ToLower(symbol)
+	if fm.writers[symbolLower] != writer {
+		return // 그 사이 회전했거나 실패해서 닫혔다
+	}
+	if now := time.Now(); now.Sub(fm.sidecars[symbolLower]) >= liveIndexInterval {
+		fm.sidecars[symbolLower] = now
+		if err := writer.WriteSidecar(); err != nil {
+			log.Printf("Error writing live index for %s: %v", symbol, err)
+		}
+	}
+}
+
+func runCollect(args []string) error {
+	fs := flag.NewFlagSet("collect", flag.ExitOnError)
+	symbolList := fs.String("symbols", strings.Join(symbols, ","), "comma-separated symbols to collect")
+	streamList := fs.String("streams", strings.Join(streamTypes, ","), "comma-separated stream types (depth20@100ms, depth@100ms, trade, bookTicker, ticker, !miniTicker@arr)")
+	sampleList := fs.String("symbol-sample", "", "keep only 1 of every N partial depth snapshots for these symbols, symbol:N[,...] (e.g. xyzusdt:10)")
+	depthList := fs.String("symbol-depth", "", "per-symbol partial depth stream replacing the one in -streams, symbol:depth<5|10|20>@<100ms|1000ms>[,...] (e.g. xyzusdt:depth5@1000ms)")
+	compression := fs.String("compression", "none", "data file compression: none or zstd")
+	deltaEvery := fs.Int("delta-every", 0, "write a full snapshot every this many snapshots per stream and only changed levels in between (readers reconstruct them); 0 writes every snapshot in full")
+	var writes writeOptions
+	writes.register(fs)
+	var pipeline pipelineOptions
+	pipeline.register(fs)
+	var discovery discoverOptions
+	discovery.register(fs)
+	var network networkOptions
+	network.register(fs)
+	var derivatives derivativesOptions
+	derivatives.register(fs)
+	var otlp telemetryOptions
+	otlp.register(fs)
+	var clockOpts clockOptions
+	clockOpts.register(fs)
+	dedup := fs.String("dedup", "off", "snapshots with the same lastUpdateId as the previous one: off writes them, marker writes a compact unchanged marker that readers expand, skip drops them (leaves sequence gaps that read reports as lost)")
+	fs.IntVar(&bootstrapDepth, "bootstrap-depth", bootstrapDepth, "on every (re)connect, record a REST depth snapshot with this many levels per symbol before the stream; 0 disables")
+	fs.BoolVar(&keepDecimalText, "keep-decimals", false, "also store the exchange's original price/quantity strings so exports can reproduce them exactly")
+	adminAddr := fs.String("admin", "", "admin/metrics listen address (e.g. 127.0.0.1:6060); empty disables")
+	blockRate := fs.Int("block-profile-rate", 0, "record goroutine blocking events for /debug/pprof/block (runtime.SetBlockProfileRate, ns); 0 disables")
+	mutexFraction := fs.Int("mutex-profile-fraction", 0, "sample 1/n mutex contention events for /debug/pprof/mutex; 0 disables")
+	cacheTTL := fs.Duration("cache-ttl", time.Minute, "how long recent events stay in the in-memory cache")
+	cacheMax := fs.String("cache-max-bytes", "16MB", "in-memory cache limit per symbol")
+	rotate := fs.String("rotate", rotateDaily, "start a new file every UTC day or hour (day, hour)")
+	rotateSize := fs.String("rotate-size", "0", "also start a new part when a file reaches this size (e.g. 512MB); 0 disables")
+	pidFile := fs.String("pid-file", "", "write the process id to this file while running and refuse to start if the process in it is alive; see systemd.go")
+	leaderSpec := fs.String("leader", "", "run hot/standby: collect only while holding this leader lock (file, file:///path, redis://host:6379/0, etcd://host:2379); see leader.go")
+	instance := fs.String("instance", "", "collector instance id when several collectors share the data directory; added to file names as @<id>")
+	onRestart := fs.String("on-restart", restartAppend, "when restarting into a period whose file exists: append to it, start a session file (name~HHMMSS), or roll to the next part")
+	fileTemplate := fs.String("file-template", "", "data file name template under the data directory (see rotation.go); default depends on -rotate")
+	ticksDir := fs.String("ticks-dir", "", "also record the best bid/ask change stream (ticks) into this data directory; empty disables")
+	liquidationsDir := fs.String("liquidations-dir", "liquidations", "with -streams forceOrder (futures), record liquidations into this data directory; empty keeps them in the symbol's data files")
+	tickersDir := fs.String("tickers-dir", "tickers", "with -streams !miniTicker@arr or !ticker@arr, record every symbol's 24h statistics into this data directory")
+	rawDir := fs.String("raw-dir", "", "also store every websocket message as received (zstd, length-prefixed) under this directory so data files can be rebuilt with reprocess; empty disables")
+	cacheLimits := fs.String("cache-limits", "", "per-symbol cache overrides, symbol:ttl:maxbytes[,...] (e.g. btcusdt:30s:64MB)")
+	var retention retentionPolicy
+	retention.register(fs)
+	var upload uploadOptions
+	upload.register(fs)
+	symbolRefresh := fs.Duration("symbol-refresh", 24*time.Hour, "how often to save symbol metadata (exchangeInfo) into the data directory; 0 disables")
+	var gcOpts gcOptions
+	gcOpts.register(fs)
+	var sinkSpecs []string
+	fs.Func("sink", "also publish live events to this sink URL (repeatable; "+strings.Join(sinkSchemes(), ", ")+"); see breaker.go", func(v string) error {
+		sinkSpecs = append(sinkSpecs, v)
+		return nil
+	})
+	var breakers breakerOptions
+	breakers.register(fs)
+	var alerts alertOptions
+	alerts.register(fs)
+	grpcAddr := fs.String("grpc", "", "serve StreamLive/StreamHistorical over gRPC on this address (e.g. :9090); empty disables")
+	grpcToken := fs.String("grpc-token", os.Getenv("ORDERBOOK_GRPC_TOKEN"), "require this bearer token on gRPC calls (default $ORDERBOOK_GRPC_TOKEN)")
+	fs.Parse(args)
+	if err := gcOpts.apply(); err != nil {
+		return err
+	}
+	symbols = splitList(strings.ToLower(*symbolList))
+	streamTypes = splitList(*streamList)
+	depths, err := parseSymbolDepth(*depthList)
+	if err != nil {
+		return err
+	}
+	symbolDepth = depths
+	for symbol := range depths {
+		if !slices.Contains(symbols, symbol) {
+			log.Printf("-symbol-depth %s ignored: not in -symbols", symbol)
+		}
+	}
+	samples, err := parseSymbolSample(*sampleList)
+	if err != nil {
+		return err
+	}
+	symbolSample = samples
+	for symbol := range samples {
+		if !slices.Contains(symbols, symbol) {
+			log.Printf("-symbol-sample %s ignored: not in -symbols", symbol)
+		}
+	}
+
+	var comp orderbook.Compression
+	switch *compression {
+	case "none":
+		comp = orderbook.Compression_COMPRESSION_NONE
+	case "zstd":
+		comp = orderbook.Compression_COMPRESSION_ZSTD
+	default:
+		return fmt.Errorf("unknown compression %q", *compression)
+	}
+	var dedupMode orderbook.DedupMode
+	switch *dedup {
+	case "off":
+		dedupMode = orderbook.DedupOff
+	case "marker":
+		dedupMode = orderbook.DedupMarker
+	case "skip":
+		dedupMode = orderbook.DedupSkip
+	default:
+		return fmt.Errorf("unknown dedup mode %q (off, marker, skip)", *dedup)
+	}
+
+	maxFile, err := parseBytes(*rotateSize)
+	if err != nil {
+		return err
+	}
+	rotation, err := newRotationPolicy(*rotate, maxFile, *fileTemplate, *instance, *onRestart)
+	if err != nil {
+		return err
+	}
+
+	if err := writes.parse(); err != nil {
+		return err
+	}
+	if err := pipeline.parse(); err != nil {
+		return err
+	}
+	if err := discovery.parse(); err != nil {
+		return err
+	}
+	if err := network.apply(); err != nil {
+		return err
+	}
+	if err := derivatives.parse(); err != nil {
+		return err
+	}
+	if err := retention.parse(); err != nil {
+		return err
+	}
+	if err := breakers.parse(); err != nil {
+		return err
+	}
+	if err := alerts.parse(); err != nil {
+		return err
+	}
+	if err := otlp.parse(); err != nil {
+		return err
+	}
+	if err := clockOpts.parse(); err != nil {
+		return err
+	}
+
+	defaults := cachePolicy{TTL: *cacheTTL}
+	if defaults.MaxBytes, err = parseBytes(*cacheMax); err != nil {
+		return err
+	}
+	overrides, err := parseCachePolicies(*cacheLimits, defaults)
+	if err != nil {
+		return err
+	}
+
+	// 청산(forceOrder)은 드물고 성격이 달라 따로 모은다. 구독하지 않으면 디렉터리를 만들지 않는다.
+	if !slices.ContainsFunc(streamTypes, func(t string) bool { return streamKind(t) == "forceOrder" }) {
+		*liquidationsDir = ""
+	}
+
+	// 시장 전체 24시간 통계는 수집하지 않는 심볼까지 오므로 심볼 데이터 파일과 섞지 않는다
+	for _, t := range marketStreamTypes() {
+		if kind := streamKind(t[1:]); kind != "ticker" && kind != "miniTicker" {
+			return fmt.Errorf("unsupported market stream %q (!miniTicker@arr, !ticker@arr)", t)
+		}
+		if *tickersDir == "" {
+			return fmt.Errorf("-streams %s needs -tickers-dir", t)
+		}
+	}
+	if len(marketStreamTypes()) == 0 {
+		*tickersDir = ""
+	}
+
+	releasePID := func() {}
+	if *pidFile != "" {
+		if releasePID, err = writePIDFile(*pidFile); err != nil {
+			return err
+		}
+		defer releasePID()
+	}
+
+	// 리더 잠금을 얻을 때까지 standby 로 기다린다 (leader.go). 얻은 뒤에는 이전 리더의 임대를 넘겨받는다
+	var leader leaderLock
+	if *leaderSpec != "" {
+		if leader, err = openLeaderLock(*leaderSpec, defaultDataDir, *instance); err != nil {
+			return err
+		}
+		waitCtx, stopWait := interruptContext()
+		err := becomeLeader(waitCtx, leader, releasePID)
+		stopWait()
+		if err != nil {
+			leader.release()
+			if waitCtx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		defer leader.release()
+	}
+
+	// 같은 디렉터리에 같은 이름으로 쓰는 다른 수집기가 있으면 시작하지 않는다.
+	// 어느 단계에서 끝나든 임대를 놓아 다시 시작할 때 임대가 낡기를 기다리지 않게 한다
+	var leases []*instanceLease
+	defer func() {
+		for _, l := range leases {
+			l.release()
+		}
+	}()
+	leaseDirs := []string{defaultDataDir, *ticksDir, *liquidationsDir, *tickersDir, *rawDir}
+	for _, dir := range []string{writes.SpillDir, writes.FailoverDir} {
+		if dir == "" {
+			continue
+		}
+		leaseDirs = append(leaseDirs, filepath.Join(dir, "data"))
+		if *ticksDir != "" {
+			leaseDirs = append(leaseDirs, filepath.Join(dir, "ticks"))
+		}
+		if *liquidationsDir != "" {
+			leaseDirs = append(leaseDirs, filepath.Join(dir, "liquidations"))
+		}
+		if *tickersDir != "" {
+			leaseDirs = append(leaseDirs, filepath.Join(dir, "tickers"))
+		}
+	}
+	for _, dir := range leaseDirs {
+		if dir == "" {
+			continue
+		}
+		lease, err := acquireInstanceLease(dir, *instance, leader != nil)
+		if err != nil {
+			return err
+		}
+		go lease.run()
+		leases = append(leases, lease)
+	}
+
+	// 세션 헤더에 구독 스트림, 표본 비율, 상장 시간과 함께 호가/수량 단위를 남긴다
+	meta := loadSymbolMetadata(defaultDataDir)
+	var clock *clockChecker // 아래에서 alerter 를 만든 뒤 정한다
+	describe := func(symbol string, h *orderbook.FileHeader) {
+		describeSymbol(symbol, h)
+		meta.describe(symbol, h)
+		clock.describe(h)
+	}
+	fm := NewFileManager(defaultDataDir, comp, rotation)
+	fm.dedup, fm.deltaEvery, fm.writes = dedupMode, *deltaEvery, writes
+	fm.describe = describe
+	var ticks *tickRecorder
+	if *ticksDir != "" {
+		ticks = &tickRecorder{fm: NewFileManager(*ticksDir, comp, rotation), deriver: orderbook.NewTickDeriver()}
+		ticks.fm.writes = writes
+	}
+	var liquidations *FileManager
+	if *liquidationsDir != "" {
+		liquidations = NewFileManager(*liquidationsDir, comp, rotation)
+		liquidations.writes, liquidations.describe = writes, describe
+	}
+	// 통계 파일의 세션 헤더에는 심볼 스트림 대신 시장 스트림을 남긴다
+	describeTickers := func(symbol string, h *orderbook.FileHeader) {
+		describe(symbol, h)
+		h.Streams = marketStreamTypes()
+	}
+	var tickers *FileManager
+	if *tickersDir != "" {
+		tickers = NewFileManager(*tickersDir, comp, rotation)
+		tickers.writes, tickers.describe = writes, describeTickers
+	}
+	if writes.FailoverDir != "" {
+		fm.failoverDir = filepath.Join(writes.FailoverDir, "data")
+		if ticks != nil {
+			ticks.fm.failoverDir = filepath.Join(writes.FailoverDir, "ticks")
+		}
+		if liquidations != nil {
+			liquidations.failoverDir = filepath.Join(writes.FailoverDir, "liquidations")
+		}
+		if tickers != nil {
+			tickers.failoverDir = filepath.Join(writes.FailoverDir, "tickers")
+		}
+	}
+	if writes.Overflow == overflowSpill {
+		fm.spill = writes.spillManager(filepath.Join(writes.SpillDir, "data"), comp, rotation)
+		fm.spill.describe = describe
+		if ticks != nil {
+			ticks.fm.spill = writes.spillManager(filepath.Join(writes.SpillDir, "ticks"), comp, rotation)
+		}
+		if liquidations != nil {
+			liquidations.spill = writes.spillManager(filepath.Join(writes.SpillDir, "liquidations"), comp, rotation)
+			liquidations.spill.describe = describe
+		}
+		if tickers != nil {
+			tickers.spill = writes.spillManager(filepath.Join(writes.SpillDir, "tickers"), comp, rotation)
+			tickers.spill.describe = describeTickers
+		}
+	}
+	var raw *rawRecorder
+	if *rawDir != "" {
+		raw = newRawRecorder(*rawDir, fm.sessionID)
+		go raw.run()
+	}
+	// 디렉터리마다 쓰기 상태, 알림, 회전 후 처리, 보관 기간을 똑같이 적용한다
+	fms := map[string]*FileManager{"data": fm}
+	if ticks != nil {
+		fms["ticks"] = ticks.fm
+	}
+	if liquidations != nil {
+		fms["liquidations"] = liquidations
+	}
+	if tickers != nil {
+		fms["tickers"] = tickers
+	}
+	// 업로드 대상을 열지 못하면 싱크나 telemetry 를 열기 전에 끝낸다
+	for name, m := range fms {
+		if err := startFileLifecycle(name, m, retention, upload); err != nil {
+			return err
+		}
+	}
+	publishWriteHealth(fms)
+	alerter := newAlerter(alerts, *instance, fms)
+	// 첫 파일 헤더에 들어가도록 연결 전에 한 번 잰다 (clock.go)
+	if clock = newClockChecker(clockOpts, alerter); clock != nil {
+		checkCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		clock.check(checkCtx)
+		cancel()
+	}
+	if otlp.Endpoint != "" {
+		if pipelineTelemetry, err = startTelemetry(context.Background(), otlp, *instance, fms); err != nil {
+			return err
+		}
+		// 어느 단계에서 끝나든 남은 span 과 메트릭을 내보낸다. 종료할 때는 파일을 닫은 뒤에 불린다
+		defer func() {
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			pipelineTelemetry.close(flushCtx)
+			cancel()
+		}()
+	}
+	expvar.Publish("stream_rates", expvar.Func(func() any { return collectRates.status() }))
+	expvar.Publish("write_queues", expvar.Func(func() any {
+		st := make(map[string]any, len(fms))
+		for name, m := range fms {
+			st[name] = m.queueStatus()
+		}
+		return st
+	}))
+
+	// TTL 과 크기가 모두 0 이면 무제한이 되므로 캐시를 끈다
+	var cache *liveCache
+	if defaults.TTL > 0 || defaults.MaxBytes > 0 {
+		cache = newLiveCache(defaults, overrides)
+		go cache.runSweeper(time.Second)
+		expvar.Publish("live_cache", expvar.Func(func() any { return cache.stats() }))
+	}
+	var sinks *sinkSet
+	if len(sinkSpecs) > 0 {
+		if sinks, err = openSinkSet(sinkSpecs, breakers.breakerConfig, defaultDataDir); err != nil {
+			return err
+		}
+		defer sinks.close() // 스풀에 남은 이벤트를 내려쓰고 연결을 닫는다
+	}
+	var live *liveHub
+	if *grpcAddr != "" {
+		live = newLiveHub(cache)
+		if err := startGRPCServer(*grpcAddr, defaultDataDir, live, *grpcToken); err != nil {
+			return err
+		}
+	}
+	if *adminAddr != "" {
+		runtime.SetBlockProfileRate(*blockRate)
+		runtime.SetMutexProfileFraction(*mutexFraction)
+		startAdminServer(*adminAddr)
+	}
+	if *symbolRefresh > 0 {
+		go meta.runRefresher(context.Background(), *symbolRefresh)
+	}
+
+	// 종료 신호를 받으면 읽기 루프를 끝내고 (아래) 파일을 닫는다
+	ctx, stop := interruptContext()
+	defer stop()
+
+	go alerter.run(ctx)
+	go clock.run(ctx)
+
+	// 첫 연결 전에 한 번 골라 둔다. 실패하면 -symbols 만으로 시작하고 다음 주기에 다시 시도한다.
+	var discoverer *symbolDiscovery
+	if discovery.Enabled {
+		discoverer = newSymbolDiscovery(discovery, symbols)
+		if err := discoverer.update(ctx); err != nil {
+			log.Printf("Symbol discovery failed, collecting -symbols only until the next refresh: %v", err)
+		}
+		go discoverer.run(ctx)
+	}
+
+	// systemd 에 준비를 알리고 워치독을 시작한다 (systemd.go)
+	collectorAlive()
+	notifySystemd("READY=1")
+	startWatchdog()
+
+	// 종료 신호를 받을 때까지 자동으로 다시 연결한다
+	for {
+		collectorAlive()
+		runCollector(ctx, fm, liquidations, tickers, cache, ticks, sinks, live, raw, alerter, pipeline, discoverer, derivatives)
+		if ctx.Err() != nil {
+			break
+		}
+		alerter.disconnected()
+		collectorAlive()
+		notifySystemd("STATUS=Disconnected, reconnecting")
+		log.Printf("Disconnected. Reconnecting in 5 seconds...")
+		select {
+		case <-ctx.Done():
+		case <-time.After(5 * time.Second):
+		}
+	}
+
+	// 읽기 루프와 심볼 고루틴이 끝났으므로 더 들어오는 이벤트 없이 압축 중인 세그먼트와 버퍼를 내려쓴다.
+	// 한 번 더 인터럽트하면 기다리지 않고 끝난다.
+	stop()
+	notifySystemd("STOPPING=1")
+	log.Printf("Shutting down, flushing data files...")
+	fm.Close()
+	if ticks != nil {
+		ticks.fm.Close()
+	}
+	if liquidations != nil {
+		liquidations.Close()
+	}
+	if tickers != nil {
+		tickers.Close()
+	}
+	if raw != nil {
+		raw.Close()
+	}
+	return nil // 싱크와 telemetry 는 defer 로 닫는다
+}
+
+// 회전으로 닫힌 fm 의 파일을 manifest 에 더한 뒤 (-downsample-on-rotate 면) 줄인 사본을 만들고 (-upload 면) 올리도록
+// fm.onRotate 를 잇고, 보관 기간을 적용한다. name 은 fms 의 이름 (data, ticks 등).
+// 줄인 사본은 스냅샷만 남기므로 data 디렉터리만 만든다. 다른 디렉터리는 -retain-raw 가 지나면 그냥 지운다.
+func startFileLifecycle(name string, fm *FileManager, retention retentionPolicy, upload uploadOptions) error {
+	dataDir, keyPrefix := fm.dataDir, ""
+	if name != "data" {
+		retention.DownsampleDir, retention.OnRotate = "", false
+		keyPrefix = name // 데이터 파일과 이름이 겹친다 (upload.go)
+	}
+	if retention.enabled() {
+		go runRetention(dataDir, &retention, time.Hour)
+	}
+	if upload.target != "" {
+		u, err := newUploader(upload, dataDir, keyPrefix)
+		if err != nil {
+			return err
+		}
+		go u.run(context.Background())
+		fm.onRotate = u.enqueue
+	}
+	if retention.OnRotate {
+		// 업로드 후 원본을 지우는 경우가 있으므로 사본을 먼저 만들고 업로드로 넘긴다
+		a := newArchiver(dataDir, &retention, fm.onRotate)
+		go a.run()
+		fm.onRotate = a.enqueue
+	}
+	// 닫힌 파일을 manifest 에 더한 뒤 보관, 업로드로 넘긴다
+	manifest := newManifestUpdater(dataDir, fm.onRotate)
+	go manifest.run()
+	fm.onRotate = manifest.enqueue
+	return nil
+}
+
+// liquidations 가 있으면 청산 이벤트는 fm 대신 그쪽에 기록한다 (순번도 그쪽에서 매긴다).
+// 시장 전체 스트림의 통계는 tickers 에 기록한다.
+// raw 가 있으면 받은 메시지를 파싱 전에 그대로 남긴다 (raw.go).
+// alerter 가 있으면 연결 상태와 증분 순번을 알린다 (alert.go).
+// liquidations, tickers, cache, ticks, sinks, live, raw, alerter, discoverer 는 nil 이어도 된다.
+// ctx 가 끝나면 연결을 닫고, 이미 받은 메시지를 모두 처리한 뒤 돌아온다.
+func runCollector(ctx context.Context, fm, liquidations, tickers *FileManager, cache *liveCache, ticks *tickRecorder, sinks *sinkSet, live *liveHub, raw *rawRecorder, alerter *alerter, pipeline pipelineOptions, discoverer *symbolDiscovery, derivatives derivativesOptions) {
+	subscribed := currentSymbols()
+	var streamNames []string
+	for _, s := range subscribed {
+		for _, t := range symbolStreamTypes(s) {
+			streamNames = append(streamNames, streamSymbol(s)+"@"+t)
+		}
+	}
+	streamNames = append(streamNames, marketStreamTypes()...)
+	if len(streamNames) > maxStreamsPerConnection {
+		log.Printf("Subscribing %d streams, more than the %d one connection allows; lower -discover-max or -streams", len(streamNames), maxStreamsPerConnection)
+	}
+	fullURL := websocketURL + strings.Join(streamNames, "/")
+
+	conn, _, err := wsDialer.DialContext(ctx, fullURL, nil)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("WebSocket dial error: %v", err)
+		}
+		return
+	}
+	defer conn.Close()
+	defer context.AfterFunc(ctx, func() { conn.Close() })() // 읽기를 깨운다
+
+	// 퐁과 SUBSCRIBE 요청이 함께 쓰므로 쓰기를 직렬화한다
+	var writeMu sync.Mutex
+	conn.SetPingHandler(func(appData string) error {
+		collectorAlive()
+		log.Println("Received Ping, sending Pong.")
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		return conn.WriteMessage(websocket.PongMessage, []byte(appData))
+	})
+
+	log.Printf("Connected to combined stream: %s", fullURL)
+	alerter.connected()
+	notifySystemd(fmt.Sprintf("STATUS=Connected, %d streams", len(streamNames)))
+
+	// 파일, 캐시, tick, 싱크, gRPC 구독자로 내보낸다
+	handle := func(symbol string, ev *orderbook.Event) {
+		switch {
+		case liquidations != nil && ev.GetLiquidation() != nil:
+			liquidations.writeEvent(symbol, ev)
+		case tickers != nil && isMarketStream(ev.StreamType):
+			tickers.writeEvent(symbol, ev)
+		default:
+			fm.writeEvent(symbol, ev)
+		}
+		if cache != nil {
+			cache.Add(ev)
+		}
+		if ticks != nil {
+			ticks.record(symbol, ev)
+		}
+		sinks.publish(ev)
+		live.publish(ev)
+		alerter.observe(symbol, ev)
+	}
+
+	// 첫 스트림 스냅샷을 기다리는 동안의 빈 구간이 없도록 REST 스냅샷을 먼저 기록한다.
+	// 그동안 온 스트림 메시지는 소켓 버퍼에 남아 있다가 이어서 읽힌다.
+	restSnapshot := func(symbol string) *orderbook.Event {
+		if bootstrapDepth <= 0 {
+			return nil
+		}
+		ev, err := fetchRESTSnapshot(ctx, symbol, bootstrapDepth)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			log.Printf("REST bootstrap snapshot for %s failed, waiting for the stream: %v", symbol, err)
+			return nil
+		}
+		return ev
+	}
+	for _, symbol := range subscribed {
+		collectorAlive() // 심볼이 많으면 오래 걸린다
+		if ev := restSnapshot(symbol); ev != nil {
+			ev.Sequence = fm.nextSequence(symbol)
+			handle(symbol, ev)
+		}
+	}
+
+	// 연결 중에 다른 고루틴이 REST 로 받은 이벤트는 읽기 루프가 순번을 매겨 심볼 큐로 넘긴다.
+	// 따로 순번을 매기면 같은 심볼의 스트림 메시지와 순번 순서가 뒤바뀔 수 있다.
+	injected := make(chan injectedEvent, 256)
+	done := make(chan struct{})
+	defer close(done)
+	inject := func(symbol string, ev *orderbook.Event) {
+		select {
+		case injected <- injectedEvent{symbol, ev}:
+		case <-done:
+		}
+	}
+
+	// 연결 중에 발견된 심볼은 SUBSCRIBE/UNSUBSCRIBE 로 맞춘다 (discover.go)
+	if discoverer != nil {
+		go discoverer.follow(conn, &writeMu, subscribed, done, func(symbol string) {
+			if ev := restSnapshot(symbol); ev != nil {
+				inject(symbol, ev)
+			}
+		})
+	}
+	// 선물 미결제약정, 펀딩비 (derivatives.go)
+	if derivatives.Interval > 0 {
+		go derivatives.run(done, inject)
+	}
+
+	latency := &latencyStats{}
+
+	// 심볼 고루틴에서 data 를 파싱해 내보낸다 (pipeline.go)
+	pipe := newSymbolPipeline(pipeline, func(symbol, stream string, data []byte, received time.Time, sequence uint64) {
+		trace := pipelineTelemetry.message(symbol, stream, received) // telemetry.go
+		defer trace.end()
+		if isMarketStream(stream) {
+			// 이 스트림만 tickers 의 순번을 매기므로 나눈 뒤 여기서 매겨도 순서가 맞는다
+			events, err := parseMarketTickers(stream, data, received)
+			if err != nil {
+				log.Printf("Stream %s data unmarshal error: %v", stream, err)
+				return
+			}
+			trace.done("parse")
+			for _, ev := range events {
+				symbol := strings.ToLower(ev.Symbol)
+				ev.Sequence = tickers.nextSequence(symbol)
+				handle(symbol, ev)
+			}
+			trace.done("handle")
+			return
+		}
+		ev, err := parseStreamEvent(stream, data, received)
+		if err != nil {
+			log.Printf("Stream %s data unmarshal error (seq %d dropped): %v", stream, sequence, err)
+			return
+		}
+		trace.done("parse")
+		ev.Sequence = sequence
+		if ev.ExchangeTime != 0 {
+			latency.observe(time.Duration(ev.LatencyUs) * time.Microsecond)
+		}
+		trace.event(ev)
+
+		handle(symbol, ev)
+		trace.done("handle")
+	}, handle)
+	defer pipe.close()
+
+	// 메시지 버퍼는 연결 동안 재사용한다. data 는 메시지의 일부이고 dispatch 가 복사한다.
+	var (
+		message bytes.Buffer
+		decoder combinedDecoder
+		sampler snapshotSampler
+	)
+	for {
+		// 다음 메시지를 기다리기 전에 그동안 들어온 REST 이벤트를 넘긴다
+		for pending := true; pending; {
+			select {
+			case in := <-injected:
+				in.ev.Sequence = fm.nextSequence(in.symbol)
+				pipe.dispatchEvent(in.symbol, in.ev)
+			default:
+				pending = false
+			}
+		}
+
+		message.Reset()
+		_, r, err := conn.NextReader()
+		if err == nil {
+			_, err = message.ReadFrom(r)
+		}
+		received := time.Now()
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("WebSocket read error: %v", err)
+			}
+			return
+		}
+		collectorAlive()
+		if raw != nil {
+			raw.record(message.Bytes(), received)
+		}
+		stream, data, err := decoder.decode(message.Bytes())
+		if err != nil {
+			log.Println("Combined stream unmarshal error:", err)
+			continue
+		}
+		if stream == "" {
+			// SUBSCRIBE/UNSUBSCRIBE 응답 ({"result":null,"id":N} 또는 {"error":...})
+			if bytes.Contains(message.Bytes(), []byte(`"error"`)) {
+				log.Printf("Subscription request failed: %s", message.Bytes())
+			}
+			continue
+		}
+
+		collectRates.observe(stream, message.Len(), received)
+		pipelineTelemetry.received(stream, message.Len())
+
+		// 순번은 받은 순서대로 여기서 매긴다
+		symbolFromStream, streamType, _ := strings.Cut(stream, "@")
+		if marketType == optionsMarket {
+			symbolFromStream = strings.ToLower(symbolFromStream) // 옵션 스트림 이름은 대문자다
+		}
+		if !sampler.keep(symbolFromStream, stream) {
+			continue
+		}
+		sequences := fm
+		if liquidations != nil && streamKind(streamType) == "forceOrder" {
+			sequences = liquidations
+		}
+		if isMarketStream(stream) {
+			// 심볼마다 나눈 뒤 순번을 매긴다. 시장 스트림마다 고루틴 하나가 맡는다.
+			pipe.dispatch(symbolFromStream, stream, data, received, 0)
+			continue
+		}
+		pipe.dispatch(symbolFromStream, stream, data, received, sequences.nextSequence(symbolFromStream))
+	}
+}
+
+type injectedEvent struct {
+	symbol string
+	ev     *orderbook.Event
+}
+
+// 수신한 스냅샷/bookTicker 에서 최우선 호가 변화만 골라 별도 데이터 디렉터리에 기록한다.
+// tick 의 순번은 tick 파일 안에서 따로 매긴다.
+type tickRecorder struct {
+	fm      *FileManager
+	mu      sync.Mutex // deriver 는 심볼 고루틴이 함께 쓴다
+	deriver *orderbook.TickDeriver
+}
+
+func (t *tickRecorder) record(symbol string, ev *orderbook.Event) {
+	t.mu.Lock()
+	tick := t.deriver.Next(ev)
+	t.mu.Unlock()
+	if tick == nil {
+		return
+	}
+	tick.Sequence = t.fm.nextSequence(symbol)
+	t.fm.writeEvent(symbol, tick)
+}
+
+// 거래소 이벤트 시간(E) 대비 수신 지연을 1분마다 요약해 로그로 남긴다
+type latencyStats struct {
+	mu       sync.Mutex
+	start    time.Time
+	count    int
+	sum, max time.Duration
+}
+
+func (l *latencyStats) observe(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if l.start.IsZero() {
+		l.start = now
+	}
+	l.count++
+	l.sum += d
+	l.max = max(l.max, d)
+	if now.Sub(l.start) >= time.Minute {
+		log.Printf("Feed latency over last %s: avg %s, max %s (%d msgs)",
+			now.Sub(l.start).Round(time.Second), (l.sum / time.Duration(l.count)).Round(time.Microsecond), l.max.Round(time.Microsecond), l.count)
+		l.start, l.count, l.sum, l.max = now, 0, 0, 0
+	}
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"orderbook/orderbook"
+)
+
+// orderbook compact <file|symbol|date>... : 보관할 파일을 체크포인트 + 델타 배치로 다시 써서 줄인다 (stats 와 같은 인자).
+//
+// 스냅샷은 stream_type 별로 -checkpoint-every 마다 온전히 쓰고 그 사이는 바뀐 호가만 쓴다 (orderbook/delta.go).
+// 증분(depth@...)이 있는 파일은 REST 스냅샷부터 책을 재구성해 -checkpoint-every 마다 책 전체를
+// orderbook.CheckpointStreamType 스냅샷으로 끼워 넣으므로, 하루 중간의 시각도 처음부터 증분을 다 적용하지 않고
+// 가까운 체크포인트부터 재구성할 수 있다. 이 체크포인트도 델타로 쓰인다. 다른 레코드와 세션 헤더는 그대로 옮기고,
+// 블록 인덱스 footer 를 붙인다.
+//
+// 다 쓴 뒤 사본을 다시 읽어 (끼워 넣은 체크포인트를 빼고) 원본과 레코드가 모두 같은지 확인한 다음에야
+// 임시 파일을 옮긴다. -replace 면 원본을 바꾼다. footer 가 없는 파일(수집 중이거나 비정상 종료)은 바꾸지 않는다.
+
+type compactOptions struct {
+	checkpoint  time.Duration
+	compression string // keep, none, zstd
+	diffs       bool
+}
+
+func runCompact(args []string) error {
+	fs := flag.NewFlagSet("compact", flag.ExitOnError)
+	dataDir := fs.String("data", defaultDataDir, "data directory for symbol and date arguments")
+	outDir := fs.String("out", "", "write compacted files under this directory as <symbol>/<file>")
+	replace := fs.Bool("replace", false, "replace the input files in place (after verifying the copy)")
+	var opts compactOptions
+	fs.DurationVar(&opts.checkpoint, "checkpoint-every", 10*time.Second, "write a full snapshot (and a depth diff checkpoint) at least this often; changed levels only in between")
+	fs.StringVar(&opts.compression, "compression", "keep", "output compression: keep (as recorded), none or zstd")
+	fs.BoolVar(&opts.diffs, "diff-checkpoints", true, "insert full-book checkpoints rebuilt from depth diffs")
+	var jobOpts jobOptions
+	jobOpts.register(fs, "")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: orderbook compact [flags] (-out <dir> | -replace) <file|symbol|date>...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("nothing to compact")
+	}
+	if (*outDir == "") == !*replace {
+		return fmt.Errorf("use exactly one of -out and -replace")
+	}
+	if opts.checkpoint <= 0 {
+		return fmt.Errorf("-checkpoint-every must be positive")
+	}
+	switch opts.compression {
+	case "keep", "none", "zstd":
+	default:
+		return fmt.Errorf("unknown compression %q (keep, none, zstd)", opts.compression)
+	}
+
+	var units []jobUnit
+	for _, arg := range fs.Args() {
+		groups, err := statsTargets(*dataDir, arg, math.MinInt64, math.MaxInt64)
+		if err != nil {
+			return err
+		}
+		for _, g := range groups {
+			for _, path := range g.files {
+				fi, err := os.Stat(path)
+				if err != nil {
+					return err
+				}
+				units = append(units, jobUnit{name: path, size: fi.Size()})
+			}
+		}
+	}
+	cp, err := openCheckpoint(jobOpts.checkpoint, "compact", fmt.Sprintf("%s %v %s %s %v", *outDir, *replace, opts.checkpoint, opts.compression, opts.diffs), jobOpts.resume)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	return runJob(ctx, jobOpts, cp, units, func(ctx context.Context, u jobUnit, p *Progress) error {
+		dst := u.name
+		if !*replace {
+			dst = filepath.Join(*outDir, fileSymbol(u.name), filepath.Base(u.name))
+		} else if !hasFooter(u.name) {
+			log.Printf("Skipping %s: no index footer (still being written?)", u.name)
+			p.Add(u.size)
+			return nil
+		}
+		res, err := compactFile(ctx, u.name, dst, opts, p)
+		if err != nil {
+			return err
+		}
+		log.Printf("%s: %d record(s), %s -> %s (%.1f%%), %d checkpoint(s)", u.name, res.records,
+			formatBytes(u.size), formatBytes(res.size), 100*float64(res.size)/float64(max(u.size, 1)), res.checkpoints)
+		return nil
+	})
+}
+
+func hasFooter(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	idx, _, err := orderbook.ReadIndex(f, fi.Size())
+	return err == nil && idx != nil
+}
+
+type compactResult struct {
+	records, checkpoints int
+	size                 int64
+}
+
+// src 를 dst 로 다시 쓴다. 임시 파일에 쓰고 원본과 대조한 뒤 옮기므로 중간에 실패해도 dst 는 그대로다.
+func compactFile(ctx context.Context, src, dst string, opts compactOptions, p *Progress) (*compactResult, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return nil, err
+	}
+	tmp := dst + ".compact.tmp"
+	os.Remove(tmp)
+
+	res, err := writeCompacted(ctx, orderbook.NewReader(p.Reader(in)), tmp, opts)
+	if err == nil {
+		err = compareCompacted(src, tmp)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	fi, err := os.Stat(tmp)
+	if err != nil {
+		return nil, err
+	}
+	res.size = fi.Size()
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	// 새 파일에는 footer 가 있다
+	return res, orderbook.RemoveSidecar(dst)
+}
+
+func writeCompacted(ctx context.Context, r *orderbook.Reader, path string, opts compactOptions) (*compactResult, error) {
+	var (
+		res     compactResult
+		fw      *orderbook.FileWriter
+		header  *orderbook.FileHeader
+		book    *orderbook.Book
+		seeded  bool  // book 이 REST 스냅샷에서 시작해 증분이 이어지고 있다
+		lastCut int64 // 마지막 체크포인트 시각
+	)
+	closeWriter := func() error {
+		if fw == nil {
+			return nil
+		}
+		err := fw.Close()
+		fw = nil
+		return err
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			closeWriter()
+			return nil, err
+		}
+		ev, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err == io.ErrUnexpectedEOF {
+			continue // 잘린 레코드. 파일 끝이면 다음에 io.EOF 가 온다
+		}
+		if err != nil {
+			closeWriter()
+			return nil, fmt.Errorf("unreadable record (run verify): %w", err)
+		}
+		// 세션마다 헤더를 옮겨 새 세션으로 이어 쓴다 (순번 확인이 세션 단위다)
+		if fw == nil || r.Header != header {
+			if err := closeWriter(); err != nil {
+				return nil, err
+			}
+			header = r.Header
+			h := &orderbook.FileHeader{CreatedAt: time.Now().UTC().UnixMilli(), Symbol: ev.Symbol, Exchange: ev.Exchange, MarketType: ev.MarketType}
+			if header != nil {
+				h = proto.Clone(header).(*orderbook.FileHeader)
+			}
+			switch opts.compression {
+			case "none":
+				h.Compression = orderbook.Compression_COMPRESSION_NONE
+			case "zstd":
+				h.Compression = orderbook.Compression_COMPRESSION_ZSTD
+			}
+			if fw, err = orderbook.OpenFileWriter(path, h); err != nil {
+				return nil, err
+			}
+			fw.SetDeltaInterval(opts.checkpoint)
+			book, seeded = orderbook.NewBook(), false
+		}
+
+		if opts.diffs {
+			if ev.StreamType == orderbook.CheckpointStreamType {
+				continue // 예전에 끼워 넣은 체크포인트는 새로 만든다
+			}
+			switch {
+			case ev.GetSnapshot() != nil && orderbook.IsFullBookSnapshot(ev.StreamType):
+				book.LoadSnapshot(ev.GetSnapshot())
+				seeded, lastCut = true, ev.EventTime
+			case ev.GetDepthDiff() != nil && seeded:
+				if _, err := book.ApplyDiff(ev.GetDepthDiff()); err != nil {
+					seeded = false // 다음 REST 스냅샷까지 체크포인트를 만들지 않는다
+				}
+			}
+		}
+		// 세션 헤더와 같은 메타데이터는 Reader 가 헤더에서 채우므로 쓰지 않는다
+		if h := r.Header; h != nil && ev.Symbol == h.Symbol && ev.Exchange == h.Exchange && ev.MarketType == h.MarketType {
+			ev.Symbol, ev.Exchange, ev.MarketType = "", "", ""
+		}
+		if err := fw.Write(ev); err != nil {
+			closeWriter()
+			return nil, err
+		}
+		res.records++
+
+		if opts.diffs && seeded && ev.GetDepthDiff() != nil && ev.EventTime-lastCut >= opts.checkpoint.Milliseconds() {
+			s := book.Snapshot()
+			s.EventTime = ev.EventTime
+			cut := &orderbook.Event{
+				EventTime:  ev.EventTime,
+				Symbol:     ev.Symbol,
+				Exchange:   ev.Exchange,
+				MarketType: ev.MarketType,
+				StreamType: orderbook.CheckpointStreamType,
+				Payload:    &orderbook.Event_Snapshot{Snapshot: s},
+			}
+			if err := fw.Write(cut); err != nil {
+				closeWriter()
+				return nil, err
+			}
+			res.checkpoints++
+			lastCut = ev.EventTime
+		}
+	}
+	if fw == nil {
+		// 레코드가 없는 파일도 빈 사본을 남긴다
+		return &res, os.WriteFile(path, nil, 0644)
+	}
+	return &res, closeWriter()
+}
+
+var errCompactMismatch = errors.New("compacted copy differs from the original")
+
+// 사본을 다시 읽어 원본과 레코드(끼워 넣은 체크포인트 제외)가 모두 같은지 확인한다
+func compareCompacted(src, dst string) error {
+	a, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+	b, err := os.Open(dst)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+	ra, rb := orderbook.NewReader(a), orderbook.NewReader(b)
+	next := func(r *orderbook.Reader) (*orderbook.Event, error) {
+		for {
+			ev, err := r.Next()
+			if err == io.ErrUnexpectedEOF {
+				continue
+			}
+			if err != nil || ev.StreamType != orderbook.CheckpointStreamType {
+				return ev, err
+			}
+		}
+	}
+	for n := 0; ; n++ {
+		ea, erra := next(ra)
+		eb, errb := next(rb)
+		if erra == io.EOF && errb == io.EOF {
+			return nil
+		}
+		if erra != nil || errb != nil {
+			return fmt.Errorf("%w: record %d: %v / %v", errCompactMismatch, n, erra, errb)
+		}
+		if !proto.Equal(ea, eb) {
+			return fmt.Errorf("%w: record %d at %s", errCompactMismatch, n, formatMillis(ea.EventTime))
+		}
+	}
+}
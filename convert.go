@@ -0,0 +1,295 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+	"orderbook/orderbook"
+)
+
+// .bin 파일을 Parquet 나 Arrow IPC(Feather v2) 로 바꿔 pandas/Polars/Spark/DuckDB 에서
+// protobuf 리더 없이 바로 읽게 한다. 스냅샷 이벤트만 옮기며, 다른 스트림(depth diff, trade 등)은 건너뛴다.
+//
+//	-format parquet -layout snapshot   스냅샷 한 건이 한 행. bids/asks 는 {price, quantity} 의 list
+//	-format parquet -layout level      호가 단계 하나가 한 행 (side, depth 열). 그대로 group by/pivot 하기 좋다
+//	-format arrow                      호가 단계 하나가 한 행 (arrowexport.go)
+//	-format binance-rest               스냅샷마다 바이낸스 REST depth 응답 JSON 파일 하나 (restexport.go)
+//
+// 출력은 입력 옆(또는 -out 디렉터리)의 <이름>.parquet / <이름>.arrow 이고, 심볼 메타데이터가 있으면
+// 파일(스키마) key-value 메타데이터 orderbook.symbol_info 에 JSON 으로 넣는다.
+//
+// -hive 면 Parquet 를 -out 아래 exchange=<거래소>/symbol=<심볼>/date=<날짜>/<이름>.parquet 로 나눠 쓴다 (hive 파티션).
+// DuckDB, Spark, Polars 가 디렉터리 이름을 열로 읽고 WHERE symbol = ... AND date = ... 로 파일을 건너뛴다.
+// 질의 SQL 은 orderbook duckdb <out> 이 만들어 준다 (duckdb.go).
+
+const symbolInfoMetadataKey = "orderbook.symbol_info"
+
+type parquetLevel struct {
+	Price        float64 `parquet:"price"`
+	Quantity     float64 `parquet:"quantity"`
+	PriceText    string  `parquet:"price_text,optional"` // 원래 문자열. -keep-decimals 로 기록하지 않았으면 null
+	QuantityText string  `parquet:"quantity_text,optional"`
+}
+
+type parquetSnapshot struct {
+	EventTime    int64          `parquet:"event_time,timestamp(millisecond)"`
+	Sequence     uint64         `parquet:"sequence"`
+	Symbol       string         `parquet:"symbol,dict"`
+	ExchangeTime int64          `parquet:"exchange_time"`
+	LastUpdateID int64          `parquet:"last_update_id"`
+	Bids         []parquetLevel `parquet:"bids,list"`
+	Asks         []parquetLevel `parquet:"asks,list"`
+}
+
+type parquetLevelRow struct {
+	EventTime    int64   `parquet:"event_time,timestamp(millisecond)"`
+	Sequence     uint64  `parquet:"sequence"`
+	Symbol       string  `parquet:"symbol,dict"`
+	LastUpdateID int64   `parquet:"last_update_id"`
+	Side         string  `parquet:"side,dict"` // bid, ask
+	Depth        int32   `parquet:"depth"`     // 0 이 최우선 호가
+	Price        float64 `parquet:"price"`
+	Quantity     float64 `parquet:"quantity"`
+	PriceText    string  `parquet:"price_text,optional"`
+	QuantityText string  `parquet:"quantity_text,optional"`
+}
+
+func runConvert(args []string) error {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	format := fs.String("format", "parquet", "output format: parquet, arrow (Arrow IPC file / Feather v2) or binance-rest (directory of REST depth JSON responses)")
+	layout := fs.String("layout", "snapshot", "parquet row layout: snapshot (nested bid/ask lists) or level (one row per price level); arrow is always per level")
+	outDir := fs.String("out", "", "write output files into this directory (default: next to each input)")
+	dataDir := fs.String("data", defaultDataDir, "data directory holding "+symbolMetadataFile)
+	restEvery := fs.Duration("rest-every", 0, "binance-rest: minimum time between written snapshots (e.g. 1s); 0 writes every snapshot")
+	restLimit := fs.Int("rest-limit", 0, "binance-rest: price levels per side (like the REST limit parameter); 0 keeps all recorded levels")
+	hive := fs.Bool("hive", false, "parquet: write into exchange=/symbol=/date= partition directories under -out (query with orderbook duckdb)")
+	var jobOpts jobOptions
+	jobOpts.register(fs, "")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: orderbook convert [flags] <file.bin>...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("no input files")
+	}
+	ext := *format
+	switch *format {
+	case "parquet", "arrow":
+	case "binance-rest":
+		ext = "rest"
+	default:
+		return fmt.Errorf("unknown format %q (use parquet, arrow or binance-rest)", *format)
+	}
+	if *layout != "snapshot" && *layout != "level" {
+		return fmt.Errorf("unknown layout %q (use snapshot or level)", *layout)
+	}
+	if *hive && (*format != "parquet" || *outDir == "") {
+		return fmt.Errorf("-hive needs -format parquet and -out")
+	}
+
+	var units []jobUnit
+	for _, path := range fs.Args() {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		units = append(units, jobUnit{name: path, size: fi.Size()})
+	}
+	cp, err := openCheckpoint(jobOpts.checkpoint, "convert", fmt.Sprintf("%s %s %s %s %d %v", *format, *layout, *outDir, *restEvery, *restLimit, *hive), jobOpts.resume)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	symbols := loadSymbolMetadata(*dataDir)
+	return runJob(ctx, jobOpts, cp, units, func(ctx context.Context, u jobUnit, p *Progress) error {
+		dir := *outDir
+		if dir == "" {
+			dir = filepath.Dir(u.name)
+		}
+		out := filepath.Join(dir, strings.TrimSuffix(filepath.Base(u.name), ".bin")+"."+ext)
+		symbol := fileSymbol(u.name)
+		if *hive {
+			partition, err := hivePartition(u.name)
+			if err != nil {
+				return err
+			}
+			if partition == "" {
+				log.Printf("%s: no records, skipping", u.name)
+				return nil
+			}
+			out = filepath.Join(dir, partition, filepath.Base(out))
+		}
+		var symbolInfo string
+		if si := symbols.Get(symbol); si != nil {
+			b, _ := json.Marshal(si)
+			symbolInfo = string(b)
+		}
+
+		if *format == "binance-rest" {
+			n, err := writeBinanceREST(ctx, u.name, out, p, restEvery.Milliseconds(), *restLimit)
+			if err != nil {
+				return err
+			}
+			log.Printf("%s: %d depth responses -> %s", u.name, n, out)
+			return nil
+		}
+		if *format == "arrow" {
+			n, err := writeArrow(ctx, u.name, out, p, symbol, symbolInfo)
+			if err != nil {
+				return err
+			}
+			log.Printf("%s: %d rows -> %s", u.name, n, out)
+			return nil
+		}
+
+		opts := []parquet.WriterOption{
+			parquet.Compression(&parquet.Zstd),
+			parquet.MaxRowsPerRowGroup(1 << 20),
+		}
+		if symbolInfo != "" {
+			opts = append(opts, parquet.KeyValueMetadata(symbolInfoMetadataKey, symbolInfo))
+		}
+
+		var n int
+		var err error
+		if *layout == "level" {
+			n, err = writeParquet(ctx, u.name, out, p, opts, func(ev *orderbook.Event, s *orderbook.Snapshot, rows []parquetLevelRow) []parquetLevelRow {
+				for _, side := range []struct {
+					name   string
+					levels []*orderbook.Level
+				}{{"bid", s.Bids}, {"ask", s.Asks}} {
+					for i, l := range side.levels {
+						rows = append(rows, parquetLevelRow{
+							EventTime:    ev.EventTime,
+							Sequence:     ev.Sequence,
+							Symbol:       eventSymbol(ev, s, symbol),
+							LastUpdateID: s.LastUpdateId,
+							Side:         side.name,
+							Depth:        int32(i),
+							Price:        l.Price,
+							Quantity:     l.Quantity,
+							PriceText:    l.PriceText,
+							QuantityText: l.QuantityText,
+						})
+					}
+				}
+				return rows
+			})
+		} else {
+			n, err = writeParquet(ctx, u.name, out, p, opts, func(ev *orderbook.Event, s *orderbook.Snapshot, rows []parquetSnapshot) []parquetSnapshot {
+				return append(rows, parquetSnapshot{
+					EventTime:    ev.EventTime,
+					Sequence:     ev.Sequence,
+					Symbol:       eventSymbol(ev, s, symbol),
+					ExchangeTime: ev.ExchangeTime,
+					LastUpdateID: s.LastUpdateId,
+					Bids:         parquetLevels(s.Bids),
+					Asks:         parquetLevels(s.Asks),
+				})
+			})
+		}
+		if err != nil {
+			return err
+		}
+		log.Printf("%s: %d rows -> %s", u.name, n, out)
+		return nil
+	})
+}
+
+// in 의 스냅샷을 rows 로 바꿔 out 에 쓴다. .tmp 에 쓴 뒤 옮기므로 중간에 멈춰도 반쪽 파일이 남지 않는다.
+func writeParquet[T any](ctx context.Context, in, out string, p *Progress, opts []parquet.WriterOption, rows func(ev *orderbook.Event, s *orderbook.Snapshot, buf []T) []T) (int, error) {
+	if err := os.MkdirAll(filepath.Dir(out), os.ModePerm); err != nil {
+		return 0, err
+	}
+	tmp := out + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp)
+	defer f.Close()
+
+	w := parquet.NewGenericWriter[T](f, opts...)
+	var n int
+	var buf []T
+	err = scanFile(ctx, in, math.MinInt64, math.MaxInt64, p, func(r *orderbook.Reader, ev *orderbook.Event) error {
+		s := ev.GetSnapshot()
+		if s == nil {
+			return nil
+		}
+		buf = rows(ev, s, buf[:0])
+		n += len(buf)
+		_, err := w.Write(buf)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := w.Close(); err != nil {
+		return 0, err
+	}
+	if err := f.Close(); err != nil {
+		return 0, err
+	}
+	return n, os.Rename(tmp, out)
+}
+
+func parquetLevels(levels []*orderbook.Level) []parquetLevel {
+	out := make([]parquetLevel, len(levels))
+	for i, l := range levels {
+		out[i] = parquetLevel{Price: l.Price, Quantity: l.Quantity, PriceText: l.PriceText, QuantityText: l.QuantityText}
+	}
+	return out
+}
+
+// 구버전 레코드에는 이벤트 심볼이 없어 스냅샷, 파일 이름 순으로 찾는다
+func eventSymbol(ev *orderbook.Event, s *orderbook.Snapshot, fallback string) string {
+	if ev.Symbol != "" {
+		return ev.Symbol
+	}
+	if s.Symbol != "" {
+		return s.Symbol
+	}
+	return strings.ToUpper(fallback)
+}
+
+// 파일의 hive 파티션 경로 exchange=<거래소>/symbol=<심볼>/date=<날짜>. 거래소는 첫 세션 헤더(없으면 첫 레코드)에서,
+// 날짜는 파일 이름에서 (없으면 첫 레코드의 UTC 날짜) 얻는다. 레코드가 없으면 "".
+func hivePartition(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	ev, err := orderbook.NewReader(f).Next()
+	if err == io.EOF {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	exchange := cmp.Or(ev.Exchange, exchangeName)
+	symbol := cmp.Or(ev.Symbol, strings.ToUpper(fileSymbol(path)))
+	date := cmp.Or(fileDate(filepath.Base(path)), utcDate(ev.EventTime))
+	return filepath.Join("exchange="+exchange, "symbol="+symbol, "date="+date), nil
+}
+
+// <symbol>_<date>....bin 에서 심볼 (소문자)
+func fileSymbol(path string) string {
+	name, _, _ := strings.Cut(filepath.Base(path), "_")
+	return strings.ToLower(name)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// serve-api 의 웹 대시보드 (GET /). 심볼마다 깊이 차트를 그리고, 라이브로 따라가거나 슬라이더로 기록을 되돌려 본다.
+// 페이지는 질의 API 만 쓴다: /v1/symbols 로 심볼과 기록 구간을, /v1/book 으로 그 시점의 책을, /v1/gaps 로 빈 구간을 받는다.
+// 책마다 스냅샷 나이, 마지막 증분까지의 지연, 적용한 증분 수, 순번 끊김을 함께 보여 데이터 품질을 눈으로 확인한다.
+//
+// 페이지 자체에는 데이터가 없으므로 -token 이 있어도 인증 없이 내보내고, 페이지가 토큰을 물어 API 요청에 싣는다.
+
+//go:embed dashboard.html
+var dashboardHTML []byte
+
+func serveDashboard(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(dashboardHTML)
+}
+
+type apiSymbol struct {
+	Symbol     string      `json:"symbol"`
+	Exchanges  []string    `json:"exchanges,omitempty"`
+	FirstEvent int64       `json:"firstEvent"`
+	LastEvent  int64       `json:"lastEvent"`
+	SymbolInfo *SymbolInfo `json:"symbolInfo,omitempty"`
+}
+
+// GET /v1/symbols : 데이터 디렉터리의 심볼과 기록 구간. manifest 를 쓰고, 아직 manifest 에 없는 파일(수집 중인 파일 등)은
+// 파일 이름의 날짜와 수정 시각으로 구간을 넓힌다. -store 로 연합 질의 중이면 -data 에 있는 것만 보인다.
+func (s *apiServer) handleSymbols(w http.ResponseWriter, r *http.Request) {
+	m, err := loadManifest(s.dataDir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	entries, err := listDataFiles(s.dataDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	bySymbol := make(map[string]*apiSymbol)
+	get := func(symbol string) *apiSymbol {
+		if a, ok := bySymbol[symbol]; ok {
+			return a
+		}
+		a := &apiSymbol{Symbol: symbol}
+		bySymbol[symbol] = a
+		return a
+	}
+	known := make(map[string]bool, len(m.Files))
+	for _, f := range m.Files {
+		known[f.Path] = true
+	}
+	for _, ms := range m.Symbols {
+		a := get(ms.Symbol)
+		a.Exchanges, a.FirstEvent, a.LastEvent = ms.Exchanges, ms.FirstEvent, ms.LastEvent
+	}
+	for _, e := range entries {
+		if known[e.Path] || e.Date == "" {
+			continue
+		}
+		day, err := time.Parse(dateLayout, e.Date)
+		if err != nil {
+			continue
+		}
+		a := get(e.Symbol)
+		if first := day.UnixMilli(); a.FirstEvent == 0 || first < a.FirstEvent {
+			a.FirstEvent = first
+		}
+		a.LastEvent = max(a.LastEvent, e.ModTime.UnixMilli())
+	}
+
+	out := make([]*apiSymbol, 0, len(bySymbol))
+	for _, a := range bySymbol {
+		a.SymbolInfo = s.symbols.Get(a.Symbol)
+		out = append(out, a)
+	}
+	slices.SortFunc(out, func(a, b *apiSymbol) int { return strings.Compare(a.Symbol, b.Symbol) })
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Symbols []*apiSymbol `json:"symbols"`
+	}{out})
+}
+
+// GET /v1/gaps/{symbol}?from=&to=[&minGap=5s] : 구간 안에서 스냅샷이 minGap 보다 오래 없었던 빈 구간 (orderbook gaps 와 같다)
+func (s *apiServer) handleGaps(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	symbol := strings.ToLower(r.PathValue("symbol"))
+	from, to, err := s.parseSpan(qs)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	minGap := 5 * time.Second
+	if v := qs.Get("minGap"); v != "" {
+		if minGap, err = time.ParseDuration(v); err != nil || minGap <= 0 {
+			http.Error(w, fmt.Sprintf("invalid minGap %q", v), http.StatusBadRequest)
+			return
+		}
+	}
+
+	files, err := s.files(r.Context(), symbol, from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// 아직 오지 않은 시간은 빈 구간이 아니다
+	gaps, err := scanGaps(r.Context(), files, symbol, from, min(to, time.Now().UnixMilli()), minGap.Milliseconds(), nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(gaps)
+}
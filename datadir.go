@@ -0,0 +1,276 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 데이터 디렉터리 구조: <dataDir>/<symbol>/<symbol>_<YYYY-MM-DD>.bin (UTC 기준 일 단위).
+// 시간 단위나 크기로 회전하면 같은 접두어 뒤에 시간과 part 가 붙는다 (rotation.go).
+// 여러 수집기가 한 디렉터리(NFS 등)를 같이 쓰면 각자 -instance 를 주어 이름에 @<instance> 가 붙는다.
+// 점(.)으로 시작하는 디렉터리는 수집기 내부용(.instances 등)이라 데이터로 보지 않는다.
+
+const (
+	defaultDataDir = "data"
+	dateLayout     = "2006-01-02"
+	dayMillis      = int64(24 * time.Hour / time.Millisecond)
+)
+
+// UTC ms 가 속한 날짜 문자열
+func utcDate(ms int64) string {
+	return time.UnixMilli(ms).UTC().Format(dateLayout)
+}
+
+// [from, to) 구간에 걸치는 UTC 날짜들
+func datesInRange(from, to int64) []string {
+	var dates []string
+	for day := from - from%dayMillis; day < to; day += dayMillis {
+		dates = append(dates, utcDate(day))
+	}
+	return dates
+}
+
+type dataFile struct {
+	path string
+	date string
+	size int64
+}
+
+// [from, to) 구간에 걸치는 날짜의 파일들 (시간순). 시간 단위나 크기로 회전한 파일은
+// 하루에 여러 개일 수 있으며 <symbol>_<date> 로 시작하는 이름의 순서가 곧 시간 순서다 (rotation.go).
+// 여러 인스턴스가 같은 날을 기록했으면 모두 포함되므로, 겹치는 구간은 카탈로그 통합 보기로 확인한다.
+func dataFilesInRange(dataDir, symbol string, from, to int64) []dataFile {
+	var files []dataFile
+	for _, date := range datesInRange(from, to) {
+		files = append(files, dayFiles(dataDir, symbol, date)...)
+	}
+	return files
+}
+
+// 심볼의 하루치 파일 (이름순 = 시간순)
+func dayFiles(dataDir, symbol, date string) []dataFile {
+	symbol = strings.ToLower(symbol)
+	matches, _ := filepath.Glob(filepath.Join(dataDir, symbol, symbol+"_"+date+"*"))
+	sort.Strings(matches)
+	var files []dataFile
+	for _, path := range matches {
+		if strings.HasSuffix(path, ".idx") || strings.HasSuffix(path, ".tmp") {
+			continue
+		}
+		fi, err := os.Stat(path)
+		if err != nil || !fi.Mode().IsRegular() {
+			continue
+		}
+		files = append(files, dataFile{path: path, date: date, size: fi.Size()})
+	}
+	return files
+}
+
+// RFC3339 문자열 또는 unix ms 숫자를 UTC ms 로 변환. now 는 지금 시각.
+func parseTime(s string) (int64, error) {
+	if s == "now" {
+		return time.Now().UnixMilli(), nil
+	}
+	if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return ms, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UnixMilli(), nil
+	}
+	// 오프셋이 없으면 -tz 시간대 (기본 UTC)
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02T15:04", dateLayout} {
+		if t, err := time.ParseInLocation(layout, s, displayLoc); err == nil {
+			return t.UnixMilli(), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid time %q: use RFC3339, YYYY-MM-DD[THH:MM[:SS]], unix milliseconds or now", s)
+}
+
+// time.ParseDuration 에 일 단위(예: 30d)를 더한 것
+func parseDuration(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// 64MB, 512KB, 1GB 같은 크기 (1024 단위, formatBytes 의 반대). 단위가 없으면 바이트.
+func parseBytes(s string) (int64, error) {
+	num := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+	mult := int64(1)
+	if i := strings.IndexAny(num, "KMGT"); i >= 0 && i == len(num)-1 {
+		mult = 1 << (10 * (strings.IndexByte("KMGT", num[i]) + 1))
+		num = num[:i]
+	}
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * float64(mult)), nil
+}
+
+// 데이터 디렉터리 안의 파일 목록 항목. Path 는 dataDir 기준 상대 경로(/ 구분).
+type catalogEntry struct {
+	Symbol   string    `json:"symbol"`
+	Date     string    `json:"date,omitempty"`
+	Instance string    `json:"instance,omitempty"` // 파일을 쓴 수집기 인스턴스. 단일 수집기면 비어 있다
+	Session  string    `json:"session,omitempty"`  // 같은 구간에 재시작해 따로 연 세션 파일의 표시 (collect -on-restart session)
+	Path     string    `json:"path"`
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"modTime"`
+
+	// 요청한 날짜 기준(dayConvention)으로 이 파일이 걸치는 날짜들. 기준을 지정하지 않으면 비어 있다.
+	Days []string `json:"days,omitempty"`
+}
+
+// <dataDir>/<symbol>/ 아래의 모든 일반 파일을 심볼, 경로 순으로 나열한다.
+func listDataFiles(dataDir string) ([]catalogEntry, error) {
+	var entries []catalogEntry
+	err := filepath.WalkDir(dataDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && path != dataDir && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if !d.Type().IsRegular() || strings.HasSuffix(path, ".idx") || strings.HasSuffix(path, ".tmp") {
+			return nil // 사이드카 인덱스와 쓰는 중인 임시 파일은 데이터 파일이 아니다
+		}
+		rel, err := filepath.Rel(dataDir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		symbol, name, ok := strings.Cut(rel, "/")
+		if !ok {
+			return nil // 최상위 파일 (manifest 등)은 심볼 데이터가 아니다
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		entries = append(entries, catalogEntry{
+			Symbol:   symbol,
+			Date:     fileDate(name),
+			Instance: fileInstance(name),
+			Session:  fileSession(name),
+			Path:     rel,
+			Size:     fi.Size(),
+			ModTime:  fi.ModTime().UTC(),
+		})
+		return nil
+	})
+	return entries, err
+}
+
+// 파일이 덮는 UTC 구간 [from, to) (ms). 시간 단위로 회전한 파일(<date>THH)은 한 시간, 나머지는 하루.
+func fileSpan(name string) (from, to int64, ok bool) {
+	date := fileDate(name)
+	if date == "" {
+		return 0, 0, false
+	}
+	day, _ := time.Parse(dateLayout, date)
+	_, rest, _ := strings.Cut(name, "_")
+	if rest = rest[len(dateLayout):]; len(rest) >= 3 && rest[0] == 'T' {
+		if h, err := strconv.Atoi(rest[1:3]); err == nil && h < 24 {
+			start := day.Add(time.Duration(h) * time.Hour)
+			return start.UnixMilli(), start.Add(time.Hour).UnixMilli(), true
+		}
+	}
+	return day.UnixMilli(), day.UnixMilli() + dayMillis, true
+}
+
+// 각 항목에 c 기준의 날짜를 채운다
+func annotateDays(entries []catalogEntry, c *dayConvention) {
+	for i := range entries {
+		if from, to, ok := fileSpan(path.Base(entries[i].Path)); ok {
+			entries[i].Days = c.daysCovering(from, to)
+		}
+	}
+}
+
+// <symbol>_<YYYY-MM-DD>... 형식의 파일 이름에서 날짜를 꺼낸다
+func fileDate(name string) string {
+	_, rest, ok := strings.Cut(name, "_")
+	if !ok || len(rest) < len(dateLayout) {
+		return ""
+	}
+	if _, err := time.Parse(dateLayout, rest[:len(dateLayout)]); err != nil {
+		return ""
+	}
+	return rest[:len(dateLayout)]
+}
+
+// <symbol>_<date>[THH]@<instance>... 형식의 파일 이름에서 인스턴스 id 를 꺼낸다. 없으면 빈 문자열.
+func fileInstance(name string) string {
+	_, rest, ok := strings.Cut(name, "@")
+	if !ok {
+		return ""
+	}
+	if i := strings.IndexAny(rest, "."+sessionMark); i >= 0 {
+		rest = rest[:i]
+	}
+	return rest
+}
+
+// <name>~<HHMMSS>[.ext] 형식의 세션 파일 이름에서 세션 표시를 꺼낸다. 없으면 빈 문자열.
+func fileSession(name string) string {
+	_, rest, ok := strings.Cut(name, sessionMark)
+	if !ok {
+		return ""
+	}
+	session, _, _ := strings.Cut(rest, ".")
+	return session
+}
+
+// 카탈로그의 통합 보기 항목: 심볼과 날짜마다 어느 인스턴스가 어떤 파일을 썼는지.
+// 회전 part 와 재시작 세션 파일은 Files 에 읽는 순서(이름순)대로 이어져 한 날이 된다.
+type consolidatedDay struct {
+	Symbol    string         `json:"symbol"`
+	Date      string         `json:"date"`
+	Instances []string       `json:"instances"`          // 인스턴스 없이 쓴 파일은 ""
+	Sessions  []string       `json:"sessions,omitempty"` // 재시작으로 따로 연 세션 파일의 표시. 처음 세션은 빠진다
+	Files     []catalogEntry `json:"files"`
+	Size      int64          `json:"size"`
+}
+
+// 항목을 심볼, 날짜별로 묶는다. 여러 인스턴스가 같은 날을 기록했으면 Instances 가 둘 이상이고,
+// 사용자는 그중 하나를 고르거나 합쳐 읽을 수 있다.
+func consolidate(entries []catalogEntry) []consolidatedDay {
+	var days []consolidatedDay
+	index := make(map[[2]string]int)
+	for _, e := range entries {
+		key := [2]string{e.Symbol, e.Date}
+		i, ok := index[key]
+		if !ok {
+			i = len(days)
+			index[key] = i
+			days = append(days, consolidatedDay{Symbol: e.Symbol, Date: e.Date})
+		}
+		d := &days[i]
+		if !slices.Contains(d.Instances, e.Instance) {
+			d.Instances = append(d.Instances, e.Instance)
+		}
+		if e.Session != "" && !slices.Contains(d.Sessions, e.Session) {
+			d.Sessions = append(d.Sessions, e.Session)
+		}
+		d.Files = append(d.Files, e)
+		d.Size += e.Size
+	}
+	for i := range days {
+		sort.Strings(days[i].Instances)
+		sort.Strings(days[i].Sessions)
+	}
+	return days
+}
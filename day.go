@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 파일은 UTC 날짜로 나뉘어 있지만, 팀마다 "하루"의 기준이 다르다 (KST 자정, 뉴욕 17:00 마감 등).
+// dayConvention 은 그런 기준의 하루를 UTC 구간으로 바꿔, 파일 이름을 바꾸지 않고도 그 기준으로
+// 질의하고 카탈로그에서 파일이 어느 날에 속하는지 보여 줄 수 있게 한다.
+//
+//	utc                   UTC 자정 기준 (기본, 파일 이름과 같다)
+//	kst                   Asia/Seoul 자정 기준
+//	<IANA 시간대>[@HH:MM]  그 시간대의 HH:MM 부터 다음 날 HH:MM 까지 (예: America/New_York@17:00)
+
+type dayConvention struct {
+	Name     string
+	loc      *time.Location
+	rollover time.Duration // 현지 자정부터 하루가 시작되는 시각까지
+}
+
+var utcDay = &dayConvention{Name: "utc", loc: time.UTC}
+
+func parseDayConvention(s string) (*dayConvention, error) {
+	if strings.EqualFold(s, "utc") || s == "" {
+		return utcDay, nil
+	}
+	zone, at, hasAt := strings.Cut(s, "@")
+	loc, err := parseZone(zone)
+	if err != nil {
+		return nil, fmt.Errorf("day convention %q: %w", s, err)
+	}
+	c := &dayConvention{Name: s, loc: loc}
+	if hasAt {
+		t, err := time.Parse("15:04", at)
+		if err != nil {
+			return nil, fmt.Errorf("day convention %q: rollover must be HH:MM", s)
+		}
+		c.rollover = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	}
+	return c, nil
+}
+
+// 이 기준의 날짜 YYYY-MM-DD 가 덮는 UTC 구간 [from, to) (ms)
+func (c *dayConvention) bounds(date string) (from, to int64, err error) {
+	d, err := time.ParseInLocation(dateLayout, date, c.loc)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid day %q: use YYYY-MM-DD", date)
+	}
+	start := d.Add(c.rollover)
+	end := d.AddDate(0, 0, 1).Add(c.rollover) // 서머타임이 바뀌는 날은 23/25 시간이다
+	return start.UnixMilli(), end.UnixMilli(), nil
+}
+
+// UTC ms 가 이 기준으로 속한 날짜
+func (c *dayConvention) dayOf(ms int64) string {
+	return time.UnixMilli(ms).In(c.loc).Add(-c.rollover).Format(dateLayout)
+}
+
+// [from, to) 구간이 걸치는 이 기준의 날짜들
+func (c *dayConvention) daysCovering(from, to int64) []string {
+	var days []string
+	for day := c.dayOf(from); ; {
+		days = append(days, day)
+		_, end, err := c.bounds(day)
+		if err != nil || end >= to {
+			return days
+		}
+		day = c.dayOf(end)
+	}
+}
+
+// 출력 시각의 시간대 (-tz). 파일 이름과 기록은 항상 UTC 이고, 사람이 읽는 시각 표시와
+// 오프셋 없이 준 -from/-to/-at, -day-convention 을 주지 않은 -day 만 이 시간대로 본다.
+// CSV 의 event_time 등 기계가 읽는 unix ms 는 그대로다.
+var displayLoc = time.UTC
+
+// utc, kst 또는 IANA 시간대 이름
+func parseZone(s string) (*time.Location, error) {
+	switch strings.ToLower(s) {
+	case "utc":
+		return time.UTC, nil
+	case "kst":
+		s = "Asia/Seoul"
+	}
+	return time.LoadLocation(s)
+}
+
+func registerTZ(fs *flag.FlagSet) {
+	fs.Func("tz", "time zone for printed times and for -from/-to/-at without an offset: utc, kst or <IANA zone> (default utc)", func(v string) error {
+		loc, err := parseZone(v)
+		if err != nil {
+			return err
+		}
+		displayLoc = loc
+		return nil
+	})
+}
+
+// 출력용 시각 (-tz 시간대, 밀리초까지)
+func formatMillis(ms int64) string {
+	return time.UnixMilli(ms).In(displayLoc).Format("2006-01-02T15:04:05.000Z07:00")
+}
+
+// 여러 명령이 같이 쓰는 구간 플래그. -from/-to 대신 -day 로 하루를 지정할 수 있다.
+type rangeFlags struct {
+	from, to, day, convention string
+}
+
+func (f *rangeFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.from, "from", "", "range start (RFC3339, YYYY-MM-DD or unix ms)")
+	fs.StringVar(&f.to, "to", "", "range end, exclusive")
+	fs.StringVar(&f.day, "day", "", "select one whole day (YYYY-MM-DD) instead of -from/-to")
+	fs.StringVar(&f.convention, "day-convention", "", "what a day means for -day: utc, kst, or <IANA zone>[@HH:MM] (default the -tz zone)")
+	registerTZ(fs)
+}
+
+// -day-convention 을 주지 않았으면 -tz 시간대의 자정 기준
+func (f *rangeFlags) dayConvention() string {
+	if f.convention == "" {
+		return displayLoc.String()
+	}
+	return f.convention
+}
+
+// 플래그를 읽은 뒤 UTC ms 구간으로 바꾼다
+func (f *rangeFlags) resolve() (from, to int64, err error) {
+	if f.day != "" {
+		if f.from != "" || f.to != "" {
+			return 0, 0, errors.New("use either -day or -from/-to")
+		}
+		c, err := parseDayConvention(f.dayConvention())
+		if err != nil {
+			return 0, 0, err
+		}
+		return c.bounds(f.day)
+	}
+	if f.from == "" || f.to == "" {
+		return 0, 0, errors.New("-from and -to (or -day) are required")
+	}
+	if from, err = parseTime(f.from); err != nil {
+		return 0, 0, err
+	}
+	if to, err = parseTime(f.to); err != nil {
+		return 0, 0, err
+	}
+	return from, to, nil
+}
+
+// 에러 메시지용 구간 설명
+func (f *rangeFlags) String() string {
+	if f.day != "" {
+		return f.day + " (" + f.dayConvention() + ")"
+	}
+	return f.from + " .. " + f.to
+}
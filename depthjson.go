@@ -0,0 +1,351 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"orderbook/orderbook"
+)
+
+// 바이낸스 depth 메시지(partial depth 스냅샷, diff depth 증분)를 encoding/json 없이 바로 protobuf 구조체로 푼다.
+// 결합 스트림 봉투({"stream":..,"data":..})도 data 를 복사하지 않고 잘라 낸다 (combinedDecoder).
+// 파싱하면서는 할당하지 않고 결과 구조체와 호가 블록만 할당한다. 가격/수량은 스키마가 double 이므로
+// 문자열을 정수로 읽어 바로 float64 로 바꾼다 (parseDecimal).
+//
+// 이스케이프된 문자열, 숫자로 온 가격처럼 예상과 다른 모양이면 errDepthJSON 을 돌려주고,
+// 부르는 쪽은 encoding/json 으로 다시 푼다. 그래서 빠른 길이 틀려도 결과는 같다.
+
+var errDepthJSON = errors.New("unexpected depth message layout")
+
+type jsonScanner struct {
+	b []byte
+	i int
+}
+
+func (s *jsonScanner) space() {
+	for s.i < len(s.b) {
+		switch s.b[s.i] {
+		case ' ', '\t', '\n', '\r':
+			s.i++
+		default:
+			return
+		}
+	}
+}
+
+func (s *jsonScanner) consume(c byte) bool {
+	s.space()
+	if s.i < len(s.b) && s.b[s.i] == c {
+		s.i++
+		return true
+	}
+	return false
+}
+
+// 이스케이프가 없는 문자열의 내용 (따옴표 제외)
+func (s *jsonScanner) str() ([]byte, error) {
+	if !s.consume('"') {
+		return nil, errDepthJSON
+	}
+	for j := s.i; j < len(s.b); j++ {
+		switch s.b[j] {
+		case '"':
+			v := s.b[s.i:j]
+			s.i = j + 1
+			return v, nil
+		case '\\':
+			return nil, errDepthJSON
+		}
+	}
+	return nil, errDepthJSON
+}
+
+// 정수. 소수점이나 지수가 붙으면 뒤의 구분자 검사에서 걸린다.
+func (s *jsonScanner) int() (int64, error) {
+	s.space()
+	neg := s.i < len(s.b) && s.b[s.i] == '-'
+	if neg {
+		s.i++
+	}
+	var n int64
+	digits := 0
+	for ; s.i < len(s.b) && s.b[s.i] >= '0' && s.b[s.i] <= '9'; s.i++ {
+		n = n*10 + int64(s.b[s.i]-'0')
+		digits++
+	}
+	if digits == 0 || digits > 18 {
+		return 0, errDepthJSON
+	}
+	if neg {
+		n = -n
+	}
+	return n, nil
+}
+
+// 값 하나를 건너뛴다
+func (s *jsonScanner) skip() error {
+	s.space()
+	if s.i >= len(s.b) {
+		return errDepthJSON
+	}
+	switch s.b[s.i] {
+	case '"':
+		for j := s.i + 1; j < len(s.b); j++ {
+			switch s.b[j] {
+			case '\\':
+				j++
+			case '"':
+				s.i = j + 1
+				return nil
+			}
+		}
+		return errDepthJSON
+	case '{', '[':
+		depth := 0
+		for s.i < len(s.b) {
+			switch s.b[s.i] {
+			case '"':
+				if err := s.skip(); err != nil {
+					return err
+				}
+				continue
+			case '{', '[':
+				depth++
+			case '}', ']':
+				if depth--; depth == 0 {
+					s.i++
+					return nil
+				}
+			}
+			s.i++
+		}
+		return errDepthJSON
+	default: // 숫자, true, false, null
+		start := s.i
+		for s.i < len(s.b) {
+			switch s.b[s.i] {
+			case ',', '}', ']', ' ', '\t', '\n', '\r':
+				if s.i == start {
+					return errDepthJSON
+				}
+				return nil
+			}
+			s.i++
+		}
+		return nil
+	}
+}
+
+// 객체의 키마다 field 를 부른다. field 는 값을 읽거나 건너뛰어야 한다.
+func (s *jsonScanner) object(field func(key []byte) error) error {
+	if !s.consume('{') {
+		return errDepthJSON
+	}
+	if s.consume('}') {
+		return nil
+	}
+	for {
+		key, err := s.str()
+		if err != nil {
+			return err
+		}
+		if !s.consume(':') {
+			return errDepthJSON
+		}
+		if err := field(key); err != nil {
+			return err
+		}
+		if s.consume(',') {
+			continue
+		}
+		if s.consume('}') {
+			return nil
+		}
+		return errDepthJSON
+	}
+}
+
+// [["가격","수량"], ...] 를 한 블록의 Level 로 (parseLevels 와 같은 결과)
+func (s *jsonScanner) levels() ([]*orderbook.Level, error) {
+	// 문자열을 먼저 모아 개수를 안 뒤 한 번에 할당한다. 보통은 스택의 배열로 충분하다.
+	var buf [64][2][]byte
+	pairs := buf[:0]
+	if !s.consume('[') {
+		return nil, errDepthJSON
+	}
+	if !s.consume(']') {
+		for {
+			if !s.consume('[') {
+				return nil, errDepthJSON
+			}
+			price, err := s.str()
+			if err != nil || !s.consume(',') {
+				return nil, errDepthJSON
+			}
+			qty, err := s.str()
+			if err != nil || !s.consume(']') {
+				return nil, errDepthJSON
+			}
+			pairs = append(pairs, [2][]byte{price, qty})
+			if s.consume(',') {
+				continue
+			}
+			if s.consume(']') {
+				break
+			}
+			return nil, errDepthJSON
+		}
+	}
+
+	block := make([]orderbook.Level, len(pairs))
+	out := make([]*orderbook.Level, len(pairs))
+	for i, p := range pairs {
+		lv := &block[i]
+		var err error
+		if lv.Price, err = parseDecimal(p[0]); err != nil {
+			return nil, errDepthJSON
+		}
+		if lv.Quantity, err = parseDecimal(p[1]); err != nil {
+			return nil, errDepthJSON
+		}
+		if keepDecimalText {
+			lv.PriceText, lv.QuantityText = string(p[0]), string(p[1])
+		}
+		out[i] = lv
+	}
+	return out, nil
+}
+
+var exactPow10 = [...]float64{1e0, 1e1, 1e2, 1e3, 1e4, 1e5, 1e6, 1e7, 1e8, 1e9, 1e10, 1e11,
+	1e12, 1e13, 1e14, 1e15, 1e16, 1e17, 1e18, 1e19, 1e20, 1e21, 1e22}
+
+// "3012.34000000" 같은 가격/수량 문자열. 숫자들을 정수로 읽어 소수 자리만큼 10 의 거듭제곱으로 나눈다.
+// 정수가 2^53 이하이고 소수 자리가 22 이하면 두 수가 double 로 정확하므로 나눗셈 한 번의 반올림이
+// strconv.ParseFloat 와 같다. 부호나 지수가 있거나 자리가 더 많으면 strconv 로 읽는다.
+func parseDecimal(b []byte) (float64, error) {
+	var m uint64
+	frac, digits := -1, 0
+	for _, c := range b {
+		switch {
+		case c >= '0' && c <= '9':
+			m = m*10 + uint64(c-'0')
+			if m > 1<<53 {
+				return strconv.ParseFloat(string(b), 64)
+			}
+			digits++
+			if frac >= 0 {
+				frac++
+			}
+		case c == '.' && frac < 0:
+			frac = 0
+		default:
+			return strconv.ParseFloat(string(b), 64)
+		}
+	}
+	if digits == 0 || frac >= len(exactPow10) {
+		return strconv.ParseFloat(string(b), 64)
+	}
+	return float64(m) / exactPow10[max(frac, 0)], nil
+}
+
+// partial depth 스냅샷 data. 현물에는 E 가 없어 exchangeTime 이 0 이다.
+// 선물은 증분과 같은 키(u, b, a)로 오므로 u 를 lastUpdateId 로 받는다.
+func parseSnapshotJSON(data []byte) (snap *orderbook.Snapshot, exchangeTime int64, err error) {
+	s := jsonScanner{b: data}
+	snap = &orderbook.Snapshot{}
+	err = s.object(func(key []byte) error {
+		var err error
+		switch string(key) {
+		case "lastUpdateId", "u":
+			snap.LastUpdateId, err = s.int()
+		case "E":
+			exchangeTime, err = s.int()
+		case "bids", "b":
+			snap.Bids, err = s.levels()
+		case "asks", "a":
+			snap.Asks, err = s.levels()
+		default:
+			err = s.skip()
+		}
+		return err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return snap, exchangeTime, nil
+}
+
+// diff depth 증분 data
+func parseDiffJSON(data []byte) (diff *orderbook.DepthDiff, exchangeTime int64, err error) {
+	s := jsonScanner{b: data}
+	diff = &orderbook.DepthDiff{}
+	err = s.object(func(key []byte) error {
+		var err error
+		switch string(key) {
+		case "E":
+			exchangeTime, err = s.int()
+		case "U":
+			diff.FirstUpdateId, err = s.int()
+		case "u":
+			diff.FinalUpdateId, err = s.int()
+		case "pu":
+			diff.PrevFinalUpdateId, err = s.int()
+		case "b":
+			diff.Bids, err = s.levels()
+		case "a":
+			diff.Asks, err = s.levels()
+		default:
+			err = s.skip()
+		}
+		return err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return diff, exchangeTime, nil
+}
+
+// 결합 스트림 메시지를 stream 이름과 data 로 나눈다. data 는 msg 의 일부이고,
+// stream 이름은 처음 볼 때 한 번만 문자열로 만들어 재사용한다. 한 고루틴에서만 쓴다.
+type combinedDecoder struct {
+	names    map[string]string
+	fallback CombinedStreamEvent
+}
+
+func (d *combinedDecoder) decode(msg []byte) (stream string, data json.RawMessage, err error) {
+	s := jsonScanner{b: msg}
+	var name []byte
+	err = s.object(func(key []byte) error {
+		var err error
+		switch string(key) {
+		case "stream":
+			name, err = s.str()
+		case "data":
+			s.space()
+			start := s.i
+			if err = s.skip(); err == nil {
+				data = msg[start:s.i]
+			}
+		default:
+			err = s.skip()
+		}
+		return err
+	})
+	if err != nil || name == nil || data == nil {
+		d.fallback = CombinedStreamEvent{Data: d.fallback.Data[:0]}
+		if err := json.Unmarshal(msg, &d.fallback); err != nil {
+			return "", nil, err
+		}
+		return d.fallback.Stream, d.fallback.Data, nil
+	}
+	stream, ok := d.names[string(name)]
+	if !ok {
+		if d.names == nil {
+			d.names = make(map[string]string)
+		}
+		stream = string(name)
+		d.names[stream] = stream
+	}
+	return stream, data, nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"orderbook/orderbook"
+)
+
+// collect -derivatives-poll : 선물(-endpoint usdm) 심볼의 미결제약정과 펀딩비를 REST 로 주기적으로 받아
+// 그 심볼의 데이터 파일에 책과 같은 순번 흐름으로 기록한다. 그래서 책과 시간순으로 나란히 읽힌다.
+//
+//	GET /fapi/v1/premiumIndex            모든 심볼의 펀딩비, 마크/인덱스 가격 (한 번에)
+//	GET /fapi/v1/openInterest?symbol=X   심볼마다
+//
+// 레코드는 Record(binance.fundingRate, binance.openInterest, proto) 이고 stream_type 은 rest/premiumIndex,
+// rest/openInterest 다 (orderbook/derivatives.go). 연결 중에만 받으며 연결될 때마다 바로 한 번 받는다.
+// 값이 천천히 바뀌므로 1분 정도면 충분하다. 요청 가중치는 주기마다 10 + 심볼 수다.
+
+type derivativesOptions struct {
+	Interval time.Duration
+	Symbols  []string // 비면 수집 중인 모든 심볼
+	symbols  string
+}
+
+func (o *derivativesOptions) register(fs *flag.FlagSet) {
+	fs.DurationVar(&o.Interval, "derivatives-poll", 0, "with -endpoint usdm, record open interest and funding rates this often (e.g. 1m); 0 disables")
+	fs.StringVar(&o.symbols, "derivatives-symbols", "", "comma-separated symbols for -derivatives-poll (default: every collected symbol)")
+}
+
+// network.apply 뒤에 부른다 (marketType 을 본다)
+func (o *derivativesOptions) parse() error {
+	o.Symbols = splitList(strings.ToLower(o.symbols))
+	switch {
+	case o.Interval < 0:
+		return fmt.Errorf("-derivatives-poll must not be negative")
+	case o.Interval > 0 && !strings.Contains(marketType, "futures"):
+		return fmt.Errorf("-derivatives-poll needs a futures endpoint (-endpoint usdm)")
+	}
+	return nil
+}
+
+// done 이 닫힐 때까지 Interval 마다 받아 emit 으로 넘긴다
+func (o *derivativesOptions) run(done <-chan struct{}, emit func(symbol string, ev *orderbook.Event)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-done
+		cancel()
+	}()
+	t := time.NewTicker(o.Interval)
+	defer t.Stop()
+	for {
+		symbols := o.Symbols
+		if len(symbols) == 0 {
+			symbols = currentSymbols()
+		}
+		if err := pollDerivatives(ctx, symbols, emit); err != nil && ctx.Err() == nil {
+			log.Printf("Derivatives poll failed: %v", err)
+		}
+		select {
+		case <-done:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func pollDerivatives(ctx context.Context, symbols []string, emit func(symbol string, ev *orderbook.Event)) error {
+	var premiums []struct {
+		Symbol          string `json:"symbol"`
+		MarkPrice       string `json:"markPrice"`
+		IndexPrice      string `json:"indexPrice"`
+		LastFundingRate string `json:"lastFundingRate"`
+		InterestRate    string `json:"interestRate"`
+		NextFundingTime int64  `json:"nextFundingTime"`
+		Time            int64  `json:"time"`
+	}
+	if err := fetchJSON(ctx, restBaseURL+restAPIPath+"/premiumIndex", &premiums); err != nil {
+		return fmt.Errorf("premiumIndex: %w", err)
+	}
+	received := time.Now()
+	wanted := make(map[string]bool, len(symbols))
+	for _, s := range symbols {
+		wanted[strings.ToUpper(s)] = true
+	}
+	for _, p := range premiums {
+		if !wanted[p.Symbol] {
+			continue
+		}
+		emit(strings.ToLower(p.Symbol), derivativesEvent(p.Symbol, orderbook.FundingRateStreamType, orderbook.FundingRateRecordType, p.Time, received, &orderbook.FundingRate{
+			FundingRate:     parseFloat(p.LastFundingRate),
+			NextFundingTime: p.NextFundingTime,
+			MarkPrice:       parseFloat(p.MarkPrice),
+			IndexPrice:      parseFloat(p.IndexPrice),
+			InterestRate:    parseFloat(p.InterestRate),
+			Time:            p.Time,
+		}))
+	}
+
+	for _, symbol := range symbols {
+		var oi struct {
+			OpenInterest string `json:"openInterest"`
+			Time         int64  `json:"time"`
+		}
+		if err := fetchJSON(ctx, restBaseURL+restAPIPath+"/openInterest?symbol="+strings.ToUpper(symbol), &oi); err != nil {
+			log.Printf("Open interest for %s failed: %v", symbol, err)
+			continue
+		}
+		emit(symbol, derivativesEvent(symbol, orderbook.OpenInterestStreamType, orderbook.OpenInterestRecordType, oi.Time, time.Now(), &orderbook.OpenInterest{
+			OpenInterest: parseFloat(oi.OpenInterest),
+			Time:         oi.Time,
+		}))
+	}
+	return nil
+}
+
+// 순번은 받는 쪽이 매긴다
+func derivativesEvent(symbol, streamType, recordType string, exchangeTime int64, received time.Time, m proto.Message) *orderbook.Event {
+	data, _ := proto.Marshal(m)
+	ev := &orderbook.Event{
+		EventTime:     received.UnixMilli(),
+		ReceiveTimeNs: received.UnixNano(),
+		Symbol:        strings.ToUpper(symbol),
+		Exchange:      exchangeName,
+		MarketType:    marketType,
+		StreamType:    streamType,
+		ExchangeTime:  exchangeTime,
+		Payload:       &orderbook.Event_Record{Record: &orderbook.Record{Type: recordType, Encoding: "proto", Data: data}},
+	}
+	if exchangeTime != 0 {
+		ev.LatencyUs = (ev.ReceiveTimeNs - exchangeTime*int64(time.Millisecond)) / int64(time.Microsecond)
+	}
+	return ev
+}
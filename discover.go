@@ -0,0 +1,410 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// collect -discover : exchangeInfo 에서 조건에 맞는 심볼을 골라 -symbols 에 더해 모두 수집한다.
+// 상태가 TRADING 이고 호가 자산이 -discover-quotes 에 있으며 24시간 거래대금(호가 자산 기준, /api/v3/ticker/24hr)이
+// -discover-min-volume 이상인 심볼을 거래대금 순으로 -discover-max 개까지 고른다.
+//
+// -discover-refresh 마다 다시 골라 새 상장 등 새로 조건에 맞는 심볼은 연결을 끊지 않고 SUBSCRIBE 로 더한다
+// (REST 스냅샷을 먼저 기록한다). 한번 고른 심볼은 거래대금이 줄어도 유지하고, 거래가 멈추거나 상장 폐지되어
+// TRADING 이 아니게 되면 UNSUBSCRIBE 로 뺀다. 거래대금이 기준 근처를 오가며 구독이 흔들리지 않게 하기 위해서다.
+//
+// -discover-symbols 의 글롭 패턴(path.Match, 소문자 심볼 기준)으로 더 거른다. ! 로 시작하면 제외 패턴이다.
+// 포함 패턴이 있으면 그중 하나에 맞아야 하고 제외 패턴에는 하나도 맞지 않아야 한다 (예: *usdt,!*downusdt,!*upusdt).
+// 나중에 제외 패턴에 걸리게 된 심볼은 TRADING 이 아니게 된 것처럼 뺀다.
+//
+// -discover-listings 를 주면 그 주기로 exchangeInfo 만 따로 받아 처음 보는 심볼(신규 상장)을 찾고, 조건(호가 자산, 패턴)에
+// 맞으면 거래대금과 -discover-max 에 상관없이 바로 구독한다. 상장 직후 몇 분이 가장 중요한 구간이므로 거래 시작 전
+// 상태(PRE_TRADING, AUCTION_MATCH, BREAK)일 때부터 받고, 감지 후 하루 동안은 TRADING 이 아니어도 빼지 않는다.
+// 감지 시간은 그 심볼 파일의 세션 헤더 listed_at 에 남는다. 시작할 때 이미 있던 심볼은 상장으로 보지 않는다.
+//
+// 바이낸스는 연결 하나에 스트림 1024 개까지 받으므로 심볼 수 x -streams 가 그보다 작게 -discover-max 를 정한다.
+
+const maxStreamsPerConnection = 1024
+
+// 신규 상장 심볼을 거래 시작 전 상태로도 유지하는 기간
+const listingGrace = 24 * time.Hour
+
+type discoverOptions struct {
+	Enabled   bool
+	Quotes    []string
+	MinVolume float64
+	Max       int
+	Refresh   time.Duration
+	Listings  time.Duration
+	Patterns  symbolPatterns
+	quotes    string
+	patterns  string
+}
+
+func (o *discoverOptions) register(fs *flag.FlagSet) {
+	fs.BoolVar(&o.Enabled, "discover", false, "also collect every exchangeInfo symbol matching -discover-quotes and -discover-min-volume, refreshed every -discover-refresh")
+	fs.StringVar(&o.quotes, "discover-quotes", "USDT", "comma-separated quote assets for -discover; empty allows any")
+	fs.Float64Var(&o.MinVolume, "discover-min-volume", 0, "minimum 24h volume in the quote asset for -discover")
+	fs.IntVar(&o.Max, "discover-max", 200, "at most this many discovered symbols, highest volume first; 0 for no limit")
+	fs.StringVar(&o.patterns, "discover-symbols", "", "comma-separated glob patterns discovered symbols must match; a leading ! excludes (e.g. *usdt,!*downusdt)")
+	fs.DurationVar(&o.Refresh, "discover-refresh", time.Hour, "how often -discover looks for new symbols")
+	fs.DurationVar(&o.Listings, "discover-listings", 0, "also poll exchangeInfo this often for newly listed symbols and capture them at once, regardless of volume and -discover-max (e.g. 10s); 0 disables")
+}
+
+func (o *discoverOptions) parse() error {
+	o.Quotes = splitList(strings.ToUpper(o.quotes))
+	patterns, err := parseSymbolPatterns(o.patterns)
+	if err != nil {
+		return err
+	}
+	o.Patterns = patterns
+	switch {
+	case !o.Enabled:
+	case o.MinVolume < 0:
+		return fmt.Errorf("-discover-min-volume must not be negative")
+	case o.Max < 0:
+		return fmt.Errorf("-discover-max must not be negative")
+	case o.Refresh <= 0:
+		return fmt.Errorf("-discover-refresh must be positive")
+	case o.Listings < 0:
+		return fmt.Errorf("-discover-listings must not be negative")
+	}
+	return nil
+}
+
+// 수집 중인 심볼 (소문자). -discover 면 symbolDiscovery 가 바꾸므로 symbolsMu 를 잡고 읽는다.
+var symbolsMu sync.RWMutex
+
+func currentSymbols() []string {
+	symbolsMu.RLock()
+	defer symbolsMu.RUnlock()
+	return slices.Clone(symbols)
+}
+
+// 상장 감지로 수집을 시작한 심볼(소문자)과 감지 시간 (UTC ms). 파일 헤더의 listed_at 이 된다.
+var (
+	listingsMu sync.RWMutex
+	listings   = make(map[string]int64)
+)
+
+func listedAt(symbol string) int64 {
+	listingsMu.RLock()
+	defer listingsMu.RUnlock()
+	return listings[symbol]
+}
+
+type exchangeSymbol struct {
+	Symbol     string `json:"symbol"`
+	Status     string `json:"status"`
+	QuoteAsset string `json:"quoteAsset"`
+}
+
+func fetchExchangeSymbols(ctx context.Context) ([]exchangeSymbol, error) {
+	var info struct {
+		Symbols []exchangeSymbol `json:"symbols"`
+	}
+	if err := fetchJSON(ctx, restBaseURL+restAPIPath+"/exchangeInfo", &info); err != nil {
+		return nil, fmt.Errorf("exchangeInfo: %w", err)
+	}
+	return info.Symbols, nil
+}
+
+// 호가 자산과 -discover-symbols 패턴에 맞는지. 상태는 보지 않는다.
+func (o *discoverOptions) wants(s exchangeSymbol) bool {
+	return (len(o.Quotes) == 0 || slices.Contains(o.Quotes, s.QuoteAsset)) && o.Patterns.match(strings.ToLower(s.Symbol))
+}
+
+// 거래 시작 전 상태. 신규 상장 심볼은 이때부터 받는다.
+func preTrading(status string) bool {
+	return status == "PRE_TRADING" || status == "AUCTION_MATCH" || status == "BREAK"
+}
+
+type discoveredSymbol struct {
+	symbol string
+	volume float64
+}
+
+// TRADING 이고 조건에 맞으며 거래대금이 -discover-min-volume 이상인 심볼을 거래대금 순으로 돌려준다
+func (o *discoverOptions) discover(ctx context.Context, all []exchangeSymbol) ([]discoveredSymbol, error) {
+	var tickers []struct {
+		Symbol      string `json:"symbol"`
+		QuoteVolume string `json:"quoteVolume"`
+	}
+	if err := fetchJSON(ctx, restBaseURL+restAPIPath+"/ticker/24hr", &tickers); err != nil {
+		return nil, fmt.Errorf("24h tickers: %w", err)
+	}
+	volumes := make(map[string]float64, len(tickers))
+	for _, t := range tickers {
+		volumes[t.Symbol] = parseFloat(t.QuoteVolume)
+	}
+
+	var selected []discoveredSymbol
+	for _, s := range all {
+		if s.Status != "TRADING" || !o.wants(s) {
+			continue
+		}
+		if v := volumes[s.Symbol]; v >= o.MinVolume {
+			selected = append(selected, discoveredSymbol{strings.ToLower(s.Symbol), v})
+		}
+	}
+	sort.Slice(selected, func(i, j int) bool { return selected[i].volume > selected[j].volume })
+	return selected, nil
+}
+
+type symbolPatterns struct {
+	include, exclude []string
+}
+
+func parseSymbolPatterns(s string) (symbolPatterns, error) {
+	var p symbolPatterns
+	for _, v := range splitList(strings.ToLower(s)) {
+		list := &p.include
+		if rest, ok := strings.CutPrefix(v, "!"); ok {
+			list, v = &p.exclude, rest
+		}
+		if _, err := path.Match(v, ""); err != nil {
+			return p, fmt.Errorf("bad -discover-symbols pattern %q: %w", v, err)
+		}
+		*list = append(*list, v)
+	}
+	return p, nil
+}
+
+func (p symbolPatterns) match(symbol string) bool {
+	matchAny := func(patterns []string) bool {
+		for _, pat := range patterns {
+			if ok, _ := path.Match(pat, symbol); ok {
+				return true
+			}
+		}
+		return false
+	}
+	return (len(p.include) == 0 || matchAny(p.include)) && !matchAny(p.exclude)
+}
+
+func fetchJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := restClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// 주기적으로 심볼을 다시 골라 symbols 를 바꾸고 changed 로 알린다. update 와 pollListings 는 run 고루틴에서만 부른다.
+type symbolDiscovery struct {
+	opts       discoverOptions
+	static     []string        // -symbols. 항상 수집한다
+	discovered map[string]bool // 고른 심볼 (static 제외)
+	known      map[string]bool // exchangeInfo 에서 본 심볼. 첫 조회 전에는 nil
+	changed    chan struct{}
+}
+
+func newSymbolDiscovery(opts discoverOptions, static []string) *symbolDiscovery {
+	return &symbolDiscovery{opts: opts, static: static, discovered: make(map[string]bool), changed: make(chan struct{}, 1)}
+}
+
+func (d *symbolDiscovery) update(ctx context.Context) error {
+	all, err := fetchExchangeSymbols(ctx)
+	if err != nil {
+		return err
+	}
+	selected, err := d.opts.discover(ctx, all)
+	if err != nil {
+		return err
+	}
+	added := d.detectListings(all)
+	var removed []string
+	byName := make(map[string]exchangeSymbol, len(all))
+	for _, s := range all {
+		byName[strings.ToLower(s.Symbol)] = s
+	}
+	for symbol := range d.discovered {
+		s, ok := byName[symbol]
+		keep := ok && d.opts.wants(s) && (s.Status == "TRADING" ||
+			preTrading(s.Status) && time.Since(time.UnixMilli(listedAt(symbol))) < listingGrace)
+		if !keep {
+			delete(d.discovered, symbol)
+			removed = append(removed, symbol)
+		}
+	}
+	for _, s := range selected {
+		if d.opts.Max > 0 && len(d.discovered) >= d.opts.Max {
+			break
+		}
+		if !d.discovered[s.symbol] && !slices.Contains(d.static, s.symbol) {
+			d.discovered[s.symbol] = true
+			added = append(added, s.symbol)
+		}
+	}
+	d.apply(added, removed)
+	return nil
+}
+
+// exchangeInfo 만 받아 신규 상장을 찾는다
+func (d *symbolDiscovery) pollListings(ctx context.Context) error {
+	all, err := fetchExchangeSymbols(ctx)
+	if err != nil {
+		return err
+	}
+	d.apply(d.detectListings(all), nil)
+	return nil
+}
+
+// 처음 보는 심볼 중 조건에 맞는 것을 상장으로 기록하고 discovered 에 더한다. 첫 조회에서는 아는 심볼만 채운다.
+func (d *symbolDiscovery) detectListings(all []exchangeSymbol) []string {
+	first := d.known == nil
+	if first {
+		d.known = make(map[string]bool, len(all))
+	}
+	var listed []string
+	for _, s := range all {
+		if d.known[s.Symbol] {
+			continue
+		}
+		d.known[s.Symbol] = true
+		symbol := strings.ToLower(s.Symbol)
+		if first || !d.opts.wants(s) || (s.Status != "TRADING" && !preTrading(s.Status)) {
+			continue
+		}
+		listingsMu.Lock()
+		listings[symbol] = time.Now().UnixMilli()
+		listingsMu.Unlock()
+		log.Printf("New listing detected: %s (%s), capturing now", symbol, s.Status)
+		if !d.discovered[symbol] && !slices.Contains(d.static, symbol) {
+			d.discovered[symbol] = true
+			listed = append(listed, symbol)
+		}
+	}
+	return listed
+}
+
+// 바뀐 심볼 목록을 symbols 에 반영하고 연결에 알린다
+func (d *symbolDiscovery) apply(added, removed []string) {
+	if len(added) == 0 && len(removed) == 0 {
+		return
+	}
+	next := slices.Clone(d.static)
+	for symbol := range d.discovered {
+		next = append(next, symbol)
+	}
+	sort.Strings(next[len(d.static):])
+	symbolsMu.Lock()
+	symbols = next
+	symbolsMu.Unlock()
+	log.Printf("Discovered symbols: %d collected, +%d %v, -%d %v", len(next), len(added), added, len(removed), removed)
+	select {
+	case d.changed <- struct{}{}:
+	default:
+	}
+}
+
+func (d *symbolDiscovery) run(ctx context.Context) {
+	t := time.NewTicker(d.opts.Refresh)
+	defer t.Stop()
+	var poll <-chan time.Time
+	if d.opts.Listings > 0 {
+		lt := time.NewTicker(d.opts.Listings)
+		defer lt.Stop()
+		poll = lt.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := d.update(ctx); err != nil {
+				log.Printf("Symbol discovery failed, keeping the current symbols: %v", err)
+			}
+		case <-poll:
+			if err := d.pollListings(ctx); err != nil {
+				log.Printf("Listing poll failed: %v", err)
+			}
+		}
+	}
+}
+
+// 연결 하나 동안 심볼 목록이 바뀌면 구독을 맞춘다. 새 심볼은 added 를 부른 뒤(REST 스냅샷) 구독한다.
+// conn 에 쓰는 곳이 여럿이라 writeMu 를 잡고 쓴다. done 이 닫히면 끝난다.
+func (d *symbolDiscovery) follow(conn *websocket.Conn, writeMu *sync.Mutex, subscribed []string, done <-chan struct{}, added func(symbol string)) {
+	current := make(map[string]bool, len(subscribed))
+	for _, s := range subscribed {
+		current[s] = true
+	}
+	var id int64
+	send := func(method string, symbols []string) error {
+		var params []string
+		for _, s := range symbols {
+			for _, t := range symbolStreamTypes(s) {
+				params = append(params, streamSymbol(s)+"@"+t)
+			}
+		}
+		// 한 번에 너무 많이 보내지 않고, 초당 요청 수 한도(5)를 넘지 않게 나눠 보낸다
+		for chunk := range slices.Chunk(params, 100) {
+			id++
+			writeMu.Lock()
+			err := conn.WriteJSON(map[string]any{"method": method, "params": chunk, "id": id})
+			writeMu.Unlock()
+			if err != nil {
+				return err
+			}
+			time.Sleep(250 * time.Millisecond)
+		}
+		return nil
+	}
+	for {
+		select {
+		case <-done:
+			return
+		case <-d.changed:
+		}
+		next := currentSymbols()
+		var add, remove []string
+		for _, s := range next {
+			if !current[s] {
+				add = append(add, s)
+			}
+		}
+		for s := range current {
+			if !slices.Contains(next, s) {
+				remove = append(remove, s)
+			}
+		}
+		for _, s := range add {
+			added(s)
+		}
+		if err := send("SUBSCRIBE", add); err != nil {
+			log.Printf("Subscribing %v failed: %v", add, err)
+			return // 읽기 루프도 곧 끊기고 재연결 때 모두 구독한다
+		}
+		if err := send("UNSUBSCRIBE", remove); err != nil {
+			log.Printf("Unsubscribing %v failed: %v", remove, err)
+			return
+		}
+		for _, s := range add {
+			current[s] = true
+		}
+		for _, s := range remove {
+			delete(current, s)
+		}
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+// 여유 공간을 알 수 없는 플랫폼. -alert-disk-free 는 쓰이지 않는다
+func diskFree(dir string) (int64, bool) {
+	return 0, false
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// orderbook duckdb <dir> : convert -hive 로 만든 데이터셋을 DuckDB 로 바로 질의하는 SQL 을 출력한다.
+//
+//	orderbook convert -format parquet -hive -out lake data/ethusdt/*.bin
+//	orderbook duckdb lake | duckdb
+//	orderbook duckdb lake > lake.sql && duckdb -init lake.sql   # 뷰를 만든 채로 대화형
+//
+// 디렉터리 이름(exchange=, symbol=, date=)이 열이 되는 뷰를 만들고, 데이터셋의 레이아웃(snapshot, level)에 맞는
+// 예제 질의를 주석으로 덧붙인다. 예제의 심볼과 날짜는 처음 찾은 파티션이다 (-symbol, -date 로 바꾼다).
+// DuckDB 가 없어도 SQL 은 Spark SQL 등에 옮기기 쉽다.
+
+func runDuckDB(args []string) error {
+	fset := flag.NewFlagSet("duckdb", flag.ExitOnError)
+	view := fset.String("view", "orderbook", "name of the view to create")
+	symbol := fset.String("symbol", "", "symbol used in the example queries (default: the first partition found)")
+	date := fset.String("date", "", "date used in the example queries (default: the first partition found)")
+	fset.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: orderbook duckdb [flags] <dir written by convert -hive>")
+		fset.PrintDefaults()
+	}
+	fset.Parse(args)
+	if fset.NArg() != 1 {
+		fset.Usage()
+		return fmt.Errorf("expected one dataset directory")
+	}
+	dir, err := filepath.Abs(fset.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	sample, err := firstHiveFile(dir)
+	if err != nil {
+		return err
+	}
+	layout, err := parquetLayout(sample)
+	if err != nil {
+		return err
+	}
+	if *symbol == "" || *date == "" {
+		for _, part := range strings.Split(filepath.ToSlash(filepath.Dir(sample)), "/") {
+			if v, ok := strings.CutPrefix(part, "symbol="); ok && *symbol == "" {
+				*symbol = v
+			}
+			if v, ok := strings.CutPrefix(part, "date="); ok && *date == "" {
+				*date = v
+			}
+		}
+	}
+
+	glob := filepath.ToSlash(filepath.Join(dir, "exchange=*", "symbol=*", "date=*", "*.parquet"))
+	where := fmt.Sprintf("symbol = %s AND date = %s", sqlString(*symbol), sqlString(*date))
+	fmt.Printf("-- %s (layout %s)\n", dir, layout)
+	fmt.Printf("CREATE OR REPLACE VIEW %s AS\n", *view)
+	fmt.Printf("SELECT * FROM read_parquet(%s, hive_partitioning = true, union_by_name = true);\n\n", sqlString(glob))
+	fmt.Printf("-- 파티션별 행 수와 시간 범위\n")
+	fmt.Printf("-- SELECT exchange, symbol, date, count(*) AS rows, min(event_time) AS first, max(event_time) AS last FROM %s GROUP BY ALL ORDER BY ALL;\n", *view)
+	switch layout {
+	case "level":
+		fmt.Printf("-- 1초마다 마지막 최우선 호가와 스프레드\n")
+		fmt.Printf("-- SELECT time_bucket(INTERVAL 1 second, event_time) AS t, arg_max(price, event_time) FILTER (side = 'bid' AND depth = 0) AS bid,\n")
+		fmt.Printf("--        arg_max(price, event_time) FILTER (side = 'ask' AND depth = 0) AS ask, ask - bid AS spread\n")
+		fmt.Printf("--   FROM %s WHERE %s GROUP BY t ORDER BY t;\n", *view, where)
+		fmt.Printf("-- 상위 5 호가 수량 합 (스냅샷마다)\n")
+		fmt.Printf("-- SELECT event_time, sum(quantity) FILTER (side = 'bid') AS bid_depth, sum(quantity) FILTER (side = 'ask') AS ask_depth\n")
+		fmt.Printf("--   FROM %s WHERE %s AND depth < 5 GROUP BY event_time ORDER BY event_time;\n", *view, where)
+	default:
+		fmt.Printf("-- 스냅샷마다 최우선 호가와 스프레드 (리스트는 1 부터)\n")
+		fmt.Printf("-- SELECT event_time, bids[1].price AS bid, asks[1].price AS ask, asks[1].price - bids[1].price AS spread\n")
+		fmt.Printf("--   FROM %s WHERE %s ORDER BY event_time;\n", *view, where)
+		fmt.Printf("-- 호가 단계 하나를 한 행으로 펼치기\n")
+		fmt.Printf("-- SELECT event_time, 'bid' AS side, unnest(bids, recursive := true) FROM %s WHERE %s\n", *view, where)
+		fmt.Printf("--  UNION ALL SELECT event_time, 'ask', unnest(asks, recursive := true) FROM %s WHERE %s;\n", *view, where)
+	}
+	return nil
+}
+
+// dir 아래에서 처음 찾은 hive 파티션의 Parquet 파일
+func firstHiveFile(dir string) (string, error) {
+	errFound := errors.New("found")
+	var found string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(path, ".parquet") && strings.Contains(filepath.ToSlash(path), "/symbol=") {
+			found = path
+			return errFound
+		}
+		return nil
+	})
+	if err != nil && err != errFound {
+		return "", err
+	}
+	if found == "" {
+		return "", fmt.Errorf("no exchange=/symbol=/date= parquet files under %s (write them with convert -format parquet -hive -out %s)", dir, dir)
+	}
+	return found, nil
+}
+
+// convert 의 Parquet 레이아웃. bids 열이 있으면 snapshot, 없으면 level
+func parquetLayout(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	pf, err := parquet.OpenFile(f, fi.Size())
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	for _, field := range pf.Schema().Fields() {
+		if field.Name() == "bids" {
+			return "snapshot", nil
+		}
+	}
+	return "level", nil
+}
+
+func sqlString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
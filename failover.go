@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"log"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// 파일 쓰기 실패 처리. 디스크가 가득 찼거나(ENOSPC) 쓰기, 내려보내기, fsync 에 실패하면 그 파일을 닫는다.
+// 버퍼에 남아 있던 이벤트는 잃고 파일 끝이 잘렸을 수 있으므로 그 파일에는 다시 이어 쓰지 않고,
+// 같은 구간이면 새 세션 파일(~HHMMSS, rotation.go)을 연다.
+//
+// -failover-dir 이 있으면 처음 실패할 때 그 아래 data/ (tick 은 ticks/) 로 넘어가 실패한 이벤트부터 다시 쓰고,
+// 재시작할 때까지 그곳에 쓴다. 같은 형식의 데이터 디렉터리라 -data 로 읽을 수 있고, 본 디렉터리로 옮기는 것은 운영자 몫이다.
+// 넘어갈 곳이 없거나 그곳도 실패하면 그 심볼은 writeRetryInterval 동안 이벤트를 버리고(순번 공백) 다시 시도한다.
+//
+// 실패는 로그로 남기고, 상태는 expvar "write_health" 와 관리 서버의 GET /health/writes 로 본다.
+// 어느 심볼이든 쓰기에 실패하고 있으면 GET /health/writes 가 503 을 돌려주므로 모니터링 경보에 쓸 수 있다.
+// collect -alert 를 주면 수집기가 직접 웹훅, Slack, Telegram 으로 알린다 (alert.go).
+
+// 쓰기에 실패한 심볼을 다시 시도하기까지 기다리는 시간
+const writeRetryInterval = 10 * time.Second
+
+type writeHealth struct {
+	State       string `json:"state"` // ok, failover (넘어간 디렉터리에 쓰는 중), failing (버리고 있다)
+	DataDir     string `json:"dataDir"`
+	Errors      int64  `json:"errors"`
+	DiskFull    int64  `json:"diskFull"`
+	Dropped     int64  `json:"dropped"`
+	LastError   string `json:"lastError,omitempty"`
+	LastErrorAt int64  `json:"lastErrorAt,omitempty"` // UTC ms
+}
+
+// 이벤트 쓰기, 내려보내기, fsync 가 err 로 실패했을 때 부른다. 열려 있던 파일을 버리고 가능하면 다른 디렉터리로 넘어간다.
+// 넘어가서 바로 다시 써 볼 만하면 true, 아니면 그 심볼을 writeRetryInterval 동안 쉬게 하고 false.
+// fm.mu 를 잡은 상태에서 호출해야 한다.
+func (fm *FileManager) writeFailed(symbol string, err error) bool {
+	symbolLower := strings.ToLower(symbol)
+	kind := "write error"
+	if errors.Is(err, syscall.ENOSPC) {
+		kind = "disk full"
+		fm.health.DiskFull++
+	}
+	fm.health.Errors++
+	fm.health.LastError, fm.health.LastErrorAt = err.Error(), time.Now().UnixMilli()
+
+	if fw, ok := fm.writers[symbolLower]; ok {
+		log.Printf("Data file %s failed (%s), closing it: %v", fw.Name(), kind, err)
+		fw.Close() // 남은 버퍼는 쓰지 못한다
+		delete(fm.writers, symbolLower)
+		delete(fm.sidecars, symbolLower)
+		delete(fm.synced, symbolLower)
+		fm.broken[symbolLower] = true
+	} else {
+		log.Printf("Cannot open data file for %s (%s): %v", symbol, kind, err)
+	}
+
+	if fm.failoverDir != "" && fm.dataDir != fm.failoverDir {
+		log.Printf("Failing over data files from %s to %s", fm.dataDir, fm.failoverDir)
+		// 다른 심볼도 넘어간 디렉터리의 새 파일로 옮긴다
+		for s := range fm.writers {
+			fm.closeFile(s)
+		}
+		fm.dataDir = fm.failoverDir
+		clear(fm.broken)
+		clear(fm.retryAt)
+		return true
+	}
+	fm.retryAt[symbolLower] = time.Now().Add(writeRetryInterval)
+	return false
+}
+
+func (fm *FileManager) writeHealth() writeHealth {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	h := fm.health
+	h.DataDir = fm.dataDir
+	switch {
+	case len(fm.retryAt) > 0:
+		h.State = "failing"
+	case fm.dataDir == fm.failoverDir:
+		h.State = "failover"
+	default:
+		h.State = "ok"
+	}
+	return h
+}
+
+// 수집기의 파일 쓰기 상태를 expvar 와 관리 서버에 등록한다. fms 는 디렉터리 이름(data, ticks 등)별 FileManager.
+func publishWriteHealth(fms map[string]*FileManager) {
+	status := func() map[string]writeHealth {
+		st := make(map[string]writeHealth, len(fms))
+		for name, fm := range fms {
+			st[name] = fm.writeHealth()
+		}
+		return st
+	}
+	expvar.Publish("write_health", expvar.Func(func() any { return status() }))
+	adminMux.HandleFunc("GET /health/writes", func(w http.ResponseWriter, r *http.Request) {
+		st := status()
+		w.Header().Set("Content-Type", "application/json")
+		for _, h := range st {
+			if h.State == "failing" {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				break
+			}
+		}
+		json.NewEncoder(w).Encode(st)
+	})
+}
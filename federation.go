@@ -0,0 +1,377 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// 여러 저장소에 걸친 질의 (serve-api -store). 호출하는 쪽은 어느 저장소에 있는지 몰라도 된다.
+//
+//	-store data                             로컬 데이터 디렉터리
+//	-store s3://bucket/prefix?region=...    upload 로 올린 보관본 (<prefix>/<symbol>/<file>[.zst]). gs:// 도 된다
+//	-store http://peer:8081[?token=...]     다른 수집기의 serve-files (/catalog 와 /files)
+//
+// 날짜마다 -store 를 준 순서대로 카탈로그를 보고, 그 심볼과 날짜의 파일이 있는 첫 저장소의 파일을 쓴다.
+// 같은 날을 여러 저장소가 가지고 있어도 한 곳에서만 읽으므로 결과가 겹치지 않는다 (빠른 저장소를 앞에 둔다).
+// 원격 파일은 -cache-dir 에 통째로 받아 (.zst 는 풀어서) 로컬 파일처럼 읽는다. 원격 크기가 바뀌면 다시 받는다.
+// 응답하지 않는 저장소는 로그만 남기고 다음 저장소로 넘어간다.
+
+// 원격 카탈로그를 다시 가져오기 전까지 쓰는 시간
+const federationCatalogTTL = time.Minute
+
+// 저장소 안의 파일 하나. rel 은 저장소 기준 <symbol>/<name>.
+type storeFile struct {
+	rel  string
+	size int64
+}
+
+type dataStore interface {
+	String() string
+	// symbol 의 date 파일들 (이름순 = 시간순)
+	dayFiles(ctx context.Context, symbol, date string) ([]storeFile, error)
+	// f 를 로컬에서 읽을 수 있는 경로
+	fetch(ctx context.Context, f storeFile) (string, error)
+}
+
+type federation struct {
+	stores []dataStore
+}
+
+// -store 목록으로 만든다. 원격 저장소의 파일은 cacheDir 아래 저장소별 디렉터리에 받는다.
+func newFederation(specs []string, cacheDir string) (*federation, error) {
+	fd := &federation{}
+	for _, spec := range specs {
+		u, err := url.Parse(spec)
+		if err != nil {
+			return nil, fmt.Errorf("store %q: %w", spec, err)
+		}
+		var cache *fileCache
+		if u.Scheme != "" && u.Scheme != "file" {
+			sum := sha256.Sum256([]byte(spec))
+			cache = &fileCache{dir: filepath.Join(cacheDir, hex.EncodeToString(sum[:4]))}
+		}
+		var st dataStore
+		switch u.Scheme {
+		case "", "file":
+			st = &localStore{dir: filepath.FromSlash(u.Path)}
+		case "s3", "gs":
+			store, err := openObjectStore(spec)
+			if err != nil {
+				return nil, err
+			}
+			st = &archiveStore{spec: spec, store: store, cache: cache}
+		case "http", "https":
+			q := u.Query()
+			token := q.Get("token")
+			q.Del("token")
+			u.RawQuery = q.Encode()
+			st = &peerStore{base: strings.TrimRight(u.String(), "/"), token: token, cache: cache, client: &http.Client{Timeout: 10 * time.Minute}}
+		default:
+			return nil, fmt.Errorf("unsupported store %q (use a directory, s3://, gs:// or http(s)://)", spec)
+		}
+		fd.stores = append(fd.stores, st)
+	}
+	if len(fd.stores) == 0 {
+		return nil, fmt.Errorf("no stores")
+	}
+	return fd, nil
+}
+
+// fileLister. 날짜마다 파일이 있는 첫 저장소를 골라 로컬 경로로 돌려준다.
+func (fd *federation) files(ctx context.Context, symbol string, from, to int64) ([]dataFile, error) {
+	symbol = strings.ToLower(symbol)
+	var files []dataFile
+	for _, date := range datesInRange(from, to) {
+		for _, st := range fd.stores {
+			found, err := st.dayFiles(ctx, symbol, date)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				log.Printf("Store %s unavailable for %s %s, trying the next: %v", st, symbol, date, err)
+				continue
+			}
+			if len(found) == 0 {
+				continue
+			}
+			for _, f := range found {
+				p, err := st.fetch(ctx, f)
+				if err != nil {
+					return nil, fmt.Errorf("store %s: %s: %w", st, f.rel, err)
+				}
+				fi, err := os.Stat(p)
+				if err != nil {
+					return nil, err
+				}
+				files = append(files, dataFile{path: p, date: date, size: fi.Size()})
+			}
+			break
+		}
+	}
+	return files, nil
+}
+
+type localStore struct {
+	dir string
+}
+
+func (s *localStore) String() string { return s.dir }
+
+func (s *localStore) dayFiles(ctx context.Context, symbol, date string) ([]storeFile, error) {
+	var files []storeFile
+	for _, f := range dayFiles(s.dir, symbol, date) {
+		files = append(files, storeFile{rel: f.path, size: f.size})
+	}
+	return files, nil
+}
+
+// 로컬 저장소의 rel 은 이미 읽을 수 있는 경로다
+func (s *localStore) fetch(ctx context.Context, f storeFile) (string, error) {
+	return f.rel, nil
+}
+
+// 원격 카탈로그나 오브젝트 키에서 온 경로는 믿지 않는다. 캐시 디렉터리 밖을 가리키면 (../, 절대 경로) 버린다
+func cacheableRel(source fmt.Stringer, rel string) bool {
+	if filepath.IsLocal(filepath.FromSlash(rel)) {
+		return true
+	}
+	log.Printf("Ignoring %q from %s: path leaves the cache directory", rel, source)
+	return false
+}
+
+// 원격 파일을 받아 둔 디렉터리. <dir>/<rel>.<원격 크기> 로 두어 크기가 바뀌면 새로 받는다.
+type fileCache struct {
+	dir string
+
+	mu      sync.Mutex
+	loading map[string]*sync.Mutex // 같은 파일을 동시에 두 번 받지 않도록
+}
+
+func (c *fileCache) get(ctx context.Context, f storeFile, open func(ctx context.Context) (io.ReadCloser, error)) (string, error) {
+	if !filepath.IsLocal(filepath.FromSlash(f.rel)) {
+		return "", fmt.Errorf("%s: path leaves the cache directory", f.rel)
+	}
+	p := filepath.Join(c.dir, filepath.FromSlash(f.rel)) + fmt.Sprintf(".%d", f.size)
+
+	c.mu.Lock()
+	if c.loading == nil {
+		c.loading = make(map[string]*sync.Mutex)
+	}
+	l := c.loading[p]
+	if l == nil {
+		l = &sync.Mutex{}
+		c.loading[p] = l
+	}
+	c.mu.Unlock()
+	l.Lock()
+	defer l.Unlock()
+
+	if _, err := os.Stat(p); err == nil {
+		return p, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+		return "", err
+	}
+	body, err := open(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	var src io.Reader = body
+	if strings.HasSuffix(f.rel, ".zst") {
+		dec, err := zstd.NewReader(body)
+		if err != nil {
+			return "", err
+		}
+		defer dec.Close()
+		src = dec
+	}
+	tmp := p + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(out, src)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	if err := os.Rename(tmp, p); err != nil {
+		return "", err
+	}
+	// 같은 파일의 이전 크기 판은 더 읽지 않는다
+	old, _ := filepath.Glob(filepath.Join(c.dir, filepath.FromSlash(f.rel)) + ".*")
+	for _, o := range old {
+		if o != p && !strings.HasSuffix(o, ".tmp") {
+			os.Remove(o)
+		}
+	}
+	log.Printf("Fetched %s (%s)", f.rel, formatBytes(f.size))
+	return p, nil
+}
+
+// 심볼별 카탈로그를 잠깐 기억한다
+type catalogCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedCatalog
+}
+
+type cachedCatalog struct {
+	files   []storeFile
+	fetched time.Time
+}
+
+func (c *catalogCache) get(symbol string, load func() ([]storeFile, error)) ([]storeFile, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[symbol]; ok && time.Since(e.fetched) < federationCatalogTTL {
+		return e.files, nil
+	}
+	files, err := load()
+	if err != nil {
+		return nil, err
+	}
+	if c.entries == nil {
+		c.entries = make(map[string]cachedCatalog)
+	}
+	c.entries[symbol] = cachedCatalog{files: files, fetched: time.Now()}
+	return files, nil
+}
+
+// 심볼 카탈로그에서 date 의 데이터 파일만 고른다 (이름순으로 받는다고 본다)
+func filesOnDate(files []storeFile, date string) []storeFile {
+	var out []storeFile
+	for _, f := range files {
+		name := strings.TrimSuffix(path.Base(f.rel), ".zst")
+		if strings.HasSuffix(name, ".idx") || strings.HasSuffix(name, ".tmp") || fileDate(name) != date {
+			continue
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+// upload 로 올린 보관본
+type archiveStore struct {
+	spec     string
+	store    *objectStore
+	cache    *fileCache
+	catalogs catalogCache
+}
+
+func (s *archiveStore) String() string { return s.spec }
+
+func (s *archiveStore) dayFiles(ctx context.Context, symbol, date string) ([]storeFile, error) {
+	files, err := s.catalogs.get(symbol, func() ([]storeFile, error) {
+		objects, err := s.store.List(ctx, s.store.key(symbol+"/"))
+		if err != nil {
+			return nil, err
+		}
+		files := make([]storeFile, 0, len(objects))
+		for _, o := range objects {
+			rel := strings.TrimPrefix(strings.TrimPrefix(o.Key, s.store.prefix), "/")
+			if !cacheableRel(s, rel) {
+				continue
+			}
+			files = append(files, storeFile{rel: rel, size: o.Size})
+		}
+		return files, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return filesOnDate(files, date), nil
+}
+
+func (s *archiveStore) fetch(ctx context.Context, f storeFile) (string, error) {
+	return s.cache.get(ctx, f, func(ctx context.Context) (io.ReadCloser, error) {
+		return s.store.Get(ctx, s.store.key(f.rel))
+	})
+}
+
+// 다른 수집기의 serve-files
+type peerStore struct {
+	base     string
+	token    string
+	cache    *fileCache
+	client   *http.Client
+	catalogs catalogCache
+}
+
+func (s *peerStore) String() string { return s.base }
+
+func (s *peerStore) get(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.base+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: %s", path, resp.Status)
+	}
+	return resp, nil
+}
+
+func (s *peerStore) dayFiles(ctx context.Context, symbol, date string) ([]storeFile, error) {
+	files, err := s.catalogs.get(symbol, func() ([]storeFile, error) {
+		resp, err := s.get(ctx, "/catalog?symbol="+url.QueryEscape(symbol))
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		var catalog struct {
+			Files []catalogEntry `json:"files"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&catalog); err != nil {
+			return nil, fmt.Errorf("catalog: %w", err)
+		}
+		files := make([]storeFile, 0, len(catalog.Files))
+		for _, e := range catalog.Files {
+			if !cacheableRel(s, e.Path) {
+				continue
+			}
+			files = append(files, storeFile{rel: e.Path, size: e.Size})
+		}
+		return files, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return filesOnDate(files, date), nil
+}
+
+func (s *peerStore) fetch(ctx context.Context, f storeFile) (string, error) {
+	return s.cache.get(ctx, f, func(ctx context.Context) (io.ReadCloser, error) {
+		resp, err := s.get(ctx, "/files/"+(&url.URL{Path: f.rel}).EscapedPath())
+		if err != nil {
+			return nil, err
+		}
+		return resp.Body, nil
+	})
+}
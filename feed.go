@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"orderbook/orderbook"
+)
+
+// 전략 코드가 라이브와 백테스트에서 같은 API 로 이벤트를 받는다.
+//
+//	feed := NewLiveFeed(streamTypes)                       // 바이낸스 웹소켓
+//	feed := NewReplayFeed(dataDir, from, to, speed)        // 기록된 파일
+//	feed := NewTailFeed(dataDir, from)                     // 수집기가 쓰고 있는 파일 (tail.go)
+//	book := feed.Subscribe("ethusdt")
+//	go feed.Run(ctx)
+//	for ev := range book { ... }
+//
+// Subscribe 는 Run 전에 부른다. 같은 심볼을 여러 번 구독하면 채널마다 같은 이벤트가 간다.
+// 여러 심볼을 한 번에 구독하면 한 채널로 피드가 내보낸 순서 그대로 받는다 (재생이면 심볼을 가로지른 수신 시각 순).
+// 심볼마다 따로 구독해 합치면 그 순서가 흐트러진다.
+// 채널은 Run 이 끝날 때 닫힌다 (재생은 구간 끝, 라이브는 ctx 취소).
+// 받는 쪽이 느리면 두 구현 모두 기다린다. 라이브에서 오래 막히면 바이낸스가 연결을 끊으므로 채널을 제때 비워야 한다.
+// 이벤트는 파일에 기록되는 것과 같은 모양이고 순번은 피드 안에서 심볼별로 매긴다 (재생은 기록된 순번 그대로).
+type Feed interface {
+	Subscribe(symbols ...string) <-chan *orderbook.Event
+	Run(ctx context.Context) error
+}
+
+// 구독 채널 하나에 밀려 있을 수 있는 이벤트 수
+const feedBuffer = 1024
+
+// 두 구현이 같이 쓰는 구독 목록
+type feedSubs struct {
+	mu   sync.Mutex
+	subs map[string][]chan *orderbook.Event // 소문자 심볼
+}
+
+func (f *feedSubs) Subscribe(symbols ...string) <-chan *orderbook.Event {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.subs == nil {
+		f.subs = make(map[string][]chan *orderbook.Event)
+	}
+	ch := make(chan *orderbook.Event, feedBuffer)
+	seen := make(map[string]bool)
+	for _, symbol := range symbols {
+		symbol = strings.ToLower(symbol)
+		if !seen[symbol] {
+			seen[symbol] = true
+			f.subs[symbol] = append(f.subs[symbol], ch)
+		}
+	}
+	return ch
+}
+
+func (f *feedSubs) symbols() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []string
+	for s := range f.subs {
+		out = append(out, s)
+	}
+	return out
+}
+
+func (f *feedSubs) deliver(ctx context.Context, ev *orderbook.Event) error {
+	f.mu.Lock()
+	chans := f.subs[strings.ToLower(ev.Symbol)]
+	f.mu.Unlock()
+	for _, ch := range chans {
+		select {
+		case ch <- ev:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (f *feedSubs) closeAll() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	closed := make(map[chan *orderbook.Event]bool) // 여러 심볼을 구독한 채널은 한 번만 닫는다
+	for _, chans := range f.subs {
+		for _, ch := range chans {
+			if !closed[ch] {
+				closed[ch] = true
+				close(ch)
+			}
+		}
+	}
+	f.subs = nil
+}
+
+// 바이낸스 combined stream 을 받는 Feed. 끊기면 5초 뒤 다시 붙는다.
+type LiveFeed struct {
+	feedSubs
+	streamTypes []string
+	sequences   map[string]uint64
+}
+
+func NewLiveFeed(streamTypes []string) *LiveFeed {
+	return &LiveFeed{streamTypes: streamTypes, sequences: make(map[string]uint64)}
+}
+
+// ctx 가 취소될 때까지 돈다
+func (f *LiveFeed) Run(ctx context.Context) error {
+	defer f.closeAll()
+	var streamNames []string
+	for _, s := range f.symbols() {
+		for _, t := range f.streamTypes {
+			streamNames = append(streamNames, s+"@"+t)
+		}
+	}
+	if len(streamNames) == 0 {
+		return errors.New("feed: no subscriptions")
+	}
+	url := websocketURL + strings.Join(streamNames, "/")
+	for {
+		err := f.stream(ctx, url)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Printf("Feed disconnected (%v). Reconnecting in 5 seconds...", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+func (f *LiveFeed) stream(ctx context.Context, url string) error {
+	conn, _, err := wsDialer.DialContext(ctx, url, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// ReadMessage 를 ctx 로 깨울 수 없으므로 취소되면 연결을 닫는다
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	var decoder combinedDecoder
+	for {
+		_, message, err := conn.ReadMessage()
+		received := time.Now()
+		if err != nil {
+			return err
+		}
+		stream, data, err := decoder.decode(message)
+		if err != nil {
+			log.Println("Feed: combined stream unmarshal error:", err)
+			continue
+		}
+		symbol, _, _ := strings.Cut(stream, "@")
+		f.sequences[symbol]++
+		sequence := f.sequences[symbol]
+
+		ev, err := parseStreamEvent(stream, data, received)
+		if err != nil {
+			log.Printf("Feed: stream %s data unmarshal error (seq %d dropped): %v", stream, sequence, err)
+			continue
+		}
+		ev.Sequence = sequence
+		if err := f.deliver(ctx, ev); err != nil {
+			return err
+		}
+	}
+}
+
+// 기록된 파일을 [from, to) 구간만큼 다시 흘려보내는 Feed.
+// 여러 심볼은 수신 시각 순으로 섞는다. speed 는 원래 간격의 배수이고 0 이면 기다리지 않는다.
+type ReplayFeed struct {
+	feedSubs
+	dataDir  string
+	from, to int64
+	speed    float64
+}
+
+func NewReplayFeed(dataDir string, from, to int64, speed float64) *ReplayFeed {
+	return &ReplayFeed{dataDir: dataDir, from: from, to: to, speed: speed}
+}
+
+// 구간 끝까지 보내면 nil 을 돌려준다
+func (f *ReplayFeed) Run(ctx context.Context) error {
+	defer f.closeAll()
+	symbols := f.symbols()
+	if len(symbols) == 0 {
+		return errors.New("feed: no subscriptions")
+	}
+	pacer := newPacer(f.speed)
+	return mergeRange(ctx, f.dataDir, symbols, f.from, f.to, func(ev *orderbook.Event) error {
+		if err := pacer.wait(ctx, ev.EventTime); err != nil {
+			return err
+		}
+		return f.deliver(ctx, ev)
+	})
+}
+
+// 심볼별로 구간을 읽어 수신 시각 순으로 섞어 fn 에 넘긴다 (orderbook.MergeReader).
+// 심볼마다 고루틴이 파일을 미리 읽어 두고, 같은 시각이면 symbols 에 준 순서대로 넘긴다.
+// 심볼을 파일 이름으로만 알던 옛 레코드는 Symbol 을 채워서 넘긴다.
+func mergeRange(ctx context.Context, dataDir string, symbols []string, from, to int64, fn func(ev *orderbook.Event) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // fn 이 오류로 멈추면 읽던 고루틴도 정리한다
+
+	var sources []orderbook.EventSource
+	for _, symbol := range symbols {
+		src := &chanSource{events: make(chan *orderbook.Event, 1024)}
+		sources = append(sources, src)
+		q := &rangeQuery{DataDir: dataDir, Symbol: symbol, From: from, To: to}
+		go func() {
+			defer close(src.events)
+			_, src.err = q.run(ctx, func(ev *orderbook.Event) error {
+				if ev.Symbol == "" {
+					ev.Symbol = strings.ToUpper(symbol)
+				}
+				select {
+				case src.events <- ev:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			})
+		}()
+	}
+
+	m := orderbook.NewMergeReader(sources...)
+	for {
+		ev, err := m.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(ev); err != nil {
+			return err
+		}
+	}
+}
+
+// 고루틴이 채우는 채널을 EventSource 로 읽는다. err 는 채널을 닫기 전에 쓴다.
+type chanSource struct {
+	events chan *orderbook.Event
+	err    error
+}
+
+func (s *chanSource) Next() (*orderbook.Event, error) {
+	ev, ok := <-s.events
+	if !ok {
+		if s.err != nil {
+			return nil, s.err
+		}
+		return nil, io.EOF
+	}
+	return ev, nil
+}
+
+// orderbook follow : Feed 로 최우선 호가 변화를 출력한다. 구간을 주면 재생, -live 면 실시간, -tail 이면 수집 중인 파일.
+// 같은 코드가 두 피드 위에서 도는 것을 보여 주는 최소 전략이기도 하다.
+func runFollow(args []string) error {
+	fs := flag.NewFlagSet("follow", flag.ExitOnError)
+	symbolList := fs.String("symbols", strings.Join(symbols, ","), "comma-separated symbols to follow")
+	live := fs.Bool("live", false, "follow the live Binance stream instead of recorded data")
+	tail := fs.Bool("tail", false, "follow the files a local collector is writing (from now) instead of a recorded range")
+	streamList := fs.String("streams", strings.Join(streamTypes, ","), "stream types for -live")
+	var rng rangeFlags
+	rng.register(fs)
+	speed := fs.Float64("speed", 0, "replay pacing relative to the original timing (1 = real time); 0 replays as fast as possible")
+	dataDir := fs.String("data", defaultDataDir, "data directory")
+	var network networkOptions
+	network.register(fs)
+	fs.Parse(args)
+	if err := network.apply(); err != nil {
+		return err
+	}
+
+	var feed Feed
+	switch {
+	case *live:
+		feed = NewLiveFeed(splitList(*streamList))
+	case *tail:
+		feed = NewTailFeed(*dataDir, time.Now().UnixMilli())
+	default:
+		from, to, err := rng.resolve()
+		if err != nil {
+			return fmt.Errorf("%w (or -live, -tail)", err)
+		}
+		feed = NewReplayFeed(*dataDir, from, to, *speed)
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+
+	deriver := orderbook.NewTickDeriver()
+	return consumeFeed(ctx, feed, splitList(*symbolList), func(ev *orderbook.Event) error {
+		t := deriver.Next(ev).GetTick()
+		if t == nil {
+			return nil
+		}
+		fmt.Printf("%s %-10s %.8g x %.8g | %.8g x %.8g\n", formatMillis(ev.EventTime), ev.Symbol, t.BidQuantity, t.BidPrice, t.AskPrice, t.AskQuantity)
+		return nil
+	})
+}
+
+// symbols 를 한 채널로 구독하고 feed 를 돌리며 이벤트를 피드 순서대로 fn 에 넘긴다.
+// 재생은 구간 끝, 라이브는 ctx 취소로 끝나며 둘 다 nil 을 돌려준다. fn 이 오류를 내면 feed 를 멈추고 그 오류를 돌려준다.
+func consumeFeed(ctx context.Context, feed Feed, symbols []string, fn func(ev *orderbook.Event) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	events := feed.Subscribe(symbols...)
+	errc := make(chan error, 1)
+	go func() { errc <- feed.Run(ctx) }()
+
+	var fnErr error
+	for ev := range events {
+		if fnErr != nil {
+			continue // Run 이 채널을 닫을 때까지 비운다
+		}
+		if fnErr = fn(ev); fnErr != nil {
+			cancel()
+		}
+	}
+	err := <-errc
+	if fnErr != nil {
+		return fnErr
+	}
+	if err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// flock 이 없는 플랫폼에서는 파일만 열고 잠긴 것으로 본다. 중복 실행은 임대 파일의 heartbeat 로만 막는다
+func lockFile(path string) (f *os.File, ok bool, err error) {
+	f, err = os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, false, err
+	}
+	return f, true, nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// 데이터 디렉터리를 읽기 전용 HTTP 로 공개한다. 공유 파일시스템 없이도 원격 리더가
+// Range 요청으로 파일의 필요한 부분만 가져갈 수 있다.
+//
+//	GET /catalog          파일 목록 (JSON). ?symbol= 로 거르고, ?convention=kst 처럼 날짜 기준을 주면
+//	                      항목마다 그 기준의 날짜(days)를 붙인다. ?day= 는 그 날에 걸치는 파일만 남긴다.
+//	                      ?view=consolidated 면 심볼, 날짜별로 묶어 어느 인스턴스가 기록했는지 보여 준다
+//	GET /files/<path>     파일 내용. Range, If-Modified-Since 지원
+
+func runServeFiles(args []string) error {
+	fs := flag.NewFlagSet("serve-files", flag.ExitOnError)
+	addr := fs.String("addr", ":8081", "listen address")
+	dataDir := fs.String("data", defaultDataDir, "data directory to serve")
+	token := fs.String("token", os.Getenv("ORDERBOOK_HTTP_TOKEN"), "require this bearer token (default $ORDERBOOK_HTTP_TOKEN; empty disables auth)")
+	fs.Parse(args)
+
+	root, err := os.OpenRoot(*dataDir)
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+
+	srv := &fileServer{dataDir: *dataDir, root: root}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /catalog", srv.handleCatalog)
+	mux.HandleFunc("GET /files/{path...}", srv.handleFile)
+
+	var handler http.Handler = mux
+	if *token != "" {
+		handler = requireToken(*token, handler)
+	} else {
+		log.Printf("Warning: serving %s without authentication", *dataDir)
+	}
+
+	log.Printf("Serving %s on %s", *dataDir, *addr)
+	return http.ListenAndServe(*addr, handler)
+}
+
+type fileServer struct {
+	dataDir string
+	root    *os.Root // 경로가 dataDir 밖으로 나가지 못하게 막는다
+}
+
+func (s *fileServer) handleCatalog(w http.ResponseWriter, r *http.Request) {
+	conv, err := parseDayConvention(r.URL.Query().Get("convention"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	entries, err := listDataFiles(s.dataDir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if r.URL.Query().Has("convention") || r.URL.Query().Has("day") {
+		annotateDays(entries, conv)
+	}
+	if day := r.URL.Query().Get("day"); day != "" {
+		filtered := entries[:0]
+		for _, e := range entries {
+			if slices.Contains(e.Days, day) {
+				filtered = append(filtered, e)
+			}
+		}
+		entries = filtered
+	}
+	if symbol := strings.ToLower(r.URL.Query().Get("symbol")); symbol != "" {
+		filtered := entries[:0]
+		for _, e := range entries {
+			if e.Symbol == symbol {
+				filtered = append(filtered, e)
+			}
+		}
+		entries = filtered
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if r.URL.Query().Get("view") == "consolidated" {
+		json.NewEncoder(w).Encode(map[string]any{"days": consolidate(entries)})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{"files": entries})
+}
+
+func (s *fileServer) handleFile(w http.ResponseWriter, r *http.Request) {
+	f, err := s.root.Open(r.PathValue("path"))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			http.NotFound(w, r)
+		} else {
+			http.Error(w, "forbidden", http.StatusForbidden)
+		}
+		return
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil || !fi.Mode().IsRegular() {
+		http.NotFound(w, r)
+		return
+	}
+	// 수집 중인 파일은 계속 커지므로 크기까지 넣어 캐시가 오래된 내용을 돌려주지 않게 한다
+	w.Header().Set("ETag", `"`+fi.ModTime().UTC().Format("20060102T150405.000000000")+"-"+strconv.FormatInt(fi.Size(), 10)+`"`)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(w, r, fi.Name(), fi.ModTime(), f)
+}
+
+func requireToken(token string, next http.Handler) http.Handler {
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(r.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(got, want) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+
+	"orderbook/orderbook"
+)
+
+// orderbook fill : 기록된 책에 시장가 주문을 넣었다면 어떻게 체결되었을지 계산한다 (orderbook.Book.SimulateFill).
+//
+//	fill -symbol ETHUSDT -side buy -qty 25 -at 2026-04-13T15:13:06Z        그 시각 한 번 (텍스트)
+//	fill -symbol ETHUSDT -side sell -qty 25 -day 2026-04-13 -every 1m      구간을 훑어 CSV 로
+//
+// 책은 -at 이하 마지막 스냅샷에 그 뒤 증분을 적용해 재구성한다 (serve-api 의 /v1/book 과 같다).
+// depth20 처럼 상위 호가만 기록했으면 그 너머는 모르므로, 다 채우지 못한 주문은 complete=false 로 나온다.
+
+func runFill(args []string) error {
+	fs := flag.NewFlagSet("fill", flag.ExitOnError)
+	symbol := fs.String("symbol", "ETHUSDT", "symbol")
+	side := fs.String("side", "buy", "order side: buy walks the asks, sell walks the bids")
+	qty := fs.Float64("qty", 0, "order size in base asset units")
+	at := fs.String("at", "", "simulate once at this time")
+	every := fs.String("every", "1m", "with -from/-to or -day, simulate at this interval")
+	dataDir := fs.String("data", defaultDataDir, "data directory")
+	var rng rangeFlags
+	rng.register(fs)
+	fs.Parse(args)
+
+	var buy bool
+	switch *side {
+	case "buy":
+		buy = true
+	case "sell":
+	default:
+		return fmt.Errorf("unknown side %q (buy or sell)", *side)
+	}
+	if *qty <= 0 {
+		return errors.New("-qty must be positive")
+	}
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	if *at != "" {
+		t, err := parseTime(*at)
+		if err != nil {
+			return err
+		}
+		res, err := reconstructBook(ctx, *dataDir, *symbol, t)
+		if errors.Is(err, errNoSnapshot) {
+			return fmt.Errorf("no snapshot of %s at or before %s", *symbol, formatMillis(t))
+		} else if err != nil {
+			return err
+		}
+		if res.Gap {
+			log.Printf("Warning: depth updates have a gap after %s; the book is as of then", formatMillis(res.UpdateTime))
+		}
+		printFill(*symbol, *side, t, res, res.Book.SimulateFill(buy, *qty))
+		return nil
+	}
+
+	from, to, err := rng.resolve()
+	if err != nil {
+		return fmt.Errorf("%w (or -at)", err)
+	}
+	step, err := parseDuration(*every)
+	if err != nil || step <= 0 {
+		return fmt.Errorf("invalid -every %q", *every)
+	}
+	return sweepFills(ctx, os.Stdout, *dataDir, *symbol, buy, *qty, from, to, step.Milliseconds())
+}
+
+func printFill(symbol, side string, at int64, res *bookAt, f orderbook.Fill) {
+	fmt.Printf("%s %s %g at %s (book as of %s, %d diffs after the snapshot)\n",
+		symbol, side, f.Requested, formatMillis(at), formatMillis(res.UpdateTime), res.Diffs)
+	fmt.Printf("  filled       %g", f.Filled)
+	if !f.Complete {
+		fmt.Printf(" of %g (the recorded book ran out)", f.Requested)
+	}
+	fmt.Println()
+	if f.Filled == 0 {
+		return
+	}
+	fmt.Printf("  best price   %.8g\n", f.BestPrice)
+	fmt.Printf("  avg price    %.8g\n", f.AvgPrice)
+	fmt.Printf("  last price   %.8g\n", f.LastPrice)
+	fmt.Printf("  notional     %.8g\n", f.Notional)
+	fmt.Printf("  slippage     %.2f bps\n", f.SlippageBps)
+	fmt.Printf("  levels       %d\n", f.Levels)
+}
+
+// [from, to) 를 step 간격으로 훑는다. 책은 한 번 재구성한 뒤 구간을 읽으며 이어서 갱신하므로
+// 시각마다 처음부터 다시 찾지 않는다. 책을 알 수 없는 시각(첫 스냅샷 전, 증분 공백 뒤)은 건너뛴다.
+func sweepFills(ctx context.Context, out io.Writer, dataDir, symbol string, buy bool, qty float64, from, to, step int64) error {
+	w := csv.NewWriter(out)
+	w.Write([]string{"time", "best_price", "avg_price", "last_price", "slippage_bps", "levels", "filled", "complete", "book_time"})
+
+	var (
+		book     *orderbook.Book
+		bookTime int64
+		next     = from
+		rows     int
+		skipped  int
+	)
+	res, err := reconstructBook(ctx, dataDir, symbol, from)
+	switch {
+	case err == nil && !res.Gap:
+		book, bookTime = res.Book, res.UpdateTime
+	case err != nil && !errors.Is(err, errNoSnapshot):
+		return err
+	}
+
+	emit := func(until int64) {
+		for ; next < until && next < to; next += step {
+			if book == nil {
+				skipped++
+				continue
+			}
+			f := book.SimulateFill(buy, qty)
+			w.Write([]string{
+				formatMillis(next),
+				strconv.FormatFloat(f.BestPrice, 'f', -1, 64),
+				strconv.FormatFloat(f.AvgPrice, 'f', -1, 64),
+				strconv.FormatFloat(f.LastPrice, 'f', -1, 64),
+				strconv.FormatFloat(f.SlippageBps, 'f', 4, 64),
+				strconv.Itoa(f.Levels),
+				strconv.FormatFloat(f.Filled, 'f', -1, 64),
+				strconv.FormatBool(f.Complete),
+				formatMillis(bookTime),
+			})
+			rows++
+		}
+	}
+
+	// from 시각까지는 reconstructBook 이 반영했다
+	emit(from + 1)
+	for _, f := range dataFilesInRange(dataDir, symbol, from+1, to) {
+		err := scanFile(ctx, f.path, from+1, to, nil, func(r *orderbook.Reader, ev *orderbook.Event) error {
+			emit(ev.EventTime)
+			switch pl := ev.Payload.(type) {
+			case *orderbook.Event_Snapshot:
+				if book == nil {
+					book = orderbook.NewBook()
+				}
+				book.LoadSnapshot(pl.Snapshot)
+				bookTime = ev.EventTime
+			case *orderbook.Event_DepthDiff:
+				if book == nil {
+					return nil
+				}
+				if applied, err := book.ApplyDiff(pl.DepthDiff); err != nil {
+					book = nil // 다음 스냅샷까지 책을 모른다
+				} else if applied {
+					bookTime = ev.EventTime
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	emit(to)
+	w.Flush()
+	if skipped > 0 {
+		log.Printf("%d of %d sample times skipped: no book (before the first snapshot or after a depth update gap)", skipped, rows+skipped)
+	}
+	return w.Error()
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"orderbook/orderbook"
+)
+
+// orderbook gaps : 구간 안에서 스냅샷이 -min-gap 보다 오래 없었던 구간(재연결, 장애)을 JSON 으로 보고한다.
+// 배치 파이프라인이 결과를 보고 그 날짜를 쓸지 정하도록 기계가 읽기 쉬운 형태로 내고,
+// -fail 이면 빈 구간이 하나라도 있을 때 종료 코드 1 로 끝난다.
+//
+//	leading   구간 시작부터 첫 스냅샷까지
+//	between   두 스냅샷 사이
+//	trailing  마지막 스냅샷부터 구간 끝(지금보다 뒤면 지금)까지
+//	missing   구간 안에 스냅샷이 하나도 없다
+//
+// 파일이 없는 날은 앞뒤 스냅샷 사이의 빈 구간으로 잡힌다. 여러 인스턴스가 같은 날을 기록했으면 파일 이름 순으로
+// 읽으며 지금까지 본 가장 늦은 스냅샷에서 간격을 재므로, 뒤 인스턴스가 메운 앞 인스턴스의 끊김도 보고될 수 있다.
+
+type gapReport struct {
+	From     int64         `json:"from"`
+	To       int64         `json:"to"`
+	MinGapMs int64         `json:"minGapMs"`
+	GapCount int           `json:"gapCount"`
+	Symbols  []*symbolGaps `json:"symbols"`
+}
+
+type symbolGaps struct {
+	Symbol        string     `json:"symbol"`
+	Files         int        `json:"files"`
+	Snapshots     int64      `json:"snapshots"`
+	FirstSnapshot int64      `json:"firstSnapshot,omitempty"`
+	LastSnapshot  int64      `json:"lastSnapshot,omitempty"`
+	TotalGapMs    int64      `json:"totalGapMs"`
+	Gaps          []gapEntry `json:"gaps"`
+}
+
+type gapEntry struct {
+	Kind       string `json:"kind"`
+	Start      int64  `json:"start"`
+	End        int64  `json:"end"`
+	DurationMs int64  `json:"durationMs"`
+	StartTime  string `json:"startTime"`
+	EndTime    string `json:"endTime"`
+}
+
+func (s *symbolGaps) add(kind string, start, end, minGap int64) {
+	if end-start <= minGap {
+		return
+	}
+	s.Gaps = append(s.Gaps, gapEntry{
+		Kind:       kind,
+		Start:      start,
+		End:        end,
+		DurationMs: end - start,
+		StartTime:  formatMillis(start),
+		EndTime:    formatMillis(end),
+	})
+	s.TotalGapMs += end - start
+}
+
+func runGaps(args []string) error {
+	fs := flag.NewFlagSet("gaps", flag.ExitOnError)
+	symbolList := fs.String("symbol", "", "symbol, or comma-separated symbols")
+	var rng rangeFlags
+	rng.register(fs)
+	minGap := fs.Duration("min-gap", 5*time.Second, "report intervals without snapshots longer than this")
+	fail := fs.Bool("fail", false, "exit with status 1 if any gap is found")
+	dataDir := fs.String("data", defaultDataDir, "data directory")
+	noProgress := fs.Bool("no-progress", false, "disable the progress bar")
+	fs.Parse(args)
+
+	symbols := splitList(*symbolList)
+	if len(symbols) == 0 {
+		return fmt.Errorf("-symbol is required")
+	}
+	if *minGap <= 0 {
+		return fmt.Errorf("-min-gap must be positive")
+	}
+	from, to, err := rng.resolve()
+	if err != nil {
+		return err
+	}
+	// 아직 오지 않은 시간은 빈 구간이 아니다
+	end := min(to, time.Now().UnixMilli())
+
+	var (
+		files []dataFile
+		size  int64
+	)
+	for _, symbol := range symbols {
+		for _, f := range dataFilesInRange(*dataDir, symbol, from, to) {
+			files = append(files, f)
+			size += f.size
+		}
+	}
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+	progress := NewProgress("gaps", size, !*noProgress)
+	report := &gapReport{From: from, To: to, MinGapMs: minGap.Milliseconds()}
+	threshold := report.MinGapMs
+	for _, symbol := range symbols {
+		s, err := scanGaps(ctx, files, symbol, from, end, threshold, progress)
+		if err != nil {
+			return err
+		}
+		report.GapCount += len(s.Gaps)
+		report.Symbols = append(report.Symbols, s)
+	}
+	progress.Finish()
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	log.Printf("Found %d gap(s) longer than %s in %s", report.GapCount, *minGap, rng.String())
+	if *fail && report.GapCount > 0 {
+		return errors.New("gaps found")
+	}
+	return nil
+}
+
+// files 중 symbol 의 파일에서 [from, end) 의 스냅샷 사이 빈 구간을 찾는다. threshold(ms) 이하의 간격은 빈 구간이 아니다.
+func scanGaps(ctx context.Context, files []dataFile, symbol string, from, end, threshold int64, progress *Progress) (*symbolGaps, error) {
+	s := &symbolGaps{Symbol: strings.ToUpper(symbol), Gaps: []gapEntry{}}
+	last := int64(0)
+	for _, f := range files {
+		if !strings.EqualFold(fileSymbol(f.path), symbol) {
+			continue
+		}
+		s.Files++
+		err := scanFile(ctx, f.path, from, end, progress, func(r *orderbook.Reader, ev *orderbook.Event) error {
+			if ev.GetSnapshot() == nil {
+				return nil
+			}
+			if s.Snapshots == 0 {
+				s.FirstSnapshot = ev.EventTime
+				s.add("leading", from, ev.EventTime, threshold)
+			} else {
+				s.add("between", last, ev.EventTime, threshold)
+			}
+			s.Snapshots++
+			last = max(last, ev.EventTime)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if s.Snapshots == 0 {
+		s.add("missing", from, end, threshold)
+	} else {
+		s.LastSnapshot = last
+		s.add("trailing", last, end, threshold)
+	}
+	return s, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"expvar"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"runtime/debug"
+)
+
+// 수집기의 GC/메모리 프로필. 메시지마다 할당이 생기므로 GC 빈도가 곧 쓰기 지연의 꼬리(p99)를 정한다.
+//
+//	default   Go 기본값 (GOGC=100, 메모리 한도 없음)
+//	latency   GOGC=400, 메모리 한도 2GB. GC 를 드물게 돌려 멈춤 횟수를 줄인다. 한도에 가까워지면 다시 잦아진다
+//	lowmem    GOGC=50, 메모리 한도 256MB. 작은 VM 용
+//
+// -gogc, -memory-limit, -ballast 로 프로필 값을 덮어쓸 수 있다. GOGC, GOMEMLIMIT 환경 변수가 있으면
+// 런타임이 이미 그 값을 쓰고 있으므로 프로필은 그 항목을 건드리지 않는다.
+// ballast 는 메모리 한도를 쓸 수 없는 환경을 위한 예전 방식이다. 힙 목표를 키워 GC 를 늦춘다.
+
+type gcProfile struct {
+	GOGC        int
+	MemoryLimit string
+	Ballast     string
+}
+
+var gcProfiles = map[string]gcProfile{
+	"default": {},
+	"latency": {GOGC: 400, MemoryLimit: "2GB"},
+	"lowmem":  {GOGC: 50, MemoryLimit: "256MB"},
+}
+
+type gcOptions struct {
+	profile     string
+	gogc        int
+	memoryLimit string
+	ballast     string
+}
+
+func (o *gcOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.profile, "gc-profile", "default", "runtime GC profile: default, latency or lowmem")
+	fs.IntVar(&o.gogc, "gogc", 0, "override the profile's GOGC percentage; 0 keeps the profile value")
+	fs.StringVar(&o.memoryLimit, "memory-limit", "", "override the profile's soft memory limit (e.g. 1GB)")
+	fs.StringVar(&o.ballast, "ballast", "", "allocate an unused heap ballast of this size to delay GC (e.g. 256MB)")
+}
+
+// 프로세스가 끝날 때까지 살아 있어야 힙 목표에 반영된다
+var gcBallast []byte
+
+func (o *gcOptions) apply() error {
+	p, ok := gcProfiles[o.profile]
+	if !ok {
+		return fmt.Errorf("unknown gc profile %q (use default, latency or lowmem)", o.profile)
+	}
+	if o.gogc != 0 {
+		p.GOGC = o.gogc
+	}
+	if o.memoryLimit != "" {
+		p.MemoryLimit = o.memoryLimit
+	}
+	if o.ballast != "" {
+		p.Ballast = o.ballast
+	}
+
+	if p.GOGC != 0 && os.Getenv("GOGC") == "" {
+		debug.SetGCPercent(p.GOGC)
+	}
+	if p.MemoryLimit != "" && os.Getenv("GOMEMLIMIT") == "" {
+		limit, err := parseBytes(p.MemoryLimit)
+		if err != nil {
+			return err
+		}
+		debug.SetMemoryLimit(limit)
+	}
+	if p.Ballast != "" {
+		n, err := parseBytes(p.Ballast)
+		if err != nil {
+			return err
+		}
+		gcBallast = make([]byte, n)
+	}
+
+	// 실제 적용된 값 (환경 변수가 이긴 경우 포함)
+	gogc := debug.SetGCPercent(-1)
+	debug.SetGCPercent(gogc)
+	limit := debug.SetMemoryLimit(-1)
+	limitText := "none"
+	if limit < 1<<62 {
+		limitText = formatBytes(limit)
+	}
+	log.Printf("GC profile %s: GOGC=%d, memory limit %s, ballast %s", o.profile, gogc, limitText, formatBytes(int64(len(gcBallast))))
+	expvar.Publish("gc_profile", expvar.Func(func() any {
+		return map[string]any{"profile": o.profile, "gogc": gogc, "memoryLimit": limit, "ballast": len(gcBallast)}
+	}))
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"orderbook/orderbook"
+)
+
+// 다른 호스트의 수집기(collect -grpc)에서 StreamLive 로 이벤트를 받는 Feed. 수집기가 이미 순번을 매긴 이벤트를 그대로 넘긴다.
+// since 를 주면 수집기 캐시의 그 시각 이후 이벤트부터 받는다 (캐시가 없는 수집기면 라이브만).
+// 끊기면 5초 뒤 다시 붙고, 그동안 놓친 이벤트는 마지막으로 받은 시각부터 캐시에서 다시 받는다. 같은 이벤트는 순번으로 거른다.
+type GRPCFeed struct {
+	feedSubs
+	addr  string
+	token string
+	since int64
+}
+
+func NewGRPCFeed(addr, token string, since int64) *GRPCFeed {
+	return &GRPCFeed{addr: addr, token: token, since: since}
+}
+
+// ctx 가 취소될 때까지 돈다
+func (f *GRPCFeed) Run(ctx context.Context) error {
+	defer f.closeAll()
+	symbols := f.symbols()
+	if len(symbols) == 0 {
+		return errors.New("feed: no subscriptions")
+	}
+	conn, err := grpc.NewClient(f.addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	client := orderbook.NewOrderBookServiceClient(conn)
+	if f.token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+f.token)
+	}
+
+	since, last := f.since, make(map[string]feedPosition)
+	backfill := true
+	for {
+		err := f.stream(ctx, client, symbols, since, last)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		switch status.Code(err) {
+		case codes.FailedPrecondition:
+			since, backfill = 0, false // 캐시가 없는 수집기. 백필 없이 라이브만 받는다
+			log.Printf("Feed %s: %v; continuing without backfill", f.addr, err)
+			continue
+		case codes.Unauthenticated, codes.PermissionDenied, codes.Unimplemented:
+			return err
+		}
+		log.Printf("Feed %s disconnected (%v). Reconnecting in 5 seconds...", f.addr, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(5 * time.Second):
+		}
+		for _, p := range last {
+			if backfill {
+				since = max(since, p.time)
+			}
+		}
+	}
+}
+
+// 심볼별로 마지막으로 넘긴 이벤트
+type feedPosition struct {
+	sequence uint64
+	time     int64
+}
+
+// 다시 붙어 받은 백필에서 last 까지 이미 넘긴 이벤트를 거른다. 수집기가 다시 시작하면 순번이 1 부터이므로 시각도 본다.
+func (f *GRPCFeed) stream(ctx context.Context, client orderbook.OrderBookServiceClient, symbols []string, since int64, last map[string]feedPosition) error {
+	stream, err := client.StreamLive(ctx, &orderbook.StreamLiveRequest{Symbols: symbols, Since: since})
+	if err != nil {
+		return err
+	}
+	for {
+		ev, err := stream.Recv()
+		if err == io.EOF {
+			return errors.New("stream closed by the collector")
+		}
+		if err != nil {
+			return err
+		}
+		if p, ok := last[ev.Symbol]; ok && ev.Sequence <= p.sequence && ev.EventTime <= p.time {
+			continue
+		}
+		last[ev.Symbol] = feedPosition{ev.Sequence, ev.EventTime}
+		if err := f.deliver(ctx, ev); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"flag"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"orderbook/orderbook"
+)
+
+// 다른 서비스가 gRPC 로 이 수집기를 구독한다 (orderbook_service.proto).
+//
+//	collect -grpc :9090      라이브(StreamLive)와 기록된 데이터(StreamHistorical)
+//	serve-grpc -addr :9090   기록된 데이터만 (StreamLive 는 UNAVAILABLE)
+//
+// 토큰(-grpc-token, -token)을 주면 authorization: Bearer <token> 메타데이터를 요구한다.
+// StreamLive 의 since 백필은 심볼별로 캐시를 다 보낸 뒤 라이브로 넘어가며, 같은 이벤트는 순번으로 걸러 한 번만 보낸다.
+
+// 구독자 하나가 밀려 있을 수 있는 이벤트 수. 넘으면 끊는다.
+const liveSubscriberBuffer = 4096
+
+// 수집 루프의 이벤트를 StreamLive 구독자들에게 나눠 준다
+type liveHub struct {
+	cache *liveCache // since 백필용. nil 이면 캐시가 꺼져 있다
+
+	mu   sync.Mutex
+	subs map[*liveSubscriber]struct{}
+}
+
+type liveSubscriber struct {
+	symbols map[string]bool // 비어 있으면 전부
+	events  chan *orderbook.Event
+	lagged  chan struct{} // 버퍼가 차서 끊을 때 닫는다
+}
+
+func newLiveHub(cache *liveCache) *liveHub {
+	return &liveHub{cache: cache, subs: make(map[*liveSubscriber]struct{})}
+}
+
+// 수집 루프에서 부른다. 느린 구독자를 기다리지 않고 끊는다. h 가 nil 이면 아무것도 하지 않는다.
+func (h *liveHub) publish(ev *orderbook.Event) {
+	if h == nil {
+		return
+	}
+	symbol := strings.ToLower(ev.Symbol)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.subs {
+		if len(s.symbols) > 0 && !s.symbols[symbol] {
+			continue
+		}
+		select {
+		case s.events <- ev:
+		default:
+			close(s.lagged)
+			delete(h.subs, s)
+		}
+	}
+}
+
+func (h *liveHub) subscribe(symbols []string) *liveSubscriber {
+	s := &liveSubscriber{
+		symbols: make(map[string]bool),
+		events:  make(chan *orderbook.Event, liveSubscriberBuffer),
+		lagged:  make(chan struct{}),
+	}
+	for _, sym := range symbols {
+		s.symbols[strings.ToLower(sym)] = true
+	}
+	h.mu.Lock()
+	h.subs[s] = struct{}{}
+	h.mu.Unlock()
+	return s
+}
+
+func (h *liveHub) unsubscribe(s *liveSubscriber) {
+	h.mu.Lock()
+	delete(h.subs, s)
+	h.mu.Unlock()
+}
+
+// StreamHistorical 한 번에 재생할 수 있는 구간 길이 (serve-grpc -max-range 의 기본값)
+const defaultGRPCMaxRange = 7 * 24 * time.Hour
+
+type grpcServer struct {
+	orderbook.UnimplementedOrderBookServiceServer
+	dataDir  string
+	live     *liveHub // nil 이면 StreamLive 를 지원하지 않는다
+	maxRange time.Duration
+}
+
+func (s *grpcServer) StreamLive(req *orderbook.StreamLiveRequest, stream grpc.ServerStreamingServer[orderbook.Event]) error {
+	if s.live == nil {
+		return status.Error(codes.Unavailable, "no live feed here; subscribe to a collector started with -grpc")
+	}
+	if req.Since != 0 && s.live.cache == nil {
+		return status.Error(codes.FailedPrecondition, "the collector runs without an event cache; since is not available")
+	}
+	// 구독을 먼저 걸어야 백필과 라이브 사이에 빠지는 이벤트가 없다
+	sub := s.live.subscribe(req.Symbols)
+	defer s.live.unsubscribe(sub)
+
+	sent := make(map[string]uint64) // 심볼별로 백필에서 보낸 마지막 순번
+	if req.Since != 0 {
+		backfill := req.Symbols
+		if len(backfill) == 0 {
+			backfill = symbols
+		}
+		for _, symbol := range backfill {
+			for _, ev := range s.live.cache.Since(symbol, req.Since) {
+				if err := stream.Send(ev); err != nil {
+					return err
+				}
+				sent[strings.ToLower(ev.Symbol)] = ev.Sequence
+			}
+		}
+	}
+
+	ctx := stream.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-sub.lagged:
+			return status.Error(codes.ResourceExhausted, "subscriber fell behind the live stream")
+		case ev := <-sub.events:
+			if last, ok := sent[strings.ToLower(ev.Symbol)]; ok && ev.Sequence <= last {
+				continue
+			}
+			if err := stream.Send(ev); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *grpcServer) StreamHistorical(req *orderbook.StreamHistoricalRequest, stream grpc.ServerStreamingServer[orderbook.Event]) error {
+	switch {
+	case req.Symbol == "":
+		return status.Error(codes.InvalidArgument, "symbol is required")
+	case req.To <= req.From:
+		return status.Error(codes.InvalidArgument, "to must be after from")
+	case req.Speed < 0:
+		return status.Error(codes.InvalidArgument, "speed must not be negative")
+	case req.To-req.From > s.maxRange.Milliseconds():
+		return status.Errorf(codes.InvalidArgument, "range exceeds the %s limit; split the request", s.maxRange)
+	}
+	q := &rangeQuery{DataDir: s.dataDir, Symbol: strings.ToLower(req.Symbol), From: req.From, To: req.To}
+	if len(dataFilesInRange(q.DataDir, q.Symbol, q.From, q.To)) == 0 {
+		return status.Errorf(codes.NotFound, "no data for %s in the requested range", q.Symbol)
+	}
+
+	ctx := stream.Context()
+	pacer := newPacer(req.Speed)
+	_, err := q.run(ctx, func(ev *orderbook.Event) error {
+		if err := pacer.wait(ctx, ev.EventTime); err != nil {
+			return err
+		}
+		return stream.Send(ev)
+	})
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return status.FromContextError(err).Err()
+	}
+	return err
+}
+
+// authorization 메타데이터가 Bearer token 과 같은 스트림만 통과시킨다
+func grpcTokenInterceptor(token string) grpc.StreamServerInterceptor {
+	want := []byte("Bearer " + token)
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		md, _ := metadata.FromIncomingContext(ss.Context())
+		var got []byte
+		if v := md.Get("authorization"); len(v) > 0 {
+			got = []byte(v[0])
+		}
+		if subtle.ConstantTimeCompare(got, want) != 1 {
+			return status.Error(codes.Unauthenticated, "unauthorized")
+		}
+		return handler(srv, ss)
+	}
+}
+
+func newGRPCServer(dataDir string, live *liveHub, token string, maxRange time.Duration) *grpc.Server {
+	var opts []grpc.ServerOption
+	if token != "" {
+		opts = append(opts, grpc.StreamInterceptor(grpcTokenInterceptor(token)))
+	} else {
+		log.Printf("Warning: serving gRPC without authentication")
+	}
+	srv := grpc.NewServer(opts...)
+	orderbook.RegisterOrderBookServiceServer(srv, &grpcServer{dataDir: dataDir, live: live, maxRange: maxRange})
+	return srv
+}
+
+// 수집기 안에서 띄운다. 주소를 열지 못하면 수집을 시작하기 전에 오류를 돌려준다.
+func startGRPCServer(addr, dataDir string, live *liveHub, token string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	srv := newGRPCServer(dataDir, live, token, defaultGRPCMaxRange)
+	go func() {
+		log.Printf("gRPC server on %s", lis.Addr())
+		if err := srv.Serve(lis); err != nil {
+			log.Printf("gRPC server stopped: %v", err)
+		}
+	}()
+	return nil
+}
+
+// orderbook serve-grpc : 수집기 없이 기록된 데이터만 gRPC 로 (StreamHistorical)
+func runServeGRPC(args []string) error {
+	fs := flag.NewFlagSet("serve-grpc", flag.ExitOnError)
+	addr := fs.String("addr", ":9090", "listen address")
+	dataDir := fs.String("data", defaultDataDir, "data directory")
+	token := fs.String("token", os.Getenv("ORDERBOOK_GRPC_TOKEN"), "require this bearer token (default $ORDERBOOK_GRPC_TOKEN; empty disables auth)")
+	maxRange := fs.String("max-range", "7d", "longest from..to span a single StreamHistorical call may cover")
+	fs.Parse(args)
+
+	mr, err := parseDuration(*maxRange)
+	if err != nil {
+		return err
+	}
+
+	lis, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("gRPC historical service for %s on %s", *dataDir, lis.Addr())
+	return newGRPCServer(*dataDir, nil, *token, mr).Serve(lis)
+}
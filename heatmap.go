@@ -0,0 +1,499 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"log"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"orderbook/orderbook"
+)
+
+// orderbook heatmap : 구간 동안 호가에 쉬고 있던 수량을 가격 × 시간 격자에 모아 내보낸다 (이벤트 전후 유동성 보기).
+//
+//	heatmap -symbol ETHUSDT -around 2026-04-13T15:13:06Z -window 5m -format png -out eth.png
+//	heatmap -symbol ETHUSDT -day 2026-04-13 -interval 1m -band 100 -format npz -out eth.npz
+//
+// 칸 값은 시간 칸 동안 그 가격 칸에 있던 수량의 시간 가중 평균이다. 책은 fill 처럼 구간 시작 시점으로 재구성한 뒤
+// 스냅샷과 증분으로 갱신하고, 책을 모르는 시간(첫 스냅샷 전, 증분 공백 뒤)은 평균에서 뺀다. 시간 칸 전체를 모르면 NaN.
+// 가격 축은 -price-min, -price-max 로 주거나, 없으면 처음 알게 된 책의 중간가 ± -band bps 다. 축 밖의 호가는 버린다.
+//
+//	csv  행마다 bin_time (UTC ms), mid, 그리고 가격 칸(열 이름은 칸의 하한)마다 매수 + 매도 수량. NaN 은 빈 칸
+//	npz  numpy.load 로 읽는다: bid, ask (시간 × 가격), time (UTC ms), price (칸의 하한), mid
+//	png  가로가 시간, 세로가 가격 (위가 높은 가격). 매수는 초록, 매도는 빨강, 밝기는 수량의 log. 중간가는 흰 점, 책을 모르는 칸은 회색
+//
+// mid 는 시간 칸이 끝날 때의 중간가다.
+
+const maxHeatmapCells = 50_000_000
+
+func runHeatmap(args []string) error {
+	fs := flag.NewFlagSet("heatmap", flag.ExitOnError)
+	symbol := fs.String("symbol", "", "symbol")
+	var rng rangeFlags
+	rng.register(fs)
+	around := fs.String("around", "", "center the window on this time instead of -from/-to or -day")
+	window := fs.String("window", "5m", "with -around, how far to look before and after")
+	interval := fs.String("interval", "1s", "time bin length (e.g. 100ms, 1s, 1m)")
+	rows := fs.Int("rows", 200, "number of price bins")
+	band := fs.Float64("band", 50, "without -price-min/-price-max, cover the first mid ± this many bps")
+	priceMin := fs.Float64("price-min", 0, "lowest price on the price axis")
+	priceMax := fs.Float64("price-max", 0, "highest price on the price axis")
+	format := fs.String("format", "csv", "output format: csv, npz or png")
+	outPath := fs.String("out", "", "output file (required for npz and png; csv defaults to stdout)")
+	scale := fs.Int("scale", 1, "png: pixels per cell")
+	dataDir := fs.String("data", defaultDataDir, "data directory")
+	noProgress := fs.Bool("no-progress", false, "disable the progress bar")
+	fs.Parse(args)
+
+	if *symbol == "" {
+		return fmt.Errorf("-symbol is required")
+	}
+	var from, to int64
+	if *around != "" {
+		at, err := parseTime(*around)
+		if err != nil {
+			return err
+		}
+		w, err := parseDuration(*window)
+		if err != nil || w <= 0 {
+			return fmt.Errorf("invalid -window %q", *window)
+		}
+		from, to = at-w.Milliseconds(), at+w.Milliseconds()
+	} else {
+		var err error
+		if from, to, err = rng.resolve(); err != nil {
+			return fmt.Errorf("%w (or -around)", err)
+		}
+	}
+	step, err := parseDuration(*interval)
+	if err != nil || step < time.Millisecond {
+		return fmt.Errorf("invalid -interval %q", *interval)
+	}
+	if *rows <= 0 || *band <= 0 || *scale <= 0 {
+		return fmt.Errorf("-rows, -band and -scale must be positive")
+	}
+	if (*priceMin != 0 || *priceMax != 0) && *priceMax <= *priceMin {
+		return fmt.Errorf("-price-max must be above -price-min")
+	}
+	switch *format {
+	case "csv":
+	case "npz", "png":
+		if *outPath == "" {
+			return fmt.Errorf("-format %s needs -out", *format)
+		}
+	default:
+		return fmt.Errorf("unknown format %q (use csv, npz or png)", *format)
+	}
+	cols := int((to - from + step.Milliseconds() - 1) / step.Milliseconds())
+	if cols*(*rows) > maxHeatmapCells {
+		return fmt.Errorf("%d x %d cells is too many; use a longer -interval or fewer -rows", cols, *rows)
+	}
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+	h := newHeatmap(from, to, step.Milliseconds(), *rows)
+	h.priceMin, h.priceMax, h.band = *priceMin, *priceMax, *band
+	if err := h.build(ctx, *dataDir, *symbol, !*noProgress); err != nil {
+		return err
+	}
+	if h.price == nil {
+		return fmt.Errorf("no book for %s between %s and %s", *symbol, formatMillis(from), formatMillis(to))
+	}
+	h.finish()
+
+	switch *format {
+	case "csv":
+		var w io.Writer = os.Stdout
+		if *outPath != "" {
+			f, err := os.Create(*outPath)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			w = f
+		}
+		err = h.writeCSV(w)
+	case "npz":
+		err = writeFileAtomic(*outPath, h.writeNPZ)
+	case "png":
+		err = writeFileAtomic(*outPath, func(w io.Writer) error { return h.writePNG(w, *scale) })
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("Wrote a %d x %d heatmap (%s, %.8g..%.8g) for %s", h.cols, h.rows, *interval, h.price[0], h.price[0]+h.tick*float64(h.rows), formatMillis(from))
+	return nil
+}
+
+// 가격 × 시간 격자. 책이 바뀔 때마다 그 전까지 흐른 시간만큼 지금 책의 칸별 수량을 더한다.
+type heatmap struct {
+	from, to, step int64
+	cols, rows     int
+
+	priceMin, priceMax, band float64
+	price                    []float64 // 칸의 하한. 처음 책을 알게 될 때 정한다
+	tick                     float64
+
+	bid, ask []float64 // cols × rows. 수량 × ms 합, finish 뒤에는 평균
+	known    []int64   // 시간 칸마다 책을 알았던 ms
+	mid      []float64
+
+	book       *orderbook.Book
+	curBid     []float64 // 지금 책을 가격 칸에 모은 것
+	curAsk     []float64
+	t          int64 // 여기까지 더했다
+	oldB, oldA map[float64]float64
+}
+
+func newHeatmap(from, to, step int64, rows int) *heatmap {
+	cols := int((to - from + step - 1) / step)
+	mid := make([]float64, cols)
+	for i := range mid {
+		mid[i] = math.NaN()
+	}
+	return &heatmap{
+		from: from, to: to, step: step, cols: cols, rows: rows,
+		bid: make([]float64, cols*rows), ask: make([]float64, cols*rows), known: make([]int64, cols), mid: mid,
+		curBid: make([]float64, rows), curAsk: make([]float64, rows), t: from,
+		oldB: make(map[float64]float64), oldA: make(map[float64]float64),
+	}
+}
+
+// from 의 책에서 시작해 [from, to) 의 스냅샷과 증분을 반영한다
+func (h *heatmap) build(ctx context.Context, dataDir, symbol string, showProgress bool) error {
+	res, err := reconstructBook(ctx, dataDir, symbol, h.from)
+	switch {
+	case err == nil && !res.Gap:
+		h.load(res.Book)
+	case err != nil && !errors.Is(err, errNoSnapshot):
+		return err
+	}
+	files := dataFilesInRange(dataDir, symbol, h.from+1, h.to)
+	var size int64
+	for _, f := range files {
+		size += f.size
+	}
+	progress := NewProgress("heatmap", size, showProgress)
+	for _, f := range files {
+		err := scanFile(ctx, f.path, h.from+1, h.to, progress, func(r *orderbook.Reader, ev *orderbook.Event) error {
+			switch pl := ev.Payload.(type) {
+			case *orderbook.Event_Snapshot:
+				h.advance(ev.EventTime)
+				book := h.book
+				if book == nil {
+					book = orderbook.NewBook()
+				}
+				book.LoadSnapshot(pl.Snapshot)
+				h.load(book)
+			case *orderbook.Event_DepthDiff:
+				if h.book != nil {
+					h.advance(ev.EventTime)
+					h.applyDiff(pl.DepthDiff)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	progress.Finish()
+	return nil
+}
+
+// 책 전체를 다시 칸에 모은다
+func (h *heatmap) load(book *orderbook.Book) {
+	h.book = book
+	if h.price == nil && !h.setAxis() {
+		return
+	}
+	clear(h.curBid)
+	clear(h.curAsk)
+	for p, q := range book.Bids {
+		if r := h.row(p); r >= 0 {
+			h.curBid[r] += q
+		}
+	}
+	for p, q := range book.Asks {
+		if r := h.row(p); r >= 0 {
+			h.curAsk[r] += q
+		}
+	}
+}
+
+// 바뀐 가격의 칸만 고친다. 적용하지 못한 증분이면(공백) 다음 스냅샷까지 책을 모른다.
+func (h *heatmap) applyDiff(d *orderbook.DepthDiff) {
+	clear(h.oldB)
+	clear(h.oldA)
+	for _, l := range d.Bids {
+		h.oldB[l.Price] = h.book.Bids[l.Price]
+	}
+	for _, l := range d.Asks {
+		h.oldA[l.Price] = h.book.Asks[l.Price]
+	}
+	applied, err := h.book.ApplyDiff(d)
+	if err != nil {
+		h.book = nil
+		return
+	}
+	if !applied || h.price == nil {
+		return
+	}
+	for p, old := range h.oldB {
+		if r := h.row(p); r >= 0 {
+			h.curBid[r] += h.book.Bids[p] - old
+		}
+	}
+	for p, old := range h.oldA {
+		if r := h.row(p); r >= 0 {
+			h.curAsk[r] += h.book.Asks[p] - old
+		}
+	}
+}
+
+func (h *heatmap) setAxis() bool {
+	lo, hi := h.priceMin, h.priceMax
+	if hi <= lo {
+		bid, ask, ok := bestPrices(h.book)
+		if !ok {
+			return false
+		}
+		mid := (bid + ask) / 2
+		lo, hi = mid*(1-h.band/1e4), mid*(1+h.band/1e4)
+	}
+	h.tick = (hi - lo) / float64(h.rows)
+	h.price = make([]float64, h.rows)
+	for i := range h.price {
+		h.price[i] = lo + h.tick*float64(i)
+	}
+	return true
+}
+
+func (h *heatmap) row(price float64) int {
+	r := int(math.Floor((price - h.price[0]) / h.tick))
+	if r < 0 || r >= h.rows {
+		return -1
+	}
+	return r
+}
+
+// t 까지 흐른 시간만큼 지금 책을 시간 칸에 더한다
+func (h *heatmap) advance(t int64) {
+	t = min(t, h.to)
+	for h.t < t {
+		col := int((h.t - h.from) / h.step)
+		end := min(t, h.from+int64(col+1)*h.step)
+		if h.book != nil && h.price != nil {
+			dt := float64(end - h.t)
+			cell := col * h.rows
+			for r := range h.rows {
+				h.bid[cell+r] += h.curBid[r] * dt
+				h.ask[cell+r] += h.curAsk[r] * dt
+			}
+			h.known[col] += end - h.t
+			if end == h.from+int64(col+1)*h.step {
+				if bid, ask, ok := bestPrices(h.book); ok {
+					h.mid[col] = (bid + ask) / 2
+				}
+			}
+		}
+		h.t = end
+	}
+}
+
+// 구간 끝까지 채우고 합을 평균으로 바꾼다
+func (h *heatmap) finish() {
+	h.advance(h.to)
+	if col := h.cols - 1; h.book != nil && math.IsNaN(h.mid[col]) { // 구간 끝이 칸 중간이면 위에서 mid 를 적지 않았다
+		if bid, ask, ok := bestPrices(h.book); ok {
+			h.mid[col] = (bid + ask) / 2
+		}
+	}
+	for col, ms := range h.known {
+		cell := h.bid[col*h.rows : (col+1)*h.rows]
+		cellA := h.ask[col*h.rows : (col+1)*h.rows]
+		for r := range cell {
+			if ms == 0 {
+				cell[r], cellA[r] = math.NaN(), math.NaN()
+			} else {
+				cell[r] /= float64(ms)
+				cellA[r] /= float64(ms)
+			}
+		}
+	}
+}
+
+// 최우선 매수, 매도 호가. 정렬하지 않고 한 번 훑는다
+func bestPrices(b *orderbook.Book) (bid, ask float64, ok bool) {
+	if len(b.Bids) == 0 || len(b.Asks) == 0 {
+		return 0, 0, false
+	}
+	bid, ask = math.Inf(-1), math.Inf(1)
+	for p := range b.Bids {
+		bid = max(bid, p)
+	}
+	for p := range b.Asks {
+		ask = min(ask, p)
+	}
+	return bid, ask, true
+}
+
+func (h *heatmap) writeCSV(out io.Writer) error {
+	w := bufio.NewWriter(out)
+	b := []byte("bin_time,mid")
+	for _, p := range h.price {
+		b = strconv.AppendFloat(append(b, ','), p, 'f', -1, 64)
+	}
+	w.Write(append(b, '\n'))
+	for col := range h.cols {
+		b = strconv.AppendInt(b[:0], h.from+int64(col)*h.step, 10)
+		b = appendCSVFloat(append(b, ','), h.mid[col])
+		for r := range h.rows {
+			b = appendCSVFloat(append(b, ','), h.bid[col*h.rows+r]+h.ask[col*h.rows+r])
+		}
+		w.Write(append(b, '\n'))
+	}
+	return w.Flush()
+}
+
+func appendCSVFloat(b []byte, v float64) []byte {
+	if math.IsNaN(v) {
+		return b
+	}
+	return strconv.AppendFloat(b, v, 'f', -1, 64)
+}
+
+// numpy.savez 와 같이 압축하지 않은 .npy 들의 zip
+func (h *heatmap) writeNPZ(out io.Writer) error {
+	z := zip.NewWriter(out)
+	times := make([]int64, h.cols)
+	for i := range times {
+		times[i] = h.from + int64(i)*h.step
+	}
+	arrays := []struct {
+		name  string
+		descr string
+		shape []int
+		data  any
+	}{
+		{"bid", "<f8", []int{h.cols, h.rows}, h.bid},
+		{"ask", "<f8", []int{h.cols, h.rows}, h.ask},
+		{"time", "<i8", []int{h.cols}, times},
+		{"price", "<f8", []int{h.rows}, h.price},
+		{"mid", "<f8", []int{h.cols}, h.mid},
+	}
+	for _, a := range arrays {
+		w, err := z.CreateHeader(&zip.FileHeader{Name: a.name + ".npy", Method: zip.Store})
+		if err != nil {
+			return err
+		}
+		if err := writeNPY(w, a.descr, a.shape, a.data); err != nil {
+			return err
+		}
+	}
+	return z.Close()
+}
+
+// NPY 1.0: 매직, 헤더 길이, 파이썬 dict 헤더 (64 바이트 정렬), 리틀 엔디언 데이터
+func writeNPY(w io.Writer, descr string, shape []int, data any) error {
+	dims := ""
+	for _, n := range shape {
+		dims += strconv.Itoa(n) + ", "
+	}
+	if len(shape) > 1 {
+		dims = dims[:len(dims)-2]
+	}
+	header := fmt.Sprintf("{'descr': '%s', 'fortran_order': False, 'shape': (%s), }", descr, dims)
+	pad := 64 - (10+len(header)+1)%64
+	if pad == 64 {
+		pad = 0
+	}
+	header += string(slices.Repeat([]byte{' '}, pad)) + "\n"
+	bw := bufio.NewWriter(w)
+	bw.WriteString("\x93NUMPY\x01\x00")
+	binary.Write(bw, binary.LittleEndian, uint16(len(header)))
+	bw.WriteString(header)
+	if err := binary.Write(bw, binary.LittleEndian, data); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func (h *heatmap) writePNG(w io.Writer, scale int) error {
+	// 밝기의 기준은 칸 값의 99 백분위수. 큰 주문 몇 개 때문에 나머지가 어두워지지 않게 한다
+	var values []float64
+	for i := range h.bid {
+		if v := h.bid[i] + h.ask[i]; v > 0 {
+			values = append(values, v)
+		}
+	}
+	top := 1.0
+	if len(values) > 0 {
+		slices.Sort(values)
+		top = values[min(len(values)-1, len(values)*99/100)]
+	}
+	shade := func(q float64) uint8 {
+		if q <= 0 {
+			return 0
+		}
+		return uint8(min(math.Log1p(q)/math.Log1p(top), 1) * 255)
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, h.cols*scale, h.rows*scale))
+	fill := func(col, row int, c color.NRGBA) {
+		y := (h.rows - 1 - row) * scale
+		for dy := range scale {
+			for dx := range scale {
+				img.SetNRGBA(col*scale+dx, y+dy, c)
+			}
+		}
+	}
+	for col := range h.cols {
+		for r := range h.rows {
+			i := col*h.rows + r
+			c := color.NRGBA{40, 40, 40, 255} // 책을 모른다
+			if !math.IsNaN(h.bid[i]) {
+				c.G, c.R = shade(h.bid[i]), shade(h.ask[i])
+				c.B = min(c.G, c.R) / 2
+			}
+			fill(col, r, c)
+		}
+		if mid := h.mid[col]; !math.IsNaN(mid) {
+			if r := h.row(mid); r >= 0 {
+				fill(col, r, color.NRGBA{255, 255, 255, 255})
+			}
+		}
+	}
+	return png.Encode(w, img)
+}
+
+// path.tmp 에 쓴 뒤 옮긴다. 실패하면 반쪽 파일을 남기지 않는다
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
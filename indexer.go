@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"orderbook/orderbook"
+)
+
+// 블록 인덱스 footer 가 없는 기존 파일에 .idx 사이드카 인덱스를 만든다.
+// read, publish 등은 footer 가 없으면 사이드카를 찾아 쓴다.
+
+func runIndex(args []string) error {
+	fs := flag.NewFlagSet("index", flag.ExitOnError)
+	every := fs.Int("every", 1000, "records between index entries")
+	force := fs.Bool("force", false, "rebuild existing sidecars and index files that already have a footer")
+	var jobOpts jobOptions
+	jobOpts.register(fs, "")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: orderbook index [flags] <file>...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("no input files")
+	}
+
+	var units []jobUnit
+	for _, path := range fs.Args() {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		units = append(units, jobUnit{name: path, size: fi.Size()})
+	}
+
+	cp, err := openCheckpoint(jobOpts.checkpoint, "index", strings.Join(fs.Args(), ","), jobOpts.resume)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	return runJob(ctx, jobOpts, cp, units, func(ctx context.Context, u jobUnit, p *Progress) error {
+		return indexFile(u.name, *every, *force, p)
+	})
+}
+
+func indexFile(path string, every int, force bool, p *Progress) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if !force {
+		if idx, err := orderbook.LoadIndex(f); err == nil && idx != nil {
+			log.Printf("%s: already indexed, skipping", path)
+			return nil
+		}
+	}
+
+	idx := orderbook.BuildIndex(p.Reader(f), every)
+	if err := orderbook.WriteSidecar(path, idx); err != nil {
+		return err
+	}
+	log.Printf("%s: %d index entries for %s", path, len(idx.Entries), formatBytes(idx.DataSize))
+	return nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// 데이터 디렉터리를 쓰는 수집기의 임대(lease) 파일. <dataDir>/.instances/<id>.json 에 호스트, pid 와
+// heartbeat 를 남겨, 같은 인스턴스 id(또는 둘 다 -instance 없이)로 같은 디렉터리에 쓰려는 두 번째
+// 수집기를 시작 단계에서 거부한다. 그대로 두면 두 프로세스가 같은 파일에 세션을 섞어 쓴다.
+// 같은 호스트에서는 <id>.lock 의 flock 으로 확실히 막는다 (동시에 시작하는 경우까지). NFS 에서는 flock 을 믿을 수 없어
+// 파일 내용과 시간으로도 판단하는데, 이쪽은 동시에 시작하는 경우까지 막는 잠금은 아니다 (hot/standby 는 leader.go).
+
+const (
+	instancesDir    = ".instances"
+	defaultInstance = "default" // -instance 가 없을 때의 임대 이름
+	leaseHeartbeat  = 30 * time.Second
+	leaseStaleAfter = 3 * leaseHeartbeat // 이보다 오래 갱신되지 않은 임대는 죽은 프로세스의 것으로 본다
+)
+
+type instanceLease struct {
+	Instance  string    `json:"instance"`
+	Host      string    `json:"host"`
+	PID       int       `json:"pid"`
+	StartedAt time.Time `json:"startedAt"`
+	Heartbeat time.Time `json:"heartbeat"`
+
+	path string
+	lock *os.File      // <id>.lock. 닫으면 flock 이 풀린다
+	stop chan struct{} // release 가 닫아 run 을 끝낸다
+	done chan struct{} // run 이 끝나면 닫힌다
+}
+
+// takeover 면 (리더 잠금을 얻은 경우, leader.go) 살아 있어 보이는 다른 호스트의 임대도 가져온다
+func acquireInstanceLease(dataDir, instance string, takeover bool) (*instanceLease, error) {
+	if instance == "" {
+		instance = defaultInstance
+	}
+	host, _ := os.Hostname()
+	l := &instanceLease{
+		Instance:  instance,
+		Host:      host,
+		PID:       os.Getpid(),
+		StartedAt: time.Now().UTC(),
+		path:      filepath.Join(dataDir, instancesDir, instance+".json"),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), os.ModePerm); err != nil {
+		return nil, err
+	}
+	lockPath := filepath.Join(dataDir, instancesDir, instance+".lock")
+	lock, ok, err := lockFile(lockPath)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("instance %q is already writing to %s (%s is locked by another process); give each collector its own -instance",
+			instance, dataDir, lockPath)
+	}
+	if other, err := readInstanceLease(l.path); err == nil && !l.sameOwner(other) {
+		age := time.Since(other.Heartbeat)
+		switch {
+		case takeover:
+			log.Printf("Taking over lease of instance %q from host %s pid %d (leader lock held)", instance, other.Host, other.PID)
+		case other.Host == l.Host && !processAlive(other.PID):
+			// 같은 호스트에서 끝난 프로세스의 임대다
+		case age < leaseStaleAfter:
+			lock.Close()
+			return nil, fmt.Errorf("instance %q is already writing to %s (host %s, pid %d, heartbeat %s ago); give each collector its own -instance",
+				instance, dataDir, other.Host, other.PID, age.Round(time.Second))
+		default:
+			log.Printf("Taking over stale lease of instance %q from host %s pid %d", instance, other.Host, other.PID)
+		}
+	}
+	l.lock = lock
+	if err := l.write(); err != nil {
+		lock.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+func readInstanceLease(path string) (*instanceLease, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var l instanceLease
+	if err := json.Unmarshal(data, &l); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+func (l *instanceLease) sameOwner(o *instanceLease) bool {
+	return l.Host == o.Host && l.PID == o.PID
+}
+
+func (l *instanceLease) write() error {
+	l.Heartbeat = time.Now().UTC()
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.path)
+}
+
+// release 할 때까지 heartbeat 를 갱신한다. 그 사이 다른 프로세스가 임대를 가져갔으면 (오래 멈춰 있었던 경우) 크게 경고한다.
+func (l *instanceLease) run() {
+	defer close(l.done)
+	tick := time.NewTicker(leaseHeartbeat)
+	defer tick.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-tick.C:
+		}
+		if other, err := readInstanceLease(l.path); err == nil && !l.sameOwner(other) {
+			log.Printf("Warning: lease of instance %q was taken over by host %s pid %d; two collectors may be writing the same files",
+				l.Instance, other.Host, other.PID)
+			continue
+		}
+		if err := l.write(); err != nil {
+			log.Printf("Error renewing instance lease: %v", err)
+		}
+	}
+}
+
+// 정상 종료할 때 임대를 지워 다음 수집기가 기다리지 않게 한다. 지운 뒤 heartbeat 가 다시 쓰지 않도록 run 이 끝나길 기다린다.
+// run 을 시작한 임대에만 부른다
+func (l *instanceLease) release() {
+	close(l.stop)
+	<-l.done
+	if other, err := readInstanceLease(l.path); err == nil && l.sameOwner(other) {
+		os.Remove(l.path)
+	}
+	l.lock.Close() // 잠금 파일은 지우지 않는다. 지우면 기다리던 다른 프로세스가 다른 inode 를 잠글 수 있다
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// export, backfill, verify 처럼 몇 달치 데이터를 훑는 장시간 작업의 공통 뼈대.
+// 작업은 단위(보통 파일 하나)로 쪼개지고, 단위가 끝날 때마다 체크포인트에 기록되어
+// 중단 후 --resume 으로 이어서 실행할 수 있다.
+
+type jobOptions struct {
+	resume     bool
+	checkpoint string
+	noProgress bool
+}
+
+func (o *jobOptions) register(fs *flag.FlagSet, defaultCheckpoint string) {
+	fs.BoolVar(&o.resume, "resume", false, "resume from the checkpoint file instead of starting over")
+	fs.StringVar(&o.checkpoint, "checkpoint", defaultCheckpoint, "checkpoint file path")
+	fs.BoolVar(&o.noProgress, "no-progress", false, "disable the progress bar")
+}
+
+// SIGINT/SIGTERM 이 오면 취소되는 컨텍스트. 작업은 현재 단위를 정리하고 빠져나온다.
+func interruptContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+type Checkpoint struct {
+	Job       string    `json:"job"`
+	Key       string    `json:"key"` // 작업 파라미터 요약. 다르면 재개를 거부한다
+	Completed []string  `json:"completed"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	path string
+	done map[string]bool
+}
+
+func openCheckpoint(path, job, key string, resume bool) (*Checkpoint, error) {
+	cp := &Checkpoint{Job: job, Key: key, path: path, done: make(map[string]bool)}
+	if path == "" {
+		return cp, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		if resume {
+			log.Printf("No checkpoint at %s, starting from scratch", path)
+		}
+		return cp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !resume {
+		log.Printf("Existing checkpoint %s will be overwritten (use --resume to continue it)", path)
+		return cp, nil
+	}
+
+	var saved Checkpoint
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("checkpoint %s: %w", path, err)
+	}
+	if saved.Job != job || saved.Key != key {
+		return nil, fmt.Errorf("checkpoint %s belongs to %s(%s), not %s(%s)", path, saved.Job, saved.Key, job, key)
+	}
+	cp.Completed = saved.Completed
+	for _, u := range saved.Completed {
+		cp.done[u] = true
+	}
+	log.Printf("Resuming %s: %d unit(s) already completed", job, len(cp.Completed))
+	return cp, nil
+}
+
+func (c *Checkpoint) IsDone(unit string) bool {
+	return c.done[unit]
+}
+
+func (c *Checkpoint) MarkDone(unit string) error {
+	if c.done[unit] {
+		return nil
+	}
+	c.done[unit] = true
+	c.Completed = append(c.Completed, unit)
+	return c.save()
+}
+
+// 임시 파일에 쓰고 rename 해서, 저장 도중 중단되어도 이전 체크포인트가 남도록 한다.
+func (c *Checkpoint) save() error {
+	if c.path == "" {
+		return nil
+	}
+	c.UpdatedAt = time.Now().UTC()
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
+
+func (c *Checkpoint) remove() {
+	if c.path == "" {
+		return
+	}
+	if err := os.Remove(c.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Failed to remove checkpoint %s: %v", c.path, err)
+	}
+}
+
+type jobUnit struct {
+	name string // 체크포인트 키 (보통 파일 경로)
+	size int64  // 진행률 계산용 바이트 수
+}
+
+// 체크포인트에 없는 단위만 순서대로 실행한다. 모두 끝나면 체크포인트를 지운다.
+func runJob(ctx context.Context, opts jobOptions, cp *Checkpoint, units []jobUnit, fn func(ctx context.Context, u jobUnit, p *Progress) error) error {
+	var total int64
+	pending := units[:0:0]
+	for _, u := range units {
+		if cp.IsDone(u.name) {
+			continue
+		}
+		pending = append(pending, u)
+		total += u.size
+	}
+
+	p := NewProgress(cp.Job, total, !opts.noProgress)
+	for i, u := range pending {
+		p.SetLabel(fmt.Sprintf("%s [%d/%d]", cp.Job, i+1, len(pending)))
+		if err := fn(ctx, u, p); err != nil {
+			p.Finish()
+			if ctx.Err() != nil {
+				log.Printf("Interrupted during %s; rerun with --resume to continue", u.name)
+				return ctx.Err()
+			}
+			return fmt.Errorf("%s: %w", u.name, err)
+		}
+		if err := cp.MarkDone(u.name); err != nil {
+			log.Printf("Failed to save checkpoint: %v", err)
+		}
+	}
+	p.Finish()
+	cp.remove()
+	return nil
+}
+
+// --- 진행률 표시 ---
+
+type Progress struct {
+	mu       sync.Mutex
+	label    string
+	total    int64
+	done     int64
+	start    time.Time
+	lastDraw time.Time
+	enabled  bool
+	tty      bool
+	out      io.Writer
+}
+
+func NewProgress(label string, total int64, enabled bool) *Progress {
+	now := time.Now()
+	p := &Progress{label: label, total: total, start: now, lastDraw: now, enabled: enabled, out: os.Stderr}
+	if fi, err := os.Stderr.Stat(); err == nil {
+		p.tty = fi.Mode()&os.ModeCharDevice != 0
+	}
+	return p
+}
+
+func (p *Progress) SetLabel(label string) {
+	p.mu.Lock()
+	p.label = label
+	p.mu.Unlock()
+}
+
+func (p *Progress) Add(n int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done += n
+	p.draw(false)
+}
+
+// 읽은 바이트 수만큼 진행률을 올리는 Reader
+func (p *Progress) Reader(r io.Reader) io.Reader {
+	return &progressReader{r: r, p: p}
+}
+
+func (p *Progress) Finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.draw(true)
+	if p.enabled && p.tty {
+		fmt.Fprintln(p.out)
+	}
+}
+
+func (p *Progress) draw(force bool) {
+	if !p.enabled {
+		return
+	}
+	now := time.Now()
+	// 터미널이 아니면 (로그 파일 등) 10초에 한 줄만 남긴다
+	interval := 200 * time.Millisecond
+	if !p.tty {
+		interval = 10 * time.Second
+	}
+	if !force && now.Sub(p.lastDraw) < interval {
+		return
+	}
+	p.lastDraw = now
+
+	elapsed := now.Sub(p.start).Seconds()
+	rate := 0.0
+	if elapsed > 0 {
+		rate = float64(p.done) / elapsed
+	}
+	pct := 100.0
+	if p.total > 0 {
+		pct = float64(p.done) / float64(p.total) * 100
+	}
+	eta := "-"
+	if rate > 0 && p.total > p.done {
+		eta = (time.Duration(float64(p.total-p.done)/rate) * time.Second).Round(time.Second).String()
+	}
+
+	status := fmt.Sprintf("%s/%s %s/s ETA %s", formatBytes(p.done), formatBytes(p.total), formatBytes(int64(rate)), eta)
+	if !p.tty {
+		log.Printf("%s %5.1f%% %s", p.label, pct, status)
+		return
+	}
+	const width = 30
+	filled := int(pct / 100 * width)
+	if filled > width {
+		filled = width
+	}
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", width-filled)
+	fmt.Fprintf(p.out, "\r%s [%s] %5.1f%% %s\033[K", p.label, bar, pct, status)
+}
+
+type progressReader struct {
+	r io.Reader
+	p *Progress
+}
+
+func (pr *progressReader) Read(b []byte) (int, error) {
+	n, err := pr.r.Read(b)
+	pr.p.Add(int64(n))
+	return n, err
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
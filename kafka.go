@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/compress"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+	"google.golang.org/protobuf/proto"
+	"orderbook/orderbook"
+)
+
+// kafka:// 이벤트마다 메시지 하나를 토픽에 보낸다. 키는 심볼이라 같은 심볼의 이벤트는 한 파티션에 순서대로 들어간다.
+// 원래 타임스탬프는 헤더(eventHeaders)로, 메시지 타임스탬프는 수신 시각(event_time)이다.
+//
+//	kafka://[user:password@]broker1:9092,broker2:9092/topic?format=proto&acks=all&compression=zstd&batch=1000&linger=50ms[&tls=true][&sasl=scram-sha-512]
+//
+// format:
+//
+//	proto           Event protobuf 그대로 (기본)
+//	proto-registry  orderbook.proto 를 스키마 레지스트리에 등록하고 Confluent 와이어 포맷으로
+//	avro            orderbook.avsc 를 스키마 레지스트리에 등록하고 Confluent 와이어 포맷으로
+//
+// 레지스트리는 registry= 쿼리나 $SCHEMA_REGISTRY_URL (인증은 $SCHEMA_REGISTRY_USER/PASSWORD/TOKEN),
+// subject 는 subject= 쿼리나 <topic>-value 이다.
+// 보내기는 비동기로 배치되고, 실패는 다음 Publish 에서 돌려준다 (수집기에서는 서킷 브레이커가 센다).
+
+func init() {
+	registerSink("kafka", openKafkaSink)
+}
+
+type kafkaSink struct {
+	w         *kafka.Writer
+	serialize func(ev *orderbook.Event) ([]byte, error)
+
+	mu       sync.Mutex
+	writeErr error // 비동기 전송 실패. 다음 Publish 에서 돌려준다
+	failed   int
+}
+
+func openKafkaSink(u *url.URL) (Sink, error) {
+	topic := strings.Trim(u.Path, "/")
+	if u.Host == "" || topic == "" {
+		return nil, fmt.Errorf("kafka: URL needs brokers and a topic (kafka://broker:9092/topic)")
+	}
+	q := u.Query()
+
+	w := &kafka.Writer{
+		Addr:         kafka.TCP(strings.Split(u.Host, ",")...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		BatchSize:    1000,
+		BatchTimeout: 50 * time.Millisecond,
+		Async:        true,
+	}
+	switch acks := q.Get("acks"); acks {
+	case "", "all":
+	case "one", "1":
+		w.RequiredAcks = kafka.RequireOne
+	case "none", "0":
+		w.RequiredAcks = kafka.RequireNone
+	default:
+		return nil, fmt.Errorf("kafka: invalid acks %q (all, one, none)", acks)
+	}
+	if v := q.Get("compression"); v != "" && v != "none" {
+		var c compress.Compression
+		if err := c.UnmarshalText([]byte(v)); err != nil {
+			return nil, fmt.Errorf("kafka: invalid compression %q (gzip, snappy, lz4, zstd)", v)
+		}
+		w.Compression = c
+	}
+	if v := q.Get("batch"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("kafka: invalid batch %q", v)
+		}
+		w.BatchSize = n
+	}
+	if v := q.Get("linger"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("kafka: invalid linger %q", v)
+		}
+		w.BatchTimeout = d
+	}
+
+	transport := &kafka.Transport{}
+	if secure, _ := strconv.ParseBool(q.Get("tls")); secure {
+		transport.TLS = &tls.Config{}
+	}
+	if mech := q.Get("sasl"); mech != "" {
+		user := u.User.Username()
+		password, _ := u.User.Password()
+		var err error
+		switch mech {
+		case "plain":
+			transport.SASL = plain.Mechanism{Username: user, Password: password}
+		case "scram-sha-256":
+			transport.SASL, err = scram.Mechanism(scram.SHA256, user, password)
+		case "scram-sha-512":
+			transport.SASL, err = scram.Mechanism(scram.SHA512, user, password)
+		default:
+			err = fmt.Errorf("unknown SASL mechanism %q (plain, scram-sha-256, scram-sha-512)", mech)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("kafka: %w", err)
+		}
+	}
+	w.Transport = transport
+
+	s := &kafkaSink{w: w}
+	registry := schemaRegistryConfig{
+		URL:      os.Getenv("SCHEMA_REGISTRY_URL"),
+		Username: os.Getenv("SCHEMA_REGISTRY_USER"),
+		Password: os.Getenv("SCHEMA_REGISTRY_PASSWORD"),
+		Token:    os.Getenv("SCHEMA_REGISTRY_TOKEN"),
+	}
+	if v := q.Get("registry"); v != "" {
+		registry.URL = v
+	}
+	subject := q.Get("subject")
+	if subject == "" {
+		subject = topic + "-value"
+	}
+	switch format := q.Get("format"); format {
+	case "", "proto":
+		s.serialize = func(ev *orderbook.Event) ([]byte, error) { return proto.Marshal(ev) }
+	case "proto-registry", "avro":
+		if registry.URL == "" {
+			return nil, fmt.Errorf("kafka: format %s needs a schema registry (registry= or $SCHEMA_REGISTRY_URL)", format)
+		}
+		if format == "avro" {
+			ser, err := newAvroRegistrySerializer(registry, subject)
+			if err != nil {
+				return nil, fmt.Errorf("kafka: %w", err)
+			}
+			s.serialize = func(ev *orderbook.Event) ([]byte, error) { return ser.Serialize(ev), nil }
+		} else {
+			ser, err := newRegistrySerializer(registry, subject)
+			if err != nil {
+				return nil, fmt.Errorf("kafka: %w", err)
+			}
+			s.serialize = func(ev *orderbook.Event) ([]byte, error) { return ser.Serialize(ev) }
+		}
+	default:
+		return nil, fmt.Errorf("kafka: unknown format %q (proto, proto-registry, avro)", format)
+	}
+
+	w.Completion = s.completed
+	return s, nil
+}
+
+func (s *kafkaSink) completed(msgs []kafka.Message, err error) {
+	if err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.writeErr == nil {
+		log.Printf("Kafka write to %s failed (%d messages): %v", s.w.Topic, len(msgs), err)
+	}
+	s.writeErr = err
+	s.failed += len(msgs)
+}
+
+// 지난 비동기 전송이 실패했으면 그 오류를 한 번 돌려준다
+func (s *kafkaSink) takeError() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.writeErr
+	if err != nil {
+		err = fmt.Errorf("kafka: %d messages not delivered: %w", s.failed, err)
+		s.writeErr, s.failed = nil, 0
+	}
+	return err
+}
+
+func (s *kafkaSink) Publish(ev *orderbook.Event) error {
+	if err := s.takeError(); err != nil {
+		return err
+	}
+	value, err := s.serialize(ev)
+	if err != nil {
+		return err
+	}
+	msg := kafka.Message{
+		Key:   []byte(strings.ToLower(ev.Symbol)),
+		Value: value,
+		Time:  time.UnixMilli(ev.EventTime),
+	}
+	for k, v := range eventHeaders(ev, replaying) {
+		msg.Headers = append(msg.Headers, kafka.Header{Key: k, Value: []byte(v)})
+	}
+	// Async 라 버퍼에 넣고 바로 돌아온다
+	return s.w.WriteMessages(context.Background(), msg)
+}
+
+func (s *kafkaSink) Close() error {
+	err := s.w.Close()
+	if werr := s.takeError(); err == nil {
+		err = werr
+	}
+	return err
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+// 같은 저장소(NFS 등)를 가리키는 수집기 둘을 hot/standby 로 돌리기 (collect -leader). 같은 -instance 의 수집기들은
+// 리더 잠금을 얻은 하나만 데이터 디렉터리에 쓰고, 나머지는 잠금을 기다린다. 잠금을 얻으면 (임대 파일을 넘겨받고)
+// 수집을 시작한다. 잠금을 잃으면 곧바로 종료하고 (상태 1) 버퍼에 남은 이벤트는 쓰지 않는다. 그 사이 새 리더가
+// 같은 파일에 쓰기 시작했을 수 있기 때문이다. systemd 의 Restart= 가 다시 standby 로 띄운다.
+//
+//	-leader file                                         데이터 디렉터리의 .instances/<id>.leader 에 flock. 같은 호스트나 flock 을 지원하는 공유 파일 시스템
+//	-leader file:///shared/orderbook.leader              그 파일에 flock
+//	-leader redis://host:6379/0?ttl=10s[&key=...]        SET NX PX 로 키를 잡고 ttl/3 마다 연장한다 (rediss:// 는 TLS)
+//	-leader etcd://host1:2379,host2:2379/orderbook?ttl=10s  etcd lease 와 election (concurrency.Election)
+//
+// 키(key=, etcd 는 경로)의 기본값은 orderbook:leader:<id> 와 /orderbook/leader/<id> 이고 <id> 는 -instance (없으면 default).
+// redis 잠금은 연장에 실패한 채로 ttl 의 2/3 가 지나면 키가 만료되기 전에 잃은 것으로 보고 물러난다.
+//
+// -leader 와 상관없이 데이터 디렉터리마다 .instances/<id>.lock 의 flock 으로 같은 호스트의 두 번째 쓰기를 막는다 (instance.go).
+
+const defaultLeaderTTL = 10 * time.Second
+
+// 리더 잠금. acquire 는 잠금을 얻거나 ctx 가 끝날 때까지 기다리며, 기다리는 동안 alive 를 부른다 (워치독, systemd.go).
+type leaderLock interface {
+	acquire(ctx context.Context, alive func()) error
+	lost() <-chan struct{} // 잠금을 잃으면 닫힌다
+	release()
+	String() string
+}
+
+var leaderLockFactories = map[string]func(u *url.URL, dataDir, name string) (leaderLock, error){}
+
+func registerLeaderLock(scheme string, open func(u *url.URL, dataDir, name string) (leaderLock, error)) {
+	leaderLockFactories[scheme] = open
+}
+
+func init() {
+	registerLeaderLock("file", openFileLeader)
+	registerLeaderLock("redis", openRedisLeader)
+	registerLeaderLock("rediss", openRedisLeader)
+	registerLeaderLock("etcd", openEtcdLeader)
+	registerLeaderLock("etcds", openEtcdLeader)
+}
+
+func openLeaderLock(spec, dataDir, instance string) (leaderLock, error) {
+	if spec == "file" {
+		spec = "file://"
+	}
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("leader %q: %w", spec, err)
+	}
+	open, ok := leaderLockFactories[u.Scheme]
+	if !ok {
+		var schemes []string
+		for s := range leaderLockFactories {
+			schemes = append(schemes, s)
+		}
+		sort.Strings(schemes)
+		return nil, fmt.Errorf("unknown leader lock %q (available: %s)", u.Scheme, strings.Join(schemes, ", "))
+	}
+	if instance == "" {
+		instance = defaultInstance
+	}
+	return open(u, dataDir, instance)
+}
+
+// 잠금을 얻을 때까지 standby 로 기다리고, 얻은 뒤 잃으면 onLost 를 부르고 종료한다
+func becomeLeader(ctx context.Context, lock leaderLock, onLost func()) error {
+	log.Printf("Standing by until this collector holds the leader lock %s", lock)
+	collectorAlive()
+	notifySystemd("READY=1\nSTATUS=Standby, waiting for the leader lock")
+	startWatchdog()
+	start := time.Now()
+	if err := lock.acquire(ctx, collectorAlive); err != nil {
+		return err
+	}
+	log.Printf("Acquired the leader lock %s after %s; collecting", lock, time.Since(start).Round(time.Second))
+	go func() {
+		<-lock.lost()
+		log.Printf("Lost the leader lock %s; exiting without flushing so the new leader is the only writer", lock)
+		onLost()
+		os.Exit(1)
+	}()
+	return nil
+}
+
+func leaderIdentity() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s/%d/%d", host, os.Getpid(), time.Now().UnixNano())
+}
+
+// 잠금을 얻을 때까지 every 마다 try 를 부른다
+func pollLock(ctx context.Context, every time.Duration, alive func(), try func() (bool, error)) error {
+	warned := false
+	for {
+		alive()
+		ok, err := try()
+		if ok {
+			return nil
+		}
+		if err != nil && !warned {
+			log.Printf("Leader lock attempt failed (retrying): %v", err)
+			warned = true
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(every):
+		}
+	}
+}
+
+// file: flock. 프로세스가 끝나면 커널이 풀어 주므로 잃는 일은 없다
+type fileLeader struct {
+	path string
+	f    *os.File
+}
+
+func openFileLeader(u *url.URL, dataDir, name string) (leaderLock, error) {
+	path := u.Path
+	if path == "" {
+		path = filepath.Join(dataDir, instancesDir, name+".leader")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, err
+	}
+	return &fileLeader{path: path}, nil
+}
+
+func (l *fileLeader) acquire(ctx context.Context, alive func()) error {
+	return pollLock(ctx, time.Second, alive, func() (bool, error) {
+		f, ok, err := lockFile(l.path)
+		l.f = f
+		return ok, err
+	})
+}
+
+func (l *fileLeader) lost() <-chan struct{} { return nil }
+
+func (l *fileLeader) release() {
+	if l.f != nil {
+		l.f.Close()
+	}
+}
+
+func (l *fileLeader) String() string { return "file " + l.path }
+
+// redis: SET key id NX PX ttl 로 잡고, 값이 아직 자기 id 일 때만 연장하거나 지운다
+var (
+	redisLeaderRenew   = redis.NewScript(`if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("PEXPIRE", KEYS[1], ARGV[2]) end return 0`)
+	redisLeaderRelease = redis.NewScript(`if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) end return 0`)
+)
+
+type redisLeader struct {
+	rdb  *redis.Client
+	key  string
+	id   string
+	ttl  time.Duration
+	addr string
+
+	once   sync.Once
+	lostCh chan struct{}
+	stop   chan struct{}
+}
+
+func openRedisLeader(u *url.URL, _ string, name string) (leaderLock, error) {
+	q := u.Query()
+	l := &redisLeader{key: "orderbook:leader:" + name, id: leaderIdentity(), ttl: defaultLeaderTTL, addr: u.Host,
+		lostCh: make(chan struct{}), stop: make(chan struct{})}
+	if v := q.Get("key"); v != "" {
+		l.key = v
+	}
+	if v := q.Get("ttl"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < time.Second {
+			return nil, fmt.Errorf("leader redis: invalid ttl %q (at least 1s)", v)
+		}
+		l.ttl = d
+	}
+	q.Del("key")
+	q.Del("ttl")
+	ru := *u
+	ru.RawQuery = q.Encode()
+	opts, err := redis.ParseURL(ru.String())
+	if err != nil {
+		return nil, fmt.Errorf("leader redis: %w", err)
+	}
+	l.rdb = redis.NewClient(opts)
+	return l, nil
+}
+
+func (l *redisLeader) acquire(ctx context.Context, alive func()) error {
+	err := pollLock(ctx, l.ttl/3, alive, func() (bool, error) {
+		callCtx, cancel := context.WithTimeout(ctx, l.ttl/3)
+		defer cancel()
+		return l.rdb.SetNX(callCtx, l.key, l.id, l.ttl).Result()
+	})
+	if err != nil {
+		return err
+	}
+	go l.renew(time.Now())
+	return nil
+}
+
+// ttl/3 마다 연장한다. 다른 프로세스가 키를 가졌거나, 마지막 연장에서 ttl 의 2/3 가 지나도록 연장하지 못하면 잃은 것으로 본다
+func (l *redisLeader) renew(renewed time.Time) {
+	tick := time.NewTicker(l.ttl / 3)
+	defer tick.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-tick.C:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), l.ttl/3)
+		n, err := redisLeaderRenew.Run(ctx, l.rdb, []string{l.key}, l.id, l.ttl.Milliseconds()).Int()
+		cancel()
+		switch {
+		case err == nil && n == 1:
+			renewed = time.Now()
+			continue
+		case err == nil:
+			log.Printf("Leader key %s is held by another collector", l.key)
+		case time.Since(renewed) < l.ttl*2/3:
+			log.Printf("Renewing leader key %s failed, retrying: %v", l.key, err)
+			continue
+		default:
+			log.Printf("Could not renew leader key %s for %s: %v", l.key, time.Since(renewed).Round(time.Millisecond), err)
+		}
+		l.once.Do(func() { close(l.lostCh) })
+		return
+	}
+}
+
+func (l *redisLeader) lost() <-chan struct{} { return l.lostCh }
+
+func (l *redisLeader) release() {
+	close(l.stop)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	redisLeaderRelease.Run(ctx, l.rdb, []string{l.key}, l.id)
+	l.rdb.Close()
+}
+
+func (l *redisLeader) String() string { return "redis " + l.addr + " " + l.key }
+
+// etcd: lease(ttl) 에 묶인 session 으로 election 에 나간다. session 이 끝나면 (lease 를 연장하지 못해 만료) 잃은 것이다
+type etcdLeader struct {
+	cli      *clientv3.Client
+	prefix   string
+	ttl      time.Duration
+	session  *concurrency.Session
+	election *concurrency.Election
+}
+
+func openEtcdLeader(u *url.URL, _ string, name string) (leaderLock, error) {
+	q := u.Query()
+	l := &etcdLeader{prefix: "/orderbook/leader/" + name, ttl: defaultLeaderTTL}
+	if p := strings.TrimSuffix(u.Path, "/"); p != "" {
+		l.prefix = p
+	}
+	if v := q.Get("ttl"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < time.Second {
+			return nil, fmt.Errorf("leader etcd: invalid ttl %q (at least 1s)", v)
+		}
+		l.ttl = d
+	}
+	scheme := "http://"
+	if u.Scheme == "etcds" {
+		scheme = "https://"
+	}
+	var endpoints []string
+	for _, h := range strings.Split(u.Host, ",") {
+		endpoints = append(endpoints, scheme+h)
+	}
+	cfg := clientv3.Config{Endpoints: endpoints, DialTimeout: 5 * time.Second}
+	if u.User != nil {
+		cfg.Username = u.User.Username()
+		cfg.Password, _ = u.User.Password()
+	}
+	cli, err := clientv3.New(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("leader etcd: %w", err)
+	}
+	l.cli = cli
+	return l, nil
+}
+
+func (l *etcdLeader) acquire(ctx context.Context, alive func()) error {
+	err := pollLock(ctx, time.Second, alive, func() (bool, error) {
+		s, err := concurrency.NewSession(l.cli, concurrency.WithTTL(int(l.ttl.Seconds())))
+		if err != nil {
+			return false, err
+		}
+		l.session = s
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	l.election = concurrency.NewElection(l.session, l.prefix)
+	// Campaign 은 리더가 될 때까지 막히므로 그동안에도 워치독이 살아 있게 한다
+	done := make(chan error, 1)
+	go func() { done <- l.election.Campaign(ctx, leaderIdentity()) }()
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+	for {
+		alive()
+		select {
+		case err := <-done:
+			return err
+		case <-l.session.Done():
+			return fmt.Errorf("leader etcd: session expired while waiting")
+		case <-tick.C:
+		}
+	}
+}
+
+func (l *etcdLeader) lost() <-chan struct{} { return l.session.Done() }
+
+func (l *etcdLeader) release() {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if l.election != nil {
+		l.election.Resign(ctx)
+	}
+	if l.session != nil {
+		l.session.Close()
+	}
+	l.cli.Close()
+}
+
+func (l *etcdLeader) String() string {
+	return "etcd " + strings.Join(l.cli.Endpoints(), ",") + " " + l.prefix + " (ttl " + strconv.Itoa(int(l.ttl.Seconds())) + "s)"
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"orderbook/orderbook"
+)
+
+// orderbook lobster : 기록된 책을 LOBSTER 형식의 message/orderbook CSV 쌍으로 내보낸다.
+// 학계의 시장 미시구조 도구 상당수가 이 형식을 입력으로 받는다.
+//
+// UTC 하루마다 두 파일을 -out 에 만든다 (LOBSTER 이름 규칙, 시각은 자정부터의 ms).
+//
+//	<SYMBOL>_<date>_<start>_<end>_message_<levels>.csv
+//	<SYMBOL>_<date>_<start>_<end>_orderbook_<levels>.csv
+//
+// message 의 한 줄은 Time(자정부터의 초, ns 정밀도), Type, Order ID, Size, Price, Direction 이고, orderbook 의 같은 줄은
+// 그 메시지 직후의 Ask Price 1, Ask Size 1, Bid Price 1, Bid Size 1, ... 이다. 가격은 -price-scale 을 곱한 정수(LOBSTER 는
+// 10000), 빈 호가는 매도 9999999999, 매수 -9999999999 에 수량 0 이다. 수량은 소수 그대로 쓴다.
+//
+// 주문 단위(L3)가 아니라 호가 단위(L2) 기록에서 만들므로 메시지는 가격별 수량 변화다. Order ID 는 모두 0 이다.
+//   - 수량이 늘면 1 (submission), 줄면 2 (partial cancel), 호가가 사라지면 3 (deletion)
+//   - 체결(trade)은 4 (execution) 이고 Direction 은 대기 주문 쪽이다 (buyer_is_maker 면 1). 책은 바꾸지 않는다.
+//     체결로 준 수량은 뒤따르는 증분에서 2 나 3 으로 다시 나타난다 (-trades=false 면 체결을 빼고 책 변화만)
+//   - 증분(depth@...)을 기록했으면 책 전체 스냅샷(REST, 체크포인트 등)부터 증분으로 재구성한다. 증분이 끊기면
+//     다음 책 전체 스냅샷까지 메시지를 내지 않고, 그 스냅샷과의 차이를 메시지로 낸다
+//   - 증분이 없으면 partial depth 스냅샷(-book 으로 stream_type 지정, 기본 처음 본 것) 사이의 차이를 메시지로 낸다.
+//     상위 N 호가 밖으로 밀려난 호가도 3 이 된다
+//   - 첫 스냅샷의 호가는 1 로 쌓는다. 그 전의 레코드는 건너뛴다
+
+const (
+	lobsterEmptyAsk = 9999999999
+	lobsterEmptyBid = -9999999999
+)
+
+func runLobster(args []string) error {
+	fs := flag.NewFlagSet("lobster", flag.ExitOnError)
+	symbol := fs.String("symbol", "", "symbol")
+	var rng rangeFlags
+	rng.register(fs)
+	dataDir := fs.String("data", defaultDataDir, "data directory")
+	outDir := fs.String("out", ".", "directory for the message/orderbook CSV files")
+	levels := fs.Int("levels", 10, "levels per side in the orderbook file")
+	scale := fs.Float64("price-scale", 10000, "prices are written as integers multiplied by this (LOBSTER uses 10000)")
+	book := fs.String("book", "", "snapshot stream_type to diff when the data has no depth updates (default: the first one seen)")
+	trades := fs.Bool("trades", true, "write trades as execution (type 4) messages")
+	noProgress := fs.Bool("no-progress", false, "disable the progress bar")
+	fs.Parse(args)
+
+	if *symbol == "" {
+		return fmt.Errorf("-symbol is required")
+	}
+	if *levels <= 0 {
+		return fmt.Errorf("-levels must be positive")
+	}
+	if *scale <= 0 {
+		return fmt.Errorf("-price-scale must be positive")
+	}
+	from, to, err := rng.resolve()
+	if err != nil {
+		return err
+	}
+	files := dataFilesInRange(*dataDir, *symbol, from, to)
+	if len(files) == 0 {
+		return fmt.Errorf("no data for %s in %s", *symbol, rng.String())
+	}
+	var size int64
+	for _, f := range files {
+		size += f.size
+	}
+	if err := os.MkdirAll(*outDir, os.ModePerm); err != nil {
+		return err
+	}
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+	x := &lobsterExporter{
+		dir:        *outDir,
+		symbol:     strings.ToUpper(*symbol),
+		from:       from,
+		to:         to,
+		levels:     *levels,
+		scale:      *scale,
+		trades:     *trades,
+		snapStream: *book,
+		bids:       lobsterSide{bid: true, qty: make(map[float64]float64)},
+		asks:       lobsterSide{qty: make(map[float64]float64)},
+	}
+	progress := NewProgress("lobster", size, !*noProgress)
+	for _, f := range files {
+		err := scanFile(ctx, f.path, from, to, progress, func(r *orderbook.Reader, ev *orderbook.Event) error {
+			return x.event(r, ev)
+		})
+		if err != nil {
+			x.close()
+			return err
+		}
+	}
+	progress.Finish()
+	if err := x.close(); err != nil {
+		return err
+	}
+	log.Printf("Wrote %d messages (%d executions) into %d day(s)", x.messages, x.executions, x.days)
+	if x.gaps > 0 {
+		log.Printf("%d depth update gaps: no messages until the next full book snapshot", x.gaps)
+	}
+	return nil
+}
+
+// 한쪽 호가. prices 는 좋은 가격부터 정렬해 둔다 (상위 N 을 매번 정렬하지 않으려고).
+type lobsterSide struct {
+	bid    bool
+	prices []float64
+	qty    map[float64]float64
+}
+
+func (s *lobsterSide) compare(a, b float64) int {
+	if s.bid {
+		return cmp.Compare(b, a)
+	}
+	return cmp.Compare(a, b)
+}
+
+// 가격의 수량을 바꾸고 예전 수량을 돌려준다 (0 이면 호가를 지운다)
+func (s *lobsterSide) set(price, quantity float64) float64 {
+	old := s.qty[price]
+	i, found := slices.BinarySearchFunc(s.prices, price, s.compare)
+	switch {
+	case quantity == 0 && found:
+		s.prices = slices.Delete(s.prices, i, i+1)
+		delete(s.qty, price)
+	case quantity != 0:
+		if !found {
+			s.prices = slices.Insert(s.prices, i, price)
+		}
+		s.qty[price] = quantity
+	}
+	return old
+}
+
+type lobsterExporter struct {
+	dir      string
+	symbol   string
+	from, to int64
+	levels   int
+	scale    float64
+	trades   bool
+
+	decided    bool   // 증분으로 재구성할지 정했는지 (첫 레코드의 세션 헤더로)
+	useDiffs   bool   // 증분으로 재구성한다
+	snapStream string // 증분이 없을 때 차이를 낼 partial depth 스냅샷
+	ready      bool   // 책을 알고 있다 (첫 스냅샷 뒤, 증분이 끊기지 않았다)
+	lastUpdate int64
+	synced     bool
+	bids, asks lobsterSide
+
+	day        string
+	dayStartNs int64
+	msgFile    *os.File
+	bookFile   *os.File
+	msg, book  *bufio.Writer
+	line       []byte
+
+	messages, executions, days, gaps int
+}
+
+func (x *lobsterExporter) event(r *orderbook.Reader, ev *orderbook.Event) error {
+	if !x.decided {
+		x.decided = true
+		if h := r.Header; h != nil {
+			x.useDiffs = slices.ContainsFunc(h.Streams, func(s string) bool { return streamKind(s) == "diff" })
+		}
+	}
+	// 예전 레코드에는 ns 수신 시각이 없다
+	at := ev.ReceiveTimeNs
+	if at == 0 {
+		at = ev.EventTime * int64(time.Millisecond)
+	}
+	switch pl := ev.Payload.(type) {
+	case *orderbook.Event_Snapshot:
+		if x.useDiffs {
+			if !orderbook.IsFullBookSnapshot(ev.StreamType) {
+				return nil
+			}
+		} else {
+			if orderbook.IsFullBookSnapshot(ev.StreamType) {
+				return nil
+			}
+			if x.snapStream == "" {
+				x.snapStream = ev.StreamType
+			}
+			if ev.StreamType != x.snapStream {
+				return nil
+			}
+		}
+		x.lastUpdate, x.synced, x.ready = pl.Snapshot.LastUpdateId, false, true
+		return x.replace(at, pl.Snapshot)
+
+	case *orderbook.Event_DepthDiff:
+		if !x.ready || !x.useDiffs {
+			return nil
+		}
+		d := pl.DepthDiff
+		ok, err := orderbook.DiffFollows(d, x.lastUpdate, x.synced)
+		if err != nil {
+			x.ready = false // 다음 책 전체 스냅샷까지 책을 모른다
+			x.gaps++
+			return nil
+		}
+		if !ok {
+			return nil
+		}
+		x.lastUpdate, x.synced = d.FinalUpdateId, true
+		for _, l := range d.Bids {
+			if err := x.change(at, &x.bids, l.Price, l.Quantity); err != nil {
+				return err
+			}
+		}
+		for _, l := range d.Asks {
+			if err := x.change(at, &x.asks, l.Price, l.Quantity); err != nil {
+				return err
+			}
+		}
+
+	case *orderbook.Event_Trade:
+		if !x.ready || !x.trades {
+			return nil
+		}
+		t := pl.Trade
+		direction := -1
+		if t.BuyerIsMaker {
+			direction = 1
+		}
+		x.executions++
+		return x.write(at, 4, t.Quantity, t.Price, direction)
+	}
+	return nil
+}
+
+// 책을 스냅샷으로 바꾸며 호가마다의 차이를 메시지로 낸다. 없어진 호가를 먼저 지운다.
+func (x *lobsterExporter) replace(at int64, s *orderbook.Snapshot) error {
+	for _, side := range []struct {
+		side   *lobsterSide
+		levels []*orderbook.Level
+	}{{&x.bids, s.Bids}, {&x.asks, s.Asks}} {
+		keep := make(map[float64]bool, len(side.levels))
+		for _, l := range side.levels {
+			if l.Quantity != 0 {
+				keep[l.Price] = true
+			}
+		}
+		for _, p := range slices.Clone(side.side.prices) {
+			if !keep[p] {
+				if err := x.change(at, side.side, p, 0); err != nil {
+					return err
+				}
+			}
+		}
+		for _, l := range side.levels {
+			if err := x.change(at, side.side, l.Price, l.Quantity); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// 한 가격의 수량을 바꾸고 바뀌었으면 메시지와 책 한 줄을 쓴다
+func (x *lobsterExporter) change(at int64, side *lobsterSide, price, quantity float64) error {
+	old := side.set(price, quantity)
+	if old == quantity {
+		return nil
+	}
+	kind := 1
+	switch {
+	case quantity == 0:
+		kind = 3
+	case quantity < old:
+		kind = 2
+	}
+	direction := -1
+	if side.bid {
+		direction = 1
+	}
+	return x.write(at, kind, math.Abs(quantity-old), price, direction)
+}
+
+func (x *lobsterExporter) write(at int64, kind int, size, price float64, direction int) error {
+	if err := x.openDay(at); err != nil {
+		return err
+	}
+	x.messages++
+
+	sinceMidnight := at - x.dayStartNs
+	b := strconv.AppendInt(x.line[:0], sinceMidnight/int64(time.Second), 10)
+	b = fmt.Appendf(b, ".%09d,%d,0,", sinceMidnight%int64(time.Second), kind)
+	b = strconv.AppendFloat(b, size, 'f', -1, 64)
+	b = append(b, ',')
+	b = strconv.AppendInt(b, x.price(price), 10)
+	b = append(b, ',')
+	b = strconv.AppendInt(b, int64(direction), 10)
+	b = append(b, '\n')
+	if _, err := x.msg.Write(b); err != nil {
+		return err
+	}
+
+	b = b[:0]
+	for i := range x.levels {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = x.appendLevel(b, &x.asks, i, lobsterEmptyAsk)
+		b = append(b, ',')
+		b = x.appendLevel(b, &x.bids, i, lobsterEmptyBid)
+	}
+	b = append(b, '\n')
+	x.line = b
+	_, err := x.book.Write(b)
+	return err
+}
+
+func (x *lobsterExporter) appendLevel(b []byte, side *lobsterSide, i int, empty int64) []byte {
+	if i >= len(side.prices) {
+		b = strconv.AppendInt(b, empty, 10)
+		return append(b, ",0"...)
+	}
+	p := side.prices[i]
+	b = strconv.AppendInt(b, x.price(p), 10)
+	b = append(b, ',')
+	return strconv.AppendFloat(b, side.qty[p], 'f', -1, 64)
+}
+
+func (x *lobsterExporter) price(p float64) int64 {
+	return int64(math.Round(p * x.scale))
+}
+
+// 메시지의 UTC 날짜가 바뀌면 새 파일 쌍을 연다. 이름의 시각 구간은 그날 안의 요청 구간이다.
+func (x *lobsterExporter) openDay(at int64) error {
+	t := time.Unix(0, at).UTC()
+	day := t.Format(dateLayout)
+	if day == x.day {
+		return nil
+	}
+	if err := x.closeDay(); err != nil {
+		return err
+	}
+	dayStart := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).UnixMilli()
+	start := max(x.from, dayStart) - dayStart
+	end := min(x.to, dayStart+dayMillis) - dayStart
+	name := func(kind string) string {
+		return filepath.Join(x.dir, fmt.Sprintf("%s_%s_%d_%d_%s_%d.csv", x.symbol, day, start, end, kind, x.levels))
+	}
+	var err error
+	if x.msgFile, err = os.Create(name("message")); err != nil {
+		return err
+	}
+	if x.bookFile, err = os.Create(name("orderbook")); err != nil {
+		x.msgFile.Close()
+		x.msgFile = nil
+		return err
+	}
+	x.msg, x.book = bufio.NewWriterSize(x.msgFile, 1<<16), bufio.NewWriterSize(x.bookFile, 1<<16)
+	x.day, x.dayStartNs = day, dayStart*int64(time.Millisecond)
+	x.days++
+	log.Printf("Writing %s", name("message"))
+	return nil
+}
+
+func (x *lobsterExporter) closeDay() error {
+	if x.msgFile == nil {
+		return nil
+	}
+	err := x.msg.Flush()
+	if ferr := x.book.Flush(); err == nil {
+		err = ferr
+	}
+	for _, f := range []*os.File{x.msgFile, x.bookFile} {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	x.msgFile, x.bookFile, x.day = nil, nil, ""
+	return err
+}
+
+func (x *lobsterExporter) close() error {
+	return x.closeDay()
+}
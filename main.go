@@ -1,178 +1,85 @@
 package main
 
 import (
-	"bufio"
-	"encoding/binary"
-	"encoding/json"
 	"fmt"
-	"log"
 	"os"
-	"strconv"
 	"strings"
-	"sync"
-	"time"
-
-	"github.com/gorilla/websocket"
-	"google.golang.org/protobuf/proto"
-	"orderbook/orderbook"
-)
-
-const (
-	websocketURL = "wss://stream.binance.com:9443/stream?streams="
-	streamSuffix = "@depth20@100ms" // 상위 20개, 100ms 주기 스냅샷 스트림
 )
 
-var symbols = []string{"ethusdt", "ethusdc", "ethbtc"}
-
-// --- 구조체 정의 ---
-type CombinedStreamEvent struct {
-	Stream string          `json:"stream"`
-	Data   json.RawMessage `json:"data"`
-}
-
-// Partial Depth Stream 응답 구조체 (스냅샷)
-type SnapshotEvent struct {
-	LastUpdateID int64       `json:"lastUpdateId"`
-	Bids         [][2]string `json:"bids"`
-	Asks         [][2]string `json:"asks"`
-}
-
-type FileManager struct {
-	mu           sync.Mutex
-	fileWriters  map[string]*bufio.Writer
-	openFiles    map[string]*os.File
-	currentDates map[string]string
-}
-
-// (FileManager 및 헬퍼 함수들은 이전과 거의 동일)
-func NewFileManager() *FileManager {
-	return &FileManager{
-		fileWriters:  make(map[string]*bufio.Writer),
-		openFiles:    make(map[string]*os.File),
-		currentDates: make(map[string]string),
-	}
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
 }
 
-func (fm *FileManager) getWriter(symbol string) (*bufio.Writer, error) {
-	fm.mu.Lock()
-	defer fm.mu.Unlock()
-	const dataDir = "data"
-	utcDate := time.Now().UTC().Format("2006-01-02")
-	symbolLower := strings.ToLower(symbol)
-	if fm.currentDates[symbolLower] != utcDate {
-		if file, ok := fm.openFiles[symbolLower]; ok {
-			fm.fileWriters[symbolLower].Flush()
-			file.Close()
-		}
-		fullDirPath := fmt.Sprintf("%s/%s", dataDir, symbolLower)
-		if err := os.MkdirAll(fullDirPath, os.ModePerm); err != nil {
-			return nil, err
-		}
-		fileName := fmt.Sprintf("%s/%s_%s.bin", fullDirPath, symbolLower, utcDate)
-		file, err := os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		if err != nil {
-			return nil, err
-		}
-		fm.openFiles[symbolLower] = file
-		fm.fileWriters[symbolLower] = bufio.NewWriter(file)
-		fm.currentDates[symbolLower] = utcDate
-		log.Printf("Opened new data file for %s: %s", symbolLower, fileName)
-	}
-	return fm.fileWriters[symbolLower], nil
-}
-
-func (fm *FileManager) writeSnapshot(symbol string, snapshot *orderbook.Snapshot) {
-	writer, err := fm.getWriter(symbol)
-	if err != nil {
-		log.Printf("Error getting writer for %s: %v", symbol, err)
-		return
-	}
-	bytes, err := proto.Marshal(snapshot)
-	if err != nil {
-		log.Printf("Error marshalling proto: %v", err)
-		return
-	}
-	lenBuf := make([]byte, 4)
-	binary.LittleEndian.PutUint32(lenBuf, uint32(len(bytes)))
-	fm.mu.Lock()
-	defer fm.mu.Unlock()
-	writer.Write(lenBuf)
-	writer.Write(bytes)
-	writer.Flush()
+var commands = []command{
+	{"collect", "바이낸스 오더북 스트림을 수집해 data/ 에 저장", runCollect},
+	{"read", "특정 시각의 오더북 스냅샷을 조회", runRead},
+	{"plan", "긴 구간의 export 를 샤드로 나눈 manifest 생성", runPlan},
+	{"fill", "기록된 책에 시장가 주문을 넣었을 때의 평균 체결가, 슬리피지, 소진 호가 수 계산 (한 시각 또는 구간)", runFill},
+	{"verify", "파일의 모든 레코드를 읽어 프레임, 디코딩, 시각 순서, 인덱스, manifest 체크섬 확인. 문제가 있으면 보고하고 실패", runVerify},
+	{"verify-book", "증분으로 재구성한 오더북을 기록된 스냅샷과 대조", runVerifyBook},
+	{"list", "데이터 디렉터리의 manifest(심볼, 출처, 기간, 레코드 수, 체크섬) 표시. -refresh 로 바뀐 파일 반영", runList},
+	{"stats", "파일, 심볼, 날짜별 레코드 수, 시간 범위, 스냅샷 간격(최소/최대/평균, 가장 큰 간격), 크기와 압축률 요약", runStats},
+	{"gaps", "구간 안에서 스냅샷이 -min-gap 보다 오래 없었던 구간(재연결, 장애)을 JSON 으로 보고. -fail 이면 있을 때 실패", runGaps},
+	{"compact", "파일을 체크포인트(-checkpoint-every 마다 온전한 스냅샷, 증분이면 책 전체) + 델타 배치로 다시 써서 줄임. 원본과 대조한 뒤 교체", runCompact},
+	{"reprocess", "collect -raw-dir 로 남긴 원본 메시지를 지금의 파서로 다시 풀어 데이터 파일 생성 (-print 로 원본 출력)", runReprocess},
+	{"import", "data.binance.vision 의 일별 체결, 캔들 아카이브를 받아 데이터 파일로 변환 (과거 구간 채우기)", runImport},
+	{"import-vendor", "외부 업체 데이터(Tardis, crypto-lake CSV)의 책, 체결을 데이터 파일로 변환 (수집 공백 채우기)", runImportVendor},
+	{"index", "footer 없는 기존 파일에 .idx 사이드카 인덱스 생성", runIndex},
+	{"ticks", "스냅샷에서 최우선 호가 변화(tick) 스트림 추출", runTicks},
+	{"resample", "스냅샷에서 최우선 호가, 중간가, 스프레드, 상위 호가 수량을 일정 간격(1s, 1m) 막대로 요약 (CSV)", runResample},
+	{"anomalies", "스냅샷에서 교차/잠긴 호가와 중간가 급변을 찾아 날짜별 보고서(또는 -events 로 건별 목록) 출력", runAnomalies},
+	{"analytics", "스냅샷마다 특징값(불균형, microprice 등)을 계산해 시계열 CSV 로 출력", runAnalytics},
+	{"heatmap", "구간의 호가 수량을 가격 × 시간 격자(시간 가중 평균)로 모아 CSV, PNG, NumPy(.npz) 로 내보냄 (이벤트 전후 유동성 보기)", runHeatmap},
+	{"convert", "데이터 파일을 Parquet 나 Arrow IPC 로 변환", runConvert},
+	{"lobster", "기록된 책과 체결을 LOBSTER 형식의 message/orderbook CSV 쌍으로 내보냄 (하루마다)", runLobster},
+	{"duckdb", "convert -hive 로 만든 Parquet 데이터셋(exchange=/symbol=/date=)을 DuckDB 로 질의하는 SQL 출력", runDuckDB},
+	{"view", "기록된 데이터를 터미널에서 재생 (일시정지, 한 단계씩, 시각 이동, 속도 조절)", runView},
+	{"watch", "수집 중인(또는 재생하는) 책의 상위 호가를 수량 막대, 스프레드, 초당 업데이트 수와 함께 터미널에 표시", runWatch},
+	{"prune", "보관 기간이 지난 파일을 줄인 사본으로 바꾸거나 삭제", runPrune},
+	{"upload", "데이터 파일을 S3/GCS 로 업로드", runUpload},
+	{"schema", "스키마 레지스트리에 orderbook.proto 등록", runSchema},
+	{"serve-files", "데이터 디렉터리를 읽기 전용 HTTP(Range 지원)로 공개", runServeFiles},
+	{"publish", "기록된 데이터를 싱크(kafka/nats 등)로 재생 발행", runPublish},
+	{"serve-api", "저장된 데이터에 대한 HTTP 질의 API", runServeAPI},
+	{"arb", "세 심볼의 최우선 호가로 합성 교차 환율과 수수료 뺀 삼각 차익 스프레드 계산, 기준 이상이면 출력 (재생 또는 -live)", runArb},
+	{"follow", "Feed 로 최우선 호가 변화를 출력 (기록 재생 또는 -live, 라이브/백테스트 공용 API 예시)", runFollow},
+	{"serve-replay", "기록된 데이터를 바이낸스와 같은 JSON 웹소켓 스트림으로 재생 (속도, 시작 시각 지정)", runServeReplay},
+	{"serve-grpc", "저장된 데이터를 gRPC 스트림으로 재생 (라이브는 collect -grpc)", runServeGRPC},
 }
 
 func main() {
-	fmt.Printf("%d\n", time.Now().UTC().UnixMilli())
-	fm := NewFileManager()
-	// 자동 재연결을 위한 무한 루프
-	for {
-		runCollector(fm)
-		log.Printf("Disconnected. Reconnecting in 5 seconds...")
-		time.Sleep(5 * time.Second)
+	// 인자가 없으면 기존처럼 수집기로 동작
+	name, args := "collect", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
 	}
-}
 
-func runCollector(fm *FileManager) {
-	var streamNames []string
-	for _, s := range symbols {
-		streamNames = append(streamNames, s+streamSuffix)
-	}
-	fullURL := websocketURL + strings.Join(streamNames, "/")
-
-	conn, _, err := websocket.DefaultDialer.Dial(fullURL, nil)
-	if err != nil {
-		log.Printf("WebSocket dial error: %v", err)
+	if name == "help" {
+		printUsage()
 		return
 	}
-	defer conn.Close()
-
-	conn.SetPingHandler(func(appData string) error {
-		log.Println("Received Ping, sending Pong.")
-		return conn.WriteMessage(websocket.PongMessage, []byte(appData))
-	})
 
-	log.Printf("Connected to combined stream: %s", fullURL)
-
-	for {
-		_, message, err := conn.ReadMessage()
-		if err != nil {
-			log.Printf("WebSocket read error: %v", err)
+	for _, c := range commands {
+		if c.name == name {
+			if err := c.run(args); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+				os.Exit(1)
+			}
 			return
 		}
-		var streamEvent CombinedStreamEvent
-		if err := json.Unmarshal(message, &streamEvent); err != nil {
-			log.Println("Combined stream unmarshal error:", err)
-			continue
-		}
-
-		var snapshot SnapshotEvent
-		if err := json.Unmarshal(streamEvent.Data, &snapshot); err != nil {
-			log.Println("Snapshot data from stream unmarshal error:", err)
-			continue
-		}
-
-		symbolFromStream := strings.Split(streamEvent.Stream, "@")[0]
-
-		fmt.Printf("sym(%s) %d\n", symbolFromStream, time.Now().UTC().UnixMilli())
-
-		// 받은 스냅샷을 Protobuf 메시지로 변환
-		pbSnapshot := &orderbook.Snapshot{
-			EventTime:    time.Now().UTC().UnixMilli(), // 스트림에 타임스탬프가 없으므로 수신 시간 사용
-			LastUpdateId: snapshot.LastUpdateID,
-			Bids:         parseLevels(snapshot.Bids),
-			Asks:         parseLevels(snapshot.Asks),
-		}
-
-		fm.writeSnapshot(symbolFromStream, pbSnapshot)
 	}
+
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+	printUsage()
+	os.Exit(2)
 }
 
-func parseLevels(levels [][2]string) []*orderbook.Level {
-	pbLevels := make([]*orderbook.Level, len(levels))
-	for i, l := range levels {
-		price, _ := strconv.ParseFloat(l[0], 64)
-		qty, _ := strconv.ParseFloat(l[1], 64)
-		pbLevels[i] = &orderbook.Level{Price: price, Quantity: qty}
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "Usage: orderbook <command> [flags]")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", c.name, c.usage)
 	}
-	return pbLevels
 }
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"orderbook/orderbook"
+)
+
+// 데이터 디렉터리의 카탈로그 manifest (<data>/manifest.json). 파일마다 레코드 수, 첫/마지막 이벤트 시각,
+// 출처(거래소, 시장), SHA-256 을 남겨 두어 파일을 다시 읽지 않고 무엇이 있는지 알 수 있다.
+//
+// 수집기는 회전으로 닫힌 파일을 그때그때 더하고, orderbook list 는 manifest 를 보여 준다.
+// list -refresh 는 manifest 와 크기나 수정 시각이 다른 파일(수집 중인 파일, 손으로 옮긴 파일 등)만 다시 읽고
+// 사라진 파일은 뺀다. manifest 가 없으면 처음 list 가 만든다.
+
+const (
+	manifestFile           = "manifest.json"
+	catalogManifestVersion = 1
+)
+
+type catalogManifest struct {
+	Version   int               `json:"version"`
+	UpdatedAt time.Time         `json:"updatedAt"`
+	Symbols   []manifestSymbol  `json:"symbols"`
+	Files     []manifestFileRow `json:"files"` // 경로순
+}
+
+// 심볼별 요약. files 에서 계산한다.
+type manifestSymbol struct {
+	Symbol     string   `json:"symbol"`
+	Exchanges  []string `json:"exchanges,omitempty"` // exchange/marketType
+	FirstEvent int64    `json:"firstEvent"`
+	LastEvent  int64    `json:"lastEvent"`
+	FirstDate  string   `json:"firstDate"`
+	LastDate   string   `json:"lastDate"`
+	Days       int      `json:"days"`
+	Files      int      `json:"files"`
+	Records    int64    `json:"records"`
+	Size       int64    `json:"size"`
+}
+
+type manifestFileRow struct {
+	catalogEntry
+	Exchange   string `json:"exchange,omitempty"`
+	MarketType string `json:"marketType,omitempty"`
+	Records    int64  `json:"records"`
+	FirstEvent int64  `json:"firstEvent,omitempty"`
+	LastEvent  int64  `json:"lastEvent,omitempty"`
+	// 세션 헤더의 구독 스트림과 파일에 들어 있는 stream_type (depth5@1000ms, trade 등)
+	Streams []string `json:"streams,omitempty"`
+	// 세션 헤더의 스냅샷 표본 비율 (N 개 중 1 개). 세션마다 다르면 가장 큰 값
+	SnapshotSample int `json:"snapshotSample,omitempty"`
+	// 신규 상장을 감지해 받기 시작한 시간 (UTC ms)
+	ListedAt int64 `json:"listedAt,omitempty"`
+	// 옵션 계약의 만기 (UTC ms)
+	Expiry int64  `json:"expiry,omitempty"`
+	SHA256 string `json:"sha256"`
+}
+
+func manifestPath(dataDir string) string {
+	return filepath.Join(dataDir, manifestFile)
+}
+
+// 없으면 빈 manifest
+func loadManifest(dataDir string) (*catalogManifest, error) {
+	b, err := os.ReadFile(manifestPath(dataDir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return &catalogManifest{Version: catalogManifestVersion}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var m catalogManifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("%s: %w", manifestPath(dataDir), err)
+	}
+	return &m, nil
+}
+
+// 요약을 다시 계산하고 임시 파일에 쓴 뒤 바꿔치기한다
+func (m *catalogManifest) save(dataDir string) error {
+	sort.Slice(m.Files, func(i, j int) bool { return m.Files[i].Path < m.Files[j].Path })
+	m.Symbols = summarizeManifest(m.Files)
+	m.Version, m.UpdatedAt = catalogManifestVersion, time.Now().UTC()
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := manifestPath(dataDir) + ".tmp"
+	if err := os.WriteFile(tmp, append(b, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, manifestPath(dataDir))
+}
+
+// 같은 경로의 항목을 바꾸거나 더한다
+func (m *catalogManifest) put(row manifestFileRow) {
+	for i := range m.Files {
+		if m.Files[i].Path == row.Path {
+			m.Files[i] = row
+			return
+		}
+	}
+	m.Files = append(m.Files, row)
+}
+
+func summarizeManifest(files []manifestFileRow) []manifestSymbol {
+	var out []manifestSymbol
+	index := make(map[string]int)
+	days := make(map[string]map[string]bool)
+	for _, f := range files {
+		i, ok := index[f.Symbol]
+		if !ok {
+			i = len(out)
+			index[f.Symbol] = i
+			out = append(out, manifestSymbol{Symbol: f.Symbol})
+			days[f.Symbol] = make(map[string]bool)
+		}
+		s := &out[i]
+		if f.Exchange != "" {
+			if src := f.Exchange + "/" + f.MarketType; !slices.Contains(s.Exchanges, src) {
+				s.Exchanges = append(s.Exchanges, src)
+			}
+		}
+		if f.Records > 0 {
+			if s.FirstEvent == 0 || f.FirstEvent < s.FirstEvent {
+				s.FirstEvent = f.FirstEvent
+			}
+			s.LastEvent = max(s.LastEvent, f.LastEvent)
+		}
+		if f.Date != "" {
+			days[f.Symbol][f.Date] = true
+			if s.FirstDate == "" || f.Date < s.FirstDate {
+				s.FirstDate = f.Date
+			}
+			s.LastDate = max(s.LastDate, f.Date)
+		}
+		s.Files++
+		s.Records += f.Records
+		s.Size += f.Size
+	}
+	for i := range out {
+		out[i].Days = len(days[out[i].Symbol])
+		sort.Strings(out[i].Exchanges)
+	}
+	return out
+}
+
+// 파일을 한 번 읽으며 레코드를 세고 해시를 계산한다
+func scanManifestFile(dataDir string, e catalogEntry) (manifestFileRow, error) {
+	row := manifestFileRow{catalogEntry: e}
+	f, err := os.Open(filepath.Join(dataDir, filepath.FromSlash(e.Path)))
+	if err != nil {
+		return row, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	src := io.TeeReader(f, h)
+	if !strings.HasSuffix(e.Path, ".zst") {
+		r := orderbook.NewReader(src)
+		for {
+			ev, err := r.Next()
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			if err != nil {
+				continue // 깨진 레코드는 세지 않는다
+			}
+			if row.Records == 0 {
+				row.FirstEvent = ev.EventTime
+				if hd := r.Header; hd != nil {
+					row.Exchange, row.MarketType = hd.Exchange, hd.MarketType
+				}
+			}
+			row.SnapshotSample = max(row.SnapshotSample, int(r.Header.GetSnapshotSample()))
+			if row.ListedAt == 0 {
+				row.ListedAt = r.Header.GetListedAt()
+			}
+			if row.Expiry == 0 {
+				row.Expiry = r.Header.GetOption().GetExpiryTime()
+			}
+			for _, stream := range r.Header.GetStreams() {
+				if !slices.Contains(row.Streams, stream) {
+					row.Streams = append(row.Streams, stream)
+				}
+			}
+			row.LastEvent = ev.EventTime
+			row.Records++
+			if ev.StreamType != "" && !slices.Contains(row.Streams, ev.StreamType) {
+				row.Streams = append(row.Streams, ev.StreamType)
+			}
+		}
+	}
+	sort.Strings(row.Streams)
+	// 리더가 읽지 않은 나머지 (잘린 꼬리, 압축 보관본 전체)
+	if _, err := io.Copy(h, f); err != nil {
+		return row, err
+	}
+	row.SHA256 = hex.EncodeToString(h.Sum(nil))
+	return row, nil
+}
+
+// manifest 를 디렉터리와 맞춘다. 크기나 수정 시각이 그대로인 파일은 다시 읽지 않는다.
+// 고친 파일 수를 돌려준다.
+func refreshManifest(dataDir string, m *catalogManifest) (int, error) {
+	entries, err := listDataFiles(dataDir)
+	if err != nil {
+		return 0, err
+	}
+	known := make(map[string]manifestFileRow, len(m.Files))
+	for _, f := range m.Files {
+		known[f.Path] = f
+	}
+	var (
+		files   []manifestFileRow
+		changed int
+	)
+	for _, e := range entries {
+		f, ok := known[e.Path]
+		delete(known, e.Path)
+		if ok && f.Size == e.Size && f.ModTime.Equal(e.ModTime) {
+			files = append(files, f)
+			continue
+		}
+		row, err := scanManifestFile(dataDir, e)
+		if err != nil {
+			log.Printf("Manifest: skipping %s: %v", e.Path, err)
+			continue
+		}
+		files = append(files, row)
+		changed++
+	}
+	changed += len(known) // 사라진 파일
+	m.Files = files
+	return changed, nil
+}
+
+// 수집기에서 회전으로 닫힌 파일을 manifest 에 더하고 then 으로 넘긴다 (업로드, 보관 등).
+// 파일을 다시 읽으므로 백그라운드에서 한다.
+type manifestUpdater struct {
+	dataDir string
+	queue   chan string
+	then    func(path string)
+	mu      sync.Mutex
+}
+
+func newManifestUpdater(dataDir string, then func(path string)) *manifestUpdater {
+	return &manifestUpdater{dataDir: dataDir, queue: make(chan string, 1024), then: then}
+}
+
+// fm.onRotate 로 불린다. 막히지 않는다.
+func (u *manifestUpdater) enqueue(path string) {
+	select {
+	case u.queue <- path:
+	default:
+		// 다음 list -refresh 때 들어간다
+		log.Printf("Manifest queue full, skipping %s for now", path)
+		if u.then != nil {
+			u.then(path)
+		}
+	}
+}
+
+func (u *manifestUpdater) run() {
+	for path := range u.queue {
+		if err := u.add(path); err != nil {
+			log.Printf("Manifest: %s: %v", path, err)
+		}
+		if u.then != nil {
+			u.then(path)
+		}
+	}
+}
+
+func (u *manifestUpdater) add(path string) error {
+	rel, err := filepath.Rel(u.dataDir, path)
+	if err != nil {
+		return err
+	}
+	rel = filepath.ToSlash(rel)
+	symbol, name, ok := strings.Cut(rel, "/")
+	if !ok {
+		return fmt.Errorf("not under a symbol directory")
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	row, err := scanManifestFile(u.dataDir, catalogEntry{
+		Symbol:   symbol,
+		Date:     fileDate(name),
+		Instance: fileInstance(name),
+		Session:  fileSession(name),
+		Path:     rel,
+		Size:     fi.Size(),
+		ModTime:  fi.ModTime().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	m, err := loadManifest(u.dataDir)
+	if err != nil {
+		return err
+	}
+	m.put(row)
+	return m.save(u.dataDir)
+}
+
+// orderbook list : manifest 로 데이터 디렉터리에 무엇이 있는지 보여 준다.
+func runList(args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	dataDir := fs.String("data", defaultDataDir, "data directory")
+	refresh := fs.Bool("refresh", false, "rescan files whose size or modification time changed since the manifest was written")
+	files := fs.Bool("files", false, "list every file instead of one line per symbol")
+	symbol := fs.String("symbol", "", "only this symbol")
+	asJSON := fs.Bool("json", false, "print the manifest as JSON")
+	registerTZ(fs)
+	fs.Parse(args)
+
+	m, err := loadManifest(*dataDir)
+	if err != nil {
+		return err
+	}
+	if *refresh || m.UpdatedAt.IsZero() {
+		n, err := refreshManifest(*dataDir, m)
+		if err != nil {
+			return err
+		}
+		if err := m.save(*dataDir); err != nil {
+			return err
+		}
+		log.Printf("Updated %s (%d file(s) changed)", manifestPath(*dataDir), n)
+	}
+	if *symbol != "" {
+		want := strings.ToLower(*symbol)
+		var kept []manifestFileRow
+		for _, f := range m.Files {
+			if f.Symbol == want {
+				kept = append(kept, f)
+			}
+		}
+		m.Files, m.Symbols = kept, summarizeManifest(kept)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(m)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if *files {
+		fmt.Fprintln(tw, "PATH\tRECORDS\tFIRST\tLAST\tSIZE\tSTREAMS\tSHA256")
+		for _, f := range m.Files {
+			streams := strings.Join(f.Streams, ",")
+			if streams == "" {
+				streams = "-"
+			}
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\t%s\n", f.Path, f.Records, manifestTime(f.FirstEvent), manifestTime(f.LastEvent), formatBytes(f.Size), streams, f.SHA256[:min(12, len(f.SHA256))])
+		}
+	} else {
+		fmt.Fprintln(tw, "SYMBOL\tSOURCE\tFIRST\tLAST\tDAYS\tFILES\tRECORDS\tSIZE")
+		for _, s := range m.Symbols {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%d\t%d\t%s\n", s.Symbol, strings.Join(s.Exchanges, ","), manifestTime(s.FirstEvent), manifestTime(s.LastEvent), s.Days, s.Files, s.Records, formatBytes(s.Size))
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	log.Printf("Manifest updated at %s", formatMillis(m.UpdatedAt.UnixMilli()))
+	return nil
+}
+
+func manifestTime(ms int64) string {
+	if ms == 0 {
+		return "-"
+	}
+	return formatMillis(ms)
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"google.golang.org/protobuf/proto"
+	"orderbook/orderbook"
+)
+
+// nats:// 이벤트를 NATS JetStream 에 <prefix>.<exchange>.<market>.<symbol> 주제로 보낸다.
+//
+//	nats://[user:password@]host:4222[,host2:4222]/?stream=ORDERBOOK&prefix=orderbook&max-age=72h&max-bytes=50GB&replicas=1&storage=file
+//
+// 예: orderbook.binance.spot.ethusdt. 시작할 때 스트림을 만들거나 설정을 맞춘다 (manage=false 면 있는지만 확인).
+// 적어도 한 번(at-least-once) 전달: 비동기로 보내고 ack 를 받지 못한 메시지는 다시 보낸다.
+// 메시지마다 Nats-Msg-Id 를 달아 중복 창(duplicate-window, 기본 2m) 안의 재전송은 서버가 걸러 낸다.
+// 그래도 못 보낸 메시지는 다음 Publish 에서 오류로 돌려준다.
+// 본문은 Event protobuf, 원래 타임스탬프는 헤더(eventHeaders)에 싣는다. creds= 로 NATS 자격 증명 파일을 쓸 수 있다.
+
+func init() {
+	registerSink("nats", openNATSSink)
+}
+
+const natsPublishRetries = 3
+
+type natsSink struct {
+	nc     *nats.Conn
+	js     jetstream.JetStream
+	stream string
+	prefix string
+
+	retries chan *nats.Msg
+	wg      sync.WaitGroup
+
+	mu      sync.Mutex
+	lastErr error // 재전송까지 실패한 메시지. 다음 Publish 에서 돌려준다
+	lost    int
+	closing bool // retries 를 닫았다
+}
+
+func openNATSSink(u *url.URL) (Sink, error) {
+	q := u.Query()
+	stream := q.Get("stream")
+	if stream == "" {
+		stream = "ORDERBOOK"
+	}
+	prefix := q.Get("prefix")
+	if prefix == "" {
+		prefix = "orderbook"
+	}
+	cfg := jetstream.StreamConfig{
+		Name:       stream,
+		Subjects:   []string{prefix + ".>"},
+		Storage:    jetstream.FileStorage,
+		Replicas:   1,
+		MaxAge:     72 * time.Hour,
+		Duplicates: 2 * time.Minute,
+	}
+	if v := q.Get("max-age"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("nats: invalid max-age %q", v)
+		}
+		cfg.MaxAge = d
+	}
+	if v := q.Get("max-bytes"); v != "" {
+		n, err := parseBytes(v)
+		if err != nil {
+			return nil, fmt.Errorf("nats: invalid max-bytes %q", v)
+		}
+		cfg.MaxBytes = n
+	}
+	if v := q.Get("replicas"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("nats: invalid replicas %q", v)
+		}
+		cfg.Replicas = n
+	}
+	if v := q.Get("duplicate-window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("nats: invalid duplicate-window %q", v)
+		}
+		cfg.Duplicates = d
+	}
+	switch v := q.Get("storage"); v {
+	case "", "file":
+	case "memory":
+		cfg.Storage = jetstream.MemoryStorage
+	default:
+		return nil, fmt.Errorf("nats: invalid storage %q (file, memory)", v)
+	}
+	maxPending := 4096
+	if v := q.Get("inflight"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("nats: invalid inflight %q", v)
+		}
+		maxPending = n
+	}
+
+	opts := []nats.Option{nats.Name("orderbook"), nats.MaxReconnects(-1)}
+	if u.User != nil {
+		password, _ := u.User.Password()
+		opts = append(opts, nats.UserInfo(u.User.Username(), password))
+	}
+	if v := q.Get("creds"); v != "" {
+		opts = append(opts, nats.UserCredentials(v))
+	}
+	var servers []string
+	for _, h := range strings.Split(u.Host, ",") {
+		servers = append(servers, "nats://"+h)
+	}
+	nc, err := nats.Connect(strings.Join(servers, ","), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("nats: %w", err)
+	}
+
+	s := &natsSink{nc: nc, stream: stream, prefix: prefix, retries: make(chan *nats.Msg, maxPending)}
+	s.js, err = jetstream.New(nc,
+		jetstream.WithPublishAsyncMaxPending(maxPending),
+		jetstream.WithPublishAsyncTimeout(10*time.Second),
+		jetstream.WithPublishAsyncErrHandler(s.asyncFailed))
+	if err != nil {
+		nc.Close()
+		return nil, fmt.Errorf("nats: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if manage, err := strconv.ParseBool(q.Get("manage")); err != nil || manage {
+		_, err = s.js.CreateOrUpdateStream(ctx, cfg)
+	} else {
+		_, err = s.js.Stream(ctx, stream)
+	}
+	if err != nil {
+		nc.Close()
+		return nil, fmt.Errorf("nats: stream %s: %w", stream, err)
+	}
+
+	s.wg.Add(1)
+	go s.runRetries()
+	return s, nil
+}
+
+// 주제에 쓸 수 없는 문자(. * > 공백)는 _ 로 바꾼다
+func natsToken(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', '*', '>', ' ', '\t':
+			return '_'
+		}
+		return r
+	}, strings.ToLower(s))
+}
+
+func (s *natsSink) subject(ev *orderbook.Event) string {
+	exchange, market := ev.Exchange, ev.MarketType
+	if exchange == "" {
+		exchange = exchangeName
+	}
+	if market == "" {
+		market = marketType
+	}
+	return s.prefix + "." + natsToken(exchange) + "." + natsToken(market) + "." + natsToken(ev.Symbol)
+}
+
+func (s *natsSink) Publish(ev *orderbook.Event) error {
+	s.mu.Lock()
+	if err := s.lastErr; err != nil {
+		err = fmt.Errorf("nats: %d messages not delivered: %w", s.lost, err)
+		s.lastErr, s.lost = nil, 0
+		s.mu.Unlock()
+		return err
+	}
+	s.mu.Unlock()
+
+	data, err := proto.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	msg := nats.NewMsg(s.subject(ev))
+	msg.Data = data
+	for k, v := range eventHeaders(ev, replaying) {
+		msg.Header.Set(k, v)
+	}
+	// 같은 이벤트를 다시 보내면 같은 ID 가 되도록 내용으로 만든다. 순번은 세션마다 다시 시작하므로 그것만으로는 부족하다
+	h := fnv.New64a()
+	h.Write(data)
+	msg.Header.Set(jetstream.MsgIDHeader, fmt.Sprintf("%s-%d-%d-%x", strings.ToLower(ev.Symbol), ev.EventTime, ev.Sequence, h.Sum64()))
+	// 보낼 수 있는 개수(inflight)가 차 있으면 ack 가 올 때까지 기다린다
+	_, err = s.js.PublishMsgAsync(msg, jetstream.WithExpectStream(s.stream))
+	return err
+}
+
+// ack 를 받지 못한 메시지를 재전송 고루틴으로 넘긴다. nats 의 콜백 고루틴이라 막히면 안 된다.
+func (s *natsSink) asyncFailed(_ jetstream.JetStream, msg *nats.Msg, err error) {
+	s.mu.Lock()
+	queued := false
+	if !s.closing {
+		select {
+		case s.retries <- msg:
+			queued = true
+		default:
+		}
+	}
+	s.mu.Unlock()
+	if !queued {
+		s.fail(err)
+	}
+}
+
+func (s *natsSink) runRetries() {
+	defer s.wg.Done()
+	for msg := range s.retries {
+		var err error
+		for attempt := range natsPublishRetries {
+			if attempt > 0 {
+				time.Sleep(time.Duration(attempt) * time.Second)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			_, err = s.js.PublishMsg(ctx, msg, jetstream.WithExpectStream(s.stream))
+			cancel()
+			if err == nil {
+				break
+			}
+		}
+		if err != nil {
+			s.fail(err)
+		}
+	}
+}
+
+func (s *natsSink) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lastErr == nil {
+		log.Printf("NATS publish to stream %s failed: %v", s.stream, err)
+	}
+	s.lastErr = err
+	s.lost++
+}
+
+func (s *natsSink) Close() error {
+	select {
+	case <-s.js.PublishAsyncComplete():
+	case <-time.After(30 * time.Second):
+		s.fail(errors.New("timed out waiting for acks"))
+	}
+	s.mu.Lock()
+	s.closing = true
+	close(s.retries)
+	s.mu.Unlock()
+	s.wg.Wait()
+	s.nc.Drain()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lastErr != nil {
+		return fmt.Errorf("nats: %d messages not delivered: %w", s.lost, s.lastErr)
+	}
+	return nil
+}
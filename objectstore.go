@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3 호환 오브젝트 스토리지 클라이언트 (AWS S3, GCS 의 XML API + HMAC 키, MinIO 등).
+// 필요한 요청이 몇 개뿐이라 SDK 대신 SigV4 서명을 직접 한다.
+//
+//	s3://bucket/prefix?region=ap-northeast-2[&endpoint=http://minio:9000]
+//	gs://bucket/prefix
+//
+// 자격 증명은 AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN 에서 읽는다
+// (GCS 는 HMAC 키를 같은 변수에 넣는다).
+
+type objectStore struct {
+	endpoint  *url.URL // 비어 있으면 AWS 가상 호스트 방식
+	region    string
+	bucket    string
+	prefix    string
+	accessKey string
+	secretKey string
+	token     string
+	client    *http.Client
+}
+
+func openObjectStore(spec string) (*objectStore, error) {
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+	s := &objectStore{
+		bucket:    u.Host,
+		prefix:    strings.Trim(u.Path, "/"),
+		region:    u.Query().Get("region"),
+		accessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		token:     os.Getenv("AWS_SESSION_TOKEN"),
+		client:    &http.Client{Timeout: 10 * time.Minute},
+	}
+	switch u.Scheme {
+	case "s3":
+		if s.region == "" {
+			s.region = os.Getenv("AWS_REGION")
+		}
+		if s.region == "" {
+			s.region = "us-east-1"
+		}
+	case "gs":
+		s.region = "auto"
+		s.endpoint = &url.URL{Scheme: "https", Host: "storage.googleapis.com"}
+	default:
+		return nil, fmt.Errorf("unsupported object store %q (use s3:// or gs://)", u.Scheme)
+	}
+	if ep := u.Query().Get("endpoint"); ep != "" {
+		if s.endpoint, err = url.Parse(ep); err != nil {
+			return nil, err
+		}
+	}
+	if s.bucket == "" {
+		return nil, fmt.Errorf("object store %q: missing bucket", spec)
+	}
+	if s.accessKey == "" || s.secretKey == "" {
+		return nil, fmt.Errorf("object store credentials not set (AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY)")
+	}
+	return s, nil
+}
+
+// prefix 를 붙인 오브젝트 키
+func (s *objectStore) key(name string) string {
+	if s.prefix == "" {
+		return name
+	}
+	return s.prefix + "/" + name
+}
+
+// 보내는 경로와 서명하는 경로가 같도록 RawPath 를 SigV4 규칙으로 인코딩해 둔다
+func (s *objectStore) objectURL(key string) *url.URL {
+	var u url.URL
+	if s.endpoint != nil {
+		u = *s.endpoint
+		u.Path = strings.TrimRight(u.Path, "/") + "/" + s.bucket + "/" + key
+	} else {
+		u = url.URL{Scheme: "https", Host: s.bucket + ".s3." + s.region + ".amazonaws.com", Path: "/" + key}
+	}
+	u.RawPath = uriEncode(u.Path, false)
+	return &u
+}
+
+// body 를 key 에 올린다. Content-MD5 와 서명된 SHA-256 으로 스토리지가 내용을 검증하게 한다.
+func (s *objectStore) Put(ctx context.Context, key string, body io.ReadSeeker, size int64, md5b64, sha256hex string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.objectURL(key).String(), body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-MD5", md5b64)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := s.do(req, sha256hex)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// 오브젝트 크기. 없으면 -1.
+func (s *objectStore) Size(ctx context.Context, key string) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, s.objectURL(key).String(), nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := s.do(req, emptySHA256)
+	if err != nil {
+		if se, ok := err.(*storeError); ok && se.Status == http.StatusNotFound {
+			return -1, nil
+		}
+		return 0, err
+	}
+	resp.Body.Close()
+	return strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+}
+
+// 오브젝트 내용. 호출자가 닫는다.
+func (s *objectStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.objectURL(key).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(req, emptySHA256)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+type storeObject struct {
+	Key  string `xml:"Key"`
+	Size int64  `xml:"Size"`
+}
+
+// prefix 로 시작하는 오브젝트들 (키 순). ListObjectsV2 를 끝까지 넘긴다.
+func (s *objectStore) List(ctx context.Context, prefix string) ([]storeObject, error) {
+	var (
+		objects []storeObject
+		token   string
+	)
+	for {
+		u := s.objectURL("")
+		q := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		u.RawQuery = canonicalQuery(q)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := s.do(req, emptySHA256)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Contents              []storeObject `xml:"Contents"`
+			IsTruncated           bool          `xml:"IsTruncated"`
+			NextContinuationToken string        `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("object store list: %w", err)
+		}
+		objects = append(objects, page.Contents...)
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+type storeError struct {
+	Status int
+	Body   string
+}
+
+func (e *storeError) Error() string {
+	return fmt.Sprintf("object store: %d %s", e.Status, e.Body)
+}
+
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+func (s *objectStore) do(req *http.Request, payloadHash string) (*http.Response, error) {
+	if s.token != "" {
+		req.Header.Set("X-Amz-Security-Token", s.token)
+	}
+	signV4(req, payloadHash, s.accessKey, s.secretKey, s.region, "s3", time.Now())
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		return nil, &storeError{Status: resp.StatusCode, Body: strings.TrimSpace(string(b))}
+	}
+	return resp, nil
+}
+
+// AWS Signature Version 4. host, content-*, range, x-amz-* 헤더를 서명에 넣는다.
+func signV4(req *http.Request, payloadHash, accessKey, secretKey, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		lk := strings.ToLower(k)
+		if strings.HasPrefix(lk, "x-amz-") || strings.HasPrefix(lk, "content-") || lk == "range" {
+			headers[lk] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonHeaders strings.Builder
+	for _, k := range names {
+		canonHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonRequest := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.Path, false),
+		canonicalQuery(req.URL.Query()),
+		canonHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	crHash := sha256.Sum256([]byte(canonRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(crHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	sig := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+sig)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// SigV4 규칙의 URI 인코딩: 비예약 문자 외에는 모두 %XX
+func uriEncode(p string, encodeSlash bool) string {
+	if p == "" && !encodeSlash {
+		return "/"
+	}
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		vs := append([]string(nil), q[k]...)
+		sort.Strings(vs)
+		for _, v := range vs {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"orderbook/orderbook"
+)
+
+// 바이낸스 유럽형 옵션 (-endpoint options: nbstream.binance.com, eapi.binance.com).
+//
+// 심볼은 BTC-240329-60000-C 처럼 기초 자산, 만기일(YYMMDD), 행사가, 콜/풋(C, P)을 잇는다.
+// 스트림 이름에는 대문자로 쓰고 (BTC-240329-60000-C@depth10@100ms), 수집기 안(-symbols, 파일 이름)에서는
+// 다른 시장처럼 소문자로 다룬다. partial depth 는 depth10, depth20, depth50, depth100 이고 선물처럼 u, b, a 키로 온다.
+//
+// 세션 헤더(FileHeader.option)에 계약 조건을 남긴다. exchangeInfo 의 optionSymbols 를 받아 두었으면 그 값을,
+// 없으면 심볼 이름에서 읽은 값을 쓴다.
+
+const optionsMarket = "options"
+
+// 스트림 이름에 쓰는 심볼 표기. 옵션만 대문자다.
+func streamSymbol(symbol string) string {
+	if marketType == optionsMarket {
+		return strings.ToUpper(symbol)
+	}
+	return symbol
+}
+
+// 심볼 이름에서 읽은 계약 조건. 옵션 심볼이 아니면 nil.
+// 이름에는 시각이 없으므로 만기는 바이낸스 옵션의 정산 시각인 만기일 08:00 UTC 로 둔다.
+// 기초 자산은 USDT 로 정산하는 지수(BTCUSDT 등)다.
+func parseOptionSymbol(symbol string) *orderbook.OptionContract {
+	parts := strings.Split(strings.ToUpper(symbol), "-")
+	if len(parts) != 4 || parts[0] == "" {
+		return nil
+	}
+	expiry, err := time.Parse("060102", parts[1])
+	if err != nil {
+		return nil
+	}
+	if _, err := strconv.ParseFloat(parts[2], 64); err != nil {
+		return nil
+	}
+	var side string
+	switch parts[3] {
+	case "C":
+		side = "CALL"
+	case "P":
+		side = "PUT"
+	default:
+		return nil
+	}
+	return &orderbook.OptionContract{
+		Underlying:  parts[0] + "USDT",
+		StrikePrice: parts[2],
+		ExpiryTime:  expiry.Add(8 * time.Hour).UnixMilli(),
+		Side:        side,
+	}
+}
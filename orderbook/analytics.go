@@ -0,0 +1,68 @@
+package orderbook
+
+import "math"
+
+// 스냅샷(또는 Book.TopBids/TopAsks)에서 흔히 뽑는 특징값. 호가는 최우선부터 정렬되어 있어야 한다.
+
+// 상위 levels 개 호가의 가중 불균형 (-1..1). 매수 쪽 수량이 많을수록 1 에 가깝다.
+// i 번째(0 부터) 호가의 가중치는 decay^i 로, decay 가 1 이면 모든 호가를 똑같이 센다.
+// 양쪽 다 비어 있으면 NaN.
+func Imbalance(bids, asks []*Level, levels int, decay float64) float64 {
+	var bid, ask float64
+	w := 1.0
+	for i := 0; i < levels; i++ {
+		if i < len(bids) {
+			bid += w * bids[i].Quantity
+		}
+		if i < len(asks) {
+			ask += w * asks[i].Quantity
+		}
+		w *= decay
+	}
+	if bid+ask == 0 {
+		return math.NaN()
+	}
+	return (bid - ask) / (bid + ask)
+}
+
+// 최우선 호가 수량으로 가중한 중간가. 반대쪽 수량이 많을수록 그쪽 가격에서 멀어진다.
+// 한쪽이라도 비어 있으면 NaN.
+func Microprice(bids, asks []*Level) float64 {
+	if len(bids) == 0 || len(asks) == 0 {
+		return math.NaN()
+	}
+	b, a := bids[0], asks[0]
+	if b.Quantity+a.Quantity == 0 {
+		return (b.Price + a.Price) / 2
+	}
+	return (b.Price*a.Quantity + a.Price*b.Quantity) / (b.Quantity + a.Quantity)
+}
+
+// 최우선 호가의 중간가. 한쪽이라도 비어 있으면 NaN.
+func Mid(bids, asks []*Level) float64 {
+	if len(bids) == 0 || len(asks) == 0 {
+		return math.NaN()
+	}
+	return (bids[0].Price + asks[0].Price) / 2
+}
+
+// mid 에서 bps 이내에 있는 호가의 수량 합과 금액(가격 x 수량) 합.
+// bid 면 levels 를 매수 호가로 보고 mid 아래 bps 까지, 아니면 매도 호가로 보고 위로 bps 까지 센다.
+// 기록된 호가가 밴드 끝에 닿지 못하면(depth20 등) 실제보다 작게 나온다.
+func LiquidityWithin(levels []*Level, mid, bps float64, bid bool) (quantity, notional float64) {
+	if math.IsNaN(mid) {
+		return math.NaN(), math.NaN()
+	}
+	limit := mid * (1 + bps/1e4)
+	if bid {
+		limit = mid * (1 - bps/1e4)
+	}
+	for _, l := range levels {
+		if bid && l.Price < limit || !bid && l.Price > limit {
+			break
+		}
+		quantity += l.Quantity
+		notional += l.Price * l.Quantity
+	}
+	return quantity, notional
+}
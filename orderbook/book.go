@@ -0,0 +1,137 @@
+package orderbook
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var ErrSequenceGap = errors.New("depth update sequence gap")
+
+// 수집기가 (재)연결 직후 REST depth 엔드포인트에서 받아 기록한 스냅샷의 stream_type
+const RESTSnapshotStreamType = "rest/depth"
+
+// compact 가 증분(depth@...)으로 재구성한 책 전체를 일정 간격으로 끼워 넣은 스냅샷의 stream_type.
+// 거래소에서 받은 레코드가 아니며, 이 스냅샷부터 뒤의 증분을 이어 적용할 수 있다.
+const CheckpointStreamType = "checkpoint/depth"
+
+// import-vendor 가 외부 업체 데이터(Tardis 등)의 책 전체 스냅샷을 옮긴 레코드의 stream_type.
+// 뒤의 증분(depth@<업체>)은 업체 데이터에 없는 update id 를 import-vendor 가 이어 붙여 이 스냅샷부터 적용된다.
+const VendorSnapshotStreamType = "vendor/depth"
+
+// REST, 체크포인트, 업체 스냅샷처럼 거래소 스트림이 아니라 책 전체를 담은 스냅샷인지
+func IsFullBookSnapshot(streamType string) bool {
+	return streamType == RESTSnapshotStreamType || streamType == CheckpointStreamType || streamType == VendorSnapshotStreamType
+}
+
+// 스냅샷과 증분(DepthDiff)으로 재구성하는 오더북
+type Book struct {
+	Bids         map[float64]float64 // 가격(key)과 수량(value)
+	Asks         map[float64]float64
+	LastUpdateID int64
+
+	// 스냅샷 이후 첫 증분이 연결되었는지. 첫 증분만 U <= lastUpdateId+1 <= u 규칙을 따른다.
+	synced bool
+}
+
+func NewBook() *Book {
+	return &Book{
+		Bids: make(map[float64]float64),
+		Asks: make(map[float64]float64),
+	}
+}
+
+// 스냅샷으로 책 전체를 교체한다
+func (b *Book) LoadSnapshot(s *Snapshot) {
+	clear(b.Bids)
+	clear(b.Asks)
+	for _, l := range s.Bids {
+		b.Bids[l.Price] = l.Quantity
+	}
+	for _, l := range s.Asks {
+		b.Asks[l.Price] = l.Quantity
+	}
+	b.LastUpdateID = s.LastUpdateId
+	b.synced = false
+}
+
+// 바이낸스 로컬 오더북 규칙에 따라 증분을 적용한다.
+// 이미 반영된 증분이면 false, 순서가 끊겼으면 ErrSequenceGap 을 돌려주고 책은 그대로 둔다.
+func (b *Book) ApplyDiff(d *DepthDiff) (bool, error) {
+	if ok, err := DiffFollows(d, b.LastUpdateID, b.synced); !ok {
+		return false, err
+	}
+	applyLevels(b.Bids, d.Bids)
+	applyLevels(b.Asks, d.Asks)
+	b.LastUpdateID = d.FinalUpdateId
+	b.synced = true
+	return true, nil
+}
+
+// 증분 d 가 lastUpdateID 까지 반영한 책에 이어지는지 (ApplyDiff 의 규칙). synced 는 스냅샷 뒤에 증분을 하나라도 적용했는지다.
+// 책을 따로 관리하는 쪽(LOBSTER export 등)이 같은 규칙을 쓰도록 공개한다.
+func DiffFollows(d *DepthDiff, lastUpdateID int64, synced bool) (bool, error) {
+	if d.FinalUpdateId <= lastUpdateID {
+		return false, nil
+	}
+	switch {
+	case !synced:
+		if d.FirstUpdateId > lastUpdateID+1 {
+			return false, fmt.Errorf("%w: first update %d after snapshot %d", ErrSequenceGap, d.FirstUpdateId, lastUpdateID)
+		}
+	case d.PrevFinalUpdateId != 0: // 선물은 pu 로 연결을 확인한다
+		if d.PrevFinalUpdateId != lastUpdateID {
+			return false, fmt.Errorf("%w: pu %d, expected %d", ErrSequenceGap, d.PrevFinalUpdateId, lastUpdateID)
+		}
+	default:
+		if d.FirstUpdateId != lastUpdateID+1 {
+			return false, fmt.Errorf("%w: U %d, expected %d", ErrSequenceGap, d.FirstUpdateId, lastUpdateID+1)
+		}
+	}
+	return true, nil
+}
+
+func applyLevels(side map[float64]float64, levels []*Level) {
+	for _, l := range levels {
+		if l.Quantity == 0 {
+			delete(side, l.Price)
+		} else {
+			side[l.Price] = l.Quantity
+		}
+	}
+}
+
+// 책 전체를 스냅샷으로 (가격 순 정렬)
+func (b *Book) Snapshot() *Snapshot {
+	return &Snapshot{LastUpdateId: b.LastUpdateID, Bids: b.TopBids(0), Asks: b.TopAsks(0)}
+}
+
+// 가격이 높은 순으로 최대 n 개 (n <= 0 이면 전부)
+func (b *Book) TopBids(n int) []*Level {
+	return topLevels(b.Bids, n, true)
+}
+
+// 가격이 낮은 순으로 최대 n 개 (n <= 0 이면 전부)
+func (b *Book) TopAsks(n int) []*Level {
+	return topLevels(b.Asks, n, false)
+}
+
+func topLevels(side map[float64]float64, n int, desc bool) []*Level {
+	prices := make([]float64, 0, len(side))
+	for p := range side {
+		prices = append(prices, p)
+	}
+	if desc {
+		sort.Sort(sort.Reverse(sort.Float64Slice(prices)))
+	} else {
+		sort.Float64s(prices)
+	}
+	if n > 0 && n < len(prices) {
+		prices = prices[:n]
+	}
+	levels := make([]*Level, len(prices))
+	for i, p := range prices {
+		levels[i] = &Level{Price: p, Quantity: side[p]}
+	}
+	return levels
+}
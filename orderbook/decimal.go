@@ -0,0 +1,25 @@
+package orderbook
+
+import "strconv"
+
+// 가격/수량의 10진 문자열. collect -keep-decimals 로 기록한 파일에는 거래소가 보낸 원래 문자열이
+// *_text 필드에 있으므로 그대로 쓰고, 없으면(이전 파일) double 을 가장 짧은 10진 표기로 바꾼다.
+// 후자는 "0.05000000" 같은 뒷자리 0 을 잃는다.
+
+func DecimalText(text string, v float64) string {
+	if text != "" {
+		return text
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// DecimalText 를 b 에 붙인다 (CSV 처럼 한 줄씩 만드는 출력용)
+func AppendDecimal(b []byte, text string, v float64) []byte {
+	if text != "" {
+		return append(b, text...)
+	}
+	return strconv.AppendFloat(b, v, 'f', -1, 64)
+}
+
+func (l *Level) PriceString() string    { return DecimalText(l.GetPriceText(), l.GetPrice()) }
+func (l *Level) QuantityString() string { return DecimalText(l.GetQuantityText(), l.GetQuantity()) }
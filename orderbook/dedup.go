@@ -0,0 +1,119 @@
+package orderbook
+
+import "google.golang.org/protobuf/proto"
+
+// 바뀌지 않은 스냅샷 줄이기. 조용한 시간에는 depth20@100ms 스냅샷이 같은 lastUpdateId 로 계속 오므로
+// 같은 블록 안에서 직전 스냅샷(같은 stream_type)과 lastUpdateId 가 같으면 쓰지 않거나(DedupSkip)
+// 책 없이 시각과 순번만 담은 표시 레코드(DedupMarker)로 바꿔 쓴다.
+//
+// 표시는 Record{type: UnchangedRecordType} 이다. Reader 가 같은 세션의 직전 스냅샷을 복사해 그 시각의
+// 스냅샷으로 돌려주므로 읽는 쪽은 차이를 모른다. 블록마다 첫 스냅샷은 온전히 쓰므로 인덱스로 블록 중간부터
+// 읽어도 풀 수 있다. 표시를 모르는 구버전 도구에는 디코더 없는 Record 로 보인다.
+//
+// DedupSkip 은 건너뛴 스냅샷의 순번이 비므로 SequenceChecker 에는 유실로 보인다. 순번을 지키려면 DedupMarker 를 쓴다.
+
+type DedupMode int
+
+const (
+	DedupOff DedupMode = iota
+	DedupSkip
+	DedupMarker
+)
+
+const UnchangedRecordType = "orderbook.unchanged"
+
+// 블록 안에서 stream_type 별로 마지막에 온전히 쓴 스냅샷의 lastUpdateId 를 기억한다
+type snapshotDedup struct {
+	last map[string]int64
+}
+
+// 쓸 이벤트를 돌려준다. 건너뛸 것이면 nil. blockStart 면 기억을 지우고 새로 시작한다.
+func (d *snapshotDedup) filter(mode DedupMode, e *Event, blockStart bool) *Event {
+	if blockStart || d.last == nil {
+		d.last = make(map[string]int64)
+	}
+	s := e.GetSnapshot()
+	if s == nil || s.LastUpdateId == 0 {
+		return e
+	}
+	if id, ok := d.last[e.StreamType]; !ok || id != s.LastUpdateId {
+		d.last[e.StreamType] = s.LastUpdateId
+		return e
+	}
+	if mode == DedupSkip {
+		return nil
+	}
+	return &Event{
+		EventTime:     e.EventTime,
+		Sequence:      e.Sequence,
+		Symbol:        e.Symbol,
+		Exchange:      e.Exchange,
+		MarketType:    e.MarketType,
+		StreamType:    e.StreamType,
+		ExchangeTime:  e.ExchangeTime,
+		ReceiveTimeNs: e.ReceiveTimeNs,
+		LatencyUs:     e.LatencyUs,
+		Payload:       &Event_Record{Record: &Record{Type: UnchangedRecordType}},
+	}
+}
+
+// Reader 가 stream_type 별로 기억하는 직전 스냅샷. 프레임을 그대로 읽은 스냅샷은 buf 만 두었다가 필요할 때 풀고,
+// 델타로 만든 스냅샷은 snap 에 둔다. 호출한 쪽에는 언제나 복사본을 돌려주므로 고쳐도 영향이 없다.
+type lastSnapshot struct {
+	buf  []byte
+	snap *Snapshot
+}
+
+func (l *lastSnapshot) get() *Snapshot {
+	if l.snap == nil {
+		var full Event
+		if err := proto.Unmarshal(l.buf, &full); err != nil {
+			return nil
+		}
+		l.snap = full.GetSnapshot()
+	}
+	return l.snap
+}
+
+// 읽은 이벤트가 표시(UnchangedRecordType)나 델타(DeltaRecordType)면 세션의 직전 스냅샷으로 풀어 스냅샷으로 바꾸고,
+// 스냅샷이면 그 프레임(buf)을 기억해 둔다. 직전 스냅샷이 없으면(세션 중간부터 읽는 등) Record 그대로 둔다.
+func (r *Reader) expandSnapshot(e *Event, buf []byte) {
+	switch p := e.Payload.(type) {
+	case *Event_Snapshot:
+		if r.snapshots == nil {
+			r.snapshots = make(map[string]*lastSnapshot)
+		}
+		r.snapshots[e.StreamType] = &lastSnapshot{buf: buf}
+	case *Event_Record:
+		t := p.Record.GetType()
+		if t != UnchangedRecordType && t != DeltaRecordType {
+			return
+		}
+		last, ok := r.snapshots[e.StreamType]
+		if !ok {
+			return
+		}
+		base := last.get()
+		if base == nil {
+			return
+		}
+		if t == DeltaRecordType {
+			var d Snapshot
+			if err := proto.Unmarshal(p.Record.GetData(), &d); err != nil {
+				return
+			}
+			applyDelta(base, &d)
+		}
+		s := proto.Clone(base).(*Snapshot)
+		s.EventTime = e.EventTime
+		e.Payload = &Event_Snapshot{Snapshot: s}
+	}
+}
+
+// 파일을 다시 열어 이어 읽을 때(tail) 앞 Reader 가 기억한 직전 스냅샷을 넘겨받는다.
+// 블록 중간의 프레임부터 다시 읽어도 표시를 풀 수 있게 한다. 같은 세션을 읽고 있을 때만 넘겨받는다.
+func (r *Reader) InheritSnapshots(prev *Reader) {
+	if prev != nil && prev.headerOffset == r.headerOffset {
+		r.snapshots = prev.snapshots
+	}
+}
@@ -0,0 +1,149 @@
+package orderbook
+
+import (
+	"sort"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// 스냅샷 델타 저장. 상위 20 호가는 100ms 마다 일부만 바뀌므로, stream_type 별로 DeltaEvery 개(또는 DeltaInterval)마다
+// 스냅샷을 온전히 쓰고 그 사이는 직전 스냅샷에서 바뀐 호가만 쓴다. 블록이 시작되면 다시 온전한 스냅샷부터 쓴다.
+//
+// 델타는 Record{type: DeltaRecordType, encoding: proto} 이고 data 는 바뀐 호가만 담은 Snapshot 이다.
+// 새로 생기거나 수량(또는 원래 문자열)이 바뀐 호가는 그대로, 사라진 호가는 수량 0 으로 담는다.
+// Reader 가 직전 스냅샷에 적용해 온전한 스냅샷으로 돌려주므로 읽는 쪽은 차이를 모른다 (dedup.go 의 expandSnapshot).
+//
+// Writer 는 델타를 적용한 결과가 원래 스냅샷과 같은지 확인하고, 다르거나(정렬되지 않은 호가 등) 델타가 더 크면
+// 온전한 스냅샷을 쓴다. Write 한 스냅샷은 다음 델타의 기준이 되므로 Write 뒤에 고치면 안 된다.
+// zstd 블록은 이미 반복되는 호가를 잘 줄이므로 효과는 주로 비압축 파일에서 크다.
+
+const DeltaRecordType = "orderbook.delta"
+
+// 블록 안에서 stream_type 별로 마지막에 쓴 스냅샷, 그 뒤로 쓴 델타 수, 마지막 온전한 스냅샷의 시각
+type snapshotDelta struct {
+	last   map[string]*Snapshot
+	deltas map[string]int
+	fullAt map[string]int64
+}
+
+// 쓸 이벤트를 돌려준다. 스냅샷이면 델타 Record 로 바뀔 수 있다. every 가 1 이하이거나 intervalMs 가 0 이면 그 기준은 쓰지 않는다.
+func (d *snapshotDelta) encode(every int, intervalMs int64, e *Event, blockStart bool) *Event {
+	if blockStart || d.last == nil {
+		d.last = make(map[string]*Snapshot)
+		d.deltas = make(map[string]int)
+		d.fullAt = make(map[string]int64)
+	}
+	s := e.GetSnapshot()
+	if s == nil {
+		return e
+	}
+	key := e.StreamType
+	prev := d.last[key]
+	d.last[key] = s
+	full := func() *Event {
+		d.deltas[key], d.fullAt[key] = 0, e.EventTime
+		return e
+	}
+	if prev == nil || (every > 1 && d.deltas[key] >= every-1) || (intervalMs > 0 && e.EventTime-d.fullAt[key] >= intervalMs) {
+		return full()
+	}
+	delta := diffSnapshot(prev, s)
+	if delta == nil {
+		return full()
+	}
+	data, err := proto.Marshal(delta)
+	if err != nil {
+		return full()
+	}
+	out := &Event{
+		EventTime:     e.EventTime,
+		Sequence:      e.Sequence,
+		Symbol:        e.Symbol,
+		Exchange:      e.Exchange,
+		MarketType:    e.MarketType,
+		StreamType:    e.StreamType,
+		ExchangeTime:  e.ExchangeTime,
+		ReceiveTimeNs: e.ReceiveTimeNs,
+		LatencyUs:     e.LatencyUs,
+		Payload:       &Event_Record{Record: &Record{Type: DeltaRecordType, Encoding: "proto", Data: data}},
+	}
+	if proto.Size(out) >= proto.Size(e) {
+		return full()
+	}
+	d.deltas[key]++
+	return out
+}
+
+// prev 에서 s 로 가는 델타. 적용해도 s 와 같아지지 않으면 nil.
+func diffSnapshot(prev, s *Snapshot) *Snapshot {
+	d := &Snapshot{
+		EventTime:    s.EventTime,
+		LastUpdateId: s.LastUpdateId,
+		Bids:         diffLevels(prev.Bids, s.Bids),
+		Asks:         diffLevels(prev.Asks, s.Asks),
+	}
+	check := proto.Clone(prev).(*Snapshot)
+	applyDelta(check, d)
+	if !proto.Equal(check, s) {
+		return nil
+	}
+	return d
+}
+
+func diffLevels(prev, cur []*Level) []*Level {
+	old := make(map[float64]*Level, len(prev))
+	for _, l := range prev {
+		old[l.Price] = l
+	}
+	var out []*Level
+	for _, l := range cur {
+		p, ok := old[l.Price]
+		delete(old, l.Price)
+		if ok && p.Quantity == l.Quantity && p.PriceText == l.PriceText && p.QuantityText == l.QuantityText {
+			continue
+		}
+		out = append(out, l)
+	}
+	for _, l := range prev {
+		if _, ok := old[l.Price]; ok {
+			out = append(out, &Level{Price: l.Price, PriceText: l.PriceText})
+		}
+	}
+	return out
+}
+
+// base 에 델타를 적용한다 (base 를 고친다)
+func applyDelta(base, d *Snapshot) {
+	base.EventTime = d.EventTime
+	base.LastUpdateId = d.LastUpdateId
+	base.Bids = mergeLevels(base.Bids, d.Bids, true)
+	base.Asks = mergeLevels(base.Asks, d.Asks, false)
+}
+
+func mergeLevels(levels, changes []*Level, desc bool) []*Level {
+	if len(changes) == 0 {
+		return levels
+	}
+	byPrice := make(map[float64]*Level, len(levels)+len(changes))
+	for _, l := range levels {
+		byPrice[l.Price] = l
+	}
+	for _, l := range changes {
+		if l.Quantity == 0 {
+			delete(byPrice, l.Price)
+		} else {
+			byPrice[l.Price] = l
+		}
+	}
+	out := make([]*Level, 0, len(byPrice))
+	for _, l := range byPrice {
+		out = append(out, l)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if desc {
+			return out[i].Price > out[j].Price
+		}
+		return out[i].Price < out[j].Price
+	})
+	return out
+}
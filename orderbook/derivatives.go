@@ -0,0 +1,18 @@
+package orderbook
+
+// collect -derivatives-poll 이 REST 로 받아 Record(encoding proto)로 기록하는 선물 지표.
+// 읽는 쪽은 Record.Decode 로 *OpenInterest, *FundingRate 를 얻는다.
+
+const (
+	OpenInterestRecordType = "binance.openInterest"
+	FundingRateRecordType  = "binance.fundingRate"
+
+	// 이벤트의 stream_type
+	OpenInterestStreamType = "rest/openInterest"
+	FundingRateStreamType  = "rest/premiumIndex"
+)
+
+func init() {
+	RegisterRecordType(OpenInterestRecordType, ProtoRecordDecoder(&OpenInterest{}))
+	RegisterRecordType(FundingRateRecordType, ProtoRecordDecoder(&FundingRate{}))
+}
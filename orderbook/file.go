@@ -0,0 +1,144 @@
+package orderbook
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"time"
+)
+
+// 데이터 파일 하나에 세션을 이어 쓰는 Writer.
+// 파일 끝에 footer 가 있으면 잘라 내고 그 인덱스를 이어받아, 닫을 때 파일 전체를 덮는 footer 를 다시 쓴다.
+// footer 없이 끝난 파일이면 사이드카 인덱스를 이어받는다.
+type FileWriter struct {
+	f  *os.File
+	bw *bufio.Writer
+	w  *Writer
+
+	syncOnClose bool
+}
+
+func OpenFileWriter(path string, h *FileHeader) (*FileWriter, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	fw, err := newFileWriter(f, h)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return fw, nil
+}
+
+func newFileWriter(f *os.File, h *FileHeader) (*FileWriter, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := fi.Size()
+
+	var opts WriterOptions
+	// footer 가 깨져 있으면 인덱스 없이 뒤에 이어 쓴다. 리더는 중간의 footer 를 건너뛴다.
+	if idx, start, err := ReadIndex(f, size); err == nil && idx != nil {
+		if err := f.Truncate(start); err != nil {
+			return nil, err
+		}
+		size = start
+		opts.Index = idx.Entries
+	} else if idx, err := ReadSidecar(f.Name()); err == nil && idx != nil && idx.DataSize <= size {
+		opts.Index = idx.Entries
+	}
+	if _, err := f.Seek(size, io.SeekStart); err != nil {
+		return nil, err
+	}
+	opts.Offset = size
+
+	bw := bufio.NewWriter(f)
+	w, err := NewWriter(bw, h, &opts)
+	if err != nil {
+		return nil, err
+	}
+	return &FileWriter{f: f, bw: bw, w: w}, nil
+}
+
+func (fw *FileWriter) Write(e *Event) error {
+	return fw.w.Write(e)
+}
+
+// 바뀌지 않은 스냅샷을 줄이는 방식을 정한다 (dedup.go). 다음 Write 부터 적용된다.
+func (fw *FileWriter) SetDedup(mode DedupMode) {
+	fw.w.Dedup = mode
+}
+
+// 스냅샷을 every 개마다 온전히 쓰고 그 사이는 델타로 쓴다 (delta.go). 0 이면 모두 온전히 쓴다.
+func (fw *FileWriter) SetDeltaEvery(every int) {
+	fw.w.DeltaEvery = every
+}
+
+// 마지막 온전한 스냅샷에서 d 만큼(EventTime 기준) 지나면 다시 온전히 쓰고 그 사이는 델타로 쓴다. 0 이면 이 기준을 쓰지 않는다.
+func (fw *FileWriter) SetDeltaInterval(d time.Duration) {
+	fw.w.DeltaInterval = d
+}
+
+// 쓰기 버퍼를 n 바이트로 바꾼다 (기본 4KB). 버퍼가 차면 OS 로 내려보낸다. 지금 버퍼에 있는 것은 먼저 내려보낸다.
+func (fw *FileWriter) SetBufferSize(n int) error {
+	if err := fw.bw.Flush(); err != nil {
+		return err
+	}
+	fw.bw = bufio.NewWriterSize(fw.f, n)
+	fw.w.w.w = fw.bw
+	return nil
+}
+
+// 버퍼를 OS 로 내려보낸다. 압축 중인 블록은 닫지 않는다.
+func (fw *FileWriter) Flush() error {
+	return fw.bw.Flush()
+}
+
+// 버퍼를 내려보내고 파일을 디스크에 기록한다 (fsync). 압축 중인 블록은 닫지 않으므로 들어가지 않는다.
+func (fw *FileWriter) Sync() error {
+	if err := fw.bw.Flush(); err != nil {
+		return err
+	}
+	return fw.f.Sync()
+}
+
+// true 면 Close 가 footer 까지 쓴 뒤 파일을 닫기 전에 fsync 한다.
+func (fw *FileWriter) SetSyncOnClose(sync bool) {
+	fw.syncOnClose = sync
+}
+
+// 남은 블록과 인덱스 footer 를 쓰고 파일을 닫는다.
+func (fw *FileWriter) Close() error {
+	err := fw.w.Close()
+	if ferr := fw.bw.Flush(); err == nil {
+		err = ferr
+	}
+	if fw.syncOnClose && err == nil {
+		err = fw.f.Sync()
+	}
+	if cerr := fw.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// 지금까지 내보낸 블록의 인덱스를 사이드카로 쓴다. 수집 중인 파일에는 footer 가 없으므로
+// 이것이 있어야 리더가 최근 시각으로 바로 이동할 수 있다. 버퍼를 먼저 내려보낸다.
+// 닫을 때 footer 가 파일 전체를 덮으므로 그 뒤에는 RemoveSidecar 로 지워도 된다.
+func (fw *FileWriter) WriteSidecar() error {
+	if err := fw.bw.Flush(); err != nil {
+		return err
+	}
+	return WriteSidecar(fw.f.Name(), fw.w.Index())
+}
+
+// 지금까지 쓴 파일 크기. 버퍼에 남은 바이트는 포함하고, 아직 닫지 않은 압축 블록은 빠진다.
+func (fw *FileWriter) Size() int64 {
+	return fw.w.Offset()
+}
+
+func (fw *FileWriter) Name() string {
+	return fw.f.Name()
+}
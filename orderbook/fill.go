@@ -0,0 +1,60 @@
+package orderbook
+
+// 시장가 주문 하나가 책을 쓸고 지나갈 때의 체결 결과. 책은 바뀌지 않는다 (자기 체결의 영향은 보지 않는다).
+type Fill struct {
+	Requested float64 // 주문 수량
+	Filled    float64 // 책에 있던 만큼만 채워진다
+	Notional  float64 // 체결 금액 (가격 x 수량의 합)
+	AvgPrice  float64 // Notional / Filled. 하나도 못 채웠으면 0
+	BestPrice float64 // 주문 시점의 최우선 호가
+	LastPrice float64 // 마지막으로 닿은 호가
+	// 최우선 호가 대비 평균 체결가가 불리한 정도 (bps). 매수는 비싸게, 매도는 싸게 산 만큼 양수다.
+	SlippageBps float64
+	Levels      int  // 닿은 호가 수 (일부만 먹은 호가 포함)
+	Complete    bool // Filled == Requested
+}
+
+// 매수면 매도 호가를, 매도면 매수 호가를 가격 순으로 먹는다
+func (b *Book) SimulateFill(buy bool, quantity float64) Fill {
+	if buy {
+		return WalkLevels(b.TopAsks(0), quantity, true)
+	}
+	return WalkLevels(b.TopBids(0), quantity, false)
+}
+
+// levels 는 유리한 가격부터 정렬되어 있어야 한다 (매도 호가는 오름차순, 매수 호가는 내림차순).
+// buy 는 SlippageBps 의 부호에만 쓴다.
+func WalkLevels(levels []*Level, quantity float64, buy bool) Fill {
+	f := Fill{Requested: quantity}
+	if len(levels) == 0 || quantity <= 0 {
+		return f
+	}
+	f.BestPrice = levels[0].Price
+	remaining := quantity
+	for _, l := range levels {
+		if remaining <= 0 {
+			break
+		}
+		take := min(remaining, l.Quantity)
+		f.Filled += take
+		f.Notional += take * l.Price
+		f.LastPrice = l.Price
+		f.Levels++
+		remaining -= take
+	}
+	if f.Filled == 0 {
+		return f
+	}
+	f.AvgPrice = f.Notional / f.Filled
+	if buy {
+		f.SlippageBps = (f.AvgPrice - f.BestPrice) / f.BestPrice * 1e4
+	} else {
+		f.SlippageBps = (f.BestPrice - f.AvgPrice) / f.BestPrice * 1e4
+	}
+	// 부동소수 합의 오차로 아주 조금 모자라는 것은 다 채운 것으로 본다
+	f.Complete = remaining <= quantity*1e-12
+	if f.Complete {
+		f.Filled = quantity
+	}
+	return f
+}
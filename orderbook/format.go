@@ -0,0 +1,404 @@
+package orderbook
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/protobuf/proto"
+)
+
+// 파일 포맷
+//
+//	v1 (구버전): [len u32 LE][Snapshot] 반복. 헤더 없음.
+//	v2: 세션의 연속. 세션 = Magic [len][FileHeader] 뒤에 블록들.
+//	    비압축: [len][Event] 반복. 약 BlockSize 바이트마다 블록 경계로 보고 인덱스에 남긴다.
+//	    zstd:  [len][zstd 프레임] 반복. 프레임 하나가 블록 하나이고, 풀면 [len][Event] 의 연속이다.
+//	    파일을 닫을 때 끝에 블록 인덱스 footer 를 붙인다 (index.go).
+//
+// v2 는 세션 단위로 Magic+헤더를 다시 쓰므로, 수집기가 재시작하며 같은 파일에 이어 쓰거나
+// 파일을 이어 붙여도(cat) 그대로 읽힌다. 리더는 모든 프레임 경계에서 Magic 을 확인한다.
+
+// LE u32 로 읽으면 1GB 가 넘는 길이가 되므로 v1 프레임 길이와 겹치지 않는다.
+var Magic = []byte{0x89, 'O', 'B', 'K'}
+
+const (
+	FormatVersion = 2
+
+	// 이보다 큰 프레임 길이는 손상된 데이터로 본다
+	MaxFrameSize = 64 << 20
+
+	// 블록을 나누는 기본 기준. 압축 블록은 크기와 시간 중 먼저 도달하는 쪽에서 닫는다.
+	DefaultBlockSize     = 256 << 10
+	DefaultBlockInterval = 10 * time.Second
+)
+
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+)
+
+var ErrFrameTooLarge = errors.New("frame length exceeds limit")
+
+// 프레임 버퍼. 길이와 본문을 한 버퍼에 이어 한 번에 쓴다. io.Writer 는 받은 바이트를 붙잡지 않으므로 쓰고 나면 돌려놓는다.
+var framePool = sync.Pool{New: func() any { b := make([]byte, 0, 4096); return &b }}
+
+// 이보다 큰 버퍼는 풀에 돌려놓지 않는다 (큰 footer 하나 때문에 메모리를 계속 잡지 않게)
+const maxPooledFrame = 1 << 20
+
+func writeFrame(w io.Writer, m proto.Message) error {
+	bp := framePool.Get().(*[]byte)
+	b, err := proto.MarshalOptions{}.MarshalAppend(append((*bp)[:0], 0, 0, 0, 0), m)
+	if err == nil {
+		binary.LittleEndian.PutUint32(b, uint32(len(b)-4))
+		_, err = w.Write(b)
+	}
+	if cap(b) <= maxPooledFrame {
+		*bp = b
+		framePool.Put(bp)
+	}
+	return err
+}
+
+func readFrame(r io.Reader) ([]byte, error) {
+	var lenBuf [4]byte
+	if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+		return nil, err
+	}
+	n := binary.LittleEndian.Uint32(lenBuf[:])
+	if n > MaxFrameSize {
+		return nil, fmt.Errorf("%w: %d", ErrFrameTooLarge, n)
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf, nil
+}
+
+type Writer struct {
+	w            *countingWriter
+	compression  Compression
+	headerOffset int64 // 현재 세션 헤더 위치
+	index        []*IndexEntry
+
+	// 비압축 세션: 다음 이벤트에서 새 블록을 시작할지, 현재 블록에 쓴 바이트
+	newBlock   bool
+	blockBytes int64
+
+	// 압축 세션: 압축 중인 블록과 그 인덱스 항목 (offset 은 기록할 때 정해진다)
+	block      bytes.Buffer
+	blockStart time.Time
+	blockEntry *IndexEntry
+	compressed []byte // 압축한 블록을 담는 버퍼. 블록마다 재사용한다
+
+	BlockSize     int
+	BlockInterval time.Duration
+
+	// 바뀌지 않은 스냅샷을 줄이는 방식 (dedup.go). 기본은 모두 쓴다.
+	Dedup DedupMode
+	dedup snapshotDedup
+	// 0 이나 1 이 아니면 stream_type 별로 이 개수마다 스냅샷을 온전히 쓰고 그 사이는 델타로 쓴다 (delta.go).
+	// DeltaInterval 이 있으면 마지막 온전한 스냅샷에서 그만큼(EventTime 기준) 지났을 때도 온전히 쓴다.
+	DeltaEvery    int
+	DeltaInterval time.Duration
+	delta         snapshotDelta
+}
+
+type WriterOptions struct {
+	Offset int64         // w 가 파일 중간(이어 쓰기)부터 시작하면 그 위치
+	Index  []*IndexEntry // 이어 쓰는 파일에 이미 있던 인덱스 항목. 새 footer 에 합쳐진다
+}
+
+// 세션 헤더를 쓰고 Writer 를 돌려준다. 기존 파일 끝에 이어 써도 된다. opts 는 nil 이어도 된다.
+func NewWriter(w io.Writer, h *FileHeader, opts *WriterOptions) (*Writer, error) {
+	if h.Version == 0 {
+		h.Version = FormatVersion
+	}
+	if opts == nil {
+		opts = &WriterOptions{}
+	}
+	cw := &countingWriter{w: w, n: opts.Offset}
+	writer := &Writer{
+		w:             cw,
+		compression:   h.Compression,
+		headerOffset:  opts.Offset,
+		index:         append([]*IndexEntry(nil), opts.Index...),
+		newBlock:      true,
+		BlockSize:     DefaultBlockSize,
+		BlockInterval: DefaultBlockInterval,
+	}
+	if _, err := cw.Write(Magic); err != nil {
+		return nil, err
+	}
+	if err := writeFrame(cw, h); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+func (w *Writer) Write(e *Event) error {
+	// 블록마다 첫 스냅샷은 온전히 써야 인덱스로 블록부터 읽어도 표시와 델타를 풀 수 있다
+	blockStart := w.newBlock
+	if w.compression != Compression_COMPRESSION_NONE {
+		blockStart = w.block.Len() == 0
+	}
+	if w.Dedup != DedupOff {
+		if e = w.dedup.filter(w.Dedup, e, blockStart); e == nil {
+			return nil
+		}
+	}
+	if w.DeltaEvery > 1 || w.DeltaInterval > 0 {
+		e = w.delta.encode(w.DeltaEvery, w.DeltaInterval.Milliseconds(), e, blockStart)
+	}
+	if w.compression == Compression_COMPRESSION_NONE {
+		if w.newBlock {
+			w.index = append(w.index, w.entryFor(e, w.w.n))
+			w.newBlock, w.blockBytes = false, 0
+		}
+		start := w.w.n
+		if err := writeFrame(w.w, e); err != nil {
+			return err
+		}
+		w.blockBytes += w.w.n - start
+		w.newBlock = w.blockBytes >= int64(w.BlockSize)
+		return nil
+	}
+
+	if w.block.Len() == 0 {
+		w.blockStart = time.Now()
+		w.blockEntry = w.entryFor(e, 0)
+	}
+	if err := writeFrame(&w.block, e); err != nil {
+		return err
+	}
+	if w.block.Len() >= w.BlockSize || time.Since(w.blockStart) >= w.BlockInterval {
+		return w.Flush()
+	}
+	return nil
+}
+
+func (w *Writer) entryFor(e *Event, offset int64) *IndexEntry {
+	return &IndexEntry{EventTime: e.EventTime, Sequence: e.Sequence, Offset: offset, HeaderOffset: w.headerOffset}
+}
+
+// 압축 중인 블록을 닫아 내보낸다. 비압축이면 아무 일도 하지 않는다.
+func (w *Writer) Flush() error {
+	if w.block.Len() == 0 {
+		return nil
+	}
+	comp := zstdEncoder.EncodeAll(w.block.Bytes(), w.compressed[:0])
+	w.compressed = comp
+	w.block.Reset()
+	w.blockEntry.Offset = w.w.n
+	w.index = append(w.index, w.blockEntry)
+
+	var lenBuf [4]byte
+	binary.LittleEndian.PutUint32(lenBuf[:], uint32(len(comp)))
+	if _, err := w.w.Write(lenBuf[:]); err != nil {
+		return err
+	}
+	_, err := w.w.Write(comp)
+	return err
+}
+
+// 남은 블록을 내보내고 블록 인덱스 footer 를 쓴다. 이후에는 Write 할 수 없다.
+func (w *Writer) Close() error {
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return writeFooter(w.w, &FileIndex{Entries: w.index})
+}
+
+// 지금까지 내보낸 블록의 인덱스. DataSize 는 Offset 이고, 압축 중인 블록은 빠진다.
+// 수집 중인 파일의 사이드카로 쓴다 (FileWriter.WriteSidecar).
+func (w *Writer) Index() *FileIndex {
+	return &FileIndex{Entries: append([]*IndexEntry(nil), w.index...), DataSize: w.w.n}
+}
+
+// 지금까지 쓴 바이트 수 (이어 쓰기 시작 위치 포함)
+func (w *Writer) Offset() int64 {
+	return w.w.n
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.n += int64(n)
+	return n, err
+}
+
+type Reader struct {
+	r   *bufio.Reader
+	src *countingReader
+	// src 가 시작한 파일 위치
+	base int64
+
+	// 마지막으로 읽은 프레임과 현재 세션 헤더의 위치 (Position)
+	frameOffset  int64
+	headerOffset int64
+
+	// 현재 세션의 헤더. v1 구간에서는 nil.
+	Header *FileHeader
+
+	// 풀어 둔 현재 압축 블록
+	block *bytes.Reader
+
+	// 현재 세션에서 stream_type 별 마지막 스냅샷 (표시와 델타를 풀 때 쓴다, dedup.go)
+	snapshots map[string]*lastSnapshot
+}
+
+func NewReader(r io.Reader) *Reader {
+	return newReaderAt(r, 0)
+}
+
+// 파일의 base 위치부터 읽는 Reader. Position 이 파일 기준 위치를 돌려주게 한다.
+func newReaderAt(r io.Reader, base int64) *Reader {
+	src := &countingReader{r: r}
+	return &Reader{r: bufio.NewReader(src), src: src, base: base, headerOffset: -1}
+}
+
+// 읽는 위치를 옮긴다. r 은 이미 base 위치에 있어야 한다.
+func (r *Reader) reset(src io.Reader, base int64) {
+	r.src = &countingReader{r: src}
+	r.base = base
+	r.r.Reset(r.src)
+	r.block = nil
+}
+
+// 다음에 읽을 바이트의 파일 위치
+func (r *Reader) offset() int64 {
+	return r.base + r.src.n - int64(r.r.Buffered())
+}
+
+// 마지막으로 돌려준 이벤트가 들어 있는 프레임(압축 세션이면 블록)의 위치와 그 세션 헤더의 위치.
+// 헤더 없는 v1 구간이면 headerOffset 은 -1. 인덱스를 만들 때 쓴다.
+func (r *Reader) Position() (offset, headerOffset int64) {
+	return r.frameOffset, r.headerOffset
+}
+
+// 다음 이벤트를 읽는다. v1 레코드는 Snapshot 을 담은 Event 로 감싸서 돌려준다.
+// 데이터가 끝나면 io.EOF, 마지막 레코드가 잘려 있으면 io.ErrUnexpectedEOF.
+func (r *Reader) Next() (*Event, error) {
+	for r.block == nil || r.block.Len() == 0 {
+		if err := r.readHeaders(); err != nil {
+			return nil, err
+		}
+		r.frameOffset = r.offset()
+		buf, err := readFrame(r.r)
+		if err != nil {
+			return nil, err
+		}
+		if r.Header == nil || r.Header.Compression == Compression_COMPRESSION_NONE {
+			return r.decode(buf)
+		}
+		dec, err := zstdDecoder.DecodeAll(buf, nil)
+		if err != nil {
+			return nil, fmt.Errorf("zstd block: %w", err)
+		}
+		r.block = bytes.NewReader(dec)
+	}
+
+	buf, err := readFrame(r.block)
+	if err != nil {
+		// 블록 안에서 잘린 프레임. 나머지는 버리고 다음 블록으로 넘어간다.
+		r.block = nil
+		return nil, noEOF(err)
+	}
+	return r.decode(buf)
+}
+
+// 프레임 경계에 있는 세션 헤더(들)를 읽는다. 중간에 낀 인덱스 footer 는 건너뛴다.
+func (r *Reader) readHeaders() error {
+	for {
+		peek, err := r.r.Peek(len(Magic))
+		if err != nil && len(peek) == 0 {
+			return err
+		}
+		if bytes.Equal(peek, IndexMagic) {
+			if err := skipFooter(r.r); err != nil {
+				return noEOF(err)
+			}
+			continue
+		}
+		if !bytes.Equal(peek, Magic) {
+			return nil
+		}
+		start := r.offset()
+		r.r.Discard(len(Magic))
+		buf, err := readFrame(r.r)
+		if err != nil {
+			return noEOF(err)
+		}
+		var h FileHeader
+		if err := proto.Unmarshal(buf, &h); err != nil {
+			return fmt.Errorf("file header: %w", err)
+		}
+		r.Header = &h
+		r.headerOffset = start
+		r.block = nil
+		r.snapshots = nil
+	}
+}
+
+func (r *Reader) decode(buf []byte) (*Event, error) {
+	if r.Header == nil {
+		var s Snapshot
+		if err := proto.Unmarshal(buf, &s); err != nil {
+			return nil, err
+		}
+		return EventFromSnapshot(&s), nil
+	}
+
+	var e Event
+	if err := proto.Unmarshal(buf, &e); err != nil {
+		return nil, err
+	}
+	if e.Symbol == "" {
+		e.Symbol, e.Exchange, e.MarketType = r.Header.Symbol, r.Header.Exchange, r.Header.MarketType
+	}
+	r.expandSnapshot(&e, buf)
+	return &e, nil
+}
+
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func EventFromSnapshot(s *Snapshot) *Event {
+	return &Event{
+		EventTime:  s.EventTime,
+		Symbol:     s.Symbol,
+		Exchange:   s.Exchange,
+		MarketType: s.MarketType,
+		StreamType: s.StreamType,
+		Payload:    &Event_Snapshot{Snapshot: s},
+	}
+}
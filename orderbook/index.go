@@ -0,0 +1,121 @@
+package orderbook
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// 블록 인덱스 footer
+//
+//	IndexMagic [len][FileIndex] [footer 시작 위치 u64 LE] IndexMagic
+//
+// 파일 끝 12 바이트(trailer)만 읽으면 footer 위치를 알 수 있다. 수집 중이거나 비정상 종료된
+// 파일에는 footer 가 없으므로 처음부터 읽어야 한다.
+
+var IndexMagic = []byte{0x89, 'O', 'B', 'I'}
+
+const trailerSize = 8 + 4
+
+func writeFooter(w *countingWriter, idx *FileIndex) error {
+	start := w.n
+	if _, err := w.Write(IndexMagic); err != nil {
+		return err
+	}
+	if err := writeFrame(w, idx); err != nil {
+		return err
+	}
+	var trailer [trailerSize]byte
+	binary.LittleEndian.PutUint64(trailer[:8], uint64(start))
+	copy(trailer[8:], IndexMagic)
+	_, err := w.Write(trailer[:])
+	return err
+}
+
+// 스트림 중간에 낀 footer 를 건너뛴다 (footer 가 붙은 파일을 이어 붙인 경우)
+func skipFooter(r *bufio.Reader) error {
+	if _, err := r.Discard(len(IndexMagic)); err != nil {
+		return err
+	}
+	if _, err := readFrame(r); err != nil {
+		return err
+	}
+	_, err := r.Discard(trailerSize)
+	return err
+}
+
+// 파일 끝의 블록 인덱스를 읽는다. footer 가 없으면 nil 과 -1 을 돌려준다.
+// 두 번째 값은 footer 시작 위치 (이어 쓸 때 이 위치로 잘라 낸다).
+func ReadIndex(r io.ReaderAt, size int64) (*FileIndex, int64, error) {
+	if size < trailerSize {
+		return nil, -1, nil
+	}
+	var trailer [trailerSize]byte
+	if _, err := r.ReadAt(trailer[:], size-trailerSize); err != nil {
+		return nil, -1, err
+	}
+	if !bytes.Equal(trailer[8:], IndexMagic) {
+		return nil, -1, nil
+	}
+	start := int64(binary.LittleEndian.Uint64(trailer[:8]))
+	if start < 0 || start > size-trailerSize-int64(len(IndexMagic)) {
+		return nil, -1, fmt.Errorf("index footer offset %d out of range", start)
+	}
+
+	sr := io.NewSectionReader(r, start, size-trailerSize-start)
+	var magic [4]byte
+	if _, err := io.ReadFull(sr, magic[:]); err != nil {
+		return nil, -1, err
+	}
+	if !bytes.Equal(magic[:], IndexMagic) {
+		return nil, -1, fmt.Errorf("index footer magic mismatch at %d", start)
+	}
+	buf, err := readFrame(sr)
+	if err != nil {
+		return nil, -1, fmt.Errorf("index footer: %w", err)
+	}
+	var idx FileIndex
+	if err := proto.Unmarshal(buf, &idx); err != nil {
+		return nil, -1, fmt.Errorf("index footer: %w", err)
+	}
+	return &idx, start, nil
+}
+
+// 첫 이벤트 시간이 target 이하인 마지막 블록의 위치. target 이 첫 블록보다 앞이면 -1.
+func (x *FileIndex) Search(target int64) int {
+	return sort.Search(len(x.Entries), func(i int) bool {
+		return x.Entries[i].EventTime > target
+	}) - 1
+}
+
+// 인덱스 항목이 가리키는 블록부터 읽는 Reader. 블록이 속한 세션 헤더를 먼저 읽어 둔다.
+// 헤더 없는 v1 구간(HeaderOffset < 0)이면 바로 블록 위치부터 읽는다.
+func OpenBlock(f io.ReadSeeker, e *IndexEntry) (*Reader, error) {
+	if e.HeaderOffset < 0 {
+		if _, err := f.Seek(e.Offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return newReaderAt(f, e.Offset), nil
+	}
+
+	if _, err := f.Seek(e.HeaderOffset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	r := newReaderAt(f, e.HeaderOffset)
+	if err := r.readHeaders(); err != nil {
+		return nil, noEOF(err)
+	}
+	if r.Header == nil {
+		return nil, fmt.Errorf("no session header at offset %d", e.HeaderOffset)
+	}
+	if _, err := f.Seek(e.Offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	r.reset(f, e.Offset)
+	return r, nil
+}
@@ -0,0 +1,75 @@
+package orderbook
+
+import "io"
+
+// 블록 인덱스를 뒤에서부터 거슬러 올라가며 EventTime 이 target 이하이고 match 를 만족하는 마지막 이벤트와
+// 그 세션 헤더를 찾는다. target 을 포함한 블록부터 읽고, 없으면 한 블록씩 앞으로 가므로
+// "가장 최근 책" 같은 질의가 하루치 파일을 처음부터 읽지 않는다.
+//
+// 마지막 인덱스 항목 뒤(수집 중인 파일의 사이드카가 아직 덮지 못한 꼬리)까지 읽는다.
+// 인덱스가 파일 중간(이어 쓴 세션)부터 시작하면 첫 항목 앞은 마지막에 처음부터 읽는다.
+// idx 가 nil 이면 파일 전체를 앞에서부터 읽는다. 찾지 못하면 nil, nil, nil.
+func FindLast(f io.ReadSeeker, idx *FileIndex, target int64, match func(*Event) bool) (*Event, *FileHeader, error) {
+	var entries []*IndexEntry
+	if idx != nil {
+		entries = idx.Entries
+	}
+	i := len(entries) - 1
+	if idx != nil {
+		i = idx.Search(target)
+	}
+	for ; i >= 0; i-- {
+		end := int64(-1)
+		if i+1 < len(entries) {
+			end = entries[i+1].Offset
+		}
+		r, err := OpenBlock(f, entries[i])
+		if err != nil {
+			return nil, nil, err
+		}
+		if ev, h := lastInSpan(r, end, target, match); ev != nil {
+			return ev, h, nil
+		}
+	}
+
+	// 인덱스가 덮지 않는 앞부분 (인덱스가 없으면 파일 전체)
+	end := int64(-1)
+	if len(entries) > 0 {
+		if end = entries[0].Offset; end == 0 || entries[0].HeaderOffset == 0 {
+			return nil, nil, nil
+		}
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
+	ev, h := lastInSpan(NewReader(f), end, target, match)
+	return ev, h, nil
+}
+
+// r 에서 프레임 위치가 end 에 닿기 전(end < 0 이면 끝까지)까지 읽으며 조건에 맞는 마지막 이벤트를 찾는다.
+// 깨진 레코드는 건너뛴다.
+func lastInSpan(r *Reader, end, target int64, match func(*Event) bool) (*Event, *FileHeader) {
+	var (
+		last   *Event
+		header *FileHeader
+	)
+	for {
+		ev, err := r.Next()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if off, _ := r.Position(); end >= 0 && off >= end {
+			break
+		}
+		if err != nil {
+			continue
+		}
+		if ev.EventTime > target {
+			break
+		}
+		if match == nil || match(ev) {
+			last, header = ev, r.Header
+		}
+	}
+	return last, header
+}
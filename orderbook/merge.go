@@ -0,0 +1,88 @@
+package orderbook
+
+import (
+	"container/heap"
+	"io"
+)
+
+// 이벤트를 하나씩 내주는 것. 끝나면 io.EOF. *Reader 가 그렇다.
+type EventSource interface {
+	Next() (*Event, error)
+}
+
+// 여러 소스(심볼별 파일 등)를 수신 시각(EventTime) 순으로 섞어 하나의 스트림으로 읽는다 (k-way merge).
+// 각 소스는 이미 시각 순이어야 한다. 시각이 같으면 앞에 준 소스의 이벤트가 먼저 나오고,
+// 한 소스 안의 순서는 그대로다.
+//
+//	m := orderbook.NewMergeReader(orderbook.NewReader(f1), orderbook.NewReader(f2))
+//	for {
+//		ev, err := m.Next()
+//		if err == io.EOF { break }
+//		...
+//	}
+type MergeReader struct {
+	sources []EventSource
+	heads   mergeHeap
+	started bool
+}
+
+func NewMergeReader(sources ...EventSource) *MergeReader {
+	return &MergeReader{sources: sources}
+}
+
+// 다음 이벤트. 모든 소스가 끝나면 io.EOF, 소스 하나라도 오류를 내면 그 오류를 돌려준다.
+func (m *MergeReader) Next() (*Event, error) {
+	if !m.started {
+		m.started = true
+		for i := range m.sources {
+			if err := m.pull(i); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(m.heads) == 0 {
+		return nil, io.EOF
+	}
+	ev, i := m.heads[0].ev, m.heads[0].source
+	heap.Pop(&m.heads)
+	if err := m.pull(i); err != nil {
+		return nil, err
+	}
+	return ev, nil
+}
+
+// 소스 i 의 다음 이벤트를 heap 에 넣는다
+func (m *MergeReader) pull(i int) error {
+	ev, err := m.sources[i].Next()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	heap.Push(&m.heads, mergeHead{ev: ev, source: i})
+	return nil
+}
+
+type mergeHead struct {
+	ev     *Event
+	source int
+}
+
+type mergeHeap []mergeHead
+
+func (h mergeHeap) Len() int { return len(h) }
+func (h mergeHeap) Less(i, j int) bool {
+	if h[i].ev.EventTime != h[j].ev.EventTime {
+		return h[i].ev.EventTime < h[j].ev.EventTime
+	}
+	return h[i].source < h[j].source
+}
+func (h mergeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *mergeHeap) Push(x any)   { *h = append(*h, x.(mergeHead)) }
+func (h *mergeHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
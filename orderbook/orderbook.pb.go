@@ -21,10 +21,61 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+type Compression int32
+
+const (
+	Compression_COMPRESSION_NONE Compression = 0
+	// 세션 본문이 [len][zstd 프레임] 블록의 연속. 블록마다 독립적으로 풀 수 있다.
+	Compression_COMPRESSION_ZSTD Compression = 1
+)
+
+// Enum value maps for Compression.
+var (
+	Compression_name = map[int32]string{
+		0: "COMPRESSION_NONE",
+		1: "COMPRESSION_ZSTD",
+	}
+	Compression_value = map[string]int32{
+		"COMPRESSION_NONE": 0,
+		"COMPRESSION_ZSTD": 1,
+	}
+)
+
+func (x Compression) Enum() *Compression {
+	p := new(Compression)
+	*p = x
+	return p
+}
+
+func (x Compression) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Compression) Descriptor() protoreflect.EnumDescriptor {
+	return file_orderbook_proto_enumTypes[0].Descriptor()
+}
+
+func (Compression) Type() protoreflect.EnumType {
+	return &file_orderbook_proto_enumTypes[0]
+}
+
+func (x Compression) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Compression.Descriptor instead.
+func (Compression) EnumDescriptor() ([]byte, []int) {
+	return file_orderbook_proto_rawDescGZIP(), []int{0}
+}
+
 type Level struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Price         float64                `protobuf:"fixed64,1,opt,name=price,proto3" json:"price,omitempty"`
-	Quantity      float64                `protobuf:"fixed64,2,opt,name=quantity,proto3" json:"quantity,omitempty"`
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Price    float64                `protobuf:"fixed64,1,opt,name=price,proto3" json:"price,omitempty"`
+	Quantity float64                `protobuf:"fixed64,2,opt,name=quantity,proto3" json:"quantity,omitempty"`
+	// 거래소가 보낸 원래 문자열 (예: "0.05000000"). collect -keep-decimals 로 기록한 파일에만 있다.
+	// 대사(reconciliation)처럼 정확한 값이 필요하면 double 대신 이쪽을 쓴다.
+	PriceText     string `protobuf:"bytes,3,opt,name=price_text,json=priceText,proto3" json:"price_text,omitempty"`
+	QuantityText  string `protobuf:"bytes,4,opt,name=quantity_text,json=quantityText,proto3" json:"quantity_text,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -73,13 +124,32 @@ func (x *Level) GetQuantity() float64 {
 	return 0
 }
 
+func (x *Level) GetPriceText() string {
+	if x != nil {
+		return x.PriceText
+	}
+	return ""
+}
+
+func (x *Level) GetQuantityText() string {
+	if x != nil {
+		return x.QuantityText
+	}
+	return ""
+}
+
 // 파일에 저장될 유일한 메시지: 오더북 스냅샷
 type Snapshot struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	EventTime     int64                  `protobuf:"varint,1,opt,name=event_time,json=eventTime,proto3" json:"event_time,omitempty"` // 데이터 수신 시간 (UTC ms)
-	LastUpdateId  int64                  `protobuf:"varint,2,opt,name=last_update_id,json=lastUpdateId,proto3" json:"last_update_id,omitempty"`
-	Bids          []*Level               `protobuf:"bytes,3,rep,name=bids,proto3" json:"bids,omitempty"`
-	Asks          []*Level               `protobuf:"bytes,4,rep,name=asks,proto3" json:"asks,omitempty"`
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	EventTime    int64                  `protobuf:"varint,1,opt,name=event_time,json=eventTime,proto3" json:"event_time,omitempty"` // 데이터 수신 시간 (UTC ms)
+	LastUpdateId int64                  `protobuf:"varint,2,opt,name=last_update_id,json=lastUpdateId,proto3" json:"last_update_id,omitempty"`
+	Bids         []*Level               `protobuf:"bytes,3,rep,name=bids,proto3" json:"bids,omitempty"`
+	Asks         []*Level               `protobuf:"bytes,4,rep,name=asks,proto3" json:"asks,omitempty"`
+	// 레코드 자체로 출처를 알 수 있도록 하는 메타데이터
+	Symbol        string `protobuf:"bytes,5,opt,name=symbol,proto3" json:"symbol,omitempty"`                           // 거래소 표기 심볼 (예: ETHUSDT)
+	Exchange      string `protobuf:"bytes,6,opt,name=exchange,proto3" json:"exchange,omitempty"`                       // 예: binance
+	MarketType    string `protobuf:"bytes,7,opt,name=market_type,json=marketType,proto3" json:"market_type,omitempty"` // 예: spot, usdm_futures
+	StreamType    string `protobuf:"bytes,8,opt,name=stream_type,json=streamType,proto3" json:"stream_type,omitempty"` // 예: depth20@100ms
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -142,65 +212,1882 @@ func (x *Snapshot) GetAsks() []*Level {
 	return nil
 }
 
-var File_orderbook_proto protoreflect.FileDescriptor
+func (x *Snapshot) GetSymbol() string {
+	if x != nil {
+		return x.Symbol
+	}
+	return ""
+}
 
-const file_orderbook_proto_rawDesc = "" +
-	"\n" +
-	"\x0forderbook.proto\x12\torderbook\"9\n" +
-	"\x05Level\x12\x14\n" +
-	"\x05price\x18\x01 \x01(\x01R\x05price\x12\x1a\n" +
-	"\bquantity\x18\x02 \x01(\x01R\bquantity\"\x9b\x01\n" +
-	"\bSnapshot\x12\x1d\n" +
-	"\n" +
-	"event_time\x18\x01 \x01(\x03R\teventTime\x12$\n" +
-	"\x0elast_update_id\x18\x02 \x01(\x03R\flastUpdateId\x12$\n" +
-	"\x04bids\x18\x03 \x03(\v2\x10.orderbook.LevelR\x04bids\x12$\n" +
-	"\x04asks\x18\x04 \x03(\v2\x10.orderbook.LevelR\x04asksB\rZ\v./orderbookb\x06proto3"
+func (x *Snapshot) GetExchange() string {
+	if x != nil {
+		return x.Exchange
+	}
+	return ""
+}
 
-var (
-	file_orderbook_proto_rawDescOnce sync.Once
-	file_orderbook_proto_rawDescData []byte
-)
+func (x *Snapshot) GetMarketType() string {
+	if x != nil {
+		return x.MarketType
+	}
+	return ""
+}
 
-func file_orderbook_proto_rawDescGZIP() []byte {
-	file_orderbook_proto_rawDescOnce.Do(func() {
-		file_orderbook_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_orderbook_proto_rawDesc), len(file_orderbook_proto_rawDesc)))
-	})
-	return file_orderbook_proto_rawDescData
+func (x *Snapshot) GetStreamType() string {
+	if x != nil {
+		return x.StreamType
+	}
+	return ""
 }
 
-var file_orderbook_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
-var file_orderbook_proto_goTypes = []any{
-	(*Level)(nil),    // 0: orderbook.Level
-	(*Snapshot)(nil), // 1: orderbook.Snapshot
+// <symbol>@depth 증분 스트림
+type DepthDiff struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	FirstUpdateId     int64                  `protobuf:"varint,1,opt,name=first_update_id,json=firstUpdateId,proto3" json:"first_update_id,omitempty"`               // U
+	FinalUpdateId     int64                  `protobuf:"varint,2,opt,name=final_update_id,json=finalUpdateId,proto3" json:"final_update_id,omitempty"`               // u
+	PrevFinalUpdateId int64                  `protobuf:"varint,3,opt,name=prev_final_update_id,json=prevFinalUpdateId,proto3" json:"prev_final_update_id,omitempty"` // pu (선물만)
+	Bids              []*Level               `protobuf:"bytes,4,rep,name=bids,proto3" json:"bids,omitempty"`
+	Asks              []*Level               `protobuf:"bytes,5,rep,name=asks,proto3" json:"asks,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
 }
-var file_orderbook_proto_depIdxs = []int32{
-	0, // 0: orderbook.Snapshot.bids:type_name -> orderbook.Level
-	0, // 1: orderbook.Snapshot.asks:type_name -> orderbook.Level
-	2, // [2:2] is the sub-list for method output_type
-	2, // [2:2] is the sub-list for method input_type
-	2, // [2:2] is the sub-list for extension type_name
-	2, // [2:2] is the sub-list for extension extendee
-	0, // [0:2] is the sub-list for field type_name
+
+func (x *DepthDiff) Reset() {
+	*x = DepthDiff{}
+	mi := &file_orderbook_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
 }
 
-func init() { file_orderbook_proto_init() }
-func file_orderbook_proto_init() {
-	if File_orderbook_proto != nil {
-		return
+func (x *DepthDiff) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DepthDiff) ProtoMessage() {}
+
+func (x *DepthDiff) ProtoReflect() protoreflect.Message {
+	mi := &file_orderbook_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DepthDiff.ProtoReflect.Descriptor instead.
+func (*DepthDiff) Descriptor() ([]byte, []int) {
+	return file_orderbook_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *DepthDiff) GetFirstUpdateId() int64 {
+	if x != nil {
+		return x.FirstUpdateId
+	}
+	return 0
+}
+
+func (x *DepthDiff) GetFinalUpdateId() int64 {
+	if x != nil {
+		return x.FinalUpdateId
+	}
+	return 0
+}
+
+func (x *DepthDiff) GetPrevFinalUpdateId() int64 {
+	if x != nil {
+		return x.PrevFinalUpdateId
+	}
+	return 0
+}
+
+func (x *DepthDiff) GetBids() []*Level {
+	if x != nil {
+		return x.Bids
+	}
+	return nil
+}
+
+func (x *DepthDiff) GetAsks() []*Level {
+	if x != nil {
+		return x.Asks
+	}
+	return nil
+}
+
+// <symbol>@trade 스트림
+type Trade struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TradeId       int64                  `protobuf:"varint,1,opt,name=trade_id,json=tradeId,proto3" json:"trade_id,omitempty"`
+	Price         float64                `protobuf:"fixed64,2,opt,name=price,proto3" json:"price,omitempty"`
+	Quantity      float64                `protobuf:"fixed64,3,opt,name=quantity,proto3" json:"quantity,omitempty"`
+	TradeTime     int64                  `protobuf:"varint,4,opt,name=trade_time,json=tradeTime,proto3" json:"trade_time,omitempty"` // 체결 시간 (UTC ms)
+	BuyerIsMaker  bool                   `protobuf:"varint,5,opt,name=buyer_is_maker,json=buyerIsMaker,proto3" json:"buyer_is_maker,omitempty"`
+	PriceText     string                 `protobuf:"bytes,6,opt,name=price_text,json=priceText,proto3" json:"price_text,omitempty"` // 원래 문자열 (Level 참고)
+	QuantityText  string                 `protobuf:"bytes,7,opt,name=quantity_text,json=quantityText,proto3" json:"quantity_text,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Trade) Reset() {
+	*x = Trade{}
+	mi := &file_orderbook_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Trade) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Trade) ProtoMessage() {}
+
+func (x *Trade) ProtoReflect() protoreflect.Message {
+	mi := &file_orderbook_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Trade.ProtoReflect.Descriptor instead.
+func (*Trade) Descriptor() ([]byte, []int) {
+	return file_orderbook_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Trade) GetTradeId() int64 {
+	if x != nil {
+		return x.TradeId
+	}
+	return 0
+}
+
+func (x *Trade) GetPrice() float64 {
+	if x != nil {
+		return x.Price
+	}
+	return 0
+}
+
+func (x *Trade) GetQuantity() float64 {
+	if x != nil {
+		return x.Quantity
+	}
+	return 0
+}
+
+func (x *Trade) GetTradeTime() int64 {
+	if x != nil {
+		return x.TradeTime
+	}
+	return 0
+}
+
+func (x *Trade) GetBuyerIsMaker() bool {
+	if x != nil {
+		return x.BuyerIsMaker
+	}
+	return false
+}
+
+func (x *Trade) GetPriceText() string {
+	if x != nil {
+		return x.PriceText
+	}
+	return ""
+}
+
+func (x *Trade) GetQuantityText() string {
+	if x != nil {
+		return x.QuantityText
+	}
+	return ""
+}
+
+// <symbol>@bookTicker 스트림
+type BookTicker struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	UpdateId        int64                  `protobuf:"varint,1,opt,name=update_id,json=updateId,proto3" json:"update_id,omitempty"`
+	BidPrice        float64                `protobuf:"fixed64,2,opt,name=bid_price,json=bidPrice,proto3" json:"bid_price,omitempty"`
+	BidQuantity     float64                `protobuf:"fixed64,3,opt,name=bid_quantity,json=bidQuantity,proto3" json:"bid_quantity,omitempty"`
+	AskPrice        float64                `protobuf:"fixed64,4,opt,name=ask_price,json=askPrice,proto3" json:"ask_price,omitempty"`
+	AskQuantity     float64                `protobuf:"fixed64,5,opt,name=ask_quantity,json=askQuantity,proto3" json:"ask_quantity,omitempty"`
+	BidPriceText    string                 `protobuf:"bytes,6,opt,name=bid_price_text,json=bidPriceText,proto3" json:"bid_price_text,omitempty"` // 원래 문자열 (Level 참고)
+	BidQuantityText string                 `protobuf:"bytes,7,opt,name=bid_quantity_text,json=bidQuantityText,proto3" json:"bid_quantity_text,omitempty"`
+	AskPriceText    string                 `protobuf:"bytes,8,opt,name=ask_price_text,json=askPriceText,proto3" json:"ask_price_text,omitempty"`
+	AskQuantityText string                 `protobuf:"bytes,9,opt,name=ask_quantity_text,json=askQuantityText,proto3" json:"ask_quantity_text,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *BookTicker) Reset() {
+	*x = BookTicker{}
+	mi := &file_orderbook_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BookTicker) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BookTicker) ProtoMessage() {}
+
+func (x *BookTicker) ProtoReflect() protoreflect.Message {
+	mi := &file_orderbook_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BookTicker.ProtoReflect.Descriptor instead.
+func (*BookTicker) Descriptor() ([]byte, []int) {
+	return file_orderbook_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *BookTicker) GetUpdateId() int64 {
+	if x != nil {
+		return x.UpdateId
+	}
+	return 0
+}
+
+func (x *BookTicker) GetBidPrice() float64 {
+	if x != nil {
+		return x.BidPrice
+	}
+	return 0
+}
+
+func (x *BookTicker) GetBidQuantity() float64 {
+	if x != nil {
+		return x.BidQuantity
+	}
+	return 0
+}
+
+func (x *BookTicker) GetAskPrice() float64 {
+	if x != nil {
+		return x.AskPrice
+	}
+	return 0
+}
+
+func (x *BookTicker) GetAskQuantity() float64 {
+	if x != nil {
+		return x.AskQuantity
+	}
+	return 0
+}
+
+func (x *BookTicker) GetBidPriceText() string {
+	if x != nil {
+		return x.BidPriceText
+	}
+	return ""
+}
+
+func (x *BookTicker) GetBidQuantityText() string {
+	if x != nil {
+		return x.BidQuantityText
+	}
+	return ""
+}
+
+func (x *BookTicker) GetAskPriceText() string {
+	if x != nil {
+		return x.AskPriceText
+	}
+	return ""
+}
+
+func (x *BookTicker) GetAskQuantityText() string {
+	if x != nil {
+		return x.AskQuantityText
+	}
+	return ""
+}
+
+// <symbol>@forceOrder 스트림 (선물 강제 청산 주문). 거래소는 심볼마다 1초에 마지막 청산 하나만 보낸다.
+type Liquidation struct {
+	state                  protoimpl.MessageState `protogen:"open.v1"`
+	Side                   string                 `protobuf:"bytes,1,opt,name=side,proto3" json:"side,omitempty"`                                                           // S: 청산 주문 방향 (BUY 면 숏 포지션 청산)
+	OrderType              string                 `protobuf:"bytes,2,opt,name=order_type,json=orderType,proto3" json:"order_type,omitempty"`                                // o: LIMIT 등
+	TimeInForce            string                 `protobuf:"bytes,3,opt,name=time_in_force,json=timeInForce,proto3" json:"time_in_force,omitempty"`                        // f: IOC 등
+	Price                  float64                `protobuf:"fixed64,4,opt,name=price,proto3" json:"price,omitempty"`                                                       // p: 주문 가격
+	AveragePrice           float64                `protobuf:"fixed64,5,opt,name=average_price,json=averagePrice,proto3" json:"average_price,omitempty"`                     // ap: 평균 체결 가격
+	Quantity               float64                `protobuf:"fixed64,6,opt,name=quantity,proto3" json:"quantity,omitempty"`                                                 // q: 주문 수량
+	LastFilledQuantity     float64                `protobuf:"fixed64,7,opt,name=last_filled_quantity,json=lastFilledQuantity,proto3" json:"last_filled_quantity,omitempty"` // l: 이번에 체결된 수량
+	FilledQuantity         float64                `protobuf:"fixed64,8,opt,name=filled_quantity,json=filledQuantity,proto3" json:"filled_quantity,omitempty"`               // z: 누적 체결 수량
+	Status                 string                 `protobuf:"bytes,9,opt,name=status,proto3" json:"status,omitempty"`                                                       // X: FILLED 등
+	TradeTime              int64                  `protobuf:"varint,10,opt,name=trade_time,json=tradeTime,proto3" json:"trade_time,omitempty"`                              // T: 체결 시간 (UTC ms)
+	PriceText              string                 `protobuf:"bytes,11,opt,name=price_text,json=priceText,proto3" json:"price_text,omitempty"`                               // 원래 문자열 (Level 참고)
+	AveragePriceText       string                 `protobuf:"bytes,12,opt,name=average_price_text,json=averagePriceText,proto3" json:"average_price_text,omitempty"`
+	QuantityText           string                 `protobuf:"bytes,13,opt,name=quantity_text,json=quantityText,proto3" json:"quantity_text,omitempty"`
+	LastFilledQuantityText string                 `protobuf:"bytes,14,opt,name=last_filled_quantity_text,json=lastFilledQuantityText,proto3" json:"last_filled_quantity_text,omitempty"`
+	FilledQuantityText     string                 `protobuf:"bytes,15,opt,name=filled_quantity_text,json=filledQuantityText,proto3" json:"filled_quantity_text,omitempty"`
+	unknownFields          protoimpl.UnknownFields
+	sizeCache              protoimpl.SizeCache
+}
+
+func (x *Liquidation) Reset() {
+	*x = Liquidation{}
+	mi := &file_orderbook_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Liquidation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Liquidation) ProtoMessage() {}
+
+func (x *Liquidation) ProtoReflect() protoreflect.Message {
+	mi := &file_orderbook_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Liquidation.ProtoReflect.Descriptor instead.
+func (*Liquidation) Descriptor() ([]byte, []int) {
+	return file_orderbook_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Liquidation) GetSide() string {
+	if x != nil {
+		return x.Side
+	}
+	return ""
+}
+
+func (x *Liquidation) GetOrderType() string {
+	if x != nil {
+		return x.OrderType
+	}
+	return ""
+}
+
+func (x *Liquidation) GetTimeInForce() string {
+	if x != nil {
+		return x.TimeInForce
+	}
+	return ""
+}
+
+func (x *Liquidation) GetPrice() float64 {
+	if x != nil {
+		return x.Price
+	}
+	return 0
+}
+
+func (x *Liquidation) GetAveragePrice() float64 {
+	if x != nil {
+		return x.AveragePrice
+	}
+	return 0
+}
+
+func (x *Liquidation) GetQuantity() float64 {
+	if x != nil {
+		return x.Quantity
+	}
+	return 0
+}
+
+func (x *Liquidation) GetLastFilledQuantity() float64 {
+	if x != nil {
+		return x.LastFilledQuantity
+	}
+	return 0
+}
+
+func (x *Liquidation) GetFilledQuantity() float64 {
+	if x != nil {
+		return x.FilledQuantity
+	}
+	return 0
+}
+
+func (x *Liquidation) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *Liquidation) GetTradeTime() int64 {
+	if x != nil {
+		return x.TradeTime
+	}
+	return 0
+}
+
+func (x *Liquidation) GetPriceText() string {
+	if x != nil {
+		return x.PriceText
+	}
+	return ""
+}
+
+func (x *Liquidation) GetAveragePriceText() string {
+	if x != nil {
+		return x.AveragePriceText
+	}
+	return ""
+}
+
+func (x *Liquidation) GetQuantityText() string {
+	if x != nil {
+		return x.QuantityText
+	}
+	return ""
+}
+
+func (x *Liquidation) GetLastFilledQuantityText() string {
+	if x != nil {
+		return x.LastFilledQuantityText
+	}
+	return ""
+}
+
+func (x *Liquidation) GetFilledQuantityText() string {
+	if x != nil {
+		return x.FilledQuantityText
+	}
+	return ""
+}
+
+// 24시간 이동 통계. <symbol>@ticker, <symbol>@miniTicker 스트림과 시장 전체 스트림(!miniTicker@arr, !ticker@arr)에서 온다.
+// miniTicker 에는 1~6 만 있고 나머지는 0 이다. 최우선 호가는 bookTicker 로 받는다.
+type Ticker struct {
+	state              protoimpl.MessageState `protogen:"open.v1"`
+	LastPrice          float64                `protobuf:"fixed64,1,opt,name=last_price,json=lastPrice,proto3" json:"last_price,omitempty"`                              // c
+	OpenPrice          float64                `protobuf:"fixed64,2,opt,name=open_price,json=openPrice,proto3" json:"open_price,omitempty"`                              // o: 24시간 전 가격
+	HighPrice          float64                `protobuf:"fixed64,3,opt,name=high_price,json=highPrice,proto3" json:"high_price,omitempty"`                              // h
+	LowPrice           float64                `protobuf:"fixed64,4,opt,name=low_price,json=lowPrice,proto3" json:"low_price,omitempty"`                                 // l
+	Volume             float64                `protobuf:"fixed64,5,opt,name=volume,proto3" json:"volume,omitempty"`                                                     // v: 기초 자산 거래량
+	QuoteVolume        float64                `protobuf:"fixed64,6,opt,name=quote_volume,json=quoteVolume,proto3" json:"quote_volume,omitempty"`                        // q: 호가 자산 거래량
+	PriceChange        float64                `protobuf:"fixed64,7,opt,name=price_change,json=priceChange,proto3" json:"price_change,omitempty"`                        // p
+	PriceChangePercent float64                `protobuf:"fixed64,8,opt,name=price_change_percent,json=priceChangePercent,proto3" json:"price_change_percent,omitempty"` // P
+	WeightedAvgPrice   float64                `protobuf:"fixed64,9,opt,name=weighted_avg_price,json=weightedAvgPrice,proto3" json:"weighted_avg_price,omitempty"`       // w
+	LastQuantity       float64                `protobuf:"fixed64,10,opt,name=last_quantity,json=lastQuantity,proto3" json:"last_quantity,omitempty"`                    // Q
+	OpenTime           int64                  `protobuf:"varint,11,opt,name=open_time,json=openTime,proto3" json:"open_time,omitempty"`                                 // O: 통계 구간 (UTC ms)
+	CloseTime          int64                  `protobuf:"varint,12,opt,name=close_time,json=closeTime,proto3" json:"close_time,omitempty"`                              // C
+	FirstTradeId       int64                  `protobuf:"varint,13,opt,name=first_trade_id,json=firstTradeId,proto3" json:"first_trade_id,omitempty"`                   // F
+	LastTradeId        int64                  `protobuf:"varint,14,opt,name=last_trade_id,json=lastTradeId,proto3" json:"last_trade_id,omitempty"`                      // L
+	TradeCount         int64                  `protobuf:"varint,15,opt,name=trade_count,json=tradeCount,proto3" json:"trade_count,omitempty"`                           // n
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
+}
+
+func (x *Ticker) Reset() {
+	*x = Ticker{}
+	mi := &file_orderbook_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Ticker) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Ticker) ProtoMessage() {}
+
+func (x *Ticker) ProtoReflect() protoreflect.Message {
+	mi := &file_orderbook_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Ticker.ProtoReflect.Descriptor instead.
+func (*Ticker) Descriptor() ([]byte, []int) {
+	return file_orderbook_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Ticker) GetLastPrice() float64 {
+	if x != nil {
+		return x.LastPrice
+	}
+	return 0
+}
+
+func (x *Ticker) GetOpenPrice() float64 {
+	if x != nil {
+		return x.OpenPrice
+	}
+	return 0
+}
+
+func (x *Ticker) GetHighPrice() float64 {
+	if x != nil {
+		return x.HighPrice
+	}
+	return 0
+}
+
+func (x *Ticker) GetLowPrice() float64 {
+	if x != nil {
+		return x.LowPrice
+	}
+	return 0
+}
+
+func (x *Ticker) GetVolume() float64 {
+	if x != nil {
+		return x.Volume
+	}
+	return 0
+}
+
+func (x *Ticker) GetQuoteVolume() float64 {
+	if x != nil {
+		return x.QuoteVolume
+	}
+	return 0
+}
+
+func (x *Ticker) GetPriceChange() float64 {
+	if x != nil {
+		return x.PriceChange
+	}
+	return 0
+}
+
+func (x *Ticker) GetPriceChangePercent() float64 {
+	if x != nil {
+		return x.PriceChangePercent
+	}
+	return 0
+}
+
+func (x *Ticker) GetWeightedAvgPrice() float64 {
+	if x != nil {
+		return x.WeightedAvgPrice
+	}
+	return 0
+}
+
+func (x *Ticker) GetLastQuantity() float64 {
+	if x != nil {
+		return x.LastQuantity
+	}
+	return 0
+}
+
+func (x *Ticker) GetOpenTime() int64 {
+	if x != nil {
+		return x.OpenTime
+	}
+	return 0
+}
+
+func (x *Ticker) GetCloseTime() int64 {
+	if x != nil {
+		return x.CloseTime
+	}
+	return 0
+}
+
+func (x *Ticker) GetFirstTradeId() int64 {
+	if x != nil {
+		return x.FirstTradeId
+	}
+	return 0
+}
+
+func (x *Ticker) GetLastTradeId() int64 {
+	if x != nil {
+		return x.LastTradeId
+	}
+	return 0
+}
+
+func (x *Ticker) GetTradeCount() int64 {
+	if x != nil {
+		return x.TradeCount
+	}
+	return 0
+}
+
+// 선물 미결제약정 (GET /fapi/v1/openInterest). Event.record 에 binance.openInterest (proto) 로 담긴다.
+type OpenInterest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	OpenInterest  float64                `protobuf:"fixed64,1,opt,name=open_interest,json=openInterest,proto3" json:"open_interest,omitempty"` // 기초 자산 수량
+	Time          int64                  `protobuf:"varint,2,opt,name=time,proto3" json:"time,omitempty"`                                      // 거래소 시간 (UTC ms)
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *OpenInterest) Reset() {
+	*x = OpenInterest{}
+	mi := &file_orderbook_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *OpenInterest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OpenInterest) ProtoMessage() {}
+
+func (x *OpenInterest) ProtoReflect() protoreflect.Message {
+	mi := &file_orderbook_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OpenInterest.ProtoReflect.Descriptor instead.
+func (*OpenInterest) Descriptor() ([]byte, []int) {
+	return file_orderbook_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *OpenInterest) GetOpenInterest() float64 {
+	if x != nil {
+		return x.OpenInterest
+	}
+	return 0
+}
+
+func (x *OpenInterest) GetTime() int64 {
+	if x != nil {
+		return x.Time
+	}
+	return 0
+}
+
+// 선물 펀딩비와 마크/인덱스 가격 (GET /fapi/v1/premiumIndex). Event.record 에 binance.fundingRate (proto) 로 담긴다.
+type FundingRate struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	FundingRate     float64                `protobuf:"fixed64,1,opt,name=funding_rate,json=fundingRate,proto3" json:"funding_rate,omitempty"`              // lastFundingRate: 다음 정산에 적용될 현재 펀딩비
+	NextFundingTime int64                  `protobuf:"varint,2,opt,name=next_funding_time,json=nextFundingTime,proto3" json:"next_funding_time,omitempty"` // 다음 정산 시간 (UTC ms)
+	MarkPrice       float64                `protobuf:"fixed64,3,opt,name=mark_price,json=markPrice,proto3" json:"mark_price,omitempty"`
+	IndexPrice      float64                `protobuf:"fixed64,4,opt,name=index_price,json=indexPrice,proto3" json:"index_price,omitempty"`
+	InterestRate    float64                `protobuf:"fixed64,5,opt,name=interest_rate,json=interestRate,proto3" json:"interest_rate,omitempty"`
+	Time            int64                  `protobuf:"varint,6,opt,name=time,proto3" json:"time,omitempty"` // 거래소 시간 (UTC ms)
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *FundingRate) Reset() {
+	*x = FundingRate{}
+	mi := &file_orderbook_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FundingRate) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FundingRate) ProtoMessage() {}
+
+func (x *FundingRate) ProtoReflect() protoreflect.Message {
+	mi := &file_orderbook_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FundingRate.ProtoReflect.Descriptor instead.
+func (*FundingRate) Descriptor() ([]byte, []int) {
+	return file_orderbook_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *FundingRate) GetFundingRate() float64 {
+	if x != nil {
+		return x.FundingRate
+	}
+	return 0
+}
+
+func (x *FundingRate) GetNextFundingTime() int64 {
+	if x != nil {
+		return x.NextFundingTime
+	}
+	return 0
+}
+
+func (x *FundingRate) GetMarkPrice() float64 {
+	if x != nil {
+		return x.MarkPrice
+	}
+	return 0
+}
+
+func (x *FundingRate) GetIndexPrice() float64 {
+	if x != nil {
+		return x.IndexPrice
+	}
+	return 0
+}
+
+func (x *FundingRate) GetInterestRate() float64 {
+	if x != nil {
+		return x.InterestRate
+	}
+	return 0
+}
+
+func (x *FundingRate) GetTime() int64 {
+	if x != nil {
+		return x.Time
+	}
+	return 0
+}
+
+// 최우선 매수/매도 호가(가격 또는 수량)가 바뀔 때만 남기는 tick. 스냅샷이나 bookTicker 에서 파생한다.
+type Tick struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	BidPrice        float64                `protobuf:"fixed64,1,opt,name=bid_price,json=bidPrice,proto3" json:"bid_price,omitempty"`
+	BidQuantity     float64                `protobuf:"fixed64,2,opt,name=bid_quantity,json=bidQuantity,proto3" json:"bid_quantity,omitempty"`
+	AskPrice        float64                `protobuf:"fixed64,3,opt,name=ask_price,json=askPrice,proto3" json:"ask_price,omitempty"`
+	AskQuantity     float64                `protobuf:"fixed64,4,opt,name=ask_quantity,json=askQuantity,proto3" json:"ask_quantity,omitempty"`
+	UpdateId        int64                  `protobuf:"varint,5,opt,name=update_id,json=updateId,proto3" json:"update_id,omitempty"`              // 파생에 쓴 원본의 lastUpdateId (bookTicker 는 u)
+	BidPriceText    string                 `protobuf:"bytes,6,opt,name=bid_price_text,json=bidPriceText,proto3" json:"bid_price_text,omitempty"` // 원본에 원래 문자열이 있으면 그대로 옮긴다
+	BidQuantityText string                 `protobuf:"bytes,7,opt,name=bid_quantity_text,json=bidQuantityText,proto3" json:"bid_quantity_text,omitempty"`
+	AskPriceText    string                 `protobuf:"bytes,8,opt,name=ask_price_text,json=askPriceText,proto3" json:"ask_price_text,omitempty"`
+	AskQuantityText string                 `protobuf:"bytes,9,opt,name=ask_quantity_text,json=askQuantityText,proto3" json:"ask_quantity_text,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *Tick) Reset() {
+	*x = Tick{}
+	mi := &file_orderbook_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Tick) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Tick) ProtoMessage() {}
+
+func (x *Tick) ProtoReflect() protoreflect.Message {
+	mi := &file_orderbook_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Tick.ProtoReflect.Descriptor instead.
+func (*Tick) Descriptor() ([]byte, []int) {
+	return file_orderbook_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *Tick) GetBidPrice() float64 {
+	if x != nil {
+		return x.BidPrice
+	}
+	return 0
+}
+
+func (x *Tick) GetBidQuantity() float64 {
+	if x != nil {
+		return x.BidQuantity
+	}
+	return 0
+}
+
+func (x *Tick) GetAskPrice() float64 {
+	if x != nil {
+		return x.AskPrice
+	}
+	return 0
+}
+
+func (x *Tick) GetAskQuantity() float64 {
+	if x != nil {
+		return x.AskQuantity
+	}
+	return 0
+}
+
+func (x *Tick) GetUpdateId() int64 {
+	if x != nil {
+		return x.UpdateId
+	}
+	return 0
+}
+
+func (x *Tick) GetBidPriceText() string {
+	if x != nil {
+		return x.BidPriceText
+	}
+	return ""
+}
+
+func (x *Tick) GetBidQuantityText() string {
+	if x != nil {
+		return x.BidQuantityText
+	}
+	return ""
+}
+
+func (x *Tick) GetAskPriceText() string {
+	if x != nil {
+		return x.AskPriceText
+	}
+	return ""
+}
+
+func (x *Tick) GetAskQuantityText() string {
+	if x != nil {
+		return x.AskQuantityText
+	}
+	return ""
+}
+
+// 서로 다른 스트림의 레코드를 하나의 파일(또는 토픽)에 순서대로 담기 위한 봉투.
+// payload 에 이 버전이 모르는 필드 번호가 오면 Payload 는 nil 이고 내용은 unknown field 로 남는다.
+// 이벤트를 다시 쓰는 도구는 그런 이벤트를 버리지 말고 그대로 Write 해야 한다 (proto 가 원래 바이트를 보존한다).
+type Event struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	EventTime  int64                  `protobuf:"varint,1,opt,name=event_time,json=eventTime,proto3" json:"event_time,omitempty"` // 데이터 수신 시간 (UTC ms)
+	Sequence   uint64                 `protobuf:"varint,2,opt,name=sequence,proto3" json:"sequence,omitempty"`                    // 수집기가 심볼별로 부여하는 순번. 세션 안에서 1 씩 증가하며, 빠진 번호는 수집기에서 유실된 레코드다
+	Symbol     string                 `protobuf:"bytes,3,opt,name=symbol,proto3" json:"symbol,omitempty"`
+	Exchange   string                 `protobuf:"bytes,4,opt,name=exchange,proto3" json:"exchange,omitempty"`
+	MarketType string                 `protobuf:"bytes,5,opt,name=market_type,json=marketType,proto3" json:"market_type,omitempty"`
+	StreamType string                 `protobuf:"bytes,6,opt,name=stream_type,json=streamType,proto3" json:"stream_type,omitempty"` // 예: depth20@100ms. 수집기가 REST 로 받은 스냅샷은 rest/depth
+	// 거래소가 찍은 이벤트 시간 E (UTC ms). E 가 없는 스트림(현물 depth20, bookTicker)은 0.
+	// event_time 은 로컬 시계 기준이므로 호스트 간 정렬에는 이 값을 쓴다.
+	ExchangeTime  int64 `protobuf:"varint,7,opt,name=exchange_time,json=exchangeTime,proto3" json:"exchange_time,omitempty"`
+	ReceiveTimeNs int64 `protobuf:"varint,8,opt,name=receive_time_ns,json=receiveTimeNs,proto3" json:"receive_time_ns,omitempty"` // 로컬 수신 시간 (UTC ns). event_time 의 나노초 버전
+	LatencyUs     int64 `protobuf:"varint,9,opt,name=latency_us,json=latencyUs,proto3" json:"latency_us,omitempty"`               // receive_time_ns - exchange_time (마이크로초). exchange_time 이 0 이면 의미 없음
+	// Types that are valid to be assigned to Payload:
+	//
+	//	*Event_Snapshot
+	//	*Event_DepthDiff
+	//	*Event_Trade
+	//	*Event_BookTicker
+	//	*Event_Tick
+	//	*Event_Record
+	//	*Event_Liquidation
+	//	*Event_Ticker
+	Payload       isEvent_Payload `protobuf_oneof:"payload"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Event) Reset() {
+	*x = Event{}
+	mi := &file_orderbook_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Event) ProtoMessage() {}
+
+func (x *Event) ProtoReflect() protoreflect.Message {
+	mi := &file_orderbook_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Event.ProtoReflect.Descriptor instead.
+func (*Event) Descriptor() ([]byte, []int) {
+	return file_orderbook_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *Event) GetEventTime() int64 {
+	if x != nil {
+		return x.EventTime
+	}
+	return 0
+}
+
+func (x *Event) GetSequence() uint64 {
+	if x != nil {
+		return x.Sequence
+	}
+	return 0
+}
+
+func (x *Event) GetSymbol() string {
+	if x != nil {
+		return x.Symbol
+	}
+	return ""
+}
+
+func (x *Event) GetExchange() string {
+	if x != nil {
+		return x.Exchange
+	}
+	return ""
+}
+
+func (x *Event) GetMarketType() string {
+	if x != nil {
+		return x.MarketType
+	}
+	return ""
+}
+
+func (x *Event) GetStreamType() string {
+	if x != nil {
+		return x.StreamType
+	}
+	return ""
+}
+
+func (x *Event) GetExchangeTime() int64 {
+	if x != nil {
+		return x.ExchangeTime
+	}
+	return 0
+}
+
+func (x *Event) GetReceiveTimeNs() int64 {
+	if x != nil {
+		return x.ReceiveTimeNs
+	}
+	return 0
+}
+
+func (x *Event) GetLatencyUs() int64 {
+	if x != nil {
+		return x.LatencyUs
+	}
+	return 0
+}
+
+func (x *Event) GetPayload() isEvent_Payload {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *Event) GetSnapshot() *Snapshot {
+	if x != nil {
+		if x, ok := x.Payload.(*Event_Snapshot); ok {
+			return x.Snapshot
+		}
+	}
+	return nil
+}
+
+func (x *Event) GetDepthDiff() *DepthDiff {
+	if x != nil {
+		if x, ok := x.Payload.(*Event_DepthDiff); ok {
+			return x.DepthDiff
+		}
+	}
+	return nil
+}
+
+func (x *Event) GetTrade() *Trade {
+	if x != nil {
+		if x, ok := x.Payload.(*Event_Trade); ok {
+			return x.Trade
+		}
+	}
+	return nil
+}
+
+func (x *Event) GetBookTicker() *BookTicker {
+	if x != nil {
+		if x, ok := x.Payload.(*Event_BookTicker); ok {
+			return x.BookTicker
+		}
+	}
+	return nil
+}
+
+func (x *Event) GetTick() *Tick {
+	if x != nil {
+		if x, ok := x.Payload.(*Event_Tick); ok {
+			return x.Tick
+		}
+	}
+	return nil
+}
+
+func (x *Event) GetRecord() *Record {
+	if x != nil {
+		if x, ok := x.Payload.(*Event_Record); ok {
+			return x.Record
+		}
+	}
+	return nil
+}
+
+func (x *Event) GetLiquidation() *Liquidation {
+	if x != nil {
+		if x, ok := x.Payload.(*Event_Liquidation); ok {
+			return x.Liquidation
+		}
+	}
+	return nil
+}
+
+func (x *Event) GetTicker() *Ticker {
+	if x != nil {
+		if x, ok := x.Payload.(*Event_Ticker); ok {
+			return x.Ticker
+		}
+	}
+	return nil
+}
+
+type isEvent_Payload interface {
+	isEvent_Payload()
+}
+
+type Event_Snapshot struct {
+	Snapshot *Snapshot `protobuf:"bytes,10,opt,name=snapshot,proto3,oneof"`
+}
+
+type Event_DepthDiff struct {
+	DepthDiff *DepthDiff `protobuf:"bytes,11,opt,name=depth_diff,json=depthDiff,proto3,oneof"`
+}
+
+type Event_Trade struct {
+	Trade *Trade `protobuf:"bytes,12,opt,name=trade,proto3,oneof"`
+}
+
+type Event_BookTicker struct {
+	BookTicker *BookTicker `protobuf:"bytes,13,opt,name=book_ticker,json=bookTicker,proto3,oneof"`
+}
+
+type Event_Tick struct {
+	Tick *Tick `protobuf:"bytes,14,opt,name=tick,proto3,oneof"`
+}
+
+type Event_Record struct {
+	Record *Record `protobuf:"bytes,15,opt,name=record,proto3,oneof"`
+}
+
+type Event_Liquidation struct {
+	Liquidation *Liquidation `protobuf:"bytes,16,opt,name=liquidation,proto3,oneof"`
+}
+
+type Event_Ticker struct {
+	Ticker *Ticker `protobuf:"bytes,17,opt,name=ticker,proto3,oneof"`
+}
+
+func (*Event_Snapshot) isEvent_Payload() {}
+
+func (*Event_DepthDiff) isEvent_Payload() {}
+
+func (*Event_Trade) isEvent_Payload() {}
+
+func (*Event_BookTicker) isEvent_Payload() {}
+
+func (*Event_Tick) isEvent_Payload() {}
+
+func (*Event_Record) isEvent_Payload() {}
+
+func (*Event_Liquidation) isEvent_Payload() {}
+
+func (*Event_Ticker) isEvent_Payload() {}
+
+// 파일 안의 각 세션 앞에 기록되는 헤더. 수집기가 (재)시작하며 파일을 열 때마다 하나씩 쓰인다.
+type FileHeader struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Version        uint32                 `protobuf:"varint,1,opt,name=version,proto3" json:"version,omitempty"`
+	CreatedAt      int64                  `protobuf:"varint,2,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"` // 세션 시작 시간 (UTC ms)
+	Symbol         string                 `protobuf:"bytes,3,opt,name=symbol,proto3" json:"symbol,omitempty"`
+	Exchange       string                 `protobuf:"bytes,4,opt,name=exchange,proto3" json:"exchange,omitempty"`
+	MarketType     string                 `protobuf:"bytes,5,opt,name=market_type,json=marketType,proto3" json:"market_type,omitempty"`
+	SessionId      string                 `protobuf:"bytes,6,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"` // 수집기 프로세스마다 새로 발급. 순번은 세션이 바뀌면 1 부터 다시 시작한다
+	Compression    Compression            `protobuf:"varint,7,opt,name=compression,proto3,enum=orderbook.Compression" json:"compression,omitempty"`
+	Streams        []string               `protobuf:"bytes,8,rep,name=streams,proto3" json:"streams,omitempty"`                                      // 이 세션에서 구독한 stream_type (depth5@1000ms, trade 등). 심볼마다 고른 깊이와 속도를 알 수 있다
+	SnapshotSample uint32                 `protobuf:"varint,9,opt,name=snapshot_sample,json=snapshotSample,proto3" json:"snapshot_sample,omitempty"` // partial depth 스냅샷을 이 개수마다 하나만 기록했다. 0 이면 모두 기록했다
+	ListedAt       int64                  `protobuf:"varint,10,opt,name=listed_at,json=listedAt,proto3" json:"listed_at,omitempty"`                  // 수집기가 신규 상장을 감지해 이 심볼을 받기 시작한 시간 (UTC ms). 0 이면 상장 감지로 시작하지 않았다
+	// 세션 시작 때 exchangeInfo 필터 (거래소 문자열 그대로, 예: "0.01000000"). 메타데이터가 없었으면 빈 문자열.
+	// 거래소가 호가 단위를 바꿔도 그 시점의 값이 파일에 남는다.
+	TickSize      string          `protobuf:"bytes,11,opt,name=tick_size,json=tickSize,proto3" json:"tick_size,omitempty"`
+	StepSize      string          `protobuf:"bytes,12,opt,name=step_size,json=stepSize,proto3" json:"step_size,omitempty"`
+	MinNotional   string          `protobuf:"bytes,13,opt,name=min_notional,json=minNotional,proto3" json:"min_notional,omitempty"`
+	Option        *OptionContract `protobuf:"bytes,14,opt,name=option,proto3" json:"option,omitempty"` // 옵션 심볼이면 계약 조건. 다른 시장은 비어 있다
+	Clock         *ClockSync      `protobuf:"bytes,15,opt,name=clock,proto3" json:"clock,omitempty"`   // 파일을 열 때 가장 최근에 잰 거래소 시계와의 차이 (collect -clock-header). 재지 않았으면 비어 있다
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FileHeader) Reset() {
+	*x = FileHeader{}
+	mi := &file_orderbook_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FileHeader) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FileHeader) ProtoMessage() {}
+
+func (x *FileHeader) ProtoReflect() protoreflect.Message {
+	mi := &file_orderbook_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FileHeader.ProtoReflect.Descriptor instead.
+func (*FileHeader) Descriptor() ([]byte, []int) {
+	return file_orderbook_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *FileHeader) GetVersion() uint32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *FileHeader) GetCreatedAt() int64 {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return 0
+}
+
+func (x *FileHeader) GetSymbol() string {
+	if x != nil {
+		return x.Symbol
+	}
+	return ""
+}
+
+func (x *FileHeader) GetExchange() string {
+	if x != nil {
+		return x.Exchange
+	}
+	return ""
+}
+
+func (x *FileHeader) GetMarketType() string {
+	if x != nil {
+		return x.MarketType
+	}
+	return ""
+}
+
+func (x *FileHeader) GetSessionId() string {
+	if x != nil {
+		return x.SessionId
+	}
+	return ""
+}
+
+func (x *FileHeader) GetCompression() Compression {
+	if x != nil {
+		return x.Compression
+	}
+	return Compression_COMPRESSION_NONE
+}
+
+func (x *FileHeader) GetStreams() []string {
+	if x != nil {
+		return x.Streams
+	}
+	return nil
+}
+
+func (x *FileHeader) GetSnapshotSample() uint32 {
+	if x != nil {
+		return x.SnapshotSample
+	}
+	return 0
+}
+
+func (x *FileHeader) GetListedAt() int64 {
+	if x != nil {
+		return x.ListedAt
+	}
+	return 0
+}
+
+func (x *FileHeader) GetTickSize() string {
+	if x != nil {
+		return x.TickSize
+	}
+	return ""
+}
+
+func (x *FileHeader) GetStepSize() string {
+	if x != nil {
+		return x.StepSize
+	}
+	return ""
+}
+
+func (x *FileHeader) GetMinNotional() string {
+	if x != nil {
+		return x.MinNotional
+	}
+	return ""
+}
+
+func (x *FileHeader) GetOption() *OptionContract {
+	if x != nil {
+		return x.Option
+	}
+	return nil
+}
+
+func (x *FileHeader) GetClock() *ClockSync {
+	if x != nil {
+		return x.Clock
+	}
+	return nil
+}
+
+// 옵션(European options) 계약 조건. 심볼 이름(BTC-240329-60000-C)에도 들어 있지만 만기 시각과 기초 자산은
+// exchangeInfo 가 있으면 그 값을 쓴다.
+type OptionContract struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Underlying    string                 `protobuf:"bytes,1,opt,name=underlying,proto3" json:"underlying,omitempty"`                      // 예: BTCUSDT
+	StrikePrice   string                 `protobuf:"bytes,2,opt,name=strike_price,json=strikePrice,proto3" json:"strike_price,omitempty"` // 거래소 문자열 그대로 (예: "60000")
+	ExpiryTime    int64                  `protobuf:"varint,3,opt,name=expiry_time,json=expiryTime,proto3" json:"expiry_time,omitempty"`   // 만기 (UTC ms)
+	Side          string                 `protobuf:"bytes,4,opt,name=side,proto3" json:"side,omitempty"`                                  // CALL, PUT
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *OptionContract) Reset() {
+	*x = OptionContract{}
+	mi := &file_orderbook_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *OptionContract) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OptionContract) ProtoMessage() {}
+
+func (x *OptionContract) ProtoReflect() protoreflect.Message {
+	mi := &file_orderbook_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OptionContract.ProtoReflect.Descriptor instead.
+func (*OptionContract) Descriptor() ([]byte, []int) {
+	return file_orderbook_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *OptionContract) GetUnderlying() string {
+	if x != nil {
+		return x.Underlying
+	}
+	return ""
+}
+
+func (x *OptionContract) GetStrikePrice() string {
+	if x != nil {
+		return x.StrikePrice
+	}
+	return ""
+}
+
+func (x *OptionContract) GetExpiryTime() int64 {
+	if x != nil {
+		return x.ExpiryTime
+	}
+	return 0
+}
+
+func (x *OptionContract) GetSide() string {
+	if x != nil {
+		return x.Side
+	}
+	return ""
+}
+
+// 거래소 서버 시각(GET /api/v3/time 등)과 로컬 시계의 차이. event_time, receive_time_ns 에 offset_us 를 더하면
+// 거래소 시계 기준이 되어 다른 호스트에서 받은 파일과 맞춰 볼 수 있다.
+type ClockSync struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	OffsetUs      int64                  `protobuf:"varint,1,opt,name=offset_us,json=offsetUs,proto3" json:"offset_us,omitempty"`       // 서버 시각 - 로컬 시각 (마이크로초). 로컬 시계가 늦으면 양수
+	RttUs         int64                  `protobuf:"varint,2,opt,name=rtt_us,json=rttUs,proto3" json:"rtt_us,omitempty"`                // 잰 요청의 왕복 시간 (마이크로초). offset_us 의 오차는 대략 이 절반 이내다
+	MeasuredAt    int64                  `protobuf:"varint,3,opt,name=measured_at,json=measuredAt,proto3" json:"measured_at,omitempty"` // 잰 시각 (로컬 UTC ms)
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ClockSync) Reset() {
+	*x = ClockSync{}
+	mi := &file_orderbook_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ClockSync) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ClockSync) ProtoMessage() {}
+
+func (x *ClockSync) ProtoReflect() protoreflect.Message {
+	mi := &file_orderbook_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ClockSync.ProtoReflect.Descriptor instead.
+func (*ClockSync) Descriptor() ([]byte, []int) {
+	return file_orderbook_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *ClockSync) GetOffsetUs() int64 {
+	if x != nil {
+		return x.OffsetUs
+	}
+	return 0
+}
+
+func (x *ClockSync) GetRttUs() int64 {
+	if x != nil {
+		return x.RttUs
+	}
+	return 0
+}
+
+func (x *ClockSync) GetMeasuredAt() int64 {
+	if x != nil {
+		return x.MeasuredAt
+	}
+	return 0
+}
+
+// 파일 끝 footer 에 기록되는 블록 인덱스 항목
+type IndexEntry struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	EventTime     int64                  `protobuf:"varint,1,opt,name=event_time,json=eventTime,proto3" json:"event_time,omitempty"`          // 블록 첫 이벤트의 수신 시간 (UTC ms)
+	Sequence      uint64                 `protobuf:"varint,2,opt,name=sequence,proto3" json:"sequence,omitempty"`                             // 블록 첫 이벤트의 순번
+	Offset        int64                  `protobuf:"varint,3,opt,name=offset,proto3" json:"offset,omitempty"`                                 // 블록 시작 위치 (파일 처음부터의 바이트)
+	HeaderOffset  int64                  `protobuf:"varint,4,opt,name=header_offset,json=headerOffset,proto3" json:"header_offset,omitempty"` // 블록이 속한 세션 헤더(Magic) 위치. 헤더 없는 v1 구간이면 -1
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *IndexEntry) Reset() {
+	*x = IndexEntry{}
+	mi := &file_orderbook_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *IndexEntry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IndexEntry) ProtoMessage() {}
+
+func (x *IndexEntry) ProtoReflect() protoreflect.Message {
+	mi := &file_orderbook_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IndexEntry.ProtoReflect.Descriptor instead.
+func (*IndexEntry) Descriptor() ([]byte, []int) {
+	return file_orderbook_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *IndexEntry) GetEventTime() int64 {
+	if x != nil {
+		return x.EventTime
+	}
+	return 0
+}
+
+func (x *IndexEntry) GetSequence() uint64 {
+	if x != nil {
+		return x.Sequence
+	}
+	return 0
+}
+
+func (x *IndexEntry) GetOffset() int64 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+func (x *IndexEntry) GetHeaderOffset() int64 {
+	if x != nil {
+		return x.HeaderOffset
+	}
+	return 0
+}
+
+type FileIndex struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Entries       []*IndexEntry          `protobuf:"bytes,1,rep,name=entries,proto3" json:"entries,omitempty"`
+	DataSize      int64                  `protobuf:"varint,2,opt,name=data_size,json=dataSize,proto3" json:"data_size,omitempty"` // 사이드카 인덱스가 만들어질 때의 데이터 파일 크기. footer 에서는 0
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FileIndex) Reset() {
+	*x = FileIndex{}
+	mi := &file_orderbook_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FileIndex) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FileIndex) ProtoMessage() {}
+
+func (x *FileIndex) ProtoReflect() protoreflect.Message {
+	mi := &file_orderbook_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FileIndex.ProtoReflect.Descriptor instead.
+func (*FileIndex) Descriptor() ([]byte, []int) {
+	return file_orderbook_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *FileIndex) GetEntries() []*IndexEntry {
+	if x != nil {
+		return x.Entries
+	}
+	return nil
+}
+
+func (x *FileIndex) GetDataSize() int64 {
+	if x != nil {
+		return x.DataSize
+	}
+	return 0
+}
+
+// 전용 payload 가 없는 레코드 (Event.record). 새 스트림 종류는 먼저 이 형태로 기록하고, 디코더는 orderbook.RegisterRecordType 으로 붙인다.
+// 디코더가 없는 도구도 data 를 그대로 복사하므로 기록이 사라지지 않는다.
+type Record struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Type          string                 `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`         // 레코드 종류 (예: binance.aggTrade)
+	Encoding      string                 `protobuf:"bytes,2,opt,name=encoding,proto3" json:"encoding,omitempty"` // data 형식 (json, proto)
+	Data          []byte                 `protobuf:"bytes,3,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Record) Reset() {
+	*x = Record{}
+	mi := &file_orderbook_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Record) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Record) ProtoMessage() {}
+
+func (x *Record) ProtoReflect() protoreflect.Message {
+	mi := &file_orderbook_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Record.ProtoReflect.Descriptor instead.
+func (*Record) Descriptor() ([]byte, []int) {
+	return file_orderbook_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *Record) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Record) GetEncoding() string {
+	if x != nil {
+		return x.Encoding
+	}
+	return ""
+}
+
+func (x *Record) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+var File_orderbook_proto protoreflect.FileDescriptor
+
+const file_orderbook_proto_rawDesc = "" +
+	"\n" +
+	"\x0forderbook.proto\x12\torderbook\"}\n" +
+	"\x05Level\x12\x14\n" +
+	"\x05price\x18\x01 \x01(\x01R\x05price\x12\x1a\n" +
+	"\bquantity\x18\x02 \x01(\x01R\bquantity\x12\x1d\n" +
+	"\n" +
+	"price_text\x18\x03 \x01(\tR\tpriceText\x12#\n" +
+	"\rquantity_text\x18\x04 \x01(\tR\fquantityText\"\x91\x02\n" +
+	"\bSnapshot\x12\x1d\n" +
+	"\n" +
+	"event_time\x18\x01 \x01(\x03R\teventTime\x12$\n" +
+	"\x0elast_update_id\x18\x02 \x01(\x03R\flastUpdateId\x12$\n" +
+	"\x04bids\x18\x03 \x03(\v2\x10.orderbook.LevelR\x04bids\x12$\n" +
+	"\x04asks\x18\x04 \x03(\v2\x10.orderbook.LevelR\x04asks\x12\x16\n" +
+	"\x06symbol\x18\x05 \x01(\tR\x06symbol\x12\x1a\n" +
+	"\bexchange\x18\x06 \x01(\tR\bexchange\x12\x1f\n" +
+	"\vmarket_type\x18\a \x01(\tR\n" +
+	"marketType\x12\x1f\n" +
+	"\vstream_type\x18\b \x01(\tR\n" +
+	"streamType\"\xd8\x01\n" +
+	"\tDepthDiff\x12&\n" +
+	"\x0ffirst_update_id\x18\x01 \x01(\x03R\rfirstUpdateId\x12&\n" +
+	"\x0ffinal_update_id\x18\x02 \x01(\x03R\rfinalUpdateId\x12/\n" +
+	"\x14prev_final_update_id\x18\x03 \x01(\x03R\x11prevFinalUpdateId\x12$\n" +
+	"\x04bids\x18\x04 \x03(\v2\x10.orderbook.LevelR\x04bids\x12$\n" +
+	"\x04asks\x18\x05 \x03(\v2\x10.orderbook.LevelR\x04asks\"\xdd\x01\n" +
+	"\x05Trade\x12\x19\n" +
+	"\btrade_id\x18\x01 \x01(\x03R\atradeId\x12\x14\n" +
+	"\x05price\x18\x02 \x01(\x01R\x05price\x12\x1a\n" +
+	"\bquantity\x18\x03 \x01(\x01R\bquantity\x12\x1d\n" +
+	"\n" +
+	"trade_time\x18\x04 \x01(\x03R\ttradeTime\x12$\n" +
+	"\x0ebuyer_is_maker\x18\x05 \x01(\bR\fbuyerIsMaker\x12\x1d\n" +
+	"\n" +
+	"price_text\x18\x06 \x01(\tR\tpriceText\x12#\n" +
+	"\rquantity_text\x18\a \x01(\tR\fquantityText\"\xcd\x02\n" +
+	"\n" +
+	"BookTicker\x12\x1b\n" +
+	"\tupdate_id\x18\x01 \x01(\x03R\bupdateId\x12\x1b\n" +
+	"\tbid_price\x18\x02 \x01(\x01R\bbidPrice\x12!\n" +
+	"\fbid_quantity\x18\x03 \x01(\x01R\vbidQuantity\x12\x1b\n" +
+	"\task_price\x18\x04 \x01(\x01R\baskPrice\x12!\n" +
+	"\fask_quantity\x18\x05 \x01(\x01R\vaskQuantity\x12$\n" +
+	"\x0ebid_price_text\x18\x06 \x01(\tR\fbidPriceText\x12*\n" +
+	"\x11bid_quantity_text\x18\a \x01(\tR\x0fbidQuantityText\x12$\n" +
+	"\x0eask_price_text\x18\b \x01(\tR\faskPriceText\x12*\n" +
+	"\x11ask_quantity_text\x18\t \x01(\tR\x0faskQuantityText\"\xac\x04\n" +
+	"\vLiquidation\x12\x12\n" +
+	"\x04side\x18\x01 \x01(\tR\x04side\x12\x1d\n" +
+	"\n" +
+	"order_type\x18\x02 \x01(\tR\torderType\x12\"\n" +
+	"\rtime_in_force\x18\x03 \x01(\tR\vtimeInForce\x12\x14\n" +
+	"\x05price\x18\x04 \x01(\x01R\x05price\x12#\n" +
+	"\raverage_price\x18\x05 \x01(\x01R\faveragePrice\x12\x1a\n" +
+	"\bquantity\x18\x06 \x01(\x01R\bquantity\x120\n" +
+	"\x14last_filled_quantity\x18\a \x01(\x01R\x12lastFilledQuantity\x12'\n" +
+	"\x0ffilled_quantity\x18\b \x01(\x01R\x0efilledQuantity\x12\x16\n" +
+	"\x06status\x18\t \x01(\tR\x06status\x12\x1d\n" +
+	"\n" +
+	"trade_time\x18\n" +
+	" \x01(\x03R\ttradeTime\x12\x1d\n" +
+	"\n" +
+	"price_text\x18\v \x01(\tR\tpriceText\x12,\n" +
+	"\x12average_price_text\x18\f \x01(\tR\x10averagePriceText\x12#\n" +
+	"\rquantity_text\x18\r \x01(\tR\fquantityText\x129\n" +
+	"\x19last_filled_quantity_text\x18\x0e \x01(\tR\x16lastFilledQuantityText\x120\n" +
+	"\x14filled_quantity_text\x18\x0f \x01(\tR\x12filledQuantityText\"\x8c\x04\n" +
+	"\x06Ticker\x12\x1d\n" +
+	"\n" +
+	"last_price\x18\x01 \x01(\x01R\tlastPrice\x12\x1d\n" +
+	"\n" +
+	"open_price\x18\x02 \x01(\x01R\topenPrice\x12\x1d\n" +
+	"\n" +
+	"high_price\x18\x03 \x01(\x01R\thighPrice\x12\x1b\n" +
+	"\tlow_price\x18\x04 \x01(\x01R\blowPrice\x12\x16\n" +
+	"\x06volume\x18\x05 \x01(\x01R\x06volume\x12!\n" +
+	"\fquote_volume\x18\x06 \x01(\x01R\vquoteVolume\x12!\n" +
+	"\fprice_change\x18\a \x01(\x01R\vpriceChange\x120\n" +
+	"\x14price_change_percent\x18\b \x01(\x01R\x12priceChangePercent\x12,\n" +
+	"\x12weighted_avg_price\x18\t \x01(\x01R\x10weightedAvgPrice\x12#\n" +
+	"\rlast_quantity\x18\n" +
+	" \x01(\x01R\flastQuantity\x12\x1b\n" +
+	"\topen_time\x18\v \x01(\x03R\bopenTime\x12\x1d\n" +
+	"\n" +
+	"close_time\x18\f \x01(\x03R\tcloseTime\x12$\n" +
+	"\x0efirst_trade_id\x18\r \x01(\x03R\ffirstTradeId\x12\"\n" +
+	"\rlast_trade_id\x18\x0e \x01(\x03R\vlastTradeId\x12\x1f\n" +
+	"\vtrade_count\x18\x0f \x01(\x03R\n" +
+	"tradeCount\"G\n" +
+	"\fOpenInterest\x12#\n" +
+	"\ropen_interest\x18\x01 \x01(\x01R\fopenInterest\x12\x12\n" +
+	"\x04time\x18\x02 \x01(\x03R\x04time\"\xd5\x01\n" +
+	"\vFundingRate\x12!\n" +
+	"\ffunding_rate\x18\x01 \x01(\x01R\vfundingRate\x12*\n" +
+	"\x11next_funding_time\x18\x02 \x01(\x03R\x0fnextFundingTime\x12\x1d\n" +
+	"\n" +
+	"mark_price\x18\x03 \x01(\x01R\tmarkPrice\x12\x1f\n" +
+	"\vindex_price\x18\x04 \x01(\x01R\n" +
+	"indexPrice\x12#\n" +
+	"\rinterest_rate\x18\x05 \x01(\x01R\finterestRate\x12\x12\n" +
+	"\x04time\x18\x06 \x01(\x03R\x04time\"\xc7\x02\n" +
+	"\x04Tick\x12\x1b\n" +
+	"\tbid_price\x18\x01 \x01(\x01R\bbidPrice\x12!\n" +
+	"\fbid_quantity\x18\x02 \x01(\x01R\vbidQuantity\x12\x1b\n" +
+	"\task_price\x18\x03 \x01(\x01R\baskPrice\x12!\n" +
+	"\fask_quantity\x18\x04 \x01(\x01R\vaskQuantity\x12\x1b\n" +
+	"\tupdate_id\x18\x05 \x01(\x03R\bupdateId\x12$\n" +
+	"\x0ebid_price_text\x18\x06 \x01(\tR\fbidPriceText\x12*\n" +
+	"\x11bid_quantity_text\x18\a \x01(\tR\x0fbidQuantityText\x12$\n" +
+	"\x0eask_price_text\x18\b \x01(\tR\faskPriceText\x12*\n" +
+	"\x11ask_quantity_text\x18\t \x01(\tR\x0faskQuantityText\"\xba\x05\n" +
+	"\x05Event\x12\x1d\n" +
+	"\n" +
+	"event_time\x18\x01 \x01(\x03R\teventTime\x12\x1a\n" +
+	"\bsequence\x18\x02 \x01(\x04R\bsequence\x12\x16\n" +
+	"\x06symbol\x18\x03 \x01(\tR\x06symbol\x12\x1a\n" +
+	"\bexchange\x18\x04 \x01(\tR\bexchange\x12\x1f\n" +
+	"\vmarket_type\x18\x05 \x01(\tR\n" +
+	"marketType\x12\x1f\n" +
+	"\vstream_type\x18\x06 \x01(\tR\n" +
+	"streamType\x12#\n" +
+	"\rexchange_time\x18\a \x01(\x03R\fexchangeTime\x12&\n" +
+	"\x0freceive_time_ns\x18\b \x01(\x03R\rreceiveTimeNs\x12\x1d\n" +
+	"\n" +
+	"latency_us\x18\t \x01(\x03R\tlatencyUs\x121\n" +
+	"\bsnapshot\x18\n" +
+	" \x01(\v2\x13.orderbook.SnapshotH\x00R\bsnapshot\x125\n" +
+	"\n" +
+	"depth_diff\x18\v \x01(\v2\x14.orderbook.DepthDiffH\x00R\tdepthDiff\x12(\n" +
+	"\x05trade\x18\f \x01(\v2\x10.orderbook.TradeH\x00R\x05trade\x128\n" +
+	"\vbook_ticker\x18\r \x01(\v2\x15.orderbook.BookTickerH\x00R\n" +
+	"bookTicker\x12%\n" +
+	"\x04tick\x18\x0e \x01(\v2\x0f.orderbook.TickH\x00R\x04tick\x12+\n" +
+	"\x06record\x18\x0f \x01(\v2\x11.orderbook.RecordH\x00R\x06record\x12:\n" +
+	"\vliquidation\x18\x10 \x01(\v2\x16.orderbook.LiquidationH\x00R\vliquidation\x12+\n" +
+	"\x06ticker\x18\x11 \x01(\v2\x11.orderbook.TickerH\x00R\x06tickerB\t\n" +
+	"\apayload\"\x8f\x04\n" +
+	"\n" +
+	"FileHeader\x12\x18\n" +
+	"\aversion\x18\x01 \x01(\rR\aversion\x12\x1d\n" +
+	"\n" +
+	"created_at\x18\x02 \x01(\x03R\tcreatedAt\x12\x16\n" +
+	"\x06symbol\x18\x03 \x01(\tR\x06symbol\x12\x1a\n" +
+	"\bexchange\x18\x04 \x01(\tR\bexchange\x12\x1f\n" +
+	"\vmarket_type\x18\x05 \x01(\tR\n" +
+	"marketType\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x06 \x01(\tR\tsessionId\x128\n" +
+	"\vcompression\x18\a \x01(\x0e2\x16.orderbook.CompressionR\vcompression\x12\x18\n" +
+	"\astreams\x18\b \x03(\tR\astreams\x12'\n" +
+	"\x0fsnapshot_sample\x18\t \x01(\rR\x0esnapshotSample\x12\x1b\n" +
+	"\tlisted_at\x18\n" +
+	" \x01(\x03R\blistedAt\x12\x1b\n" +
+	"\ttick_size\x18\v \x01(\tR\btickSize\x12\x1b\n" +
+	"\tstep_size\x18\f \x01(\tR\bstepSize\x12!\n" +
+	"\fmin_notional\x18\r \x01(\tR\vminNotional\x121\n" +
+	"\x06option\x18\x0e \x01(\v2\x19.orderbook.OptionContractR\x06option\x12*\n" +
+	"\x05clock\x18\x0f \x01(\v2\x14.orderbook.ClockSyncR\x05clock\"\x88\x01\n" +
+	"\x0eOptionContract\x12\x1e\n" +
+	"\n" +
+	"underlying\x18\x01 \x01(\tR\n" +
+	"underlying\x12!\n" +
+	"\fstrike_price\x18\x02 \x01(\tR\vstrikePrice\x12\x1f\n" +
+	"\vexpiry_time\x18\x03 \x01(\x03R\n" +
+	"expiryTime\x12\x12\n" +
+	"\x04side\x18\x04 \x01(\tR\x04side\"`\n" +
+	"\tClockSync\x12\x1b\n" +
+	"\toffset_us\x18\x01 \x01(\x03R\boffsetUs\x12\x15\n" +
+	"\x06rtt_us\x18\x02 \x01(\x03R\x05rttUs\x12\x1f\n" +
+	"\vmeasured_at\x18\x03 \x01(\x03R\n" +
+	"measuredAt\"\x84\x01\n" +
+	"\n" +
+	"IndexEntry\x12\x1d\n" +
+	"\n" +
+	"event_time\x18\x01 \x01(\x03R\teventTime\x12\x1a\n" +
+	"\bsequence\x18\x02 \x01(\x04R\bsequence\x12\x16\n" +
+	"\x06offset\x18\x03 \x01(\x03R\x06offset\x12#\n" +
+	"\rheader_offset\x18\x04 \x01(\x03R\fheaderOffset\"Y\n" +
+	"\tFileIndex\x12/\n" +
+	"\aentries\x18\x01 \x03(\v2\x15.orderbook.IndexEntryR\aentries\x12\x1b\n" +
+	"\tdata_size\x18\x02 \x01(\x03R\bdataSize\"L\n" +
+	"\x06Record\x12\x12\n" +
+	"\x04type\x18\x01 \x01(\tR\x04type\x12\x1a\n" +
+	"\bencoding\x18\x02 \x01(\tR\bencoding\x12\x12\n" +
+	"\x04data\x18\x03 \x01(\fR\x04data*9\n" +
+	"\vCompression\x12\x14\n" +
+	"\x10COMPRESSION_NONE\x10\x00\x12\x14\n" +
+	"\x10COMPRESSION_ZSTD\x10\x01B\rZ\v./orderbookb\x06proto3"
+
+var (
+	file_orderbook_proto_rawDescOnce sync.Once
+	file_orderbook_proto_rawDescData []byte
+)
+
+func file_orderbook_proto_rawDescGZIP() []byte {
+	file_orderbook_proto_rawDescOnce.Do(func() {
+		file_orderbook_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_orderbook_proto_rawDesc), len(file_orderbook_proto_rawDesc)))
+	})
+	return file_orderbook_proto_rawDescData
+}
+
+var file_orderbook_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_orderbook_proto_msgTypes = make([]protoimpl.MessageInfo, 17)
+var file_orderbook_proto_goTypes = []any{
+	(Compression)(0),       // 0: orderbook.Compression
+	(*Level)(nil),          // 1: orderbook.Level
+	(*Snapshot)(nil),       // 2: orderbook.Snapshot
+	(*DepthDiff)(nil),      // 3: orderbook.DepthDiff
+	(*Trade)(nil),          // 4: orderbook.Trade
+	(*BookTicker)(nil),     // 5: orderbook.BookTicker
+	(*Liquidation)(nil),    // 6: orderbook.Liquidation
+	(*Ticker)(nil),         // 7: orderbook.Ticker
+	(*OpenInterest)(nil),   // 8: orderbook.OpenInterest
+	(*FundingRate)(nil),    // 9: orderbook.FundingRate
+	(*Tick)(nil),           // 10: orderbook.Tick
+	(*Event)(nil),          // 11: orderbook.Event
+	(*FileHeader)(nil),     // 12: orderbook.FileHeader
+	(*OptionContract)(nil), // 13: orderbook.OptionContract
+	(*ClockSync)(nil),      // 14: orderbook.ClockSync
+	(*IndexEntry)(nil),     // 15: orderbook.IndexEntry
+	(*FileIndex)(nil),      // 16: orderbook.FileIndex
+	(*Record)(nil),         // 17: orderbook.Record
+}
+var file_orderbook_proto_depIdxs = []int32{
+	1,  // 0: orderbook.Snapshot.bids:type_name -> orderbook.Level
+	1,  // 1: orderbook.Snapshot.asks:type_name -> orderbook.Level
+	1,  // 2: orderbook.DepthDiff.bids:type_name -> orderbook.Level
+	1,  // 3: orderbook.DepthDiff.asks:type_name -> orderbook.Level
+	2,  // 4: orderbook.Event.snapshot:type_name -> orderbook.Snapshot
+	3,  // 5: orderbook.Event.depth_diff:type_name -> orderbook.DepthDiff
+	4,  // 6: orderbook.Event.trade:type_name -> orderbook.Trade
+	5,  // 7: orderbook.Event.book_ticker:type_name -> orderbook.BookTicker
+	10, // 8: orderbook.Event.tick:type_name -> orderbook.Tick
+	17, // 9: orderbook.Event.record:type_name -> orderbook.Record
+	6,  // 10: orderbook.Event.liquidation:type_name -> orderbook.Liquidation
+	7,  // 11: orderbook.Event.ticker:type_name -> orderbook.Ticker
+	0,  // 12: orderbook.FileHeader.compression:type_name -> orderbook.Compression
+	13, // 13: orderbook.FileHeader.option:type_name -> orderbook.OptionContract
+	14, // 14: orderbook.FileHeader.clock:type_name -> orderbook.ClockSync
+	15, // 15: orderbook.FileIndex.entries:type_name -> orderbook.IndexEntry
+	16, // [16:16] is the sub-list for method output_type
+	16, // [16:16] is the sub-list for method input_type
+	16, // [16:16] is the sub-list for extension type_name
+	16, // [16:16] is the sub-list for extension extendee
+	0,  // [0:16] is the sub-list for field type_name
+}
+
+func init() { file_orderbook_proto_init() }
+func file_orderbook_proto_init() {
+	if File_orderbook_proto != nil {
+		return
+	}
+	file_orderbook_proto_msgTypes[10].OneofWrappers = []any{
+		(*Event_Snapshot)(nil),
+		(*Event_DepthDiff)(nil),
+		(*Event_Trade)(nil),
+		(*Event_BookTicker)(nil),
+		(*Event_Tick)(nil),
+		(*Event_Record)(nil),
+		(*Event_Liquidation)(nil),
+		(*Event_Ticker)(nil),
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_orderbook_proto_rawDesc), len(file_orderbook_proto_rawDesc)),
-			NumEnums:      0,
-			NumMessages:   2,
+			NumEnums:      1,
+			NumMessages:   17,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
 		GoTypes:           file_orderbook_proto_goTypes,
 		DependencyIndexes: file_orderbook_proto_depIdxs,
+		EnumInfos:         file_orderbook_proto_enumTypes,
 		MessageInfos:      file_orderbook_proto_msgTypes,
 	}.Build()
 	File_orderbook_proto = out.File
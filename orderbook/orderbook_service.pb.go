@@ -0,0 +1,216 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.7
+// 	protoc        v6.31.1
+// source: orderbook_service.proto
+
+package orderbook
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type StreamLiveRequest struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Symbols []string               `protobuf:"bytes,1,rep,name=symbols,proto3" json:"symbols,omitempty"` // 비어 있으면 수집 중인 모든 심볼
+	// 0 이 아니면 수집기 메모리 캐시에 남아 있는 이 시각(UTC ms) 이후 이벤트를 먼저 보낸다
+	Since         int64 `protobuf:"varint,2,opt,name=since,proto3" json:"since,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamLiveRequest) Reset() {
+	*x = StreamLiveRequest{}
+	mi := &file_orderbook_service_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamLiveRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamLiveRequest) ProtoMessage() {}
+
+func (x *StreamLiveRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_orderbook_service_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamLiveRequest.ProtoReflect.Descriptor instead.
+func (*StreamLiveRequest) Descriptor() ([]byte, []int) {
+	return file_orderbook_service_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *StreamLiveRequest) GetSymbols() []string {
+	if x != nil {
+		return x.Symbols
+	}
+	return nil
+}
+
+func (x *StreamLiveRequest) GetSince() int64 {
+	if x != nil {
+		return x.Since
+	}
+	return 0
+}
+
+type StreamHistoricalRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Symbol        string                 `protobuf:"bytes,1,opt,name=symbol,proto3" json:"symbol,omitempty"`
+	From          int64                  `protobuf:"varint,2,opt,name=from,proto3" json:"from,omitempty"` // [from, to) 수신 시각 (UTC ms)
+	To            int64                  `protobuf:"varint,3,opt,name=to,proto3" json:"to,omitempty"`
+	Speed         float64                `protobuf:"fixed64,4,opt,name=speed,proto3" json:"speed,omitempty"` // 원래 간격의 몇 배로 보낼지 (1 = 실시간). 0 이면 최대한 빠르게
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamHistoricalRequest) Reset() {
+	*x = StreamHistoricalRequest{}
+	mi := &file_orderbook_service_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamHistoricalRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamHistoricalRequest) ProtoMessage() {}
+
+func (x *StreamHistoricalRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_orderbook_service_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamHistoricalRequest.ProtoReflect.Descriptor instead.
+func (*StreamHistoricalRequest) Descriptor() ([]byte, []int) {
+	return file_orderbook_service_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *StreamHistoricalRequest) GetSymbol() string {
+	if x != nil {
+		return x.Symbol
+	}
+	return ""
+}
+
+func (x *StreamHistoricalRequest) GetFrom() int64 {
+	if x != nil {
+		return x.From
+	}
+	return 0
+}
+
+func (x *StreamHistoricalRequest) GetTo() int64 {
+	if x != nil {
+		return x.To
+	}
+	return 0
+}
+
+func (x *StreamHistoricalRequest) GetSpeed() float64 {
+	if x != nil {
+		return x.Speed
+	}
+	return 0
+}
+
+var File_orderbook_service_proto protoreflect.FileDescriptor
+
+const file_orderbook_service_proto_rawDesc = "" +
+	"\n" +
+	"\x17orderbook_service.proto\x12\torderbook\x1a\x0forderbook.proto\"C\n" +
+	"\x11StreamLiveRequest\x12\x18\n" +
+	"\asymbols\x18\x01 \x03(\tR\asymbols\x12\x14\n" +
+	"\x05since\x18\x02 \x01(\x03R\x05since\"k\n" +
+	"\x17StreamHistoricalRequest\x12\x16\n" +
+	"\x06symbol\x18\x01 \x01(\tR\x06symbol\x12\x12\n" +
+	"\x04from\x18\x02 \x01(\x03R\x04from\x12\x0e\n" +
+	"\x02to\x18\x03 \x01(\x03R\x02to\x12\x14\n" +
+	"\x05speed\x18\x04 \x01(\x01R\x05speed2\x9e\x01\n" +
+	"\x10OrderBookService\x12>\n" +
+	"\n" +
+	"StreamLive\x12\x1c.orderbook.StreamLiveRequest\x1a\x10.orderbook.Event0\x01\x12J\n" +
+	"\x10StreamHistorical\x12\".orderbook.StreamHistoricalRequest\x1a\x10.orderbook.Event0\x01B\rZ\v./orderbookb\x06proto3"
+
+var (
+	file_orderbook_service_proto_rawDescOnce sync.Once
+	file_orderbook_service_proto_rawDescData []byte
+)
+
+func file_orderbook_service_proto_rawDescGZIP() []byte {
+	file_orderbook_service_proto_rawDescOnce.Do(func() {
+		file_orderbook_service_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_orderbook_service_proto_rawDesc), len(file_orderbook_service_proto_rawDesc)))
+	})
+	return file_orderbook_service_proto_rawDescData
+}
+
+var file_orderbook_service_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_orderbook_service_proto_goTypes = []any{
+	(*StreamLiveRequest)(nil),       // 0: orderbook.StreamLiveRequest
+	(*StreamHistoricalRequest)(nil), // 1: orderbook.StreamHistoricalRequest
+	(*Event)(nil),                   // 2: orderbook.Event
+}
+var file_orderbook_service_proto_depIdxs = []int32{
+	0, // 0: orderbook.OrderBookService.StreamLive:input_type -> orderbook.StreamLiveRequest
+	1, // 1: orderbook.OrderBookService.StreamHistorical:input_type -> orderbook.StreamHistoricalRequest
+	2, // 2: orderbook.OrderBookService.StreamLive:output_type -> orderbook.Event
+	2, // 3: orderbook.OrderBookService.StreamHistorical:output_type -> orderbook.Event
+	2, // [2:4] is the sub-list for method output_type
+	0, // [0:2] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_orderbook_service_proto_init() }
+func file_orderbook_service_proto_init() {
+	if File_orderbook_service_proto != nil {
+		return
+	}
+	file_orderbook_proto_init()
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_orderbook_service_proto_rawDesc), len(file_orderbook_service_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_orderbook_service_proto_goTypes,
+		DependencyIndexes: file_orderbook_service_proto_depIdxs,
+		MessageInfos:      file_orderbook_service_proto_msgTypes,
+	}.Build()
+	File_orderbook_service_proto = out.File
+	file_orderbook_service_proto_goTypes = nil
+	file_orderbook_service_proto_depIdxs = nil
+}
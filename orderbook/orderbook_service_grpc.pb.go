@@ -0,0 +1,177 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v6.31.1
+// source: orderbook_service.proto
+
+package orderbook
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	OrderBookService_StreamLive_FullMethodName       = "/orderbook.OrderBookService/StreamLive"
+	OrderBookService_StreamHistorical_FullMethodName = "/orderbook.OrderBookService/StreamHistorical"
+)
+
+// OrderBookServiceClient is the client API for OrderBookService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// 다른 서비스가 네트워크로 수집기를 구독하는 gRPC 서비스 (collect -grpc, serve-grpc).
+// 이벤트는 파일에 기록되는 Event 그대로다.
+type OrderBookServiceClient interface {
+	// 수집 중인 이벤트를 받는다. 수집기(collect -grpc)에서만 된다.
+	// 구독자가 따라오지 못해 버퍼가 차면 RESOURCE_EXHAUSTED 로 끊는다 (빠진 이벤트로 책이 틀어지지 않도록).
+	StreamLive(ctx context.Context, in *StreamLiveRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error)
+	// 기록된 구간을 재생한다.
+	StreamHistorical(ctx context.Context, in *StreamHistoricalRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error)
+}
+
+type orderBookServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewOrderBookServiceClient(cc grpc.ClientConnInterface) OrderBookServiceClient {
+	return &orderBookServiceClient{cc}
+}
+
+func (c *orderBookServiceClient) StreamLive(ctx context.Context, in *StreamLiveRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &OrderBookService_ServiceDesc.Streams[0], OrderBookService_StreamLive_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamLiveRequest, Event]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type OrderBookService_StreamLiveClient = grpc.ServerStreamingClient[Event]
+
+func (c *orderBookServiceClient) StreamHistorical(ctx context.Context, in *StreamHistoricalRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &OrderBookService_ServiceDesc.Streams[1], OrderBookService_StreamHistorical_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamHistoricalRequest, Event]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type OrderBookService_StreamHistoricalClient = grpc.ServerStreamingClient[Event]
+
+// OrderBookServiceServer is the server API for OrderBookService service.
+// All implementations must embed UnimplementedOrderBookServiceServer
+// for forward compatibility.
+//
+// 다른 서비스가 네트워크로 수집기를 구독하는 gRPC 서비스 (collect -grpc, serve-grpc).
+// 이벤트는 파일에 기록되는 Event 그대로다.
+type OrderBookServiceServer interface {
+	// 수집 중인 이벤트를 받는다. 수집기(collect -grpc)에서만 된다.
+	// 구독자가 따라오지 못해 버퍼가 차면 RESOURCE_EXHAUSTED 로 끊는다 (빠진 이벤트로 책이 틀어지지 않도록).
+	StreamLive(*StreamLiveRequest, grpc.ServerStreamingServer[Event]) error
+	// 기록된 구간을 재생한다.
+	StreamHistorical(*StreamHistoricalRequest, grpc.ServerStreamingServer[Event]) error
+	mustEmbedUnimplementedOrderBookServiceServer()
+}
+
+// UnimplementedOrderBookServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedOrderBookServiceServer struct{}
+
+func (UnimplementedOrderBookServiceServer) StreamLive(*StreamLiveRequest, grpc.ServerStreamingServer[Event]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamLive not implemented")
+}
+func (UnimplementedOrderBookServiceServer) StreamHistorical(*StreamHistoricalRequest, grpc.ServerStreamingServer[Event]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamHistorical not implemented")
+}
+func (UnimplementedOrderBookServiceServer) mustEmbedUnimplementedOrderBookServiceServer() {}
+func (UnimplementedOrderBookServiceServer) testEmbeddedByValue()                          {}
+
+// UnsafeOrderBookServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to OrderBookServiceServer will
+// result in compilation errors.
+type UnsafeOrderBookServiceServer interface {
+	mustEmbedUnimplementedOrderBookServiceServer()
+}
+
+func RegisterOrderBookServiceServer(s grpc.ServiceRegistrar, srv OrderBookServiceServer) {
+	// If the following call pancis, it indicates UnimplementedOrderBookServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&OrderBookService_ServiceDesc, srv)
+}
+
+func _OrderBookService_StreamLive_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamLiveRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(OrderBookServiceServer).StreamLive(m, &grpc.GenericServerStream[StreamLiveRequest, Event]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type OrderBookService_StreamLiveServer = grpc.ServerStreamingServer[Event]
+
+func _OrderBookService_StreamHistorical_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamHistoricalRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(OrderBookServiceServer).StreamHistorical(m, &grpc.GenericServerStream[StreamHistoricalRequest, Event]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type OrderBookService_StreamHistoricalServer = grpc.ServerStreamingServer[Event]
+
+// OrderBookService_ServiceDesc is the grpc.ServiceDesc for OrderBookService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var OrderBookService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "orderbook.OrderBookService",
+	HandlerType: (*OrderBookServiceServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamLive",
+			Handler:       _OrderBookService_StreamLive_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "StreamHistorical",
+			Handler:       _OrderBookService_StreamHistorical_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "orderbook_service.proto",
+}
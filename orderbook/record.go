@@ -0,0 +1,113 @@
+package orderbook
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Record 로 담긴 레코드 종류별 디코더 등록부. 새 스트림을 다루는 쪽(플러그인, 별도 패키지)이 init 에서 등록한다.
+// 등록되지 않은 종류도 Record 그대로 읽고 쓸 수 있으므로, 디코더가 없는 도구가 기록을 버리지 않는다.
+
+// data 를 해석한 값을 돌려준다. encoding 은 Record.Encoding.
+type RecordDecoder func(encoding string, data []byte) (any, error)
+
+var ErrUnknownRecordType = errors.New("unknown record type")
+
+var (
+	recordMu       sync.RWMutex
+	recordDecoders = map[string]RecordDecoder{}
+)
+
+// 같은 종류를 두 번 등록하면 panic 한다 (database/sql.Register 와 같이).
+func RegisterRecordType(recordType string, decode RecordDecoder) {
+	recordMu.Lock()
+	defer recordMu.Unlock()
+	if _, ok := recordDecoders[recordType]; ok {
+		panic("orderbook: record type " + recordType + " registered twice")
+	}
+	recordDecoders[recordType] = decode
+}
+
+func RecordTypes() []string {
+	recordMu.RLock()
+	defer recordMu.RUnlock()
+	var types []string
+	for t := range recordDecoders {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// 등록된 디코더로 data 를 해석한다. 디코더가 없으면 ErrUnknownRecordType.
+func (r *Record) Decode() (any, error) {
+	recordMu.RLock()
+	decode, ok := recordDecoders[r.GetType()]
+	recordMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownRecordType, r.GetType())
+	}
+	return decode(r.GetEncoding(), r.GetData())
+}
+
+// 이 빌드가 내용을 해석할 수 없는 이벤트인지. payload 가 새 버전의 필드라 unknown field 로만 남았거나,
+// 디코더가 등록되지 않은 Record 면 true. 이런 이벤트도 다시 쓸 때는 그대로 Write 한다.
+func IsOpaque(ev *Event) bool {
+	switch p := ev.Payload.(type) {
+	case nil:
+		return len(ev.ProtoReflect().GetUnknown()) > 0
+	case *Event_Record:
+		recordMu.RLock()
+		defer recordMu.RUnlock()
+		_, ok := recordDecoders[p.Record.GetType()]
+		return !ok
+	}
+	return false
+}
+
+// 로그와 통계에 쓰는 payload 종류 이름. Record 는 그 type, 모르는 payload 는 "unknown".
+func PayloadKind(ev *Event) string {
+	switch p := ev.Payload.(type) {
+	case *Event_Snapshot:
+		return "snapshot"
+	case *Event_DepthDiff:
+		return "depthDiff"
+	case *Event_Trade:
+		return "trade"
+	case *Event_BookTicker:
+		return "bookTicker"
+	case *Event_Tick:
+		return "tick"
+	case *Event_Liquidation:
+		return "liquidation"
+	case *Event_Ticker:
+		return "ticker"
+	case *Event_Record:
+		return p.Record.GetType()
+	case nil:
+		if len(ev.ProtoReflect().GetUnknown()) > 0 {
+			return "unknown"
+		}
+	}
+	return "empty"
+}
+
+// proto 로 인코딩한 Record 용 디코더. 메시지 타입의 빈 값을 넘기면 등록할 디코더를 만든다.
+//
+//	orderbook.RegisterRecordType("acme.fundingRate", orderbook.ProtoRecordDecoder(&acmepb.FundingRate{}))
+func ProtoRecordDecoder(empty proto.Message) RecordDecoder {
+	return func(encoding string, data []byte) (any, error) {
+		if encoding != "proto" {
+			return nil, fmt.Errorf("record encoding %q is not proto", encoding)
+		}
+		m := empty.ProtoReflect().New().Interface()
+		if err := proto.Unmarshal(data, m); err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+}
@@ -0,0 +1,29 @@
+package orderbook
+
+// 수집기가 부여한 순번을 따라가며 유실된 레코드 수를 센다.
+// 같은 세션 안에서는 심볼별로 1 씩 증가해야 하고, 세션이 바뀌면 다시 시작한다.
+type SequenceChecker struct {
+	last map[string]uint64 // 세션/심볼 -> 마지막 순번
+}
+
+func NewSequenceChecker() *SequenceChecker {
+	return &SequenceChecker{last: make(map[string]uint64)}
+}
+
+// e 앞에서 빠진 레코드 수를 돌려준다. 순번이 없는 구버전 레코드는 0.
+func (c *SequenceChecker) Check(h *FileHeader, e *Event) uint64 {
+	if h == nil || e.Sequence == 0 {
+		return 0
+	}
+	key := h.SessionId + "/" + e.Symbol
+	last, ok := c.last[key]
+	c.last[key] = e.Sequence
+	if !ok {
+		// 세션 중간부터 읽기 시작한 경우(다음 날 파일 등)도 있으므로 첫 레코드는 기준으로만 쓴다
+		return 0
+	}
+	if e.Sequence <= last+1 {
+		return 0
+	}
+	return e.Sequence - last - 1
+}
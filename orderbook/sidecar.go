@@ -0,0 +1,133 @@
+package orderbook
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// footer 가 없는 기존 파일(v1, 수집 중 비정상 종료된 v2 등)을 위한 사이드카 인덱스.
+// <파일>.idx 에 IndexMagic [len][FileIndex] 를 쓴다. 데이터 파일은 건드리지 않는다.
+//
+// 데이터 파일은 뒤에만 덧붙으므로 만들어진 뒤 파일이 커져도 인덱스는 앞부분에 대해 여전히 맞다.
+// 파일이 DataSize 보다 작아졌으면 다른 파일로 바뀐 것으로 보고 쓰지 않는다.
+
+func SidecarPath(path string) string {
+	return path + ".idx"
+}
+
+// r 을 끝까지 읽으며 대략 every 개 레코드마다 인덱스 항목을 남긴다.
+// 압축 세션에서는 블록 경계에서만 항목을 남길 수 있다.
+func BuildIndex(r io.Reader, every int) *FileIndex {
+	if every <= 0 {
+		every = 1
+	}
+	rd := NewReader(r)
+	idx := &FileIndex{}
+	var n int
+	lastOffset := int64(-1)
+	for {
+		ev, err := rd.Next()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			continue // 깨진 레코드는 건너뛴다. 다음 프레임부터 다시 읽힌다
+		}
+		off, headerOff := rd.Position()
+		if off != lastOffset && (len(idx.Entries) == 0 || n >= every) {
+			idx.Entries = append(idx.Entries, &IndexEntry{
+				EventTime:    ev.EventTime,
+				Sequence:     ev.Sequence,
+				Offset:       off,
+				HeaderOffset: headerOff,
+			})
+			n = 0
+		}
+		lastOffset = off
+		n++
+	}
+	idx.DataSize = rd.offset()
+	return idx
+}
+
+// 사이드카 인덱스를 임시 파일에 쓰고 바꿔치기한다
+func WriteSidecar(path string, idx *FileIndex) error {
+	tmp := SidecarPath(path) + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(f)
+	bw.Write(IndexMagic)
+	err = writeFrame(bw, idx)
+	if ferr := bw.Flush(); err == nil {
+		err = ferr
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, SidecarPath(path))
+}
+
+// path 의 사이드카 인덱스를 지운다. 없으면 아무 일도 하지 않는다.
+func RemoveSidecar(path string) error {
+	err := os.Remove(SidecarPath(path))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// path 의 사이드카 인덱스를 읽는다. 없으면 nil.
+func ReadSidecar(path string) (*FileIndex, error) {
+	b, err := os.ReadFile(SidecarPath(path))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(b, IndexMagic) {
+		return nil, fmt.Errorf("%s: not an index file", SidecarPath(path))
+	}
+	buf, err := readFrame(bytes.NewReader(b[len(IndexMagic):]))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", SidecarPath(path), err)
+	}
+	var idx FileIndex
+	if err := proto.Unmarshal(buf, &idx); err != nil {
+		return nil, fmt.Errorf("%s: %w", SidecarPath(path), err)
+	}
+	return &idx, nil
+}
+
+// 열린 데이터 파일의 인덱스. footer 가 있으면 그것을, 없으면 사이드카를 쓴다. 둘 다 없으면 nil.
+func LoadIndex(f *os.File) (*FileIndex, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	idx, _, err := ReadIndex(f, fi.Size())
+	if idx != nil || err != nil {
+		return idx, err
+	}
+	idx, err = ReadSidecar(f.Name())
+	if idx == nil || err != nil {
+		return nil, err
+	}
+	if idx.DataSize > fi.Size() {
+		return nil, fmt.Errorf("%s is stale (indexed %d bytes, file has %d)", SidecarPath(f.Name()), idx.DataSize, fi.Size())
+	}
+	return idx, nil
+}
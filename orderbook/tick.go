@@ -0,0 +1,67 @@
+package orderbook
+
+import "strings"
+
+// tick 이벤트의 stream_type
+const TickStreamType = "tick"
+
+// 스냅샷과 bookTicker 에서 최우선 호가가 바뀐 순간만 골라 tick 이벤트로 만든다.
+// 심볼별로 마지막 호가를 기억하므로 심볼이 섞인 스트림에 그대로 쓸 수 있다.
+type TickDeriver struct {
+	last map[string]*Tick
+}
+
+func NewTickDeriver() *TickDeriver {
+	return &TickDeriver{last: make(map[string]*Tick)}
+}
+
+// ev 로 최우선 호가가 바뀌었으면 tick 이벤트를 돌려준다. 바뀌지 않았거나 호가를 알 수 없는 이벤트(증분, 체결)면 nil.
+// 돌려준 이벤트의 Sequence 는 비어 있다. 기록하는 쪽에서 채운다.
+func (d *TickDeriver) Next(ev *Event) *Event {
+	var t *Tick
+	switch p := ev.Payload.(type) {
+	case *Event_Snapshot:
+		t = SnapshotTick(p.Snapshot)
+	case *Event_BookTicker:
+		b := p.BookTicker
+		t = &Tick{
+			BidPrice: b.BidPrice, BidQuantity: b.BidQuantity, AskPrice: b.AskPrice, AskQuantity: b.AskQuantity, UpdateId: b.UpdateId,
+			BidPriceText: b.BidPriceText, BidQuantityText: b.BidQuantityText, AskPriceText: b.AskPriceText, AskQuantityText: b.AskQuantityText,
+		}
+	default:
+		return nil
+	}
+
+	key := strings.ToLower(ev.Symbol)
+	if prev := d.last[key]; prev != nil &&
+		prev.BidPrice == t.BidPrice && prev.BidQuantity == t.BidQuantity &&
+		prev.AskPrice == t.AskPrice && prev.AskQuantity == t.AskQuantity {
+		return nil
+	}
+	d.last[key] = t
+	return &Event{
+		EventTime:     ev.EventTime,
+		Symbol:        ev.Symbol,
+		Exchange:      ev.Exchange,
+		MarketType:    ev.MarketType,
+		StreamType:    TickStreamType,
+		ExchangeTime:  ev.ExchangeTime,
+		ReceiveTimeNs: ev.ReceiveTimeNs,
+		LatencyUs:     ev.LatencyUs,
+		Payload:       &Event_Tick{Tick: t},
+	}
+}
+
+// 스냅샷의 최우선 호가. 한쪽이 비어 있으면 그쪽은 0 이다.
+func SnapshotTick(s *Snapshot) *Tick {
+	t := &Tick{UpdateId: s.LastUpdateId}
+	if len(s.Bids) > 0 {
+		b := s.Bids[0]
+		t.BidPrice, t.BidQuantity, t.BidPriceText, t.BidQuantityText = b.Price, b.Quantity, b.PriceText, b.QuantityText
+	}
+	if len(s.Asks) > 0 {
+		a := s.Asks[0]
+		t.AskPrice, t.AskQuantity, t.AskPriceText, t.AskQuantityText = a.Price, a.Quantity, a.PriceText, a.QuantityText
+	}
+	return t
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"orderbook/orderbook"
+)
+
+// 심볼별 처리 파이프라인. 읽기 루프는 결합 스트림 봉투만 풀고 순번을 매긴 뒤 data 사본을 심볼별 큐로 넘기고,
+// 심볼마다 고루틴 하나가 data 를 파싱해 파일, 캐시, tick, 싱크로 내보낸다. 한 심볼의 쓰기가 느리거나
+// 큰 증분을 파싱하느라 늦어도 다른 심볼의 처리는 밀리지 않는다. 한 심볼 안의 순서는 그대로다.
+//
+// 동시에 파싱/처리하는 심볼 수는 -pipeline-workers 로 제한한다 (기본 GOMAXPROCS).
+// 한 심볼의 큐(-pipeline-queue)가 가득 차면 읽기 루프가 기다린다. 그동안 메시지는 소켓 버퍼에 남는다.
+// -pipeline-queue 0 이면 예전처럼 읽기 루프에서 바로 처리한다.
+//
+// 연결 중에 REST 로 받은 이벤트도 읽기 루프가 순번을 매겨 같은 큐로 넘긴다 (dispatchEvent).
+
+type pipelineOptions struct {
+	Queue   int
+	Workers int
+}
+
+func (o *pipelineOptions) register(fs *flag.FlagSet) {
+	fs.IntVar(&o.Queue, "pipeline-queue", 1000, "messages buffered per symbol between the stream reader and the symbol's parse/persist goroutine; 0 processes every message on the reader")
+	fs.IntVar(&o.Workers, "pipeline-workers", runtime.GOMAXPROCS(0), "at most this many symbols are parsed and persisted at the same time")
+}
+
+func (o *pipelineOptions) parse() error {
+	switch {
+	case o.Queue < 0:
+		return fmt.Errorf("-pipeline-queue must not be negative")
+	case o.Workers <= 0:
+		return fmt.Errorf("-pipeline-workers must be positive")
+	}
+	return nil
+}
+
+// 처리 함수. data 는 돌아온 뒤 다시 쓰이므로 붙잡으면 안 된다 (parseStreamEvent 는 붙잡지 않는다).
+type processFunc func(symbol, stream string, data []byte, received time.Time, sequence uint64)
+
+type pipelineMessage struct {
+	stream   string
+	data     *[]byte // pipelineBufs 에서 빌린 사본
+	received time.Time
+	sequence uint64
+	event    *orderbook.Event // 이미 만든 이벤트. 있으면 파싱하지 않고 handle 로 넘긴다
+}
+
+// 메시지 사본 버퍼. 아주 큰 메시지의 버퍼는 돌려놓지 않는다.
+var pipelineBufs = sync.Pool{New: func() any { return new([]byte) }}
+
+const maxPooledMessage = 1 << 20
+
+// 연결 하나 동안 쓰는 파이프라인. dispatch 는 읽기 루프 한 고루틴에서만 부른다.
+type symbolPipeline struct {
+	opts    pipelineOptions
+	process processFunc
+	handle  func(symbol string, ev *orderbook.Event)
+	sem     chan struct{}
+	queues  map[string]chan pipelineMessage
+	wg      sync.WaitGroup
+}
+
+func newSymbolPipeline(opts pipelineOptions, process processFunc, handle func(symbol string, ev *orderbook.Event)) *symbolPipeline {
+	return &symbolPipeline{
+		opts:    opts,
+		process: process,
+		handle:  handle,
+		sem:     make(chan struct{}, opts.Workers),
+		queues:  make(map[string]chan pipelineMessage),
+	}
+}
+
+// 메시지를 심볼의 큐로 넘긴다. data 는 복사하므로 돌아온 뒤 다시 써도 된다.
+func (p *symbolPipeline) dispatch(symbol, stream string, data []byte, received time.Time, sequence uint64) {
+	if p.opts.Queue == 0 {
+		p.process(symbol, stream, data, received, sequence)
+		return
+	}
+	buf := pipelineBufs.Get().(*[]byte)
+	*buf = append((*buf)[:0], data...)
+	p.queue(symbol) <- pipelineMessage{stream: stream, data: buf, received: received, sequence: sequence}
+}
+
+// 순번까지 매긴 이벤트를 심볼의 큐로 넘긴다
+func (p *symbolPipeline) dispatchEvent(symbol string, ev *orderbook.Event) {
+	if p.opts.Queue == 0 {
+		p.handle(symbol, ev)
+		return
+	}
+	p.queue(symbol) <- pipelineMessage{event: ev}
+}
+
+func (p *symbolPipeline) queue(symbol string) chan pipelineMessage {
+	q, ok := p.queues[symbol]
+	if !ok {
+		q = make(chan pipelineMessage, p.opts.Queue)
+		p.queues[symbol] = q
+		p.wg.Add(1)
+		go p.run(symbol, q)
+	}
+	return q
+}
+
+func (p *symbolPipeline) run(symbol string, q chan pipelineMessage) {
+	defer p.wg.Done()
+	for m := range q {
+		p.sem <- struct{}{}
+		if m.event != nil {
+			p.handle(symbol, m.event)
+			<-p.sem
+			continue
+		}
+		p.process(symbol, m.stream, *m.data, m.received, m.sequence)
+		<-p.sem
+		if cap(*m.data) <= maxPooledMessage {
+			pipelineBufs.Put(m.data)
+		}
+	}
+}
+
+// 큐에 남은 메시지를 모두 처리하고 심볼 고루틴을 끝낸다
+func (p *symbolPipeline) close() {
+	for _, q := range p.queues {
+		close(q)
+	}
+	p.wg.Wait()
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// 긴 구간의 export 를 워커 여러 대에 나눠 돌리기 위한 샤드 계획.
+// 샤드 경계는 unix epoch 기준 shard 크기의 배수로 정렬되므로, 요청 구간이 조금 달라도
+// 겹치는 샤드의 ID 와 경계는 항상 같다. 스케줄러는 manifest 의 shards 를 워커 하나당 하나씩 나눠주면 된다.
+// -tz 를 주면 격자를 그 시간대의 자정에 맞추고 ID 와 time 표시도 그 시간대로 쓴다 (-tz kst -shard 1d 는 KST 하루씩).
+// 서머타임이 있는 시간대는 요청 구간 시작 시점의 오프셋으로 정렬한다.
+
+const manifestVersion = 1
+
+type exportManifest struct {
+	Version   int           `json:"version"`
+	DataDir   string        `json:"dataDir"`
+	From      int64         `json:"from"` // 요청 구간 (UTC ms, [from, to))
+	To        int64         `json:"to"`
+	ShardSize string        `json:"shardSize"`
+	Shards    []exportShard `json:"shards"`
+}
+
+type exportShard struct {
+	ID     string `json:"id"`
+	Symbol string `json:"symbol"`
+	// 샤드 구간 (UTC ms, [from, to)). 요청 구간으로 잘리지 않은 격자 단위 그대로다.
+	From   int64      `json:"from"`
+	To     int64      `json:"to"`
+	Inputs []string   `json:"inputs"`
+	Bytes  int64      `json:"estimatedBytes"` // 입력 파일 크기를 샤드 길이에 비례해 나눈 추정치
+	Output string     `json:"output"`
+	Time   shardTimes `json:"time"`
+}
+
+// 사람이 읽기 위한 구간 표시
+type shardTimes struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+func runPlan(args []string) error {
+	fs := flag.NewFlagSet("plan", flag.ExitOnError)
+	symbolList := fs.String("symbols", strings.Join(symbols, ","), "comma-separated symbols")
+	var rng rangeFlags
+	rng.register(fs)
+	shardSize := fs.String("shard", "24h", "shard length (e.g. 1h, 6h, 1d); must divide a day or be whole days")
+	dataDir := fs.String("data", defaultDataDir, "data directory")
+	outputTmpl := fs.String("output-template", "export/{symbol}/{shard}", "per-shard output path; {symbol} and {shard} are substituted")
+	skipEmpty := fs.Bool("skip-empty", true, "omit shards with no input files")
+	out := fs.String("o", "", "write the manifest to this file instead of stdout")
+	fs.Parse(args)
+
+	fromMs, toMs, err := rng.resolve()
+	if err != nil {
+		return err
+	}
+	size, err := parseDuration(*shardSize)
+	if err != nil {
+		return err
+	}
+	if size <= 0 || (size < 24*time.Hour && (24*time.Hour)%size != 0) || (size >= 24*time.Hour && size%(24*time.Hour) != 0) {
+		return fmt.Errorf("shard length %s must divide a day or be a whole number of days", size)
+	}
+
+	m := planShards(*dataDir, splitList(strings.ToLower(*symbolList)), fromMs, toMs, size, *outputTmpl, *skipEmpty)
+	m.ShardSize = compactDuration(size)
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if *out == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(*out, data, 0644)
+}
+
+func planShards(dataDir string, symbols []string, from, to int64, size time.Duration, outputTmpl string, skipEmpty bool) *exportManifest {
+	m := &exportManifest{Version: manifestVersion, DataDir: dataDir, From: from, To: to, Shards: []exportShard{}}
+	step := size.Milliseconds()
+	_, offset := time.UnixMilli(from).In(displayLoc).Zone()
+	offsetMs := int64(offset) * 1000
+	for _, symbol := range symbols {
+		for start := from - mod(from+offsetMs, step); start < to; start += step {
+			end := start + step
+			shard := exportShard{
+				ID:     fmt.Sprintf("%s-%s-%s", symbol, time.UnixMilli(start).In(displayLoc).Format("20060102T150405Z0700"), compactDuration(size)),
+				Symbol: symbol,
+				From:   start,
+				To:     end,
+				Inputs: []string{},
+				Time: shardTimes{
+					From: time.UnixMilli(start).In(displayLoc).Format(time.RFC3339),
+					To:   time.UnixMilli(end).In(displayLoc).Format(time.RFC3339),
+				},
+			}
+			for _, f := range dataFilesInRange(dataDir, symbol, start, end) {
+				shard.Inputs = append(shard.Inputs, f.path)
+				// 하루치 파일 중 이 샤드가 차지하는 비율만큼
+				shard.Bytes += int64(float64(f.size) * float64(min(step, dayMillis)) / float64(dayMillis))
+			}
+			if skipEmpty && len(shard.Inputs) == 0 {
+				continue
+			}
+			shard.Output = strings.NewReplacer("{symbol}", symbol, "{shard}", shard.ID).Replace(outputTmpl)
+			m.Shards = append(m.Shards, shard)
+		}
+	}
+	return m
+}
+
+// 샤드 ID 용 짧은 표기 (6h0m0s -> 6h, 48h -> 2d)
+func compactDuration(d time.Duration) string {
+	switch {
+	case d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	default:
+		return fmt.Sprintf("%ds", d/time.Second)
+	}
+}
+
+// 음수에서도 0 이상을 돌려주는 나머지
+func mod(a, b int64) int64 {
+	r := a % b
+	if r < 0 {
+		r += b
+	}
+	return r
+}
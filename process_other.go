@@ -0,0 +1,15 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// 유닉스가 아닌 플랫폼에서는 프로세스를 열 수 있으면 있는 것으로 본다
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
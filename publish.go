@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"orderbook/orderbook"
+)
+
+// 기록된 파일을 읽어 싱크로 다시 내보낸다. 새로 붙는 소비자에게 과거 데이터를 채워 줄 때 쓴다.
+// 원래 수신 시각은 메시지 헤더(event-time 등)로 전달되고, -speed 로 원래 간격을 재현할 수 있다.
+
+func runPublish(args []string) error {
+	fs := flag.NewFlagSet("publish", flag.ExitOnError)
+	sinkSpec := fs.String("sink", "", "sink URL ("+strings.Join(sinkSchemes(), ", ")+")")
+	symbol := fs.String("symbol", "", "symbol to replay")
+	var rng rangeFlags
+	rng.register(fs)
+	speed := fs.Float64("speed", 0, "pacing relative to the original timing (1 = real time, 10 = 10x); 0 publishes as fast as possible")
+	dataDir := fs.String("data", defaultDataDir, "data directory")
+	var jobOpts jobOptions
+	jobOpts.register(fs, "")
+	fs.Parse(args)
+
+	if *sinkSpec == "" || *symbol == "" {
+		return fmt.Errorf("-sink and -symbol are required")
+	}
+	fromMs, toMs, err := rng.resolve()
+	if err != nil {
+		return err
+	}
+
+	files := dataFilesInRange(*dataDir, *symbol, fromMs, toMs)
+	if len(files) == 0 {
+		return fmt.Errorf("no data for %s in %s", *symbol, rng.String())
+	}
+	var units []jobUnit
+	for _, f := range files {
+		units = append(units, jobUnit{name: f.path, size: f.size})
+	}
+
+	key := fmt.Sprintf("%s %s %d-%d", sinkName(*sinkSpec), *symbol, fromMs, toMs)
+	cp, err := openCheckpoint(jobOpts.checkpoint, "publish", key, jobOpts.resume)
+	if err != nil {
+		return err
+	}
+
+	replaying = true
+	sink, err := openSink(*sinkSpec)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	pacer := newPacer(*speed)
+	var published int
+	err = runJob(ctx, jobOpts, cp, units, func(ctx context.Context, u jobUnit, p *Progress) error {
+		return scanFile(ctx, u.name, fromMs, toMs, p, func(r *orderbook.Reader, ev *orderbook.Event) error {
+			if err := pacer.wait(ctx, ev.EventTime); err != nil {
+				return err
+			}
+			if err := sink.Publish(ev); err != nil {
+				return err
+			}
+			published++
+			return nil
+		})
+	})
+	if cerr := sink.Close(); err == nil {
+		err = cerr
+	}
+	log.Printf("Published %d events to %s", published, sinkName(*sinkSpec))
+	return err
+}
+
+// 원래 수신 간격을 speed 배로 재현한다. speed <= 0 이면 기다리지 않는다.
+type pacer struct {
+	speed     float64
+	start     time.Time
+	firstTime int64
+}
+
+func newPacer(speed float64) *pacer {
+	return &pacer{speed: speed}
+}
+
+func (p *pacer) wait(ctx context.Context, eventTime int64) error {
+	if p.speed <= 0 {
+		return nil
+	}
+	if p.start.IsZero() {
+		p.start, p.firstTime = time.Now(), eventTime
+		return nil
+	}
+	due := p.start.Add(time.Duration(float64(eventTime-p.firstTime)/p.speed) * time.Millisecond)
+	d := time.Until(due)
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
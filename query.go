@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"orderbook/orderbook"
+)
+
+// 저장된 데이터에 대한 구간 질의. REST/gRPC API 가 같은 코드로 페이지를 나누거나 스트리밍한다.
+// 몇 시간치 100ms 스냅샷을 한 번에 메모리에 올리지 않도록, 결과는 fn 으로 하나씩 넘기고
+// Limit 에 도달하면 다음 페이지를 시작할 커서를 돌려준다.
+
+// 다음 페이지의 시작 위치. 같은 밀리초에 이벤트가 여럿일 수 있으므로 그 시각에서 이미 돌려준 개수를 함께 둔다.
+type queryCursor struct {
+	Time int64
+	Skip int
+}
+
+func (c *queryCursor) String() string {
+	return base64.RawURLEncoding.EncodeToString(fmt.Appendf(nil, "%d.%d", c.Time, c.Skip))
+}
+
+func parseCursor(s string) (*queryCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	t, skip, ok := strings.Cut(string(b), ".")
+	if !ok {
+		return nil, errors.New("invalid cursor")
+	}
+	c := &queryCursor{}
+	if c.Time, err = strconv.ParseInt(t, 10, 64); err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	if c.Skip, err = strconv.Atoi(skip); err != nil || c.Skip < 0 {
+		return nil, errors.New("invalid cursor")
+	}
+	return c, nil
+}
+
+// 구간에 걸치는 데이터 파일을 읽는 순서대로 찾는다. 로컬 디렉터리(localFiles) 또는 여러 저장소(federation.files).
+type fileLister func(ctx context.Context, symbol string, from, to int64) ([]dataFile, error)
+
+func localFiles(dataDir string) fileLister {
+	return func(ctx context.Context, symbol string, from, to int64) ([]dataFile, error) {
+		return dataFilesInRange(dataDir, symbol, from, to), nil
+	}
+}
+
+type rangeQuery struct {
+	DataDir string
+	Files   fileLister // nil 이면 DataDir 에서 찾는다
+	Symbol  string
+	From    int64 // [From, To) 수신 시각 (UTC ms)
+	To      int64
+	Cursor  *queryCursor // 이전 페이지가 돌려준 커서. nil 이면 From 부터
+	Limit   int          // 0 이면 제한 없음
+}
+
+var errPageFull = errors.New("page full")
+
+// 구간의 이벤트를 순서대로 fn 에 넘긴다. Limit 때문에 멈췄으면 다음 페이지 커서를, 끝까지 읽었으면 nil 을 돌려준다.
+func (q *rangeQuery) run(ctx context.Context, fn func(ev *orderbook.Event) error) (*queryCursor, error) {
+	from, skip := q.From, 0
+	if c := q.Cursor; c != nil && c.Time >= q.From {
+		from, skip = c.Time, c.Skip
+	}
+
+	var (
+		next   *queryCursor
+		n      int
+		last   int64 = -1
+		atLast int   // last 시각에서 지금까지 지나온 이벤트 수
+	)
+	lister := q.Files
+	if lister == nil {
+		lister = localFiles(q.DataDir)
+	}
+	files, err := lister(ctx, q.Symbol, from, q.To)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		err := scanFile(ctx, f.path, from, q.To, nil, func(r *orderbook.Reader, ev *orderbook.Event) error {
+			if ev.EventTime != last {
+				last, atLast = ev.EventTime, 0
+			}
+			atLast++
+			if skip > 0 && ev.EventTime == from {
+				skip--
+				return nil
+			}
+			if q.Limit > 0 && n == q.Limit {
+				next = &queryCursor{Time: ev.EventTime, Skip: atLast - 1}
+				return errPageFull
+			}
+			n++
+			return fn(ev)
+		})
+		if errors.Is(err, errPageFull) {
+			return next, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+var errNoSnapshot = errors.New("no snapshot at or before the requested time")
+
+// 어떤 시각의 재구성된 책
+type bookAt struct {
+	Book         *orderbook.Book
+	Header       *orderbook.FileHeader // 시작한 스냅샷이 있던 세션
+	SnapshotTime int64                 // 시작한 스냅샷의 수신 시각 (UTC ms)
+	UpdateTime   int64                 // 마지막으로 반영한 스냅샷이나 증분의 수신 시각
+	Diffs        int                   // 스냅샷 뒤에 적용한 증분 수
+	Gap          bool                  // 증분 순번이 끊겨 그 뒤의 증분은 반영하지 못했다
+}
+
+// at 이하의 마지막 스냅샷에서 시작해 at 까지 기록된 증분(depth@...)을 적용한다.
+// 스냅샷은 at 이 속한 파일과 하루 전 파일까지 찾는다. 증분을 기록하지 않았으면 스냅샷 그대로다.
+func reconstructBook(ctx context.Context, dataDir, symbol string, at int64) (*bookAt, error) {
+	return reconstructBookFrom(ctx, localFiles(dataDir), symbol, at)
+}
+
+func reconstructBookFrom(ctx context.Context, lister fileLister, symbol string, at int64) (*bookAt, error) {
+	files, err := lister(ctx, symbol, at-dayMillis, at+1)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		snap   *orderbook.Snapshot
+		header *orderbook.FileHeader
+	)
+	for i := len(files) - 1; i >= 0 && snap == nil; i-- {
+		if snap, header, err = findSnapshot(files[i].path, at, false); err != nil {
+			return nil, err
+		}
+	}
+	if snap == nil {
+		return nil, errNoSnapshot
+	}
+
+	res := &bookAt{Book: orderbook.NewBook(), Header: header, SnapshotTime: snap.EventTime, UpdateTime: snap.EventTime}
+	res.Book.LoadSnapshot(snap)
+	files, err = lister(ctx, symbol, snap.EventTime, at+1)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		err := scanFile(ctx, f.path, snap.EventTime, at+1, nil, func(r *orderbook.Reader, ev *orderbook.Event) error {
+			d := ev.GetDepthDiff()
+			if d == nil || res.Gap {
+				return nil
+			}
+			applied, err := res.Book.ApplyDiff(d)
+			if err != nil {
+				res.Gap = true
+				return nil
+			}
+			if applied {
+				res.Diffs++
+				res.UpdateTime = ev.EventTime
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
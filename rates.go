@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 스트림별 수신 메시지 수와 바이트 수. 심볼을 늘리기 전에 네트워크와 저장 공간을 어림하는 데 쓴다.
+// 바이트는 웹소켓 메시지(결합 스트림 봉투 포함 JSON) 크기다. 저장되는 크기는 이보다 작으며
+// 실제 비율은 orderbook stats 의 압축률로 본다.
+//
+// 1분 구간마다 전체 초당 메시지 수, 초당 바이트, 하루 환산량과 바이트가 가장 많은 스트림을 로그로 남기고,
+// expvar "stream_rates" 에 스트림별 누계와 직전 구간의 초당 값을 둔다.
+
+const rateWindow = time.Minute
+
+type streamRate struct {
+	Messages       uint64  `json:"messages"` // 시작 후 누계
+	Bytes          uint64  `json:"bytes"`
+	MessagesPerSec float64 `json:"messagesPerSec"` // 직전 구간
+	BytesPerSec    float64 `json:"bytesPerSec"`
+	LastAt         int64   `json:"lastAt"` // 마지막 메시지를 받은 시각 (UTC ms)
+
+	windowMessages, windowBytes uint64
+}
+
+type streamRates struct {
+	mu          sync.Mutex
+	streams     map[string]*streamRate
+	windowStart time.Time
+}
+
+var collectRates = &streamRates{streams: make(map[string]*streamRate)}
+
+// 수신한 메시지 하나를 센다
+func (r *streamRates) observe(stream string, size int, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.windowStart.IsZero() {
+		r.windowStart = now
+	}
+	s, ok := r.streams[stream]
+	if !ok {
+		s = &streamRate{}
+		r.streams[stream] = s
+	}
+	s.Messages++
+	s.Bytes += uint64(size)
+	s.LastAt = now.UnixMilli()
+	s.windowMessages++
+	s.windowBytes += uint64(size)
+	if elapsed := now.Sub(r.windowStart); elapsed >= rateWindow {
+		r.roll(elapsed)
+		r.windowStart = now
+	}
+}
+
+// 구간을 닫고 요약을 로그로 남긴다. r.mu 를 잡은 상태에서 호출해야 한다.
+func (r *streamRates) roll(elapsed time.Duration) {
+	secs := elapsed.Seconds()
+	var msgs, bytes float64
+	names := make([]string, 0, len(r.streams))
+	for name, s := range r.streams {
+		s.MessagesPerSec = float64(s.windowMessages) / secs
+		s.BytesPerSec = float64(s.windowBytes) / secs
+		s.windowMessages, s.windowBytes = 0, 0
+		msgs += s.MessagesPerSec
+		bytes += s.BytesPerSec
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return r.streams[names[i]].BytesPerSec > r.streams[names[j]].BytesPerSec })
+	var top []string
+	for _, name := range names[:min(len(names), 5)] {
+		top = append(top, fmt.Sprintf("%s %s/s", name, formatBytes(int64(r.streams[name].BytesPerSec))))
+	}
+	log.Printf("Stream rates over last %s: %d stream(s), %.1f msg/s, %s/s (%s/day); top: %s",
+		elapsed.Round(time.Second), len(names), msgs, formatBytes(int64(bytes)), formatBytes(int64(bytes*86400)), strings.Join(top, ", "))
+}
+
+type streamRatesStatus struct {
+	Streams map[string]streamRate `json:"streams"`
+	Symbols map[string]streamRate `json:"symbols"` // 심볼별 합
+	Total   streamRate            `json:"total"`
+	// 직전 구간의 속도로 하루 동안 받을 양
+	BytesPerDay    float64 `json:"bytesPerDay"`
+	MessagesPerDay float64 `json:"messagesPerDay"`
+}
+
+func (r *streamRates) status() streamRatesStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	st := streamRatesStatus{Streams: make(map[string]streamRate), Symbols: make(map[string]streamRate)}
+	for name, s := range r.streams {
+		st.Streams[name] = *s
+		symbol, _, _ := strings.Cut(name, "@")
+		st.Symbols[symbol] = addRate(st.Symbols[symbol], s)
+		st.Total = addRate(st.Total, s)
+	}
+	st.BytesPerDay = st.Total.BytesPerSec * 86400
+	st.MessagesPerDay = st.Total.MessagesPerSec * 86400
+	return st
+}
+
+func addRate(a streamRate, b *streamRate) streamRate {
+	return streamRate{
+		Messages:       a.Messages + b.Messages,
+		Bytes:          a.Bytes + b.Bytes,
+		MessagesPerSec: a.MessagesPerSec + b.MessagesPerSec,
+		BytesPerSec:    a.BytesPerSec + b.BytesPerSec,
+		LastAt:         max(a.LastAt, b.LastAt),
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// collect -raw-dir : 웹소켓으로 받은 메시지를 파싱 전 그대로 함께 남긴다. 나중에 파서 버그를 찾으면
+// reprocess 로 원본에서 데이터 파일을 다시 만들 수 있다 (reprocess.go).
+//
+// 파일은 <raw-dir>/<YYYY-MM-DD>/raw_<시작 시각>.zst 이고 UTC 한 시간마다, 수집기가 시작할 때마다 새로 연다.
+// 전체가 zstd 스트림 하나이며 풀면 레코드가 이어진다.
+//
+//	[uvarint 길이][수신 시각 UTC ns, 8바이트 little-endian][메시지 그대로]
+//
+// 첫 레코드는 수신 시각이 0 이고 메시지 자리에 rawHeader JSON 이 들어 있다. 매초 내려쓰므로 비정상 종료하면
+// 마지막 1초 정도와 끝이 잘린 레코드만 잃는다. SUBSCRIBE 응답도 받은 그대로 남는다.
+
+const rawFlushInterval = time.Second
+
+// raw 파일의 첫 레코드. reprocess 가 이 값으로 수집할 때의 설정을 되살린다.
+type rawHeader struct {
+	Exchange   string   `json:"exchange"`
+	MarketType string   `json:"marketType"`
+	Streams    []string `json:"streams"`
+	Session    string   `json:"session"`
+	KeepText   bool     `json:"keepDecimals,omitempty"`
+}
+
+type rawRecorder struct {
+	dir     string
+	session string
+
+	mu     sync.Mutex
+	file   *os.File
+	enc    *zstd.Encoder
+	period string // 지금 파일의 UTC 시간 (2006-01-02T15)
+	prefix []byte
+}
+
+func newRawRecorder(dir, session string) *rawRecorder {
+	return &rawRecorder{dir: dir, session: session}
+}
+
+// 읽기 루프에서 메시지마다 부른다. 압축은 인코더의 고루틴이 하므로 복사만 한다.
+// 쓰지 못하면 파일을 닫고 다음 메시지에서 새 파일을 연다.
+func (r *rawRecorder) record(frame []byte, received time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if period := received.UTC().Format("2006-01-02T15"); r.enc == nil || period != r.period {
+		r.closeLocked()
+		if err := r.openLocked(received); err != nil {
+			log.Printf("Error opening raw capture file: %v", err)
+			return
+		}
+		r.period = period
+	}
+	if err := r.writeLocked(frame, received.UnixNano()); err != nil {
+		log.Printf("Error writing raw capture %s: %v", r.file.Name(), err)
+		r.closeLocked()
+	}
+}
+
+func (r *rawRecorder) writeLocked(frame []byte, receivedNs int64) error {
+	r.prefix = binary.AppendUvarint(r.prefix[:0], uint64(8+len(frame)))
+	r.prefix = binary.LittleEndian.AppendUint64(r.prefix, uint64(receivedNs))
+	if _, err := r.enc.Write(r.prefix); err != nil {
+		return err
+	}
+	_, err := r.enc.Write(frame)
+	return err
+}
+
+func (r *rawRecorder) openLocked(at time.Time) error {
+	at = at.UTC()
+	name := filepath.Join(r.dir, at.Format("2006-01-02"), "raw_"+at.Format("20060102T150405.000Z")+".zst")
+	if err := os.MkdirAll(filepath.Dir(name), os.ModePerm); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	enc, err := zstd.NewWriter(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	header, _ := json.Marshal(rawHeader{
+		Exchange:   exchangeName,
+		MarketType: marketType,
+		Streams:    streamTypes,
+		Session:    r.session,
+		KeepText:   keepDecimalText,
+	})
+	r.file, r.enc = f, enc
+	if err := r.writeLocked(header, 0); err != nil {
+		r.closeLocked()
+		return err
+	}
+	log.Printf("Opened raw capture file %s", name)
+	return nil
+}
+
+func (r *rawRecorder) closeLocked() {
+	if r.enc == nil {
+		return
+	}
+	err := r.enc.Close()
+	if cerr := r.file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		log.Printf("Error closing raw capture %s: %v", r.file.Name(), err)
+	}
+	r.file, r.enc = nil, nil
+}
+
+// rawFlushInterval 마다 압축된 블록을 파일로 내려쓴다
+func (r *rawRecorder) run() {
+	t := time.NewTicker(rawFlushInterval)
+	defer t.Stop()
+	for range t.C {
+		r.mu.Lock()
+		if r.enc != nil {
+			if err := r.enc.Flush(); err != nil {
+				log.Printf("Error flushing raw capture %s: %v", r.file.Name(), err)
+				r.closeLocked()
+			}
+		}
+		r.mu.Unlock()
+	}
+}
+
+func (r *rawRecorder) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closeLocked()
+}
+
+// raw 파일의 레코드를 차례로 fn 에 넘긴다. frame 은 fn 이 돌아온 뒤 다시 쓰인다.
+// 비정상 종료로 끝이 잘린 파일은 온전한 레코드까지만 읽고 truncated 를 true 로 돌려준다.
+func readRawFile(path string, fn func(h *rawHeader, received time.Time, frame []byte) error) (truncated bool, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	dec, err := zstd.NewReader(f)
+	if err != nil {
+		return false, err
+	}
+	defer dec.Close()
+	br := bufio.NewReaderSize(dec, 1<<16)
+
+	var (
+		header rawHeader
+		buf    []byte
+	)
+	for n := 0; ; n++ {
+		size, err := binary.ReadUvarint(br)
+		if err == io.EOF {
+			return false, nil
+		}
+		if err == nil && size < 8 {
+			err = fmt.Errorf("invalid record length %d", size)
+		}
+		if err == nil {
+			if uint64(cap(buf)) < size {
+				buf = make([]byte, size)
+			}
+			buf = buf[:size]
+			_, err = io.ReadFull(br, buf)
+		}
+		if err != nil {
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return true, nil
+			}
+			return false, fmt.Errorf("%s: record %d: %w", path, n, err)
+		}
+		receivedNs, frame := int64(binary.LittleEndian.Uint64(buf)), buf[8:]
+		if n == 0 {
+			if receivedNs != 0 || json.Unmarshal(frame, &header) != nil {
+				return false, fmt.Errorf("%s: not a raw capture file", path)
+			}
+			continue
+		}
+		if err := fn(&header, time.Unix(0, receivedNs), frame); err != nil {
+			return false, err
+		}
+	}
+}
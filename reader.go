@@ -2,15 +2,19 @@
 package main
 
 import (
-	"encoding/binary"
+	"bufio"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"sort"
-	"strings"
+	"strconv"
 	"time"
 
+	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
 	"orderbook/orderbook" // protoc로 생성한 패키지
 )
@@ -20,84 +24,290 @@ type OrderBook struct {
 	Asks map[float64]float64
 }
 
-func main() {
-	symbol := "ETHUSDT"
-	targetTime := time.Date(2026, 4, 13, 15, 13, 6, 0, time.UTC).UnixMilli()
+func runRead(args []string) error {
+	fs := flag.NewFlagSet("read", flag.ExitOnError)
+	symbol := fs.String("symbol", "ETHUSDT", "symbol to look up")
+	at := fs.String("at", "2026-04-13T15:13:06Z", "target time (RFC3339, unix ms or now)")
+	depth := fs.Int("depth", 20, "number of levels to print per side")
+	noProgress := fs.Bool("no-progress", false, "disable the progress bar")
+	format := fs.String("format", "text", "text prints the book at -at; csv or jsonl dump every snapshot in -from/-to (or -day) to stdout")
+	top := fs.Bool("top", false, "with csv/jsonl, only dump the best bid/ask of each snapshot")
+	follow := fs.Bool("follow", false, "with csv/jsonl, keep streaming snapshots as the collector appends them (from -from, default the start of today)")
+	dataDir := fs.String("data", defaultDataDir, "data directory (e.g. a -downsample-dir archive)")
+	lookback := fs.String("lookback", "1d", "how far before -at to look for the last snapshot (crosses into earlier days' files)")
+	var rng rangeFlags
+	rng.register(fs)
+	fs.Parse(args)
 
-	dateStr := time.UnixMilli(targetTime).UTC().Format("2006-01-02")
-	fileName := fmt.Sprintf("data/%s/%s_%s.bin", strings.ToLower(symbol), strings.ToLower(symbol), dateStr)
+	switch *format {
+	case "text":
+	case "csv", "jsonl":
+		return dumpSnapshots(os.Stdout, *dataDir, *symbol, rng, *format, *depth, *top, *follow, !*noProgress)
+	default:
+		return fmt.Errorf("unknown format %q (use text, csv or jsonl)", *format)
+	}
+
+	targetTime, err := parseTime(*at)
+	if err != nil {
+		return err
+	}
+
+	window, err := parseDuration(*lookback)
+	if err != nil || window < 0 {
+		return fmt.Errorf("invalid -lookback %q", *lookback)
+	}
+	// 자정 직후라면 마지막 스냅샷은 전날 파일에 있다
+	files := dataFilesInRange(*dataDir, *symbol, targetTime-window.Milliseconds(), targetTime+1)
+	if len(files) == 0 {
+		return fmt.Errorf("no data file for %s within %s before %s", *symbol, *lookback, formatMillis(targetTime))
+	}
+
+	log.Printf("Attempting to find order book for %s at %s in %d file(s) starting with %s", *symbol, formatMillis(targetTime), len(files), files[0].path)
+
+	// 회전된 파일이 여럿이면 뒤에서부터 본다. target 이전 스냅샷이 있는 가장 늦은 파일에 답이 있다.
+	var (
+		closestSnapshot *orderbook.Snapshot
+		header          *orderbook.FileHeader
+	)
+	for i := len(files) - 1; i >= 0 && closestSnapshot == nil; i-- {
+		closestSnapshot, header, err = findSnapshot(files[i].path, targetTime, !*noProgress)
+		if err != nil {
+			return err
+		}
+	}
+
+	if closestSnapshot == nil {
+		return fmt.Errorf("no snapshot found within %s before the target time; try a longer -lookback or check if the files have data", *lookback)
+	}
+
+	log.Printf("Found closest snapshot with EventTime: %s (diff: %dms)", formatMillis(closestSnapshot.EventTime), targetTime-closestSnapshot.EventTime)
+	if h := header; h != nil {
+		log.Printf("Source: %s %s %s", h.Exchange, h.MarketType, h.Symbol)
+	}
+
+	// 가격은 호가 단위 자릿수로 맞춘 값을 키로 쓴다
+	prec := symbolPrecision(header, loadSymbolMetadata(*dataDir), *symbol)
+	book := &OrderBook{
+		Bids: make(map[float64]float64),
+		Asks: make(map[float64]float64),
+	}
+	for _, l := range closestSnapshot.Bids {
+		book.Bids[roundDecimals(l.Price, prec.Price)] = l.Quantity
+	}
+	for _, l := range closestSnapshot.Asks {
+		book.Asks[roundDecimals(l.Price, prec.Price)] = l.Quantity
+	}
 
-	log.Printf("Attempting to find order book for %s at %d from file %s", symbol, targetTime, fileName)
+	fmt.Printf("\n--- Order Book for %s at %s ---\n", *symbol, formatMillis(targetTime))
+	printBook(book, *depth, prec)
+	return nil
+}
 
+// 파일에서 target 이하인 마지막 스냅샷과 그 세션 헤더를 찾는다. 없으면 nil.
+// 블록 인덱스(footer, 또는 수집 중인 파일의 사이드카)가 있으면 target 블록부터 거꾸로 찾고 (orderbook.FindLast),
+// 없으면 처음부터 읽는다.
+func findSnapshot(fileName string, targetTime int64, showProgress bool) (*orderbook.Snapshot, *orderbook.FileHeader, error) {
 	file, err := os.Open(fileName)
 	if err != nil {
-		log.Fatalf("Failed to open file %s: %v", fileName, err)
+		return nil, nil, fmt.Errorf("failed to open file %s: %w", fileName, err)
 	}
 	defer file.Close()
 
-	var closestSnapshot *orderbook.Snapshot
+	idx, err := orderbook.LoadIndex(file)
+	if err != nil {
+		log.Printf("Ignoring unreadable block index: %v", err)
+	}
+	if idx != nil {
+		ev, header, err := orderbook.FindLast(file, idx, targetTime, func(ev *orderbook.Event) bool {
+			s := ev.GetSnapshot()
+			return s != nil && s.EventTime <= targetTime
+		})
+		if err != nil || ev == nil {
+			return nil, nil, err
+		}
+		return ev.GetSnapshot(), header, nil
+	}
+
+	var size int64
+	if fi, err := file.Stat(); err == nil {
+		size = fi.Size()
+	}
+	progress := NewProgress("scan", size, showProgress)
+	r := orderbook.NewReader(progress.Reader(file))
+
+	var (
+		closestSnapshot *orderbook.Snapshot
+		header          *orderbook.FileHeader
+	)
+	seqCheck := orderbook.NewSequenceChecker()
+	var dropped uint64
 
 	for {
-		snapshot, err := readNextSnapshot(file)
-		if err == io.EOF {
+		ev, err := r.Next()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
 			break
 		}
 		if err != nil {
 			log.Printf("Error reading snapshot, skipping: %v", err)
 			continue
 		}
+		dropped += seqCheck.Check(r.Header, ev)
+		// 스냅샷 외의 이벤트(증분, 체결 등)는 건너뛴다
+		snapshot := ev.GetSnapshot()
+		if snapshot == nil {
+			continue
+		}
 
 		if snapshot.EventTime > targetTime {
 			break
 		}
 
-		closestSnapshot = snapshot
+		closestSnapshot, header = snapshot, r.Header
 	}
 
-	if closestSnapshot == nil {
-		log.Fatal("No snapshot found before the target time. Try an earlier time or check if the file has data.")
+	progress.Finish()
+	if dropped > 0 {
+		log.Printf("Warning: %d record(s) missing from the collector sequence in the scanned range of %s", dropped, fileName)
 	}
+	return closestSnapshot, header, nil
+}
 
-	log.Printf("Found closest snapshot with EventTime: %d (diff: %dms)", closestSnapshot.EventTime, targetTime-closestSnapshot.EventTime)
-
-	book := &OrderBook{
-		Bids: make(map[float64]float64),
-		Asks: make(map[float64]float64),
-	}
-	for _, l := range closestSnapshot.Bids {
-		book.Bids[l.Price] = l.Quantity
+// 구간 안의 스냅샷을 CSV 나 JSON lines 로 w 에 쓴다. Go 없이 바로 쓸 수 있는 형태다.
+// follow 면 구간 끝 없이 수집 중인 파일을 따라가며 줄마다 내보낸다 (tail.go). Ctrl-C 로 멈춘다.
+//
+//	csv         event_time,sequence,side,depth,price,quantity (호가 단계마다 한 줄, 한쪽에 depth 개까지)
+//	csv -top    event_time,sequence,bid_price,bid_quantity,ask_price,ask_quantity,last_update_id
+//	jsonl       질의 API 와 같은 이벤트 JSON (호가는 depth 개까지)
+//	jsonl -top  tick 이벤트 JSON
+//
+// CSV 의 가격/수량은 원래 문자열이 기록되어 있으면 그대로 쓴다 (orderbook.DecimalText).
+// JSON 에는 priceText 등으로 함께 실린다.
+func dumpSnapshots(w io.Writer, dataDir, symbol string, rng rangeFlags, format string, depth int, top, follow, showProgress bool) error {
+	bw := bufio.NewWriter(w)
+	if format == "csv" {
+		if top {
+			bw.WriteString("event_time,sequence,bid_price,bid_quantity,ask_price,ask_quantity,last_update_id\n")
+		} else {
+			bw.WriteString("event_time,sequence,side,depth,price,quantity\n")
+		}
 	}
-	for _, l := range closestSnapshot.Asks {
-		book.Asks[l.Price] = l.Quantity
+	var n int
+	write := func(ev *orderbook.Event) error {
+		s := ev.GetSnapshot()
+		if s == nil {
+			return nil
+		}
+		n++
+		var b []byte
+		switch {
+		case format == "csv" && top:
+			b = appendTopCSV(nil, ev, s)
+		case format == "csv":
+			b = appendLevelsCSV(nil, ev, s, depth)
+		default:
+			out := &orderbook.Event{EventTime: ev.EventTime, Sequence: ev.Sequence, Symbol: ev.Symbol, ExchangeTime: ev.ExchangeTime, StreamType: ev.StreamType}
+			if top {
+				out.StreamType = orderbook.TickStreamType
+				out.Payload = &orderbook.Event_Tick{Tick: orderbook.SnapshotTick(s)}
+			} else {
+				trimmed := proto.Clone(s).(*orderbook.Snapshot)
+				trimmed.Bids, trimmed.Asks = trimmed.Bids[:min(depth, len(trimmed.Bids))], trimmed.Asks[:min(depth, len(trimmed.Asks))]
+				out.Payload = &orderbook.Event_Snapshot{Snapshot: trimmed}
+			}
+			var err error
+			if b, err = protojson.Marshal(out); err != nil {
+				return err
+			}
+			b = append(b, '\n')
+		}
+		_, err := bw.Write(b)
+		return err
 	}
 
-	fmt.Printf("\n--- Order Book for %s at %s ---\n", symbol, time.UnixMilli(targetTime).UTC())
-	printBook(book, 20)
-}
+	ctx, cancel := interruptContext()
+	defer cancel()
 
-func readNextSnapshot(f *os.File) (*orderbook.Snapshot, error) {
-	lenBuf := make([]byte, 4)
-	_, err := io.ReadFull(f, lenBuf)
-	if err != nil {
-		return nil, err
+	if follow {
+		// 끝이 없으므로 시작만 받는다. 기본은 오늘(UTC) 파일의 처음부터
+		if rng.to != "" || rng.day != "" {
+			return errors.New("-follow reads from -from (default the start of today, UTC) with no end; drop -to/-day")
+		}
+		now := time.Now().UnixMilli()
+		from := now - now%dayMillis
+		if rng.from != "" {
+			var err error
+			if from, err = parseTime(rng.from); err != nil {
+				return err
+			}
+		}
+		err := tailSymbol(ctx, dataDir, symbol, from, func(ev *orderbook.Event) error {
+			if err := write(ev); err != nil {
+				return err
+			}
+			return bw.Flush()
+		})
+		if errors.Is(err, context.Canceled) {
+			log.Printf("Dumped %d snapshots", n)
+			return bw.Flush()
+		}
+		return err
 	}
 
-	msgLen := binary.LittleEndian.Uint32(lenBuf)
-	msgBuf := make([]byte, msgLen)
-	_, err = io.ReadFull(f, msgBuf)
+	from, to, err := rng.resolve()
 	if err != nil {
-		return nil, err
+		return err
 	}
-
-	var snapshot orderbook.Snapshot
-	if err := proto.Unmarshal(msgBuf, &snapshot); err != nil {
-		return nil, err
+	files := dataFilesInRange(dataDir, symbol, from, to)
+	if len(files) == 0 {
+		return fmt.Errorf("no data for %s in %s", symbol, rng.String())
 	}
+	var size int64
+	for _, f := range files {
+		size += f.size
+	}
+	progress := NewProgress("dump", size, showProgress)
+	for _, f := range files {
+		err := scanFile(ctx, f.path, from, to, progress, func(r *orderbook.Reader, ev *orderbook.Event) error {
+			return write(ev)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	progress.Finish()
+	log.Printf("Dumped %d snapshots", n)
+	return bw.Flush()
+}
 
-	return &snapshot, nil
+func appendTopCSV(b []byte, ev *orderbook.Event, s *orderbook.Snapshot) []byte {
+	t := orderbook.SnapshotTick(s)
+	b = strconv.AppendInt(b, ev.EventTime, 10)
+	b = strconv.AppendUint(append(b, ','), ev.Sequence, 10)
+	b = appendTickDecimals(b, t)
+	b = strconv.AppendInt(append(b, ','), t.UpdateId, 10)
+	return append(b, '\n')
+}
+
+func appendLevelsCSV(b []byte, ev *orderbook.Event, s *orderbook.Snapshot, depth int) []byte {
+	for _, side := range []struct {
+		name   string
+		levels []*orderbook.Level
+	}{{"bid", s.Bids}, {"ask", s.Asks}} {
+		for i, l := range side.levels[:min(depth, len(side.levels))] {
+			b = strconv.AppendInt(b, ev.EventTime, 10)
+			b = strconv.AppendUint(append(b, ','), ev.Sequence, 10)
+			b = append(append(append(b, ','), side.name...), ',')
+			b = strconv.AppendInt(b, int64(i), 10)
+			b = orderbook.AppendDecimal(append(b, ','), l.PriceText, l.Price)
+			b = orderbook.AppendDecimal(append(b, ','), l.QuantityText, l.Quantity)
+			b = append(b, '\n')
+		}
+	}
+	return b
 }
 
-func printBook(book *OrderBook, depth int) {
+// 가격과 수량은 호가/수량 단위의 자릿수로 출력한다
+func printBook(book *OrderBook, depth int, prec decimalPrecision) {
 	askPrices := make([]float64, 0, len(book.Asks))
 	for p := range book.Asks {
 		askPrices = append(askPrices, p)
@@ -109,7 +319,7 @@ func printBook(book *OrderBook, depth int) {
 	// 가장 낮은 가격부터 출력 (오름차순)
 	for i := 0; i < depth && i < len(askPrices); i++ {
 		p := askPrices[i]
-		fmt.Printf("%.4f\t%.4f\n", p, book.Asks[p])
+		fmt.Printf("%s\t%s\n", formatDecimals(p, prec.Price), formatDecimals(book.Asks[p], prec.Quantity))
 	}
 
 	bidPrices := make([]float64, 0, len(book.Bids))
@@ -123,6 +333,6 @@ func printBook(book *OrderBook, depth int) {
 	// 가장 높은 가격부터 출력 (내림차순)
 	for i := 0; i < depth && i < len(bidPrices); i++ {
 		p := bidPrices[i]
-		fmt.Printf("%.4f\t%.4f\n", p, book.Bids[p])
+		fmt.Printf("%s\t%s\n", formatDecimals(p, prec.Price), formatDecimals(book.Bids[p], prec.Quantity))
 	}
 }
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"orderbook/orderbook"
+)
+
+// redis:// 심볼별 최신 오더북을 Redis 에 올린다. 트레이딩 서비스가 파일을 읽지 않고 거의 실시간 책을 가져갈 수 있게.
+//
+//	redis://[user:password@]host:6379/0?latest=latest:{symbol}&stream=book:{symbol}&maxlen=10000&depth=20&format=json[&ttl=10s][&channel=book:{symbol}]
+//
+// 스냅샷은 그대로, 증분은 심볼별로 재구성한 책(orderbook.Book)에 적용해 상위 depth 호가를 Snapshot 이벤트로 만든다.
+// 책이 바뀔 때마다 한 번의 파이프라인으로
+//
+//	SET     latest    최신 책 (ttl 이 있으면 만료 시간과 함께)
+//	XADD    stream    책 이력. MAXLEN ~ maxlen 으로 대략 잘라 낸다 (0 이면 자르지 않는다)
+//	PUBLISH channel   pub/sub 구독자용 (channel= 을 줄 때만)
+//
+// 을 보낸다. 키 템플릿의 {symbol} 은 소문자 심볼이고, 빈 값(latest=, stream=)이면 그 명령을 보내지 않는다.
+// 스트림 항목은 event 필드에 책을, 나머지 필드에 원래 타임스탬프(eventHeaders)를 싣는다.
+// format 은 json (protojson) 또는 proto. rediss:// 는 TLS. 그 밖의 쿼리(dial_timeout 등)는 go-redis 옵션으로 넘긴다.
+// 보내기는 동기라 실패는 그 Publish 의 오류다 (수집기에서는 서킷 브레이커가 센다).
+
+func init() {
+	registerSink("redis", openRedisSink)
+	registerSink("rediss", openRedisSink)
+}
+
+const redisWriteTimeout = 5 * time.Second
+
+type redisSink struct {
+	rdb     *redis.Client
+	latest  string // 키 템플릿
+	stream  string
+	channel string
+	maxLen  int64
+	ttl     time.Duration
+	depth   int
+	marshal func(ev *orderbook.Event) ([]byte, error)
+
+	books map[string]*redisBook // 심볼별 재구성 책. Publish 는 managedSink 큐에서 하나씩 불린다
+}
+
+type redisBook struct {
+	book   *orderbook.Book
+	seeded bool // 스냅샷을 받았고 증분이 이어지고 있다
+}
+
+func openRedisSink(u *url.URL) (Sink, error) {
+	q := u.Query()
+	s := &redisSink{
+		latest: "latest:{symbol}",
+		stream: "book:{symbol}",
+		maxLen: 10000,
+		depth:  20,
+		books:  make(map[string]*redisBook),
+	}
+	if q.Has("latest") {
+		s.latest = q.Get("latest")
+	}
+	if q.Has("stream") {
+		s.stream = q.Get("stream")
+	}
+	s.channel = q.Get("channel")
+	if s.latest == "" && s.stream == "" && s.channel == "" {
+		return nil, fmt.Errorf("redis: latest, stream and channel are all empty")
+	}
+	if v := q.Get("maxlen"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("redis: invalid maxlen %q", v)
+		}
+		s.maxLen = n
+	}
+	if v := q.Get("ttl"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("redis: invalid ttl %q", v)
+		}
+		s.ttl = d
+	}
+	if v := q.Get("depth"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("redis: invalid depth %q", v)
+		}
+		s.depth = n
+	}
+	switch format := q.Get("format"); format {
+	case "", "json":
+		s.marshal = func(ev *orderbook.Event) ([]byte, error) { return protojson.Marshal(ev) }
+	case "proto":
+		s.marshal = func(ev *orderbook.Event) ([]byte, error) { return proto.Marshal(ev) }
+	default:
+		return nil, fmt.Errorf("redis: unknown format %q (json, proto)", format)
+	}
+
+	// 이 싱크의 옵션을 빼고 나머지는 go-redis 가 해석한다 (모르는 옵션은 거기서 오류)
+	for _, k := range []string{"latest", "stream", "channel", "maxlen", "ttl", "depth", "format"} {
+		q.Del(k)
+	}
+	ru := *u
+	ru.RawQuery = q.Encode()
+	opts, err := redis.ParseURL(ru.String())
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	s.rdb = redis.NewClient(opts)
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisWriteTimeout)
+	defer cancel()
+	if err := s.rdb.Ping(ctx).Err(); err != nil {
+		s.rdb.Close()
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	return s, nil
+}
+
+func (s *redisSink) Publish(ev *orderbook.Event) error {
+	book := s.update(ev)
+	if book == nil {
+		return nil
+	}
+	data, err := s.marshal(book)
+	if err != nil {
+		return err
+	}
+	symbol := strings.ToLower(ev.Symbol)
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisWriteTimeout)
+	defer cancel()
+	pipe := s.rdb.Pipeline()
+	if s.latest != "" {
+		pipe.Set(ctx, redisKey(s.latest, symbol), data, s.ttl)
+	}
+	if s.stream != "" {
+		values := []any{"event", data}
+		for k, v := range eventHeaders(ev, replaying) {
+			values = append(values, k, v)
+		}
+		args := &redis.XAddArgs{Stream: redisKey(s.stream, symbol), Values: values}
+		if s.maxLen > 0 {
+			args.MaxLen, args.Approx = s.maxLen, true
+		}
+		pipe.XAdd(ctx, args)
+	}
+	if s.channel != "" {
+		pipe.Publish(ctx, redisKey(s.channel, symbol), data)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("redis: %w", err)
+	}
+	return nil
+}
+
+// 이벤트를 심볼의 책에 반영하고, 책이 바뀌었으면 올릴 Snapshot 이벤트를 돌려준다
+func (s *redisSink) update(ev *orderbook.Event) *orderbook.Event {
+	if ev.Symbol == "" { // 심볼을 파일 이름으로만 알던 옛 기록은 키를 만들 수 없다
+		return nil
+	}
+	rb := s.books[ev.Symbol]
+	if rb == nil {
+		rb = &redisBook{book: orderbook.NewBook()}
+		s.books[ev.Symbol] = rb
+	}
+	var snap *orderbook.Snapshot
+	switch pl := ev.Payload.(type) {
+	case *orderbook.Event_Snapshot:
+		rb.book.LoadSnapshot(pl.Snapshot)
+		rb.seeded = true
+		// 받은 스냅샷은 원래 텍스트를 살려 그대로 자른다
+		snap = &orderbook.Snapshot{
+			LastUpdateId: pl.Snapshot.LastUpdateId,
+			Bids:         trimLevels(pl.Snapshot.Bids, s.depth),
+			Asks:         trimLevels(pl.Snapshot.Asks, s.depth),
+		}
+	case *orderbook.Event_DepthDiff:
+		if !rb.seeded {
+			return nil
+		}
+		applied, err := rb.book.ApplyDiff(pl.DepthDiff)
+		if err != nil {
+			log.Printf("Redis sink: %s book out of sync, waiting for the next snapshot: %v", ev.Symbol, err)
+			rb.seeded = false
+			return nil
+		}
+		if !applied {
+			return nil
+		}
+		snap = &orderbook.Snapshot{
+			LastUpdateId: rb.book.LastUpdateID,
+			Bids:         rb.book.TopBids(s.depth),
+			Asks:         rb.book.TopAsks(s.depth),
+		}
+	default:
+		return nil
+	}
+	return &orderbook.Event{
+		EventTime:     ev.EventTime,
+		Sequence:      ev.Sequence,
+		Symbol:        ev.Symbol,
+		Exchange:      ev.Exchange,
+		MarketType:    ev.MarketType,
+		StreamType:    ev.StreamType,
+		ExchangeTime:  ev.ExchangeTime,
+		ReceiveTimeNs: ev.ReceiveTimeNs,
+		LatencyUs:     ev.LatencyUs,
+		Payload:       &orderbook.Event_Snapshot{Snapshot: snap},
+	}
+}
+
+func trimLevels(levels []*orderbook.Level, n int) []*orderbook.Level {
+	if n > 0 && n < len(levels) {
+		return levels[:n]
+	}
+	return levels
+}
+
+func redisKey(template, symbol string) string {
+	return strings.ReplaceAll(template, "{symbol}", symbol)
+}
+
+func (s *redisSink) Close() error {
+	return s.rdb.Close()
+}
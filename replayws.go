@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"orderbook/orderbook"
+)
+
+// 기록된 데이터를 바이낸스가 보내는 것과 같은 JSON 으로 웹소켓에 다시 흘려보낸다.
+// 트레이딩 봇은 접속 주소만 바꾸면 코드 수정 없이 과거 데이터로 돌려 볼 수 있다.
+//
+//	ws://host:9443/stream?streams=ethusdt@depth20@100ms/ethbtc@trade&start=2026-04-13T15:00:00Z[&end=][&speed=10x]
+//	                                  combined stream: {"stream":"<name>","data":{...}}
+//	ws://host:9443/ws/ethusdt@depth20@100ms[/ethbtc@trade]?start=...   raw stream: data 만
+//
+// speed 는 1x (기본, 원래 간격), 10x, 0.5x 처럼 배수이거나 max (기다리지 않음).
+// start 는 필수이고 end 를 주지 않으면 기록이 끝날 때까지 보낸다. 여러 심볼은 수신 시각 순으로 섞는다.
+// REST 부트스트랩 스냅샷(rest/depth)과 tick 처럼 바이낸스 스트림에 없는 레코드는 보내지 않는다.
+
+func runServeReplay(args []string) error {
+	fs := flag.NewFlagSet("serve-replay", flag.ExitOnError)
+	addr := fs.String("addr", ":9443", "listen address")
+	dataDir := fs.String("data", defaultDataDir, "data directory")
+	token := fs.String("token", os.Getenv("ORDERBOOK_HTTP_TOKEN"), "require this bearer token (default $ORDERBOOK_HTTP_TOKEN; empty disables auth)")
+	registerTZ(fs)
+	fs.Parse(args)
+
+	srv := &replayServer{dataDir: *dataDir}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /stream", srv.handleCombined)
+	mux.HandleFunc("GET /ws/{streams...}", srv.handleRaw)
+
+	var handler http.Handler = mux
+	if *token != "" {
+		handler = requireToken(*token, handler)
+	} else {
+		log.Printf("Warning: serving the replay feed without authentication")
+	}
+	log.Printf("Replaying %s over websocket on %s", *dataDir, *addr)
+	return http.ListenAndServe(*addr, handler)
+}
+
+type replayServer struct {
+	dataDir string
+}
+
+var replayUpgrader = websocket.Upgrader{
+	// 봇은 브라우저가 아니므로 Origin 을 보지 않는다
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+func (s *replayServer) handleCombined(w http.ResponseWriter, r *http.Request) {
+	s.serve(w, r, strings.Split(r.URL.Query().Get("streams"), "/"), true)
+}
+
+func (s *replayServer) handleRaw(w http.ResponseWriter, r *http.Request) {
+	s.serve(w, r, strings.Split(r.PathValue("streams"), "/"), false)
+}
+
+type replayRequest struct {
+	streams  map[string]bool // 소문자 스트림 이름
+	symbols  []string
+	from, to int64
+	speed    float64 // 0 이면 기다리지 않는다
+}
+
+func parseReplayRequest(r *http.Request, streams []string) (*replayRequest, error) {
+	qs := r.URL.Query()
+	req := &replayRequest{streams: make(map[string]bool), to: time.Now().UnixMilli(), speed: 1}
+	seen := make(map[string]bool)
+	for _, name := range streams {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		symbol, _, ok := strings.Cut(name, "@")
+		if !ok {
+			return nil, fmt.Errorf("invalid stream %q (want <symbol>@<type>)", name)
+		}
+		req.streams[name] = true
+		if !seen[symbol] {
+			seen[symbol] = true
+			req.symbols = append(req.symbols, symbol)
+		}
+	}
+	if len(req.streams) == 0 {
+		return nil, fmt.Errorf("no streams requested")
+	}
+	if qs.Get("start") == "" {
+		return nil, fmt.Errorf("start is required")
+	}
+	var err error
+	if req.from, err = parseTime(qs.Get("start")); err != nil {
+		return nil, err
+	}
+	if v := qs.Get("end"); v != "" {
+		if req.to, err = parseTime(v); err != nil {
+			return nil, err
+		}
+	}
+	if req.to <= req.from {
+		return nil, fmt.Errorf("end must be after start")
+	}
+	if v := qs.Get("speed"); v != "" && v != "max" {
+		req.speed, err = strconv.ParseFloat(strings.TrimSuffix(v, "x"), 64)
+		if err != nil || req.speed <= 0 {
+			return nil, fmt.Errorf("invalid speed %q (e.g. 1x, 10x, max)", v)
+		}
+	} else if v == "max" {
+		req.speed = 0
+	}
+	return req, nil
+}
+
+func (s *replayServer) serve(w http.ResponseWriter, r *http.Request, streams []string, combined bool) {
+	req, err := parseReplayRequest(r, streams)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	conn, err := replayUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return // Upgrade 가 이미 응답했다
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	// 제어 프레임을 처리하고 클라이언트가 끊은 것을 알아채려면 계속 읽어야 한다.
+	// SUBSCRIBE 같은 요청은 받기만 하고 무시한다.
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	log.Printf("Replay %s: %d stream(s) from %s at x%g", r.RemoteAddr, len(req.streams), formatMillis(req.from), req.speed)
+	n, err := s.replay(ctx, req, func(stream string, data []byte) error {
+		msg := data
+		if combined {
+			msg = make([]byte, 0, len(data)+len(stream)+20)
+			msg = append(msg, `{"stream":"`...)
+			msg = append(msg, stream...)
+			msg = append(msg, `","data":`...)
+			msg = append(msg, data...)
+			msg = append(msg, '}')
+		}
+		conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		return conn.WriteMessage(websocket.TextMessage, msg)
+	})
+	if err != nil && ctx.Err() == nil {
+		log.Printf("Replay %s stopped after %d messages: %v", r.RemoteAddr, n, err)
+		return
+	}
+	log.Printf("Replay %s finished: %d messages", r.RemoteAddr, n)
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "end of recording"), time.Now().Add(time.Second))
+}
+
+// 요청한 스트림의 이벤트를 수신 시각 순으로 send 에 넘긴다
+func (s *replayServer) replay(ctx context.Context, req *replayRequest, send func(stream string, data []byte) error) (int, error) {
+	pacer := newPacer(req.speed)
+	var n int
+	err := mergeRange(ctx, s.dataDir, req.symbols, req.from, req.to, func(ev *orderbook.Event) error {
+		stream := binanceStreamName(ev)
+		if !req.streams[stream] {
+			return nil
+		}
+		data := appendBinanceStreamData(nil, ev)
+		if data == nil {
+			return nil
+		}
+		if err := pacer.wait(ctx, ev.EventTime); err != nil {
+			return err
+		}
+		if err := send(stream, data); err != nil {
+			return err
+		}
+		n++
+		return nil
+	})
+	return n, err
+}
+
+// <symbol>@<stream type>. 스트림 종류가 없는 옛 레코드는 depth20@100ms 로 본다.
+func binanceStreamName(ev *orderbook.Event) string {
+	streamType := ev.StreamType
+	if streamType == "" {
+		streamType = ev.GetSnapshot().GetStreamType()
+		if streamType == "" {
+			streamType = "depth20@100ms"
+		}
+	}
+	return strings.ToLower(ev.Symbol) + "@" + streamType
+}
+
+// 이벤트를 바이낸스 스트림 메시지의 data JSON 으로 되돌린다 (stream.go 의 역변환).
+// 가격/수량은 원래 문자열이 있으면 그대로 쓴다. 바이낸스 스트림에 없는 레코드면 nil.
+func appendBinanceStreamData(b []byte, ev *orderbook.Event) []byte {
+	futures := strings.Contains(ev.MarketType, "futures")
+	symbol := strings.ToUpper(ev.Symbol)
+	switch pl := ev.Payload.(type) {
+	case *orderbook.Event_Snapshot:
+		if orderbook.IsFullBookSnapshot(ev.StreamType) {
+			return nil
+		}
+		s := pl.Snapshot
+		if futures {
+			// 선물 partial depth 는 depthUpdate 모양이다. 기록에 없는 U 는 뺀다.
+			b = append(b, `{"e":"depthUpdate","E":`...)
+			b = strconv.AppendInt(b, ev.ExchangeTime, 10)
+			b = append(b, `,"T":`...)
+			b = strconv.AppendInt(b, ev.ExchangeTime, 10)
+			b = appendJSONString(append(b, `,"s":`...), symbol)
+			b = append(b, `,"u":`...)
+			b = strconv.AppendInt(b, s.LastUpdateId, 10)
+			b = appendRESTLevels(append(b, `,"b":`...), s.Bids)
+			b = appendRESTLevels(append(b, `,"a":`...), s.Asks)
+			return append(b, '}')
+		}
+		b = append(b, `{"lastUpdateId":`...)
+		b = strconv.AppendInt(b, s.LastUpdateId, 10)
+		b = appendRESTLevels(append(b, `,"bids":`...), s.Bids)
+		b = appendRESTLevels(append(b, `,"asks":`...), s.Asks)
+		return append(b, '}')
+	case *orderbook.Event_DepthDiff:
+		d := pl.DepthDiff
+		b = append(b, `{"e":"depthUpdate","E":`...)
+		b = strconv.AppendInt(b, ev.ExchangeTime, 10)
+		b = appendJSONString(append(b, `,"s":`...), symbol)
+		b = append(b, `,"U":`...)
+		b = strconv.AppendInt(b, d.FirstUpdateId, 10)
+		b = append(b, `,"u":`...)
+		b = strconv.AppendInt(b, d.FinalUpdateId, 10)
+		if futures {
+			b = append(b, `,"pu":`...)
+			b = strconv.AppendInt(b, d.PrevFinalUpdateId, 10)
+		}
+		b = appendRESTLevels(append(b, `,"b":`...), d.Bids)
+		b = appendRESTLevels(append(b, `,"a":`...), d.Asks)
+		return append(b, '}')
+	case *orderbook.Event_Trade:
+		t := pl.Trade
+		b = append(b, `{"e":"trade","E":`...)
+		b = strconv.AppendInt(b, ev.ExchangeTime, 10)
+		b = appendJSONString(append(b, `,"s":`...), symbol)
+		b = append(b, `,"t":`...)
+		b = strconv.AppendInt(b, t.TradeId, 10)
+		b = orderbook.AppendDecimal(append(b, `,"p":"`...), t.PriceText, t.Price)
+		b = orderbook.AppendDecimal(append(b, `","q":"`...), t.QuantityText, t.Quantity)
+		b = append(b, `","T":`...)
+		b = strconv.AppendInt(b, t.TradeTime, 10)
+		b = strconv.AppendBool(append(b, `,"m":`...), t.BuyerIsMaker)
+		return append(b, `,"M":true}`...)
+	case *orderbook.Event_BookTicker:
+		t := pl.BookTicker
+		b = append(b, '{')
+		if futures {
+			b = append(b, `"e":"bookTicker","E":`...)
+			b = strconv.AppendInt(b, ev.ExchangeTime, 10)
+			b = append(b, `,"T":`...)
+			b = strconv.AppendInt(b, ev.ExchangeTime, 10)
+			b = append(b, ',')
+		}
+		b = append(b, `"u":`...)
+		b = strconv.AppendInt(b, t.UpdateId, 10)
+		b = appendJSONString(append(b, `,"s":`...), symbol)
+		b = orderbook.AppendDecimal(append(b, `,"b":"`...), t.BidPriceText, t.BidPrice)
+		b = orderbook.AppendDecimal(append(b, `","B":"`...), t.BidQuantityText, t.BidQuantity)
+		b = orderbook.AppendDecimal(append(b, `","a":"`...), t.AskPriceText, t.AskPrice)
+		b = orderbook.AppendDecimal(append(b, `","A":"`...), t.AskQuantityText, t.AskQuantity)
+		return append(b, `"}`...)
+	case *orderbook.Event_Liquidation:
+		l := pl.Liquidation
+		b = append(b, `{"e":"forceOrder","E":`...)
+		b = strconv.AppendInt(b, ev.ExchangeTime, 10)
+		b = appendJSONString(append(b, `,"o":{"s":`...), symbol)
+		b = appendJSONString(append(b, `,"S":`...), l.Side)
+		b = appendJSONString(append(b, `,"o":`...), l.OrderType)
+		b = appendJSONString(append(b, `,"f":`...), l.TimeInForce)
+		b = orderbook.AppendDecimal(append(b, `,"q":"`...), l.QuantityText, l.Quantity)
+		b = orderbook.AppendDecimal(append(b, `","p":"`...), l.PriceText, l.Price)
+		b = orderbook.AppendDecimal(append(b, `","ap":"`...), l.AveragePriceText, l.AveragePrice)
+		b = appendJSONString(append(b, `","X":`...), l.Status)
+		b = orderbook.AppendDecimal(append(b, `,"l":"`...), l.LastFilledQuantityText, l.LastFilledQuantity)
+		b = orderbook.AppendDecimal(append(b, `","z":"`...), l.FilledQuantityText, l.FilledQuantity)
+		b = append(b, `","T":`...)
+		b = strconv.AppendInt(b, l.TradeTime, 10)
+		return append(b, `}}`...)
+	case *orderbook.Event_Ticker:
+		// 시장 전체 스트림은 심볼마다 나눠 기록했으므로 한 메시지로 되돌리지 않는다
+		if isMarketStream(ev.StreamType) {
+			return nil
+		}
+		t := pl.Ticker
+		mini := streamKind(ev.StreamType) == "miniTicker"
+		if mini {
+			b = append(b, `{"e":"24hrMiniTicker","E":`...)
+		} else {
+			b = append(b, `{"e":"24hrTicker","E":`...)
+		}
+		b = strconv.AppendInt(b, ev.ExchangeTime, 10)
+		b = appendJSONString(append(b, `,"s":`...), symbol)
+		if !mini {
+			b = orderbook.AppendDecimal(append(b, `,"p":"`...), "", t.PriceChange)
+			b = orderbook.AppendDecimal(append(b, `","P":"`...), "", t.PriceChangePercent)
+			b = orderbook.AppendDecimal(append(b, `","w":"`...), "", t.WeightedAvgPrice)
+			b = orderbook.AppendDecimal(append(b, `","Q":"`...), "", t.LastQuantity)
+			b = append(b, '"')
+		}
+		b = orderbook.AppendDecimal(append(b, `,"c":"`...), "", t.LastPrice)
+		b = orderbook.AppendDecimal(append(b, `","o":"`...), "", t.OpenPrice)
+		b = orderbook.AppendDecimal(append(b, `","h":"`...), "", t.HighPrice)
+		b = orderbook.AppendDecimal(append(b, `","l":"`...), "", t.LowPrice)
+		b = orderbook.AppendDecimal(append(b, `","v":"`...), "", t.Volume)
+		b = orderbook.AppendDecimal(append(b, `","q":"`...), "", t.QuoteVolume)
+		if mini {
+			return append(b, `"}`...)
+		}
+		b = append(b, `","O":`...)
+		b = strconv.AppendInt(b, t.OpenTime, 10)
+		b = append(b, `,"C":`...)
+		b = strconv.AppendInt(b, t.CloseTime, 10)
+		b = append(b, `,"F":`...)
+		b = strconv.AppendInt(b, t.FirstTradeId, 10)
+		b = append(b, `,"L":`...)
+		b = strconv.AppendInt(b, t.LastTradeId, 10)
+		b = append(b, `,"n":`...)
+		b = strconv.AppendInt(b, t.TradeCount, 10)
+		return append(b, '}')
+	case *orderbook.Event_Record:
+		// 전용 payload 가 없던 스트림은 받은 JSON 을 그대로 담아 두었다
+		if pl.Record.Encoding != "json" || !strings.HasPrefix(pl.Record.Type, exchangeName+".") {
+			return nil
+		}
+		return append(b, pl.Record.Data...)
+	}
+	return nil
+}
+
+func appendJSONString(b []byte, s string) []byte {
+	return strconv.AppendQuote(b, s)
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"orderbook/orderbook"
+)
+
+// orderbook reprocess -out <dir> <raw 파일|디렉터리>... : collect -raw-dir 로 남긴 원본 메시지를 지금의 파서로
+// 다시 풀어 데이터 파일을 새로 만든다. 파서를 고쳤거나 스키마에 필드가 늘었을 때 쓴다.
+//
+// 수집기와 같게 만든다.
+//   - 수집할 때의 거래소, 시장, 구독 스트림을 raw 파일 헤더에서 되살린다
+//   - 세션 ID 도 원래 것을 쓰고 세션이 바뀌면 순번을 1 부터 다시 매긴다. 파싱에 실패한 메시지도 번호를 소비한다
+//   - 청산과 시장 전체 통계는 -liquidations-dir, -tickers-dir 로 나눌 수 있다 (비우면 -out 에 함께)
+//
+// 디렉터리는 그 아래의 raw_*.zst 를 모두 읽는다. 파일 이름의 시작 시각 순으로 처리하므로 여러 날을 한 번에 넘겨도 된다.
+// 원래 데이터 디렉터리를 덮어쓰지 않는다. 결과를 확인한 뒤 옮긴다. 끝나면 -out 의 manifest 를 갱신한다.
+//
+// -print 는 파일을 만들지 않고 "수신 시각 메시지" 줄로 원본을 출력한다.
+
+func runReprocess(args []string) error {
+	fset := flag.NewFlagSet("reprocess", flag.ExitOnError)
+	outDir := fset.String("out", "", "write the rebuilt data files under this data directory (must not be the live one)")
+	liquidationsDir := fset.String("liquidations-dir", "", "write liquidations (forceOrder) into this data directory; empty keeps them in -out")
+	tickersDir := fset.String("tickers-dir", "", "write market-wide 24h statistics (!miniTicker@arr) into this data directory; empty keeps them in -out")
+	compression := fset.String("compression", "none", "data file compression: none or zstd")
+	rotate := fset.String("rotate", rotateDaily, "start a new file every UTC day or hour (day, hour)")
+	keepDecimals := fset.Bool("keep-decimals", false, "store the original price/quantity strings even if the capture was made without -keep-decimals")
+	from := fset.String("from", "", "skip messages received before this time (RFC3339, YYYY-MM-DD or unix ms)")
+	to := fset.String("to", "", "skip messages received at or after this time")
+	printOnly := fset.Bool("print", false, "print the captured messages (receive time and JSON) instead of rebuilding data files")
+	fset.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: orderbook reprocess (-out <dir> | -print) [flags] <raw file|dir>...")
+		fset.PrintDefaults()
+	}
+	fset.Parse(args)
+	if fset.NArg() == 0 {
+		fset.Usage()
+		return fmt.Errorf("no raw files")
+	}
+	if (*outDir == "") == !*printOnly {
+		return fmt.Errorf("use exactly one of -out and -print")
+	}
+	if *outDir != "" && filepath.Clean(*outDir) == filepath.Clean(defaultDataDir) {
+		return fmt.Errorf("-out must not be the collector's data directory %s", defaultDataDir)
+	}
+	fromMs, toMs := int64(0), int64(1<<63-1)
+	var err error
+	if *from != "" {
+		if fromMs, err = parseTime(*from); err != nil {
+			return err
+		}
+	}
+	if *to != "" {
+		if toMs, err = parseTime(*to); err != nil {
+			return err
+		}
+	}
+	paths, err := rawFiles(fset.Args())
+	if err != nil {
+		return err
+	}
+
+	p := &reprocessor{outDir: *outDir, liquidationsDir: *liquidationsDir, tickersDir: *tickersDir, keepDecimals: *keepDecimals}
+	if !*printOnly {
+		switch *compression {
+		case "none":
+			p.compression = orderbook.Compression_COMPRESSION_NONE
+		case "zstd":
+			p.compression = orderbook.Compression_COMPRESSION_ZSTD
+		default:
+			return fmt.Errorf("unknown compression %q", *compression)
+		}
+		if p.rotation, err = newRotationPolicy(*rotate, 0, "", "", restartAppend); err != nil {
+			return err
+		}
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	for _, path := range paths {
+		truncated, err := readRawFile(path, func(h *rawHeader, received time.Time, frame []byte) error {
+			if ms := received.UnixMilli(); ms < fromMs || ms >= toMs {
+				return nil
+			}
+			if *printOnly {
+				fmt.Fprintf(out, "%s %s\n", received.UTC().Format(time.RFC3339Nano), frame)
+				return nil
+			}
+			p.message(path, h, received, frame)
+			return nil
+		})
+		if err != nil {
+			p.close()
+			return err
+		}
+		if truncated {
+			log.Printf("%s: ends with a partial record (collector stopped while writing)", path)
+		}
+	}
+	if *printOnly {
+		return nil
+	}
+	p.close()
+	log.Printf("Reprocessed %d messages from %d files into %d events (%d failed to parse)", p.messages, len(paths), p.events, p.failed)
+
+	for _, dir := range []string{*outDir, *liquidationsDir, *tickersDir} {
+		if dir == "" {
+			continue
+		}
+		m, err := loadManifest(dir)
+		if err != nil {
+			return err
+		}
+		if _, err := refreshManifest(dir, m); err != nil {
+			return err
+		}
+		if err := m.save(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 인자의 raw 파일과 디렉터리 아래의 raw_*.zst 를 시작 시각(파일 이름) 순으로
+func rawFiles(args []string) ([]string, error) {
+	var paths []string
+	for _, arg := range args {
+		fi, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			paths = append(paths, arg)
+			continue
+		}
+		err = filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() && strings.HasPrefix(d.Name(), "raw_") && strings.HasSuffix(d.Name(), ".zst") {
+				paths = append(paths, path)
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	slices.SortStableFunc(paths, func(a, b string) int { return strings.Compare(filepath.Base(a), filepath.Base(b)) })
+	return slices.Compact(paths), nil
+}
+
+// raw 세션마다 파일 관리자를 새로 만들어 원래 세션 ID 와 순번을 되살린다
+type reprocessor struct {
+	outDir, liquidationsDir, tickersDir string
+	compression                         orderbook.Compression
+	rotation                            *rotationPolicy
+	keepDecimals                        bool
+
+	session                   string
+	fm, liquidations, tickers *FileManager
+	decoder                   combinedDecoder
+	messages, events, failed  int
+}
+
+func (p *reprocessor) message(path string, h *rawHeader, received time.Time, frame []byte) {
+	p.messages++
+	if h.Session != p.session || p.fm == nil {
+		p.close()
+		p.open(h)
+	}
+	stream, data, err := p.decoder.decode(frame)
+	if err != nil || stream == "" {
+		return // SUBSCRIBE 응답 등. 수집기도 순번을 매기지 않는다
+	}
+
+	// 순번은 수집기처럼 파싱 전에 매긴다
+	if isMarketStream(stream) {
+		events, err := parseMarketTickers(stream, data, received)
+		if err != nil {
+			p.parseFailed(path, stream, received, err)
+			return
+		}
+		for _, ev := range events {
+			symbol := strings.ToLower(ev.Symbol)
+			ev.Sequence = p.tickers.nextSequence(symbol)
+			p.tickers.writeEvent(symbol, ev)
+			p.events++
+		}
+		return
+	}
+	symbol, streamType, _ := strings.Cut(stream, "@")
+	symbol = strings.ToLower(symbol)
+	fm := p.fm
+	if streamKind(streamType) == "forceOrder" {
+		fm = p.liquidations
+	}
+	sequence := fm.nextSequence(symbol)
+	ev, err := parseStreamEvent(stream, data, received)
+	if err != nil {
+		p.parseFailed(path, stream, received, err)
+		return
+	}
+	ev.Sequence = sequence
+	fm.writeEvent(symbol, ev)
+	p.events++
+}
+
+func (p *reprocessor) parseFailed(path, stream string, received time.Time, err error) {
+	p.failed++
+	log.Printf("%s: stream %s at %s: %v", path, stream, received.UTC().Format(time.RFC3339Nano), err)
+}
+
+// 수집할 때의 설정을 되살리고 세션의 파일 관리자를 연다
+func (p *reprocessor) open(h *rawHeader) {
+	exchangeName, marketType, streamTypes = h.Exchange, h.MarketType, h.Streams
+	keepDecimalText = h.KeepText || p.keepDecimals
+	p.session = h.Session
+	newFM := func(dir string) *FileManager {
+		fm := NewFileManager(dir, p.compression, p.rotation)
+		if h.Session != "" {
+			fm.sessionID = h.Session
+		}
+		fm.describe = describeSymbol
+		return fm
+	}
+	p.fm = newFM(p.outDir)
+	p.liquidations, p.tickers = p.fm, p.fm
+	if p.liquidationsDir != "" {
+		p.liquidations = newFM(p.liquidationsDir)
+	}
+	if p.tickersDir != "" {
+		p.tickers = newFM(p.tickersDir)
+		p.tickers.describe = func(symbol string, h *orderbook.FileHeader) {
+			describeSymbol(symbol, h)
+			h.Streams = marketStreamTypes()
+		}
+	}
+}
+
+func (p *reprocessor) close() {
+	if p.fm == nil {
+		return
+	}
+	p.fm.Close()
+	for _, fm := range []*FileManager{p.liquidations, p.tickers} {
+		if fm != p.fm {
+			fm.Close()
+		}
+	}
+	p.fm, p.liquidations, p.tickers = nil, nil, nil
+}
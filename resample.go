@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"orderbook/orderbook"
+)
+
+// 스냅샷에서 최우선 호가를 일정 간격 막대로 요약한다 (차트, 회귀 분석용). 전체 호가를 읽지 않아도 된다.
+//
+//	bar_time           막대 시작 (UTC ms). 간격은 -tz 의 자정 기준으로 정렬한다 (1h, 1d 막대가 현지 시각에 맞도록)
+//	bid, ask, spread   막대 끝 시점의 최우선 호가와 스프레드
+//	mid_open..close    막대 안 중간가의 시가, 고가, 저가, 종가
+//	spread_mean        막대 안 스냅샷들의 스프레드 평균
+//	bid_qty, ask_qty   최우선 호가의 수량
+//	bid_depth, ...     상위 -levels 개 호가의 수량 합
+//	updates            막대 안 스냅샷 수. 0 이면 앞 막대 값을 이어 쓴 것이다
+//
+// 구간의 첫 스냅샷 전 막대와 한쪽 호가가 빈 스냅샷은 건너뛴다.
+
+func runResample(args []string) error {
+	fs := flag.NewFlagSet("resample", flag.ExitOnError)
+	symbol := fs.String("symbol", "", "symbol")
+	var rng rangeFlags
+	rng.register(fs)
+	interval := fs.String("interval", "1s", "bar length (e.g. 100ms, 1s, 1m, 1h, 1d)")
+	levels := fs.Int("levels", 5, "levels per side summed into bid_depth/ask_depth")
+	dataDir := fs.String("data", defaultDataDir, "data directory")
+	noProgress := fs.Bool("no-progress", false, "disable the progress bar")
+	fs.Parse(args)
+
+	if *symbol == "" {
+		return fmt.Errorf("-symbol is required")
+	}
+	from, to, err := rng.resolve()
+	if err != nil {
+		return err
+	}
+	d, err := parseDuration(*interval)
+	if err != nil || d < time.Millisecond {
+		return fmt.Errorf("invalid -interval %q", *interval)
+	}
+	if *levels <= 0 {
+		return fmt.Errorf("-levels must be positive")
+	}
+	files := dataFilesInRange(*dataDir, *symbol, from, to)
+	if len(files) == 0 {
+		return fmt.Errorf("no data for %s in %s", *symbol, rng.String())
+	}
+	var size int64
+	for _, f := range files {
+		size += f.size
+	}
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+	bw := bufio.NewWriter(os.Stdout)
+	rs := newResampler(bw, from, to, d.Milliseconds(), *levels)
+	progress := NewProgress("resample", size, !*noProgress)
+	for _, f := range files {
+		err := scanFile(ctx, f.path, from, to, progress, func(r *orderbook.Reader, ev *orderbook.Event) error {
+			if s := ev.GetSnapshot(); s != nil {
+				rs.add(ev.EventTime, s)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	rs.finish()
+	progress.Finish()
+	log.Printf("Wrote %d bars", rs.bars)
+	return bw.Flush()
+}
+
+type resampler struct {
+	w      io.Writer
+	step   int64
+	to     int64
+	levels int
+
+	start int64 // 지금 막대의 시작
+	bars  int
+	buf   []byte
+
+	// 마지막 스냅샷 (막대를 넘어 이어진다)
+	seen                 bool
+	bid, ask, bidQ, askQ float64
+	bidDepth, askDepth   float64
+	// 지금 막대 안의 집계
+	updates                int
+	open, high, low, close float64
+	spreadSum              float64
+}
+
+func newResampler(w io.Writer, from, to, step int64, levels int) *resampler {
+	_, offset := time.UnixMilli(from).In(displayLoc).Zone()
+	rs := &resampler{w: w, step: step, to: to, levels: levels, start: from - mod(from+int64(offset)*1000, step)}
+	io.WriteString(w, "bar_time,bid,ask,spread,mid_open,mid_high,mid_low,mid_close,spread_mean,bid_qty,ask_qty,bid_depth,ask_depth,updates\n")
+	return rs
+}
+
+func (rs *resampler) add(t int64, s *orderbook.Snapshot) {
+	if len(s.Bids) == 0 || len(s.Asks) == 0 {
+		return
+	}
+	rs.advance(t)
+	rs.seen = true
+	rs.bid, rs.bidQ = s.Bids[0].Price, s.Bids[0].Quantity
+	rs.ask, rs.askQ = s.Asks[0].Price, s.Asks[0].Quantity
+	rs.bidDepth, rs.askDepth = sumQuantity(s.Bids, rs.levels), sumQuantity(s.Asks, rs.levels)
+
+	mid := (rs.bid + rs.ask) / 2
+	if rs.updates == 0 {
+		rs.open, rs.high, rs.low = mid, mid, mid
+	}
+	rs.high, rs.low, rs.close = math.Max(rs.high, mid), math.Min(rs.low, mid), mid
+	rs.spreadSum += rs.ask - rs.bid
+	rs.updates++
+}
+
+// t 이전에 끝난 막대를 모두 쓴다
+func (rs *resampler) advance(t int64) {
+	for t >= rs.start+rs.step {
+		rs.flush()
+		rs.start += rs.step
+	}
+}
+
+func (rs *resampler) finish() {
+	rs.advance(rs.to + rs.step - 1)
+}
+
+func (rs *resampler) flush() {
+	if rs.start >= rs.to || !rs.seen {
+		return
+	}
+	mid, spread := (rs.bid+rs.ask)/2, rs.ask-rs.bid
+	if rs.updates == 0 {
+		rs.open, rs.high, rs.low, rs.close = mid, mid, mid, mid
+		rs.spreadSum = spread
+	}
+	b := strconv.AppendInt(rs.buf[:0], rs.start, 10)
+	for _, v := range []float64{rs.bid, rs.ask, spread, rs.open, rs.high, rs.low, rs.close,
+		rs.spreadSum / float64(max(rs.updates, 1)), rs.bidQ, rs.askQ, rs.bidDepth, rs.askDepth} {
+		b = strconv.AppendFloat(append(b, ','), v, 'f', -1, 64)
+	}
+	b = strconv.AppendInt(append(b, ','), int64(rs.updates), 10)
+	rs.buf = append(b, '\n')
+	rs.w.Write(rs.buf)
+	rs.bars++
+	rs.updates, rs.spreadSum = 0, 0
+}
+
+func sumQuantity(levels []*orderbook.Level, n int) float64 {
+	var sum float64
+	for _, l := range trimLevels(levels, n) {
+		sum += l.Quantity
+	}
+	return sum
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"orderbook/orderbook"
+)
+
+// 바이낸스 REST depth 응답 모양의 JSON 디렉터리 출력 (convert -format binance-rest).
+// REST depth 엔드포인트를 흉내 내는 모의 거래소 하네스가 그대로 돌려줄 수 있게 스냅샷 하나를 파일 하나로 쓴다.
+//
+//	<name>.rest/<event_time>.json   GET /api/v3/depth 응답 {"lastUpdateId":..,"bids":[["가격","수량"],..],"asks":..}
+//	                                선물(usdm_futures 등)은 /fapi/v1/depth 처럼 "E", "T" (거래소 시각) 가 붙는다
+//	<name>.rest/index.csv           event_time,last_update_id,file (시각 순). at 이하 마지막 파일을 찾는 데 쓴다
+//
+// 가격/수량 문자열은 원래 문자열이 기록되어 있으면 그대로 쓴다. 같은 밀리초의 스냅샷은 처음 것만 남는다.
+// -rest-every 로 스냅샷 사이 최소 간격을, -rest-limit 으로 한쪽 호가 수를 줄일 수 있다.
+
+func writeBinanceREST(ctx context.Context, in, out string, p *Progress, every int64, limit int) (int, error) {
+	tmp := out + ".tmp"
+	if err := os.RemoveAll(tmp); err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(tmp, os.ModePerm); err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(tmp)
+
+	idx, err := os.Create(filepath.Join(tmp, "index.csv"))
+	if err != nil {
+		return 0, err
+	}
+	defer idx.Close()
+	iw := bufio.NewWriter(idx)
+	iw.WriteString("event_time,last_update_id,file\n")
+
+	var (
+		n    int
+		last int64 = math.MinInt64
+		buf  []byte
+	)
+	err = scanFile(ctx, in, math.MinInt64, math.MaxInt64, p, func(r *orderbook.Reader, ev *orderbook.Event) error {
+		s := ev.GetSnapshot()
+		if s == nil || ev.EventTime == last || (every > 0 && last != math.MinInt64 && ev.EventTime-last < every) {
+			return nil
+		}
+		last = ev.EventTime
+
+		market := ev.MarketType
+		if market == "" && r.Header != nil {
+			market = r.Header.MarketType
+		}
+		buf = appendRESTDepth(buf[:0], s, limit, strings.Contains(market, "futures"), ev.ExchangeTime)
+		name := strconv.FormatInt(ev.EventTime, 10) + ".json"
+		if err := os.WriteFile(filepath.Join(tmp, name), buf, 0644); err != nil {
+			return err
+		}
+		fmt.Fprintf(iw, "%d,%d,%s\n", ev.EventTime, s.LastUpdateId, name)
+		n++
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := iw.Flush(); err != nil {
+		return 0, err
+	}
+	if err := idx.Close(); err != nil {
+		return 0, err
+	}
+	if err := os.RemoveAll(out); err != nil {
+		return 0, err
+	}
+	return n, os.Rename(tmp, out)
+}
+
+func appendRESTDepth(b []byte, s *orderbook.Snapshot, limit int, futures bool, exchangeTime int64) []byte {
+	b = append(b, `{"lastUpdateId":`...)
+	b = strconv.AppendInt(b, s.LastUpdateId, 10)
+	if futures {
+		b = append(b, `,"E":`...)
+		b = strconv.AppendInt(b, exchangeTime, 10)
+		b = append(b, `,"T":`...)
+		b = strconv.AppendInt(b, exchangeTime, 10)
+	}
+	b = append(b, `,"bids":`...)
+	b = appendRESTLevels(b, trimLevels(s.Bids, limit))
+	b = append(b, `,"asks":`...)
+	b = appendRESTLevels(b, trimLevels(s.Asks, limit))
+	return append(b, "}\n"...)
+}
+
+func appendRESTLevels(b []byte, levels []*orderbook.Level) []byte {
+	b = append(b, '[')
+	for i, l := range levels {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = append(b, `["`...)
+		b = orderbook.AppendDecimal(b, l.PriceText, l.Price)
+		b = append(b, `","`...)
+		b = orderbook.AppendDecimal(b, l.QuantityText, l.Quantity)
+		b = append(b, `"]`...)
+	}
+	return append(b, ']')
+}
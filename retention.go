@@ -0,0 +1,320 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"orderbook/orderbook"
+)
+
+// 보관 정책. 원본은 Raw 기간만 두고, 그보다 오래된 파일은 DownsampleDir 에 Interval 해상도로
+// 줄인 사본을 만든 뒤 지운다. 줄인 사본은 Downsampled 기간이 지나면 지운다.
+// 수집기는 이를 백그라운드에서 주기적으로 돌리고, prune 명령으로 한 번만 실행할 수도 있다.
+//
+// OnRotate 면 수집기가 파일을 회전할 때 바로 줄인 사본을 만든다(장기 보관 계층). 원본을 몇 달만 두고 지워도
+// 사본은 같은 데이터 디렉터리 형식이라 read/serve-api/view 에 -data 로 그 디렉터리를 주면 그대로 조회할 수 있다.
+//
+//	collect -downsample-dir archive -downsample-on-rotate -downsample-depth 10 -retain-raw 90d -retain-downsampled 1825d
+
+type retentionPolicy struct {
+	Raw           time.Duration // 0 이면 원본을 지우지 않는다
+	Downsampled   time.Duration // 0 이면 줄인 사본을 지우지 않는다
+	DownsampleDir string        // 비어 있으면 줄인 사본 없이 지운다
+	Interval      time.Duration // 줄인 사본에서 스냅샷 사이 최소 간격
+	Depth         int           // 줄인 사본에 남길 호가 단계 수. 0 이면 전부
+	OnRotate      bool          // 회전할 때 사본을 만든다 (수집기만)
+
+	raw, downsampled string // 플래그 값 (30d 처럼 일 단위를 허용하므로 문자열로 받는다)
+}
+
+func (p *retentionPolicy) register(fs *flag.FlagSet) {
+	fs.StringVar(&p.raw, "retain-raw", "0", "delete raw data files older than this (e.g. 30d); 0 keeps them forever")
+	fs.StringVar(&p.downsampled, "retain-downsampled", "0", "delete downsampled files older than this (e.g. 365d); 0 keeps them forever")
+	fs.StringVar(&p.DownsampleDir, "downsample-dir", "", "before deleting a raw file, keep a downsampled copy in this data directory")
+	fs.DurationVar(&p.Interval, "downsample-interval", time.Second, "minimum spacing between snapshots in downsampled copies")
+	fs.IntVar(&p.Depth, "downsample-depth", 0, "levels per side to keep in downsampled copies; 0 keeps all")
+	if fs.Name() == "collect" {
+		fs.BoolVar(&p.OnRotate, "downsample-on-rotate", false, "write the downsampled copy as soon as a file rotates instead of when it expires")
+	}
+}
+
+// 플래그를 읽은 뒤 호출한다
+func (p *retentionPolicy) parse() error {
+	var err error
+	if p.Raw, err = parseDuration(p.raw); err != nil {
+		return err
+	}
+	if p.Downsampled, err = parseDuration(p.downsampled); err != nil {
+		return err
+	}
+	if p.DownsampleDir != "" && p.Raw == 0 && !p.OnRotate {
+		return errors.New("-downsample-dir needs -retain-raw or -downsample-on-rotate")
+	}
+	if p.OnRotate && p.DownsampleDir == "" {
+		return errors.New("-downsample-on-rotate needs -downsample-dir")
+	}
+	if p.Depth < 0 {
+		return errors.New("-downsample-depth must not be negative")
+	}
+	return nil
+}
+
+func (p *retentionPolicy) enabled() bool {
+	return p.Raw > 0 || (p.DownsampleDir != "" && p.Downsampled > 0)
+}
+
+// 날짜 파일 전체가 now 기준 age 보다 오래되었는지. 날짜를 알 수 없는 파일은 건드리지 않는다.
+func expired(e catalogEntry, age time.Duration, now time.Time) bool {
+	if age <= 0 || e.Date == "" {
+		return false
+	}
+	day, err := time.Parse(dateLayout, e.Date)
+	if err != nil {
+		return false
+	}
+	return now.Sub(day.Add(24*time.Hour)) > age
+}
+
+// dataDir 에 정책을 한 번 적용한다. dryRun 이면 할 일만 로그로 남긴다.
+func (p *retentionPolicy) apply(dataDir string, now time.Time, dryRun bool) error {
+	entries, err := listDataFiles(dataDir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !expired(e, p.Raw, now) {
+			continue
+		}
+		path := filepath.Join(dataDir, filepath.FromSlash(e.Path))
+		if dryRun {
+			log.Printf("Would expire %s (%s)", path, formatBytes(e.Size))
+			continue
+		}
+		if p.DownsampleDir != "" {
+			dst := filepath.Join(p.DownsampleDir, filepath.FromSlash(e.Path))
+			if upToDate(dst, path) {
+				// 회전할 때 이미 만들어 두었다
+				removeDataFile(path)
+				continue
+			}
+			if err := downsampleFile(path, dst, p.Interval, p.Depth); err != nil {
+				// 사본을 못 만들었으면 원본을 남겨 두고 다음 주기에 다시 시도한다
+				log.Printf("Failed to downsample %s, keeping it: %v", path, err)
+				continue
+			}
+		}
+		removeDataFile(path)
+	}
+
+	if p.DownsampleDir == "" || p.Downsampled <= 0 {
+		return nil
+	}
+	entries, err = listDataFiles(p.DownsampleDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	for _, e := range entries {
+		if !expired(e, p.Downsampled, now) {
+			continue
+		}
+		path := filepath.Join(p.DownsampleDir, filepath.FromSlash(e.Path))
+		if dryRun {
+			log.Printf("Would delete downsampled %s (%s)", path, formatBytes(e.Size))
+			continue
+		}
+		removeDataFile(path)
+	}
+	return nil
+}
+
+// 데이터 파일과 사이드카 인덱스를 지운다
+func removeDataFile(path string) {
+	if err := os.Remove(path); err != nil {
+		log.Printf("Failed to delete %s: %v", path, err)
+		return
+	}
+	os.Remove(orderbook.SidecarPath(path))
+	log.Printf("Deleted expired %s", path)
+}
+
+// dst 가 src 보다 나중에 만들어졌으면 true (src 가 그 뒤로 바뀌지 않았다)
+func upToDate(dst, src string) bool {
+	d, err := os.Stat(dst)
+	if err != nil {
+		return false
+	}
+	s, err := os.Stat(src)
+	return err == nil && !d.ModTime().Before(s.ModTime())
+}
+
+// src 의 스냅샷을 interval 마다 하나만 남겨 dst 에 쓴다. depth > 0 이면 호가도 그 단계까지만 남긴다.
+// 증분, 체결 등 다른 이벤트는 버린다.
+// 임시 파일에 쓰고 끝난 뒤 이름을 바꾸므로 중간에 실패해도 불완전한 사본이 남지 않는다.
+func downsampleFile(src, dst string, interval time.Duration, depth int) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return err
+	}
+	tmp := dst + ".tmp"
+	os.Remove(tmp)
+
+	var (
+		fw       *orderbook.FileWriter
+		lastKept int64 = -1
+		seq      uint64
+	)
+	sessionID := newSessionID()
+	r := orderbook.NewReader(in)
+	for {
+		ev, err := r.Next()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			continue
+		}
+		if ev.GetSnapshot() == nil {
+			continue
+		}
+		if lastKept >= 0 && ev.EventTime-lastKept < interval.Milliseconds() {
+			continue
+		}
+		if fw == nil {
+			h := &orderbook.FileHeader{CreatedAt: time.Now().UTC().UnixMilli(), Symbol: ev.Symbol, SessionId: sessionID}
+			if src := r.Header; src != nil {
+				h.Symbol, h.Exchange, h.MarketType = src.Symbol, src.Exchange, src.MarketType
+			}
+			if fw, err = orderbook.OpenFileWriter(tmp, h); err != nil {
+				return err
+			}
+		}
+		if s := ev.GetSnapshot(); depth > 0 {
+			s.Bids, s.Asks = s.Bids[:min(depth, len(s.Bids))], s.Asks[:min(depth, len(s.Asks))]
+		}
+		seq++
+		ev.Sequence = seq
+		if err := fw.Write(ev); err != nil {
+			fw.Close()
+			os.Remove(tmp)
+			return err
+		}
+		lastKept = ev.EventTime
+	}
+	if fw == nil {
+		return nil // 스냅샷이 없는 파일은 사본도 없다
+	}
+	if err := fw.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
+
+// 회전으로 닫힌 파일의 줄인 사본을 바로 만든다 (-downsample-on-rotate).
+// 시작할 때는 수집기가 멈춰 있던 사이 닫힌 파일(오늘 이전 날짜)의 빠진 사본부터 채운다.
+type archiver struct {
+	dataDir string
+	p       *retentionPolicy
+	queue   chan string
+	then    func(path string) // 사본을 만든 뒤 원본을 넘긴다 (업로드 등). nil 이어도 된다
+}
+
+func newArchiver(dataDir string, p *retentionPolicy, then func(path string)) *archiver {
+	return &archiver{dataDir: dataDir, p: p, queue: make(chan string, 1024), then: then}
+}
+
+// fm.onRotate 로 불린다. 막히지 않는다.
+func (a *archiver) enqueue(path string) {
+	select {
+	case a.queue <- path:
+	default:
+		// 다음 시작 때의 backfill 이나 보관 기간 만료 때 만들어진다
+		log.Printf("Archive queue full, skipping %s for now", path)
+		if a.then != nil {
+			a.then(path)
+		}
+	}
+}
+
+func (a *archiver) run() {
+	a.backfill(time.Now())
+	for path := range a.queue {
+		a.archive(path)
+		if a.then != nil {
+			a.then(path)
+		}
+	}
+}
+
+func (a *archiver) archive(path string) {
+	rel, err := filepath.Rel(a.dataDir, path)
+	if err != nil {
+		log.Printf("Archive: %v", err)
+		return
+	}
+	dst := filepath.Join(a.p.DownsampleDir, rel)
+	start := time.Now()
+	if err := downsampleFile(path, dst, a.p.Interval, a.p.Depth); err != nil {
+		log.Printf("Failed to archive %s: %v", path, err)
+		return
+	}
+	log.Printf("Archived %s -> %s in %s", path, dst, time.Since(start).Round(time.Millisecond))
+}
+
+func (a *archiver) backfill(now time.Time) {
+	entries, err := listDataFiles(a.dataDir)
+	if err != nil {
+		log.Printf("Archive backfill: %v", err)
+		return
+	}
+	today := now.UTC().Format(dateLayout)
+	for _, e := range entries {
+		// 오늘 파일은 아직 이어 쓰일 수 있다. 회전할 때 만든다
+		if e.Date == "" || e.Date >= today {
+			continue
+		}
+		path := filepath.Join(a.dataDir, filepath.FromSlash(e.Path))
+		if !upToDate(filepath.Join(a.p.DownsampleDir, filepath.FromSlash(e.Path)), path) {
+			a.archive(path)
+		}
+	}
+}
+
+// 수집기 안에서 every 마다 정책을 적용한다
+func runRetention(dataDir string, p *retentionPolicy, every time.Duration) {
+	for {
+		if err := p.apply(dataDir, time.Now(), false); err != nil {
+			log.Printf("Retention: %v", err)
+		}
+		time.Sleep(every)
+	}
+}
+
+func runPrune(args []string) error {
+	fs := flag.NewFlagSet("prune", flag.ExitOnError)
+	dataDir := fs.String("data", defaultDataDir, "data directory")
+	dryRun := fs.Bool("dry-run", false, "only list what would be deleted")
+	var policy retentionPolicy
+	policy.register(fs)
+	fs.Parse(args)
+	if err := policy.parse(); err != nil {
+		return err
+	}
+	if !policy.enabled() {
+		return fmt.Errorf("nothing to do: set -retain-raw and/or -retain-downsampled")
+	}
+	return policy.apply(*dataDir, time.Now(), *dryRun)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// 데이터 파일 회전 정책. UTC 일 단위(기본) 또는 시간 단위로 새 파일을 열고,
+// 크기 한도를 두면 한 구간 안에서도 파일이 한도를 넘을 때 다음 part 로 넘어간다.
+//
+// 파일 이름 템플릿 (데이터 디렉터리 기준):
+//
+//	{symbol}    소문자 심볼
+//	{date}      UTC 날짜 YYYY-MM-DD
+//	{hour}      UTC 시 HH (시간 단위 회전일 때 필수)
+//	{part}      구간 안의 순번 000, 001, ... (크기 한도가 있을 때 필수)
+//	{instance}  수집기 인스턴스 id (collect -instance 를 줄 때 필수). 기본 템플릿은 날짜(시) 바로 뒤에 @{instance}
+//
+// 리더는 <symbol>/<symbol>_<date>* 로 하루치 파일을 찾아 이름순으로 읽으므로, 템플릿은
+// {symbol}/{symbol}_{date} 로 시작해야 하고 그 뒤는 이름순이 시간순이 되게 써야 한다.
+//
+// 같은 구간 안에 재시작해 그 구간의 파일이 이미 있을 때 (collect -on-restart):
+//
+//	append   기존 파일 끝에 새 세션으로 이어 쓴다 (기본). 한 파일에 세션이 섞인다
+//	session  확장자 앞에 ~HHMMSS (세션 시작 UTC 시각)를 붙인 새 파일. {part} 가 있으면 기존 part 다음 번호부터
+//	part     다음 part 파일 ({part} 필요, 기본 템플릿이면 붙인다)
+//
+// 어느 쪽이든 이름순이 시간순이므로 리더와 카탈로그는 이 파일들을 이어서 하루로 본다.
+
+const (
+	rotateDaily  = "day"
+	rotateHourly = "hour"
+
+	templatePrefix = "{symbol}/{symbol}_{date}"
+
+	restartAppend  = "append"
+	restartSession = "session"
+	restartPart    = "part"
+
+	// 세션 파일 이름의 확장자 앞에 붙는 표시. '.' 보다 뒤에 정렬되므로 원래 파일 다음에 읽힌다.
+	sessionMark = "~"
+)
+
+// 인스턴스 id 는 파일 이름에 들어가므로 소문자, 숫자, - 만 쓴다 (fileInstance 가 @ 와 . ~ 로 잘라 읽는다)
+var instanceIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+type rotationPolicy struct {
+	Every     string // rotateDaily 또는 rotateHourly
+	MaxBytes  int64  // 0 이면 크기로 나누지 않는다
+	Template  string
+	Instance  string // 비어 있으면 이름에 인스턴스를 넣지 않는다
+	OnRestart string // restartAppend, restartSession, restartPart
+}
+
+func newRotationPolicy(every string, maxBytes int64, template, instance, onRestart string) (*rotationPolicy, error) {
+	if every != rotateDaily && every != rotateHourly {
+		return nil, fmt.Errorf("unknown rotation %q: use %s or %s", every, rotateDaily, rotateHourly)
+	}
+	if onRestart != restartAppend && onRestart != restartSession && onRestart != restartPart {
+		return nil, fmt.Errorf("unknown restart policy %q: use %s, %s or %s", onRestart, restartAppend, restartSession, restartPart)
+	}
+	if instance != "" && !instanceIDPattern.MatchString(instance) {
+		return nil, fmt.Errorf("invalid instance id %q: use lowercase letters, digits and -", instance)
+	}
+	if template == "" {
+		template = templatePrefix
+		if every == rotateHourly {
+			template += "T{hour}"
+		}
+		if instance != "" {
+			template += "@{instance}"
+		}
+		if maxBytes > 0 || onRestart == restartPart {
+			template += ".{part}"
+		}
+		template += ".bin"
+	}
+	switch {
+	case !strings.HasPrefix(template, templatePrefix) || strings.Contains(template[len(templatePrefix):], "/"):
+		return nil, fmt.Errorf("file template must start with %s and stay in the symbol directory", templatePrefix)
+	case every == rotateHourly && !strings.Contains(template, "{hour}"):
+		return nil, fmt.Errorf("hourly rotation needs {hour} in the file template")
+	case maxBytes > 0 && !strings.Contains(template, "{part}"):
+		return nil, fmt.Errorf("size-based rotation needs {part} in the file template")
+	case onRestart == restartPart && !strings.Contains(template, "{part}"):
+		return nil, fmt.Errorf("-on-restart %s needs {part} in the file template", restartPart)
+	case strings.Contains(template, sessionMark):
+		return nil, fmt.Errorf("the file template must not contain %q (reserved for session files)", sessionMark)
+	case instance != "" && !strings.Contains(template, "{instance}"):
+		return nil, fmt.Errorf("collectors with an instance id need {instance} in the file template")
+	case instance == "" && strings.Contains(template, "{instance}"):
+		return nil, fmt.Errorf("the file template uses {instance} but no instance id is set")
+	}
+	return &rotationPolicy{Every: every, MaxBytes: maxBytes, Template: template, Instance: instance, OnRestart: onRestart}, nil
+}
+
+// t 가 속한 회전 구간. 이 값이 바뀌면 새 파일을 연다.
+func (p *rotationPolicy) period(t time.Time) string {
+	if p.Every == rotateHourly {
+		return t.UTC().Format("2006-01-02T15")
+	}
+	return t.UTC().Format(dateLayout)
+}
+
+// session 이 있으면 확장자 앞에 ~session 을 붙인다
+func (p *rotationPolicy) path(dataDir, symbol string, t time.Time, part int, session string) string {
+	t = t.UTC()
+	name := strings.NewReplacer(
+		"{symbol}", strings.ToLower(symbol),
+		"{date}", t.Format(dateLayout),
+		"{hour}", t.Format("15"),
+		"{part}", fmt.Sprintf("%03d", part),
+		"{instance}", p.Instance,
+	).Replace(p.Template)
+	if session != "" {
+		ext := path.Ext(name)
+		name = strings.TrimSuffix(name, ext) + sessionMark + session + ext
+	}
+	return filepath.Join(dataDir, filepath.FromSlash(name))
+}
+
+// 구간 t 에 쓸 파일. 크기 한도가 있으면 한도에 닿지 않은 첫 part 를 고른다.
+// 그 파일이 이미 있으면 (같은 구간에 재시작) OnRestart 에 따라 이어 쓰거나 새 파일을 고른다.
+// session 은 새 세션 파일의 표시로, 이 구간의 다음 part 에도 같이 붙여야 한다.
+func (p *rotationPolicy) open(dataDir, symbol string, t time.Time) (file string, part int, session string) {
+	for {
+		file = p.path(dataDir, symbol, t, part, "")
+		fi, err := os.Stat(file)
+		if err != nil {
+			return file, part, ""
+		}
+		if p.MaxBytes <= 0 || fi.Size() < p.MaxBytes {
+			break
+		}
+		part++
+	}
+	if p.OnRestart == restartAppend {
+		return file, part, ""
+	}
+	// 기존 part 를 건너뛰어 새 파일이 이름순으로 뒤에 오게 한다
+	if strings.Contains(p.Template, "{part}") {
+		for {
+			if _, err := os.Stat(p.path(dataDir, symbol, t, part, "")); err != nil {
+				break
+			}
+			part++
+		}
+	}
+	if p.OnRestart == restartSession {
+		session = t.UTC().Format("150405")
+	}
+	return p.path(dataDir, symbol, t, part, session), part, session
+}
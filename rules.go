@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"orderbook/orderbook"
+)
+
+// 데이터 품질 규칙 (collect -rule, -rules). 수집 중인 스트림에서 심볼마다 값을 계산해 조건을 보고,
+// 조건이 for 동안 이어지면 -alert 로 알린다. 조건이 풀리면 resolved 를 보낸다 (같은 규칙, 같은 심볼은 -alert-repeat 에 한 번).
+//
+//	[심볼,...:] <값> <비교> <기준> [for <기간>]
+//
+//	-rule 'spread_bps > 50 for 10s'
+//	-rule 'btcusdt,ethusdt: unchanged > 60s'
+//	-rule 'levels < 20'
+//	-rules rules.txt                        한 줄에 규칙 하나. 빈 줄과 # 로 시작하는 줄은 건너뛴다
+//
+// 비교는 >, >=, <, <=, ==, != 이다. 값은 아래와 같고, 시간인 값(unchanged, silent)의 기준은 기간(60s, 5m)으로 쓴다.
+//
+//	bid, ask, mid, spread, spread_bps   최우선 호가 (스냅샷, bookTicker 에서)
+//	bid_qty, ask_qty, imbalance         최우선 호가 수량과 (bid_qty - ask_qty) / (bid_qty + ask_qty)
+//	levels                              마지막 스냅샷의 매수, 매도 호가 수 중 작은 것
+//	latency_ms                          마지막 이벤트의 거래소 시각 대비 수신 지연
+//	rate                                직전 1초의 메시지 수
+//	unchanged                           책(스냅샷의 lastUpdateId, 증분, bookTicker)이 마지막으로 바뀐 뒤 지난 시간
+//	silent                              마지막 메시지 뒤 지난 시간
+//
+// 아직 계산할 수 없는 값(책을 받기 전 등)의 조건은 거짓으로 본다. 규칙은 이벤트마다, 그리고 1초마다 다시 본다.
+// 메시지를 한 번도 받지 못한 심볼은 보지 않는다 (연결과 멈춘 심볼은 alert.go 가 알린다).
+
+type ruleMetric struct {
+	duration bool // 값이 시간(초)이고 기준을 기간으로 쓴다
+	value    func(s *ruleSymbol, now time.Time) (float64, bool)
+}
+
+var ruleMetrics = map[string]ruleMetric{
+	"bid":    {value: func(s *ruleSymbol, _ time.Time) (float64, bool) { return s.bid, s.hasTop }},
+	"ask":    {value: func(s *ruleSymbol, _ time.Time) (float64, bool) { return s.ask, s.hasTop }},
+	"mid":    {value: func(s *ruleSymbol, _ time.Time) (float64, bool) { return (s.bid + s.ask) / 2, s.hasTop }},
+	"spread": {value: func(s *ruleSymbol, _ time.Time) (float64, bool) { return s.ask - s.bid, s.hasTop }},
+	"spread_bps": {value: func(s *ruleSymbol, _ time.Time) (float64, bool) {
+		mid := (s.bid + s.ask) / 2
+		return (s.ask - s.bid) / mid * 1e4, s.hasTop && mid > 0
+	}},
+	"bid_qty": {value: func(s *ruleSymbol, _ time.Time) (float64, bool) { return s.bidQty, s.hasTop }},
+	"ask_qty": {value: func(s *ruleSymbol, _ time.Time) (float64, bool) { return s.askQty, s.hasTop }},
+	"imbalance": {value: func(s *ruleSymbol, _ time.Time) (float64, bool) {
+		total := s.bidQty + s.askQty
+		return (s.bidQty - s.askQty) / total, s.hasTop && total > 0
+	}},
+	"levels":     {value: func(s *ruleSymbol, _ time.Time) (float64, bool) { return float64(s.levels), s.hasLevels }},
+	"latency_ms": {value: func(s *ruleSymbol, _ time.Time) (float64, bool) { return s.latencyMs, s.hasLatency }},
+	"rate":       {value: func(s *ruleSymbol, _ time.Time) (float64, bool) { return s.rate, !s.rateAt.IsZero() }},
+	"unchanged": {duration: true, value: func(s *ruleSymbol, now time.Time) (float64, bool) {
+		return now.Sub(s.changedAt).Seconds(), !s.changedAt.IsZero()
+	}},
+	"silent": {duration: true, value: func(s *ruleSymbol, now time.Time) (float64, bool) {
+		return now.Sub(s.lastAt).Seconds(), true
+	}},
+}
+
+type rule struct {
+	text      string
+	symbols   []string // 비어 있으면 모든 심볼
+	metric    string
+	op        string
+	threshold float64
+	hold      time.Duration // for
+}
+
+func parseRule(text string) (*rule, error) {
+	r := &rule{text: strings.Join(strings.Fields(text), " ")}
+	body := r.text
+	if head, rest, ok := strings.Cut(body, ":"); ok {
+		r.symbols = splitList(strings.ToLower(head))
+		body = rest
+	}
+	f := strings.Fields(body)
+	if len(f) != 3 && !(len(f) == 5 && f[3] == "for") {
+		return nil, fmt.Errorf("rule %q: want [symbols:] <metric> <op> <value> [for <duration>]", text)
+	}
+	m, ok := ruleMetrics[f[0]]
+	if !ok {
+		names := make([]string, 0, len(ruleMetrics))
+		for name := range ruleMetrics {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		return nil, fmt.Errorf("rule %q: unknown value %q (%s)", text, f[0], strings.Join(names, ", "))
+	}
+	r.metric = f[0]
+	switch f[1] {
+	case ">", ">=", "<", "<=", "==", "!=":
+		r.op = f[1]
+	default:
+		return nil, fmt.Errorf("rule %q: unknown comparison %q", text, f[1])
+	}
+	if m.duration {
+		d, err := parseDuration(f[2])
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %s needs a duration (e.g. 60s): %w", text, r.metric, err)
+		}
+		r.threshold = d.Seconds()
+	} else {
+		v, err := strconv.ParseFloat(f[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: invalid value %q", text, f[2])
+		}
+		r.threshold = v
+	}
+	if len(f) == 5 {
+		d, err := parseDuration(f[4])
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("rule %q: invalid duration %q", text, f[4])
+		}
+		r.hold = d
+	}
+	return r, nil
+}
+
+// 규칙 파일을 읽는다. 빈 줄과 # 주석은 건너뛴다
+func loadRules(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var rules []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if line := strings.TrimSpace(sc.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			rules = append(rules, line)
+		}
+	}
+	return rules, sc.Err()
+}
+
+func (r *rule) applies(symbol string) bool {
+	return len(r.symbols) == 0 || slices.Contains(r.symbols, symbol)
+}
+
+func (r *rule) holds(v float64) bool {
+	switch r.op {
+	case ">":
+		return v > r.threshold
+	case ">=":
+		return v >= r.threshold
+	case "<":
+		return v < r.threshold
+	case "<=":
+		return v <= r.threshold
+	case "==":
+		return v == r.threshold
+	default:
+		return v != r.threshold
+	}
+}
+
+func (r *rule) format(v float64) string {
+	if ruleMetrics[r.metric].duration {
+		return (time.Duration(v * float64(time.Second))).Round(time.Second).String()
+	}
+	return strconv.FormatFloat(v, 'g', 6, 64)
+}
+
+// 규칙이 보는 심볼의 최근 값
+type ruleSymbol struct {
+	hasTop            bool
+	bid, ask          float64
+	bidQty, askQty    float64
+	hasLevels         bool
+	levels            int
+	hasLatency        bool
+	latencyMs         float64
+	lastUpdateID      int64
+	changedAt, lastAt time.Time
+	count             int // countStart 뒤로 받은 메시지 수
+	countStart        time.Time
+	rate              float64
+	rateAt            time.Time   // rate 를 마지막으로 계산한 시각. 0 이면 아직 없다
+	since             []time.Time // 규칙마다 조건이 참이 된 시각. 거짓이면 0
+}
+
+type ruleEngine struct {
+	rules   []*rule
+	alerter *alerter
+
+	mu      sync.Mutex
+	symbols map[string]*ruleSymbol
+}
+
+func newRuleEngine(rules []*rule, a *alerter) *ruleEngine {
+	return &ruleEngine{rules: rules, alerter: a, symbols: make(map[string]*ruleSymbol)}
+}
+
+// 수집기가 내보내는 이벤트마다 부른다
+func (e *ruleEngine) observe(symbol string, ev *orderbook.Event, now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	s, ok := e.symbols[symbol]
+	if !ok {
+		s = &ruleSymbol{since: make([]time.Time, len(e.rules)), countStart: now}
+		e.symbols[symbol] = s
+	}
+	s.lastAt = now
+	s.count++
+	if ev.ExchangeTime != 0 {
+		s.hasLatency, s.latencyMs = true, float64(ev.LatencyUs)/1000
+	}
+	switch pl := ev.Payload.(type) {
+	case *orderbook.Event_Snapshot:
+		snap := pl.Snapshot
+		s.hasLevels, s.levels = true, min(len(snap.Bids), len(snap.Asks))
+		if len(snap.Bids) > 0 && len(snap.Asks) > 0 {
+			s.hasTop = true
+			s.bid, s.bidQty = snap.Bids[0].Price, snap.Bids[0].Quantity
+			s.ask, s.askQty = snap.Asks[0].Price, snap.Asks[0].Quantity
+		}
+		if snap.LastUpdateId != s.lastUpdateID || s.changedAt.IsZero() {
+			s.lastUpdateID, s.changedAt = snap.LastUpdateId, now
+		}
+	case *orderbook.Event_DepthDiff:
+		s.changedAt = now
+	case *orderbook.Event_BookTicker:
+		t := pl.BookTicker
+		s.hasTop = true
+		s.bid, s.bidQty, s.ask, s.askQty = t.BidPrice, t.BidQuantity, t.AskPrice, t.AskQuantity
+		if t.UpdateId != s.lastUpdateID || s.changedAt.IsZero() {
+			s.lastUpdateID, s.changedAt = t.UpdateId, now
+		}
+	}
+	e.evaluate(symbol, s, now)
+}
+
+// 1초마다 부른다. 이벤트가 없어도 시간이 지나면 참이 되는 규칙(unchanged, silent, for)을 본다
+func (e *ruleEngine) tick(now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for symbol, s := range e.symbols {
+		if elapsed := now.Sub(s.countStart); elapsed >= time.Second {
+			s.rate, s.rateAt = float64(s.count)/elapsed.Seconds(), now
+			s.count, s.countStart = 0, now
+		}
+		e.evaluate(symbol, s, now)
+	}
+}
+
+// e.mu 를 잡은 상태에서 호출해야 한다
+func (e *ruleEngine) evaluate(symbol string, s *ruleSymbol, now time.Time) {
+	for i, r := range e.rules {
+		if !r.applies(symbol) {
+			continue
+		}
+		v, ok := ruleMetrics[r.metric].value(s, now)
+		if !ok || !r.holds(v) {
+			if !s.since[i].IsZero() {
+				s.since[i] = time.Time{}
+				msg := r.metric + " is unknown"
+				if ok {
+					msg = fmt.Sprintf("%s is %s", r.metric, r.format(v))
+				}
+				e.alerter.resolveRule(r.text, symbol, msg)
+			}
+			continue
+		}
+		if s.since[i].IsZero() {
+			s.since[i] = now
+		}
+		if held := now.Sub(s.since[i]); held >= r.hold {
+			msg := fmt.Sprintf("%s is %s", r.metric, r.format(v))
+			if r.hold > 0 {
+				msg += fmt.Sprintf(" for %s", held.Round(time.Second))
+			}
+			e.alerter.raiseRule(r.text, symbol, msg)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+
+	"orderbook/orderbook"
+)
+
+// path 에서 수신 시간이 [from, to) 인 이벤트를 순서대로 fn 에 넘긴다.
+// 블록 인덱스(footer 또는 사이드카)가 있으면 from 직전 블록으로 바로 이동한다. p 는 nil 이어도 된다.
+func scanFile(ctx context.Context, path string, from, to int64, p *Progress, fn func(r *orderbook.Reader, ev *orderbook.Event) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var src io.Reader = f
+	if p != nil {
+		src = p.Reader(f)
+	}
+	r := orderbook.NewReader(src)
+	if idx, err := orderbook.LoadIndex(f); err == nil && idx != nil {
+		if i := idx.Search(from); i > 0 {
+			e := idx.Entries[i-1]
+			if r, err = orderbook.OpenBlock(seekableSource{f, src}, e); err != nil {
+				return err
+			}
+			if p != nil {
+				p.Add(e.Offset) // 건너뛴 부분도 처리한 것으로 본다
+			}
+		}
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		ev, err := r.Next()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			log.Printf("%s: skipping unreadable record: %v", path, err)
+			continue
+		}
+		if ev.EventTime < from {
+			continue
+		}
+		if ev.EventTime >= to {
+			return nil
+		}
+		if err := fn(r, ev); err != nil {
+			return err
+		}
+	}
+}
+
+// Seek 은 파일에, Read 는 진행률을 세는 쪽으로 보낸다
+type seekableSource struct {
+	f *os.File
+	r io.Reader
+}
+
+func (s seekableSource) Read(b []byte) (int, error) { return s.r.Read(b) }
+
+func (s seekableSource) Seek(off int64, whence int) (int64, error) { return s.f.Seek(off, whence) }
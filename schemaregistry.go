@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"orderbook/orderbook"
+)
+
+// 브로커 싱크로 protobuf 를 보낼 때 스키마 레지스트리(Confluent 또는 Buf 의 Confluent 호환 API)에
+// orderbook.proto 를 등록하고, 메시지 앞에 스키마 ID 를 붙이는 Confluent 와이어 포맷으로 직렬화한다.
+// Avro 는 orderbook.avsc 를 등록하고 message indexes 없이 붙인다.
+//
+//	[0x00][schema id u32 BE][message indexes (zigzag varint)][protobuf]
+//	[0x00][schema id u32 BE][avro]
+
+//go:embed orderbook.proto
+var orderbookProtoSource string
+
+type schemaRegistryConfig struct {
+	URL      string
+	Username string // basic auth (Confluent Cloud API key 등)
+	Password string
+	Token    string // bearer token (Buf BSR 등)
+}
+
+func (c *schemaRegistryConfig) register(fs *flag.FlagSet) {
+	fs.StringVar(&c.URL, "registry", os.Getenv("SCHEMA_REGISTRY_URL"), "schema registry base URL (default $SCHEMA_REGISTRY_URL)")
+	fs.StringVar(&c.Username, "registry-user", os.Getenv("SCHEMA_REGISTRY_USER"), "schema registry basic auth user")
+	fs.StringVar(&c.Password, "registry-password", os.Getenv("SCHEMA_REGISTRY_PASSWORD"), "schema registry basic auth password")
+	fs.StringVar(&c.Token, "registry-token", os.Getenv("SCHEMA_REGISTRY_TOKEN"), "schema registry bearer token")
+}
+
+type schemaRegistry struct {
+	cfg    schemaRegistryConfig
+	client *http.Client
+}
+
+func newSchemaRegistry(cfg schemaRegistryConfig) *schemaRegistry {
+	return &schemaRegistry{cfg: cfg, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+type registryError struct {
+	Status  int    `json:"-"`
+	Code    int    `json:"error_code"`
+	Message string `json:"message"`
+}
+
+func (e *registryError) Error() string {
+	return fmt.Sprintf("schema registry: %s (%d)", e.Message, e.Code)
+}
+
+func (r *schemaRegistry) do(method, path string, body, out any) error {
+	var rd io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		rd = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, strings.TrimRight(r.cfg.URL, "/")+path, rd)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+	req.Header.Set("Accept", "application/vnd.schemaregistry.v1+json")
+	switch {
+	case r.cfg.Token != "":
+		req.Header.Set("Authorization", "Bearer "+r.cfg.Token)
+	case r.cfg.Username != "":
+		req.SetBasicAuth(r.cfg.Username, r.cfg.Password)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		regErr := &registryError{Status: resp.StatusCode, Code: resp.StatusCode, Message: strings.TrimSpace(string(data))}
+		json.Unmarshal(data, regErr)
+		return regErr
+	}
+	return json.Unmarshal(data, out)
+}
+
+type registrySchema struct {
+	Schema     string `json:"schema"`
+	SchemaType string `json:"schemaType"`
+}
+
+// 최신 버전과 호환되는지 먼저 확인한 뒤 등록한다. 같은 스키마가 이미 있으면 기존 ID 가 돌아온다.
+// schemaType 은 PROTOBUF 또는 AVRO.
+func (r *schemaRegistry) registerSchema(subject, schemaType, source string) (int, error) {
+	schema := registrySchema{Schema: source, SchemaType: schemaType}
+	subjectPath := "/subjects/" + url.PathEscape(subject)
+
+	var compat struct {
+		IsCompatible bool `json:"is_compatible"`
+	}
+	err := r.do(http.MethodPost, "/compatibility"+subjectPath+"/versions/latest", schema, &compat)
+	var regErr *registryError
+	switch {
+	case errors.As(err, &regErr) && regErr.Status == http.StatusNotFound:
+		// 아직 등록된 적 없는 subject
+	case err != nil:
+		return 0, err
+	case !compat.IsCompatible:
+		return 0, fmt.Errorf("schema for subject %s is not compatible with the registered version", subject)
+	}
+
+	var res struct {
+		ID int `json:"id"`
+	}
+	if err := r.do(http.MethodPost, subjectPath+"/versions", schema, &res); err != nil {
+		return 0, err
+	}
+	return res.ID, nil
+}
+
+// 레지스트리에 등록된 스키마 ID 를 메시지 앞에 붙여 직렬화한다
+type registrySerializer struct {
+	schemaID int
+	indexes  map[protoreflect.FullName][]byte // 메시지 타입별 message-indexes 인코딩
+}
+
+// orderbook.proto 를 subject 에 등록하고 serializer 를 만든다
+func newRegistrySerializer(cfg schemaRegistryConfig, subject string) (*registrySerializer, error) {
+	id, err := newSchemaRegistry(cfg).registerSchema(subject, "PROTOBUF", orderbookProtoSource)
+	if err != nil {
+		return nil, err
+	}
+	s := &registrySerializer{schemaID: id, indexes: make(map[protoreflect.FullName][]byte)}
+	msgs := orderbook.File_orderbook_proto.Messages()
+	for i := 0; i < msgs.Len(); i++ {
+		// 최상위 메시지만 있으므로 경로는 [i]. [0] 은 관례상 0 한 바이트로 줄여 쓴다.
+		var idx []byte
+		if i == 0 {
+			idx = []byte{0}
+		} else {
+			idx = binary.AppendVarint(binary.AppendVarint(nil, 1), int64(i))
+		}
+		s.indexes[msgs.Get(i).FullName()] = idx
+	}
+	return s, nil
+}
+
+func (s *registrySerializer) Serialize(m proto.Message) ([]byte, error) {
+	idx, ok := s.indexes[m.ProtoReflect().Descriptor().FullName()]
+	if !ok {
+		return nil, fmt.Errorf("message %s is not part of the registered schema", m.ProtoReflect().Descriptor().FullName())
+	}
+	buf := make([]byte, 5, 5+len(idx)+proto.Size(m))
+	binary.BigEndian.PutUint32(buf[1:5], uint32(s.schemaID))
+	buf = append(buf, idx...)
+	return proto.MarshalOptions{}.MarshalAppend(buf, m)
+}
+
+// orderbook.avsc 로 등록한 Avro 직렬화
+type avroRegistrySerializer struct {
+	schemaID int
+}
+
+func newAvroRegistrySerializer(cfg schemaRegistryConfig, subject string) (*avroRegistrySerializer, error) {
+	id, err := newSchemaRegistry(cfg).registerSchema(subject, "AVRO", orderbookAvroSchema)
+	if err != nil {
+		return nil, err
+	}
+	return &avroRegistrySerializer{schemaID: id}, nil
+}
+
+func (s *avroRegistrySerializer) Serialize(ev *orderbook.Event) []byte {
+	buf := make([]byte, 5, 256)
+	binary.BigEndian.PutUint32(buf[1:5], uint32(s.schemaID))
+	return appendAvroEvent(buf, ev)
+}
+
+// Confluent 와이어 포맷 메시지에서 스키마 ID 와 protobuf 본문을 꺼낸다
+func parseRegistryFrame(b []byte) (schemaID int, payload []byte, err error) {
+	if len(b) < 6 || b[0] != 0 {
+		return 0, nil, errors.New("not a schema registry framed message")
+	}
+	schemaID = int(binary.BigEndian.Uint32(b[1:5]))
+	rest := b[5:]
+	count, n := binary.Varint(rest)
+	if n <= 0 {
+		return 0, nil, errors.New("bad message index header")
+	}
+	rest = rest[n:]
+	for range count {
+		if _, n = binary.Varint(rest); n <= 0 {
+			return 0, nil, errors.New("bad message index")
+		}
+		rest = rest[n:]
+	}
+	return schemaID, rest, nil
+}
+
+// orderbook schema register -subject <topic>-value : 싱크를 띄우기 전에 수동으로 등록할 때
+func runSchema(args []string) error {
+	if len(args) == 0 || args[0] != "register" {
+		return fmt.Errorf("usage: orderbook schema register -registry <url> -subject <subject> [-format proto|avro]")
+	}
+	fs := flag.NewFlagSet("schema register", flag.ExitOnError)
+	var cfg schemaRegistryConfig
+	cfg.register(fs)
+	subject := fs.String("subject", "orderbook-events-value", "subject to register the schema under")
+	format := fs.String("format", "proto", "schema to register: proto (orderbook.proto) or avro (orderbook.avsc)")
+	fs.Parse(args[1:])
+	if cfg.URL == "" {
+		return fmt.Errorf("-registry is required")
+	}
+	schemaType, source := "PROTOBUF", orderbookProtoSource
+	switch *format {
+	case "proto":
+	case "avro":
+		schemaType, source = "AVRO", orderbookAvroSchema
+	default:
+		return fmt.Errorf("unknown schema format %q (use proto or avro)", *format)
+	}
+
+	id, err := newSchemaRegistry(cfg).registerSchema(*subject, schemaType, source)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("registered %s: schema id %d\n", *subject, id)
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"orderbook/orderbook"
+)
+
+// 파일 외의 출력(브로커, DB 등)으로 이벤트를 내보내는 싱크.
+// 싱크는 URL 로 지정하고(kafka://..., nats://...), scheme 별 구현이 init 에서 registerSink 로 등록된다.
+type Sink interface {
+	Publish(ev *orderbook.Event) error
+	Close() error
+}
+
+var sinkFactories = map[string]func(u *url.URL) (Sink, error){}
+
+func registerSink(scheme string, open func(u *url.URL) (Sink, error)) {
+	sinkFactories[scheme] = open
+}
+
+func openSink(spec string) (Sink, error) {
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("sink %q: %w", spec, err)
+	}
+	open, ok := sinkFactories[u.Scheme]
+	if !ok {
+		return nil, fmt.Errorf("unknown sink type %q (available: %s)", u.Scheme, strings.Join(sinkSchemes(), ", "))
+	}
+	return open(u)
+}
+
+// 로그와 체크포인트에 남기는 싱크 이름. URL 의 비밀번호는 가린다.
+func sinkName(spec string) string {
+	if u, err := url.Parse(spec); err == nil {
+		return u.Redacted()
+	}
+	return spec
+}
+
+func sinkSchemes() []string {
+	var schemes []string
+	for s := range sinkFactories {
+		schemes = append(schemes, s)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// publish 명령으로 기록된 파일을 재생하는 중이면 true. 브로커 싱크는 메시지에 replay 표시를 단다.
+var replaying bool
+
+// 브로커 메시지 헤더에 싣는 원래 타임스탬프. 재생(replay)한 메시지도 수신 당시 시각을 그대로 갖는다.
+func eventHeaders(ev *orderbook.Event, replay bool) map[string]string {
+	h := map[string]string{
+		"symbol":          ev.Symbol,
+		"stream-type":     ev.StreamType,
+		"event-time":      strconv.FormatInt(ev.EventTime, 10),
+		"receive-time-ns": strconv.FormatInt(ev.ReceiveTimeNs, 10),
+		"sequence":        strconv.FormatUint(ev.Sequence, 10),
+	}
+	if ev.ExchangeTime != 0 {
+		h["exchange-time"] = strconv.FormatInt(ev.ExchangeTime, 10)
+	}
+	if replay {
+		h["replay"] = "true"
+	}
+	return h
+}
+
+func init() {
+	registerSink("stdout", openStdoutSink)
+}
+
+// stdout:// 이벤트를 JSON 한 줄씩 표준 출력으로 (디버깅, 파이프 연결용)
+type stdoutSink struct {
+	mu sync.Mutex
+	w  *bufio.Writer
+}
+
+func openStdoutSink(u *url.URL) (Sink, error) {
+	return &stdoutSink{w: bufio.NewWriter(os.Stdout)}, nil
+}
+
+func (s *stdoutSink) Publish(ev *orderbook.Event) error {
+	b, err := protojson.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.w.Write(b)
+	return s.w.WriteByte('\n')
+}
+
+func (s *stdoutSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Flush()
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"orderbook/orderbook"
+)
+
+// orderbook stats <file|symbol|date>... : 데이터 품질을 빠르게 훑어본다.
+//
+//	stats data/ethusdt/ethusdt_2026-04-13.bin    그 파일
+//	stats ethusdt                                 그 심볼의 모든 파일 (-from/-to 나 -day 로 좁힐 수 있다)
+//	stats 2026-04-13                              그 날짜의 모든 심볼 (심볼마다 따로)
+//
+// 인자마다 레코드 수(종류별), 시간 범위, 스냅샷 사이 간격의 최소/최대/평균과 가장 큰 간격의 위치,
+// 파일 크기, 압축률(비압축 프레임으로 쓴다면의 크기 / 실제 크기)을 출력한다. 여러 파일이면 합쳐서 보고,
+// 간격은 파일 경계를 넘어서도 잰다.
+
+func runStats(args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	dataDir := fs.String("data", defaultDataDir, "data directory for symbol and date arguments")
+	var rng rangeFlags
+	rng.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: orderbook stats [flags] <file|symbol|date>...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("nothing to report on")
+	}
+
+	from, to := int64(math.MinInt64), int64(math.MaxInt64)
+	if rng.from != "" || rng.to != "" || rng.day != "" {
+		var err error
+		if from, to, err = rng.resolve(); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+	for _, arg := range fs.Args() {
+		groups, err := statsTargets(*dataDir, arg, from, to)
+		if err != nil {
+			return err
+		}
+		for _, g := range groups {
+			st := &fileStats{counts: make(map[string]int64), minGap: math.MaxInt64}
+			for _, f := range g.files {
+				if err := st.scan(ctx, f, from, to); err != nil {
+					return err
+				}
+			}
+			st.print(os.Stdout, g.name)
+		}
+	}
+	return nil
+}
+
+type statsGroup struct {
+	name  string
+	files []string
+}
+
+// 인자를 파일 묶음으로 바꾼다. 있는 파일 경로, 날짜(YYYY-MM-DD), 심볼 순으로 본다.
+func statsTargets(dataDir, arg string, from, to int64) ([]statsGroup, error) {
+	if fi, err := os.Stat(arg); err == nil && fi.Mode().IsRegular() {
+		return []statsGroup{{name: arg, files: []string{arg}}}, nil
+	}
+	if _, err := time.Parse(dateLayout, arg); err == nil {
+		entries, err := listDataFiles(dataDir)
+		if err != nil {
+			return nil, err
+		}
+		var groups []statsGroup
+		for _, e := range entries {
+			if e.Date != arg {
+				continue
+			}
+			if len(groups) == 0 || groups[len(groups)-1].name != e.Symbol+" "+arg {
+				groups = append(groups, statsGroup{name: e.Symbol + " " + arg})
+			}
+			g := &groups[len(groups)-1]
+			g.files = append(g.files, filepath.Join(dataDir, filepath.FromSlash(e.Path)))
+		}
+		if len(groups) == 0 {
+			return nil, fmt.Errorf("no data files for %s in %s", arg, dataDir)
+		}
+		return groups, nil
+	}
+
+	symbol := strings.ToLower(arg)
+	var files []string
+	if from == math.MinInt64 && to == math.MaxInt64 {
+		entries, err := listDataFiles(dataDir)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if e.Symbol == symbol {
+				files = append(files, filepath.Join(dataDir, filepath.FromSlash(e.Path)))
+			}
+		}
+	} else {
+		for _, f := range dataFilesInRange(dataDir, symbol, from, to) {
+			files = append(files, f.path)
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s is not a file, date or symbol with data in %s", arg, dataDir)
+	}
+	return []statsGroup{{name: symbol, files: files}}, nil
+}
+
+type fileStats struct {
+	files   int
+	size    int64
+	rawSize int64 // 비압축 프레임으로 썼을 때의 크기
+	records int64
+	counts  map[string]int64 // 종류별 레코드 수
+
+	first, last int64
+
+	snapshots              int64
+	lastSnapshot           int64
+	minGap, maxGap, gapSum int64
+	maxGapAt               int64 // 가장 큰 간격이 시작된 스냅샷 시각
+}
+
+func (st *fileStats) scan(ctx context.Context, path string, from, to int64) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	st.files++
+	st.size += fi.Size()
+	return scanFile(ctx, path, from, to, nil, func(r *orderbook.Reader, ev *orderbook.Event) error {
+		if st.records == 0 {
+			st.first = ev.EventTime
+		}
+		st.last = ev.EventTime
+		st.records++
+		st.rawSize += int64(4 + proto.Size(ev))
+		st.counts[orderbook.PayloadKind(ev)]++
+
+		if ev.GetSnapshot() == nil {
+			return nil
+		}
+		if st.snapshots > 0 {
+			gap := ev.EventTime - st.lastSnapshot
+			st.minGap = min(st.minGap, gap)
+			if gap > st.maxGap {
+				st.maxGap, st.maxGapAt = gap, st.lastSnapshot
+			}
+			st.gapSum += gap
+		}
+		st.snapshots++
+		st.lastSnapshot = ev.EventTime
+		return nil
+	})
+}
+
+func (st *fileStats) print(w io.Writer, name string) {
+	fmt.Fprintf(w, "%s\n", name)
+	fmt.Fprintf(w, "  files          %d\n", st.files)
+	fmt.Fprintf(w, "  size           %s", formatBytes(st.size))
+	if st.size > 0 && st.rawSize > 0 {
+		fmt.Fprintf(w, " (compression ratio %.2fx)", float64(st.rawSize)/float64(st.size))
+	}
+	fmt.Fprintln(w)
+	kinds := make([]string, 0, len(st.counts))
+	for k := range st.counts {
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+	parts := make([]string, len(kinds))
+	for i, k := range kinds {
+		parts[i] = fmt.Sprintf("%s %d", k, st.counts[k])
+	}
+	fmt.Fprintf(w, "  records        %d", st.records)
+	if len(parts) > 0 {
+		fmt.Fprintf(w, " (%s)", strings.Join(parts, ", "))
+	}
+	fmt.Fprintln(w)
+	if st.records == 0 {
+		fmt.Fprintln(w)
+		return
+	}
+	fmt.Fprintf(w, "  span           %s .. %s (%s)\n", formatMillis(st.first), formatMillis(st.last), time.Duration(st.last-st.first)*time.Millisecond)
+	if st.snapshots > 1 {
+		n := st.snapshots - 1
+		fmt.Fprintf(w, "  snapshot gap   min %s, mean %s, max %s\n",
+			time.Duration(st.minGap)*time.Millisecond, time.Duration(st.gapSum/n)*time.Millisecond, time.Duration(st.maxGap)*time.Millisecond)
+		fmt.Fprintf(w, "  largest gap    %s .. %s\n", formatMillis(st.maxGapAt), formatMillis(st.maxGapAt+st.maxGap))
+	}
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,492 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"orderbook/orderbook"
+)
+
+// "e"(이벤트 종류)는 쓰지 않지만 필드로 두어야 한다. 없으면 encoding/json 이 대소문자를 무시하고 "E" 필드에 맞춰 실패한다.
+
+// Partial Depth Stream 응답 구조체 (스냅샷). 선물은 증분과 같은 모양(u, b, a)으로 온다.
+type SnapshotEvent struct {
+	EventType     string      `json:"e"` // 선물만
+	EventTime     int64       `json:"E"` // 선물만
+	LastUpdateID  int64       `json:"lastUpdateId"`
+	Bids          [][2]string `json:"bids"`
+	Asks          [][2]string `json:"asks"`
+	FirstUpdateID int64       `json:"U"` // 선물만
+	FinalUpdateID int64       `json:"u"` // 선물만. lastUpdateId 로 쓴다
+	FuturesBids   [][2]string `json:"b"`
+	FuturesAsks   [][2]string `json:"a"`
+}
+
+// Diff Depth Stream 응답 구조체 (<symbol>@depth)
+type DepthUpdateEvent struct {
+	EventType     string      `json:"e"`
+	EventTime     int64       `json:"E"`
+	FirstUpdateID int64       `json:"U"`
+	FinalUpdateID int64       `json:"u"`
+	PrevUpdateID  int64       `json:"pu"`
+	Bids          [][2]string `json:"b"`
+	Asks          [][2]string `json:"a"`
+}
+
+// Trade Stream 응답 구조체 (<symbol>@trade)
+type TradeEvent struct {
+	EventType    string `json:"e"`
+	EventTime    int64  `json:"E"`
+	TradeID      int64  `json:"t"`
+	Price        string `json:"p"`
+	Quantity     string `json:"q"`
+	TradeTime    int64  `json:"T"`
+	BuyerIsMaker bool   `json:"m"`
+}
+
+// Liquidation Order Stream 응답 구조체 (선물 <symbol>@forceOrder)
+type ForceOrderEvent struct {
+	EventType string `json:"e"`
+	EventTime int64  `json:"E"`
+	Order     struct {
+		Symbol         string `json:"s"`
+		Side           string `json:"S"`
+		OrderType      string `json:"o"`
+		TimeInForce    string `json:"f"`
+		Quantity       string `json:"q"`
+		Price          string `json:"p"`
+		AveragePrice   string `json:"ap"`
+		Status         string `json:"X"`
+		LastFilled     string `json:"l"`
+		FilledQuantity string `json:"z"`
+		TradeTime      int64  `json:"T"`
+	} `json:"o"`
+}
+
+// 24시간 통계 응답 구조체 (<symbol>@ticker, <symbol>@miniTicker, 시장 전체 스트림은 이것의 배열).
+// miniTicker 에는 s, c, o, h, l, v, q 만 온다.
+type TickerEvent struct {
+	EventType          string `json:"e"`
+	EventTime          int64  `json:"E"`
+	Symbol             string `json:"s"`
+	PriceChange        string `json:"p"`
+	PriceChangePercent string `json:"P"`
+	WeightedAvgPrice   string `json:"w"`
+	LastPrice          string `json:"c"`
+	LastQuantity       string `json:"Q"`
+	OpenPrice          string `json:"o"`
+	HighPrice          string `json:"h"`
+	LowPrice           string `json:"l"`
+	Volume             string `json:"v"`
+	QuoteVolume        string `json:"q"`
+	OpenTime           int64  `json:"O"`
+	CloseTime          int64  `json:"C"`
+	FirstTradeID       int64  `json:"F"`
+	LastTradeID        int64  `json:"L"`
+	TradeCount         int64  `json:"n"`
+}
+
+func (t *TickerEvent) payload() *orderbook.Event_Ticker {
+	return &orderbook.Event_Ticker{Ticker: &orderbook.Ticker{
+		LastPrice:          parseFloat(t.LastPrice),
+		OpenPrice:          parseFloat(t.OpenPrice),
+		HighPrice:          parseFloat(t.HighPrice),
+		LowPrice:           parseFloat(t.LowPrice),
+		Volume:             parseFloat(t.Volume),
+		QuoteVolume:        parseFloat(t.QuoteVolume),
+		PriceChange:        parseFloat(t.PriceChange),
+		PriceChangePercent: parseFloat(t.PriceChangePercent),
+		WeightedAvgPrice:   parseFloat(t.WeightedAvgPrice),
+		LastQuantity:       parseFloat(t.LastQuantity),
+		OpenTime:           t.OpenTime,
+		CloseTime:          t.CloseTime,
+		FirstTradeId:       t.FirstTradeID,
+		LastTradeId:        t.LastTradeID,
+		TradeCount:         t.TradeCount,
+	}}
+}
+
+// Book Ticker Stream 응답 구조체 (<symbol>@bookTicker)
+type BookTickerEvent struct {
+	EventType   string `json:"e"` // 선물만
+	EventTime   int64  `json:"E"` // 선물만
+	UpdateID    int64  `json:"u"`
+	BidPrice    string `json:"b"`
+	BidQuantity string `json:"B"`
+	AskPrice    string `json:"a"`
+	AskQuantity string `json:"A"`
+}
+
+// encoding/json 으로 되돌아갈 때(decodeSnapshotJSON 등) 호가 배열을 푸는 중간 구조체는 메시지마다 새로 만들지 않고 재사용한다. json 은 슬라이스의 backing 을
+// 그대로 채우고 문자열은 새로 만들므로, 만든 이벤트가 중간 구조체를 참조하지 않는다.
+var (
+	snapshotEventPool = sync.Pool{New: func() any { return new(SnapshotEvent) }}
+	depthUpdatePool   = sync.Pool{New: func() any { return new(DepthUpdateEvent) }}
+)
+
+// true 면 가격/수량의 원래 문자열도 *_text 필드에 남긴다 (collect -keep-decimals).
+// 파일이 커지는 대신 double 로 바꾸며 잃는 표기(뒷자리 0 등)를 그대로 보존한다.
+var keepDecimalText bool
+
+// 스트림 이름(<symbol>@<type>)과 data 를 받아 Event 로 변환한다.
+// received 는 메시지를 읽은 직후의 로컬 시간. data 는 붙잡지 않으므로 호출한 쪽이 다시 써도 된다.
+func parseStreamEvent(stream string, data json.RawMessage, received time.Time) (*orderbook.Event, error) {
+	symbol, streamType, _ := strings.Cut(stream, "@")
+	receiveTime := received.UnixMilli()
+	ev := &orderbook.Event{
+		EventTime:     receiveTime,
+		ReceiveTimeNs: received.UnixNano(),
+		Symbol:        upperSymbol(symbol),
+		Exchange:      exchangeName,
+		MarketType:    marketType,
+		StreamType:    streamType,
+	}
+
+	switch kind := streamKind(streamType); kind {
+	case "snapshot":
+		snapshot, exchangeTime, err := parseSnapshotJSON(data)
+		if err != nil {
+			if snapshot, exchangeTime, err = decodeSnapshotJSON(data); err != nil {
+				return nil, err
+			}
+		}
+		ev.ExchangeTime = exchangeTime
+		snapshot.EventTime = receiveTime // 스트림에 타임스탬프가 없으므로 수신 시간 사용
+		ev.Payload = &orderbook.Event_Snapshot{Snapshot: snapshot}
+	case "diff":
+		diff, exchangeTime, err := parseDiffJSON(data)
+		if err != nil {
+			if diff, exchangeTime, err = decodeDiffJSON(data); err != nil {
+				return nil, err
+			}
+		}
+		ev.ExchangeTime = exchangeTime
+		ev.Payload = &orderbook.Event_DepthDiff{DepthDiff: diff}
+	case "trade":
+		var t TradeEvent
+		if err := json.Unmarshal(data, &t); err != nil {
+			return nil, err
+		}
+		ev.ExchangeTime = t.EventTime
+		trade := &orderbook.Trade{
+			TradeId:      t.TradeID,
+			Price:        parseFloat(t.Price),
+			Quantity:     parseFloat(t.Quantity),
+			TradeTime:    t.TradeTime,
+			BuyerIsMaker: t.BuyerIsMaker,
+		}
+		if keepDecimalText {
+			trade.PriceText, trade.QuantityText = t.Price, t.Quantity
+		}
+		ev.Payload = &orderbook.Event_Trade{Trade: trade}
+	case "bookTicker":
+		var bt BookTickerEvent
+		if err := json.Unmarshal(data, &bt); err != nil {
+			return nil, err
+		}
+		ev.ExchangeTime = bt.EventTime
+		ticker := &orderbook.BookTicker{
+			UpdateId:    bt.UpdateID,
+			BidPrice:    parseFloat(bt.BidPrice),
+			BidQuantity: parseFloat(bt.BidQuantity),
+			AskPrice:    parseFloat(bt.AskPrice),
+			AskQuantity: parseFloat(bt.AskQuantity),
+		}
+		if keepDecimalText {
+			ticker.BidPriceText, ticker.BidQuantityText = bt.BidPrice, bt.BidQuantity
+			ticker.AskPriceText, ticker.AskQuantityText = bt.AskPrice, bt.AskQuantity
+		}
+		ev.Payload = &orderbook.Event_BookTicker{BookTicker: ticker}
+	case "forceOrder":
+		var f ForceOrderEvent
+		if err := json.Unmarshal(data, &f); err != nil {
+			return nil, err
+		}
+		ev.ExchangeTime = f.EventTime
+		o := f.Order
+		liq := &orderbook.Liquidation{
+			Side:               o.Side,
+			OrderType:          o.OrderType,
+			TimeInForce:        o.TimeInForce,
+			Price:              parseFloat(o.Price),
+			AveragePrice:       parseFloat(o.AveragePrice),
+			Quantity:           parseFloat(o.Quantity),
+			LastFilledQuantity: parseFloat(o.LastFilled),
+			FilledQuantity:     parseFloat(o.FilledQuantity),
+			Status:             o.Status,
+			TradeTime:          o.TradeTime,
+		}
+		if keepDecimalText {
+			liq.PriceText, liq.AveragePriceText, liq.QuantityText = o.Price, o.AveragePrice, o.Quantity
+			liq.LastFilledQuantityText, liq.FilledQuantityText = o.LastFilled, o.FilledQuantity
+		}
+		ev.Payload = &orderbook.Event_Liquidation{Liquidation: liq}
+	case "ticker", "miniTicker":
+		var t TickerEvent
+		if err := json.Unmarshal(data, &t); err != nil {
+			return nil, err
+		}
+		ev.ExchangeTime = t.EventTime
+		ev.Payload = t.payload()
+	default:
+		// 전용 payload 가 없는 스트림(aggTrade, kline 등)은 원래 JSON 을 Record 로 담아 그대로 남긴다
+		if !json.Valid(data) {
+			return nil, fmt.Errorf("stream %s: invalid JSON", stream)
+		}
+		var common struct {
+			EventTime int64 `json:"E"`
+		}
+		json.Unmarshal(data, &common)
+		ev.ExchangeTime = common.EventTime
+		ev.Payload = &orderbook.Event_Record{Record: &orderbook.Record{
+			Type:     exchangeName + "." + kind,
+			Encoding: "json",
+			Data:     bytes.Clone(data),
+		}}
+	}
+	if ev.ExchangeTime != 0 {
+		ev.LatencyUs = (ev.ReceiveTimeNs - ev.ExchangeTime*int64(time.Millisecond)) / int64(time.Microsecond)
+	}
+	return ev, nil
+}
+
+// 시장 전체 스트림(!miniTicker@arr, !ticker@arr)의 data 는 심볼마다 하나씩인 통계의 배열이다.
+// 심볼별 이벤트로 나누고 stream_type 에는 시장 스트림 이름을 그대로 남긴다. 순번은 부르는 쪽이 매긴다.
+func parseMarketTickers(stream string, data json.RawMessage, received time.Time) ([]*orderbook.Event, error) {
+	var tickers []TickerEvent
+	if err := json.Unmarshal(data, &tickers); err != nil {
+		return nil, err
+	}
+	events := make([]*orderbook.Event, 0, len(tickers))
+	for i := range tickers {
+		t := &tickers[i]
+		if t.Symbol == "" {
+			continue
+		}
+		ev := &orderbook.Event{
+			EventTime:     received.UnixMilli(),
+			ReceiveTimeNs: received.UnixNano(),
+			Symbol:        t.Symbol,
+			Exchange:      exchangeName,
+			MarketType:    marketType,
+			StreamType:    stream,
+			ExchangeTime:  t.EventTime,
+			Payload:       t.payload(),
+		}
+		if ev.ExchangeTime != 0 {
+			ev.LatencyUs = (ev.ReceiveTimeNs - ev.ExchangeTime*int64(time.Millisecond)) / int64(time.Microsecond)
+		}
+		events = append(events, ev)
+	}
+	return events, nil
+}
+
+// 심볼이 없는 시장 전체 스트림 (!miniTicker@arr 등). 심볼마다가 아니라 연결에 한 번 구독한다.
+func isMarketStream(streamType string) bool {
+	return strings.HasPrefix(streamType, "!")
+}
+
+// -streams 중 시장 전체 스트림
+func marketStreamTypes() []string {
+	var out []string
+	for _, t := range streamTypes {
+		if isMarketStream(t) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// 심볼별 partial depth 스트림 (collect -symbol-depth). 예를 들어 주요 심볼은 depth20@100ms,
+// 거래가 적은 심볼은 depth5@1000ms 로 받는다. 없는 심볼은 -streams 를 따른다.
+// 구독한 stream_type 은 세션 헤더(FileHeader.streams)와 이벤트의 stream_type 에 남고, manifest 도 파일마다 적는다.
+var symbolDepth map[string]string
+
+// symbol:depth<5|10|20>@<100ms|1000ms>[,...]
+func parseSymbolDepth(s string) (map[string]string, error) {
+	out := make(map[string]string)
+	for _, item := range splitList(s) {
+		symbol, stream, ok := strings.Cut(item, ":")
+		symbol = strings.ToLower(strings.TrimSpace(symbol))
+		level, speed, _ := strings.Cut(strings.TrimSpace(stream), "@")
+		switch {
+		case !ok || symbol == "":
+			return nil, fmt.Errorf("invalid symbol depth %q (symbol:depth5@1000ms)", item)
+		case level != "depth5" && level != "depth10" && level != "depth20":
+			return nil, fmt.Errorf("symbol depth %q: level must be depth5, depth10 or depth20", item)
+		case speed != "100ms" && speed != "1000ms":
+			return nil, fmt.Errorf("symbol depth %q: speed must be 100ms or 1000ms", item)
+		}
+		out[symbol] = level + "@" + speed
+	}
+	return out, nil
+}
+
+// symbol 을 구독할 스트림 종류. -symbol-depth 가 있으면 -streams 의 partial depth 스트림 대신 그것을 받는다
+// (-streams 에 partial depth 가 없어도 받는다).
+// 시장 전체 스트림은 빠진다.
+func symbolStreamTypes(symbol string) []string {
+	depth, ok := symbolDepth[symbol]
+	var out []string
+	if ok {
+		out = append(out, depth)
+	}
+	for _, t := range streamTypes {
+		if !isMarketStream(t) && (!ok || streamKind(t) != "snapshot") {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// 심볼별 스냅샷 표본 (collect -symbol-sample). N 이면 partial depth 스냅샷을 스트림마다 N 개 중 첫 번째만 남겨
+// 우선순위가 낮은 심볼의 저장량을 줄인다. 거른 스냅샷은 순번을 받지 않으므로 순번 공백이 생기지 않고,
+// 파일, 캐시, tick, 싱크 모두 남긴 스냅샷만 본다. 비율은 세션 헤더(FileHeader.snapshot_sample)에 남는다.
+var symbolSample map[string]int
+
+// symbol:N[,...]
+func parseSymbolSample(s string) (map[string]int, error) {
+	out := make(map[string]int)
+	for _, item := range splitList(s) {
+		symbol, ratio, ok := strings.Cut(item, ":")
+		symbol = strings.ToLower(strings.TrimSpace(symbol))
+		n, err := strconv.Atoi(strings.TrimSpace(ratio))
+		if !ok || symbol == "" || err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid symbol sample %q (symbol:N, keep 1 of every N snapshots)", item)
+		}
+		out[symbol] = n
+	}
+	return out, nil
+}
+
+// 읽기 루프에서 표본에 들지 않는 스냅샷을 거른다. 한 고루틴에서만 쓴다.
+type snapshotSampler struct {
+	seen map[string]int // 스트림별로 지금까지 받은 스냅샷 수
+}
+
+func (s *snapshotSampler) keep(symbol, stream string) bool {
+	n := symbolSample[symbol]
+	if n <= 1 {
+		return true
+	}
+	_, streamType, _ := strings.Cut(stream, "@")
+	if streamKind(streamType) != "snapshot" {
+		return true
+	}
+	if s.seen == nil {
+		s.seen = make(map[string]int)
+	}
+	c := s.seen[stream]
+	s.seen[stream] = c + 1
+	return c%n == 0
+}
+
+// 세션 헤더에 심볼의 수집 설정(구독 스트림, 스냅샷 표본)을 적는다
+func describeSymbol(symbol string, h *orderbook.FileHeader) {
+	h.Streams = symbolStreamTypes(symbol)
+	if n := symbolSample[symbol]; n > 1 {
+		h.SnapshotSample = uint32(n)
+	}
+	h.ListedAt = listedAt(symbol)
+	if marketType == optionsMarket {
+		h.Option = parseOptionSymbol(symbol)
+	}
+}
+
+// depthjson.go 의 빠른 길이 풀지 못한 depth 메시지를 encoding/json 으로 푼다
+func decodeSnapshotJSON(data []byte) (*orderbook.Snapshot, int64, error) {
+	snapshot := snapshotEventPool.Get().(*SnapshotEvent)
+	defer snapshotEventPool.Put(snapshot)
+	*snapshot = SnapshotEvent{Bids: snapshot.Bids[:0], Asks: snapshot.Asks[:0], FuturesBids: snapshot.FuturesBids[:0], FuturesAsks: snapshot.FuturesAsks[:0]}
+	if err := json.Unmarshal(data, snapshot); err != nil {
+		return nil, 0, err
+	}
+	if snapshot.LastUpdateID == 0 {
+		snapshot.LastUpdateID = snapshot.FinalUpdateID
+	}
+	if len(snapshot.Bids) == 0 && len(snapshot.Asks) == 0 {
+		snapshot.Bids, snapshot.Asks = snapshot.FuturesBids, snapshot.FuturesAsks
+	}
+	return &orderbook.Snapshot{
+		LastUpdateId: snapshot.LastUpdateID,
+		Bids:         parseLevels(snapshot.Bids),
+		Asks:         parseLevels(snapshot.Asks),
+	}, snapshot.EventTime, nil
+}
+
+func decodeDiffJSON(data []byte) (*orderbook.DepthDiff, int64, error) {
+	diff := depthUpdatePool.Get().(*DepthUpdateEvent)
+	defer depthUpdatePool.Put(diff)
+	*diff = DepthUpdateEvent{Bids: diff.Bids[:0], Asks: diff.Asks[:0]}
+	if err := json.Unmarshal(data, diff); err != nil {
+		return nil, 0, err
+	}
+	return &orderbook.DepthDiff{
+		FirstUpdateId:     diff.FirstUpdateID,
+		FinalUpdateId:     diff.FinalUpdateID,
+		PrevFinalUpdateId: diff.PrevUpdateID,
+		Bids:              parseLevels(diff.Bids),
+		Asks:              parseLevels(diff.Asks),
+	}, diff.EventTime, nil
+}
+
+// 스트림 이름의 소문자 심볼을 대문자로. 심볼마다 한 번만 만들므로 메시지마다 할당하지 않는다.
+var upperSymbols struct {
+	sync.RWMutex
+	m map[string]string
+}
+
+func upperSymbol(symbol string) string {
+	upperSymbols.RLock()
+	s, ok := upperSymbols.m[symbol]
+	upperSymbols.RUnlock()
+	if ok {
+		return s
+	}
+	upperSymbols.Lock()
+	defer upperSymbols.Unlock()
+	if upperSymbols.m == nil {
+		upperSymbols.m = make(map[string]string)
+	}
+	s = strings.ToUpper(symbol)
+	upperSymbols.m[strings.Clone(symbol)] = s
+	return s
+}
+
+// depth20@100ms -> snapshot, depth@100ms -> diff, trade, bookTicker. 그 밖에는 이름 그대로 (aggTrade, kline_1m, ticker)
+func streamKind(streamType string) string {
+	name, _, _ := strings.Cut(streamType, "@")
+	switch {
+	case name == "depth":
+		return "diff"
+	case strings.HasPrefix(name, "depth"):
+		return "snapshot"
+	default:
+		return name
+	}
+}
+
+// 메시지 하나의 호가는 한 블록으로 할당한다 (호가마다 따로 할당하지 않는다)
+func parseLevels(levels [][2]string) []*orderbook.Level {
+	block := make([]orderbook.Level, len(levels))
+	pbLevels := make([]*orderbook.Level, len(levels))
+	for i, l := range levels {
+		lv := &block[i]
+		lv.Price, lv.Quantity = parseFloat(l[0]), parseFloat(l[1])
+		if keepDecimalText {
+			lv.PriceText, lv.QuantityText = l[0], l[1]
+		}
+		pbLevels[i] = lv
+	}
+	return pbLevels
+}
+
+func parseFloat(s string) float64 {
+	f, _ := strconv.ParseFloat(s, 64)
+	return f
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"orderbook/orderbook"
+)
+
+// 심볼 메타데이터(기초/호가 자산, 호가 단위, 수량 단위, 상태) 캐시.
+// 바이낸스 exchangeInfo 를 주기적으로 받아 데이터 디렉터리의 symbols.json 에 저장해 두므로,
+// 네트워크가 없는 분석 환경에서도 마지막으로 받은 값을 쓸 수 있다. 질의 API 응답에 함께 실린다.
+// 수집기는 파일을 열 때 그 시점의 필터를 세션 헤더(tick_size, step_size, min_notional)에도 남기고,
+// read 는 헤더(없으면 symbols.json)의 호가/수량 단위로 가격을 단위에 맞춰 반올림하고 자릿수를 정해 출력한다.
+
+const symbolMetadataFile = "symbols.json"
+
+// REST API 주소와 경로 접두어 (현물 /api/v3, 선물 /fapi/v1). -endpoint 로 바꾼다 (network.go)
+var (
+	restBaseURL = endpointPresets["global"].REST
+	restAPIPath = endpointPresets["global"].API
+)
+
+type SymbolInfo struct {
+	Symbol         string `json:"symbol"`
+	Status         string `json:"status"`
+	BaseAsset      string `json:"baseAsset"`
+	QuoteAsset     string `json:"quoteAsset"`
+	BasePrecision  int    `json:"basePrecision"`
+	QuotePrecision int    `json:"quotePrecision"`
+	TickSize       string `json:"tickSize,omitempty"` // 거래소 문자열 그대로 (예: "0.01000000")
+	StepSize       string `json:"stepSize,omitempty"`
+	MinNotional    string `json:"minNotional,omitempty"`
+	// 옵션만 (options.go)
+	Underlying  string `json:"underlying,omitempty"`
+	StrikePrice string `json:"strikePrice,omitempty"`
+	ExpiryDate  int64  `json:"expiryDate,omitempty"`
+	Side        string `json:"side,omitempty"`
+}
+
+type symbolMetadata struct {
+	mu        sync.RWMutex
+	path      string
+	FetchedAt time.Time              `json:"fetchedAt"`
+	Symbols   map[string]*SymbolInfo `json:"symbols"` // 키는 소문자 심볼
+}
+
+// dataDir 의 symbols.json 을 읽는다. 없으면 빈 캐시.
+func loadSymbolMetadata(dataDir string) *symbolMetadata {
+	m := &symbolMetadata{path: filepath.Join(dataDir, symbolMetadataFile), Symbols: make(map[string]*SymbolInfo)}
+	data, err := os.ReadFile(m.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Ignoring symbol metadata cache: %v", err)
+		}
+		return m
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		log.Printf("Ignoring symbol metadata cache %s: %v", m.path, err)
+		m.Symbols = make(map[string]*SymbolInfo)
+	}
+	return m
+}
+
+// 캐시에 없으면 nil
+func (m *symbolMetadata) Get(symbol string) *SymbolInfo {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.Symbols[strings.ToLower(symbol)]
+}
+
+type exchangeInfoResponse struct {
+	Symbols       []exchangeInfoSymbol `json:"symbols"`
+	OptionSymbols []exchangeInfoSymbol `json:"optionSymbols"` // 옵션은 이쪽에 온다
+}
+
+type exchangeInfoSymbol struct {
+	Symbol              string `json:"symbol"`
+	Status              string `json:"status"`
+	BaseAsset           string `json:"baseAsset"`
+	BaseAssetPrecision  int    `json:"baseAssetPrecision"`
+	QuoteAsset          string `json:"quoteAsset"`
+	QuoteAssetPrecision int    `json:"quoteAssetPrecision"`
+	Underlying          string `json:"underlying"` // 옵션만
+	StrikePrice         string `json:"strikePrice"`
+	ExpiryDate          int64  `json:"expiryDate"`
+	Side                string `json:"side"`
+	Filters             []struct {
+		FilterType  string `json:"filterType"`
+		TickSize    string `json:"tickSize"`
+		StepSize    string `json:"stepSize"`
+		MinNotional string `json:"minNotional"`
+		Notional    string `json:"notional"` // 선물의 MIN_NOTIONAL
+	} `json:"filters"`
+}
+
+// 세션 헤더에 심볼의 필터(옵션이면 계약 조건도)를 채운다. 캐시에 없으면 그대로 둔다.
+func (m *symbolMetadata) describe(symbol string, h *orderbook.FileHeader) {
+	si := m.Get(symbol)
+	if si == nil {
+		return
+	}
+	h.TickSize, h.StepSize, h.MinNotional = si.TickSize, si.StepSize, si.MinNotional
+	if si.ExpiryDate != 0 {
+		h.Option = &orderbook.OptionContract{Underlying: si.Underlying, StrikePrice: si.StrikePrice, ExpiryTime: si.ExpiryDate, Side: si.Side}
+	}
+}
+
+// 호가/수량 단위의 소수 자릿수. 단위를 모르면 -1 이고 가장 짧은 표기로 출력한다.
+type decimalPrecision struct {
+	Price, Quantity int
+}
+
+// 파일 헤더의 단위를 먼저 쓰고, 없으면(이전 파일) meta 에서 찾는다. meta 는 nil 이어도 된다.
+func symbolPrecision(h *orderbook.FileHeader, meta *symbolMetadata, symbol string) decimalPrecision {
+	tick, step := h.GetTickSize(), h.GetStepSize()
+	if tick == "" && meta != nil {
+		if si := meta.Get(symbol); si != nil {
+			tick, step = si.TickSize, si.StepSize
+		}
+	}
+	return decimalPrecision{Price: stepDecimals(tick), Quantity: stepDecimals(step)}
+}
+
+// "0.01000000" -> 2, "1.00000000" -> 0. 비었거나 잘못된 값이면 -1.
+func stepDecimals(step string) int {
+	if v, err := strconv.ParseFloat(step, 64); err != nil || v <= 0 {
+		return -1
+	}
+	_, frac, ok := strings.Cut(step, ".")
+	if !ok {
+		return 0
+	}
+	return len(strings.TrimRight(frac, "0"))
+}
+
+// 단위 자릿수로 반올림한다. 10^d 배 한 정수로 맞추므로 double 오차로 같은 호가가 다른 키가 되지 않는다.
+func roundDecimals(v float64, decimals int) float64 {
+	if decimals < 0 {
+		return v
+	}
+	scale := math.Pow10(decimals)
+	return math.Round(v*scale) / scale
+}
+
+func formatDecimals(v float64, decimals int) string {
+	return strconv.FormatFloat(v, 'f', decimals, 64)
+}
+
+// exchangeInfo 를 받아 캐시를 바꾸고 파일에 저장한다
+func (m *symbolMetadata) refresh(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, restBaseURL+restAPIPath+"/exchangeInfo", nil)
+	if err != nil {
+		return err
+	}
+	// exchangeInfo 는 수 MB 라 시간 제한 없이 받는다. 프록시, TLS 설정은 restClient 를 따른다.
+	client := *restClient
+	client.Timeout = 0
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("exchangeInfo: %s", resp.Status)
+	}
+	var info exchangeInfoResponse
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return fmt.Errorf("exchangeInfo: %w", err)
+	}
+
+	symbols := make(map[string]*SymbolInfo, len(info.Symbols)+len(info.OptionSymbols))
+	for _, s := range append(info.Symbols, info.OptionSymbols...) {
+		si := &SymbolInfo{
+			Symbol:         s.Symbol,
+			Status:         s.Status,
+			BaseAsset:      s.BaseAsset,
+			QuoteAsset:     s.QuoteAsset,
+			BasePrecision:  s.BaseAssetPrecision,
+			QuotePrecision: s.QuoteAssetPrecision,
+			Underlying:     s.Underlying,
+			StrikePrice:    s.StrikePrice,
+			ExpiryDate:     s.ExpiryDate,
+			Side:           s.Side,
+		}
+		for _, f := range s.Filters {
+			switch f.FilterType {
+			case "PRICE_FILTER":
+				si.TickSize = f.TickSize
+			case "LOT_SIZE":
+				si.StepSize = f.StepSize
+			case "NOTIONAL", "MIN_NOTIONAL":
+				si.MinNotional = cmp.Or(f.MinNotional, f.Notional)
+			}
+		}
+		symbols[strings.ToLower(s.Symbol)] = si
+	}
+
+	m.mu.Lock()
+	m.Symbols, m.FetchedAt = symbols, time.Now().UTC()
+	data, err := json.MarshalIndent(m, "", "  ")
+	m.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(m.path), os.ModePerm); err != nil {
+		return err
+	}
+	tmp := m.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, m.path); err != nil {
+		return err
+	}
+	log.Printf("Symbol metadata refreshed (%d symbols)", len(symbols))
+	return nil
+}
+
+// 캐시가 interval 보다 오래되었으면 곧바로, 그 뒤로는 interval 마다 갱신한다. 실패하면 기존 값을 그대로 쓴다.
+func (m *symbolMetadata) runRefresher(ctx context.Context, interval time.Duration) {
+	m.mu.RLock()
+	wait := time.Until(m.FetchedAt.Add(interval))
+	m.mu.RUnlock()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(max(wait, 0)):
+		}
+		if err := m.refresh(ctx); err != nil {
+			log.Printf("Symbol metadata refresh failed, keeping cached values: %v", err)
+		}
+		wait = interval
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// systemd 와 함께 돌리기 (sd_notify, 워치독) 와 PID 파일.
+//
+// systemd 가 NOTIFY_SOCKET 을 주면(Type=notify) 준비를 마치고 첫 연결을 시도하기 직전에 READY=1 을,
+// 연결 상태를 STATUS= 로, 종료할 때 STOPPING=1 을 보낸다. WatchdogSec 이 있으면 그 절반마다 WATCHDOG=1 을
+// 보내는데, 수집 루프가 WatchdogSec 동안 움직이지 않았으면(메시지, 핑, 재연결 시도가 없으면) 보내지 않는다.
+// 그러면 systemd 가 멈춘 수집기(죽은 연결에서 읽기를 기다리거나, 디스크가 막혀 큐에서 기다리는 경우)를 죽이고
+// Restart= 로 다시 띄운다. 재연결 간격(5초)과 REST 부트스트랩보다 넉넉하게 WatchdogSec=60 정도를 권한다.
+//
+//	[Service]
+//	Type=notify
+//	ExecStart=/usr/local/bin/orderbook collect -symbols btcusdt,ethusdt -pid-file /run/orderbook/collect.pid
+//	WatchdogSec=60
+//	Restart=always
+//	RestartSec=5
+//	NotifyAccess=main
+//
+// -pid-file 은 systemd 없이 데몬처럼 돌릴 때(또는 PIDFile= 로) 쓴다. 실행하는 동안 파일을 flock 으로 잠가 두어
+// 잠긴 파일이면 시작하지 않고, 지난 실행이 남긴 파일이면 덮어쓴다. 정상 종료할 때 지운다.
+
+// 수집 루프가 움직였다는 표시 (UnixNano). 읽기 루프가 메시지나 핑을 받을 때, 재연결을 시도할 때 찍는다
+var collectorHeartbeat atomic.Int64
+
+func collectorAlive() {
+	collectorHeartbeat.Store(time.Now().UnixNano())
+}
+
+// NOTIFY_SOCKET 으로 상태를 보낸다. systemd 아래가 아니면 아무것도 하지 않는다
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	if strings.HasPrefix(socket, "@") {
+		socket = "\x00" + socket[1:] // 추상 네임스페이스 소켓
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// 실패해도 수집은 계속한다. 같은 실패를 계속 남기지 않도록 처음 한 번만 로그로 남긴다
+var sdNotifyFailed atomic.Bool
+
+func notifySystemd(state string) {
+	if err := sdNotify(state); err != nil && !sdNotifyFailed.Swap(true) {
+		log.Printf("systemd notify failed: %v", err)
+	}
+}
+
+// systemd 가 이 프로세스에 워치독을 켰으면 그 시간
+func watchdogTimeout() (time.Duration, bool) {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0, false
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, false
+	}
+	return time.Duration(usec) * time.Microsecond, true
+}
+
+var watchdogOnce sync.Once
+
+// 수집 루프가 움직이는 동안 워치독 시간의 절반마다 WATCHDOG=1 을 보낸다. 여러 번 불러도 한 번만 시작한다
+// (대기 중인 standby 도 leader.go 에서 시작한다)
+func startWatchdog() {
+	watchdogOnce.Do(func() {
+		timeout, ok := watchdogTimeout()
+		if !ok {
+			return
+		}
+		log.Printf("systemd watchdog enabled (%s)", timeout)
+		go runWatchdog(timeout)
+	})
+}
+
+func runWatchdog(timeout time.Duration) {
+	stalled := false
+	for range time.Tick(timeout / 2) {
+		idle := time.Since(time.Unix(0, collectorHeartbeat.Load()))
+		if idle < timeout {
+			stalled = false
+			notifySystemd("WATCHDOG=1")
+			continue
+		}
+		if !stalled {
+			log.Printf("Collector loop has not moved for %s, withholding the watchdog ping so systemd restarts it", idle.Round(time.Second))
+			stalled = true
+		}
+	}
+}
+
+// path 에 이 프로세스의 PID 를 쓰고 지우는 함수를 돌려준다. 파일 내용이 아니라 잠금으로 판단하므로 (filelock_unix.go)
+// 동시에 시작한 다른 프로세스가 PID 를 쓰기 전의 빈 파일을 보더라도 둘 다 시작하는 일은 없다.
+func writePIDFile(path string) (func(), error) {
+	for {
+		f, ok, err := lockFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			if other, err := readPIDFile(path); err == nil {
+				return nil, fmt.Errorf("pid file %s: process %d is already running", path, other)
+			}
+			return nil, fmt.Errorf("pid file %s is locked by another process", path)
+		}
+		// 열고 잠그는 사이에 잡고 있던 프로세스가 끝나며 지웠으면 지워진 파일을 잠근 것이다. 다시 연다
+		if fi, err := os.Stat(path); err != nil || !sameFile(f, fi) {
+			f.Close()
+			continue
+		}
+		// 잠금을 잡았으니 남아 있는 PID 는 끝난 프로세스의 것이다
+		if other, err := readPIDFile(path); err == nil {
+			log.Printf("Replacing stale pid file %s (process %d)", path, other)
+		}
+		if err := f.Truncate(0); err != nil {
+			f.Close()
+			return nil, err
+		}
+		if _, err := fmt.Fprintf(f, "%d\n", os.Getpid()); err != nil {
+			f.Close()
+			return nil, err
+		}
+		return sync.OnceFunc(func() {
+			// 잠근 채 지워야 기다리던 프로세스가 지워진 파일을 잡지 않는다 (위의 확인)
+			os.Remove(path)
+			f.Close()
+		}), nil
+	}
+}
+
+func sameFile(f *os.File, fi fs.FileInfo) bool {
+	cur, err := f.Stat()
+	return err == nil && os.SameFile(cur, fi)
+}
+
+func readPIDFile(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"orderbook/orderbook"
+)
+
+// 수집기가 쓰고 있는 파일을 tail -f 처럼 따라 읽는다 (read -follow, follow -tail).
+// from 이후의 기록을 끝까지 읽은 뒤, 수집기가 덧붙이는 레코드를 tailPoll 마다 확인해 넘긴다.
+// 회전(날짜, 시간, 크기 part)으로 다음 파일이 생기면 지금 파일을 마저 읽고 그 파일로 넘어간다.
+// 여러 인스턴스가 같은 데이터 디렉터리에 쓰면 처음 고른 파일의 인스턴스만 따라간다.
+
+// 파일 끝에서 새 레코드를 기다리는 간격
+const tailPoll = 500 * time.Millisecond
+
+// symbol 의 기록을 from 부터 따라가며 fn 에 넘긴다. ctx 가 취소될 때까지 돈다.
+func tailSymbol(ctx context.Context, dataDir, symbol string, from int64, fn func(ev *orderbook.Event) error) error {
+	var t *fileTail
+	for {
+		if t == nil {
+			if p := nextTailFile(dataDir, symbol, from, ""); p != "" {
+				t = &fileTail{path: p, offset: -1}
+				log.Printf("Following %s", p)
+			}
+		}
+		if t != nil {
+			// 다음 파일이 이미 있으면 수집기는 지금 파일을 닫았다. 먼저 확인하고 읽어야 그 사이 덧붙은 레코드를 놓치지 않는다.
+			next := nextTailFile(dataDir, symbol, from, t.path)
+			if err := t.read(ctx, from, fn); err != nil {
+				return err
+			}
+			if next != "" {
+				t = &fileTail{path: next, offset: -1}
+				log.Printf("Following %s", next)
+				continue
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(tailPoll):
+		}
+	}
+}
+
+// after 다음에 읽을 파일. after 가 비어 있으면 from 날짜부터 처음 파일. 없으면 "".
+func nextTailFile(dataDir, symbol string, from int64, after string) string {
+	start := from
+	if after != "" {
+		if t, err := time.Parse(dateLayout, fileDate(filepath.Base(after))); err == nil {
+			start = max(start, t.UnixMilli())
+		}
+	}
+	for _, f := range dataFilesInRange(dataDir, symbol, start, time.Now().UnixMilli()+1) {
+		switch {
+		case after == "":
+			return f.path
+		case f.path > after && fileInstance(filepath.Base(f.path)) == fileInstance(filepath.Base(after)):
+			return f.path
+		}
+	}
+	return ""
+}
+
+// 따라 읽는 파일 하나. 어디까지 넘겼는지 기억했다가 다음에 그 뒤부터 다시 연다.
+type fileTail struct {
+	path string
+	// 마지막으로 넘긴 레코드가 든 프레임(압축이면 블록)의 위치와 그 세션 헤더 위치. 아직 없으면 offset 은 -1.
+	offset, headerOffset int64
+	// 그 프레임에서 이미 넘긴 레코드 수 (압축 블록에는 여럿이 들어 있다)
+	done int
+	// 지난번 Reader. 바뀌지 않은 스냅샷 표시를 풀 직전 스냅샷을 넘겨받는다
+	prev *orderbook.Reader
+}
+
+// 지금 파일에 있는 만큼 읽는다. 쓰는 중이라 잘린 마지막 프레임은 다음에 다시 읽는다.
+func (t *fileTail) read(ctx context.Context, from int64, fn func(ev *orderbook.Event) error) error {
+	f, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := orderbook.NewReader(f)
+	skip := 0
+	switch idx, _ := orderbook.LoadIndex(f); {
+	case t.offset < 0 && idx != nil:
+		// 처음 열 때는 (수집 중이면 사이드카) 인덱스로 from 근처까지 건너뛴다
+		if i := idx.Search(from); i > 0 {
+			if r, err = orderbook.OpenBlock(f, idx.Entries[i-1]); err != nil {
+				return err
+			}
+		}
+	case t.offset >= 0:
+		if r, err = orderbook.OpenBlock(f, &orderbook.IndexEntry{Offset: t.offset, HeaderOffset: t.headerOffset}); err != nil {
+			return err
+		}
+		skip = t.done
+		r.InheritSnapshots(t.prev)
+	}
+	t.prev = r
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		ev, err := r.Next()
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		if off, headerOff := r.Position(); off == t.offset {
+			t.done++
+		} else {
+			t.offset, t.headerOffset, t.done = off, headerOff, 1
+		}
+		if err != nil {
+			log.Printf("%s: skipping unreadable record: %v", t.path, err)
+			continue
+		}
+		if ev.EventTime < from {
+			continue
+		}
+		if err := fn(ev); err != nil {
+			return err
+		}
+	}
+}
+
+// 수집 중인 파일을 따라 읽는 Feed. 라이브처럼 Run 은 ctx 가 취소될 때까지 돈다.
+// 웹소켓 대신 수집기가 남긴 파일을 읽으므로 같은 기계에서 여러 도구가 연결 없이 실시간 데이터를 나눠 쓸 수 있다.
+// 심볼마다 따로 읽으므로 심볼 사이의 순서는 파일에 닿은 순서다.
+type TailFeed struct {
+	feedSubs
+	dataDir string
+	from    int64
+}
+
+func NewTailFeed(dataDir string, from int64) *TailFeed {
+	return &TailFeed{dataDir: dataDir, from: from}
+}
+
+func (f *TailFeed) Run(ctx context.Context) error {
+	defer f.closeAll()
+	symbols := f.symbols()
+	if len(symbols) == 0 {
+		return errors.New("feed: no subscriptions")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errc := make(chan error, len(symbols))
+	for _, symbol := range symbols {
+		go func() {
+			errc <- tailSymbol(ctx, f.dataDir, symbol, f.from, func(ev *orderbook.Event) error {
+				if ev.Symbol == "" {
+					ev.Symbol = strings.ToUpper(symbol)
+				}
+				return f.deliver(ctx, ev)
+			})
+		}()
+	}
+	var err error
+	for range symbols {
+		if e := <-errc; err == nil || errors.Is(err, context.Canceled) {
+			err = e
+		}
+		cancel() // 하나가 실패하면 모두 멈춘다
+	}
+	return err
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"orderbook/orderbook"
+)
+
+// 수집 파이프라인의 OpenTelemetry 메트릭과 트레이스 (collect -otlp). OTLP/HTTP 로 수집기(OpenTelemetry Collector,
+// Tempo, Jaeger 등)에 보내 단계별 지연 예산을 기존 관측 스택에서 본다.
+//
+//	-otlp http://otel-collector:4318   보낼 곳. 비어 있으면 끈다
+//	-otlp-header 'x-api-key=...'       요청 헤더 (여러 번). OTEL_EXPORTER_OTLP_HEADERS 도 읽는다
+//	-otlp-sample 0.001                 트레이스로 남길 메시지 비율. 메트릭은 모든 메시지를 센다
+//	-otlp-interval 15s                 메트릭을 보내는 간격
+//
+// service.name 은 orderbook-collector 이고 OTEL_SERVICE_NAME, OTEL_RESOURCE_ATTRIBUTES 로 바꾸거나 더할 수 있다.
+// -instance 가 있으면 service.instance.id 로 붙는다.
+//
+// 단계 (orderbook.pipeline.duration 의 stage, 트레이스의 span 이름)
+//
+//	queue   읽기 루프가 받은 뒤 심볼 고루틴이 꺼낼 때까지 (pipeline.go)
+//	parse   JSON 을 이벤트로 파싱
+//	handle  파일(또는 쓰기 큐), 캐시, 싱크, gRPC 로 내보내기
+//	write   파일 쓰기. 직렬화(proto, dedup, 델타, 압축)와 파일 버퍼에 쓰기를 함께 잰다
+//	flush   파일 버퍼를 OS 로 내려보내기
+//	fsync   -fsync 의 디스크 기록
+//
+// 그 밖의 메트릭
+//
+//	orderbook.exchange.latency   거래소 이벤트 시간(E) 에서 수신까지. E 가 없는 스트림은 빠진다
+//	orderbook.pipeline.latency   수신에서 파일 쓰기까지 (쓰기 큐에서 기다린 시간 포함)
+//	orderbook.messages           받은 메시지 수, orderbook.received.bytes 받은 바이트 (stream: snapshot, diff, trade ...)
+//	orderbook.write_queue.depth  쓰기 큐에 쌓인 이벤트 수
+//	orderbook.write.dropped      쓰지 못하고 버린 이벤트 수 (failover.go)
+//
+// 트레이스는 메시지마다 orderbook.message span 하나(수신 시각에 시작)와 단계별 자식 span 이다. 쓰기 큐가 있으면
+// write span 은 부모가 끝난 뒤에 온다.
+
+type telemetryOptions struct {
+	Endpoint string
+	Headers  []string
+	Sample   float64
+	Interval time.Duration
+}
+
+func (o *telemetryOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.Endpoint, "otlp", "", "export pipeline metrics and traces over OTLP/HTTP to this endpoint (e.g. http://127.0.0.1:4318); empty disables; see telemetry.go")
+	fs.Func("otlp-header", "extra OTLP request header, name=value (repeatable)", func(v string) error {
+		if name, _, ok := strings.Cut(v, "="); !ok || name == "" {
+			return fmt.Errorf("want name=value")
+		}
+		o.Headers = append(o.Headers, v)
+		return nil
+	})
+	fs.Float64Var(&o.Sample, "otlp-sample", 0.001, "fraction of messages traced through the pipeline (metrics count every message)")
+	fs.DurationVar(&o.Interval, "otlp-interval", 15*time.Second, "how often metrics are exported")
+}
+
+func (o *telemetryOptions) parse() error {
+	switch {
+	case o.Sample < 0 || o.Sample > 1:
+		return fmt.Errorf("-otlp-sample must be between 0 and 1")
+	case o.Interval <= 0:
+		return fmt.Errorf("-otlp-interval must be positive")
+	}
+	o.Endpoint = strings.TrimRight(o.Endpoint, "/")
+	return nil
+}
+
+// 수집기 전체가 쓰는 계측. -otlp 가 없으면 nil 이고 메서드는 아무것도 하지 않는다.
+var pipelineTelemetry *telemetry
+
+// 쓰기 큐를 지나는 동안 트레이스할 이벤트의 span 을 찾아 둔다. 버려진 이벤트가 남지 않도록 가득 차면 비운다.
+const maxTracedPending = 4096
+
+type telemetry struct {
+	sample   float64
+	tracer   trace.Tracer
+	shutdown []func(context.Context) error
+
+	stages   metric.Float64Histogram
+	exchange metric.Float64Histogram
+	latency  metric.Float64Histogram
+	messages metric.Int64Counter
+	bytes    metric.Int64Counter
+	stageSet map[string]metric.MeasurementOption
+
+	mu      sync.Mutex
+	pending map[*orderbook.Event]trace.SpanContext
+}
+
+// 초 단위 히스토그램 경계. 수 µs 파싱부터 수 초 밀린 큐까지
+var telemetryBuckets = []float64{
+	0.00001, 0.000025, 0.00005, 0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005,
+	0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10,
+}
+
+func startTelemetry(ctx context.Context, opts telemetryOptions, instance string, fms map[string]*FileManager) (*telemetry, error) {
+	headers := make(map[string]string, len(opts.Headers))
+	for _, h := range opts.Headers {
+		name, value, _ := strings.Cut(h, "=")
+		headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	attrs := []attribute.KeyValue{attribute.String("service.name", "orderbook-collector")}
+	if instance != "" {
+		attrs = append(attrs, attribute.String("service.instance.id", instance))
+	} else if host, err := os.Hostname(); err == nil {
+		attrs = append(attrs, attribute.String("service.instance.id", host))
+	}
+	// 환경 변수가 기본값보다 앞선다
+	res, err := resource.New(ctx, resource.WithAttributes(attrs...), resource.WithFromEnv(), resource.WithHost())
+	if err != nil {
+		return nil, fmt.Errorf("otlp resource: %w", err)
+	}
+
+	traceExp, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(opts.Endpoint+"/v1/traces"), otlptracehttp.WithHeaders(headers))
+	if err != nil {
+		return nil, fmt.Errorf("otlp traces: %w", err)
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(traceExp), sdktrace.WithResource(res))
+	metricExp, err := otlpmetrichttp.New(ctx, otlpmetrichttp.WithEndpointURL(opts.Endpoint+"/v1/metrics"), otlpmetrichttp.WithHeaders(headers))
+	if err != nil {
+		tp.Shutdown(ctx)
+		return nil, fmt.Errorf("otlp metrics: %w", err)
+	}
+	mp := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExp, sdkmetric.WithInterval(opts.Interval))),
+		sdkmetric.WithResource(res))
+
+	t := &telemetry{
+		sample:   opts.Sample,
+		tracer:   tp.Tracer("orderbook/collector"),
+		shutdown: []func(context.Context) error{tp.Shutdown, mp.Shutdown},
+		stageSet: make(map[string]metric.MeasurementOption),
+		pending:  make(map[*orderbook.Event]trace.SpanContext),
+	}
+	for _, stage := range []string{"queue", "parse", "handle", "write", "flush", "fsync"} {
+		t.stageSet[stage] = metric.WithAttributeSet(attribute.NewSet(attribute.String("stage", stage)))
+	}
+	meter := mp.Meter("orderbook/collector")
+	t.stages, err = meter.Float64Histogram("orderbook.pipeline.duration", metric.WithUnit("s"),
+		metric.WithDescription("Time spent in each collector pipeline stage"), metric.WithExplicitBucketBoundaries(telemetryBuckets...))
+	if err != nil {
+		return nil, err
+	}
+	t.exchange, err = meter.Float64Histogram("orderbook.exchange.latency", metric.WithUnit("s"),
+		metric.WithDescription("Exchange event time to local receive time"), metric.WithExplicitBucketBoundaries(telemetryBuckets...))
+	if err != nil {
+		return nil, err
+	}
+	t.latency, err = meter.Float64Histogram("orderbook.pipeline.latency", metric.WithUnit("s"),
+		metric.WithDescription("Local receive time to data file write"), metric.WithExplicitBucketBoundaries(telemetryBuckets...))
+	if err != nil {
+		return nil, err
+	}
+	if t.messages, err = meter.Int64Counter("orderbook.messages", metric.WithUnit("{message}"),
+		metric.WithDescription("Websocket messages received")); err != nil {
+		return nil, err
+	}
+	if t.bytes, err = meter.Int64Counter("orderbook.received.bytes", metric.WithUnit("By"),
+		metric.WithDescription("Websocket message bytes received")); err != nil {
+		return nil, err
+	}
+	depth, err := meter.Int64ObservableGauge("orderbook.write_queue.depth", metric.WithUnit("{event}"),
+		metric.WithDescription("Events waiting in the write queues"))
+	if err != nil {
+		return nil, err
+	}
+	dropped, err := meter.Int64ObservableCounter("orderbook.write.dropped", metric.WithUnit("{event}"),
+		metric.WithDescription("Events that could not be written and were dropped"))
+	if err != nil {
+		return nil, err
+	}
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		for name, fm := range fms {
+			set := metric.WithAttributes(attribute.String("dir", name))
+			queued := 0
+			for _, q := range fm.queueStatus() {
+				queued += q.Queued
+			}
+			o.ObserveInt64(depth, int64(queued), set)
+			o.ObserveInt64(dropped, fm.writeHealth().Dropped, set)
+		}
+		return nil
+	}, depth, dropped)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Exporting pipeline telemetry over OTLP to %s (tracing %g of messages)", opts.Endpoint, opts.Sample)
+	return t, nil
+}
+
+// 남은 span 과 메트릭을 보낸다
+func (t *telemetry) close(ctx context.Context) {
+	if t == nil {
+		return
+	}
+	var errs []error
+	for _, shutdown := range t.shutdown {
+		errs = append(errs, shutdown(ctx))
+	}
+	if err := errors.Join(errs...); err != nil {
+		log.Printf("OTLP export on shutdown failed: %v", err)
+	}
+}
+
+// 읽기 루프가 메시지를 받을 때마다 부른다
+func (t *telemetry) received(stream string, size int) {
+	if t == nil {
+		return
+	}
+	_, streamType, _ := strings.Cut(stream, "@")
+	set := metric.WithAttributes(attribute.String("stream", streamKind(streamType)))
+	t.messages.Add(context.Background(), 1, set)
+	t.bytes.Add(context.Background(), int64(size), set)
+}
+
+func (t *telemetry) stage(stage string, start, end time.Time) {
+	t.stages.Record(context.Background(), end.Sub(start).Seconds(), t.stageSet[stage])
+}
+
+// 심볼 고루틴에서 메시지 하나를 처리하는 동안의 계측. 트레이스하지 않는 메시지는 span 이 nil 이다.
+type messageTrace struct {
+	t        *telemetry
+	received time.Time
+	mark     time.Time // 지난 단계가 끝난 시각
+	ctx      context.Context
+	span     trace.Span
+}
+
+// 심볼 고루틴이 메시지를 꺼냈다. 여기까지가 queue 단계다
+func (t *telemetry) message(symbol, stream string, received time.Time) *messageTrace {
+	if t == nil {
+		return nil
+	}
+	now := time.Now()
+	t.stage("queue", received, now)
+	m := &messageTrace{t: t, received: received, mark: now}
+	if t.sample > 0 && rand.Float64() < t.sample {
+		m.ctx, m.span = t.tracer.Start(context.Background(), "orderbook.message", trace.WithTimestamp(received),
+			trace.WithAttributes(attribute.String("symbol", symbol), attribute.String("stream", stream)))
+		_, q := t.tracer.Start(m.ctx, "queue", trace.WithTimestamp(received))
+		q.End(trace.WithTimestamp(now))
+	}
+	return m
+}
+
+// 단계 하나가 끝났다
+func (m *messageTrace) done(stage string) {
+	if m == nil {
+		return
+	}
+	now := time.Now()
+	m.t.stage(stage, m.mark, now)
+	if m.span != nil {
+		_, s := m.t.tracer.Start(m.ctx, stage, trace.WithTimestamp(m.mark))
+		s.End(trace.WithTimestamp(now))
+	}
+	m.mark = now
+}
+
+// 파싱한 이벤트를 내보내기 전에 부른다. 트레이스하는 메시지면 이벤트가 파일에 쓰일 때 write span 을 잇는다
+func (m *messageTrace) event(ev *orderbook.Event) {
+	if m == nil {
+		return
+	}
+	if ev.ExchangeTime != 0 {
+		m.t.exchange.Record(context.Background(), float64(ev.LatencyUs)/1e6)
+	}
+	if m.span == nil {
+		return
+	}
+	m.span.SetAttributes(attribute.Int64("sequence", int64(ev.Sequence)))
+	m.t.mu.Lock()
+	if len(m.t.pending) >= maxTracedPending {
+		clear(m.t.pending)
+	}
+	m.t.pending[ev] = m.span.SpanContext()
+	m.t.mu.Unlock()
+}
+
+func (m *messageTrace) end() {
+	if m == nil || m.span == nil {
+		return
+	}
+	m.span.End()
+}
+
+// 이벤트 하나를 파일에 쓴 시간. 트레이스하는 이벤트면 그 메시지의 write span 을 남긴다
+func (t *telemetry) written(ev *orderbook.Event, start, end time.Time) {
+	if t == nil {
+		return
+	}
+	t.stage("write", start, end)
+	if ev.ReceiveTimeNs != 0 {
+		t.latency.Record(context.Background(), end.Sub(time.Unix(0, ev.ReceiveTimeNs)).Seconds())
+	}
+	if t.sample == 0 {
+		return
+	}
+	t.mu.Lock()
+	parent, ok := t.pending[ev]
+	delete(t.pending, ev)
+	t.mu.Unlock()
+	if ok {
+		_, s := t.tracer.Start(trace.ContextWithSpanContext(context.Background(), parent), "write", trace.WithTimestamp(start))
+		s.End(trace.WithTimestamp(end))
+	}
+}
+
+// flush, fsync 처럼 이벤트 하나에 묶이지 않는 단계
+func (t *telemetry) timed(stage string, start time.Time) {
+	if t == nil {
+		return
+	}
+	t.stage(stage, start, time.Now())
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"orderbook/orderbook"
+)
+
+// 기록된 스냅샷/bookTicker 에서 최우선 호가 변화(tick) 스트림을 만든다.
+// -out 을 주면 tick 이벤트를 그 데이터 디렉터리에 일 단위 파일로 쓰고, 없으면 CSV 로 표준 출력에 쓴다.
+// 수집 중에 바로 만들려면 collect -ticks-dir 를 쓴다.
+
+func runTicks(args []string) error {
+	fs := flag.NewFlagSet("ticks", flag.ExitOnError)
+	symbol := fs.String("symbol", "", "symbol")
+	var rng rangeFlags
+	rng.register(fs)
+	dataDir := fs.String("data", defaultDataDir, "data directory")
+	outDir := fs.String("out", "", "write tick files into this data directory instead of CSV on stdout")
+	var jobOpts jobOptions
+	jobOpts.register(fs, "")
+	fs.Parse(args)
+
+	if *symbol == "" {
+		return fmt.Errorf("-symbol is required")
+	}
+	fromMs, toMs, err := rng.resolve()
+	if err != nil {
+		return err
+	}
+	files := dataFilesInRange(*dataDir, *symbol, fromMs, toMs)
+	if len(files) == 0 {
+		return fmt.Errorf("no data for %s in %s", *symbol, rng.String())
+	}
+	var units []jobUnit
+	for _, f := range files {
+		units = append(units, jobUnit{name: f.path, size: f.size})
+	}
+
+	var out tickOutput
+	if *outDir != "" {
+		out = &tickFileOutput{dir: *outDir, symbol: strings.ToLower(*symbol), sessionID: newSessionID()}
+	} else {
+		out = newTickCSVOutput(os.Stdout)
+	}
+
+	cp, err := openCheckpoint(jobOpts.checkpoint, "ticks", fmt.Sprintf("%s %d-%d %s", *symbol, fromMs, toMs, *outDir), jobOpts.resume)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	deriver := orderbook.NewTickDeriver()
+	var n int
+	err = runJob(ctx, jobOpts, cp, units, func(ctx context.Context, u jobUnit, p *Progress) error {
+		return scanFile(ctx, u.name, fromMs, toMs, p, func(r *orderbook.Reader, ev *orderbook.Event) error {
+			tick := deriver.Next(ev)
+			if tick == nil {
+				return nil
+			}
+			n++
+			tick.Sequence = uint64(n)
+			return out.write(tick)
+		})
+	})
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	log.Printf("Derived %d ticks", n)
+	return err
+}
+
+type tickOutput interface {
+	write(ev *orderbook.Event) error
+	Close() error
+}
+
+// tick 이벤트를 수신 시간의 UTC 날짜별 파일로 쓴다
+type tickFileOutput struct {
+	dir       string
+	symbol    string // 구버전 레코드에는 심볼이 없으므로 요청한 심볼로 쓴다
+	sessionID string
+	date      string
+	fw        *orderbook.FileWriter
+}
+
+func (o *tickFileOutput) write(ev *orderbook.Event) error {
+	if date := utcDate(ev.EventTime); date != o.date {
+		if err := o.Close(); err != nil {
+			return err
+		}
+		path := filepath.Join(o.dir, o.symbol, o.symbol+"_"+date+".bin")
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			return err
+		}
+		fw, err := orderbook.OpenFileWriter(path, &orderbook.FileHeader{
+			CreatedAt:  time.Now().UTC().UnixMilli(),
+			Symbol:     strings.ToUpper(o.symbol),
+			Exchange:   ev.Exchange,
+			MarketType: ev.MarketType,
+			SessionId:  o.sessionID,
+		})
+		if err != nil {
+			return err
+		}
+		o.fw, o.date = fw, date
+	}
+	return o.fw.Write(ev)
+}
+
+func (o *tickFileOutput) Close() error {
+	if o.fw == nil {
+		return nil
+	}
+	err := o.fw.Close()
+	o.fw, o.date = nil, ""
+	return err
+}
+
+type tickCSVOutput struct {
+	w *bufio.Writer
+}
+
+func newTickCSVOutput(f *os.File) *tickCSVOutput {
+	w := bufio.NewWriter(f)
+	w.WriteString("event_time,bid_price,bid_quantity,ask_price,ask_quantity,update_id\n")
+	return &tickCSVOutput{w: w}
+}
+
+func (o *tickCSVOutput) write(ev *orderbook.Event) error {
+	t := ev.GetTick()
+	b := strconv.AppendInt(nil, ev.EventTime, 10)
+	b = appendTickDecimals(b, t)
+	b = strconv.AppendInt(append(b, ','), t.UpdateId, 10)
+	_, err := o.w.Write(append(b, '\n'))
+	return err
+}
+
+func (o *tickCSVOutput) Close() error {
+	return o.w.Flush()
+}
+
+// ,bid_price,bid_quantity,ask_price,ask_quantity (원래 문자열이 있으면 그대로)
+func appendTickDecimals(b []byte, t *orderbook.Tick) []byte {
+	b = orderbook.AppendDecimal(append(b, ','), t.BidPriceText, t.BidPrice)
+	b = orderbook.AppendDecimal(append(b, ','), t.BidQuantityText, t.BidQuantity)
+	b = orderbook.AppendDecimal(append(b, ','), t.AskPriceText, t.AskPrice)
+	return orderbook.AppendDecimal(append(b, ','), t.AskQuantityText, t.AskQuantity)
+}
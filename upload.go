@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"orderbook/orderbook"
+)
+
+// 회전으로 닫힌 데이터 파일을 오브젝트 스토리지에 올린다. 수집기는 파일이 회전될 때마다 큐에 넣고
+// 백그라운드에서 올리며, 재시작 등으로 빠진 파일은 upload 명령으로 올린다.
+//
+// 오브젝트 키는 <prefix>/<데이터 디렉터리 기준 경로>[.zst]. 수집기의 ticks, liquidations, tickers 디렉터리는
+// 데이터 파일과 이름이 겹치므로 <prefix>/<ticks 등>/<디렉터리 기준 경로> 로 올린다 (upload 명령으로 올릴 때는
+// -upload 에 /ticks 등을 붙인다). 업로드는 Content-MD5 로 스토리지가 내용을 검증하고, 끝난 뒤 HEAD 로 크기를 확인한다. 확인된 뒤에만 로컬 파일을 지운다.
+
+type uploadOptions struct {
+	target      string
+	compress    bool
+	deleteLocal bool
+	retries     int
+}
+
+func (o *uploadOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.target, "upload", "", "upload rotated files to object storage (s3://bucket/prefix or gs://bucket/prefix)")
+	fs.BoolVar(&o.compress, "upload-compress", false, "zstd-compress uncompressed files before uploading")
+	fs.BoolVar(&o.deleteLocal, "upload-delete", false, "delete the local file once the upload is verified")
+	fs.IntVar(&o.retries, "upload-retries", 5, "attempts per file before giving up")
+}
+
+type uploader struct {
+	opts      uploadOptions
+	store     *objectStore
+	dataDir   string
+	keyPrefix string // 데이터 디렉터리 기준 경로 앞에 붙인다. 비어 있으면 붙이지 않는다
+	queue     chan string
+}
+
+func newUploader(opts uploadOptions, dataDir, keyPrefix string) (*uploader, error) {
+	store, err := openObjectStore(opts.target)
+	if err != nil {
+		return nil, err
+	}
+	return &uploader{opts: opts, store: store, dataDir: dataDir, keyPrefix: keyPrefix, queue: make(chan string, 1024)}, nil
+}
+
+// 막히지 않는다. 큐가 가득 차면 로그만 남기고 upload 명령으로 나중에 올리게 한다.
+func (u *uploader) enqueue(path string) {
+	select {
+	case u.queue <- path:
+	default:
+		log.Printf("Upload queue full, %s must be uploaded later with 'orderbook upload'", path)
+	}
+}
+
+func (u *uploader) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case path := <-u.queue:
+			if err := u.upload(ctx, path); err != nil {
+				log.Printf("Upload of %s failed: %v", path, err)
+			}
+		}
+	}
+}
+
+// 파일 하나를 (필요하면 압축해) 올리고 검증한다. 실패하면 지수 백오프로 opts.retries 번까지 시도한다.
+func (u *uploader) upload(ctx context.Context, path string) error {
+	rel, err := filepath.Rel(u.dataDir, path)
+	if err != nil {
+		return err
+	}
+	rel = filepath.ToSlash(rel)
+	if u.keyPrefix != "" {
+		rel = u.keyPrefix + "/" + rel
+	}
+	key := u.store.key(rel)
+
+	src := path
+	if u.opts.compress && !zstdFile(path) {
+		tmp, err := compressFile(path)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp)
+		src, key = tmp, key+".zst"
+	}
+
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	size, md5b64, sha256hex, err := hashFile(f)
+	if err != nil {
+		return err
+	}
+
+	backoff := time.Second
+	for attempt := 1; ; attempt++ {
+		if _, err = f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		if err = u.store.Put(ctx, key, f, size, md5b64, sha256hex); err == nil {
+			var got int64
+			if got, err = u.store.Size(ctx, key); err == nil && got != size {
+				err = fmt.Errorf("uploaded object is %d bytes, expected %d", got, size)
+			}
+		}
+		if err == nil {
+			break
+		}
+		if attempt >= u.opts.retries || ctx.Err() != nil {
+			return err
+		}
+		log.Printf("Upload of %s failed (attempt %d/%d), retrying in %s: %v", path, attempt, u.opts.retries, backoff, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, time.Minute)
+	}
+	log.Printf("Uploaded %s to %s (%s)", path, key, formatBytes(size))
+
+	if u.opts.deleteLocal {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		os.Remove(orderbook.SidecarPath(path))
+		log.Printf("Deleted local copy %s", path)
+	}
+	return nil
+}
+
+func hashFile(f *os.File) (size int64, md5b64, sha256hex string, err error) {
+	m, s := md5.New(), sha256.New()
+	if size, err = io.Copy(io.MultiWriter(m, s), f); err != nil {
+		return 0, "", "", err
+	}
+	return size, base64.StdEncoding.EncodeToString(m.Sum(nil)), hex.EncodeToString(s.Sum(nil)), nil
+}
+
+// 첫 세션이 이미 zstd 블록으로 쓰였는지. 다시 압축해도 줄지 않는다.
+func zstdFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	r := orderbook.NewReader(f)
+	if _, err := r.Next(); err != nil {
+		return false
+	}
+	return r.Header != nil && r.Header.Compression == orderbook.Compression_COMPRESSION_ZSTD
+}
+
+// path 를 zstd 로 압축한 임시 파일을 만든다. 호출자가 지운다.
+func compressFile(path string) (string, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	out, err := os.CreateTemp("", filepath.Base(path)+".*.zst")
+	if err != nil {
+		return "", err
+	}
+	enc, err := zstd.NewWriter(out)
+	if err == nil {
+		_, err = io.Copy(enc, in)
+		if cerr := enc.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(out.Name())
+		return "", err
+	}
+	return out.Name(), nil
+}
+
+// orderbook upload -upload s3://bucket/prefix [flags] <file>... : 수집기가 올리지 못한 파일을 올린다
+func runUpload(args []string) error {
+	fs := flag.NewFlagSet("upload", flag.ExitOnError)
+	dataDir := fs.String("data", defaultDataDir, "data directory the files belong to (object keys are relative to it)")
+	var opts uploadOptions
+	opts.register(fs)
+	var jobOpts jobOptions
+	jobOpts.register(fs, "")
+	fs.Parse(args)
+	if opts.target == "" || fs.NArg() == 0 {
+		return fmt.Errorf("usage: orderbook upload -upload <s3://bucket/prefix> [flags] <file>...")
+	}
+
+	u, err := newUploader(opts, *dataDir, "")
+	if err != nil {
+		return err
+	}
+	var units []jobUnit
+	for _, path := range fs.Args() {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		units = append(units, jobUnit{name: path, size: fi.Size()})
+	}
+	cp, err := openCheckpoint(jobOpts.checkpoint, "upload", opts.target, jobOpts.resume)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := interruptContext()
+	defer cancel()
+	return runJob(ctx, jobOpts, cp, units, func(ctx context.Context, unit jobUnit, p *Progress) error {
+		defer p.Add(unit.size)
+		return u.upload(ctx, unit.name)
+	})
+}
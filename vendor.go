@@ -0,0 +1,637 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"compress/gzip"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"orderbook/orderbook"
+)
+
+// orderbook import-vendor <csv 파일>... : 구입한 외부 업체 데이터(Tardis, crypto-lake 의 CSV)를 데이터 파일로 바꾼다.
+// 우리 수집에 빠진 구간을 채워 같은 Reader 와 명령(read, fill, stats 등)으로 읽게 한다.
+//
+// 파일 종류는 머리글 줄로 알아낸다 (.csv.gz 도 된다).
+//
+//	Tardis incremental_book_L2   exchange,symbol,timestamp,local_timestamp,is_snapshot,side,price,amount
+//	Tardis book_snapshot_N       exchange,symbol,timestamp,local_timestamp,asks[0].price,asks[0].amount,bids[0].price,...
+//	Tardis trades                exchange,symbol,timestamp,local_timestamp,id,side,price,amount
+//	crypto-lake book             received_time,origin_time,...,bid_0_price,bid_0_size,...,ask_0_price,ask_0_size,...
+//	crypto-lake trades           received_time,origin_time,side,quantity,price,trade_id,symbol,...
+//
+// 레코드는 수집기 것과 같은 payload 로 옮기고 stream_type 의 @ 뒤에 업체 이름을 남긴다.
+//   - 증분 책의 스냅샷 줄(is_snapshot)은 책 전체라서 orderbook.VendorSnapshotStreamType 스냅샷이 되고, 나머지는
+//     같은 시각의 줄끼리 묶어 depth@tardis 증분이 된다. 업체 데이터에 update id 가 없으므로 1 씩 늘어나는 번호를
+//     붙여 재구성이 스냅샷부터 이어지게 한다 (거래소의 U/u 와는 관계없다)
+//   - 상위 N 호가 스냅샷은 depth<N>@tardis, depth<N>@cryptolake, 체결은 trade 다
+//   - event_time 과 receive_time_ns 는 업체의 수신 시각, exchange_time 은 거래소 시각이다
+//
+// 파일을 여러 개 넘기면(같은 날의 책과 체결 등) 수신 시각 순으로 섞어 심볼, 날짜마다 파일 하나
+// (<symbol>_<date>@<업체>.bin)에 쓴다. 세션 ID 는 <업체>-<date> 이다. 이미 있는 파일은 건너뛴다 (-force 로 다시 만든다).
+
+// 업체의 거래소 이름 -> 우리 거래소, 시장
+var tardisExchanges = map[string]struct{ exchange, marketType string }{
+	"binance":         {"binance", "spot"},
+	"binance-futures": {"binance", "usdm_futures"},
+}
+
+var cryptoLakeExchanges = map[string]struct{ exchange, marketType string }{
+	"BINANCE":         {"binance", "spot"},
+	"BINANCE_FUTURES": {"binance", "usdm_futures"},
+}
+
+// CSV 파일 하나를 이벤트로 바꾼다. 순번은 쓰는 쪽이 매긴다.
+type vendorSource struct {
+	path    string
+	vendor  string // tardis, cryptolake
+	dataset string
+	file    *os.File
+	rows    *csv.Reader
+	col     map[string]int
+	row     []string // 이미 읽었지만 아직 이벤트로 만들지 않은 줄
+	line    int
+	next    func() (*orderbook.Event, error)
+	head    *orderbook.Event // 다음에 쓸 이벤트 (merge 용)
+
+	ids vendorUpdateIDs
+}
+
+// 심볼마다 이어 붙이는 update id
+type vendorUpdateIDs map[string]int64
+
+func (ids vendorUpdateIDs) next(symbol string) int64 {
+	ids[symbol]++
+	return ids[symbol]
+}
+
+func runImportVendor(args []string) error {
+	fs := flag.NewFlagSet("import-vendor", flag.ExitOnError)
+	dataDir := fs.String("data", defaultDataDir, "data directory to import into")
+	symbol := fs.String("symbol", "", "use this symbol instead of the one in the files (e.g. when the vendor names it BTC-USDT)")
+	instance := fs.String("instance", "", "instance id added to the file names (default: the vendor name, tardis or cryptolake)")
+	compression := fs.String("compression", "zstd", "data file compression: none or zstd")
+	keepDecimals := fs.Bool("keep-decimals", false, "also store the vendor's original price/quantity strings")
+	force := fs.Bool("force", false, "rebuild files that already exist")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: orderbook import-vendor [flags] <csv file>...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("no input files")
+	}
+	var comp orderbook.Compression
+	switch *compression {
+	case "none":
+		comp = orderbook.Compression_COMPRESSION_NONE
+	case "zstd":
+		comp = orderbook.Compression_COMPRESSION_ZSTD
+	default:
+		return fmt.Errorf("unknown compression %q", *compression)
+	}
+	keepDecimalText = *keepDecimals
+
+	ids := make(vendorUpdateIDs)
+	var sources []*vendorSource
+	defer func() {
+		for _, s := range sources {
+			s.file.Close()
+		}
+	}()
+	for _, path := range fs.Args() {
+		s, err := openVendorSource(path, ids)
+		if err != nil {
+			return err
+		}
+		sources = append(sources, s)
+		if s.vendor != sources[0].vendor && *instance == "" {
+			return fmt.Errorf("%s is %s data but %s is %s; import them separately or set -instance", path, s.vendor, sources[0].path, sources[0].vendor)
+		}
+		log.Printf("%s: %s %s", path, s.vendor, s.dataset)
+	}
+	if *instance == "" {
+		*instance = sources[0].vendor
+	}
+	rotation, err := newRotationPolicy(rotateDaily, 0, "", *instance, restartAppend)
+	if err != nil {
+		return err
+	}
+
+	w := &vendorWriter{
+		dataDir:     *dataDir,
+		rotation:    rotation,
+		vendor:      *instance,
+		compression: comp,
+		force:       *force,
+		files:       make(map[string]*vendorFile),
+	}
+	// 첫 이벤트를 읽어 두고 수신 시각이 가장 이른 것부터 쓴다. 파일이 몇 개뿐이라 매번 훑는다.
+	for _, s := range sources {
+		if err := s.advance(*symbol); err != nil {
+			return err
+		}
+		if s.head != nil {
+			w.streams(s.head.Symbol, s.streamTypes(s.head))
+		}
+	}
+	for {
+		var first *vendorSource
+		for _, s := range sources {
+			if s.head != nil && (first == nil || s.head.ReceiveTimeNs < first.head.ReceiveTimeNs) {
+				first = s
+			}
+		}
+		if first == nil {
+			break
+		}
+		if err := w.write(first.head); err != nil {
+			w.abort()
+			return err
+		}
+		if err := first.advance(*symbol); err != nil {
+			w.abort()
+			return err
+		}
+	}
+	return w.close()
+}
+
+func openVendorSource(path string, ids vendorUpdateIDs) (*vendorSource, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	var r io.Reader = bufio.NewReaderSize(f, 1<<16)
+	if strings.HasSuffix(path, ".gz") {
+		if r, err = gzip.NewReader(r); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	s := &vendorSource{path: path, file: f, rows: csv.NewReader(r), col: make(map[string]int), ids: ids}
+	s.rows.ReuseRecord = true
+	s.rows.FieldsPerRecord = -1
+	header, err := s.rows.Read()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: reading header: %w", path, err)
+	}
+	for i, name := range header {
+		s.col[strings.TrimSpace(name)] = i
+	}
+	s.line = 1
+
+	has := func(names ...string) bool {
+		for _, n := range names {
+			if _, ok := s.col[n]; !ok {
+				return false
+			}
+		}
+		return true
+	}
+	switch {
+	case has("exchange", "symbol", "timestamp", "local_timestamp", "is_snapshot", "side", "price", "amount"):
+		s.vendor, s.dataset, s.next = "tardis", "incremental_book_L2", s.tardisIncremental
+	case has("exchange", "symbol", "timestamp", "local_timestamp", "asks[0].price", "bids[0].price"):
+		s.vendor, s.dataset, s.next = "tardis", fmt.Sprintf("book_snapshot_%d", s.levels("asks[%d].price")), s.tardisSnapshot
+	case has("exchange", "symbol", "timestamp", "local_timestamp", "id", "side", "price", "amount"):
+		s.vendor, s.dataset, s.next = "tardis", "trades", s.tardisTrade
+	case has("received_time", "bid_0_price", "ask_0_price"):
+		s.vendor, s.dataset, s.next = "cryptolake", "book", s.cryptoLakeBook
+	case has("received_time", "side", "quantity", "price", "trade_id"):
+		s.vendor, s.dataset, s.next = "cryptolake", "trades", s.cryptoLakeTrade
+	default:
+		f.Close()
+		return nil, fmt.Errorf("%s: unknown CSV format (header %s)", path, strings.Join(header, ","))
+	}
+	return s, nil
+}
+
+// 이름 틀(asks[%d].price 등)에 맞는 열이 0 부터 몇 개 있는지
+func (s *vendorSource) levels(format string) int {
+	n := 0
+	for {
+		if _, ok := s.col[fmt.Sprintf(format, n)]; !ok {
+			return n
+		}
+		n++
+	}
+}
+
+// 세션 헤더의 streams 에 남길 stream_type
+func (s *vendorSource) streamTypes(ev *orderbook.Event) []string {
+	switch s.dataset {
+	case "incremental_book_L2":
+		return []string{orderbook.VendorSnapshotStreamType, "depth@" + s.vendor}
+	case "trades":
+		return []string{"trade"}
+	default:
+		return []string{ev.StreamType}
+	}
+}
+
+func (s *vendorSource) advance(symbol string) error {
+	ev, err := s.next()
+	if errors.Is(err, io.EOF) {
+		s.head = nil
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%s: line %d: %w", s.path, s.line, err)
+	}
+	if symbol != "" {
+		ev.Symbol = strings.ToUpper(symbol)
+	}
+	s.head = ev
+	return nil
+}
+
+// 다음 줄. 앞에서 읽어 둔 줄이 있으면 그것
+func (s *vendorSource) read() ([]string, error) {
+	if s.row != nil {
+		row := s.row
+		s.row = nil
+		return row, nil
+	}
+	row, err := s.rows.Read()
+	if err == nil {
+		s.line++
+	}
+	return row, err
+}
+
+// 다음 read 가 같은 줄을 돌려주도록 되돌린다. ReuseRecord 이므로 복사해 둔다.
+func (s *vendorSource) unread(row []string) {
+	s.row = slices.Clone(row)
+}
+
+func (s *vendorSource) field(row []string, name string) string {
+	if i, ok := s.col[name]; ok && i < len(row) {
+		return row[i]
+	}
+	return ""
+}
+
+func (s *vendorSource) level(price, quantity string) *orderbook.Level {
+	l := &orderbook.Level{Price: parseFloat(price), Quantity: parseFloat(quantity)}
+	if keepDecimalText {
+		l.PriceText, l.QuantityText = strings.Clone(price), strings.Clone(quantity)
+	}
+	return l
+}
+
+// 업체의 거래소 이름과 심볼, 시각으로 이벤트의 공통 필드를 채운다
+func (s *vendorSource) event(venue, symbol, streamType string, exchangeNs, receivedNs int64) (*orderbook.Event, error) {
+	var m struct{ exchange, marketType string }
+	var ok bool
+	if s.vendor == "tardis" {
+		m, ok = tardisExchanges[venue]
+	} else {
+		m, ok = cryptoLakeExchanges[venue]
+	}
+	if !ok {
+		return nil, fmt.Errorf("unsupported %s exchange %q", s.vendor, venue)
+	}
+	ev := &orderbook.Event{
+		EventTime:     receivedNs / int64(time.Millisecond),
+		ReceiveTimeNs: receivedNs,
+		Symbol:        strings.ToUpper(strings.ReplaceAll(symbol, "-", "")),
+		Exchange:      m.exchange,
+		MarketType:    m.marketType,
+		StreamType:    streamType,
+		ExchangeTime:  exchangeNs / int64(time.Millisecond),
+	}
+	if exchangeNs != 0 {
+		ev.LatencyUs = (receivedNs - exchangeNs) / int64(time.Microsecond)
+	}
+	return ev, nil
+}
+
+// Tardis 의 timestamp, local_timestamp (UTC 마이크로초)
+func (s *vendorSource) tardisTimes(row []string) (exchangeNs, receivedNs int64, err error) {
+	ts, err := strconv.ParseInt(s.field(row, "timestamp"), 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("timestamp: %w", err)
+	}
+	local, err := strconv.ParseInt(s.field(row, "local_timestamp"), 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("local_timestamp: %w", err)
+	}
+	return ts * int64(time.Microsecond), local * int64(time.Microsecond), nil
+}
+
+// 같은 local_timestamp, 같은 is_snapshot 인 줄을 한 이벤트로 묶는다.
+// 스냅샷 줄의 묶음은 책 전체를 바꾸고, 다른 줄은 증분이다 (amount 0 은 호가 삭제).
+func (s *vendorSource) tardisIncremental() (*orderbook.Event, error) {
+	row, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	exchangeNs, receivedNs, err := s.tardisTimes(row)
+	if err != nil {
+		return nil, err
+	}
+	local, snapshot := s.field(row, "local_timestamp"), s.field(row, "is_snapshot") == "true"
+	streamType := "depth@" + s.vendor
+	if snapshot {
+		streamType = orderbook.VendorSnapshotStreamType
+	}
+	ev, err := s.event(s.field(row, "exchange"), s.field(row, "symbol"), streamType, exchangeNs, receivedNs)
+	if err != nil {
+		return nil, err
+	}
+	var bids, asks []*orderbook.Level
+	for {
+		l := s.level(s.field(row, "price"), s.field(row, "amount"))
+		switch s.field(row, "side") {
+		case "bid":
+			bids = append(bids, l)
+		case "ask":
+			asks = append(asks, l)
+		default:
+			return nil, fmt.Errorf("unknown side %q", s.field(row, "side"))
+		}
+		if row, err = s.read(); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if s.field(row, "local_timestamp") != local || (s.field(row, "is_snapshot") == "true") != snapshot {
+			s.unread(row)
+			break
+		}
+	}
+
+	id := s.ids.next(ev.Symbol)
+	if snapshot {
+		// 스냅샷 줄은 가격순이 아닐 수 있다
+		slices.SortFunc(bids, func(a, b *orderbook.Level) int { return cmp.Compare(b.Price, a.Price) })
+		slices.SortFunc(asks, func(a, b *orderbook.Level) int { return cmp.Compare(a.Price, b.Price) })
+		ev.Payload = &orderbook.Event_Snapshot{Snapshot: &orderbook.Snapshot{EventTime: ev.EventTime, LastUpdateId: id, Bids: bids, Asks: asks}}
+	} else {
+		ev.Payload = &orderbook.Event_DepthDiff{DepthDiff: &orderbook.DepthDiff{FirstUpdateId: id, FinalUpdateId: id, Bids: bids, Asks: asks}}
+	}
+	return ev, nil
+}
+
+func (s *vendorSource) tardisSnapshot() (*orderbook.Event, error) {
+	row, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	exchangeNs, receivedNs, err := s.tardisTimes(row)
+	if err != nil {
+		return nil, err
+	}
+	n := s.levels("asks[%d].price")
+	ev, err := s.event(s.field(row, "exchange"), s.field(row, "symbol"), fmt.Sprintf("depth%d@%s", n, s.vendor), exchangeNs, receivedNs)
+	if err != nil {
+		return nil, err
+	}
+	snap := &orderbook.Snapshot{EventTime: ev.EventTime}
+	// 호가가 N 개보다 적으면 남는 열은 비어 있다
+	for i := range n {
+		if p := s.field(row, fmt.Sprintf("bids[%d].price", i)); p != "" {
+			snap.Bids = append(snap.Bids, s.level(p, s.field(row, fmt.Sprintf("bids[%d].amount", i))))
+		}
+		if p := s.field(row, fmt.Sprintf("asks[%d].price", i)); p != "" {
+			snap.Asks = append(snap.Asks, s.level(p, s.field(row, fmt.Sprintf("asks[%d].amount", i))))
+		}
+	}
+	ev.Payload = &orderbook.Event_Snapshot{Snapshot: snap}
+	return ev, nil
+}
+
+// side 는 taker 방향이다 (sell 이면 매수자가 maker)
+func (s *vendorSource) tardisTrade() (*orderbook.Event, error) {
+	row, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	exchangeNs, receivedNs, err := s.tardisTimes(row)
+	if err != nil {
+		return nil, err
+	}
+	ev, err := s.event(s.field(row, "exchange"), s.field(row, "symbol"), "trade", exchangeNs, receivedNs)
+	if err != nil {
+		return nil, err
+	}
+	id, _ := strconv.ParseInt(s.field(row, "id"), 10, 64)
+	ev.Payload = &orderbook.Event_Trade{Trade: s.trade(id, s.field(row, "price"), s.field(row, "amount"), ev.ExchangeTime, s.field(row, "side") == "sell")}
+	return ev, nil
+}
+
+func (s *vendorSource) trade(id int64, price, quantity string, at int64, buyerIsMaker bool) *orderbook.Trade {
+	t := &orderbook.Trade{TradeId: id, Price: parseFloat(price), Quantity: parseFloat(quantity), TradeTime: at, BuyerIsMaker: buyerIsMaker}
+	if keepDecimalText {
+		t.PriceText, t.QuantityText = strings.Clone(price), strings.Clone(quantity)
+	}
+	return t
+}
+
+// crypto-lake 의 received_time, origin_time. 내보낸 도구에 따라 정수(ns, µs, ms)이거나 날짜 문자열이다.
+func (s *vendorSource) cryptoLakeTimes(row []string) (exchangeNs, receivedNs int64, err error) {
+	if receivedNs, err = vendorTime(s.field(row, "received_time")); err != nil {
+		return 0, 0, fmt.Errorf("received_time: %w", err)
+	}
+	if origin := s.field(row, "origin_time"); origin != "" {
+		if exchangeNs, err = vendorTime(origin); err != nil {
+			return 0, 0, fmt.Errorf("origin_time: %w", err)
+		}
+	}
+	return exchangeNs, receivedNs, nil
+}
+
+func vendorTime(s string) (int64, error) {
+	if v, err := strconv.ParseInt(s, 10, 64); err == nil {
+		switch {
+		case v >= 1e17:
+			return v, nil
+		case v >= 1e14:
+			return v * int64(time.Microsecond), nil
+		default:
+			return v * int64(time.Millisecond), nil
+		}
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999", "2006-01-02 15:04:05.999999999Z07:00"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UnixNano(), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid time %q", s)
+}
+
+// crypto-lake 는 심볼(BTC-USDT)과 거래소(BINANCE)를 열로 두지만 내보낼 때 빼는 경우가 많아 없으면 바이낸스 현물로 본다
+func (s *vendorSource) cryptoLakeVenue(row []string) (venue, symbol string) {
+	venue, symbol = s.field(row, "exchange"), s.field(row, "symbol")
+	if venue == "" {
+		venue = "BINANCE"
+	}
+	return strings.ToUpper(venue), symbol
+}
+
+func (s *vendorSource) cryptoLakeBook() (*orderbook.Event, error) {
+	row, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	exchangeNs, receivedNs, err := s.cryptoLakeTimes(row)
+	if err != nil {
+		return nil, err
+	}
+	n := max(s.levels("bid_%d_price"), s.levels("ask_%d_price"))
+	venue, symbol := s.cryptoLakeVenue(row)
+	ev, err := s.event(venue, symbol, fmt.Sprintf("depth%d@%s", n, s.vendor), exchangeNs, receivedNs)
+	if err != nil {
+		return nil, err
+	}
+	snap := &orderbook.Snapshot{EventTime: ev.EventTime}
+	snap.LastUpdateId, _ = strconv.ParseInt(s.field(row, "sequence_number"), 10, 64)
+	for i := range n {
+		if p := s.field(row, fmt.Sprintf("bid_%d_price", i)); p != "" {
+			snap.Bids = append(snap.Bids, s.level(p, s.field(row, fmt.Sprintf("bid_%d_size", i))))
+		}
+		if p := s.field(row, fmt.Sprintf("ask_%d_price", i)); p != "" {
+			snap.Asks = append(snap.Asks, s.level(p, s.field(row, fmt.Sprintf("ask_%d_size", i))))
+		}
+	}
+	ev.Payload = &orderbook.Event_Snapshot{Snapshot: snap}
+	return ev, nil
+}
+
+func (s *vendorSource) cryptoLakeTrade() (*orderbook.Event, error) {
+	row, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	exchangeNs, receivedNs, err := s.cryptoLakeTimes(row)
+	if err != nil {
+		return nil, err
+	}
+	venue, symbol := s.cryptoLakeVenue(row)
+	ev, err := s.event(venue, symbol, "trade", exchangeNs, receivedNs)
+	if err != nil {
+		return nil, err
+	}
+	id, _ := strconv.ParseInt(s.field(row, "trade_id"), 10, 64)
+	ev.Payload = &orderbook.Event_Trade{Trade: s.trade(id, s.field(row, "price"), s.field(row, "quantity"), ev.ExchangeTime, strings.EqualFold(s.field(row, "side"), "sell"))}
+	return ev, nil
+}
+
+// 심볼, 날짜마다 파일을 열어 두고 모두 끝나면 이름을 바꾼다
+type vendorWriter struct {
+	dataDir     string
+	rotation    *rotationPolicy
+	vendor      string
+	compression orderbook.Compression
+	force       bool
+
+	files       map[string]*vendorFile // 최종 경로 -> 파일
+	symbolTypes map[string][]string    // 심볼 -> 세션 헤더의 streams
+}
+
+type vendorFile struct {
+	fw       *orderbook.FileWriter // 이미 있어 건너뛰는 파일이면 nil
+	sequence uint64
+}
+
+func (w *vendorWriter) streams(symbol string, types []string) {
+	if w.symbolTypes == nil {
+		w.symbolTypes = make(map[string][]string)
+	}
+	for _, t := range types {
+		if !slices.Contains(w.symbolTypes[symbol], t) {
+			w.symbolTypes[symbol] = append(w.symbolTypes[symbol], t)
+		}
+	}
+}
+
+func (w *vendorWriter) write(ev *orderbook.Event) error {
+	day := time.Unix(0, ev.ReceiveTimeNs).UTC()
+	target := w.rotation.path(w.dataDir, ev.Symbol, day, 0, "")
+	f, ok := w.files[target]
+	if !ok {
+		f = &vendorFile{}
+		w.files[target] = f
+		if _, err := os.Stat(target); err == nil && !w.force {
+			log.Printf("%s already exists, skipping (use -force to rebuild)", target)
+		} else {
+			if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+				return err
+			}
+			fw, err := orderbook.OpenFileWriter(target+".tmp", &orderbook.FileHeader{
+				CreatedAt:   time.Now().UTC().UnixMilli(),
+				Symbol:      ev.Symbol,
+				Exchange:    ev.Exchange,
+				MarketType:  ev.MarketType,
+				SessionId:   w.vendor + "-" + day.Format(dateLayout),
+				Compression: w.compression,
+				Streams:     w.symbolTypes[ev.Symbol],
+			})
+			if err != nil {
+				return err
+			}
+			f.fw = fw
+		}
+	}
+	if f.fw == nil {
+		return nil
+	}
+	f.sequence++
+	ev.Sequence = f.sequence
+	return f.fw.Write(ev)
+}
+
+// 실패하면 임시 파일을 지운다
+func (w *vendorWriter) abort() {
+	for target, f := range w.files {
+		if f.fw != nil {
+			f.fw.Close()
+			os.Remove(target + ".tmp")
+			orderbook.RemoveSidecar(target + ".tmp")
+		}
+	}
+}
+
+func (w *vendorWriter) close() error {
+	manifest := newManifestUpdater(w.dataDir, nil)
+	targets := slices.Sorted(maps.Keys(w.files))
+	var firstErr error
+	for _, target := range targets {
+		f := w.files[target]
+		if f.fw == nil {
+			continue
+		}
+		tmp := target + ".tmp"
+		err := f.fw.Close()
+		if err == nil {
+			orderbook.RemoveSidecar(target) // -force 로 다시 만든 파일의 예전 인덱스
+			err = os.Rename(tmp, target)
+		}
+		orderbook.RemoveSidecar(tmp)
+		if err == nil {
+			log.Printf("Imported %s: %d records", target, f.sequence)
+			err = manifest.add(target)
+		} else {
+			os.Remove(tmp)
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
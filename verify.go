@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"orderbook/orderbook"
+)
+
+// orderbook verify <file|symbol|date>... : 파일의 모든 레코드를 읽어 무결성을 확인한다 (stats 와 같은 인자).
+//
+//	framing    프레임 길이가 한도를 넘는다. 그 뒤는 프레임 경계를 알 수 없어 읽지 않는다
+//	truncated  레코드(또는 압축 블록 안의 프레임)가 잘렸다
+//	decode     세션 헤더, zstd 블록, protobuf 를 풀 수 없다
+//	time       EventTime 이 앞 레코드보다 이르다
+//	index      footer/사이드카 인덱스가 깨졌거나 항목이 가리키는 블록이 맞지 않는다
+//	checksum   manifest.json 의 SHA-256 과 다르다 (크기와 수정 시각이 manifest 와 같은 파일만)
+//
+// 파일 포맷에는 레코드별 CRC 가 없으므로 내용 손상은 manifest 체크섬으로만 잡힌다.
+// 문제가 하나라도 있으면 파일별 보고를 출력하고 종료 코드 1 로 끝난다.
+
+type verifyIssue struct {
+	offset int64
+	kind   string
+	detail string
+}
+
+type fileVerification struct {
+	path        string
+	records     int64
+	sessions    int
+	first, last int64
+	checksum    string // "ok", "mismatch" 또는 manifest 에 없으면 ""
+	issues      []verifyIssue
+}
+
+func (v *fileVerification) add(offset int64, kind, format string, args ...any) {
+	v.issues = append(v.issues, verifyIssue{offset: offset, kind: kind, detail: fmt.Sprintf(format, args...)})
+}
+
+func runVerify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	dataDir := fs.String("data", defaultDataDir, "data directory for symbol and date arguments (and manifest checksums)")
+	allowPartial := fs.Bool("allow-partial", false, "accept a truncated final record (files still being written)")
+	maxIssues := fs.Int("max-issues", 20, "issues to print per file (all are counted)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: orderbook verify [flags] <file|symbol|date>...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("nothing to verify")
+	}
+
+	var files []string
+	for _, arg := range fs.Args() {
+		groups, err := statsTargets(*dataDir, arg, math.MinInt64, math.MaxInt64)
+		if err != nil {
+			return err
+		}
+		for _, g := range groups {
+			files = append(files, g.files...)
+		}
+	}
+	m, err := loadManifest(*dataDir)
+	if err != nil {
+		log.Printf("Not checking checksums: %v", err)
+		m = &catalogManifest{}
+	}
+	sums := make(map[string]manifestFileRow, len(m.Files))
+	for _, f := range m.Files {
+		sums[f.Path] = f
+	}
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+	var failed int
+	for _, path := range files {
+		v, err := verifyFile(ctx, path, *allowPartial, manifestRowFor(*dataDir, path, sums))
+		if err != nil {
+			return err
+		}
+		v.print(os.Stdout, *maxIssues)
+		if len(v.issues) > 0 {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d file(s) failed verification", failed, len(files))
+	}
+	log.Printf("Verified %d file(s)", len(files))
+	return nil
+}
+
+// path 가 데이터 디렉터리 안의 파일이고 manifest 가 지금 크기와 수정 시각으로 기록했으면 그 행
+func manifestRowFor(dataDir, path string, sums map[string]manifestFileRow) *manifestFileRow {
+	rel, err := filepath.Rel(dataDir, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return nil
+	}
+	row, ok := sums[filepath.ToSlash(rel)]
+	if !ok || row.SHA256 == "" {
+		return nil
+	}
+	fi, err := os.Stat(path)
+	if err != nil || fi.Size() != row.Size || !fi.ModTime().UTC().Equal(row.ModTime) {
+		return nil
+	}
+	return &row
+}
+
+func verifyFile(ctx context.Context, path string, allowPartial bool, row *manifestFileRow) (*fileVerification, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	v := &fileVerification{path: path}
+	h := sha256.New()
+	r := orderbook.NewReader(io.TeeReader(f, h))
+	var (
+		header     *orderbook.FileHeader
+		truncated  bool // 마지막 문제가 잘린 레코드이고 그 뒤로 읽은 레코드가 없다
+		lastOffset int64
+	)
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		ev, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		off, _ := r.Position()
+		if r.Header != header {
+			header = r.Header
+			v.sessions++
+		}
+		if err != nil {
+			switch {
+			case errors.Is(err, orderbook.ErrFrameTooLarge):
+				v.add(off, "framing", "%v; rest of file not checked", err)
+			case errors.Is(err, io.ErrUnexpectedEOF):
+				v.add(off, "truncated", "record cut short")
+				truncated = true
+				continue
+			default:
+				v.add(off, "decode", "%v", err)
+				truncated = false
+				continue
+			}
+			break
+		}
+		truncated = false
+		if v.records > 0 && ev.EventTime < v.last {
+			v.add(off, "time", "event time %s is before the previous record's %s", formatMillis(ev.EventTime), formatMillis(v.last))
+		}
+		if v.records == 0 {
+			v.first = ev.EventTime
+		}
+		v.last = max(v.last, ev.EventTime)
+		v.records++
+		lastOffset = off
+	}
+	if truncated && allowPartial {
+		// 쓰는 중인 파일의 마지막 레코드. 앞에서 잘린 것이 아니면 문제로 보지 않는다.
+		if i := len(v.issues) - 1; v.issues[i].offset > lastOffset {
+			v.issues = v.issues[:i]
+		}
+	}
+
+	if row != nil {
+		// 리더가 읽지 않은 나머지까지 (인덱스를 확인하며 위치를 옮기기 전에)
+		if _, err := io.Copy(h, f); err != nil {
+			return nil, err
+		}
+		if sum := hex.EncodeToString(h.Sum(nil)); sum != row.SHA256 {
+			v.checksum = "mismatch"
+			v.add(0, "checksum", "sha256 %s, manifest has %s", sum, row.SHA256)
+		} else {
+			v.checksum = "ok"
+		}
+	}
+	verifyIndex(v, f, fi.Size())
+	return v, nil
+}
+
+// footer 인덱스(없으면 사이드카)의 항목이 차례대로이고 각 항목이 가리키는 블록이 그 시각의 이벤트로 시작하는지 본다
+func verifyIndex(v *fileVerification, f *os.File, size int64) {
+	idx, limit, err := orderbook.ReadIndex(f, size)
+	if err != nil {
+		v.add(0, "index", "footer: %v", err)
+		return
+	}
+	if idx == nil {
+		if idx, err = orderbook.ReadSidecar(f.Name()); err != nil {
+			v.add(0, "index", "%v", err)
+			return
+		}
+		if idx == nil {
+			return
+		}
+		if idx.DataSize > size {
+			v.add(0, "index", "%s is stale (indexed %d bytes, file has %d)", orderbook.SidecarPath(f.Name()), idx.DataSize, size)
+			return
+		}
+		limit = idx.DataSize
+	}
+	for i, e := range idx.Entries {
+		if i > 0 {
+			prev := idx.Entries[i-1]
+			if e.Offset <= prev.Offset || e.EventTime < prev.EventTime {
+				v.add(e.Offset, "index", "entry %d (offset %d, %s) is out of order", i, e.Offset, formatMillis(e.EventTime))
+				continue
+			}
+		}
+		if e.Offset >= limit {
+			v.add(e.Offset, "index", "entry %d points past the indexed data (%d)", i, limit)
+			continue
+		}
+		r, err := orderbook.OpenBlock(f, e)
+		if err != nil {
+			v.add(e.Offset, "index", "entry %d: %v", i, err)
+			continue
+		}
+		ev, err := r.Next()
+		switch {
+		case err != nil:
+			v.add(e.Offset, "index", "entry %d: %v", i, err)
+		case ev.EventTime != e.EventTime:
+			v.add(e.Offset, "index", "entry %d says %s, block starts at %s", i, formatMillis(e.EventTime), formatMillis(ev.EventTime))
+		}
+	}
+}
+
+func (v *fileVerification) print(w io.Writer, maxIssues int) {
+	status := "OK"
+	if len(v.issues) > 0 {
+		status = "FAIL"
+	}
+	fmt.Fprintf(w, "%-4s %s: %d record(s), %d session(s)", status, v.path, v.records, v.sessions)
+	if v.records > 0 {
+		fmt.Fprintf(w, ", %s .. %s", formatMillis(v.first), formatMillis(v.last))
+	}
+	if v.checksum != "" {
+		fmt.Fprintf(w, ", checksum %s", v.checksum)
+	}
+	fmt.Fprintln(w)
+	for i, is := range v.issues {
+		if i == maxIssues {
+			fmt.Fprintf(w, "     ... %d more issue(s)\n", len(v.issues)-maxIssues)
+			break
+		}
+		fmt.Fprintf(w, "     offset %d: %s: %s\n", is.offset, is.kind, is.detail)
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"orderbook/orderbook"
+)
+
+// 증분(depth@...) 스트림으로 오더북을 재구성하면서, 같은 파일에 기록된 스냅샷(depthN@...)을
+// 체크포인트 삼아 재구성 결과가 맞는지 끝까지 대조한다. 처음 어긋나는 지점을 출력한다.
+//
+// 첫 스냅샷으로 책을 시작하므로 그 스냅샷이 덮는 가격 범위 밖은 알 수 없다. 대조는 알고 있는
+// 범위 안에서만 하고, 체크포인트가 일치할 때마다 그 스냅샷 범위만큼 아는 범위를 넓힌다.
+
+func runVerifyBook(args []string) error {
+	fs := flag.NewFlagSet("verify-book", flag.ExitOnError)
+	all := fs.Bool("all", false, "keep going after a divergence (resync from the checkpoint) and report every one")
+	var jobOpts jobOptions
+	jobOpts.register(fs, "")
+	registerTZ(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: orderbook verify-book [flags] <file>...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("no input files")
+	}
+
+	var units []jobUnit
+	for _, path := range fs.Args() {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		units = append(units, jobUnit{name: path, size: fi.Size()})
+	}
+
+	cp, err := openCheckpoint(jobOpts.checkpoint, "verify-book", strings.Join(fs.Args(), ","), jobOpts.resume)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	v := newBookVerifier(*all)
+	err = runJob(ctx, jobOpts, cp, units, func(ctx context.Context, u jobUnit, p *Progress) error {
+		return v.verifyFile(ctx, u.name, p)
+	})
+	v.printSummary()
+	if err != nil {
+		return err
+	}
+	if v.divergences > 0 {
+		return fmt.Errorf("%d divergence(s) found", v.divergences)
+	}
+	return nil
+}
+
+type bookVerifier struct {
+	all  bool
+	book *orderbook.Book
+
+	seeded   bool
+	bidFloor float64 // 정확히 알고 있는 매수 가격 하한
+	askCeil  float64 // 정확히 알고 있는 매도 가격 상한
+	pending  []*orderbook.Event
+
+	diffs, checkpoints, matched, skipped, gaps, divergences int
+
+	truncated int // 끝이 잘린 레코드 (경고만 한다)
+}
+
+func newBookVerifier(all bool) *bookVerifier {
+	return &bookVerifier{all: all, book: orderbook.NewBook()}
+}
+
+func (v *bookVerifier) verifyFile(ctx context.Context, path string, p *Progress) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := orderbook.NewReader(p.Reader(f))
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		ev, err := r.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err == io.ErrUnexpectedEOF {
+			// 수집 중이거나 비정상 종료로 끝이 잘린 레코드. 다른 명령처럼 데이터의 끝으로 본다 (다음에 io.EOF 가 온다)
+			off, _ := r.Position()
+			log.Printf("Warning: %s: record cut short at offset %d (file still being written or truncated)", path, off)
+			v.truncated++
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := v.process(ev); err != nil {
+			return err
+		}
+	}
+}
+
+func (v *bookVerifier) process(ev *orderbook.Event) error {
+	switch p := ev.Payload.(type) {
+	case *orderbook.Event_Snapshot:
+		v.checkpoints++
+		if !v.seeded {
+			v.seed(p.Snapshot)
+			return nil
+		}
+		switch id := p.Snapshot.LastUpdateId; {
+		case id == v.book.LastUpdateID:
+			return v.compare(ev)
+		case id > v.book.LastUpdateID:
+			// 해당 증분이 아직 도착하지 않았다
+			v.pending = append(v.pending, ev)
+		default:
+			v.skipped++
+		}
+
+	case *orderbook.Event_DepthDiff:
+		if !v.seeded {
+			return nil
+		}
+		v.diffs++
+		if _, err := v.book.ApplyDiff(p.DepthDiff); err != nil {
+			if !errors.Is(err, orderbook.ErrSequenceGap) {
+				return err
+			}
+			v.gaps++
+			log.Printf("Gap at %s (seq %d): %v; waiting for the next checkpoint to resync", formatMillis(ev.EventTime), ev.Sequence, err)
+			v.seeded = false
+			v.pending = v.pending[:0]
+			return nil
+		}
+
+		remaining := v.pending[:0]
+		for _, cpEv := range v.pending {
+			switch id := cpEv.GetSnapshot().LastUpdateId; {
+			case id == v.book.LastUpdateID:
+				if err := v.compare(cpEv); err != nil {
+					return err
+				}
+			case id > v.book.LastUpdateID:
+				remaining = append(remaining, cpEv)
+			default:
+				v.skipped++
+			}
+		}
+		v.pending = remaining
+	}
+	return nil
+}
+
+func (v *bookVerifier) seed(s *orderbook.Snapshot) {
+	v.book.LoadSnapshot(s)
+	v.bidFloor, v.askCeil = worstPrice(s.Bids), worstPrice(s.Asks)
+	v.seeded = true
+	v.pending = v.pending[:0]
+}
+
+// 아는 범위 안에서 재구성한 책과 체크포인트를 대조한다. 일치하면 체크포인트 범위만큼 아는 범위를 넓힌다.
+func (v *bookVerifier) compare(ev *orderbook.Event) error {
+	s := ev.GetSnapshot()
+	bidLo := max(v.bidFloor, worstPrice(s.Bids))
+	askHi := min(v.askCeil, worstPrice(s.Asks))
+
+	bookBids := filterLevels(v.book.TopBids(0), func(p float64) bool { return p >= bidLo })
+	snapBids := filterLevels(s.Bids, func(p float64) bool { return p >= bidLo })
+	bookAsks := filterLevels(v.book.TopAsks(0), func(p float64) bool { return p <= askHi })
+	snapAsks := filterLevels(s.Asks, func(p float64) bool { return p <= askHi })
+
+	if msg := diffLevels("bid", bookBids, snapBids); msg == "" {
+		if msg = diffLevels("ask", bookAsks, snapAsks); msg != "" {
+			return v.diverged(ev, msg)
+		}
+	} else {
+		return v.diverged(ev, msg)
+	}
+
+	v.matched++
+	v.adopt(s)
+	return nil
+}
+
+// 일치한 체크포인트의 레벨로 아는 범위 밖을 채운다
+func (v *bookVerifier) adopt(s *orderbook.Snapshot) {
+	if w := worstPrice(s.Bids); len(s.Bids) > 0 && w < v.bidFloor {
+		for p := range v.book.Bids {
+			if p >= w && p < v.bidFloor {
+				delete(v.book.Bids, p)
+			}
+		}
+		for _, l := range s.Bids {
+			v.book.Bids[l.Price] = l.Quantity
+		}
+		v.bidFloor = w
+	}
+	if w := worstPrice(s.Asks); len(s.Asks) > 0 && w > v.askCeil {
+		for p := range v.book.Asks {
+			if p <= w && p > v.askCeil {
+				delete(v.book.Asks, p)
+			}
+		}
+		for _, l := range s.Asks {
+			v.book.Asks[l.Price] = l.Quantity
+		}
+		v.askCeil = w
+	}
+}
+
+func (v *bookVerifier) diverged(ev *orderbook.Event, msg string) error {
+	v.divergences++
+	fmt.Printf("DIVERGENCE at %s (seq %d, updateId %d): %s\n", formatMillis(ev.EventTime), ev.Sequence, ev.GetSnapshot().LastUpdateId, msg)
+	if !v.all {
+		return fmt.Errorf("book diverged from checkpoint")
+	}
+	v.seed(ev.GetSnapshot())
+	return nil
+}
+
+func (v *bookVerifier) printSummary() {
+	fmt.Printf("diffs applied: %d, checkpoints: %d, matched: %d, uncomparable: %d, gaps: %d, divergences: %d, truncated records: %d\n",
+		v.diffs, v.checkpoints, v.matched, v.skipped, v.gaps, v.divergences, v.truncated)
+}
+
+// 스냅샷에서 가장 깊은 레벨의 가격. 비어 있으면 0.
+func worstPrice(levels []*orderbook.Level) float64 {
+	if len(levels) == 0 {
+		return 0
+	}
+	return levels[len(levels)-1].Price
+}
+
+func filterLevels(levels []*orderbook.Level, keep func(price float64) bool) []*orderbook.Level {
+	var out []*orderbook.Level
+	for _, l := range levels {
+		if keep(l.Price) {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+// 처음 다른 레벨을 설명하는 문자열. 같으면 "".
+func diffLevels(side string, got, want []*orderbook.Level) string {
+	for i := 0; i < max(len(got), len(want)); i++ {
+		switch {
+		case i >= len(got):
+			return fmt.Sprintf("%s level %d: missing in rebuilt book, checkpoint has %v@%v", side, i, want[i].Quantity, want[i].Price)
+		case i >= len(want):
+			return fmt.Sprintf("%s level %d: rebuilt book has extra %v@%v", side, i, got[i].Quantity, got[i].Price)
+		case got[i].Price != want[i].Price || got[i].Quantity != want[i].Quantity:
+			return fmt.Sprintf("%s level %d: rebuilt %v@%v, checkpoint %v@%v", side, i, got[i].Quantity, got[i].Price, want[i].Quantity, want[i].Price)
+		}
+	}
+	return ""
+}
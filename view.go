@@ -0,0 +1,385 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+	"orderbook/orderbook"
+)
+
+// 기록된 데이터를 터미널에서 재생하며 보는 뷰어. 비디오 플레이어처럼 조작한다.
+//
+//	space   일시정지 / 재생
+//	n, →    (일시정지 중) 이벤트 하나 앞으로
+//	+, -    재생 속도 2배 / 절반
+//	[, ]    1분 뒤로 / 앞으로
+//	g       시각으로 이동 (RFC3339, YYYY-MM-DD, unix ms 또는 그날의 HH:MM:SS). Enter 로 이동, Esc 로 취소
+//	q       종료
+//
+// 이동하면 그 시각부터 다시 읽으므로, 증분(depth) 스트림만 있는 구간은 다음 스냅샷이 나올 때까지 책이 비어 있다.
+
+func runView(args []string) error {
+	fs := flag.NewFlagSet("view", flag.ExitOnError)
+	symbol := fs.String("symbol", "", "symbol")
+	var rng rangeFlags
+	rng.register(fs)
+	dataDir := fs.String("data", defaultDataDir, "data directory")
+	depth := fs.Int("depth", 10, "levels to show per side")
+	speed := fs.Float64("speed", 1, "initial replay speed (1 = recorded pace)")
+	fs.Parse(args)
+
+	if *symbol == "" {
+		return fmt.Errorf("-symbol is required")
+	}
+	from, to, err := rng.resolve()
+	if err != nil {
+		return err
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return fmt.Errorf("view needs an interactive terminal")
+	}
+	state, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return err
+	}
+	defer term.Restore(int(os.Stdin.Fd()), state)
+	fmt.Print("\x1b[?25l") // 커서 숨김
+	defer fmt.Print("\x1b[?25h\r\n")
+
+	p := newReplayPlayer(*dataDir, strings.ToLower(*symbol), from, to, *speed)
+	defer p.src.stop()
+	return p.run(readKeys(os.Stdin), *depth)
+}
+
+// [from, to) 안의 한 지점부터 이벤트를 읽어 보내는 쪽. seek 하면 읽던 것을 버리고 새 위치에서 다시 읽는다.
+type replaySource struct {
+	dataDir, symbol string
+	from, to        int64
+	events          chan *orderbook.Event
+	cancel          context.CancelFunc
+}
+
+func (s *replaySource) seek(t int64) {
+	s.stop()
+	t = min(max(t, s.from), s.to)
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan *orderbook.Event, 1024)
+	s.events, s.cancel = events, cancel
+	go func() {
+		defer close(events)
+		for _, f := range dataFilesInRange(s.dataDir, s.symbol, t, s.to) {
+			err := scanFile(ctx, f.path, t, s.to, nil, func(r *orderbook.Reader, ev *orderbook.Event) error {
+				select {
+				case events <- ev:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			})
+			if err != nil {
+				return
+			}
+		}
+	}()
+}
+
+func (s *replaySource) stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+}
+
+type replayPlayer struct {
+	src    *replaySource
+	speed  float64
+	paused bool
+	ended  bool
+
+	pos        int64 // 마지막으로 반영한 이벤트 시각
+	next       *orderbook.Event
+	fresh      bool      // 이동한 뒤 아직 이벤트를 받지 않았다. 첫 이벤트까지의 빈 구간은 기다리지 않는다
+	anchorWall time.Time // 재생 기준점: 이 벽시계 시각에 anchorPos 를 보여 준다
+	anchorPos  int64
+
+	book      *orderbook.Book
+	hasBook   bool
+	bookGap   bool
+	lastTrade *orderbook.Trade
+	applied   int
+
+	prompt    bool
+	input     string
+	statusMsg string
+}
+
+func newReplayPlayer(dataDir, symbol string, from, to int64, speed float64) *replayPlayer {
+	p := &replayPlayer{
+		src:   &replaySource{dataDir: dataDir, symbol: symbol, from: from, to: to},
+		speed: speed,
+		book:  orderbook.NewBook(),
+	}
+	p.jump(from)
+	return p
+}
+
+func (p *replayPlayer) jump(t int64) {
+	p.src.seek(t)
+	p.pos, p.next, p.ended, p.fresh = min(max(t, p.src.from), p.src.to), nil, false, true
+	p.book, p.hasBook, p.bookGap, p.lastTrade = orderbook.NewBook(), false, false, nil
+	p.reanchor()
+}
+
+// 일시정지, 속도 변경, 이동 뒤에는 지금 이 순간부터 현재 위치를 기준으로 다시 잰다
+func (p *replayPlayer) reanchor() {
+	p.anchorWall, p.anchorPos = time.Now(), p.pos
+}
+
+func (p *replayPlayer) apply(ev *orderbook.Event) {
+	p.pos = ev.EventTime
+	p.applied++
+	switch pl := ev.Payload.(type) {
+	case *orderbook.Event_Snapshot:
+		p.book.LoadSnapshot(pl.Snapshot)
+		p.hasBook, p.bookGap = true, false
+	case *orderbook.Event_DepthDiff:
+		if p.hasBook {
+			if _, err := p.book.ApplyDiff(pl.DepthDiff); err != nil {
+				p.bookGap = true
+			}
+		}
+	case *orderbook.Event_Trade:
+		p.lastTrade = pl.Trade
+	}
+}
+
+func (p *replayPlayer) run(keys <-chan string, depth int) error {
+	render := time.NewTicker(50 * time.Millisecond)
+	defer render.Stop()
+	dirty := true
+	for {
+		// 다음 이벤트가 없으면 읽어 오고, 재생 중이면 그 이벤트의 시각까지 기다린다
+		var events <-chan *orderbook.Event
+		if p.next == nil && !p.ended {
+			events = p.src.events
+		}
+		var due <-chan time.Time
+		var timer *time.Timer
+		if p.next != nil && !p.paused {
+			d := time.Duration(float64(p.next.EventTime-p.anchorPos)/p.speed*float64(time.Millisecond)) - time.Since(p.anchorWall)
+			timer = time.NewTimer(max(d, 0))
+			due = timer.C
+		}
+
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				p.ended, p.paused = true, true
+				p.statusMsg = "end of data"
+				dirty = true
+			} else {
+				p.next = ev
+				if p.fresh {
+					p.fresh = false
+					p.anchorWall, p.anchorPos = time.Now(), ev.EventTime
+				}
+			}
+		case <-due:
+			p.apply(p.next)
+			p.next = nil
+			dirty = true
+		case k, ok := <-keys:
+			if !ok || !p.handleKey(k) {
+				return nil
+			}
+			dirty = true
+		case <-render.C:
+			if dirty {
+				p.render(depth)
+				dirty = false
+			}
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// false 면 종료
+func (p *replayPlayer) handleKey(k string) bool {
+	p.statusMsg = ""
+	if p.prompt {
+		switch k {
+		case "enter":
+			p.prompt = false
+			t, err := p.parseJump(p.input)
+			if err != nil {
+				p.statusMsg = err.Error()
+				return true
+			}
+			p.jump(t)
+		case "esc":
+			p.prompt = false
+		case "backspace":
+			if p.input != "" {
+				p.input = p.input[:len(p.input)-1]
+			}
+		default:
+			if len(k) == 1 {
+				p.input += k
+			}
+		}
+		return true
+	}
+
+	switch k {
+	case "q", "ctrl-c":
+		return false
+	case " ":
+		if p.ended {
+			return true
+		}
+		p.paused = !p.paused
+		p.reanchor()
+	case "n", "right":
+		if !p.paused {
+			return true
+		}
+		if p.next == nil && !p.ended {
+			if ev, ok := <-p.src.events; ok {
+				p.next = ev
+			} else {
+				p.ended = true
+			}
+		}
+		if p.next != nil {
+			p.apply(p.next)
+			p.next = nil
+		}
+	case "+", "=":
+		p.speed *= 2
+		p.reanchor()
+	case "-":
+		p.speed /= 2
+		p.reanchor()
+	case "[":
+		p.jump(p.pos - int64(time.Minute/time.Millisecond))
+	case "]":
+		p.jump(p.pos + int64(time.Minute/time.Millisecond))
+	case "g":
+		p.prompt, p.input = true, ""
+	}
+	return true
+}
+
+// 이동할 시각. HH:MM[:SS] 는 현재 위치의 -tz 날짜의 그 시각으로 본다.
+func (p *replayPlayer) parseJump(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{"15:04:05", "15:04"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			y, m, d := time.UnixMilli(p.pos).In(displayLoc).Date()
+			return time.Date(y, m, d, t.Hour(), t.Minute(), t.Second(), 0, displayLoc).UnixMilli(), nil
+		}
+	}
+	return parseTime(s)
+}
+
+func (p *replayPlayer) render(depth int) {
+	var b strings.Builder
+	line := func(format string, args ...any) {
+		fmt.Fprintf(&b, format, args...)
+		b.WriteString("\x1b[K\r\n")
+	}
+	b.WriteString("\x1b[H")
+
+	state := "PLAYING"
+	if p.paused {
+		state = "PAUSED"
+	}
+	line("%s  %s  %s  x%g  events %d", strings.ToUpper(p.src.symbol), time.UnixMilli(p.pos).In(displayLoc).Format("2006-01-02 15:04:05.000 MST"), state, p.speed, p.applied)
+	line("")
+
+	switch {
+	case !p.hasBook:
+		line("  (waiting for a snapshot)")
+	default:
+		asks, bids := p.book.TopAsks(depth), p.book.TopBids(depth)
+		for i := len(asks) - 1; i >= 0; i-- {
+			line("  \x1b[31m%16s  %16s\x1b[0m", asks[i].PriceString(), asks[i].QuantityString())
+		}
+		spread := ""
+		if len(asks) > 0 && len(bids) > 0 {
+			spread = fmt.Sprintf("spread %.10g", asks[0].Price-bids[0].Price)
+		}
+		if p.bookGap {
+			spread += "  (sequence gap, book may be stale)"
+		}
+		line("  %s", spread)
+		for _, l := range bids {
+			line("  \x1b[32m%16s  %16s\x1b[0m", l.PriceString(), l.QuantityString())
+		}
+	}
+	line("")
+	if t := p.lastTrade; t != nil {
+		side := "buy"
+		if t.BuyerIsMaker {
+			side = "sell"
+		}
+		line("last trade  %s %s @ %s", side, orderbook.DecimalText(t.QuantityText, t.Quantity), orderbook.DecimalText(t.PriceText, t.Price))
+	} else {
+		line("")
+	}
+	line("")
+	switch {
+	case p.prompt:
+		line("jump to: %s_", p.input)
+	case p.statusMsg != "":
+		line("%s", p.statusMsg)
+	default:
+		line("space pause  n/→ step  +/- speed  [/] ±1m  g jump  q quit")
+	}
+	b.WriteString("\x1b[J")
+	os.Stdout.WriteString(b.String())
+}
+
+// raw 모드 표준 입력을 키 이름으로 바꾼다. → 는 ESC [ C 로 온다.
+func readKeys(f *os.File) <-chan string {
+	keys := make(chan string, 16)
+	go func() {
+		defer close(keys)
+		buf := make([]byte, 16)
+		for {
+			n, err := f.Read(buf)
+			if err != nil {
+				return
+			}
+			in := buf[:n]
+			for len(in) > 0 {
+				switch {
+				case len(in) >= 3 && in[0] == 0x1b && in[1] == '[':
+					if in[2] == 'C' {
+						keys <- "right"
+					}
+					in = in[3:]
+					continue
+				case in[0] == 0x1b:
+					keys <- "esc"
+				case in[0] == '\r' || in[0] == '\n':
+					keys <- "enter"
+				case in[0] == 0x7f || in[0] == 0x08:
+					keys <- "backspace"
+				case in[0] == 0x03:
+					keys <- "ctrl-c"
+				default:
+					keys <- string(in[:1])
+				}
+				in = in[1:]
+			}
+		}
+	}()
+	return keys
+}
@@ -0,0 +1,486 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"orderbook/orderbook"
+)
+
+// orderbook import : data.binance.vision 의 일별 체결(trades), 캔들(klines) 아카이브를 받아 데이터 파일로 바꾼다.
+// 과거 구간을 채워 넣어 수집기가 받은 데이터와 한 데이터 디렉터리에서 함께 읽게 한다.
+//
+//	orderbook import -symbols ethusdt,btcusdt -from 2024-01-01 -to 2024-01-31 -klines 1m
+//
+// 심볼, 날짜마다 파일 하나(<symbol>_<date>@vision.bin)를 만든다. 인스턴스 이름(-instance)이 붙으므로 같은 날
+// 수집기 파일과 섞이지 않고, read, stats 등은 다른 인스턴스 파일처럼 함께 읽는다. 이미 있는 날은 건너뛴다 (-force 로 다시 만든다).
+//
+// 레코드는 라이브 스트림과 같은 모양이다.
+//   - 체결은 stream_type trade 의 Trade. event_time, exchange_time 은 체결 시간이다 (수신 시간이 없다)
+//   - 캔들은 stream_type kline_<interval> 의 Record(binance.kline_<interval>, json). data 는 닫힌 캔들("x":true)의
+//     kline 스트림 메시지이고 event_time 은 캔들 마감 시간이다. 아카이브에 없는 첫/마지막 체결 ID 는 뺀다
+//
+// 두 종류는 시간순으로 섞어 한 세션(session_id vision-<date>)에 쓰고 순번은 1 부터 매긴다.
+// 아카이브마다 .CHECKSUM(sha256)을 받아 확인한다. 그날 아카이브가 없으면(상장 전 등) 그 종류만 건너뛴다.
+// 2025년부터 현물 아카이브의 시간은 마이크로초이므로 자릿수를 보고 맞춘다.
+
+const visionBaseURL = "https://data.binance.vision"
+
+var visionMarkets = map[string]struct{ path, marketType string }{
+	"spot": {"spot", "spot"},
+	"usdm": {"futures/um", "usdm_futures"},
+}
+
+type visionImport struct {
+	baseURL     string
+	path        string // 아카이브 경로의 시장 부분 (spot, futures/um)
+	marketType  string
+	trades      bool
+	intervals   []string
+	dataDir     string
+	rotation    *rotationPolicy
+	compression orderbook.Compression
+	keepText    bool
+	force       bool
+	client      *http.Client
+}
+
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	dataDir := fs.String("data", defaultDataDir, "data directory to import into")
+	symbolList := fs.String("symbols", "", "comma-separated symbols to import")
+	from := fs.String("from", "", "first day to import (YYYY-MM-DD, UTC)")
+	to := fs.String("to", "", "last day to import, inclusive (default -from)")
+	market := fs.String("market", "spot", "archive market: spot or usdm (USD-M futures)")
+	trades := fs.Bool("trades", true, "import the daily trades archives")
+	klines := fs.String("klines", "", "comma-separated kline intervals to import (e.g. 1m,1h); empty imports none")
+	instance := fs.String("instance", "vision", "instance id added to the imported file names so they never collide with collector files")
+	compression := fs.String("compression", "zstd", "data file compression: none or zstd")
+	keepDecimals := fs.Bool("keep-decimals", false, "also store the archive's original price/quantity strings")
+	force := fs.Bool("force", false, "rebuild days that were already imported")
+	baseURL := fs.String("base-url", visionBaseURL, "archive server (a mirror of data.binance.vision)")
+	var jobOpts jobOptions
+	jobOpts.register(fs, "")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: orderbook import -symbols <s,...> -from YYYY-MM-DD [-to YYYY-MM-DD] [flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	symbols := splitList(strings.ToLower(*symbolList))
+	if len(symbols) == 0 || *from == "" {
+		fs.Usage()
+		return fmt.Errorf("-symbols and -from are required")
+	}
+	first, err := time.Parse(dateLayout, *from)
+	if err != nil {
+		return fmt.Errorf("invalid -from: %w", err)
+	}
+	last := first
+	if *to != "" {
+		if last, err = time.Parse(dateLayout, *to); err != nil {
+			return fmt.Errorf("invalid -to: %w", err)
+		}
+	}
+	if last.Before(first) {
+		return fmt.Errorf("-to is before -from")
+	}
+	m, ok := visionMarkets[*market]
+	if !ok {
+		return fmt.Errorf("unknown -market %q (spot, usdm)", *market)
+	}
+	imp := &visionImport{
+		baseURL:    strings.TrimSuffix(*baseURL, "/"),
+		path:       m.path,
+		marketType: m.marketType,
+		trades:     *trades,
+		intervals:  splitList(*klines),
+		dataDir:    *dataDir,
+		keepText:   *keepDecimals,
+		force:      *force,
+	}
+	if !imp.trades && len(imp.intervals) == 0 {
+		return fmt.Errorf("nothing to import: enable -trades or -klines")
+	}
+	switch *compression {
+	case "none":
+		imp.compression = orderbook.Compression_COMPRESSION_NONE
+	case "zstd":
+		imp.compression = orderbook.Compression_COMPRESSION_ZSTD
+	default:
+		return fmt.Errorf("unknown compression %q", *compression)
+	}
+	if imp.rotation, err = newRotationPolicy(rotateDaily, 0, "", *instance, restartAppend); err != nil {
+		return err
+	}
+	// 아카이브는 수백 MB 일 수 있으므로 시간 제한 없이 받는다
+	client := *restClient
+	client.Timeout = 0
+	imp.client = &client
+
+	var units []jobUnit
+	for day := first; !day.After(last); day = day.AddDate(0, 0, 1) {
+		for _, symbol := range symbols {
+			units = append(units, jobUnit{name: symbol + " " + day.Format(dateLayout), size: 1})
+		}
+	}
+	ctx, stop := interruptContext()
+	defer stop()
+	key := fmt.Sprintf("%s %s %v %s %s", *dataDir, *market, *trades, *klines, *instance)
+	cp, err := openCheckpoint(jobOpts.checkpoint, "import", key, jobOpts.resume)
+	if err != nil {
+		return err
+	}
+	manifest := newManifestUpdater(*dataDir, nil)
+	return runJob(ctx, jobOpts, cp, units, func(ctx context.Context, u jobUnit, p *Progress) error {
+		defer p.Add(u.size)
+		symbol, date, _ := strings.Cut(u.name, " ")
+		day, _ := time.Parse(dateLayout, date)
+		path, err := imp.importDay(ctx, symbol, day)
+		if err != nil || path == "" {
+			return err
+		}
+		return manifest.add(path)
+	})
+}
+
+// 심볼의 하루를 파일 하나로 만든다. 만든 파일 경로를 돌려주고, 건너뛰었으면 "".
+func (imp *visionImport) importDay(ctx context.Context, symbol string, day time.Time) (string, error) {
+	target := imp.rotation.path(imp.dataDir, symbol, day, 0, "")
+	if _, err := os.Stat(target); err == nil {
+		if !imp.force {
+			log.Printf("%s already imported, skipping (use -force to rebuild)", target)
+			return "", nil
+		}
+		if err := os.Remove(target); err != nil {
+			return "", err
+		}
+		orderbook.RemoveSidecar(target)
+	}
+
+	// 캔들은 하루에 많아야 1440 개라 먼저 읽어 두고 체결 사이에 끼워 넣는다
+	var klines []*orderbook.Event
+	for _, interval := range imp.intervals {
+		name := fmt.Sprintf("%s-%s-%s.zip", strings.ToUpper(symbol), interval, day.Format(dateLayout))
+		err := imp.withArchive(ctx, "klines/"+strings.ToUpper(symbol)+"/"+interval+"/"+name, func(rows *csv.Reader) error {
+			return readVisionRows(rows, func(row []string) error {
+				ev, err := imp.klineEvent(symbol, interval, row)
+				if err == nil {
+					klines = append(klines, ev)
+				}
+				return err
+			})
+		})
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	// 구간마다 이미 시간순이지만 여러 구간을 섞으면 마감 시간으로 다시 정렬해야 한다
+	slices.SortStableFunc(klines, func(a, b *orderbook.Event) int { return cmp.Compare(a.EventTime, b.EventTime) })
+
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return "", err
+	}
+	tmp := target + ".tmp"
+	streams := make([]string, 0, 1+len(imp.intervals))
+	if imp.trades {
+		streams = append(streams, "trade")
+	}
+	for _, interval := range imp.intervals {
+		streams = append(streams, "kline_"+interval)
+	}
+	fw, err := orderbook.OpenFileWriter(tmp, &orderbook.FileHeader{
+		CreatedAt:   time.Now().UTC().UnixMilli(),
+		Symbol:      strings.ToUpper(symbol),
+		Exchange:    "binance",
+		MarketType:  imp.marketType,
+		SessionId:   "vision-" + day.Format(dateLayout),
+		Compression: imp.compression,
+		Streams:     streams,
+	})
+	if err != nil {
+		return "", err
+	}
+	var sequence uint64
+	write := func(ev *orderbook.Event) error {
+		sequence++
+		ev.Sequence = sequence
+		return fw.Write(ev)
+	}
+	flushKlines := func(before int64) error {
+		for len(klines) > 0 && klines[0].EventTime < before {
+			if err := write(klines[0]); err != nil {
+				return err
+			}
+			klines = klines[1:]
+		}
+		return nil
+	}
+
+	if imp.trades {
+		name := fmt.Sprintf("%s-trades-%s.zip", strings.ToUpper(symbol), day.Format(dateLayout))
+		err = imp.withArchive(ctx, "trades/"+strings.ToUpper(symbol)+"/"+name, func(rows *csv.Reader) error {
+			return readVisionRows(rows, func(row []string) error {
+				ev, err := imp.tradeEvent(symbol, row)
+				if err != nil {
+					return err
+				}
+				if err := flushKlines(ev.EventTime); err != nil {
+					return err
+				}
+				return write(ev)
+			})
+		})
+		if err != nil {
+			err = fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	if err == nil {
+		err = flushKlines(1<<63 - 1)
+	}
+	if cerr := fw.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && sequence == 0 {
+		log.Printf("No archives for %s on %s", symbol, day.Format(dateLayout))
+		os.Remove(tmp)
+		orderbook.RemoveSidecar(tmp)
+		return "", nil
+	}
+	if err == nil {
+		err = os.Rename(tmp, target)
+	}
+	orderbook.RemoveSidecar(tmp)
+	if err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	log.Printf("Imported %s: %d records", target, sequence)
+	return target, nil
+}
+
+// 아카이브를 임시 파일로 받아 체크섬을 확인하고 안의 CSV 를 fn 에 넘긴다. 아카이브가 없으면 아무것도 하지 않는다.
+func (imp *visionImport) withArchive(ctx context.Context, rel string, fn func(*csv.Reader) error) error {
+	url := imp.baseURL + "/data/" + imp.path + "/daily/" + rel
+	tmp, err := os.CreateTemp("", "vision-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := sha256.New()
+	found, err := imp.download(ctx, url, io.MultiWriter(tmp, h))
+	if err != nil || !found {
+		if err == nil {
+			log.Printf("No archive %s", url)
+		}
+		return err
+	}
+	var want string
+	var sum strings.Builder
+	if ok, err := imp.download(ctx, url+".CHECKSUM", &sum); err != nil {
+		return err
+	} else if ok {
+		want, _, _ = strings.Cut(strings.TrimSpace(sum.String()), " ")
+	}
+	switch got := hex.EncodeToString(h.Sum(nil)); {
+	case want == "":
+		log.Printf("No checksum for %s, importing unverified", url)
+	case !strings.EqualFold(got, want):
+		return fmt.Errorf("checksum mismatch: got %s, want %s", got, want)
+	}
+
+	size, err := tmp.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	zr, err := zip.NewReader(tmp, size)
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		if !strings.HasSuffix(f.Name, ".csv") {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		rows := csv.NewReader(bufio.NewReaderSize(rc, 1<<16))
+		rows.ReuseRecord = true
+		rows.FieldsPerRecord = -1
+		err = fn(rows)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 404 면 false
+func (imp *visionImport) download(ctx context.Context, url string, w io.Writer) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := imp.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err == nil, err
+}
+
+// 선물 아카이브의 머리글 줄은 건너뛴다
+func readVisionRows(rows *csv.Reader, fn func(row []string) error) error {
+	for line := 1; ; line++ {
+		row, err := rows.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(row) > 0 && line == 1 {
+			if _, err := strconv.ParseInt(row[0], 10, 64); err != nil {
+				continue
+			}
+		}
+		if err := fn(row); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+}
+
+// 아카이브의 시간을 UTC ns 로. 2025년부터의 현물 아카이브는 마이크로초다.
+func visionTime(s string) (int64, error) {
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if v >= 1e14 {
+		return v * int64(time.Microsecond), nil
+	}
+	return v * int64(time.Millisecond), nil
+}
+
+// id, price, qty, quoteQty, time, isBuyerMaker[, isBestMatch]
+func (imp *visionImport) tradeEvent(symbol string, row []string) (*orderbook.Event, error) {
+	if len(row) < 6 {
+		return nil, fmt.Errorf("trade row has %d fields", len(row))
+	}
+	id, err := strconv.ParseInt(row[0], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	ns, err := visionTime(row[4])
+	if err != nil {
+		return nil, err
+	}
+	ms := ns / int64(time.Millisecond)
+	trade := &orderbook.Trade{
+		TradeId:      id,
+		Price:        parseFloat(row[1]),
+		Quantity:     parseFloat(row[2]),
+		TradeTime:    ms,
+		BuyerIsMaker: strings.EqualFold(row[5], "true"),
+	}
+	if imp.keepText {
+		trade.PriceText, trade.QuantityText = strings.Clone(row[1]), strings.Clone(row[2])
+	}
+	return &orderbook.Event{
+		EventTime:     ms,
+		ReceiveTimeNs: ns,
+		Symbol:        strings.ToUpper(symbol),
+		Exchange:      "binance",
+		MarketType:    imp.marketType,
+		StreamType:    "trade",
+		ExchangeTime:  ms,
+		Payload:       &orderbook.Event_Trade{Trade: trade},
+	}, nil
+}
+
+// openTime, open, high, low, close, volume, closeTime, quoteVolume, count, takerBuyVolume, takerBuyQuoteVolume, ignore
+// 를 라이브 kline 스트림의 닫힌 캔들 메시지로 만든다
+func (imp *visionImport) klineEvent(symbol, interval string, row []string) (*orderbook.Event, error) {
+	if len(row) < 11 {
+		return nil, fmt.Errorf("kline row has %d fields", len(row))
+	}
+	openNs, err := visionTime(row[0])
+	if err != nil {
+		return nil, err
+	}
+	closeNs, err := visionTime(row[6])
+	if err != nil {
+		return nil, err
+	}
+	count, err := strconv.ParseInt(row[8], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	upper := strings.ToUpper(symbol)
+	closeMs := closeNs / int64(time.Millisecond)
+	b := append([]byte(nil), `{"e":"kline","E":`...)
+	b = strconv.AppendInt(b, closeMs, 10)
+	b = appendJSONString(append(b, `,"s":`...), upper)
+	b = append(b, `,"k":{"t":`...)
+	b = strconv.AppendInt(b, openNs/int64(time.Millisecond), 10)
+	b = append(b, `,"T":`...)
+	b = strconv.AppendInt(b, closeMs, 10)
+	b = appendJSONString(append(b, `,"s":`...), upper)
+	b = appendJSONString(append(b, `,"i":`...), interval)
+	for _, f := range []struct {
+		key   string
+		value string
+	}{{"o", row[1]}, {"c", row[4]}, {"h", row[2]}, {"l", row[3]}, {"v", row[5]}} {
+		b = appendJSONString(append(b, `,"`+f.key+`":`...), f.value)
+	}
+	b = append(b, `,"n":`...)
+	b = strconv.AppendInt(b, count, 10)
+	b = append(b, `,"x":true`...)
+	b = appendJSONString(append(b, `,"q":`...), row[7])
+	b = appendJSONString(append(b, `,"V":`...), row[9])
+	b = appendJSONString(append(b, `,"Q":`...), row[10])
+	b = append(b, `}}`...)
+	return &orderbook.Event{
+		EventTime:     closeMs,
+		ReceiveTimeNs: closeNs,
+		Symbol:        upper,
+		Exchange:      "binance",
+		MarketType:    imp.marketType,
+		StreamType:    "kline_" + interval,
+		ExchangeTime:  closeMs,
+		Payload: &orderbook.Event_Record{Record: &orderbook.Record{
+			Type:     "binance.kline_" + interval,
+			Encoding: "json",
+			Data:     b,
+		}},
+	}, nil
+}
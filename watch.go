@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+	"orderbook/orderbook"
+)
+
+// orderbook watch <symbol> : 지금 수집 중인 책을 터미널에서 본다. 상위 N 호가를 수량 막대와 함께 그리고
+// 스프레드, 중간가, 초당 업데이트 수, 지연, 마지막 체결을 보여 준다.
+//
+//	orderbook watch ethusdt                          로컬 수집기가 쓰고 있는 파일을 따라 읽는다 (tail.go)
+//	orderbook watch -grpc host:9090 ethusdt          수집기(collect -grpc)의 StreamLive 를 받는다 (grpcfeed.go)
+//	orderbook watch -day 2024-05-01 -speed 10 ethusdt 기록된 구간을 재생한다 (되감기, 이동은 view)
+//
+// 시작할 때 -lookback 만큼 앞의 기록부터 읽어 스냅샷을 먼저 채운다 (gRPC 는 수집기 캐시에 있을 때만).
+// 증분(depth@...)만 따라오는 책은 순번이 끊기면 다음 스냅샷까지 낡았다고 표시한다.
+// 책 이벤트가 없고 bookTicker 만 있으면 최우선 호가만 그린다.
+//
+//	space  화면 멈춤 / 다시 (멈춘 동안에도 이벤트는 계속 반영한다)
+//	+, -   호가 단계 수 늘리기 / 줄이기
+//	q      종료
+
+func runWatch(args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	dataDir := fs.String("data", defaultDataDir, "data directory to follow")
+	grpcAddr := fs.String("grpc", "", "watch a collector started with -grpc at this address instead of following local files")
+	token := fs.String("token", "", "bearer token for -grpc")
+	lookback := fs.Duration("lookback", time.Minute, "start this far in the past so the first snapshot is on screen")
+	var rng rangeFlags
+	rng.register(fs)
+	speed := fs.Float64("speed", 1, "with -from/-to or -day, replay pacing (1 = recorded pace, 0 = as fast as possible)")
+	depth := fs.Int("depth", 10, "levels to show per side")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: orderbook watch [flags] <symbol>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected one symbol")
+	}
+	symbol := strings.ToLower(fs.Arg(0))
+	if *depth <= 0 {
+		return fmt.Errorf("-depth must be positive")
+	}
+
+	var feed Feed
+	source := "following " + *dataDir
+	since := time.Now().Add(-*lookback).UnixMilli()
+	switch {
+	case rng.from != "" || rng.day != "":
+		from, to, err := rng.resolve()
+		if err != nil {
+			return err
+		}
+		feed, source = NewReplayFeed(*dataDir, from, to, *speed), fmt.Sprintf("replay %s x%g", rng.String(), *speed)
+	case *grpcAddr != "":
+		feed, source = NewGRPCFeed(*grpcAddr, *token, since), "collector "+*grpcAddr
+	default:
+		feed = NewTailFeed(*dataDir, since)
+	}
+
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return fmt.Errorf("watch needs an interactive terminal")
+	}
+	state, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return err
+	}
+	defer term.Restore(int(os.Stdin.Fd()), state)
+	fmt.Print("\x1b[?25l\x1b[2J") // 커서 숨김, 화면 지움
+	defer fmt.Print("\x1b[?25h\r\n")
+
+	// 피드의 로그(재연결, 따라 읽는 파일)는 화면을 깨뜨리므로 상태 줄에 보인다
+	status := &watchStatus{}
+	log.SetOutput(status)
+	defer log.SetOutput(os.Stderr)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := feed.Subscribe(symbol)
+	errc := make(chan error, 1)
+	go func() { errc <- feed.Run(ctx) }()
+
+	w := &bookWatcher{symbol: symbol, source: source, depth: *depth, status: status, book: orderbook.NewBook()}
+	return w.run(events, errc, readKeys(os.Stdin))
+}
+
+// 로그의 마지막 줄을 상태 줄에 보이려고 받아 둔다
+type watchStatus struct {
+	mu   sync.Mutex
+	last string
+}
+
+func (s *watchStatus) Write(b []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	line := strings.TrimSpace(string(b))
+	if _, msg, ok := strings.Cut(line, " "); ok { // 로그의 날짜, 시각은 뺀다
+		if _, msg, ok = strings.Cut(msg, " "); ok {
+			line = msg
+		}
+	}
+	s.last = line
+	return len(b), nil
+}
+
+func (s *watchStatus) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.last
+}
+
+type bookWatcher struct {
+	symbol, source string
+	depth          int
+	status         *watchStatus
+
+	book      *orderbook.Book
+	hasBook   bool
+	bookGap   bool
+	hasDepth  bool // 스냅샷이나 증분을 받았다. 그 뒤로는 bookTicker 로 책을 바꾸지 않는다
+	lastEvent *orderbook.Event
+	lastTrade *orderbook.Trade
+	frozen    bool
+	ended     string
+
+	count int     // 지금 1초 동안 받은 이벤트 수
+	rate  float64 // 지난 1초의 이벤트 수
+}
+
+func (w *bookWatcher) run(events <-chan *orderbook.Event, errc <-chan error, keys <-chan string) error {
+	render := time.NewTicker(100 * time.Millisecond)
+	defer render.Stop()
+	second := time.NewTicker(time.Second)
+	defer second.Stop()
+	dirty := true
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				events = nil
+				w.ended = "end of data"
+				if err := <-errc; err != nil && err != context.Canceled {
+					w.ended = err.Error()
+				}
+				dirty = true
+				continue
+			}
+			w.apply(ev)
+			w.count++
+			dirty = true
+		case k, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			switch k {
+			case "q", "ctrl-c":
+				return nil
+			case " ":
+				w.frozen = !w.frozen
+			case "+", "=":
+				w.depth++
+			case "-":
+				w.depth = max(w.depth-1, 1)
+			}
+			dirty = true
+		case <-second.C:
+			w.rate, w.count = float64(w.count), 0
+			dirty = true
+		case <-render.C:
+			if dirty && !w.frozen {
+				w.render()
+				dirty = false
+			}
+		}
+	}
+}
+
+func (w *bookWatcher) apply(ev *orderbook.Event) {
+	w.lastEvent = ev
+	switch pl := ev.Payload.(type) {
+	case *orderbook.Event_Snapshot:
+		w.book.LoadSnapshot(pl.Snapshot)
+		w.hasBook, w.bookGap, w.hasDepth = true, false, true
+	case *orderbook.Event_DepthDiff:
+		w.hasDepth = true
+		if w.hasBook {
+			if _, err := w.book.ApplyDiff(pl.DepthDiff); err != nil {
+				w.bookGap = true
+			}
+		}
+	case *orderbook.Event_BookTicker:
+		if !w.hasDepth {
+			t := pl.BookTicker
+			w.book.LoadSnapshot(&orderbook.Snapshot{
+				LastUpdateId: t.UpdateId,
+				Bids:         []*orderbook.Level{{Price: t.BidPrice, Quantity: t.BidQuantity, PriceText: t.BidPriceText, QuantityText: t.BidQuantityText}},
+				Asks:         []*orderbook.Level{{Price: t.AskPrice, Quantity: t.AskQuantity, PriceText: t.AskPriceText, QuantityText: t.AskQuantityText}},
+			})
+			w.hasBook = true
+		}
+	case *orderbook.Event_Trade:
+		w.lastTrade = pl.Trade
+	}
+}
+
+func (w *bookWatcher) render() {
+	width, _, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width < 60 {
+		width = 80
+	}
+	var b strings.Builder
+	line := func(format string, args ...any) {
+		fmt.Fprintf(&b, format, args...)
+		b.WriteString("\x1b[K\r\n")
+	}
+	b.WriteString("\x1b[H")
+
+	at := "-"
+	if ev := w.lastEvent; ev != nil {
+		at = time.UnixMilli(ev.EventTime).In(displayLoc).Format("15:04:05.000 MST")
+	}
+	line("\x1b[1m%s\x1b[0m  %s  %s  %.0f updates/s", strings.ToUpper(w.symbol), w.source, at, w.rate)
+	line("")
+
+	if !w.hasBook {
+		line("  (waiting for a snapshot)")
+	} else {
+		asks, bids := w.book.TopAsks(w.depth), w.book.TopBids(w.depth)
+		maxQty := 0.0
+		for _, l := range append(asks[:len(asks):len(asks)], bids...) {
+			maxQty = max(maxQty, l.Quantity)
+		}
+		barWidth := width - 40
+		bar := func(q float64) string {
+			if maxQty <= 0 {
+				return ""
+			}
+			return strings.Repeat("█", max(int(math.Round(q/maxQty*float64(barWidth))), 1))
+		}
+		for i := w.depth - 1; i >= 0; i-- {
+			if i >= len(asks) {
+				line("")
+				continue
+			}
+			line("  \x1b[31m%16s  %16s  %s\x1b[0m", asks[i].PriceString(), asks[i].QuantityString(), bar(asks[i].Quantity))
+		}
+		spread := ""
+		if len(asks) > 0 && len(bids) > 0 {
+			bid, ask := bids[0].Price, asks[0].Price
+			mid := (bid + ask) / 2
+			spread = fmt.Sprintf("spread %.10g (%.2f bps)  mid %.10g", ask-bid, (ask-bid)/mid*1e4, mid)
+		}
+		if w.bookGap {
+			spread += "  \x1b[33m(sequence gap, book may be stale)\x1b[0m"
+		}
+		line("  %s", spread)
+		for i := range w.depth {
+			if i >= len(bids) {
+				line("")
+				continue
+			}
+			line("  \x1b[32m%16s  %16s  %s\x1b[0m", bids[i].PriceString(), bids[i].QuantityString(), bar(bids[i].Quantity))
+		}
+	}
+	line("")
+	if t := w.lastTrade; t != nil {
+		side, color := "buy", "32"
+		if t.BuyerIsMaker {
+			side, color = "sell", "31"
+		}
+		line("last trade  \x1b[%sm%s %s @ %s\x1b[0m", color, side, orderbook.DecimalText(t.QuantityText, t.Quantity), orderbook.DecimalText(t.PriceText, t.Price))
+	} else {
+		line("")
+	}
+	if ev := w.lastEvent; ev != nil && ev.ExchangeTime != 0 && ev.LatencyUs != 0 {
+		line("latency     %.1f ms (%s)", float64(ev.LatencyUs)/1000, ev.StreamType)
+	} else {
+		line("")
+	}
+	line("")
+	switch {
+	case w.ended != "":
+		line("%s  (q quit)", w.ended)
+	case w.frozen:
+		line("FROZEN  space resume  q quit")
+	default:
+		line("space freeze  +/- levels  q quit  %s", w.status.String())
+	}
+	b.WriteString("\x1b[J")
+	os.Stdout.WriteString(b.String())
+}
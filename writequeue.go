@@ -0,0 +1,328 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"orderbook/orderbook"
+)
+
+// 수신 루프와 디스크 쓰기를 떼어 놓는 심볼별 쓰기 큐.
+// 수신 루프는 이벤트를 큐에 넣기만 하고, 심볼마다 writer 고루틴이 쌓인 이벤트를 한꺼번에 꺼내 파일에 쓴다.
+// 파일 버퍼는 -flush-bytes 가 차거나 -flush-interval 마다 OS 로 내려보낸다. 그 전까지는 파일을 읽는 쪽
+// (api, tail, 사이드카 인덱스)에 보이지 않으므로, 최근 이벤트는 메모리 캐시로 본다.
+//
+// -write-queue 0 이면 예전처럼 수신 루프에서 바로 쓰고 이벤트마다 내려보낸다.
+//
+// 디스크가 따라오지 못해 큐가 가득 차면 -write-overflow 를 따른다.
+//
+//	block        자리가 날 때까지 수신 루프가 기다린다 (기본). 잃는 것은 없지만 수신이 밀린다
+//	drop-oldest  큐에서 가장 오래된 이벤트를 버리고 넣는다
+//	drop-newest  새 이벤트를 버린다
+//	spill        새 이벤트를 -spill-dir 의 data/ (tick 은 ticks/) 에 바로 쓴다. 같은 형식의 데이터 디렉터리라
+//	             -data 로 따로 읽을 수 있고, 순번이 그대로라 본 파일의 순번 공백과 맞춰 볼 수 있다
+//
+// 버린 이벤트는 순번 공백으로 남는다. 큐마다 쌓인 수, 버린 수, 넘긴 수, 기다린 횟수와 시간은
+// expvar "write_queues" 로 볼 수 있다.
+//
+// 내려보낸 데이터도 OS 페이지 캐시에 있을 뿐이라 전원이 나가면 잃을 수 있다. -fsync 로 디스크 기록을 정한다.
+//
+//	never        fsync 하지 않는다 (기본). 처리량이 가장 좋다
+//	interval     파일마다 -fsync-interval 마다, 그리고 파일을 닫을 때
+//	every-write  쓸 때마다. 큐가 있으면 한 번에 꺼낸 묶음마다 (큐에 남은 이벤트는 아직 기록되지 않았다)
+//
+// zstd 파일은 압축 중인 블록이 닫힐 때까지(256KB 나 10초) 메모리에 있으므로 어느 정책이든 그 블록은 들어가지 않는다.
+
+const (
+	overflowBlock      = "block"
+	overflowDropOldest = "drop-oldest"
+	overflowDropNewest = "drop-newest"
+	overflowSpill      = "spill"
+)
+
+const (
+	fsyncNever      = "never"
+	fsyncInterval   = "interval"
+	fsyncEveryWrite = "every-write"
+)
+
+type writeOptions struct {
+	Queue         int
+	FlushInterval time.Duration
+	FlushBytes    int64
+	Fsync         string
+	FsyncInterval time.Duration
+	Overflow      string
+	SpillDir      string
+	FailoverDir   string
+	flushBytes    string
+}
+
+func (o *writeOptions) register(fs *flag.FlagSet) {
+	fs.IntVar(&o.Queue, "write-queue", 10000, "events buffered per symbol between the stream reader and the file writer; 0 writes and flushes every event inline")
+	fs.DurationVar(&o.FlushInterval, "flush-interval", time.Second, "with a write queue, flush buffered file data to the OS at least this often; 0 flushes only when -flush-bytes fill up")
+	fs.StringVar(&o.flushBytes, "flush-bytes", "1MB", "with a write queue, file buffer size per symbol; a full buffer is flushed to the OS")
+	fs.StringVar(&o.Fsync, "fsync", fsyncNever, "when data files are fsynced to disk: never, interval (every -fsync-interval and on close) or every-write (every event, or every batch with a write queue)")
+	fs.DurationVar(&o.FsyncInterval, "fsync-interval", time.Second, "fsync period for -fsync interval")
+	fs.StringVar(&o.Overflow, "write-overflow", overflowBlock, "when a symbol's write queue is full: block (the stream reader waits), drop-oldest, drop-newest or spill (write to -spill-dir instead)")
+	fs.StringVar(&o.SpillDir, "spill-dir", "", "secondary data directory for -write-overflow spill, ideally on another disk")
+	fs.StringVar(&o.FailoverDir, "failover-dir", "", "on a write error (e.g. disk full) switch data files to this directory until restart; empty drops events and retries")
+}
+
+func (o *writeOptions) parse() error {
+	n, err := parseBytes(o.flushBytes)
+	if err != nil {
+		return err
+	}
+	o.FlushBytes = n
+	switch {
+	case o.Queue < 0:
+		return fmt.Errorf("-write-queue must not be negative")
+	case o.FlushInterval < 0:
+		return fmt.Errorf("-flush-interval must not be negative")
+	case o.Queue > 0 && o.FlushBytes <= 0:
+		return fmt.Errorf("-flush-bytes must be positive")
+	case o.Fsync != fsyncNever && o.Fsync != fsyncInterval && o.Fsync != fsyncEveryWrite:
+		return fmt.Errorf("unknown fsync policy %q (never, interval, every-write)", o.Fsync)
+	case o.Fsync == fsyncInterval && o.FsyncInterval <= 0:
+		return fmt.Errorf("-fsync-interval must be positive")
+	case o.Overflow != overflowBlock && o.Overflow != overflowDropOldest && o.Overflow != overflowDropNewest && o.Overflow != overflowSpill:
+		return fmt.Errorf("unknown write overflow policy %q (block, drop-oldest, drop-newest, spill)", o.Overflow)
+	case o.Overflow != overflowBlock && o.Queue == 0:
+		return fmt.Errorf("-write-overflow %s needs a write queue (-write-queue > 0)", o.Overflow)
+	case o.Overflow == overflowSpill && o.SpillDir == "":
+		return fmt.Errorf("-write-overflow spill needs -spill-dir")
+	}
+	return nil
+}
+
+// 넘친 이벤트를 dir 에 바로 쓰는 FileManager. 큐 없이 쓰고 fsync 정책은 따른다.
+func (o *writeOptions) spillManager(dir string, compression orderbook.Compression, rotation *rotationPolicy) *FileManager {
+	fm := NewFileManager(dir, compression, rotation)
+	fm.writes = writeOptions{Fsync: o.Fsync, FsyncInterval: o.FsyncInterval, Overflow: overflowBlock}
+	return fm
+}
+
+// 쓰기 큐의 writer 고루틴이 깨어나 내려보내고 fsync 할 주기. 0 이면 쓸 것이 올 때만 깨어난다.
+func (o *writeOptions) tickInterval() time.Duration {
+	d := o.FlushInterval
+	if o.Fsync == fsyncInterval && (d == 0 || o.FsyncInterval < d) {
+		d = o.FsyncInterval
+	}
+	return d
+}
+
+// 한 번에 꺼내 쓰는 최대 이벤트 수. 그동안 fm.mu 를 잡고 있으므로 너무 크지 않게 한다.
+const writeBatchSize = 512
+
+// 넘침을 로그로 알리는 최소 간격
+const overflowLogInterval = time.Minute
+
+type writeQueue struct {
+	events chan *orderbook.Event
+	done   chan struct{}
+
+	dropped, spilled, blocked, blockedNs atomic.Int64
+	warnedAt                             atomic.Int64 // 마지막으로 넘침을 로그로 남긴 시각 (UnixNano)
+}
+
+type writeQueueStatus struct {
+	Symbol    string `json:"symbol"`
+	Queued    int    `json:"queued"`
+	Capacity  int    `json:"capacity"`
+	Dropped   int64  `json:"dropped"`
+	Spilled   int64  `json:"spilled"`
+	Blocked   int64  `json:"blocked"`
+	BlockedMs int64  `json:"blockedMs"`
+}
+
+// 심볼의 큐에 넣는다. 가득 차 있으면 -write-overflow 를 따른다. 닫힌 뒤(종료 중)에 들어온 이벤트는 버린다.
+func (fm *FileManager) enqueue(symbol string, ev *orderbook.Event) {
+	q := fm.queueFor(symbol)
+	// 닫히는 동안 보내지 않도록 읽기 잠금을 잡은 채 넣는다
+	fm.queueMu.RLock()
+	defer fm.queueMu.RUnlock()
+	if q == nil || fm.queuesClosed {
+		fm.dropLate(symbol, ev)
+		return
+	}
+	select {
+	case q.events <- ev:
+		return
+	default:
+	}
+	q.warn(symbol, fm.writes.Overflow)
+	switch fm.writes.Overflow {
+	case overflowDropNewest:
+		q.dropped.Add(1)
+	case overflowDropOldest:
+		for {
+			select {
+			case q.events <- ev:
+				return
+			default:
+			}
+			select {
+			case <-q.events:
+				q.dropped.Add(1)
+			default:
+			}
+		}
+	case overflowSpill:
+		fm.spill.writeEvent(symbol, ev)
+		q.spilled.Add(1)
+	default:
+		start := time.Now()
+		q.events <- ev
+		q.blocked.Add(1)
+		q.blockedNs.Add(int64(time.Since(start)))
+	}
+}
+
+func (q *writeQueue) warn(symbol, policy string) {
+	now := time.Now().UnixNano()
+	last := q.warnedAt.Load()
+	if now-last < int64(overflowLogInterval) || !q.warnedAt.CompareAndSwap(last, now) {
+		return
+	}
+	log.Printf("Write queue for %s is full (%d events), overflow %s: %d dropped, %d spilled, %d blocked so far",
+		symbol, cap(q.events), policy, q.dropped.Load(), q.spilled.Load(), q.blocked.Load())
+}
+
+func (fm *FileManager) queueStatus() []writeQueueStatus {
+	fm.queueMu.RLock()
+	defer fm.queueMu.RUnlock()
+	out := []writeQueueStatus{}
+	for symbol, q := range fm.queues {
+		out = append(out, writeQueueStatus{
+			Symbol:    symbol,
+			Queued:    len(q.events),
+			Capacity:  cap(q.events),
+			Dropped:   q.dropped.Load(),
+			Spilled:   q.spilled.Load(),
+			Blocked:   q.blocked.Load(),
+			BlockedMs: time.Duration(q.blockedNs.Load()).Milliseconds(),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Symbol < out[j].Symbol })
+	return out
+}
+
+// 심볼의 큐. 없으면 writer 고루틴과 함께 만든다. 닫혔으면 nil.
+func (fm *FileManager) queueFor(symbol string) *writeQueue {
+	symbolLower := strings.ToLower(symbol)
+	fm.queueMu.RLock()
+	q := fm.queues[symbolLower]
+	fm.queueMu.RUnlock()
+	if q != nil {
+		return q
+	}
+	fm.queueMu.Lock()
+	defer fm.queueMu.Unlock()
+	if fm.queuesClosed {
+		return nil
+	}
+	if q = fm.queues[symbolLower]; q == nil {
+		q = &writeQueue{events: make(chan *orderbook.Event, fm.writes.Queue), done: make(chan struct{})}
+		fm.queues[symbolLower] = q
+		go fm.runQueue(symbol, q)
+	}
+	return q
+}
+
+func (fm *FileManager) runQueue(symbol string, q *writeQueue) {
+	defer close(q.done)
+	var tick <-chan time.Time
+	if d := fm.writes.tickInterval(); d > 0 {
+		t := time.NewTicker(d)
+		defer t.Stop()
+		tick = t.C
+	}
+	batch := make([]*orderbook.Event, 0, writeBatchSize)
+	for {
+		select {
+		case ev, ok := <-q.events:
+			if !ok {
+				return
+			}
+			batch = append(batch[:0], ev)
+			// 이미 쌓여 있는 것을 함께 꺼낸다 (닫힌 뒤에도 남은 것은 꺼낼 수 있다)
+			for n := len(q.events); n > 0 && len(batch) < writeBatchSize; n-- {
+				batch = append(batch, <-q.events)
+			}
+			fm.writeBatch(symbol, batch)
+		case <-tick:
+			fm.flushFile(symbol)
+		}
+	}
+}
+
+func (fm *FileManager) writeBatch(symbol string, batch []*orderbook.Event) {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	var writer *orderbook.FileWriter
+	for _, ev := range batch {
+		if w := fm.writeLocked(symbol, ev); w != nil {
+			writer = w
+		}
+	}
+	if writer != nil {
+		fm.syncFile(symbol, writer, fm.writes.Fsync == fsyncEveryWrite)
+		fm.maintainSidecar(symbol, writer)
+	}
+}
+
+func (fm *FileManager) flushFile(symbol string) {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	if fw, ok := fm.writers[strings.ToLower(symbol)]; ok {
+		start := time.Now()
+		if err := fw.Flush(); err != nil {
+			fm.writeFailed(symbol, err)
+			return
+		}
+		pipelineTelemetry.timed("flush", start)
+		fm.syncFile(symbol, fw, false)
+	}
+}
+
+// -fsync 정책에 따라 파일을 디스크에 기록한다. now 면 every-write 처럼 바로, 아니면 interval 정책에서 간격이 지났을 때만.
+// fm.mu 를 잡은 상태에서 호출해야 한다.
+func (fm *FileManager) syncFile(symbol string, fw *orderbook.FileWriter, now bool) {
+	symbolLower := strings.ToLower(symbol)
+	switch {
+	case now:
+	case fm.writes.Fsync == fsyncInterval && time.Since(fm.synced[symbolLower]) >= fm.writes.FsyncInterval:
+	default:
+		return
+	}
+	start := time.Now()
+	fm.synced[symbolLower] = start
+	if err := fw.Sync(); err != nil {
+		fm.writeFailed(symbol, err)
+		return
+	}
+	pipelineTelemetry.timed("fsync", start)
+}
+
+// 큐를 닫고 writer 고루틴이 남은 이벤트를 다 쓸 때까지 기다린다. 이후에 들어오는 이벤트는 버린다.
+func (fm *FileManager) stopQueues() {
+	fm.queueMu.Lock()
+	fm.queuesClosed = true
+	queues := fm.queues
+	for _, q := range queues {
+		close(q.events)
+	}
+	fm.queueMu.Unlock()
+	for symbol, q := range queues {
+		if n := len(q.events); n > 0 {
+			log.Printf("Writing %d queued events for %s...", n, symbol)
+		}
+		<-q.done
+	}
+}